@@ -12,6 +12,8 @@
 // Package api provides basic API structs for the REST services
 package api
 
+import "time"
+
 const (
 	// PathBlockingStatusPath defines the REST endpoint for blocking status
 	PathBlockingStatusPath = "/api/blocking/status"
@@ -25,11 +27,38 @@ const (
 	// PathListsRefresh defines the REST endpoint for blocking refresh
 	PathListsRefresh = "/api/lists/refresh"
 
+	// PathListGroupRefresh defines the REST endpoint for the refresh of one list group
+	PathListGroupRefresh = "/api/lists/{group}/refresh"
+
+	// PathListHitsPath defines the REST endpoint for the matches per list source
+	PathListHitsPath = "/api/lists/hits"
+
+	// PathListsExportPath defines the REST endpoint for the export of the blacklist entries of a group
+	PathListsExportPath = "/api/lists/export"
+
+	// PathListsCustomBlock defines the REST endpoint for the domains blocked at runtime
+	PathListsCustomBlock = "/api/lists/custom/block"
+
+	// PathQuotaStatusPath defines the REST endpoint for the query quota status
+	PathQuotaStatusPath = "/api/quota/status"
+
+	// PathBlockingStatisticsPath defines the REST endpoint for the blocked queries over time
+	PathBlockingStatisticsPath = "/api/blocking/statistics"
+
+	// PathCacheEntriesPath defines the REST endpoint for the cache entries
+	PathCacheEntriesPath = "/api/cache/entries"
+
+	// PathResolversPath defines the REST endpoint for the resolver chain
+	PathResolversPath = "/api/resolvers"
+
 	// PathQueryPath defines the REST endpoint for query
 	PathQueryPath = "/api/query"
 
 	// PathDohQuery DoH Url
 	PathDohQuery = "/dns-query"
+
+	// PathReadiness defines the endpoint for readiness check
+	PathReadiness = "/readyz"
 )
 
 // QueryRequest is a data structure for a DNS request
@@ -50,6 +79,28 @@ type QueryResult struct {
 	Response string `json:"response"`
 	// DNS return code (NOERROR, NXDOMAIN, ...)
 	ReturnCode string `json:"returnCode"`
+	// time spent in each resolver of the chain
+	Timings []ResolverTiming `json:"timings,omitempty"`
+}
+
+// ResolverTiming is a data structure for the time spent in a resolver
+type ResolverTiming struct {
+	// resolver name
+	Resolver string `json:"resolver"`
+	// time spent in the resolver without the next resolvers in ms
+	DurationMs float64 `json:"durationMs"`
+	// time spent in the resolver including the next resolvers in ms
+	TotalMs float64 `json:"totalMs"`
+}
+
+// ResolverInfo represents one resolver of the resolver chain
+type ResolverInfo struct {
+	// resolver name
+	Name string `json:"name"`
+	// False if the resolver is deactivated by the configuration
+	Active bool `json:"active"`
+	// configuration summary of the resolver
+	Configuration []string `json:"configuration"`
 }
 
 // BlockingStatus represents the current blocking status
@@ -60,4 +111,92 @@ type BlockingStatus struct {
 	DisabledGroups []string `json:"disabledGroups"`
 	// If blocking is temporary disabled: amount of seconds until blocking will be enabled
 	AutoEnableInSec uint `json:"autoEnableInSec"`
+	// Groups which can't be disabled
+	AlwaysOnGroups []string `json:"alwaysOnGroups,omitempty"`
+}
+
+// ListRefreshResult represents the result of the refresh of one list source
+type ListRefreshResult struct {
+	// List type (blacklist, whitelist)
+	ListType string `json:"listType"`
+	// Link, file or "[INLINE DEFINITION]"
+	Source string `json:"source"`
+	// Amount of imported entries
+	Entries int `json:"entries"`
+	// Error message if the source can't be imported
+	Error string `json:"error,omitempty"`
+}
+
+// ListSourceHits represents the amount of matches of one list source
+type ListSourceHits struct {
+	// List type (blacklist, whitelist)
+	ListType string `json:"listType"`
+	// Name of the list group
+	Group string `json:"group"`
+	// Link, file or "[INLINE DEFINITION]"
+	Source string `json:"source"`
+	// Amount of matches since the start
+	Hits uint64 `json:"hits"`
+}
+
+// ClientQuotaStatus represents the daily query quota status of a client
+type ClientQuotaStatus struct {
+	// Client name or IP address
+	Client string `json:"client"`
+	// Amount of queries allowed per day
+	Limit uint `json:"limit"`
+	// Amount of queries performed today
+	Used uint `json:"used"`
+	// Amount of remaining queries until the quota will be reset at midnight
+	Remaining uint `json:"remaining"`
+}
+
+// CacheEntry represents a cached DNS response
+type CacheEntry struct {
+	// Cached domain name
+	Name string `json:"name"`
+	// Query type (A, AAAA, ...)
+	Type string `json:"type"`
+	// Types of the cached records
+	RecordTypes []string `json:"recordTypes"`
+	// DNS return code (NOERROR, NXDOMAIN)
+	ReturnCode string `json:"returnCode"`
+	// Amount of seconds until the entry expires
+	RemainingTTLInSec uint `json:"remainingTTLInSec"`
+	// Set if the answer was resolved with DO bit and contains the DNSSEC records
+	DNSSEC bool `json:"dnssec,omitempty"`
+}
+
+// CacheEntries is a page of cache entries matching the filter
+type CacheEntries struct {
+	// Total count of matching entries
+	Total int `json:"total"`
+	// Entries of the requested page
+	Entries []CacheEntry `json:"entries"`
+}
+
+// BlockingStatistics represents the amount of blocked queries in a time interval
+type BlockingStatistics struct {
+	// Start of the interval (hour or day)
+	Start time.Time `json:"start"`
+	// Amount of blocked queries in the interval
+	Blocked uint `json:"blocked"`
+}
+
+// DynamicBlockRequest represents a request to block a domain at runtime
+type DynamicBlockRequest struct {
+	// Domain to block, including all subdomains
+	Domain string `json:"domain"`
+	// Optional duration of the block, e.g. "30m" or "2h". Uses the configured default if empty
+	TTL string `json:"ttl,omitempty"`
+}
+
+// DynamicBlock represents a domain blocked at runtime
+type DynamicBlock struct {
+	// Blocked domain (including all subdomains)
+	Domain string `json:"domain"`
+	// Expiration time of the block
+	Expires time.Time `json:"expires"`
+	// Amount of seconds until the block expires
+	RemainingTTLInSec uint `json:"remainingTTLInSec"`
 }
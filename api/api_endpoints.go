@@ -1,8 +1,11 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,6 +15,13 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	defaultCacheEntriesLimit = 100
+	maxCacheEntriesLimit     = 1000
+
+	jsonContentType = "application/json"
+)
+
 // BlockingControl interface to control the blocking status
 type BlockingControl interface {
 	EnableBlocking()
@@ -24,6 +34,42 @@ type ListRefresher interface {
 	RefreshLists()
 }
 
+// ListGroupRefresher interface to refresh the lists of one group
+type ListGroupRefresher interface {
+	RefreshListGroup(group string) ([]ListRefreshResult, error)
+}
+
+// ListHitsProvider interface to get the amount of matches per list source
+type ListHitsProvider interface {
+	ListHits() []ListSourceHits
+}
+
+// ListExporter interface to iterate the loaded blacklist entries of a group
+type ListExporter interface {
+	ExportList(group string, fn func(entry string)) error
+}
+
+// DynamicBlockControl interface to block domains at runtime
+type DynamicBlockControl interface {
+	BlockDomain(domain string, ttl time.Duration) error
+	DynamicBlocks() []DynamicBlock
+}
+
+// QuotaStatusProvider interface to get the query quota status of the clients
+type QuotaStatusProvider interface {
+	QuotaStatus() []ClientQuotaStatus
+}
+
+// BlockingStatisticsProvider interface to get the amount of blocked queries over time
+type BlockingStatisticsProvider interface {
+	BlockingStatistics(daily bool) []BlockingStatistics
+}
+
+// CacheInspector interface to list the cache contents
+type CacheInspector interface {
+	CacheEntries(filter string) []CacheEntry
+}
+
 // BlockingEndpoint endpoint for the blocking status control
 type BlockingEndpoint struct {
 	control BlockingControl
@@ -34,6 +80,41 @@ type ListRefreshEndpoint struct {
 	refresher ListRefresher
 }
 
+// ListGroupRefreshEndpoint endpoint for the refresh of one list group
+type ListGroupRefreshEndpoint struct {
+	refresher ListGroupRefresher
+}
+
+// ListHitsEndpoint endpoint for the matches per list source
+type ListHitsEndpoint struct {
+	provider ListHitsProvider
+}
+
+// ListExportEndpoint endpoint for the export of the blacklist entries
+type ListExportEndpoint struct {
+	exporter ListExporter
+}
+
+// DynamicBlockEndpoint endpoint for the domains blocked at runtime
+type DynamicBlockEndpoint struct {
+	control DynamicBlockControl
+}
+
+// QuotaEndpoint endpoint for the query quota status
+type QuotaEndpoint struct {
+	provider QuotaStatusProvider
+}
+
+// BlockingStatisticsEndpoint endpoint for the blocked queries over time
+type BlockingStatisticsEndpoint struct {
+	provider BlockingStatisticsProvider
+}
+
+// CacheEndpoint endpoint for the cache contents
+type CacheEndpoint struct {
+	inspector CacheInspector
+}
+
 // RegisterEndpoint registers an implementation as HTTP endpoint
 func RegisterEndpoint(router chi.Router, t interface{}) {
 	if a, ok := t.(BlockingControl); ok {
@@ -43,6 +124,235 @@ func RegisterEndpoint(router chi.Router, t interface{}) {
 	if a, ok := t.(ListRefresher); ok {
 		registerListRefreshEndpoints(router, a)
 	}
+
+	if a, ok := t.(ListGroupRefresher); ok {
+		registerListGroupRefreshEndpoints(router, a)
+	}
+
+	if a, ok := t.(ListHitsProvider); ok {
+		registerListHitsEndpoints(router, a)
+	}
+
+	if a, ok := t.(ListExporter); ok {
+		registerListExportEndpoints(router, a)
+	}
+
+	if a, ok := t.(DynamicBlockControl); ok {
+		registerDynamicBlockEndpoints(router, a)
+	}
+
+	if a, ok := t.(QuotaStatusProvider); ok {
+		registerQuotaEndpoints(router, a)
+	}
+
+	if a, ok := t.(CacheInspector); ok {
+		registerCacheEndpoints(router, a)
+	}
+
+	if a, ok := t.(BlockingStatisticsProvider); ok {
+		registerBlockingStatisticsEndpoints(router, a)
+	}
+}
+
+func registerBlockingStatisticsEndpoints(router chi.Router, provider BlockingStatisticsProvider) {
+	b := &BlockingStatisticsEndpoint{provider}
+
+	router.Get(PathBlockingStatisticsPath, b.apiBlockingStatistics)
+}
+
+// apiBlockingStatistics is the http endpoint to get the amount of blocked queries over time
+// @Summary Blocking statistics
+// @Description get the amount of blocked queries per hour or day within the configured retention
+// @Tags blocking
+// @Produce  json
+// @Param interval query string false "aggregation interval: hour (default) or day" Format(string)
+// @Success 200 {array} api.BlockingStatistics "Returns blocked queries per interval, oldest first"
+// @Failure 400   "Wrong interval"
+// @Router /blocking/statistics [get]
+func (b *BlockingStatisticsEndpoint) apiBlockingStatistics(rw http.ResponseWriter, req *http.Request) {
+	var daily bool
+
+	switch interval := req.URL.Query().Get("interval"); interval {
+	case "", "hour":
+	case "day":
+		daily = true
+	default:
+		log.Log().Errorf("wrong interval '%s'", log.EscapeInput(interval))
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	response, _ := json.Marshal(b.provider.BlockingStatistics(daily))
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err := rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
+}
+
+func registerCacheEndpoints(router chi.Router, inspector CacheInspector) {
+	c := &CacheEndpoint{inspector}
+
+	router.Get(PathCacheEntriesPath, c.apiCacheEntries)
+}
+
+// apiCacheEntries is the http endpoint to list the cached entries
+// @Summary Cache entries
+// @Description list cached entries matching the filter with remaining TTL
+// @Tags cache
+// @Produce  json
+// @Param q query string false "return only entries with domain names containing this string" Format(string)
+// @Param offset query int false "amount of entries to skip, default: 0" Format(int)
+// @Param limit query int false "max amount of returned entries, default: 100, max: 1000" Format(int)
+// @Success 200 {object} api.CacheEntries "Returns matching cache entries"
+// @Failure 400   "Wrong offset or limit"
+// @Router /cache/entries [get]
+func (c *CacheEndpoint) apiCacheEntries(rw http.ResponseWriter, req *http.Request) {
+	offset, err := parseIntParam(req, "offset", 0)
+	if err != nil || offset < 0 {
+		log.Log().Errorf("wrong offset '%s'", log.EscapeInput(req.URL.Query().Get("offset")))
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	limit, err := parseIntParam(req, "limit", defaultCacheEntriesLimit)
+	if err != nil || limit <= 0 || limit > maxCacheEntriesLimit {
+		log.Log().Errorf("wrong limit '%s'", log.EscapeInput(req.URL.Query().Get("limit")))
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	entries := c.inspector.CacheEntries(req.URL.Query().Get("q"))
+
+	result := CacheEntries{Total: len(entries), Entries: []CacheEntry{}}
+
+	if offset < len(entries) {
+		end := offset + limit
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		result.Entries = entries[offset:end]
+	}
+
+	response, _ := json.Marshal(result)
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err = rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
+}
+
+func parseIntParam(req *http.Request, name string, defaultValue int) (int, error) {
+	param := req.URL.Query().Get(name)
+	if len(param) == 0 {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(param)
+}
+
+func registerDynamicBlockEndpoints(router chi.Router, control DynamicBlockControl) {
+	d := &DynamicBlockEndpoint{control}
+
+	router.Get(PathListsCustomBlock, d.apiDynamicBlocks)
+	router.Post(PathListsCustomBlock, d.apiBlockDomain)
+}
+
+// apiDynamicBlocks is the http endpoint to list the domains blocked at runtime
+// @Summary Dynamic blocks
+// @Description list the domains blocked at runtime with their expiration
+// @Tags lists
+// @Produce  json
+// @Success 200 {array} api.DynamicBlock "Returns the current dynamic block set"
+// @Router /lists/custom/block [get]
+func (d *DynamicBlockEndpoint) apiDynamicBlocks(rw http.ResponseWriter, _ *http.Request) {
+	response, _ := json.Marshal(d.control.DynamicBlocks())
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err := rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
+}
+
+// apiBlockDomain is the http endpoint to block a domain at runtime
+// @Summary Block domain
+// @Description block a domain with all subdomains for all clients, the block expires after the TTL
+// @Tags lists
+// @Accept  json
+// @Produce  json
+// @Param   request body api.DynamicBlockRequest true "domain and optional TTL"
+// @Success 200 {array} api.DynamicBlock "Domain is blocked, returns the current dynamic block set"
+// @Failure 400   "Wrong request (invalid domain or TTL)"
+// @Router /lists/custom/block [post]
+func (d *DynamicBlockEndpoint) apiBlockDomain(rw http.ResponseWriter, req *http.Request) {
+	var request DynamicBlockRequest
+
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		log.Log().Error("can't read request: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var ttl time.Duration
+
+	if request.TTL != "" {
+		var err error
+
+		ttl, err = time.ParseDuration(request.TTL)
+		if err != nil || ttl < 0 {
+			log.Log().Errorf("wrong TTL '%s'", log.EscapeInput(request.TTL))
+			rw.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if err := d.control.BlockDomain(request.Domain, ttl); err != nil {
+		log.Log().Error("can't block domain: ", log.EscapeInput(err.Error()))
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	d.apiDynamicBlocks(rw, req)
+}
+
+func registerQuotaEndpoints(router chi.Router, provider QuotaStatusProvider) {
+	q := &QuotaEndpoint{provider}
+
+	router.Get(PathQuotaStatusPath, q.apiQuotaStatus)
+}
+
+// apiQuotaStatus is the http endpoint to get the current query quota status of all clients
+// @Summary Query quota status
+// @Description get the daily query quota status of all clients with queries today
+// @Tags quota
+// @Produce  json
+// @Param client query string false "return only the status of this client (name or IP address)" Format(string)
+// @Success 200 {array} api.ClientQuotaStatus "Returns current query quota status"
+// @Router /quota/status [get]
+func (q *QuotaEndpoint) apiQuotaStatus(rw http.ResponseWriter, req *http.Request) {
+	status := q.provider.QuotaStatus()
+
+	if client := req.URL.Query().Get("client"); len(client) > 0 {
+		filtered := []ClientQuotaStatus{}
+
+		for _, s := range status {
+			if s.Client == client {
+				filtered = append(filtered, s)
+			}
+		}
+
+		status = filtered
+	}
+
+	response, _ := json.Marshal(status)
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err := rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
 }
 
 func registerListRefreshEndpoints(router chi.Router, refresher ListRefresher) {
@@ -61,6 +371,128 @@ func (l *ListRefreshEndpoint) apiListRefresh(_ http.ResponseWriter, _ *http.Requ
 	l.refresher.RefreshLists()
 }
 
+func registerListGroupRefreshEndpoints(router chi.Router, refresher ListGroupRefresher) {
+	l := &ListGroupRefreshEndpoint{refresher}
+
+	router.Post(PathListGroupRefresh, l.apiListGroupRefresh)
+}
+
+// apiListGroupRefresh is the http endpoint to trigger the refresh of the lists of one group
+// @Summary List group refresh
+// @Description Refresh the black and white lists of one group
+// @Tags lists
+// @Produce  json
+// @Param group path string true "name of the list group" Format(string)
+// @Success 200 {array} api.ListRefreshResult "Lists of the group were reloaded, returns the result per list"
+// @Failure 404   "Unknown group"
+// @Router /lists/{group}/refresh [post]
+func (l *ListGroupRefreshEndpoint) apiListGroupRefresh(rw http.ResponseWriter, req *http.Request) {
+	group := chi.URLParam(req, "group")
+
+	results, err := l.refresher.RefreshListGroup(group)
+	if err != nil {
+		log.Log().Error("can't refresh the list group: ", log.EscapeInput(err.Error()))
+		rw.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	response, _ := json.Marshal(results)
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err = rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
+}
+
+func registerListHitsEndpoints(router chi.Router, provider ListHitsProvider) {
+	l := &ListHitsEndpoint{provider}
+
+	router.Get(PathListHitsPath, l.apiListHits)
+}
+
+// apiListHits is the http endpoint to get the amount of matches per list source
+// @Summary List source hits
+// @Description get the amount of matches per list source since the start (requires blocking.hitCounting)
+// @Tags lists
+// @Produce  json
+// @Success 200 {array} api.ListSourceHits "Returns the matches per list source"
+// @Router /lists/hits [get]
+func (l *ListHitsEndpoint) apiListHits(rw http.ResponseWriter, _ *http.Request) {
+	response, _ := json.Marshal(l.provider.ListHits())
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err := rw.Write(response)
+
+	util.LogOnError("unable to write response ", err)
+}
+
+func registerListExportEndpoints(router chi.Router, exporter ListExporter) {
+	l := &ListExportEndpoint{exporter}
+
+	router.Get(PathListsExportPath, l.apiListExport)
+}
+
+// apiListExport is the http endpoint to download the blacklist entries of a group
+// @Summary List export
+// @Description download the loaded, deduplicated blacklist entries of a group as text file, one entry per line.
+// @Description The entries are streamed, domains in alphabetical order followed by the regexes
+// @Tags lists
+// @Produce  plain
+// @Param group query string true "name of the list group" Format(string)
+// @Success 200   "Returns the entries of the group"
+// @Failure 400   "Missing group"
+// @Failure 404   "Unknown group"
+// @Router /lists/export [get]
+func (l *ListExportEndpoint) apiListExport(rw http.ResponseWriter, req *http.Request) {
+	group := req.URL.Query().Get("group")
+	if group == "" {
+		log.Log().Error("missing group")
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var (
+		w        *bufio.Writer
+		writeErr error
+	)
+
+	// the headers are written with the first entry, an unknown group returns an error before
+	err := l.exporter.ExportList(group, func(entry string) {
+		if w == nil {
+			setListExportHeaders(rw, group)
+
+			w = bufio.NewWriter(rw)
+		}
+
+		if writeErr == nil {
+			_, writeErr = w.WriteString(entry + "\n")
+		}
+	})
+	if err != nil {
+		log.Log().Error("can't export the list group: ", log.EscapeInput(err.Error()))
+		rw.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if w == nil {
+		setListExportHeaders(rw, group)
+
+		return
+	}
+
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+
+	util.LogOnError("unable to write response ", writeErr)
+}
+
+func setListExportHeaders(rw http.ResponseWriter, group string) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", group+".txt"))
+}
+
 func registerBlockingEndpoints(router chi.Router, control BlockingControl) {
 	s := &BlockingEndpoint{control}
 	// register API endpoints
@@ -133,6 +565,7 @@ func (s *BlockingEndpoint) apiBlockingStatus(rw http.ResponseWriter, _ *http.Req
 	status := s.control.BlockingStatus()
 
 	response, _ := json.Marshal(status)
+	rw.Header().Set("Content-Type", jsonContentType)
 	_, err := rw.Write(response)
 
 	util.LogOnError("unable to write response ", err)
@@ -2,7 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"time"
 
 	. "github.com/0xERR0R/blocky/helpertest"
@@ -25,6 +29,90 @@ func (l *ListRefreshMock) RefreshLists() {
 	l.refreshTriggered = true
 }
 
+type ListGroupRefreshMock struct {
+	group string
+}
+
+func (l *ListGroupRefreshMock) RefreshListGroup(group string) ([]ListRefreshResult, error) {
+	if group != "ads" {
+		return nil, errors.New("unknown group")
+	}
+
+	l.group = group
+
+	return []ListRefreshResult{{ListType: "blacklist", Source: "https://example.com/ads.txt", Entries: 5}}, nil
+}
+
+type DynamicBlockMock struct {
+	blocks []DynamicBlock
+	ttl    time.Duration
+}
+
+func (d *DynamicBlockMock) BlockDomain(domain string, ttl time.Duration) error {
+	if domain == "" {
+		return errors.New("invalid domain")
+	}
+
+	d.ttl = ttl
+	d.blocks = append(d.blocks, DynamicBlock{Domain: domain, RemainingTTLInSec: uint(ttl.Seconds())})
+
+	return nil
+}
+
+func (d *DynamicBlockMock) DynamicBlocks() []DynamicBlock {
+	return d.blocks
+}
+
+type QuotaStatusMock struct {
+	status []ClientQuotaStatus
+}
+
+func (q *QuotaStatusMock) QuotaStatus() []ClientQuotaStatus {
+	return q.status
+}
+
+type CacheInspectorMock struct {
+	entries []CacheEntry
+	filter  string
+}
+
+func (c *CacheInspectorMock) CacheEntries(filter string) []CacheEntry {
+	c.filter = filter
+
+	return c.entries
+}
+
+type BlockingStatisticsMock struct {
+	daily bool
+}
+
+func (b *BlockingStatisticsMock) BlockingStatistics(daily bool) []BlockingStatistics {
+	b.daily = daily
+
+	return []BlockingStatistics{{Start: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC), Blocked: 5}}
+}
+
+type ListExportMock struct{}
+
+func (l *ListExportMock) ExportList(group string, fn func(entry string)) error {
+	switch group {
+	case "ads":
+		fn("ads.com")
+		fn("tracker.org")
+	case "empty":
+	default:
+		return errors.New("unknown group")
+	}
+
+	return nil
+}
+
+type ListHitsMock struct{}
+
+func (l *ListHitsMock) ListHits() []ListSourceHits {
+	return []ListSourceHits{{ListType: "blacklist", Group: "ads", Source: "http://list", Hits: 3}}
+}
+
 func (b *BlockingControlMock) EnableBlocking() {
 	b.enabled = true
 }
@@ -42,6 +130,13 @@ var _ = Describe("API tests", func() {
 	Describe("Register router", func() {
 		RegisterEndpoint(chi.NewRouter(), &BlockingControlMock{})
 		RegisterEndpoint(chi.NewRouter(), &ListRefreshMock{})
+		RegisterEndpoint(chi.NewRouter(), &ListGroupRefreshMock{})
+		RegisterEndpoint(chi.NewRouter(), &QuotaStatusMock{})
+		RegisterEndpoint(chi.NewRouter(), &CacheInspectorMock{})
+		RegisterEndpoint(chi.NewRouter(), &BlockingStatisticsMock{})
+		RegisterEndpoint(chi.NewRouter(), &ListHitsMock{})
+		RegisterEndpoint(chi.NewRouter(), &ListExportMock{})
+		RegisterEndpoint(chi.NewRouter(), &DynamicBlockMock{})
 	})
 
 	Describe("Lists API", func() {
@@ -58,6 +153,312 @@ var _ = Describe("API tests", func() {
 
 	})
 
+	Describe("List group refresh API", func() {
+		var (
+			router    *chi.Mux
+			refresher *ListGroupRefreshMock
+		)
+
+		BeforeEach(func() {
+			router = chi.NewRouter()
+			refresher = &ListGroupRefreshMock{}
+			RegisterEndpoint(router, refresher)
+		})
+
+		post := func(url string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodPost, url, nil)
+			Expect(err).Should(Succeed())
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		When("refresh of a defined group is called", func() {
+			It("should refresh the group and return the results", func() {
+				rr := post("/api/lists/ads/refresh")
+				Expect(rr.Code).Should(Equal(http.StatusOK))
+				Expect(rr.Header().Get("Content-Type")).Should(Equal("application/json"))
+				Expect(refresher.group).Should(Equal("ads"))
+
+				var result []ListRefreshResult
+				Expect(json.NewDecoder(rr.Body).Decode(&result)).Should(Succeed())
+				Expect(result).Should(Equal([]ListRefreshResult{
+					{ListType: "blacklist", Source: "https://example.com/ads.txt", Entries: 5},
+				}))
+			})
+		})
+
+		When("refresh of an unknown group is called", func() {
+			It("should return not found", func() {
+				rr := post("/api/lists/unknown/refresh")
+				Expect(rr.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("Dynamic block API", func() {
+		var (
+			router  *chi.Mux
+			control *DynamicBlockMock
+		)
+
+		BeforeEach(func() {
+			router = chi.NewRouter()
+			control = &DynamicBlockMock{}
+			RegisterEndpoint(router, control)
+		})
+
+		post := func(body string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodPost, "/api/lists/custom/block", strings.NewReader(body))
+			Expect(err).Should(Succeed())
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		When("a domain with TTL is posted", func() {
+			It("should block the domain and return the current dynamic block set", func() {
+				rr := post(`{"domain":"example.com","ttl":"30m"}`)
+				Expect(rr.Code).Should(Equal(http.StatusOK))
+				Expect(control.ttl).Should(Equal(30 * time.Minute))
+
+				var result []DynamicBlock
+				Expect(json.NewDecoder(rr.Body).Decode(&result)).Should(Succeed())
+				Expect(result).Should(Equal([]DynamicBlock{{Domain: "example.com", RemainingTTLInSec: 1800}}))
+			})
+		})
+
+		When("a domain without TTL is posted", func() {
+			It("should use the default TTL", func() {
+				rr := post(`{"domain":"example.com"}`)
+				Expect(rr.Code).Should(Equal(http.StatusOK))
+				Expect(control.ttl).Should(BeZero())
+			})
+		})
+
+		When("the request is invalid", func() {
+			It("should return bad request", func() {
+				Expect(post(`{"domain":"example.com","ttl":"abc"}`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(post(`{"domain":""}`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(post(`not json`).Code).Should(Equal(http.StatusBadRequest))
+				Expect(control.blocks).Should(BeEmpty())
+			})
+		})
+
+		When("the dynamic block set is requested", func() {
+			It("should return all entries", func() {
+				control.blocks = []DynamicBlock{{Domain: "example.com", RemainingTTLInSec: 60}}
+
+				httpCode, body := DoGetRequest("/api/lists/custom/block", router.ServeHTTP)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []DynamicBlock
+				Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+				Expect(result).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("Quota API", func() {
+		var sut *QuotaEndpoint
+
+		BeforeEach(func() {
+			sut = &QuotaEndpoint{provider: &QuotaStatusMock{status: []ClientQuotaStatus{
+				{Client: "client1", Limit: 10, Used: 3, Remaining: 7},
+				{Client: "192.168.178.3", Limit: 5, Used: 5, Remaining: 0},
+			}}}
+		})
+
+		When("Quota status is called", func() {
+			It("should return the status of all clients", func() {
+				httpCode, body := DoGetRequest("/api/quota/status", sut.apiQuotaStatus)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []ClientQuotaStatus
+				err := json.NewDecoder(body).Decode(&result)
+				Expect(err).Should(Succeed())
+
+				Expect(result).Should(HaveLen(2))
+			})
+		})
+
+		When("Quota status is called with a client parameter", func() {
+			It("should return only the status of the client", func() {
+				httpCode, body := DoGetRequest("/api/quota/status?client=client1", sut.apiQuotaStatus)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []ClientQuotaStatus
+				err := json.NewDecoder(body).Decode(&result)
+				Expect(err).Should(Succeed())
+
+				Expect(result).Should(Equal([]ClientQuotaStatus{{Client: "client1", Limit: 10, Used: 3, Remaining: 7}}))
+			})
+		})
+	})
+
+	Describe("List export API", func() {
+		sut := &ListExportEndpoint{exporter: &ListExportMock{}}
+
+		When("a known group is exported", func() {
+			It("should return the entries as file", func() {
+				r, _ := http.NewRequest("GET", "/api/lists/export?group=ads", nil)
+				rr := httptest.NewRecorder()
+				sut.apiListExport(rr, r)
+
+				Expect(rr.Code).Should(Equal(http.StatusOK))
+				Expect(rr.Header().Get("Content-Disposition")).Should(Equal(`attachment; filename="ads.txt"`))
+				Expect(rr.Body.String()).Should(Equal("ads.com\ntracker.org\n"))
+			})
+			It("should return an empty file for a group without entries", func() {
+				httpCode, body := DoGetRequest("/api/lists/export?group=empty", sut.apiListExport)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+				Expect(body.String()).Should(BeEmpty())
+			})
+		})
+
+		When("the group is unknown or missing", func() {
+			It("should return not found or bad request", func() {
+				httpCode, _ := DoGetRequest("/api/lists/export?group=unknown", sut.apiListExport)
+				Expect(httpCode).Should(Equal(http.StatusNotFound))
+
+				httpCode, _ = DoGetRequest("/api/lists/export", sut.apiListExport)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("List hits API", func() {
+		When("List hits are called", func() {
+			sut := &ListHitsEndpoint{provider: &ListHitsMock{}}
+			It("should return the matches per list source", func() {
+				httpCode, body := DoGetRequest("/api/lists/hits", sut.apiListHits)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []ListSourceHits
+				err := json.NewDecoder(body).Decode(&result)
+				Expect(err).Should(Succeed())
+
+				Expect(result).Should(Equal([]ListSourceHits{
+					{ListType: "blacklist", Group: "ads", Source: "http://list", Hits: 3},
+				}))
+			})
+		})
+	})
+
+	Describe("Blocking statistics API", func() {
+		var (
+			sut      *BlockingStatisticsEndpoint
+			provider *BlockingStatisticsMock
+		)
+
+		BeforeEach(func() {
+			provider = &BlockingStatisticsMock{}
+			sut = &BlockingStatisticsEndpoint{provider: provider}
+		})
+
+		When("Statistics are called without interval", func() {
+			It("should return the hourly statistics", func() {
+				httpCode, body := DoGetRequest("/api/blocking/statistics", sut.apiBlockingStatistics)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []BlockingStatistics
+				err := json.NewDecoder(body).Decode(&result)
+				Expect(err).Should(Succeed())
+
+				Expect(result).Should(HaveLen(1))
+				Expect(result[0].Blocked).Should(Equal(uint(5)))
+				Expect(provider.daily).Should(BeFalse())
+			})
+		})
+
+		When("Statistics are called with daily interval", func() {
+			It("should return the daily statistics", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/statistics?interval=day", sut.apiBlockingStatistics)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+				Expect(provider.daily).Should(BeTrue())
+			})
+		})
+
+		When("Statistics are called with wrong interval", func() {
+			It("should return bad request", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/statistics?interval=week", sut.apiBlockingStatistics)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Cache API", func() {
+		var (
+			ci  *CacheInspectorMock
+			sut *CacheEndpoint
+		)
+
+		BeforeEach(func() {
+			ci = &CacheInspectorMock{entries: []CacheEntry{
+				{Name: "example.com", Type: "A"},
+				{Name: "example.com", Type: "AAAA"},
+				{Name: "example.org", Type: "A"},
+			}}
+			sut = &CacheEndpoint{inspector: ci}
+		})
+
+		decode := func(body io.Reader) CacheEntries {
+			var result CacheEntries
+			err := json.NewDecoder(body).Decode(&result)
+			Expect(err).Should(Succeed())
+
+			return result
+		}
+
+		When("Cache entries are called with filter", func() {
+			It("should pass the filter and return all entries", func() {
+				httpCode, body := DoGetRequest("/api/cache/entries?q=example", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+				Expect(ci.filter).Should(Equal("example"))
+
+				result := decode(body)
+				Expect(result.Total).Should(Equal(3))
+				Expect(result.Entries).Should(HaveLen(3))
+			})
+		})
+
+		When("Cache entries are called with offset and limit", func() {
+			It("should return only the requested page", func() {
+				httpCode, body := DoGetRequest("/api/cache/entries?offset=1&limit=1", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				result := decode(body)
+				Expect(result.Total).Should(Equal(3))
+				Expect(result.Entries).Should(Equal([]CacheEntry{{Name: "example.com", Type: "AAAA"}}))
+			})
+			It("should return empty page if offset is too big", func() {
+				httpCode, body := DoGetRequest("/api/cache/entries?offset=10", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				result := decode(body)
+				Expect(result.Total).Should(Equal(3))
+				Expect(result.Entries).Should(BeEmpty())
+			})
+		})
+
+		When("Cache entries are called with wrong parameters", func() {
+			It("should return http bad request as return code", func() {
+				httpCode, _ := DoGetRequest("/api/cache/entries?offset=abc", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+
+				httpCode, _ = DoGetRequest("/api/cache/entries?limit=0", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+
+				httpCode, _ = DoGetRequest("/api/cache/entries?limit=5000", sut.apiCacheEntries)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
 	Describe("Control blocking status via API", func() {
 		var (
 			bc  *BlockingControlMock
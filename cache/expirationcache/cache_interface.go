@@ -14,4 +14,8 @@ type ExpiringCache interface {
 
 	// Clear removes all cache entries
 	Clear()
+
+	// Iterate calls the passed function for each valid (not expired) element with its remained TTL.
+	// The usage order of the elements is not changed
+	Iterate(fn func(key string, val interface{}, expiration time.Duration))
 }
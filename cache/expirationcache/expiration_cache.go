@@ -19,6 +19,7 @@ type element struct {
 type ExpiringLRUCache struct {
 	cleanUpInterval time.Duration
 	preExpirationFn OnExpirationCallback
+	maxSize         uint
 	lru             *lru.Cache
 }
 
@@ -44,26 +45,26 @@ func WithOnExpiredFn(fn OnExpirationCallback) CacheOption {
 func WithMaxSize(size uint) CacheOption {
 	return func(c *ExpiringLRUCache) {
 		if size > 0 {
-			l, _ := lru.New(int(size))
-			c.lru = l
+			c.maxSize = size
 		}
 	}
 }
 
 func NewCache(options ...CacheOption) *ExpiringLRUCache {
-	l, _ := lru.New(defaultSize)
 	c := &ExpiringLRUCache{
 		cleanUpInterval: defaultCleanUpInterval,
 		preExpirationFn: func(key string) (val interface{}, ttl time.Duration) {
 			return nil, 0
 		},
-		lru: l,
+		maxSize: defaultSize,
 	}
 
 	for _, opt := range options {
 		opt(c)
 	}
 
+	c.lru, _ = lru.New(int(c.maxSize))
+
 	go periodicCleanup(c)
 
 	return c
@@ -115,20 +116,12 @@ func (e *ExpiringLRUCache) Put(key string, val interface{}, ttl time.Duration) {
 		return
 	}
 
-	expiresEpochMs := time.Now().UnixMilli() + ttl.Milliseconds()
-
-	el, found := e.lru.Get(key)
-	if found {
-		// update existing item
-		el.(*element).val = val
-		el.(*element).expiresEpochMs = expiresEpochMs
-	} else {
-		// add new item
-		e.lru.Add(key, &element{
-			val:            val,
-			expiresEpochMs: expiresEpochMs,
-		})
-	}
+	// the elements are not modified after adding, concurrent readers can use them without lock.
+	// Add replaces the element of an existing key
+	e.lru.Add(key, &element{
+		val:            val,
+		expiresEpochMs: time.Now().UnixMilli() + ttl.Milliseconds(),
+	})
 }
 
 func (e *ExpiringLRUCache) Get(key string) (val interface{}, ttl time.Duration) {
@@ -169,3 +162,14 @@ func (e *ExpiringLRUCache) TotalCount() (count int) {
 func (e *ExpiringLRUCache) Clear() {
 	e.lru.Purge()
 }
+
+func (e *ExpiringLRUCache) Iterate(fn func(key string, val interface{}, expiration time.Duration)) {
+	for _, k := range e.lru.Keys() {
+		if v, ok := e.lru.Peek(k); ok {
+			el := v.(*element)
+			if !isExpired(el) {
+				fn(k.(string), el.val, calculateRemainTTL(el.expiresEpochMs))
+			}
+		}
+	}
+}
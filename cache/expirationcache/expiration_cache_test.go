@@ -89,6 +89,24 @@ var _ = Describe("Expiration cache", func() {
 				Expect(cache.TotalCount()).Should(Equal(0))
 			})
 		})
+		When("Iterating over entries", func() {
+			It("Should return only valid entries with remained TTL", func() {
+				cache := NewCache()
+				cache.Put("key1", "val1", time.Second)
+				cache.Put("key2", "val2", 10*time.Millisecond)
+
+				time.Sleep(20 * time.Millisecond)
+
+				result := make(map[string]interface{})
+
+				cache.Iterate(func(key string, val interface{}, expiration time.Duration) {
+					result[key] = val
+					Expect(expiration.Milliseconds()).Should(BeNumerically(">", 900))
+				})
+
+				Expect(result).Should(Equal(map[string]interface{}{"key1": "val1"}))
+			})
+		})
 	})
 	Describe("preExpiration function", func() {
 		When(" function is defined", func() {
@@ -0,0 +1,86 @@
+package expirationcache
+
+import (
+	"time"
+)
+
+// ShardedCache distributes the entries by key hash to multiple independent caches (shards). Each shard has its own
+// lock, this reduces the lock contention with many concurrent queries. The max. size is split between the shards,
+// so the LRU eviction is per shard
+type ShardedCache struct {
+	shards []*ExpiringLRUCache
+}
+
+// NewShardedCache returns a cache with the passed amount of shards, with 0 or 1 shard a single cache is returned
+func NewShardedCache(shardCount uint, options ...CacheOption) ExpiringCache {
+	if shardCount <= 1 {
+		return NewCache(options...)
+	}
+
+	probe := &ExpiringLRUCache{maxSize: defaultSize}
+	for _, opt := range options {
+		opt(probe)
+	}
+
+	// each shard should hold at least one entry
+	if probe.maxSize < shardCount {
+		shardCount = probe.maxSize
+	}
+
+	c := &ShardedCache{shards: make([]*ExpiringLRUCache, shardCount)}
+
+	for i := range c.shards {
+		shardSize := probe.maxSize / shardCount
+		if uint(i) < probe.maxSize%shardCount {
+			shardSize++
+		}
+
+		c.shards[i] = NewCache(append(options[:len(options):len(options)], WithMaxSize(shardSize))...)
+	}
+
+	return c
+}
+
+// shard returns the shard of the key (FNV-1a hash)
+func (c *ShardedCache) shard(key string) *ExpiringLRUCache {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+
+	return c.shards[hash%uint32(len(c.shards))]
+}
+
+func (c *ShardedCache) Put(key string, val interface{}, expiration time.Duration) {
+	c.shard(key).Put(key, val, expiration)
+}
+
+func (c *ShardedCache) Get(key string) (val interface{}, expiration time.Duration) {
+	return c.shard(key).Get(key)
+}
+
+func (c *ShardedCache) TotalCount() (count int) {
+	for _, s := range c.shards {
+		count += s.TotalCount()
+	}
+
+	return count
+}
+
+func (c *ShardedCache) Clear() {
+	for _, s := range c.shards {
+		s.Clear()
+	}
+}
+
+func (c *ShardedCache) Iterate(fn func(key string, val interface{}, expiration time.Duration)) {
+	for _, s := range c.shards {
+		s.Iterate(fn)
+	}
+}
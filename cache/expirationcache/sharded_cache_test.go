@@ -0,0 +1,119 @@
+package expirationcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sharded cache", func() {
+	When("shard count is 0 or 1", func() {
+		It("should return a single cache", func() {
+			Expect(NewShardedCache(0)).Should(BeAssignableToTypeOf(&ExpiringLRUCache{}))
+			Expect(NewShardedCache(1)).Should(BeAssignableToTypeOf(&ExpiringLRUCache{}))
+		})
+	})
+
+	When("multiple shards are used", func() {
+		var cache ExpiringCache
+
+		BeforeEach(func() {
+			cache = NewShardedCache(4, WithMaxSize(100))
+		})
+
+		It("should distribute the max size to the shards", func() {
+			var total uint
+			for _, s := range cache.(*ShardedCache).shards {
+				total += s.maxSize
+			}
+
+			Expect(cache.(*ShardedCache).shards).Should(HaveLen(4))
+			Expect(total).Should(BeEquivalentTo(100))
+		})
+
+		It("should put, get and count the entries of all shards", func() {
+			for i := 0; i < 50; i++ {
+				cache.Put(fmt.Sprintf("key%d", i), i, time.Minute)
+			}
+
+			val, ttl := cache.Get("key42")
+			Expect(val).Should(Equal(42))
+			Expect(ttl).Should(BeNumerically(">", 0))
+			Expect(cache.TotalCount()).Should(Equal(50))
+
+			for _, s := range cache.(*ShardedCache).shards {
+				Expect(s.TotalCount()).Should(BeNumerically(">", 0))
+			}
+
+			keys := make(map[string]bool)
+			cache.Iterate(func(key string, _ interface{}, _ time.Duration) {
+				keys[key] = true
+			})
+			Expect(keys).Should(HaveLen(50))
+
+			cache.Clear()
+			Expect(cache.TotalCount()).Should(Equal(0))
+		})
+
+		It("should call the expiration function of the shards", func() {
+			cache = NewShardedCache(2, WithCleanUpInterval(100*time.Millisecond),
+				WithOnExpiredFn(func(key string) (val interface{}, ttl time.Duration) {
+					return "renewed", time.Minute
+				}))
+
+			cache.Put("key1", "val1", 50*time.Millisecond)
+
+			Eventually(func() interface{} {
+				val, _ := cache.Get("key1")
+
+				return val
+			}, "1s").Should(Equal("renewed"))
+		})
+	})
+
+	When("max size is smaller than the shard count", func() {
+		It("should reduce the shard count", func() {
+			cache := NewShardedCache(16, WithMaxSize(3))
+			Expect(cache.(*ShardedCache).shards).Should(HaveLen(3))
+		})
+	})
+})
+
+func benchmarkCache(b *testing.B, cache ExpiringCache) {
+	const keyCount = 1000
+
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("example%d.com:A", i)
+		cache.Put(keys[i], i, time.Hour)
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%keyCount]
+
+			// mostly cache hits, every 10th operation updates the entry
+			if i%10 == 0 {
+				cache.Put(key, i, time.Hour)
+			} else {
+				cache.Get(key)
+			}
+
+			i++
+		}
+	})
+}
+
+func BenchmarkSingleCache(b *testing.B) {
+	benchmarkCache(b, NewCache())
+}
+
+func BenchmarkShardedCache(b *testing.B) {
+	benchmarkCache(b, NewShardedCache(16))
+}
@@ -1,6 +1,7 @@
 package stringcache
 
 import (
+	"container/heap"
 	"regexp"
 	"sort"
 	"strings"
@@ -13,8 +14,21 @@ import (
 type StringCache interface {
 	ElementCount() int
 	Contains(searchString string) bool
+	// MemorySize returns the estimated memory usage in bytes
+	MemorySize() int
+	// ForEach calls the function for each entry, regex entries are passed with slashes (/regex/)
+	ForEach(fn func(entry string))
 }
 
+const (
+	// estimated overhead of a map entry with the string header
+	mapEntryOverhead = 48
+
+	// rough estimation of the memory used by a compiled regex, the real size depends on the expression
+	regexBaseSize    = 1024
+	regexSizePerChar = 32
+)
+
 type CacheFactory interface {
 	AddEntry(entry string)
 	Create() StringCache
@@ -32,6 +46,16 @@ func (cache stringCache) ElementCount() int {
 	return count
 }
 
+func (cache stringCache) MemorySize() int {
+	size := 0
+
+	for _, v := range cache {
+		size += len(v) + mapEntryOverhead
+	}
+
+	return size
+}
+
 func (cache stringCache) Contains(searchString string) bool {
 	searchLen := len(searchString)
 	if searchLen == 0 {
@@ -50,6 +74,80 @@ func (cache stringCache) Contains(searchString string) bool {
 	return false
 }
 
+// ForEach calls the function for each entry in alphabetical order, the buckets per length are merged
+func (cache stringCache) ForEach(fn func(entry string)) {
+	mergeBuckets(cache.cursors(), fn)
+}
+
+// cursors returns the cursors of the non-empty buckets
+func (cache stringCache) cursors() bucketCursors {
+	cursors := make(bucketCursors, 0, len(cache))
+
+	for k, v := range cache {
+		if len(v) > 0 {
+			cursors = append(cursors, &bucketCursor{bucket: v, size: k})
+		}
+	}
+
+	return cursors
+}
+
+// mergeBuckets calls the function for each entry of the sorted buckets in alphabetical order,
+// an entry of multiple buckets is passed once
+func mergeBuckets(cursors bucketCursors, fn func(entry string)) {
+	heap.Init(&cursors)
+
+	var last string
+
+	for cursors.Len() > 0 {
+		c := cursors[0]
+
+		if entry := c.current(); entry != last {
+			fn(entry)
+
+			last = entry
+		}
+
+		c.pos += c.size
+		if c.pos >= len(c.bucket) {
+			heap.Pop(&cursors)
+		} else {
+			heap.Fix(&cursors, 0)
+		}
+	}
+}
+
+// bucketCursor is the position in the sorted bucket of one length
+type bucketCursor struct {
+	bucket string
+	size   int
+	pos    int
+}
+
+func (c *bucketCursor) current() string {
+	return c.bucket[c.pos : c.pos+c.size]
+}
+
+// bucketCursors is a min heap of the current entries of the buckets
+type bucketCursors []*bucketCursor
+
+func (h bucketCursors) Len() int           { return len(h) }
+func (h bucketCursors) Less(i, j int) bool { return h[i].current() < h[j].current() }
+func (h bucketCursors) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *bucketCursors) Push(x interface{}) {
+	*h = append(*h, x.(*bucketCursor))
+}
+
+func (h *bucketCursors) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+
+	return c
+}
+
 type stringCacheFactory struct {
 	cache stringCache
 	keys  map[string]struct{}
@@ -95,6 +193,16 @@ func (cache regexCache) ElementCount() int {
 	return len(cache)
 }
 
+func (cache regexCache) MemorySize() int {
+	size := 0
+
+	for _, regex := range cache {
+		size += regexBaseSize + len(regex.String())*regexSizePerChar
+	}
+
+	return size
+}
+
 func (cache regexCache) Contains(searchString string) bool {
 	for _, regex := range cache {
 		if regex.MatchString(searchString) {
@@ -106,6 +214,12 @@ func (cache regexCache) Contains(searchString string) bool {
 	return false
 }
 
+func (cache regexCache) ForEach(fn func(entry string)) {
+	for _, regex := range cache {
+		fn("/" + regex.String() + "/")
+	}
+}
+
 type regexCacheFactory struct {
 	cache regexCache
 }
@@ -142,6 +256,15 @@ func (cache chainedCache) ElementCount() int {
 	return sum
 }
 
+func (cache chainedCache) MemorySize() int {
+	sum := 0
+	for _, c := range cache.caches {
+		sum += c.MemorySize()
+	}
+
+	return sum
+}
+
 func (cache chainedCache) Contains(searchString string) bool {
 	for _, c := range cache.caches {
 		if c.Contains(searchString) {
@@ -152,6 +275,12 @@ func (cache chainedCache) Contains(searchString string) bool {
 	return false
 }
 
+func (cache chainedCache) ForEach(fn func(entry string)) {
+	for _, c := range cache.caches {
+		c.ForEach(fn)
+	}
+}
+
 type chainedCacheFactory struct {
 	stringCacheFactory CacheFactory
 	regexCacheFactory  CacheFactory
@@ -174,6 +303,49 @@ func (r *chainedCacheFactory) Create() StringCache {
 	}
 }
 
+// ForEachMerged calls the function for each entry of the caches once, the strings in alphabetical order followed by
+// the regexes. The sorted strings of the caches are merged, so the duplicates are detected without a set of all entries
+func ForEachMerged(caches []StringCache, fn func(entry string)) {
+	var (
+		cursors bucketCursors
+		others  []StringCache
+	)
+
+	var collect func(cache StringCache)
+
+	collect = func(cache StringCache) {
+		switch c := cache.(type) {
+		case *chainedCache:
+			for _, cc := range c.caches {
+				collect(cc)
+			}
+		case stringCache:
+			cursors = append(cursors, c.cursors()...)
+		default:
+			others = append(others, c)
+		}
+	}
+
+	for _, cache := range caches {
+		collect(cache)
+	}
+
+	mergeBuckets(cursors, fn)
+
+	// only a few regexes, the duplicates are detected with a set
+	seen := make(map[string]struct{})
+
+	for _, cache := range others {
+		cache.ForEach(func(entry string) {
+			if _, ok := seen[entry]; !ok {
+				seen[entry] = struct{}{}
+
+				fn(entry)
+			}
+		})
+	}
+}
+
 func NewChainedCacheFactory() CacheFactory {
 	return &chainedCacheFactory{
 		stringCacheFactory: newStringCacheFactory(),
@@ -21,6 +21,46 @@ var _ = Describe("Caches", func() {
 			It("should return correct element count", func() {
 				Expect(cache.ElementCount()).Should(Equal(2))
 			})
+			It("should estimate the memory size", func() {
+				// one bucket for each length of the entries
+				Expect(cache.MemorySize()).Should(Equal(len("google.com") + len("apple.com") + 2*mapEntryOverhead))
+			})
+			It("should iterate the entries in alphabetical order", func() {
+				factory := newStringCacheFactory()
+				for _, e := range []string{"zz.com", "google.com", "apple.com", "a.com", "google.com", "bb.org"} {
+					factory.AddEntry(e)
+				}
+
+				var entries []string
+				factory.Create().ForEach(func(entry string) {
+					entries = append(entries, entry)
+				})
+
+				Expect(entries).Should(Equal([]string{"a.com", "apple.com", "bb.org", "google.com", "zz.com"}))
+			})
+		})
+	})
+
+	Describe("Merged iteration", func() {
+		It("should pass the entries of the caches once, the strings in alphabetical order followed by the regexes", func() {
+			create := func(entries ...string) StringCache {
+				factory := NewChainedCacheFactory()
+				for _, entry := range entries {
+					factory.AddEntry(entry)
+				}
+
+				return factory.Create()
+			}
+
+			var entries []string
+			ForEachMerged([]StringCache{
+				create("zz.com", "bb.org", "/^apple/"),
+				create("a.com", "bb.org", "google.com", "/^apple/", "/amazon/"),
+			}, func(entry string) {
+				entries = append(entries, entry)
+			})
+
+			Expect(entries).Should(Equal([]string{"a.com", "bb.org", "google.com", "zz.com", "/^apple/", "/amazon/"}))
 		})
 	})
 
@@ -50,6 +90,9 @@ var _ = Describe("Caches", func() {
 			It("should return correct element count", func() {
 				Expect(cache.ElementCount()).Should(Equal(3))
 			})
+			It("should estimate the memory size", func() {
+				Expect(cache.MemorySize()).Should(BeNumerically(">=", 3*regexBaseSize))
+			})
 		})
 	})
 
@@ -74,6 +117,17 @@ var _ = Describe("Caches", func() {
 			It("should return correct element count", func() {
 				Expect(cache.ElementCount()).Should(Equal(3))
 			})
+			It("should estimate the memory size of all caches", func() {
+				Expect(cache.MemorySize()).Should(BeNumerically(">", 2*regexBaseSize+len("amazon.com")))
+			})
+			It("should iterate the strings and the regexes with slashes", func() {
+				var entries []string
+				cache.ForEach(func(entry string) {
+					entries = append(entries, entry)
+				})
+
+				Expect(entries).Should(Equal([]string{"amazon.com", "/.*google.com/", "/^apple\\.(de|com)$/"}))
+			})
 		})
 	})
 
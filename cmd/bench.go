@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/resolver"
+	"github.com/0xERR0R/blocky/server"
+	"github.com/0xERR0R/blocky/util"
+
+	"github.com/miekg/dns"
+	"github.com/spf13/cobra"
+)
+
+// NewBenchCommand creates new command instance
+func NewBenchCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "bench <file>",
+		Args:  cobra.ExactArgs(1),
+		Short: "replays the queries of the file through the resolver chain and reports throughput and latency",
+		Long: `Replays the queries of the file through the resolver chain of the configuration, without DNS listener.
+Each line of the file contains a domain name and an optional query type (default A), e.g. "example.com AAAA".`,
+		Run: bench,
+	}
+
+	c.Flags().UintP("concurrency", "n", 10, "number of parallel queries")
+	c.Flags().Bool("warmup", false, "replay the queries once before the measurement, e.g. to fill the cache")
+
+	return c
+}
+
+// benchQuery is one query of the bench file
+type benchQuery struct {
+	name  string
+	qType uint16
+}
+
+// benchResult contains the measurement of one run
+type benchResult struct {
+	errors    int
+	duration  time.Duration
+	latencies []time.Duration
+}
+
+// percentile returns the latency of the percentile (0 - 100), the latencies must be sorted
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	idx := int(float64(len(r.latencies))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+
+	if idx >= len(r.latencies) {
+		idx = len(r.latencies) - 1
+	}
+
+	return r.latencies[idx]
+}
+
+// throughput returns the queries per second
+func (r *benchResult) throughput() float64 {
+	if r.duration <= 0 {
+		return 0
+	}
+
+	return float64(len(r.latencies)) / r.duration.Seconds()
+}
+
+func bench(cmd *cobra.Command, args []string) {
+	concurrency, _ := cmd.Flags().GetUint("concurrency")
+	warmup, _ := cmd.Flags().GetBool("warmup")
+
+	if concurrency == 0 {
+		log.Log().Fatal("concurrency must be greater than 0")
+
+		return
+	}
+
+	queries, err := readBenchQueries(args[0])
+	if err != nil {
+		log.Log().Fatal("can't read queries: ", err)
+
+		return
+	}
+
+	loadConfig(true)
+
+	cfg := config.GetConfig()
+	configureHTTPClient(cfg)
+
+	r, err := server.NewQueryResolver(cfg)
+	if err != nil {
+		log.Log().Fatal("can't create resolver chain: ", err)
+
+		return
+	}
+
+	if warmup {
+		log.Log().Infof("warmup with %d queries", len(queries))
+
+		runBench(r, queries, concurrency)
+	}
+
+	printBenchResult(runBench(r, queries, concurrency), concurrency)
+}
+
+// readBenchQueries reads the queries of the file, empty lines and comments (#) are ignored
+func readBenchQueries(path string) ([]benchQuery, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		result []benchQuery
+		line   int
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line++
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		query := benchQuery{name: dns.Fqdn(fields[0]), qType: dns.TypeA}
+
+		if len(fields) > 1 {
+			qType, found := dns.StringToType[strings.ToUpper(fields[1])]
+			if !found {
+				return nil, fmt.Errorf("line %d: unknown query type '%s'", line, fields[1])
+			}
+
+			query.qType = qType
+		}
+
+		result = append(result, query)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no queries in '%s'", path)
+	}
+
+	return result, nil
+}
+
+// runBench resolves all queries with the passed amount of parallel workers
+func runBench(r resolver.Resolver, queries []benchQuery, concurrency uint) *benchResult {
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		result = &benchResult{latencies: make([]time.Duration, 0, len(queries))}
+		work   = make(chan benchQuery)
+		logger = log.PrefixedLog("bench")
+	)
+
+	start := time.Now()
+
+	for i := uint(0); i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for q := range work {
+				request := &model.Request{
+					ClientIP:  net.IPv4(127, 0, 0, 1),
+					Protocol:  model.RequestProtocolUDP,
+					Req:       util.NewMsgWithQuestion(q.name, q.qType),
+					Log:       logger,
+					RequestTS: time.Now(),
+				}
+
+				resp, err := resolver.Resolve(r, request)
+				latency := time.Since(request.RequestTS)
+
+				lock.Lock()
+				result.latencies = append(result.latencies, latency)
+
+				if err != nil || resp == nil {
+					result.errors++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, q := range queries {
+		work <- q
+	}
+
+	close(work)
+	wg.Wait()
+
+	result.duration = time.Since(start)
+
+	sort.Slice(result.latencies, func(i, j int) bool {
+		return result.latencies[i] < result.latencies[j]
+	})
+
+	return result
+}
+
+func printBenchResult(result *benchResult, concurrency uint) {
+	log.Log().Infof("%d queries in %s with concurrency %d, %d errors",
+		len(result.latencies), result.duration, concurrency, result.errors)
+	log.Log().Infof("\tthroughput: %10.1f queries/s", result.throughput())
+	log.Log().Infof("\tlatency p50: %10s", result.percentile(50))
+	log.Log().Infof("\tlatency p90: %10s", result.percentile(90))
+	log.Log().Infof("\tlatency p99: %10s", result.percentile(99))
+	log.Log().Infof("\tlatency max: %10s", result.percentile(100))
+}
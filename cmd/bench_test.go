@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"net"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/server"
+
+	"github.com/creasty/defaults"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+type panicResolver struct{}
+
+func (panicResolver) Resolve(*model.Request) (*model.Response, error) {
+	panic("bench")
+}
+
+func (panicResolver) Configuration() []string {
+	return nil
+}
+
+var _ = Describe("Bench command", func() {
+	Describe("Read queries", func() {
+		It("should read names with optional query type", func() {
+			file := TempFile("# comment\nexample.com\n\nexample.org aaaa\n")
+			defer file.Close()
+
+			queries, err := readBenchQueries(file.Name())
+			Expect(err).Should(Succeed())
+			Expect(queries).Should(Equal([]benchQuery{
+				{name: "example.com.", qType: dns.TypeA},
+				{name: "example.org.", qType: dns.TypeAAAA},
+			}))
+		})
+
+		It("should fail with unknown query type", func() {
+			file := TempFile("example.com\nexample.org XYZ\n")
+			defer file.Close()
+
+			_, err := readBenchQueries(file.Name())
+			Expect(err).Should(MatchError("line 2: unknown query type 'XYZ'"))
+		})
+
+		It("should fail without queries", func() {
+			file := TempFile("# comment\n")
+			defer file.Close()
+
+			_, err := readBenchQueries(file.Name())
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Run benchmark", func() {
+		It("should resolve all queries through the resolver chain", func() {
+			var cfg config.Config
+			Expect(defaults.Set(&cfg)).Should(Succeed())
+
+			cfg.CustomDNS.Mapping = config.CustomDNSMapping{
+				HostIPs: map[string][]net.IP{"bench.lan": {net.ParseIP("192.168.178.3")}},
+			}
+
+			r, err := server.NewQueryResolver(&cfg)
+			Expect(err).Should(Succeed())
+
+			queries := make([]benchQuery, 100)
+			for i := range queries {
+				queries[i] = benchQuery{name: "bench.lan.", qType: dns.TypeA}
+			}
+
+			result := runBench(r, queries, 4)
+			Expect(result.latencies).Should(HaveLen(100))
+			Expect(result.errors).Should(BeZero())
+			Expect(result.throughput()).Should(BeNumerically(">", 0))
+
+			printBenchResult(result, 4)
+			// the query log writes asynchronously, its entries can follow the result
+			Expect(loggerHook.AllEntries()).Should(ContainElement(
+				WithTransform(func(e *logrus.Entry) string { return e.Message }, ContainSubstring("latency max"))))
+		})
+
+		It("should count a panic of the resolver as error", func() {
+			result := runBench(panicResolver{}, []benchQuery{{name: "bench.lan.", qType: dns.TypeA}}, 1)
+			Expect(result.latencies).Should(HaveLen(1))
+			Expect(result.errors).Should(Equal(1))
+		})
+	})
+
+	It("should calculate the percentiles", func() {
+		result := &benchResult{duration: time.Second}
+		for i := 1; i <= 10; i++ {
+			result.latencies = append(result.latencies, time.Duration(i)*time.Millisecond)
+		}
+
+		Expect(result.percentile(50)).Should(Equal(5 * time.Millisecond))
+		Expect(result.percentile(90)).Should(Equal(9 * time.Millisecond))
+		Expect(result.percentile(100)).Should(Equal(10 * time.Millisecond))
+		Expect(result.throughput()).Should(BeNumerically("==", 10))
+		Expect((&benchResult{}).percentile(50)).Should(BeZero())
+	})
+})
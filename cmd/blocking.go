@@ -111,4 +111,8 @@ func statusBlocking(_ *cobra.Command, _ []string) {
 				strings.Join(result.DisabledGroups, "; "), result.AutoEnableInSec)
 		}
 	}
+
+	if len(result.AlwaysOnGroups) > 0 {
+		log.Log().Infof("always-on groups: %s", strings.Join(result.AlwaysOnGroups, "; "))
+	}
 }
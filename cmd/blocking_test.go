@@ -124,6 +124,23 @@ var _ = Describe("Blocking command", func() {
 				Expect(loggerHook.LastEntry().Message).Should(Equal("blocking disabled for groups: abc"))
 			})
 		})
+		When("status blocking is called via REST and always-on groups are defined", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					response, _ := json.Marshal(api.BlockingStatus{
+						Enabled:        false,
+						DisabledGroups: []string{"ads"},
+						AlwaysOnGroups: []string{"malware"},
+					})
+					_, err := w.Write(response)
+					Expect(err).Should(Succeed())
+				}
+			})
+			It("should show the always-on groups", func() {
+				statusBlocking(newBlockingCommand(), []string{})
+				Expect(loggerHook.LastEntry().Message).Should(Equal("always-on groups: malware"))
+			})
+		})
 		When("Wrong url is used", func() {
 			It("Should end with error", func() {
 				apiPort = 0
@@ -69,4 +69,12 @@ func query(cmd *cobra.Command, args []string) {
 	log.Log().Infof("\tresponse type: %20s", result.ResponseType)
 	log.Log().Infof("\tresponse:      %20s", result.Response)
 	log.Log().Infof("\treturn code:   %20s", result.ReturnCode)
+
+	if len(result.Timings) > 0 {
+		log.Log().Info("\ttimings:")
+
+		for _, t := range result.Timings {
+			log.Log().Infof("\t  %-28s %10.3f ms (total %.3f ms)", t.Resolver, t.DurationMs, t.TotalMs)
+		}
+	}
 }
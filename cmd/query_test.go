@@ -57,6 +57,27 @@ var _ = Describe("Blocking command", func() {
 				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("NOERROR"))
 			})
 		})
+		When("query result contains resolver timings", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					response, _ := json.Marshal(api.QueryResult{
+						Reason:       "Reason",
+						ResponseType: "Type",
+						Response:     "Response",
+						ReturnCode:   "NOERROR",
+						Timings:      []api.ResolverTiming{{Resolver: "CachingResolver", DurationMs: 0.5, TotalMs: 12.25}},
+					})
+					_, err := w.Write(response)
+					Expect(err).Should(Succeed())
+				}
+			})
+			It("should print the timings", func() {
+				query(NewQueryCommand(), []string{"google.de"})
+
+				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("CachingResolver"))
+				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("12.250 ms"))
+			})
+		})
 		When("Server returns 500", func() {
 			BeforeEach(func() {
 				mockFn = func(w http.ResponseWriter, _ *http.Request) {
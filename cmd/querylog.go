@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/querylog"
+
+	"github.com/spf13/cobra"
+)
+
+// NewQueryLogCommand creates new command instance
+func NewQueryLogCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "querylog",
+		Short: "query log operations",
+	}
+
+	tailCommand := &cobra.Command{
+		Use:   "tail",
+		Args:  cobra.NoArgs,
+		Short: "Print the newest entries of the configured CSV or database query log",
+		Run:   tailQueryLog,
+	}
+	tailCommand.Flags().IntP("lines", "n", 20, "number of entries to print, 0 for all entries")
+	tailCommand.Flags().String("client", "", "print only entries with client name or IP containing this value")
+	tailCommand.Flags().String("domain", "", "print only entries with question containing this value")
+	tailCommand.Flags().String("reason", "", "print only entries with reason containing this value")
+	tailCommand.Flags().BoolP("follow", "f", false, "print new entries as they are written (CSV only)")
+	c.AddCommand(tailCommand)
+
+	return c
+}
+
+func tailQueryLog(cmd *cobra.Command, _ []string) {
+	lines, _ := cmd.Flags().GetInt("lines")
+	follow, _ := cmd.Flags().GetBool("follow")
+	client, _ := cmd.Flags().GetString("client")
+	domain, _ := cmd.Flags().GetString("domain")
+	reason, _ := cmd.Flags().GetString("reason")
+
+	filter := querylog.Filter{Client: client, Domain: domain, Reason: reason}
+
+	reader, err := querylog.NewReader(config.GetConfig().QueryLog)
+	if err != nil {
+		log.Log().Fatal("can't read query log: ", err)
+
+		return
+	}
+
+	csvReader, isCSV := reader.(*querylog.CSVReader)
+	if follow && !isCSV {
+		log.Log().Fatal("follow is only supported for CSV query logs")
+
+		return
+	}
+
+	records, err := reader.Last(filter, lines)
+	if err != nil {
+		log.Log().Fatal("can't read query log: ", err)
+
+		return
+	}
+
+	for _, r := range records {
+		printRecord(r)
+	}
+
+	if follow {
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		if err := csvReader.Follow(filter, stop, printRecord); err != nil {
+			log.Log().Fatal("can't read query log: ", err)
+		}
+	}
+}
+
+func printRecord(r *querylog.Record) {
+	log.Log().Infof("%s  %-15s %-20s %6s ms  %-30s %-20s %-10s %s",
+		r.Time, r.ClientIP, r.ClientName, r.DurationMs, r.Reason, r.Question, r.ResponseCode, r.Answer)
+}
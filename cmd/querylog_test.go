@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/0xERR0R/blocky/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query log command", func() {
+	var tmpDir string
+
+	// calls the tail command directly, the config would be reloaded by Execute
+	tail := func(flags map[string]string) {
+		c, _, err := NewQueryLogCommand().Find([]string{"tail"})
+		Expect(err).Should(Succeed())
+
+		for name, value := range flags {
+			Expect(c.Flags().Set(name, value)).Should(Succeed())
+		}
+
+		tailQueryLog(c, nil)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "querylogCmd")
+		Expect(err).Should(Succeed())
+		DeferCleanup(os.RemoveAll, tmpDir)
+
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "2022-03-01_ALL.log"), []byte(
+			"2022-03-01 10:00:00\t192.168.178.25\tlaptop\t20\tResolved\tA (google.de.)\tA (1.2.3.4)\tNOERROR\n"+
+				"2022-03-01 10:00:01\t192.168.178.26\tphone\t1\tBLOCKED (ads)\tA (doubleclick.net.)\tA (0.0.0.0)\tNOERROR\n"),
+			0600)).Should(Succeed())
+
+		cfg := config.GetConfig().QueryLog
+		DeferCleanup(func() { config.GetConfig().QueryLog = cfg })
+
+		config.GetConfig().QueryLog = config.QueryLogConfig{Type: config.QueryLogTypeCsv, Target: tmpDir}
+
+		fatal = false
+	})
+
+	When("tail is called", func() {
+		It("should print the newest entries", func() {
+			tail(map[string]string{"lines": "1"})
+
+			Expect(fatal).Should(BeFalse())
+			Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("doubleclick.net"))
+		})
+
+		It("should print only entries matching the filter", func() {
+			tail(map[string]string{"client": "laptop"})
+
+			Expect(fatal).Should(BeFalse())
+			Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("google.de"))
+		})
+	})
+
+	When("query log can't be read", func() {
+		It("should end with error", func() {
+			config.GetConfig().QueryLog = config.QueryLogConfig{Type: config.QueryLogTypeConsole}
+
+			tail(nil)
+
+			Expect(fatal).Should(BeTrue())
+			Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("can't read query log"))
+		})
+	})
+
+	When("follow is used with a database query log", func() {
+		It("should end with error", func() {
+			config.GetConfig().QueryLog = config.QueryLogConfig{Type: config.QueryLogTypeMysql, Target: "wrong"}
+
+			tail(map[string]string{"follow": "true"})
+
+			Expect(fatal).Should(BeTrue())
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/log"
@@ -15,9 +16,12 @@ import (
 
 //nolint:gochecknoglobals
 var (
-	configPath string
-	apiHost    string
-	apiPort    uint16
+	configPath         string
+	configCache        string
+	configPollInterval time.Duration
+	configRestart      bool
+	apiHost            string
+	apiPort            uint16
 )
 
 // NewRootCommand creates a new root cli command instance
@@ -34,7 +38,13 @@ Complete documentation is available at https://github.com/0xERR0R/blocky`,
 		},
 	}
 
-	c.PersistentFlags().StringVarP(&configPath, "config", "c", "./config.yml", "path to config file")
+	c.PersistentFlags().StringVarP(&configPath, "config", "c", "./config.yml", "path to config file or HTTP(S) URL")
+	c.PersistentFlags().StringVar(&configCache, "configCache", "",
+		"local copy of the remote config, used if the URL is not reachable")
+	c.PersistentFlags().DurationVar(&configPollInterval, "configPollInterval", 0,
+		"poll interval for changes of the remote config, 0 to disable")
+	c.PersistentFlags().BoolVar(&configRestart, "configChangeRestart", false,
+		"stop blocky if the remote config has changed, the service manager must restart blocky to apply it")
 	c.PersistentFlags().StringVar(&apiHost, "apiHost", "localhost", "host of blocky (API). Default overridden by config and CLI.") // nolint:lll
 	c.PersistentFlags().Uint16Var(&apiPort, "apiPort", 4000, "port of blocky (API). Default overridden by config and CLI.")
 
@@ -43,7 +53,9 @@ Complete documentation is available at https://github.com/0xERR0R/blocky`,
 		NewVersionCommand(),
 		newServeCommand(),
 		newBlockingCommand(),
-		NewListsCommand())
+		NewListsCommand(),
+		NewQueryLogCommand(),
+		NewBenchCommand())
 
 	return c
 }
@@ -57,8 +69,22 @@ func init() {
 	cobra.OnInitialize(initConfig)
 }
 
+// loadConfig loads the config from the file or the HTTP(S) URL
+func loadConfig(mandatory bool) *config.RemoteConfigLoader {
+	if config.IsRemoteConfig(configPath) {
+		loader := config.NewRemoteConfigLoader(configPath, configCache)
+		loader.Load(mandatory)
+
+		return loader
+	}
+
+	config.LoadConfig(configPath, mandatory)
+
+	return nil
+}
+
 func initConfig() {
-	config.LoadConfig(configPath, false)
+	loadConfig(false)
 	log.ConfigureLogger(config.GetConfig().LogLevel, config.GetConfig().LogFormat, config.GetConfig().LogTimestamp)
 
 	if len(config.GetConfig().HTTPPorts) != 0 {
@@ -33,7 +33,7 @@ func newServeCommand() *cobra.Command {
 func startServer(_ *cobra.Command, _ []string) {
 	printBanner()
 
-	config.LoadConfig(configPath, true)
+	remoteConfig := loadConfig(true)
 	log.ConfigureLogger(config.GetConfig().LogLevel, config.GetConfig().LogFormat, config.GetConfig().LogTimestamp)
 
 	configureHTTPClient(config.GetConfig())
@@ -48,9 +48,19 @@ func startServer(_ *cobra.Command, _ []string) {
 
 	srv.Start()
 
+	stop := make(chan struct{}, 1)
+
+	if remoteConfig != nil && configPollInterval > 0 {
+		remoteConfig.Watch(configPollInterval, onRemoteConfigChange(configRestart, stop))
+	}
+
 	go func() {
-		<-signals
-		log.Log().Infof("Terminating...")
+		select {
+		case <-signals:
+			log.Log().Infof("Terminating...")
+		case <-stop:
+		}
+
 		srv.Stop()
 		done <- true
 	}()
@@ -59,6 +69,22 @@ func startServer(_ *cobra.Command, _ []string) {
 	<-done
 }
 
+// onRemoteConfigChange returns the handler of a changed remote config, blocky is only stopped if the restart to
+// apply the config is enabled. The config is not reloaded in place, the resolvers can't be replaced while running
+func onRemoteConfigChange(restart bool, stop chan<- struct{}) func() {
+	return func() {
+		if !restart {
+			log.Log().Warn("remote config has changed, restart blocky to apply it")
+
+			return
+		}
+
+		log.Log().Info("stopping blocky to apply the changed remote config on restart")
+
+		stop <- struct{}{}
+	}
+}
+
 func configureHTTPClient(cfg *config.Config) {
 	http.DefaultTransport = &http.Transport{
 		Dial:                (util.Dialer(cfg)).Dial,
@@ -6,6 +6,7 @@ import (
 	"github.com/0xERR0R/blocky/config"
 
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Serve command", func() {
@@ -23,4 +24,15 @@ var _ = Describe("Serve command", func() {
 			done <- true
 		})
 	})
+	When("the remote config has changed", func() {
+		It("should only stop blocky if the restart is enabled", func() {
+			stop := make(chan struct{}, 1)
+
+			onRemoteConfigChange(false, stop)()
+			Expect(stop).ShouldNot(Receive())
+
+			onRemoteConfigChange(true, stop)()
+			Expect(stop).Should(Receive())
+		})
+	})
 })
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/0xERR0R/blocky/log"
 	"github.com/creasty/defaults"
+	"github.com/miekg/dns"
 	"gopkg.in/yaml.v2"
 )
 
@@ -25,6 +27,7 @@ import (
 // tcp+udp // TCP and UDP protocols
 // tcp-tls // TCP-TLS protocol
 // https // HTTPS protocol
+// dnscrypt // DNSCrypt protocol
 // )
 type NetProtocol uint16
 
@@ -35,20 +38,129 @@ type NetProtocol uint16
 // postgresql // PostgreSQL database
 // csv // CSV file per day
 // csv-client // CSV file per day and client
+// dnstap // DNSTAP frame stream over unix socket or TCP
+// kafka // Kafka topic
 // )
 type QueryLogType int16
 
+// QueryLogField field of a query log entry ENUM(
+// time // timestamp of the request
+// clientIP // IP address of the client
+// clientName // name(s) of the client
+// duration // request duration in ms
+// reason // reason of the response
+// question // question of the request
+// answer // answer of the response
+// responseCode // DNS response code
+// upstreamResponseCode // raw response code of the upstream server
+// cached // answer was served from the cache
+// stale // answer was served from an expired cache entry
+// )
+type QueryLogField int
+
+// QueryLogTimeFormat format of the timestamps in the query log ENUM(
+// default // 2006-01-02 15:04:05
+// rfc3339 // RFC3339 with time zone offset, e.g. 2006-01-02T15:04:05+01:00
+// )
+type QueryLogTimeFormat uint8
+
+// QueryLogTimeZone time zone of the timestamps in the query log ENUM(
+// local // local time zone of the host
+// utc // UTC
+// )
+type QueryLogTimeZone uint8
+
+// CustomDNSAnswerOrder order of answers for custom DNS entries with multiple addresses ENUM(
+// fixed // return addresses in the configured order
+// shuffle // return all addresses in random order
+// round-robin // rotate the first address with each query
+// )
+type CustomDNSAnswerOrder uint8
+
+// UpstreamAnswerOrder order of A/AAAA records in responses from the upstream DNS servers ENUM(
+// keep // keep the order of the upstream response
+// shuffle // return the records in random order
+// sort // sort the records by address
+// )
+type UpstreamAnswerOrder uint8
+
+// UpstreamTruncatedResponse handling of truncated UDP responses from the upstream DNS servers ENUM(
+// retryTcp // repeat the query via TCP to the same upstream
+// return // return the truncated response, the client repeats the query via TCP
+// )
+type UpstreamTruncatedResponse uint8
+
+// RootQueryMode handling of queries to the root zone or a bare TLD ENUM(
+// forward // forward the query to the next resolver
+// refuse // return REFUSED
+// hint // answer with the configured static records
+// )
+type RootQueryMode uint8
+
+// MultipleQuestionsMode handling of DNS messages with more than one question ENUM(
+// refuse // answer with FORMERR
+// first // resolve only the first question, the other questions are ignored
+// )
+type MultipleQuestionsMode uint8
+
+// NoAnswerResponse answer for queries, which the resolver chain returns without response ENUM(
+// servfail // answer with SERVFAIL
+// nxdomain // answer with NXDOMAIN
+// refused // answer with REFUSED
+// )
+type NoAnswerResponse uint8
+
+// CNAMEBlockAction answer if a CNAME of the upstream response points to a blocked domain ENUM(
+// block // answer as a blocked query (blockType)
+// nxdomain // answer with NXDOMAIN
+// cname // return the CNAME records up to the blocked domain
+// original // return the original answer
+// )
+type CNAMEBlockAction uint8
+
+// QueryNameLimitResponse answer for queries with a name exceeding the limits ENUM(
+// formerr // answer with FORMERR
+// refused // answer with REFUSED
+// )
+type QueryNameLimitResponse uint8
+
+// ListConflictMode behavior if a domain is on the black and white list of the same group ENUM(
+// allow // the whitelist wins, it is checked first for each query
+// warn // like allow, the conflicting entries are logged as warning while loading the lists
+// )
+type ListConflictMode uint8
+
+// ListLoadingMode handling of queries before the initial load of the lists is complete ENUM(
+// wait // the DNS server starts after the lists are loaded
+// passThrough // the lists are loaded in the background, queries are resolved without blocking
+// hold // the lists are loaded in the background, queries wait up to the hold time and are refused afterwards
+// refuse // the lists are loaded in the background, queries are refused
+// )
+type ListLoadingMode uint8
+
+// ListFormat format of a list source ENUM(
+// auto // hosts or domain lines, Adblock Plus rules are detected
+// domains // one domain, IP or regex per line
+// hosts // hosts file format, all names after the IP address
+// adblock // Adblock Plus domain rules (||domain^)
+// )
+type ListFormat uint8
+
 type Duration time.Duration
 
 func (c *Duration) String() string {
 	return durafmt.Parse(time.Duration(*c)).String()
 }
 
+// FileSize size in bytes, can be defined with unit (KB, MB, GB)
+type FileSize uint64
+
 // nolint:gochecknoglobals
 var netDefaultPort = map[NetProtocol]uint16{
-	NetProtocolTcpUdp: 53,
-	NetProtocolTcpTls: 853,
-	NetProtocolHttps:  443,
+	NetProtocolTcpUdp:   53,
+	NetProtocolTcpTls:   853,
+	NetProtocolHttps:    443,
+	NetProtocolDnscrypt: 443,
 }
 
 // Upstream is the definition of external DNS server
@@ -57,6 +169,10 @@ type Upstream struct {
 	Host string
 	Port uint16
 	Path string
+
+	// DNSCrypt only: hex encoded public key and name of the provider
+	PublicKey    string
+	ProviderName string
 }
 
 // UnmarshalYAML creates Upstream from YAML
@@ -154,6 +270,203 @@ func (c *CustomDNSMapping) UnmarshalYAML(unmarshal func(interface{}) error) erro
 	return nil
 }
 
+// UnmarshalYAML creates CustomDNSRecords from YAML. Each record is defined in zone file format
+func (c *CustomDNSRecords) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input []string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	result := make(CustomDNSRecords, 0, len(input))
+
+	for _, v := range input {
+		rr, err := dns.NewRR(v)
+		if err != nil {
+			return fmt.Errorf("invalid custom DNS record '%s': %w", v, err)
+		}
+
+		switch rr.(type) {
+		case *dns.TXT, *dns.MX, *dns.SRV:
+			result = append(result, rr)
+		default:
+			return fmt.Errorf("unsupported custom DNS record '%s', only TXT, MX and SRV records are allowed", v)
+		}
+	}
+
+	*c = result
+
+	return nil
+}
+
+// UnmarshalYAML creates CustomDNSReverseZones from YAML. The key is a CIDR or a reverse zone name
+// (e.g. 1.168.192.in-addr.arpa), the value the name template
+func (c *CustomDNSReverseZones) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input map[string]string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	result := make(CustomDNSReverseZones, 0, len(input))
+
+	for k, v := range input {
+		subnet, err := parseReverseZone(k)
+		if err != nil {
+			return fmt.Errorf("invalid reverse zone '%s': %w", k, err)
+		}
+
+		sample := strings.ReplaceAll(v, ReverseZoneIPPlaceholder, "192-168-1-10")
+		if _, ok := dns.IsDomainName(sample); !strings.Contains(v, ReverseZoneIPPlaceholder) || !ok {
+			return fmt.Errorf("invalid name template '%s' for reverse zone '%s', must be a domain name containing '%s'",
+				v, k, ReverseZoneIPPlaceholder)
+		}
+
+		result = append(result, CustomDNSReverseZone{Subnet: subnet, Template: v})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		onesI, _ := result[i].Subnet.Mask.Size()
+		onesJ, _ := result[j].Subnet.Mask.Size()
+
+		if onesI != onesJ {
+			return onesI > onesJ
+		}
+
+		return result[i].Subnet.String() < result[j].Subnet.String()
+	})
+
+	*c = result
+
+	return nil
+}
+
+// parseReverseZone returns the subnet of a CIDR or a reverse zone name
+func parseReverseZone(zone string) (*net.IPNet, error) {
+	const (
+		ipv4Suffix = ".in-addr.arpa"
+		ipv6Suffix = ".ip6.arpa"
+	)
+
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+
+	switch {
+	case strings.HasSuffix(name, ipv4Suffix):
+		labels := strings.Split(strings.TrimSuffix(name, ipv4Suffix), ".")
+		if len(labels) > net.IPv4len {
+			return nil, errors.New("too many labels")
+		}
+
+		ip := make(net.IP, net.IPv4len)
+
+		for i, label := range labels {
+			octet, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid label '%s'", label)
+			}
+
+			ip[len(labels)-1-i] = byte(octet)
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(labels), 8*net.IPv4len)}, nil
+	case strings.HasSuffix(name, ipv6Suffix):
+		labels := strings.Split(strings.TrimSuffix(name, ipv6Suffix), ".")
+		if len(labels) > 2*net.IPv6len {
+			return nil, errors.New("too many labels")
+		}
+
+		ip := make(net.IP, net.IPv6len)
+
+		for i, label := range labels {
+			nibble, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil, fmt.Errorf("invalid label '%s'", label)
+			}
+
+			pos := len(labels) - 1 - i
+			if pos%2 == 0 {
+				nibble <<= 4
+			}
+
+			ip[pos/2] |= byte(nibble)
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(4*len(labels), 8*net.IPv6len)}, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(name)
+
+	return subnet, err
+}
+
+// UnmarshalYAML creates RootHints from YAML. Each record is defined in zone file format
+func (c *RootHints) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input []string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	result := make(RootHints, 0, len(input))
+
+	for _, v := range input {
+		rr, err := dns.NewRR(v)
+		if err != nil {
+			return fmt.Errorf("invalid root hint '%s': %w", v, err)
+		}
+
+		if dns.CountLabel(rr.Header().Name) > 1 {
+			return fmt.Errorf("invalid root hint '%s', only records for the root zone or a TLD are allowed", v)
+		}
+
+		result = append(result, rr)
+	}
+
+	*c = result
+
+	return nil
+}
+
+// UnmarshalYAML creates QueryTypes from YAML
+func (c *QueryTypes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input []string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	result := make(QueryTypes, 0, len(input))
+
+	for _, v := range input {
+		qType, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(v))]
+		if !ok {
+			return fmt.Errorf("unknown query type '%s'", v)
+		}
+
+		result = append(result, qType)
+	}
+
+	*c = result
+
+	return nil
+}
+
+// Contains returns true if the query type is in the list
+func (c QueryTypes) Contains(qType uint16) bool {
+	for _, t := range c {
+		if t == qType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c QueryTypes) String() string {
+	names := make([]string, len(c))
+	for i, t := range c {
+		names[i] = dns.TypeToString[t]
+	}
+
+	return strings.Join(names, ", ")
+}
+
 // UnmarshalYAML creates Duration from YAML. If no unit is used, uses minutes
 func (c *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var input string
@@ -177,11 +490,109 @@ func (c *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+// nolint:gochecknoglobals
+var fileSizeUnits = []struct {
+	suffix string
+	factor uint64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// UnmarshalYAML creates FileSize from YAML, a number without unit is in bytes
+func (c *FileSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(input))
+	factor := uint64(1)
+
+	for _, unit := range fileSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			factor = unit.factor
+
+			break
+		}
+	}
+
+	size, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid file size '%s': %w", input, err)
+	}
+
+	*c = FileSize(size * factor)
+
+	return nil
+}
+
+// UnmarshalYAML creates RefreshWindow from YAML in the format "HH:MM-HH:MM"
+func (w *RefreshWindow) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	parts := strings.Split(input, "-")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid refresh window '%s', expected format 'HH:MM-HH:MM'", input)
+	}
+
+	var times [2]time.Duration
+
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("invalid refresh window '%s': %w", input, err)
+		}
+
+		times[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+
+	if times[0] == times[1] {
+		return fmt.Errorf("invalid refresh window '%s', start and end are equal", input)
+	}
+
+	*w = RefreshWindow{Start: times[0], End: times[1]}
+
+	return nil
+}
+
+// UnmarshalYAML creates MACAddress from YAML
+func (m *MACAddress) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var input string
+	if err := unmarshal(&input); err != nil {
+		return err
+	}
+
+	mac, err := net.ParseMAC(input)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address '%s': %w", input, err)
+	}
+
+	*m = MACAddress(mac)
+
+	return nil
+}
+
 var validDomain = regexp.MustCompile(
 	`^(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]*[a-zA-Z0-9])\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\-]*[A-Za-z0-9])$`)
 
-// ParseUpstream creates new Upstream from passed string in format [net]:host[:port][/path]
+// ParseUpstream creates new Upstream from passed string in format [net]:host[:port][/path] or a DNS stamp (sdns://...)
 func ParseUpstream(upstream string) (Upstream, error) {
+	if strings.HasPrefix(upstream, dnsStampPrefix) {
+		stamp, err := parseDNSStamp(upstream)
+		if err != nil {
+			return Upstream{}, err
+		}
+
+		return stamp.upstream()
+	}
+
 	var path string
 
 	var port uint16
@@ -272,6 +683,7 @@ func extractNet(upstream string) (NetProtocol, string) {
 type Config struct {
 	Upstream        UpstreamConfig            `yaml:"upstream"`
 	UpstreamTimeout Duration                  `yaml:"upstreamTimeout" default:"2s"`
+	UpstreamCookies bool                      `yaml:"upstreamCookies" default:"true"`
 	CustomDNS       CustomDNSConfig           `yaml:"customDNS"`
 	Conditional     ConditionalUpstreamConfig `yaml:"conditional"`
 	Blocking        BlockingConfig            `yaml:"blocking"`
@@ -293,6 +705,54 @@ type Config struct {
 	KeyFile         string                    `yaml:"keyFile"`
 	BootstrapDNS    Upstream                  `yaml:"bootstrapDns"`
 	HostsFile       HostsFileConfig           `yaml:"hostsFile"`
+	TrustedProxy    TrustedProxyConfig        `yaml:"trustedProxy"`
+	HealthProbe     HealthProbeConfig         `yaml:"healthProbe"`
+	QueryQuota      QueryQuotaConfig          `yaml:"queryQuota"`
+	RootQueries     RootQueriesConfig         `yaml:"rootQueries"`
+	UpstreamLimit   UpstreamLimitConfig       `yaml:"upstreamLimit"`
+	LoopDetection   LoopDetectionConfig       `yaml:"loopDetection"`
+	// order of A/AAAA records in responses from the upstream DNS servers
+	UpstreamAnswerOrder UpstreamAnswerOrder `yaml:"upstreamAnswerOrder" default:"keep"`
+	// counts of blocked queries over time
+	BlockingStatistics BlockingStatisticsConfig `yaml:"blockingStatistics"`
+	// query types, which are only sent to the listed upstream DNS servers
+	UpstreamQueryTypes map[Upstream]QueryTypes `yaml:"upstreamQueryTypes"`
+	// max queries per second to the upstream DNS servers
+	UpstreamRateLimits map[Upstream]UpstreamRateLimitConfig `yaml:"upstreamRateLimits"`
+	// local IP address or network interface for the queries to the upstream DNS servers
+	UpstreamSourceAddress string `yaml:"upstreamSourceAddress"`
+	// wait for another upstream, if the first answer for A/AAAA is empty
+	RetryOnEmpty bool `yaml:"retryOnEmpty" default:"false"`
+	// tokens of the DoH clients
+	ClientAuth ClientAuthConfig `yaml:"clientAuth"`
+	// domains, which are appended to single-label queries (e.g. printer -> printer.home.arpa)
+	SearchDomains []string `yaml:"searchDomains"`
+	// trusted clients can select the upstream DNS server per query (diagnostics)
+	UpstreamOverride UpstreamOverrideConfig `yaml:"upstreamOverride"`
+	// limits of the open connections of the DoT and DoH servers
+	ConnectionLimits ConnectionLimitsConfig `yaml:"connectionLimits"`
+	// clients, which are allowed to query blocky
+	ClientACL ClientACLConfig `yaml:"clientACL"`
+	// handling of DNS messages with more than one question
+	MultipleQuestions MultipleQuestionsMode `yaml:"multipleQuestions" default:"refuse"`
+	// queries with longer names or more labels are rejected
+	QueryNameLimits QueryNameLimitsConfig `yaml:"queryNameLimits"`
+	// zones, which are transferred from the primary DNS server and answered authoritatively
+	SecondaryZones []SecondaryZoneConfig `yaml:"secondaryZones"`
+	// a panic in a resolver crashes the process instead of answering with SERVFAIL (debugging)
+	DisablePanicRecovery bool `yaml:"disablePanicRecovery" default:"false"`
+	// .local names are resolved with a multicast DNS query on the LAN
+	MDNS MDNSConfig `yaml:"mdns"`
+	// response type and reason are added as EDNS0 option to the responses of trusted clients (debugging)
+	EDNSDebugTag EDNSDebugTagConfig `yaml:"ednsDebugTag"`
+	// answer if the resolver chain returns neither a response nor an error
+	NoAnswerResponse NoAnswerResponse `yaml:"noAnswerResponse" default:"servfail"`
+	// multiplier of the upstream timeout per client (name, IP or CIDR), e.g. for high-latency clients over VPN
+	UpstreamTimeoutMultipliers map[string]float64 `yaml:"upstreamTimeoutMultipliers"`
+	// TXT record with version and hostname of the instance
+	Identity IdentityConfig `yaml:"identity"`
+	// handling of truncated UDP responses from the upstream DNS servers
+	UpstreamTruncatedResponse UpstreamTruncatedResponse `yaml:"upstreamTruncatedResponse" default:"retryTcp"`
 	// Deprecated
 	HTTPCertFile string `yaml:"httpsCertFile"`
 	// Deprecated
@@ -303,6 +763,10 @@ type Config struct {
 type PrometheusConfig struct {
 	Enable bool   `yaml:"enable" default:"false"`
 	Path   string `yaml:"path" default:"/metrics"`
+	// prepended to the names of all blocky metrics, e.g. "edge_" -> "edge_blocky_query_total"
+	Prefix string `yaml:"prefix"`
+	// static labels of all metrics, e.g. instance or location
+	Labels map[string]string `yaml:"labels"`
 }
 
 // UpstreamConfig upstream server configuration
@@ -310,10 +774,31 @@ type UpstreamConfig struct {
 	ExternalResolvers map[string][]Upstream `yaml:",inline"`
 }
 
+// QueryTypes is a list of DNS query types (A, AAAA, TXT, ...)
+type QueryTypes []uint16
+
 // CustomDNSConfig custom DNS configuration
 type CustomDNSConfig struct {
-	CustomTTL Duration         `yaml:"customTTL" default:"1h"`
-	Mapping   CustomDNSMapping `yaml:"mapping"`
+	CustomTTL     Duration                    `yaml:"customTTL" default:"1h"`
+	Mapping       CustomDNSMapping            `yaml:"mapping"`
+	ClientMapping map[string]CustomDNSMapping `yaml:"clientMapping"`
+	AnswerOrder   CustomDNSAnswerOrder        `yaml:"answerOrder" default:"fixed"`
+	Records       CustomDNSRecords            `yaml:"records"`
+	ReverseZones  CustomDNSReverseZones       `yaml:"reverseZones"`
+	Zones         []CustomDNSZoneConfig       `yaml:"zones"`
+}
+
+// CustomDNSZoneConfig locally served zone, the SOA and NS records of the apex are synthesized.
+// Empty values are replaced by defaults
+type CustomDNSZoneConfig struct {
+	Zone        string   `yaml:"zone"`
+	NameServers []string `yaml:"nameServers"`
+	Mbox        string   `yaml:"mbox"`
+	Serial      uint32   `yaml:"serial"`
+	Refresh     Duration `yaml:"refresh"`
+	Retry       Duration `yaml:"retry"`
+	Expire      Duration `yaml:"expire"`
+	Minimum     Duration `yaml:"minimum"`
 }
 
 // CustomDNSMapping mapping for the custom DNS configuration
@@ -321,10 +806,29 @@ type CustomDNSMapping struct {
 	HostIPs map[string][]net.IP
 }
 
+// CustomDNSRecords additional records (TXT, MX, SRV) for the custom DNS configuration
+type CustomDNSRecords []dns.RR
+
+// CustomDNSReverseZones generated PTR names for whole subnets, the most specific subnet comes first
+type CustomDNSReverseZones []CustomDNSReverseZone
+
+// CustomDNSReverseZone generates the PTR name for each address of the subnet from the template
+type CustomDNSReverseZone struct {
+	Subnet   *net.IPNet
+	Template string
+}
+
+// ReverseZoneIPPlaceholder is replaced with the address (dots and colons replaced by dashes) in the template
+const ReverseZoneIPPlaceholder = "{ip}"
+
 // ConditionalUpstreamConfig conditional upstream configuration
 type ConditionalUpstreamConfig struct {
-	Rewrite map[string]string          `yaml:"rewrite"`
-	Mapping ConditionalUpstreamMapping `yaml:"mapping"`
+	Rewrite       map[string]string                     `yaml:"rewrite"`
+	Mapping       ConditionalUpstreamMapping            `yaml:"mapping"`
+	ClientMapping map[string]ConditionalUpstreamMapping `yaml:"clientMapping"`
+	Fallthrough   []string                              `yaml:"fallthrough"`
+	// domains, which are resolved by the next resolvers if the conditional upstream fails
+	Fallback []string `yaml:"fallback"`
 }
 
 // ConditionalUpstreamMapping mapping for conditional configuration
@@ -332,37 +836,260 @@ type ConditionalUpstreamMapping struct {
 	Upstreams map[string][]Upstream
 }
 
+// maxJitterPercent limits the jitter of the refresh period and the prefetch cache time, with a higher jitter the
+// refresh or prefetch could happen almost immediately
+const maxJitterPercent = 50
+
 // BlockingConfig configuration for query blocking
 type BlockingConfig struct {
-	BlackLists           map[string][]string `yaml:"blackLists"`
-	WhiteLists           map[string][]string `yaml:"whiteLists"`
-	ClientGroupsBlock    map[string][]string `yaml:"clientGroupsBlock"`
-	BlockType            string              `yaml:"blockType" default:"ZEROIP"`
-	BlockTTL             Duration            `yaml:"blockTTL" default:"6h"`
-	DownloadTimeout      Duration            `yaml:"downloadTimeout" default:"60s"`
-	DownloadAttempts     int                 `yaml:"downloadAttempts" default:"3"`
-	DownloadCooldown     Duration            `yaml:"downloadCooldown" default:"1s"`
-	RefreshPeriod        Duration            `yaml:"refreshPeriod" default:"4h"`
-	FailStartOnListError bool                `yaml:"failStartOnListError" default:"false"`
+	BlackLists            map[string][]string `yaml:"blackLists"`
+	WhiteLists            map[string][]string `yaml:"whiteLists"`
+	ClientGroupsBlock     map[string][]string `yaml:"clientGroupsBlock"`
+	BlockType             string              `yaml:"blockType" default:"ZEROIP"`
+	BlockTTL              Duration            `yaml:"blockTTL" default:"6h"`
+	DownloadTimeout       Duration            `yaml:"downloadTimeout" default:"60s"`
+	DownloadAttempts      int                 `yaml:"downloadAttempts" default:"3"`
+	DownloadCooldown      Duration            `yaml:"downloadCooldown" default:"1s"`
+	RefreshPeriod         Duration            `yaml:"refreshPeriod" default:"4h"`
+	RefreshJitter         uint                `yaml:"refreshJitter" default:"10"`
+	FailStartOnListError  bool                `yaml:"failStartOnListError" default:"false"`
+	RefreshFailureWebhook string              `yaml:"refreshFailureWebhook"`
+	DryRunGroups          []string            `yaml:"dryRunGroups"`
+	BlockedTLDs           map[string][]string `yaml:"blockedTLDs"`
+	BlockTXTResponse      map[string]string   `yaml:"blockTxtResponse"`
+	HitCounting           bool                `yaml:"hitCounting" default:"false"`
+	BlockPage             BlockPageConfig     `yaml:"blockPage"`
+	AlwaysOnGroups        []string            `yaml:"alwaysOnGroups"`
+	// periodic refreshes of these groups are deferred until the daily time window
+	RefreshWindows map[string]RefreshWindow `yaml:"refreshWindows"`
+	// answer per group if a CNAME target of the response is blocked
+	CNAMEBlockAction map[string]CNAMEBlockAction `yaml:"cnameBlockAction"`
+	// domains blocked at runtime via API are saved in this file
+	DynamicBlocksFile string   `yaml:"dynamicBlocksFile"`
+	DynamicBlockTTL   Duration `yaml:"dynamicBlockTTL" default:"1h"`
+	// PTR queries of the custom block IPs are answered with this name
+	SinkholePTR string `yaml:"sinkholePtr"`
+	// domains on the black and white list of the same group
+	ListConflicts ListConflictMode `yaml:"listConflicts" default:"allow"`
+	// queries which arrive before the lists are loaded
+	ListLoading         ListLoadingMode `yaml:"listLoading" default:"wait"`
+	ListLoadingHoldTime Duration        `yaml:"listLoadingHoldTime" default:"5s"`
+	// format per list source (URL or file path), other sources are detected automatically
+	ListFormats map[string]ListFormat `yaml:"listFormats"`
+	// groups block only queries of these types, groups without entry block all types
+	BlockedQueryTypes map[string]QueryTypes `yaml:"blockedQueryTypes"`
+}
+
+// MACAddress is the hardware address of a client (e.g. "aa:bb:cc:dd:ee:ff")
+type MACAddress net.HardwareAddr
+
+// String returns the address in the format "aa:bb:cc:dd:ee:ff"
+func (m MACAddress) String() string {
+	return net.HardwareAddr(m).String()
+}
+
+// RefreshWindow is a daily time window in local time (e.g. "01:00-05:00"), the window can span midnight
+type RefreshWindow struct {
+	// Start and End are the durations since midnight
+	Start, End time.Duration
+}
+
+// String returns the window in the format "HH:MM-HH:MM"
+func (w RefreshWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+
+	return format(w.Start) + "-" + format(w.End)
+}
+
+// Delay returns the time until the window opens, 0 if t is within the window
+func (w RefreshWindow) Delay(t time.Time) time.Duration {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	now := t.Sub(midnight)
+
+	if w.Start <= w.End {
+		if now >= w.Start && now < w.End {
+			return 0
+		}
+	} else if now >= w.Start || now < w.End {
+		return 0
+	}
+
+	delay := w.Start - now
+	if delay < 0 {
+		delay += 24 * time.Hour
+	}
+
+	return delay
+}
+
+// BlockPageConfig configuration for the HTTP(S) block page, which explains blocked requests.
+// Only useful with a custom IP block type pointing to blocky
+type BlockPageConfig struct {
+	Port      ListenConfig `yaml:"port"`
+	HTTPSPort ListenConfig `yaml:"httpsPort"`
+}
+
+// IsEnabled returns true if at least one block page listener is configured
+func (c *BlockPageConfig) IsEnabled() bool {
+	return len(c.Port) != 0 || len(c.HTTPSPort) != 0
+}
+
+// BlockingStatisticsConfig configuration for the hourly counts of blocked queries
+type BlockingStatisticsConfig struct {
+	Retention Duration `yaml:"retention"`
 }
 
 // ClientLookupConfig configuration for the client lookup
 type ClientLookupConfig struct {
-	ClientnameIPMapping map[string][]net.IP `yaml:"clients"`
-	Upstream            Upstream            `yaml:"upstream"`
-	SingleNameOrder     []uint              `yaml:"singleNameOrder"`
+	ClientnameIPMapping  map[string][]net.IP     `yaml:"clients"`
+	ClientnameMACMapping map[string][]MACAddress `yaml:"macs"`
+	Upstream             Upstream                `yaml:"upstream"`
+	SingleNameOrder      []uint                  `yaml:"singleNameOrder"`
+}
+
+// TrustedProxyConfig configuration for DoH requests received via a reverse proxy
+type TrustedProxyConfig struct {
+	Header               string   `yaml:"header" default:"X-Forwarded-For"`
+	CIDRs                []string `yaml:"cidrs"`
+	UseEDNS0ClientSubnet bool     `yaml:"useEdns0ClientSubnet" default:"false"`
+}
+
+// ClientAuthConfig configuration of the tokens for DoH clients. If tokens are defined, DoH requests without a valid
+// token and all DoT requests are refused
+type ClientAuthConfig struct {
+	// token -> client name
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+// HealthProbeConfig configuration for the periodic synthetic query
+type HealthProbeConfig struct {
+	Domain           string   `yaml:"domain"`
+	Interval         Duration `yaml:"interval" default:"1m"`
+	FailureThreshold uint     `yaml:"failureThreshold" default:"3"`
+}
+
+// UpstreamLimitConfig configuration for the limit of concurrent upstream resolutions
+type UpstreamLimitConfig struct {
+	MaxConcurrent uint     `yaml:"maxConcurrent"`
+	WaitTimeout   Duration `yaml:"waitTimeout" default:"100ms"`
+	// max concurrent queries to a single upstream DNS server
+	MaxConcurrentPerUpstream uint `yaml:"maxConcurrentPerUpstream"`
+}
+
+// UpstreamRateLimitConfig configuration for the queries per second to an upstream DNS server (token bucket)
+type UpstreamRateLimitConfig struct {
+	QPS   uint `yaml:"qps"`
+	Burst uint `yaml:"burst"`
+	// queries over the limit wait up to this time, 0 - the query fails immediately
+	MaxWait Duration `yaml:"maxWait"`
+}
+
+// UpstreamOverrideConfig configuration for the selection of the upstream DNS server per query via EDNS0 option
+type UpstreamOverrideConfig struct {
+	Enabled bool     `yaml:"enabled" default:"false"`
+	Clients []string `yaml:"clients"`
+}
+
+// EDNSDebugTagConfig configuration of the EDNS0 option with the response type and reason
+type EDNSDebugTagConfig struct {
+	Enabled bool     `yaml:"enabled" default:"false"`
+	Clients []string `yaml:"clients"`
+}
+
+// ClientACLConfig restricts the queries to the allowed client IPs and CIDRs, all other clients get REFUSED.
+// Without allowed clients, all clients can query
+type ClientACLConfig struct {
+	AllowedClients []string `yaml:"allowedClients"`
+}
+
+// QueryNameLimitsConfig limits the length and the label count of the query names,
+// the defaults are the maximums of the DNS protocol
+type QueryNameLimitsConfig struct {
+	MaxLength uint                   `yaml:"maxLength" default:"253"`
+	MaxLabels uint                   `yaml:"maxLabels" default:"127"`
+	Response  QueryNameLimitResponse `yaml:"response" default:"formerr"`
+}
+
+// SecondaryZoneConfig zone, which is transferred periodically from the primary DNS server via AXFR.
+// Without refresh, the refresh interval of the SOA record is used
+type SecondaryZoneConfig struct {
+	Zone    string   `yaml:"zone"`
+	Primary string   `yaml:"primary"`
+	Refresh Duration `yaml:"refresh"`
+}
+
+// ConnectionLimitsConfig limits the open connections of the encrypted DNS servers (DoT, DoH), 0 - no limit
+type ConnectionLimitsConfig struct {
+	MaxConnections      int `yaml:"maxConnections" default:"0"`
+	MaxConnectionsPerIP int `yaml:"maxConnectionsPerIP" default:"0"`
+}
+
+// LoopDetectionConfig configuration for the detection of forwarding loops
+type LoopDetectionConfig struct {
+	MaxHops       uint8    `yaml:"maxHops" default:"0"`
+	SelfAddresses []string `yaml:"selfAddresses"`
+}
+
+// QueryQuotaConfig configuration for the daily query quota per client
+type QueryQuotaConfig struct {
+	ClientGroups map[string]uint `yaml:"clientGroups"`
+	StateFile    string          `yaml:"stateFile"`
+}
+
+// RootQueriesConfig configuration for queries to the root zone (".") or a bare TLD (e.g. "com.")
+type RootQueriesConfig struct {
+	Mode      RootQueryMode `yaml:"mode" default:"forward"`
+	Hints     RootHints     `yaml:"hints"`
+	RateLimit uint          `yaml:"rateLimit"`
+}
+
+// MDNSConfig configuration of the multicast DNS resolution of .local names
+type MDNSConfig struct {
+	Enable    bool     `yaml:"enable" default:"false"`
+	Timeout   Duration `yaml:"timeout" default:"1s"`
+	CacheTime Duration `yaml:"cacheTime" default:"1m"`
+}
+
+// IdentityConfig configuration of the TXT answer with version, build time and hostname of the instance
+type IdentityConfig struct {
+	Enable bool   `yaml:"enable" default:"false"`
+	Name   string `yaml:"name" default:"_blocky.version"`
+	// hostname in the answer, default: hostname of the system
+	Hostname string `yaml:"hostname"`
+	// only these clients (IPs or CIDRs) get the answer, default: all clients
+	Clients []string `yaml:"clients"`
 }
 
+// RootHints static records for queries to the root zone or a bare TLD
+type RootHints []dns.RR
+
 // CachingConfig configuration for domain caching
 type CachingConfig struct {
 	MinCachingTime        Duration `yaml:"minTime"`
 	MaxCachingTime        Duration `yaml:"maxTime"`
 	CacheTimeNegative     Duration `yaml:"cacheTimeNegative" default:"30m"`
+	CacheTimeServFail     Duration `yaml:"cacheTimeServFail"`
+	ForceTTL              Duration `yaml:"forceTtl"`
+	ClientMaxTTL          Duration `yaml:"clientMaxTtl"`
 	MaxItemsCount         int      `yaml:"maxItemsCount"`
 	Prefetching           bool     `yaml:"prefetching"`
 	PrefetchExpires       Duration `yaml:"prefetchExpires" default:"2h"`
 	PrefetchThreshold     int      `yaml:"prefetchThreshold" default:"5"`
 	PrefetchMaxItemsCount int      `yaml:"prefetchMaxItemsCount"`
+	PrefetchJitter        uint     `yaml:"prefetchJitter" default:"10"`
+	Shards                uint     `yaml:"shards" default:"16"`
+	// fixed TTL per domain (including sub-domains), overrides all other TTL settings
+	DomainTTL map[string]Duration `yaml:"domainTtl"`
+	// expired answers are kept for this time and served if the upstream fails (serve-stale)
+	StaleRetention Duration `yaml:"staleRetention"`
+	// max. time since the expiration of a served stale answer, 0: the retention time
+	StaleMaxAge Duration `yaml:"staleMaxAge"`
+	// domains (including sub-domains) which are never cached
+	NoCacheDomains []string `yaml:"noCacheDomains"`
+	// clients (name, IP, CIDR or group name with wildcards) which always get fresh answers
+	NoCacheClients []string `yaml:"noCacheClients"`
 }
 
 // QueryLogConfig configuration for the query logging
@@ -370,12 +1097,28 @@ type QueryLogConfig struct {
 	// Deprecated
 	Dir string `yaml:"dir"`
 	// Deprecated
-	PerClient        bool         `yaml:"perClient" default:"false"`
-	Target           string       `yaml:"target"`
-	Type             QueryLogType `yaml:"type"`
-	LogRetentionDays uint64       `yaml:"logRetentionDays"`
-	CreationAttempts int          `yaml:"creationAttempts" default:"3"`
-	CreationCooldown Duration     `yaml:"creationCooldown" default:"2s"`
+	PerClient        bool            `yaml:"perClient" default:"false"`
+	Target           string          `yaml:"target"`
+	Type             QueryLogType    `yaml:"type"`
+	LogRetentionDays uint64          `yaml:"logRetentionDays"`
+	CreationAttempts int             `yaml:"creationAttempts" default:"3"`
+	CreationCooldown Duration        `yaml:"creationCooldown" default:"2s"`
+	CSVFields        []QueryLogField `yaml:"csvFields"`
+	MaxFileSize      FileSize        `yaml:"maxFileSize"`
+	// format and time zone of the timestamps in the CSV files
+	TimeFormat QueryLogTimeFormat `yaml:"timeFormat" default:"default"`
+	TimeZone   QueryLogTimeZone   `yaml:"timeZone" default:"local"`
+	// own type, target and fields per client (name, IP or CIDR)
+	ClientMapping map[string]QueryLogClientConfig `yaml:"clientMapping"`
+	// log the raw upstream response code and if the answer was cached
+	SourceFields bool `yaml:"sourceFields" default:"false"`
+}
+
+// QueryLogClientConfig query log of the clients, the CSV fields are inherited if not defined
+type QueryLogClientConfig struct {
+	Type      QueryLogType    `yaml:"type"`
+	Target    string          `yaml:"target"`
+	CSVFields []QueryLogField `yaml:"csvFields"`
 }
 
 // RedisConfig configuration for the redis connection
@@ -421,17 +1164,35 @@ func LoadConfig(path string, mandatory bool) {
 }
 
 func unmarshalConfig(data []byte, cfg Config) {
-	err := yaml.UnmarshalStrict(data, &cfg)
+	c, err := parseConfig(data, cfg)
 	if err != nil {
-		log.Log().Fatal("wrong file structure: ", err)
+		log.Log().Fatal(err)
 	}
 
-	validateConfig(&cfg)
+	config = c
+}
 
-	config = &cfg
+// parseConfig creates the config from YAML and validates it
+func parseConfig(data []byte, cfg Config) (*Config, error) {
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("wrong file structure: %w", err)
+	}
+
+	if err := checkConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
 }
 
 func validateConfig(cfg *Config) {
+	if err := checkConfig(cfg); err != nil {
+		log.Log().Fatal(err)
+	}
+}
+
+// checkConfig maps deprecated parameters and returns an error if mandatory parameters are missing
+func checkConfig(cfg *Config) error {
 	if cfg.QueryLog.Dir != "" {
 		log.Log().Warnf("queryLog.Dir is deprecated, use 'queryLog.target' instead")
 
@@ -458,12 +1219,113 @@ func validateConfig(cfg *Config) {
 	}
 
 	if len(cfg.TLSPorts) != 0 && (cfg.CertFile == "" || cfg.KeyFile == "") {
-		log.Log().Fatal("certFile and keyFile parameters are mandatory for TLS")
+		return errors.New("certFile and keyFile parameters are mandatory for TLS")
 	}
 
 	if len(cfg.HTTPSPorts) != 0 && (cfg.CertFile == "" || cfg.KeyFile == "") {
-		log.Log().Fatal("certFile and keyFile parameters are mandatory for HTTPS")
+		return errors.New("certFile and keyFile parameters are mandatory for HTTPS")
+	}
+
+	if len(cfg.Blocking.BlockPage.HTTPSPort) != 0 && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return errors.New("certFile and keyFile parameters are mandatory for the HTTPS block page")
+	}
+
+	if cfg.UpstreamSourceAddress != "" && net.ParseIP(cfg.UpstreamSourceAddress) == nil {
+		if _, err := net.InterfaceByName(cfg.UpstreamSourceAddress); err != nil {
+			return fmt.Errorf("upstreamSourceAddress '%s' is neither a valid IP address nor a network interface",
+				cfg.UpstreamSourceAddress)
+		}
+	}
+
+	for _, client := range cfg.UpstreamOverride.Clients {
+		if _, _, err := net.ParseCIDR(client); err != nil && net.ParseIP(client) == nil {
+			return fmt.Errorf("upstream override client '%s' is not a valid IP address or CIDR", client)
+		}
+	}
+
+	for _, client := range cfg.ClientACL.AllowedClients {
+		if _, _, err := net.ParseCIDR(client); err != nil && net.ParseIP(client) == nil {
+			return fmt.Errorf("allowed client '%s' is not a valid IP address or CIDR", client)
+		}
+	}
+
+	for _, zone := range cfg.SecondaryZones {
+		if _, ok := dns.IsDomainName(zone.Zone); !ok || strings.Trim(zone.Zone, ".") == "" {
+			return fmt.Errorf("secondary zone '%s' is not a valid domain name", zone.Zone)
+		}
+
+		if zone.Primary == "" {
+			return fmt.Errorf("secondary zone '%s' has no primary", zone.Zone)
+		}
+	}
+
+	for _, domain := range cfg.SearchDomains {
+		if _, ok := dns.IsDomainName(domain); !ok || strings.Trim(domain, ".") == "" {
+			return fmt.Errorf("search domain '%s' is not a valid domain name", domain)
+		}
+	}
+
+	if cfg.Blocking.RefreshJitter > maxJitterPercent {
+		return fmt.Errorf("blocking.refreshJitter %d is greater than %d percent", cfg.Blocking.RefreshJitter, maxJitterPercent)
+	}
+
+	if cfg.Caching.PrefetchJitter > maxJitterPercent {
+		return fmt.Errorf("caching.prefetchJitter %d is greater than %d percent", cfg.Caching.PrefetchJitter, maxJitterPercent)
+	}
+
+	return checkUpstreamLoops(cfg)
+}
+
+// checkUpstreamLoops returns an error if an upstream points to a self address on the DNS port of blocky
+func checkUpstreamLoops(cfg *Config) error {
+	if len(cfg.LoopDetection.SelfAddresses) == 0 {
+		return nil
+	}
+
+	dnsPorts := make(map[uint16]bool)
+
+	for _, p := range cfg.DNSPorts {
+		port, err := strconv.ParseUint(p[strings.LastIndex(p, ":")+1:], 10, 16)
+		if err == nil {
+			dnsPorts[uint16(port)] = true
+		}
 	}
+
+	var upstreams []Upstream
+
+	for _, u := range cfg.Upstream.ExternalResolvers {
+		upstreams = append(upstreams, u...)
+	}
+
+	for _, u := range cfg.Conditional.Mapping.Upstreams {
+		upstreams = append(upstreams, u...)
+	}
+
+	for _, m := range cfg.Conditional.ClientMapping {
+		for _, u := range m.Upstreams {
+			upstreams = append(upstreams, u...)
+		}
+	}
+
+	for _, u := range upstreams {
+		if u.Net != NetProtocolHttps && dnsPorts[u.Port] && isSelfAddress(u.Host, cfg.LoopDetection.SelfAddresses) {
+			return fmt.Errorf("upstream '%s:%d' points to blocky itself (loopDetection.selfAddresses)", u.Host, u.Port)
+		}
+	}
+
+	return nil
+}
+
+func isSelfAddress(host string, selfAddresses []string) bool {
+	hostIP := net.ParseIP(host)
+
+	for _, self := range selfAddresses {
+		if strings.EqualFold(host, self) || (hostIP != nil && hostIP.Equal(net.ParseIP(self))) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // GetConfig returns the current config
@@ -11,6 +11,438 @@ import (
 	"strings"
 )
 
+const (
+	// CNAMEBlockActionBlock is a CNAMEBlockAction of type Block.
+	// answer as a blocked query (blockType)
+	CNAMEBlockActionBlock CNAMEBlockAction = iota
+	// CNAMEBlockActionNxdomain is a CNAMEBlockAction of type Nxdomain.
+	// answer with NXDOMAIN
+	CNAMEBlockActionNxdomain
+	// CNAMEBlockActionCname is a CNAMEBlockAction of type Cname.
+	// return the CNAME records up to the blocked domain
+	CNAMEBlockActionCname
+	// CNAMEBlockActionOriginal is a CNAMEBlockAction of type Original.
+	// return the original answer
+	CNAMEBlockActionOriginal
+)
+
+const _CNAMEBlockActionName = "blocknxdomaincnameoriginal"
+
+var _CNAMEBlockActionNames = []string{
+	_CNAMEBlockActionName[0:5],
+	_CNAMEBlockActionName[5:13],
+	_CNAMEBlockActionName[13:18],
+	_CNAMEBlockActionName[18:26],
+}
+
+// CNAMEBlockActionNames returns a list of possible string values of CNAMEBlockAction.
+func CNAMEBlockActionNames() []string {
+	tmp := make([]string, len(_CNAMEBlockActionNames))
+	copy(tmp, _CNAMEBlockActionNames)
+	return tmp
+}
+
+var _CNAMEBlockActionMap = map[CNAMEBlockAction]string{
+	0: _CNAMEBlockActionName[0:5],
+	1: _CNAMEBlockActionName[5:13],
+	2: _CNAMEBlockActionName[13:18],
+	3: _CNAMEBlockActionName[18:26],
+}
+
+// String implements the Stringer interface.
+func (x CNAMEBlockAction) String() string {
+	if str, ok := _CNAMEBlockActionMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("CNAMEBlockAction(%d)", x)
+}
+
+var _CNAMEBlockActionValue = map[string]CNAMEBlockAction{
+	_CNAMEBlockActionName[0:5]:   0,
+	_CNAMEBlockActionName[5:13]:  1,
+	_CNAMEBlockActionName[13:18]: 2,
+	_CNAMEBlockActionName[18:26]: 3,
+}
+
+// ParseCNAMEBlockAction attempts to convert a string to a CNAMEBlockAction
+func ParseCNAMEBlockAction(name string) (CNAMEBlockAction, error) {
+	if x, ok := _CNAMEBlockActionValue[name]; ok {
+		return x, nil
+	}
+	return CNAMEBlockAction(0), fmt.Errorf("%s is not a valid CNAMEBlockAction, try [%s]", name, strings.Join(_CNAMEBlockActionNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x CNAMEBlockAction) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *CNAMEBlockAction) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseCNAMEBlockAction(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// CustomDNSAnswerOrderFixed is a CustomDNSAnswerOrder of type Fixed.
+	// return addresses in the configured order
+	CustomDNSAnswerOrderFixed CustomDNSAnswerOrder = iota
+	// CustomDNSAnswerOrderShuffle is a CustomDNSAnswerOrder of type Shuffle.
+	// return all addresses in random order
+	CustomDNSAnswerOrderShuffle
+	// CustomDNSAnswerOrderRoundRobin is a CustomDNSAnswerOrder of type Round-Robin.
+	// rotate the first address with each query
+	CustomDNSAnswerOrderRoundRobin
+)
+
+const _CustomDNSAnswerOrderName = "fixedshuffleround-robin"
+
+var _CustomDNSAnswerOrderNames = []string{
+	_CustomDNSAnswerOrderName[0:5],
+	_CustomDNSAnswerOrderName[5:12],
+	_CustomDNSAnswerOrderName[12:23],
+}
+
+// CustomDNSAnswerOrderNames returns a list of possible string values of CustomDNSAnswerOrder.
+func CustomDNSAnswerOrderNames() []string {
+	tmp := make([]string, len(_CustomDNSAnswerOrderNames))
+	copy(tmp, _CustomDNSAnswerOrderNames)
+	return tmp
+}
+
+var _CustomDNSAnswerOrderMap = map[CustomDNSAnswerOrder]string{
+	0: _CustomDNSAnswerOrderName[0:5],
+	1: _CustomDNSAnswerOrderName[5:12],
+	2: _CustomDNSAnswerOrderName[12:23],
+}
+
+// String implements the Stringer interface.
+func (x CustomDNSAnswerOrder) String() string {
+	if str, ok := _CustomDNSAnswerOrderMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("CustomDNSAnswerOrder(%d)", x)
+}
+
+var _CustomDNSAnswerOrderValue = map[string]CustomDNSAnswerOrder{
+	_CustomDNSAnswerOrderName[0:5]:   0,
+	_CustomDNSAnswerOrderName[5:12]:  1,
+	_CustomDNSAnswerOrderName[12:23]: 2,
+}
+
+// ParseCustomDNSAnswerOrder attempts to convert a string to a CustomDNSAnswerOrder
+func ParseCustomDNSAnswerOrder(name string) (CustomDNSAnswerOrder, error) {
+	if x, ok := _CustomDNSAnswerOrderValue[name]; ok {
+		return x, nil
+	}
+	return CustomDNSAnswerOrder(0), fmt.Errorf("%s is not a valid CustomDNSAnswerOrder, try [%s]", name, strings.Join(_CustomDNSAnswerOrderNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x CustomDNSAnswerOrder) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *CustomDNSAnswerOrder) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseCustomDNSAnswerOrder(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// ListConflictModeAllow is a ListConflictMode of type Allow.
+	// the whitelist wins, it is checked first for each query
+	ListConflictModeAllow ListConflictMode = iota
+	// ListConflictModeWarn is a ListConflictMode of type Warn.
+	// like allow, the conflicting entries are logged as warning while loading the lists
+	ListConflictModeWarn
+)
+
+const _ListConflictModeName = "allowwarn"
+
+var _ListConflictModeNames = []string{
+	_ListConflictModeName[0:5],
+	_ListConflictModeName[5:9],
+}
+
+// ListConflictModeNames returns a list of possible string values of ListConflictMode.
+func ListConflictModeNames() []string {
+	tmp := make([]string, len(_ListConflictModeNames))
+	copy(tmp, _ListConflictModeNames)
+	return tmp
+}
+
+var _ListConflictModeMap = map[ListConflictMode]string{
+	0: _ListConflictModeName[0:5],
+	1: _ListConflictModeName[5:9],
+}
+
+// String implements the Stringer interface.
+func (x ListConflictMode) String() string {
+	if str, ok := _ListConflictModeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("ListConflictMode(%d)", x)
+}
+
+var _ListConflictModeValue = map[string]ListConflictMode{
+	_ListConflictModeName[0:5]: 0,
+	_ListConflictModeName[5:9]: 1,
+}
+
+// ParseListConflictMode attempts to convert a string to a ListConflictMode
+func ParseListConflictMode(name string) (ListConflictMode, error) {
+	if x, ok := _ListConflictModeValue[name]; ok {
+		return x, nil
+	}
+	return ListConflictMode(0), fmt.Errorf("%s is not a valid ListConflictMode, try [%s]", name, strings.Join(_ListConflictModeNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x ListConflictMode) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *ListConflictMode) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseListConflictMode(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// ListFormatAuto is a ListFormat of type Auto.
+	// hosts or domain lines, Adblock Plus rules are detected
+	ListFormatAuto ListFormat = iota
+	// ListFormatDomains is a ListFormat of type Domains.
+	// one domain, IP or regex per line
+	ListFormatDomains
+	// ListFormatHosts is a ListFormat of type Hosts.
+	// hosts file format, all names after the IP address
+	ListFormatHosts
+	// ListFormatAdblock is a ListFormat of type Adblock.
+	// Adblock Plus domain rules (||domain^)
+	ListFormatAdblock
+)
+
+const _ListFormatName = "autodomainshostsadblock"
+
+var _ListFormatNames = []string{
+	_ListFormatName[0:4],
+	_ListFormatName[4:11],
+	_ListFormatName[11:16],
+	_ListFormatName[16:23],
+}
+
+// ListFormatNames returns a list of possible string values of ListFormat.
+func ListFormatNames() []string {
+	tmp := make([]string, len(_ListFormatNames))
+	copy(tmp, _ListFormatNames)
+	return tmp
+}
+
+var _ListFormatMap = map[ListFormat]string{
+	0: _ListFormatName[0:4],
+	1: _ListFormatName[4:11],
+	2: _ListFormatName[11:16],
+	3: _ListFormatName[16:23],
+}
+
+// String implements the Stringer interface.
+func (x ListFormat) String() string {
+	if str, ok := _ListFormatMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("ListFormat(%d)", x)
+}
+
+var _ListFormatValue = map[string]ListFormat{
+	_ListFormatName[0:4]:   0,
+	_ListFormatName[4:11]:  1,
+	_ListFormatName[11:16]: 2,
+	_ListFormatName[16:23]: 3,
+}
+
+// ParseListFormat attempts to convert a string to a ListFormat
+func ParseListFormat(name string) (ListFormat, error) {
+	if x, ok := _ListFormatValue[name]; ok {
+		return x, nil
+	}
+	return ListFormat(0), fmt.Errorf("%s is not a valid ListFormat, try [%s]", name, strings.Join(_ListFormatNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x ListFormat) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *ListFormat) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseListFormat(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// ListLoadingModeWait is a ListLoadingMode of type Wait.
+	// the DNS server starts after the lists are loaded
+	ListLoadingModeWait ListLoadingMode = iota
+	// ListLoadingModePassThrough is a ListLoadingMode of type PassThrough.
+	// the lists are loaded in the background, queries are resolved without blocking
+	ListLoadingModePassThrough
+	// ListLoadingModeHold is a ListLoadingMode of type Hold.
+	// the lists are loaded in the background, queries wait up to the hold time and are refused afterwards
+	ListLoadingModeHold
+	// ListLoadingModeRefuse is a ListLoadingMode of type Refuse.
+	// the lists are loaded in the background, queries are refused
+	ListLoadingModeRefuse
+)
+
+const _ListLoadingModeName = "waitpassThroughholdrefuse"
+
+var _ListLoadingModeNames = []string{
+	_ListLoadingModeName[0:4],
+	_ListLoadingModeName[4:15],
+	_ListLoadingModeName[15:19],
+	_ListLoadingModeName[19:25],
+}
+
+// ListLoadingModeNames returns a list of possible string values of ListLoadingMode.
+func ListLoadingModeNames() []string {
+	tmp := make([]string, len(_ListLoadingModeNames))
+	copy(tmp, _ListLoadingModeNames)
+	return tmp
+}
+
+var _ListLoadingModeMap = map[ListLoadingMode]string{
+	0: _ListLoadingModeName[0:4],
+	1: _ListLoadingModeName[4:15],
+	2: _ListLoadingModeName[15:19],
+	3: _ListLoadingModeName[19:25],
+}
+
+// String implements the Stringer interface.
+func (x ListLoadingMode) String() string {
+	if str, ok := _ListLoadingModeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("ListLoadingMode(%d)", x)
+}
+
+var _ListLoadingModeValue = map[string]ListLoadingMode{
+	_ListLoadingModeName[0:4]:   0,
+	_ListLoadingModeName[4:15]:  1,
+	_ListLoadingModeName[15:19]: 2,
+	_ListLoadingModeName[19:25]: 3,
+}
+
+// ParseListLoadingMode attempts to convert a string to a ListLoadingMode
+func ParseListLoadingMode(name string) (ListLoadingMode, error) {
+	if x, ok := _ListLoadingModeValue[name]; ok {
+		return x, nil
+	}
+	return ListLoadingMode(0), fmt.Errorf("%s is not a valid ListLoadingMode, try [%s]", name, strings.Join(_ListLoadingModeNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x ListLoadingMode) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *ListLoadingMode) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseListLoadingMode(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// MultipleQuestionsModeRefuse is a MultipleQuestionsMode of type Refuse.
+	// answer with FORMERR
+	MultipleQuestionsModeRefuse MultipleQuestionsMode = iota
+	// MultipleQuestionsModeFirst is a MultipleQuestionsMode of type First.
+	// resolve only the first question, the other questions are ignored
+	MultipleQuestionsModeFirst
+)
+
+const _MultipleQuestionsModeName = "refusefirst"
+
+var _MultipleQuestionsModeNames = []string{
+	_MultipleQuestionsModeName[0:6],
+	_MultipleQuestionsModeName[6:11],
+}
+
+// MultipleQuestionsModeNames returns a list of possible string values of MultipleQuestionsMode.
+func MultipleQuestionsModeNames() []string {
+	tmp := make([]string, len(_MultipleQuestionsModeNames))
+	copy(tmp, _MultipleQuestionsModeNames)
+	return tmp
+}
+
+var _MultipleQuestionsModeMap = map[MultipleQuestionsMode]string{
+	0: _MultipleQuestionsModeName[0:6],
+	1: _MultipleQuestionsModeName[6:11],
+}
+
+// String implements the Stringer interface.
+func (x MultipleQuestionsMode) String() string {
+	if str, ok := _MultipleQuestionsModeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("MultipleQuestionsMode(%d)", x)
+}
+
+var _MultipleQuestionsModeValue = map[string]MultipleQuestionsMode{
+	_MultipleQuestionsModeName[0:6]:  0,
+	_MultipleQuestionsModeName[6:11]: 1,
+}
+
+// ParseMultipleQuestionsMode attempts to convert a string to a MultipleQuestionsMode
+func ParseMultipleQuestionsMode(name string) (MultipleQuestionsMode, error) {
+	if x, ok := _MultipleQuestionsModeValue[name]; ok {
+		return x, nil
+	}
+	return MultipleQuestionsMode(0), fmt.Errorf("%s is not a valid MultipleQuestionsMode, try [%s]", name, strings.Join(_MultipleQuestionsModeNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x MultipleQuestionsMode) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *MultipleQuestionsMode) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseMultipleQuestionsMode(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
 const (
 	// NetProtocolUdp is a NetProtocol of type Udp.
 	// Deprecated: use tcp+udp instead
@@ -27,9 +459,12 @@ const (
 	// NetProtocolHttps is a NetProtocol of type Https.
 	// HTTPS protocol
 	NetProtocolHttps
+	// NetProtocolDnscrypt is a NetProtocol of type Dnscrypt.
+	// DNSCrypt protocol
+	NetProtocolDnscrypt
 )
 
-const _NetProtocolName = "udptcptcp+udptcp-tlshttps"
+const _NetProtocolName = "udptcptcp+udptcp-tlshttpsdnscrypt"
 
 var _NetProtocolNames = []string{
 	_NetProtocolName[0:3],
@@ -37,6 +472,7 @@ var _NetProtocolNames = []string{
 	_NetProtocolName[6:13],
 	_NetProtocolName[13:20],
 	_NetProtocolName[20:25],
+	_NetProtocolName[25:33],
 }
 
 // NetProtocolNames returns a list of possible string values of NetProtocol.
@@ -52,6 +488,7 @@ var _NetProtocolMap = map[NetProtocol]string{
 	2: _NetProtocolName[6:13],
 	3: _NetProtocolName[13:20],
 	4: _NetProtocolName[20:25],
+	5: _NetProtocolName[25:33],
 }
 
 // String implements the Stringer interface.
@@ -68,6 +505,7 @@ var _NetProtocolValue = map[string]NetProtocol{
 	_NetProtocolName[6:13]:  2,
 	_NetProtocolName[13:20]: 3,
 	_NetProtocolName[20:25]: 4,
+	_NetProtocolName[25:33]: 5,
 }
 
 // ParseNetProtocol attempts to convert a string to a NetProtocol
@@ -94,6 +532,326 @@ func (x *NetProtocol) UnmarshalText(text []byte) error {
 	return nil
 }
 
+const (
+	// NoAnswerResponseServfail is a NoAnswerResponse of type Servfail.
+	// answer with SERVFAIL
+	NoAnswerResponseServfail NoAnswerResponse = iota
+	// NoAnswerResponseNxdomain is a NoAnswerResponse of type Nxdomain.
+	// answer with NXDOMAIN
+	NoAnswerResponseNxdomain
+	// NoAnswerResponseRefused is a NoAnswerResponse of type Refused.
+	// answer with REFUSED
+	NoAnswerResponseRefused
+)
+
+const _NoAnswerResponseName = "servfailnxdomainrefused"
+
+var _NoAnswerResponseNames = []string{
+	_NoAnswerResponseName[0:8],
+	_NoAnswerResponseName[8:16],
+	_NoAnswerResponseName[16:23],
+}
+
+// NoAnswerResponseNames returns a list of possible string values of NoAnswerResponse.
+func NoAnswerResponseNames() []string {
+	tmp := make([]string, len(_NoAnswerResponseNames))
+	copy(tmp, _NoAnswerResponseNames)
+	return tmp
+}
+
+var _NoAnswerResponseMap = map[NoAnswerResponse]string{
+	0: _NoAnswerResponseName[0:8],
+	1: _NoAnswerResponseName[8:16],
+	2: _NoAnswerResponseName[16:23],
+}
+
+// String implements the Stringer interface.
+func (x NoAnswerResponse) String() string {
+	if str, ok := _NoAnswerResponseMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("NoAnswerResponse(%d)", x)
+}
+
+var _NoAnswerResponseValue = map[string]NoAnswerResponse{
+	_NoAnswerResponseName[0:8]:   0,
+	_NoAnswerResponseName[8:16]:  1,
+	_NoAnswerResponseName[16:23]: 2,
+}
+
+// ParseNoAnswerResponse attempts to convert a string to a NoAnswerResponse
+func ParseNoAnswerResponse(name string) (NoAnswerResponse, error) {
+	if x, ok := _NoAnswerResponseValue[name]; ok {
+		return x, nil
+	}
+	return NoAnswerResponse(0), fmt.Errorf("%s is not a valid NoAnswerResponse, try [%s]", name, strings.Join(_NoAnswerResponseNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x NoAnswerResponse) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *NoAnswerResponse) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseNoAnswerResponse(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// QueryLogFieldTime is a QueryLogField of type Time.
+	// timestamp of the request
+	QueryLogFieldTime QueryLogField = iota
+	// QueryLogFieldClientIP is a QueryLogField of type ClientIP.
+	// IP address of the client
+	QueryLogFieldClientIP
+	// QueryLogFieldClientName is a QueryLogField of type ClientName.
+	// name(s) of the client
+	QueryLogFieldClientName
+	// QueryLogFieldDuration is a QueryLogField of type Duration.
+	// request duration in ms
+	QueryLogFieldDuration
+	// QueryLogFieldReason is a QueryLogField of type Reason.
+	// reason of the response
+	QueryLogFieldReason
+	// QueryLogFieldQuestion is a QueryLogField of type Question.
+	// question of the request
+	QueryLogFieldQuestion
+	// QueryLogFieldAnswer is a QueryLogField of type Answer.
+	// answer of the response
+	QueryLogFieldAnswer
+	// QueryLogFieldResponseCode is a QueryLogField of type ResponseCode.
+	// DNS response code
+	QueryLogFieldResponseCode
+	// QueryLogFieldUpstreamResponseCode is a QueryLogField of type UpstreamResponseCode.
+	// raw response code of the upstream server
+	QueryLogFieldUpstreamResponseCode
+	// QueryLogFieldCached is a QueryLogField of type Cached.
+	// answer was served from the cache
+	QueryLogFieldCached
+	// QueryLogFieldStale is a QueryLogField of type Stale.
+	// answer was served from an expired cache entry
+	QueryLogFieldStale
+)
+
+const _QueryLogFieldName = "timeclientIPclientNamedurationreasonquestionanswerresponseCodeupstreamResponseCodecachedstale"
+
+var _QueryLogFieldNames = []string{
+	_QueryLogFieldName[0:4],
+	_QueryLogFieldName[4:12],
+	_QueryLogFieldName[12:22],
+	_QueryLogFieldName[22:30],
+	_QueryLogFieldName[30:36],
+	_QueryLogFieldName[36:44],
+	_QueryLogFieldName[44:50],
+	_QueryLogFieldName[50:62],
+	_QueryLogFieldName[62:82],
+	_QueryLogFieldName[82:88],
+	_QueryLogFieldName[88:93],
+}
+
+// QueryLogFieldNames returns a list of possible string values of QueryLogField.
+func QueryLogFieldNames() []string {
+	tmp := make([]string, len(_QueryLogFieldNames))
+	copy(tmp, _QueryLogFieldNames)
+	return tmp
+}
+
+var _QueryLogFieldMap = map[QueryLogField]string{
+	0:  _QueryLogFieldName[0:4],
+	1:  _QueryLogFieldName[4:12],
+	2:  _QueryLogFieldName[12:22],
+	3:  _QueryLogFieldName[22:30],
+	4:  _QueryLogFieldName[30:36],
+	5:  _QueryLogFieldName[36:44],
+	6:  _QueryLogFieldName[44:50],
+	7:  _QueryLogFieldName[50:62],
+	8:  _QueryLogFieldName[62:82],
+	9:  _QueryLogFieldName[82:88],
+	10: _QueryLogFieldName[88:93],
+}
+
+// String implements the Stringer interface.
+func (x QueryLogField) String() string {
+	if str, ok := _QueryLogFieldMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("QueryLogField(%d)", x)
+}
+
+var _QueryLogFieldValue = map[string]QueryLogField{
+	_QueryLogFieldName[0:4]:   0,
+	_QueryLogFieldName[4:12]:  1,
+	_QueryLogFieldName[12:22]: 2,
+	_QueryLogFieldName[22:30]: 3,
+	_QueryLogFieldName[30:36]: 4,
+	_QueryLogFieldName[36:44]: 5,
+	_QueryLogFieldName[44:50]: 6,
+	_QueryLogFieldName[50:62]: 7,
+	_QueryLogFieldName[62:82]: 8,
+	_QueryLogFieldName[82:88]: 9,
+	_QueryLogFieldName[88:93]: 10,
+}
+
+// ParseQueryLogField attempts to convert a string to a QueryLogField
+func ParseQueryLogField(name string) (QueryLogField, error) {
+	if x, ok := _QueryLogFieldValue[name]; ok {
+		return x, nil
+	}
+	return QueryLogField(0), fmt.Errorf("%s is not a valid QueryLogField, try [%s]", name, strings.Join(_QueryLogFieldNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x QueryLogField) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *QueryLogField) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseQueryLogField(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// QueryLogTimeFormatDefault is a QueryLogTimeFormat of type Default.
+	// 2006-01-02 15:04:05
+	QueryLogTimeFormatDefault QueryLogTimeFormat = iota
+	// QueryLogTimeFormatRfc3339 is a QueryLogTimeFormat of type Rfc3339.
+	// RFC3339 with time zone offset, e.g. 2006-01-02T15:04:05+01:00
+	QueryLogTimeFormatRfc3339
+)
+
+const _QueryLogTimeFormatName = "defaultrfc3339"
+
+var _QueryLogTimeFormatNames = []string{
+	_QueryLogTimeFormatName[0:7],
+	_QueryLogTimeFormatName[7:14],
+}
+
+// QueryLogTimeFormatNames returns a list of possible string values of QueryLogTimeFormat.
+func QueryLogTimeFormatNames() []string {
+	tmp := make([]string, len(_QueryLogTimeFormatNames))
+	copy(tmp, _QueryLogTimeFormatNames)
+	return tmp
+}
+
+var _QueryLogTimeFormatMap = map[QueryLogTimeFormat]string{
+	0: _QueryLogTimeFormatName[0:7],
+	1: _QueryLogTimeFormatName[7:14],
+}
+
+// String implements the Stringer interface.
+func (x QueryLogTimeFormat) String() string {
+	if str, ok := _QueryLogTimeFormatMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("QueryLogTimeFormat(%d)", x)
+}
+
+var _QueryLogTimeFormatValue = map[string]QueryLogTimeFormat{
+	_QueryLogTimeFormatName[0:7]:  0,
+	_QueryLogTimeFormatName[7:14]: 1,
+}
+
+// ParseQueryLogTimeFormat attempts to convert a string to a QueryLogTimeFormat
+func ParseQueryLogTimeFormat(name string) (QueryLogTimeFormat, error) {
+	if x, ok := _QueryLogTimeFormatValue[name]; ok {
+		return x, nil
+	}
+	return QueryLogTimeFormat(0), fmt.Errorf("%s is not a valid QueryLogTimeFormat, try [%s]", name, strings.Join(_QueryLogTimeFormatNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x QueryLogTimeFormat) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *QueryLogTimeFormat) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseQueryLogTimeFormat(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// QueryLogTimeZoneLocal is a QueryLogTimeZone of type Local.
+	// local time zone of the host
+	QueryLogTimeZoneLocal QueryLogTimeZone = iota
+	// QueryLogTimeZoneUtc is a QueryLogTimeZone of type Utc.
+	// UTC
+	QueryLogTimeZoneUtc
+)
+
+const _QueryLogTimeZoneName = "localutc"
+
+var _QueryLogTimeZoneNames = []string{
+	_QueryLogTimeZoneName[0:5],
+	_QueryLogTimeZoneName[5:8],
+}
+
+// QueryLogTimeZoneNames returns a list of possible string values of QueryLogTimeZone.
+func QueryLogTimeZoneNames() []string {
+	tmp := make([]string, len(_QueryLogTimeZoneNames))
+	copy(tmp, _QueryLogTimeZoneNames)
+	return tmp
+}
+
+var _QueryLogTimeZoneMap = map[QueryLogTimeZone]string{
+	0: _QueryLogTimeZoneName[0:5],
+	1: _QueryLogTimeZoneName[5:8],
+}
+
+// String implements the Stringer interface.
+func (x QueryLogTimeZone) String() string {
+	if str, ok := _QueryLogTimeZoneMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("QueryLogTimeZone(%d)", x)
+}
+
+var _QueryLogTimeZoneValue = map[string]QueryLogTimeZone{
+	_QueryLogTimeZoneName[0:5]: 0,
+	_QueryLogTimeZoneName[5:8]: 1,
+}
+
+// ParseQueryLogTimeZone attempts to convert a string to a QueryLogTimeZone
+func ParseQueryLogTimeZone(name string) (QueryLogTimeZone, error) {
+	if x, ok := _QueryLogTimeZoneValue[name]; ok {
+		return x, nil
+	}
+	return QueryLogTimeZone(0), fmt.Errorf("%s is not a valid QueryLogTimeZone, try [%s]", name, strings.Join(_QueryLogTimeZoneNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x QueryLogTimeZone) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *QueryLogTimeZone) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseQueryLogTimeZone(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
 const (
 	// QueryLogTypeConsole is a QueryLogType of type Console.
 	// use logger as fallback
@@ -113,9 +871,15 @@ const (
 	// QueryLogTypeCsvClient is a QueryLogType of type Csv-Client.
 	// CSV file per day and client
 	QueryLogTypeCsvClient
+	// QueryLogTypeDnstap is a QueryLogType of type Dnstap.
+	// DNSTAP frame stream over unix socket or TCP
+	QueryLogTypeDnstap
+	// QueryLogTypeKafka is a QueryLogType of type Kafka.
+	// Kafka topic
+	QueryLogTypeKafka
 )
 
-const _QueryLogTypeName = "consolenonemysqlpostgresqlcsvcsv-client"
+const _QueryLogTypeName = "consolenonemysqlpostgresqlcsvcsv-clientdnstapkafka"
 
 var _QueryLogTypeNames = []string{
 	_QueryLogTypeName[0:7],
@@ -124,6 +888,8 @@ var _QueryLogTypeNames = []string{
 	_QueryLogTypeName[16:26],
 	_QueryLogTypeName[26:29],
 	_QueryLogTypeName[29:39],
+	_QueryLogTypeName[39:45],
+	_QueryLogTypeName[45:50],
 }
 
 // QueryLogTypeNames returns a list of possible string values of QueryLogType.
@@ -140,6 +906,8 @@ var _QueryLogTypeMap = map[QueryLogType]string{
 	3: _QueryLogTypeName[16:26],
 	4: _QueryLogTypeName[26:29],
 	5: _QueryLogTypeName[29:39],
+	6: _QueryLogTypeName[39:45],
+	7: _QueryLogTypeName[45:50],
 }
 
 // String implements the Stringer interface.
@@ -157,6 +925,8 @@ var _QueryLogTypeValue = map[string]QueryLogType{
 	_QueryLogTypeName[16:26]: 3,
 	_QueryLogTypeName[26:29]: 4,
 	_QueryLogTypeName[29:39]: 5,
+	_QueryLogTypeName[39:45]: 6,
+	_QueryLogTypeName[45:50]: 7,
 }
 
 // ParseQueryLogType attempts to convert a string to a QueryLogType
@@ -182,3 +952,275 @@ func (x *QueryLogType) UnmarshalText(text []byte) error {
 	*x = tmp
 	return nil
 }
+
+const (
+	// QueryNameLimitResponseFormerr is a QueryNameLimitResponse of type Formerr.
+	// answer with FORMERR
+	QueryNameLimitResponseFormerr QueryNameLimitResponse = iota
+	// QueryNameLimitResponseRefused is a QueryNameLimitResponse of type Refused.
+	// answer with REFUSED
+	QueryNameLimitResponseRefused
+)
+
+const _QueryNameLimitResponseName = "formerrrefused"
+
+var _QueryNameLimitResponseNames = []string{
+	_QueryNameLimitResponseName[0:7],
+	_QueryNameLimitResponseName[7:14],
+}
+
+// QueryNameLimitResponseNames returns a list of possible string values of QueryNameLimitResponse.
+func QueryNameLimitResponseNames() []string {
+	tmp := make([]string, len(_QueryNameLimitResponseNames))
+	copy(tmp, _QueryNameLimitResponseNames)
+	return tmp
+}
+
+var _QueryNameLimitResponseMap = map[QueryNameLimitResponse]string{
+	0: _QueryNameLimitResponseName[0:7],
+	1: _QueryNameLimitResponseName[7:14],
+}
+
+// String implements the Stringer interface.
+func (x QueryNameLimitResponse) String() string {
+	if str, ok := _QueryNameLimitResponseMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("QueryNameLimitResponse(%d)", x)
+}
+
+var _QueryNameLimitResponseValue = map[string]QueryNameLimitResponse{
+	_QueryNameLimitResponseName[0:7]:  0,
+	_QueryNameLimitResponseName[7:14]: 1,
+}
+
+// ParseQueryNameLimitResponse attempts to convert a string to a QueryNameLimitResponse
+func ParseQueryNameLimitResponse(name string) (QueryNameLimitResponse, error) {
+	if x, ok := _QueryNameLimitResponseValue[name]; ok {
+		return x, nil
+	}
+	return QueryNameLimitResponse(0), fmt.Errorf("%s is not a valid QueryNameLimitResponse, try [%s]", name, strings.Join(_QueryNameLimitResponseNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x QueryNameLimitResponse) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *QueryNameLimitResponse) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseQueryNameLimitResponse(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// RootQueryModeForward is a RootQueryMode of type Forward.
+	// forward the query to the next resolver
+	RootQueryModeForward RootQueryMode = iota
+	// RootQueryModeRefuse is a RootQueryMode of type Refuse.
+	// return REFUSED
+	RootQueryModeRefuse
+	// RootQueryModeHint is a RootQueryMode of type Hint.
+	// answer with the configured static records
+	RootQueryModeHint
+)
+
+const _RootQueryModeName = "forwardrefusehint"
+
+var _RootQueryModeNames = []string{
+	_RootQueryModeName[0:7],
+	_RootQueryModeName[7:13],
+	_RootQueryModeName[13:17],
+}
+
+// RootQueryModeNames returns a list of possible string values of RootQueryMode.
+func RootQueryModeNames() []string {
+	tmp := make([]string, len(_RootQueryModeNames))
+	copy(tmp, _RootQueryModeNames)
+	return tmp
+}
+
+var _RootQueryModeMap = map[RootQueryMode]string{
+	0: _RootQueryModeName[0:7],
+	1: _RootQueryModeName[7:13],
+	2: _RootQueryModeName[13:17],
+}
+
+// String implements the Stringer interface.
+func (x RootQueryMode) String() string {
+	if str, ok := _RootQueryModeMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("RootQueryMode(%d)", x)
+}
+
+var _RootQueryModeValue = map[string]RootQueryMode{
+	_RootQueryModeName[0:7]:   0,
+	_RootQueryModeName[7:13]:  1,
+	_RootQueryModeName[13:17]: 2,
+}
+
+// ParseRootQueryMode attempts to convert a string to a RootQueryMode
+func ParseRootQueryMode(name string) (RootQueryMode, error) {
+	if x, ok := _RootQueryModeValue[name]; ok {
+		return x, nil
+	}
+	return RootQueryMode(0), fmt.Errorf("%s is not a valid RootQueryMode, try [%s]", name, strings.Join(_RootQueryModeNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x RootQueryMode) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *RootQueryMode) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseRootQueryMode(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// UpstreamAnswerOrderKeep is a UpstreamAnswerOrder of type Keep.
+	// keep the order of the upstream response
+	UpstreamAnswerOrderKeep UpstreamAnswerOrder = iota
+	// UpstreamAnswerOrderShuffle is a UpstreamAnswerOrder of type Shuffle.
+	// return the records in random order
+	UpstreamAnswerOrderShuffle
+	// UpstreamAnswerOrderSort is a UpstreamAnswerOrder of type Sort.
+	// sort the records by address
+	UpstreamAnswerOrderSort
+)
+
+const _UpstreamAnswerOrderName = "keepshufflesort"
+
+var _UpstreamAnswerOrderNames = []string{
+	_UpstreamAnswerOrderName[0:4],
+	_UpstreamAnswerOrderName[4:11],
+	_UpstreamAnswerOrderName[11:15],
+}
+
+// UpstreamAnswerOrderNames returns a list of possible string values of UpstreamAnswerOrder.
+func UpstreamAnswerOrderNames() []string {
+	tmp := make([]string, len(_UpstreamAnswerOrderNames))
+	copy(tmp, _UpstreamAnswerOrderNames)
+	return tmp
+}
+
+var _UpstreamAnswerOrderMap = map[UpstreamAnswerOrder]string{
+	0: _UpstreamAnswerOrderName[0:4],
+	1: _UpstreamAnswerOrderName[4:11],
+	2: _UpstreamAnswerOrderName[11:15],
+}
+
+// String implements the Stringer interface.
+func (x UpstreamAnswerOrder) String() string {
+	if str, ok := _UpstreamAnswerOrderMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("UpstreamAnswerOrder(%d)", x)
+}
+
+var _UpstreamAnswerOrderValue = map[string]UpstreamAnswerOrder{
+	_UpstreamAnswerOrderName[0:4]:   0,
+	_UpstreamAnswerOrderName[4:11]:  1,
+	_UpstreamAnswerOrderName[11:15]: 2,
+}
+
+// ParseUpstreamAnswerOrder attempts to convert a string to a UpstreamAnswerOrder
+func ParseUpstreamAnswerOrder(name string) (UpstreamAnswerOrder, error) {
+	if x, ok := _UpstreamAnswerOrderValue[name]; ok {
+		return x, nil
+	}
+	return UpstreamAnswerOrder(0), fmt.Errorf("%s is not a valid UpstreamAnswerOrder, try [%s]", name, strings.Join(_UpstreamAnswerOrderNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x UpstreamAnswerOrder) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *UpstreamAnswerOrder) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseUpstreamAnswerOrder(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
+
+const (
+	// UpstreamTruncatedResponseRetryTcp is a UpstreamTruncatedResponse of type RetryTcp.
+	// repeat the query via TCP to the same upstream
+	UpstreamTruncatedResponseRetryTcp UpstreamTruncatedResponse = iota
+	// UpstreamTruncatedResponseReturn is a UpstreamTruncatedResponse of type Return.
+	// return the truncated response, the client repeats the query via TCP
+	UpstreamTruncatedResponseReturn
+)
+
+const _UpstreamTruncatedResponseName = "retryTcpreturn"
+
+var _UpstreamTruncatedResponseNames = []string{
+	_UpstreamTruncatedResponseName[0:8],
+	_UpstreamTruncatedResponseName[8:14],
+}
+
+// UpstreamTruncatedResponseNames returns a list of possible string values of UpstreamTruncatedResponse.
+func UpstreamTruncatedResponseNames() []string {
+	tmp := make([]string, len(_UpstreamTruncatedResponseNames))
+	copy(tmp, _UpstreamTruncatedResponseNames)
+	return tmp
+}
+
+var _UpstreamTruncatedResponseMap = map[UpstreamTruncatedResponse]string{
+	0: _UpstreamTruncatedResponseName[0:8],
+	1: _UpstreamTruncatedResponseName[8:14],
+}
+
+// String implements the Stringer interface.
+func (x UpstreamTruncatedResponse) String() string {
+	if str, ok := _UpstreamTruncatedResponseMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("UpstreamTruncatedResponse(%d)", x)
+}
+
+var _UpstreamTruncatedResponseValue = map[string]UpstreamTruncatedResponse{
+	_UpstreamTruncatedResponseName[0:8]:  0,
+	_UpstreamTruncatedResponseName[8:14]: 1,
+}
+
+// ParseUpstreamTruncatedResponse attempts to convert a string to a UpstreamTruncatedResponse
+func ParseUpstreamTruncatedResponse(name string) (UpstreamTruncatedResponse, error) {
+	if x, ok := _UpstreamTruncatedResponseValue[name]; ok {
+		return x, nil
+	}
+	return UpstreamTruncatedResponse(0), fmt.Errorf("%s is not a valid UpstreamTruncatedResponse, try [%s]", name, strings.Join(_UpstreamTruncatedResponseNames, ", "))
+}
+
+// MarshalText implements the text marshaller method
+func (x UpstreamTruncatedResponse) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (x *UpstreamTruncatedResponse) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseUpstreamTruncatedResponse(name)
+	if err != nil {
+		return err
+	}
+	*x = tmp
+	return nil
+}
@@ -4,11 +4,13 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/0xERR0R/blocky/helpertest"
 
 	. "github.com/0xERR0R/blocky/log"
+	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -90,6 +92,389 @@ var _ = Describe("Config", func() {
 				})
 			})
 		})
+		When("CustomDNS has records defined", func() {
+			It("should parse the records", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  records:
+    - 'my.domain TXT "some text"'
+    - my.domain MX 10 mail.my.domain.
+    - _sip._tcp.my.domain SRV 10 60 5060 sip.my.domain.`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.CustomDNS.Records).Should(HaveLen(3))
+				Expect(config.CustomDNS.Records[0].Header().Name).Should(Equal("my.domain."))
+				Expect(config.CustomDNS.Records[0].(*dns.TXT).Txt).Should(Equal([]string{"some text"}))
+				Expect(config.CustomDNS.Records[1].(*dns.MX).Mx).Should(Equal("mail.my.domain."))
+				Expect(config.CustomDNS.Records[2].(*dns.SRV).Port).Should(BeEquivalentTo(5060))
+			})
+		})
+		When("CustomDNS has invalid record defined", func() {
+			It("should log with fatal and exit", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  records:
+    - my.domain MX wrong`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("CustomDNS has record with unsupported type defined", func() {
+			It("should log with fatal and exit", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  records:
+    - my.domain A 192.168.178.3`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("CustomDNS has reverse zones defined", func() {
+			It("should parse CIDRs and reverse zone names, most specific first", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  reverseZones:
+    10.0.0.0/8: "{ip}.lan"
+    1.168.192.in-addr.arpa: "host-{ip}.local"
+    8.b.d.0.1.0.0.2.ip6.arpa.: "host-{ip}.local"`
+				unmarshalConfig([]byte(data), cfg)
+
+				zones := config.CustomDNS.ReverseZones
+				Expect(zones).Should(HaveLen(3))
+				Expect(zones[0].Subnet.String()).Should(Equal("2001:db8::/32"))
+				Expect(zones[1].Subnet.String()).Should(Equal("192.168.1.0/24"))
+				Expect(zones[1].Template).Should(Equal("host-{ip}.local"))
+				Expect(zones[2].Subnet.String()).Should(Equal("10.0.0.0/8"))
+			})
+		})
+		When("CustomDNS has invalid reverse zone defined", func() {
+			It("should log with fatal and exit", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  reverseZones:
+    300.168.192.in-addr.arpa: "host-{ip}.local"`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("CustomDNS has reverse zone template without placeholder", func() {
+			It("should log with fatal and exit", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  reverseZones:
+    192.168.1.0/24: "host.local"`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("root hints are defined", func() {
+			It("should parse the records", func() {
+				cfg := Config{}
+				data :=
+					`rootQueries:
+  mode: hint
+  rateLimit: 10
+  hints:
+    - . 3600 IN NS a.root-servers.net.
+    - com. 3600 IN NS a.gtld-servers.net.`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.RootQueries.Mode).Should(Equal(RootQueryModeHint))
+				Expect(config.RootQueries.RateLimit).Should(BeEquivalentTo(10))
+				Expect(config.RootQueries.Hints).Should(HaveLen(2))
+				Expect(config.RootQueries.Hints[1].(*dns.NS).Ns).Should(Equal("a.gtld-servers.net."))
+			})
+		})
+		When("root hint for a domain below a TLD is defined", func() {
+			It("should log with fatal and exit", func() {
+				cfg := Config{}
+				data :=
+					`rootQueries:
+  hints:
+    - a.root-servers.net. 3600 IN A 198.41.0.4`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("Conditional client mapping is defined", func() {
+			It("should parse the mapping per client", func() {
+				cfg := Config{}
+				data :=
+					`conditional:
+  clientMapping:
+    vpn-*:
+      internal.corp: udp:10.8.0.1
+    10.8.0.0/24:
+      internal.corp: udp:10.8.0.1,udp:10.8.0.2`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.Conditional.ClientMapping).Should(HaveLen(2))
+				Expect(config.Conditional.ClientMapping["vpn-*"].Upstreams["internal.corp"]).Should(HaveLen(1))
+				Expect(config.Conditional.ClientMapping["vpn-*"].Upstreams["internal.corp"][0].Host).Should(Equal("10.8.0.1"))
+				Expect(config.Conditional.ClientMapping["10.8.0.0/24"].Upstreams["internal.corp"]).Should(HaveLen(2))
+			})
+		})
+		When("Custom DNS client mapping is defined", func() {
+			It("should parse the mapping per client", func() {
+				cfg := Config{}
+				data :=
+					`customDNS:
+  mapping:
+    service.lan: 192.168.178.10
+  clientMapping:
+    vpn-*:
+      service.lan: 10.8.0.10,2001:db8::10`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.CustomDNS.ClientMapping).Should(HaveLen(1))
+				Expect(config.CustomDNS.ClientMapping["vpn-*"].HostIPs["service.lan"]).Should(HaveLen(2))
+				Expect(config.CustomDNS.ClientMapping["vpn-*"].HostIPs["service.lan"][0].String()).Should(Equal("10.8.0.10"))
+			})
+		})
+		When("upstream points to a self address on the DNS port", func() {
+			It("should return an error", func() {
+				cfg := Config{
+					DNSPorts:      ListenConfig{"53"},
+					LoopDetection: LoopDetectionConfig{SelfAddresses: []string{"192.168.178.2", "blocky.lan"}},
+					Upstream: UpstreamConfig{ExternalResolvers: map[string][]Upstream{
+						"default": {{Net: NetProtocolTcpUdp, Host: "192.168.178.2", Port: 53}},
+					}},
+				}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("points to blocky itself")))
+			})
+			It("should return an error for conditional upstreams", func() {
+				cfg := Config{
+					DNSPorts:      ListenConfig{"192.168.178.2:5353"},
+					LoopDetection: LoopDetectionConfig{SelfAddresses: []string{"blocky.lan"}},
+					Conditional: ConditionalUpstreamConfig{Mapping: ConditionalUpstreamMapping{
+						Upstreams: map[string][]Upstream{
+							"lan": {{Net: NetProtocolTcpUdp, Host: "BLOCKY.lan", Port: 5353}},
+						},
+					}},
+				}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("points to blocky itself")))
+			})
+			It("should accept the self address on another port", func() {
+				cfg := Config{
+					DNSPorts:      ListenConfig{"53"},
+					LoopDetection: LoopDetectionConfig{SelfAddresses: []string{"192.168.178.2"}},
+					Upstream: UpstreamConfig{ExternalResolvers: map[string][]Upstream{
+						"default": {{Net: NetProtocolTcpUdp, Host: "192.168.178.2", Port: 5353}},
+					}},
+				}
+
+				Expect(checkConfig(&cfg)).Should(Succeed())
+			})
+		})
+		When("upstream source address is neither an IP address nor a network interface", func() {
+			It("should return an error", func() {
+				cfg := Config{UpstreamSourceAddress: "notexisting0"}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("neither a valid IP address nor a network")))
+			})
+		})
+		When("search domain is not a valid domain name", func() {
+			It("should return an error", func() {
+				cfg := Config{SearchDomains: []string{"home.arpa", "."}}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("not a valid domain name")))
+			})
+		})
+		When("jitter is greater than 50 percent", func() {
+			It("should return an error", func() {
+				cfg := Config{Blocking: BlockingConfig{RefreshJitter: 51}}
+				Expect(checkConfig(&cfg)).Should(MatchError("blocking.refreshJitter 51 is greater than 50 percent"))
+
+				cfg = Config{Caching: CachingConfig{PrefetchJitter: 100}}
+				Expect(checkConfig(&cfg)).Should(MatchError("caching.prefetchJitter 100 is greater than 50 percent"))
+
+				cfg = Config{Blocking: BlockingConfig{RefreshJitter: 50}, Caching: CachingConfig{PrefetchJitter: 50}}
+				Expect(checkConfig(&cfg)).Should(Succeed())
+			})
+		})
+		When("HTTPS block page is configured without certificate", func() {
+			It("should return an error", func() {
+				cfg := Config{Blocking: BlockingConfig{BlockPage: BlockPageConfig{HTTPSPort: ListenConfig{"8443"}}}}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("mandatory for the HTTPS block page")))
+				Expect(cfg.Blocking.BlockPage.IsEnabled()).Should(BeTrue())
+			})
+		})
+		When("upstream override client is not a valid IP or CIDR", func() {
+			It("should return an error", func() {
+				cfg := Config{UpstreamOverride: UpstreamOverrideConfig{Clients: []string{"10.0.0.0/8", "wrong"}}}
+
+				Expect(checkConfig(&cfg)).Should(MatchError(ContainSubstring("not a valid IP address or CIDR")))
+			})
+		})
+		When("allowed client is not a valid IP or CIDR", func() {
+			It("should return an error", func() {
+				cfg := Config{ClientACL: ClientACLConfig{AllowedClients: []string{"10.0.0.0/8", "wrong"}}}
+
+				Expect(checkConfig(&cfg)).Should(MatchError("allowed client 'wrong' is not a valid IP address or CIDR"))
+			})
+		})
+		When("secondary zone is invalid", func() {
+			It("should return an error", func() {
+				cfg := Config{SecondaryZones: []SecondaryZoneConfig{{Zone: ".", Primary: "192.168.178.1"}}}
+				Expect(checkConfig(&cfg)).Should(MatchError("secondary zone '.' is not a valid domain name"))
+
+				cfg = Config{SecondaryZones: []SecondaryZoneConfig{{Zone: "home.lan"}}}
+				Expect(checkConfig(&cfg)).Should(MatchError("secondary zone 'home.lan' has no primary"))
+			})
+		})
+		When("refresh windows are defined", func() {
+			It("should parse the windows per group", func() {
+				cfg := Config{}
+				data :=
+					`blocking:
+  refreshWindows:
+    big: 01:00-05:30
+    night: 22:00-02:00`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.Blocking.RefreshWindows).Should(Equal(map[string]RefreshWindow{
+					"big":   {Start: time.Hour, End: 5*time.Hour + 30*time.Minute},
+					"night": {Start: 22 * time.Hour, End: 2 * time.Hour},
+				}))
+				Expect(config.Blocking.RefreshWindows["big"].String()).Should(Equal("01:00-05:30"))
+			})
+			It("should log with fatal and exit if the window is invalid", func() {
+				cfg := Config{}
+				data :=
+					`blocking:
+  refreshWindows:
+    big: 01:00`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+			It("should return the delay until the window opens", func() {
+				day := func(hour, minute int) time.Time {
+					return time.Date(2022, 3, 1, hour, minute, 0, 0, time.Local)
+				}
+
+				window := RefreshWindow{Start: time.Hour, End: 5 * time.Hour}
+				Expect(window.Delay(day(2, 0))).Should(BeZero())
+				Expect(window.Delay(day(0, 30))).Should(Equal(30 * time.Minute))
+				Expect(window.Delay(day(5, 0))).Should(Equal(20 * time.Hour))
+
+				window = RefreshWindow{Start: 22 * time.Hour, End: 2 * time.Hour}
+				Expect(window.Delay(day(23, 0))).Should(BeZero())
+				Expect(window.Delay(day(1, 0))).Should(BeZero())
+				Expect(window.Delay(day(12, 0))).Should(Equal(10 * time.Hour))
+			})
+		})
+		When("client MAC addresses are defined", func() {
+			It("should parse the addresses", func() {
+				cfg := Config{}
+				data :=
+					`clientLookup:
+  macs:
+    laptop:
+      - AA:BB:CC:DD:EE:01
+      - aa-bb-cc-dd-ee-02`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.ClientLookup.ClientnameMACMapping).Should(Equal(map[string][]MACAddress{
+					"laptop": {{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}, {0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}},
+				}))
+				Expect(config.ClientLookup.ClientnameMACMapping["laptop"][0].String()).Should(Equal("aa:bb:cc:dd:ee:01"))
+			})
+			It("should log with fatal and exit if the address is invalid", func() {
+				cfg := Config{}
+				data :=
+					`clientLookup:
+  macs:
+    laptop:
+      - aa:bb:cc`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("query log max file size is defined", func() {
+			It("should parse the size with unit", func() {
+				cfg := Config{}
+				data :=
+					`queryLog:
+  maxFileSize: 100MB`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.QueryLog.MaxFileSize).Should(Equal(FileSize(100 * 1024 * 1024)))
+			})
+			It("should parse the size without unit as bytes", func() {
+				cfg := Config{}
+				data :=
+					`queryLog:
+  maxFileSize: 2048`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.QueryLog.MaxFileSize).Should(Equal(FileSize(2048)))
+			})
+			It("should log with fatal and exit if the size is invalid", func() {
+				cfg := Config{}
+				data :=
+					`queryLog:
+  maxFileSize: 10XB`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("upstream query types are defined", func() {
+			It("should parse the query types per upstream", func() {
+				cfg := Config{}
+				data :=
+					`upstreamQueryTypes:
+  tcp-tls:dnssec.example.com: [TXT, ds]`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.UpstreamQueryTypes).Should(Equal(map[Upstream]QueryTypes{
+					{Net: NetProtocolTcpTls, Host: "dnssec.example.com", Port: 853}: {dns.TypeTXT, dns.TypeDS},
+				}))
+			})
+			It("should log with fatal and exit if the query type is unknown", func() {
+				cfg := Config{}
+				data :=
+					`upstreamQueryTypes:
+  1.1.1.1: [TXT, WRONG]`
+				helpertest.ShouldLogFatal(func() {
+					unmarshalConfig([]byte(data), cfg)
+				})
+			})
+		})
+		When("upstream rate limits are defined", func() {
+			It("should parse the limits per upstream", func() {
+				cfg := Config{}
+				data :=
+					`upstreamRateLimits:
+  1.1.1.1:
+    qps: 20
+    burst: 40
+    maxWait: 50ms`
+				unmarshalConfig([]byte(data), cfg)
+
+				Expect(config.UpstreamRateLimits).Should(Equal(map[Upstream]UpstreamRateLimitConfig{
+					{Net: NetProtocolTcpUdp, Host: "1.1.1.1", Port: 53}: {
+						QPS: 20, Burst: 40, MaxWait: Duration(50 * time.Millisecond),
+					},
+				}))
+			})
+		})
 		When("Conditional mapping hast wrong defined upstreams", func() {
 			It("should log with fatal and exit", func() {
 				cfg := Config{}
@@ -353,5 +738,58 @@ var _ = Describe("Config", func() {
 			"[2620:fe::9]:55",
 			Upstream{Net: NetProtocolTcpUdp, Host: "2620:fe::9", Port: 55},
 			false),
+		Entry("DNS stamp plain",
+			"sdns://AAEAAAAAAAAABzkuOS45Ljk",
+			Upstream{Net: NetProtocolTcpUdp, Host: "9.9.9.9", Port: 53},
+			false),
+		Entry("DNS stamp plain IPv6 with port",
+			"sdns://AAEAAAAAAAAAElsyNjIwOmZlOjpmZV06NTM1Mw",
+			Upstream{Net: NetProtocolTcpUdp, Host: "2620:fe::fe", Port: 5353},
+			false),
+		Entry("DNS stamp DoH",
+			"sdns://AgEAAAAAAAAABzguOC44LjggEREREREREREREREREREREREREREREREREREREREREREKZG5zLmdvb2dsZQovZG5zLXF1ZXJ5",
+			Upstream{Net: NetProtocolHttps, Host: "dns.google", Port: 443, Path: "/dns-query"},
+			false),
+		Entry("DNS stamp DoH with port in address and bootstrap IPs",
+			"sdns://AgEAAAAAAAAABTo4NDQzAA9kb2guZXhhbXBsZS5jb20CL3GHMS4yLjMuNAc1LjYuNy44",
+			Upstream{Net: NetProtocolHttps, Host: "doh.example.com", Port: 8443, Path: "/q"},
+			false),
+		Entry("DNS stamp DoT with port in host name",
+			"sdns://AwEAAAAAAAAAAAASZG5zLnF1YWQ5Lm5ldDo4ODUz",
+			Upstream{Net: NetProtocolTcpTls, Host: "dns.quad9.net", Port: 8853},
+			false),
+		Entry("DNS stamp DNSCrypt",
+			"sdns://AQEAAAAAAAAABzEuMS4xLjEgIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIbMi5kbnNjcnlwdC1jZXJ0LmV4YW1wbGUuY29t",
+			Upstream{
+				Net: NetProtocolDnscrypt, Host: "1.1.1.1", Port: 443,
+				PublicKey:    strings.Repeat("22", 32),
+				ProviderName: "2.dnscrypt-cert.example.com",
+			},
+			false),
+		Entry("DNS stamp DNSCrypt with invalid public key",
+			"sdns://AQEAAAAAAAAABzEuMS4xLjECIiIbMi5kbnNjcnlwdC1jZXJ0LmV4YW1wbGUuY29t",
+			nil,
+			true),
+		Entry("DNS stamp with unsupported protocol",
+			"sdns://BQEAAAAAAAAAAA",
+			nil,
+			true),
+		Entry("DNS stamp truncated",
+			"sdns://AgEAAAAAAAAABzguOC44Ljg",
+			nil,
+			true),
+		Entry("DNS stamp with invalid encoding",
+			"sdns://!!!",
+			nil,
+			true),
 	)
+
+	It("should parse the public key and provider name of DNSCrypt stamps", func() {
+		stamp, err := parseDNSStamp(
+			"sdns://AQEAAAAAAAAABzEuMS4xLjEgIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIbMi5kbnNjcnlwdC1jZXJ0LmV4YW1wbGUuY29t")
+		Expect(err).Should(Succeed())
+		Expect(stamp.address).Should(Equal("1.1.1.1"))
+		Expect(stamp.publicKey).Should(HaveLen(32))
+		Expect(stamp.providerName).Should(Equal("2.dnscrypt-cert.example.com"))
+	})
 })
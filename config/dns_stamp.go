@@ -0,0 +1,207 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	dnsStampPrefix   = "sdns://"
+	stampPropsLength = 8
+)
+
+// protocol identifiers of DNS stamps (https://dnscrypt.info/stamps-specifications)
+const (
+	stampProtocolPlain    = 0x00
+	stampProtocolDNSCrypt = 0x01
+	stampProtocolDoH      = 0x02
+	stampProtocolDoT      = 0x03
+)
+
+// dnsStamp contains the parsed content of a DNS stamp
+type dnsStamp struct {
+	protocol     byte
+	address      string
+	publicKey    []byte
+	providerName string
+	hostname     string
+	path         string
+}
+
+// parseDNSStamp decodes the stamp in format sdns://<base64url>
+func parseDNSStamp(stamp string) (dnsStamp, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimPrefix(stamp, dnsStampPrefix), "="))
+	if err != nil {
+		return dnsStamp{}, fmt.Errorf("can't decode DNS stamp: %w", err)
+	}
+
+	r := &stampReader{data: data}
+	result := dnsStamp{protocol: r.byte()}
+
+	// the properties (DNSSEC, no logs, no filter) are only informational
+	r.take(stampPropsLength)
+
+	result.address = r.lp()
+
+	switch result.protocol {
+	case stampProtocolPlain:
+	case stampProtocolDNSCrypt:
+		result.publicKey = []byte(r.lp())
+		result.providerName = r.lp()
+	case stampProtocolDoH, stampProtocolDoT:
+		// certificate hashes are not used, the certificate is verified with the system CAs
+		r.vlp()
+		result.hostname = r.lp()
+
+		if result.protocol == stampProtocolDoH {
+			result.path = r.lp()
+		}
+
+		// optional bootstrap IPs are ignored, blocky uses the bootstrap DNS server
+		if !r.done() {
+			r.vlp()
+		}
+	default:
+		return dnsStamp{}, fmt.Errorf("unsupported DNS stamp protocol 0x%02x", result.protocol)
+	}
+
+	if r.err != nil {
+		return dnsStamp{}, fmt.Errorf("invalid DNS stamp: %w", r.err)
+	}
+
+	if !r.done() {
+		return dnsStamp{}, errors.New("invalid DNS stamp: unexpected trailing data")
+	}
+
+	return result, nil
+}
+
+// upstream converts the stamp to an upstream definition
+func (s dnsStamp) upstream() (Upstream, error) {
+	var (
+		result Upstream
+		err    error
+	)
+
+	switch s.protocol {
+	case stampProtocolPlain:
+		result.Net = NetProtocolTcpUdp
+		result.Host, result.Port, err = stampHostPort(s.address, "", netDefaultPort[NetProtocolTcpUdp])
+	case stampProtocolDoT:
+		result.Net = NetProtocolTcpTls
+		result.Host, result.Port, err = stampHostPort(s.hostname, s.address, netDefaultPort[NetProtocolTcpTls])
+	case stampProtocolDoH:
+		result.Net = NetProtocolHttps
+		result.Path = s.path
+		result.Host, result.Port, err = stampHostPort(s.hostname, s.address, netDefaultPort[NetProtocolHttps])
+	case stampProtocolDNSCrypt:
+		if len(s.publicKey) != ed25519.PublicKeySize {
+			return Upstream{}, fmt.Errorf("DNSCrypt public key must have %d bytes", ed25519.PublicKeySize)
+		}
+
+		if s.providerName == "" {
+			return Upstream{}, errors.New("DNSCrypt provider name is missing")
+		}
+
+		result.Net = NetProtocolDnscrypt
+		result.PublicKey = hex.EncodeToString(s.publicKey)
+		result.ProviderName = s.providerName
+		result.Host, result.Port, err = stampHostPort(s.address, "", netDefaultPort[NetProtocolDnscrypt])
+	}
+
+	if err != nil {
+		return Upstream{}, err
+	}
+
+	if net.ParseIP(result.Host) == nil && !validDomain.MatchString(result.Host) {
+		return Upstream{}, fmt.Errorf("wrong host name '%s'", result.Host)
+	}
+
+	return result, nil
+}
+
+// stampHostPort returns host and port of the server. Without port in the host name, the port of the
+// address (e.g. ":8443") or the default port is used
+func stampHostPort(hostname, address string, defaultPort uint16) (string, uint16, error) {
+	if hostname == "" {
+		hostname, address = address, ""
+	}
+
+	host, portString, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]")
+
+		if _, portString, err = net.SplitHostPort(address); err != nil {
+			return host, defaultPort, nil
+		}
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("can't convert port to number (1 - 65535) %w", err)
+	}
+
+	return host, uint16(port), nil
+}
+
+// stampReader reads the length-prefixed values of a stamp, the first error is kept
+type stampReader struct {
+	data []byte
+	err  error
+}
+
+func (r *stampReader) done() bool {
+	return len(r.data) == 0
+}
+
+func (r *stampReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if len(r.data) < n {
+		r.err = errors.New("unexpected end of data")
+
+		return nil
+	}
+
+	result := r.data[:n]
+	r.data = r.data[n:]
+
+	return result
+}
+
+func (r *stampReader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+// lp reads a value with one byte length prefix
+func (r *stampReader) lp() string {
+	return string(r.take(int(r.byte())))
+}
+
+// vlp reads a set of values, the high bit of the length prefix marks if more values follow
+func (r *stampReader) vlp() (result []string) {
+	const more = 0x80
+
+	for r.err == nil {
+		length := r.byte()
+		result = append(result, string(r.take(int(length&^more))))
+
+		if length&more == 0 {
+			break
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/0xERR0R/blocky/log"
+	"github.com/creasty/defaults"
+)
+
+const (
+	remoteConfigTimeout = 30 * time.Second
+
+	remoteConfigCacheFilePermissions = 0o600
+)
+
+// IsRemoteConfig returns true if the config path is a HTTP(S) URL
+func IsRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// RemoteConfigLoader loads the configuration from a HTTP(S) URL. The last valid configuration is stored
+// in the optional cache file, which is used as fallback if the URL is not reachable
+type RemoteConfigLoader struct {
+	url       string
+	cacheFile string
+	client    *http.Client
+	loaded    []byte
+}
+
+// NewRemoteConfigLoader creates a new loader for the URL, cacheFile can be empty
+func NewRemoteConfigLoader(url, cacheFile string) *RemoteConfigLoader {
+	return &RemoteConfigLoader{
+		url:       url,
+		cacheFile: cacheFile,
+		client:    &http.Client{Timeout: remoteConfigTimeout},
+	}
+}
+
+// Load fetches and applies the configuration. Without valid configuration, blocky exits if the config is
+// mandatory, otherwise the default values are used
+func (l *RemoteConfigLoader) Load(mandatory bool) {
+	cfg := Config{}
+	if err := defaults.Set(&cfg); err != nil {
+		log.Log().Fatal("Can't apply default values: ", err)
+	}
+
+	data, err := l.fetchValid(cfg)
+	if err != nil {
+		log.Log().Warnf("can't load remote config from %s: %v", l.url, err)
+
+		data, err = l.readCache(cfg)
+		if err != nil {
+			if !mandatory {
+				config = &cfg
+
+				return
+			}
+
+			log.Log().Fatal("Can't load remote config and no valid cached config available: ", err)
+		}
+
+		log.Log().Warnf("using cached config from %s", l.cacheFile)
+	}
+
+	l.loaded = data
+
+	unmarshalConfig(data, cfg)
+}
+
+// Watch polls the URL in the interval and calls onChange once, if a changed and valid configuration is found.
+// The new configuration is stored in the cache file, but not applied
+func (l *RemoteConfigLoader) Watch(interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			<-ticker.C
+
+			if l.checkForChange() {
+				onChange()
+
+				return
+			}
+		}
+	}()
+}
+
+func (l *RemoteConfigLoader) checkForChange() bool {
+	cfg := Config{}
+	if err := defaults.Set(&cfg); err != nil {
+		log.Log().Error("Can't apply default values: ", err)
+
+		return false
+	}
+
+	data, err := l.fetchValid(cfg)
+	if err != nil {
+		log.Log().Warnf("can't check remote config from %s: %v", l.url, err)
+
+		return false
+	}
+
+	if bytes.Equal(data, l.loaded) {
+		return false
+	}
+
+	log.Log().Infof("remote config from %s has changed", l.url)
+
+	return true
+}
+
+// fetchValid downloads the configuration and validates it. A valid configuration is stored in the cache file
+func (l *RemoteConfigLoader) fetchValid(cfg Config) ([]byte, error) {
+	data, err := l.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := parseConfig(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if l.cacheFile != "" {
+		if err := os.WriteFile(l.cacheFile, data, remoteConfigCacheFilePermissions); err != nil {
+			log.Log().Warnf("can't write config cache file %s: %v", l.cacheFile, err)
+		}
+	}
+
+	return data, nil
+}
+
+func (l *RemoteConfigLoader) fetch() ([]byte, error) {
+	resp, err := l.client.Get(l.url)
+	if err != nil {
+		return nil, fmt.Errorf("can't download config: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't download config, got status code %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config: %w", err)
+	}
+
+	return data, nil
+}
+
+func (l *RemoteConfigLoader) readCache(cfg Config) ([]byte, error) {
+	if l.cacheFile == "" {
+		return nil, errors.New("no cache file configured")
+	}
+
+	data, err := os.ReadFile(l.cacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read cache file: %w", err)
+	}
+
+	if _, err := parseConfig(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid cached config: %w", err)
+	}
+
+	return data, nil
+}
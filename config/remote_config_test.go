@@ -0,0 +1,170 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/helpertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Remote config", func() {
+	var (
+		server    *httptest.Server
+		lock      sync.Mutex
+		body      string
+		status    int
+		cacheFile string
+	)
+
+	setResponse := func(s int, b string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		status, body = s, b
+	}
+
+	BeforeEach(func() {
+		setResponse(http.StatusOK, "upstream:\n  default:\n    - 8.8.8.8\nlogLevel: debug\n")
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		}))
+		DeferCleanup(server.Close)
+
+		dir, err := os.MkdirTemp("", "blocky")
+		Expect(err).Should(Succeed())
+		DeferCleanup(os.RemoveAll, dir)
+
+		cacheFile = filepath.Join(dir, "config-cache.yml")
+	})
+
+	Describe("URL detection", func() {
+		It("should detect HTTP(S) URLs", func() {
+			Expect(IsRemoteConfig("http://example.com/config.yml")).Should(BeTrue())
+			Expect(IsRemoteConfig("https://example.com/config.yml")).Should(BeTrue())
+			Expect(IsRemoteConfig("./config.yml")).Should(BeFalse())
+		})
+	})
+
+	Describe("Loading", func() {
+		When("URL returns a valid config", func() {
+			It("should apply it and store it in the cache file", func() {
+				NewRemoteConfigLoader(server.URL, cacheFile).Load(true)
+
+				Expect(config.Upstream.ExternalResolvers["default"][0].Host).Should(Equal("8.8.8.8"))
+				Expect(config.LogLevel.String()).Should(Equal("debug"))
+				// default values are applied
+				Expect(config.UpstreamTimeout).Should(Equal(Duration(2 * time.Second)))
+
+				data, err := os.ReadFile(cacheFile)
+				Expect(err).Should(Succeed())
+				Expect(string(data)).Should(ContainSubstring("8.8.8.8"))
+			})
+		})
+		When("URL is not reachable", func() {
+			It("should use the cached config", func() {
+				Expect(os.WriteFile(cacheFile, []byte("upstream:\n  default:\n    - 1.1.1.1\n"), 0o600)).Should(Succeed())
+				setResponse(http.StatusInternalServerError, "")
+
+				NewRemoteConfigLoader(server.URL, cacheFile).Load(true)
+
+				Expect(config.Upstream.ExternalResolvers["default"][0].Host).Should(Equal("1.1.1.1"))
+			})
+			It("should log with fatal and exit if no cached config exists", func() {
+				setResponse(http.StatusNotFound, "")
+
+				helpertest.ShouldLogFatal(func() {
+					NewRemoteConfigLoader(server.URL, cacheFile).Load(true)
+				})
+			})
+			It("should use default config if config is not mandatory", func() {
+				setResponse(http.StatusNotFound, "")
+
+				NewRemoteConfigLoader(server.URL, "").Load(false)
+
+				Expect(config.Upstream.ExternalResolvers).Should(BeEmpty())
+				Expect(config.UpstreamTimeout).Should(Equal(Duration(2 * time.Second)))
+			})
+		})
+		When("URL returns an invalid config", func() {
+			It("should not apply or cache it and use the cached config", func() {
+				Expect(os.WriteFile(cacheFile, []byte("upstream:\n  default:\n    - 1.1.1.1\n"), 0o600)).Should(Succeed())
+				setResponse(http.StatusOK, "unknownKey: 1\n")
+
+				NewRemoteConfigLoader(server.URL, cacheFile).Load(true)
+
+				Expect(config.Upstream.ExternalResolvers["default"][0].Host).Should(Equal("1.1.1.1"))
+
+				data, err := os.ReadFile(cacheFile)
+				Expect(err).Should(Succeed())
+				Expect(string(data)).ShouldNot(ContainSubstring("unknownKey"))
+			})
+		})
+	})
+
+	Describe("Watching for changes", func() {
+		var sut *RemoteConfigLoader
+
+		BeforeEach(func() {
+			sut = NewRemoteConfigLoader(server.URL, cacheFile)
+			sut.Load(true)
+		})
+
+		When("config is unchanged", func() {
+			It("should not report a change", func() {
+				Expect(sut.checkForChange()).Should(BeFalse())
+			})
+		})
+		When("changed config is invalid", func() {
+			It("should not report a change", func() {
+				setResponse(http.StatusOK, "unknownKey: 1\n")
+
+				Expect(sut.checkForChange()).Should(BeFalse())
+			})
+		})
+		When("config is changed", func() {
+			It("should call the callback once", func() {
+				setResponse(http.StatusOK, "upstream:\n  default:\n    - 9.9.9.9\n")
+
+				var (
+					cbLock sync.Mutex
+					calls  int
+				)
+
+				sut.Watch(10*time.Millisecond, func() {
+					cbLock.Lock()
+					defer cbLock.Unlock()
+
+					calls++
+				})
+
+				Eventually(func() int {
+					cbLock.Lock()
+					defer cbLock.Unlock()
+
+					return calls
+				}, "1s").Should(Equal(1))
+				Consistently(func() int {
+					cbLock.Lock()
+					defer cbLock.Unlock()
+
+					return calls
+				}, "100ms").Should(Equal(1))
+
+				data, err := os.ReadFile(cacheFile)
+				Expect(err).Should(Succeed())
+				Expect(string(data)).Should(ContainSubstring("9.9.9.9"))
+			})
+		})
+	})
+})
@@ -8,9 +8,28 @@ const (
 	// BlockingEnabledEvent fires if blocking status will be changed. Parameter: boolean (enabled = true)
 	BlockingEnabledEvent = "blocking:enabled"
 
+	// BlockingStatusChanged fires if blocking status of groups will be changed.
+	// Parameter: all groups, disabled groups, time of automatic enabling (zero if not set)
+	BlockingStatusChanged = "blocking:statusChanged"
+
 	// BlockingCacheGroupChanged fires, if a list group is changed. Parameter: list type, group name, element count
 	BlockingCacheGroupChanged = "blocking:cachingGroupChanged"
 
+	// BlockingCacheGroupMemoryChanged fires, if a list group is changed.
+	// Parameter: list type, group name, estimated memory usage in bytes
+	BlockingCacheGroupMemoryChanged = "blocking:cachingGroupMemoryChanged"
+
+	// BlockingCacheGroupRefreshFailed fires, if a list group can't be refreshed.
+	// Parameter: list type, group name, error
+	BlockingCacheGroupRefreshFailed = "blocking:cachingGroupRefreshFailed"
+
+	// BlockingListSourceHit fires, if a list source matches and hit counting is enabled.
+	// Parameter: list type, group name, source name
+	BlockingListSourceHit = "blocking:listSourceHit"
+
+	// BlockingDryRunMatch fires, if a request would be blocked by a group in dry run mode. Parameter: group name
+	BlockingDryRunMatch = "blocking:dryRunMatch"
+
 	// CachingDomainPrefetched fires if a domain will be prefetched, Parameter: domain name
 	CachingDomainPrefetched = "caching:prefetched"
 
@@ -20,18 +39,76 @@ const (
 	// CachingPrefetchCacheHit fires if a query result was found in the prefetch cache, Parameter: domain name
 	CachingPrefetchCacheHit = "caching:prefetchHit"
 
+	// CachingPrefetchedEntryExpired fires if a prefetched query result expires,
+	// Parameter: domain name, true if the result was returned from cache before
+	CachingPrefetchedEntryExpired = "caching:prefetchedEntryExpired"
+
 	// CachingResultCacheHit fires, if a query result was found in the cache, Parameter: domain name
 	CachingResultCacheHit = "caching:cacheHit"
 
 	// CachingResultCacheMiss fires, if a query result was not found in the cache, Parameter: domain name
 	CachingResultCacheMiss = "caching:cacheMiss"
 
+	// CachingStaleAnswerServed fires, if an expired answer was served because the upstream failed, Parameter: domain name
+	CachingStaleAnswerServed = "caching:staleAnswerServed"
+
 	// CachingDomainsToPrefetchCountChanged fires, if a number of domains being prefetched changed, Parameter: new count
 	CachingDomainsToPrefetchCountChanged = "caching:domainsToPrefetchCountChanged"
 
 	// CachingFailedDownloadChanged fires, if a download of a blocking list fails
 	CachingFailedDownloadChanged = "caching:failedDownload"
 
+	// UpstreamLimitQueued fires if a request waits for a free slot of the upstream concurrency limit
+	UpstreamLimitQueued = "upstreamLimit:queued"
+
+	// UpstreamLimitRejected fires if a request is rejected, because the upstream concurrency limit is reached
+	UpstreamLimitRejected = "upstreamLimit:rejected"
+
+	// UpstreamRateLimitQueued fires if a query waits, because the rate limit of the upstream is reached.
+	// Parameter: upstream
+	UpstreamRateLimitQueued = "upstreamRateLimit:queued"
+
+	// UpstreamRateLimitRejected fires if a query isn't sent, because the rate limit of the upstream is reached.
+	// Parameter: upstream
+	UpstreamRateLimitRejected = "upstreamRateLimit:rejected"
+
+	// UpstreamInFlightRejected fires if a query isn't sent, because the max concurrent queries to the upstream are
+	// in flight. Parameter: upstream
+	UpstreamInFlightRejected = "upstream:inFlightRejected"
+
+	// ServerConnectionsChanged fires if the number of open connections of an encrypted DNS server changed.
+	// Parameter: server (tls, https), open connections
+	ServerConnectionsChanged = "server:connectionsChanged"
+
+	// ServerConnectionRejected fires if a connection is closed, because the connection limit is reached.
+	// Parameter: server (tls, https)
+	ServerConnectionRejected = "server:connectionRejected"
+
+	// ClientACLRejected fires if a query is refused, because the client is not allowed. Parameter: client IP
+	ClientACLRejected = "clientACL:rejected"
+
+	// ResolverPanicRecovered fires if a panic of a resolver is recovered. Parameter: resolver name
+	ResolverPanicRecovered = "resolver:panicRecovered"
+
+	// QueryNameLimitExceeded fires if a query is rejected, because the question name exceeds a limit.
+	// Parameter: limit (length, labels)
+	QueryNameLimitExceeded = "queryNameLimits:exceeded"
+
+	// DNSCryptHandshakeFinished fires after each certificate fetch of a DNSCrypt upstream.
+	// Parameter: upstream, success
+	DNSCryptHandshakeFinished = "upstream:dnscryptHandshakeFinished"
+
+	// QueryLogDatabaseConnectionChanged fires if the query log database becomes (un)available.
+	// Parameter: boolean (connected = true)
+	QueryLogDatabaseConnectionChanged = "queryLog:databaseConnectionChanged"
+
+	// QueryLogEntriesDropped fires if query log entries are dropped, because the target is not available.
+	// Parameter: writer (e.g. database), amount of dropped entries
+	QueryLogEntriesDropped = "queryLog:entriesDropped"
+
+	// HealthProbeFinished fires after each synthetic health probe query. Parameter: success, duration
+	HealthProbeFinished = "health:probeFinished"
+
 	// ApplicationStarted fires on start of the application. Parameter: version number, build time
 	ApplicationStarted = "application:started"
 )
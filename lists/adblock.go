@@ -0,0 +1,98 @@
+package lists
+
+import (
+	"regexp"
+	"strings"
+)
+
+// options of Adblock Plus rules, which don't restrict the rule to a content type or context. Rules with other
+// options (e.g. $third-party, $script) block only a part of the requests of a browser, they are skipped
+var adblockDomainOptions = map[string]bool{
+	"important": true,
+	"all":       true,
+	"document":  true,
+	"doc":       true,
+}
+
+// markers of cosmetic (element hiding and scriptlet) rules, e.g. "example.com##.banner"
+var adblockCosmeticMarkers = []string{"##", "#@#", "#?#", "#$#", "#%#"}
+
+// isAdblockLine returns true for Adblock Plus rules, comments and headers
+func isAdblockLine(line string) bool {
+	return strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@") ||
+		strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[Adblock")
+}
+
+// parseAdblockLine adds the domain of a blocking rule (||domain^) to the entries and of an exception rule
+// (@@||domain^) to the exceptions of the result, other lines are skipped
+func parseAdblockLine(line string, result *groupCache) {
+	domain, exception, ok := parseAdblockRule(line)
+	if !ok {
+		return
+	}
+
+	entry := adblockDomainRegex(domain)
+
+	if exception {
+		result.exceptions = append(result.exceptions, entry)
+	} else {
+		result.cache = append(result.cache, entry)
+	}
+}
+
+// adblockDomainRegex returns the regex entry (/regex/) of a rule domain, the rule applies to the domain and all its
+// subdomains
+func adblockDomainRegex(domain string) string {
+	return "/(^|\\.)" + regexp.QuoteMeta(domain) + "$/"
+}
+
+// parseAdblockRule returns the domain of a blocking or exception rule. Comments, cosmetic rules and rules, which
+// don't apply to the whole domain (paths, wildcards, restricting options), return false
+func parseAdblockRule(line string) (domain string, exception, ok bool) {
+	for _, marker := range adblockCosmeticMarkers {
+		if strings.Contains(line, marker) {
+			return "", false, false
+		}
+	}
+
+	if strings.HasPrefix(line, "@@") {
+		exception = true
+		line = line[2:]
+	}
+
+	if !strings.HasPrefix(line, "||") {
+		return "", false, false
+	}
+
+	rule := line[2:]
+
+	if idx := strings.IndexByte(rule, '$'); idx >= 0 {
+		if !isAdblockDomainOptions(rule[idx+1:]) {
+			return "", false, false
+		}
+
+		rule = rule[:idx]
+	}
+
+	rule = strings.TrimSuffix(rule, "|")
+	if !strings.HasSuffix(rule, "^") {
+		return "", false, false
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(rule, "^"))
+	if domain == "" || strings.ContainsAny(domain, "*/:^|") {
+		return "", false, false
+	}
+
+	return domain, exception, true
+}
+
+func isAdblockDomainOptions(options string) bool {
+	for _, option := range strings.Split(options, ",") {
+		if !adblockDomainOptions[strings.ToLower(strings.TrimSpace(option))] {
+			return false
+		}
+	}
+
+	return true
+}
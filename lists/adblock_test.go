@@ -0,0 +1,90 @@
+package lists
+
+import (
+	"github.com/0xERR0R/blocky/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Adblock Plus parser", func() {
+	DescribeTable("rules",
+		func(line, domain string, exception, ok bool) {
+			d, e, o := parseAdblockRule(line)
+			Expect(o).Should(Equal(ok))
+			Expect(d).Should(Equal(domain))
+			Expect(e).Should(Equal(exception))
+		},
+		Entry("blocking rule", "||Ads.example.com^", "ads.example.com", false, true),
+		Entry("blocking rule with separator", "||ads.example.com^|", "ads.example.com", false, true),
+		Entry("exception rule", "@@||allowed.example.com^", "allowed.example.com", true, true),
+		Entry("rule with domain options", "||ads.example.com^$important,document", "ads.example.com", false, true),
+		Entry("rule with restricting option", "||ads.example.com^$third-party", "", false, false),
+		Entry("rule with path", "||ads.example.com/banner.js", "", false, false),
+		Entry("rule with wildcard", "||*.ads.example.com^", "", false, false),
+		Entry("rule without separator", "||ads.example.com", "", false, false),
+		Entry("element hiding rule", "example.com##.banner", "", false, false),
+		Entry("element hiding exception", "example.com#@#.banner", "", false, false),
+		Entry("scriptlet rule", "example.com#%#//scriptlet('abort-on-property-read', 'ads')", "", false, false),
+		Entry("comment", "! Title: EasyList", "", false, false),
+		Entry("URL rule", "|https://ads.example.com/", "", false, false),
+	)
+
+	It("should map the exceptions of blacklist sources to the exceptions of the group", func() {
+		sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+			"gr1": {"[Adblock Plus 2.0]\n||ads.com^\n@@||allowed.com^\nexample.com##.banner\n"},
+		}, 0, 0, 0, 3, 0)
+		Expect(err).Should(Succeed())
+
+		found, group := sut.Match("ads.com", []string{"gr1"})
+		Expect(found).Should(BeTrue())
+		Expect(group).Should(Equal("gr1"))
+
+		found, _ = sut.Match("allowed.com", []string{"gr1"})
+		Expect(found).Should(BeFalse())
+
+		found, group = sut.MatchException("allowed.com", []string{"gr1"})
+		Expect(found).Should(BeTrue())
+		Expect(group).Should(Equal("gr1"))
+
+		found, _ = sut.MatchException("ads.com", []string{"gr1"})
+		Expect(found).Should(BeFalse())
+	})
+
+	It("should match the subdomains of the rule domain", func() {
+		sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+			"gr1": {"||ads.com^\n@@||allowed.ads.com^\n"},
+		}, 0, 0, 0, 3, 0)
+		Expect(err).Should(Succeed())
+
+		for _, domain := range []string{"ads.com", "sub.ads.com", "a.b.ads.com", "allowed.ads.com"} {
+			found, _ := sut.Match(domain, []string{"gr1"})
+			Expect(found).Should(BeTrue(), domain)
+		}
+
+		for _, domain := range []string{"otherads.com", "ads.com.example.org", "adsxcom"} {
+			found, _ := sut.Match(domain, []string{"gr1"})
+			Expect(found).Should(BeFalse(), domain)
+		}
+
+		found, _ := sut.MatchException("sub.allowed.ads.com", []string{"gr1"})
+		Expect(found).Should(BeTrue())
+
+		found, _ = sut.MatchException("sub.ads.com", []string{"gr1"})
+		Expect(found).Should(BeFalse())
+	})
+
+	It("should add the exceptions of whitelist sources to the whitelist", func() {
+		source := "@@||allowed.com^\n||also-allowed.com^\n"
+
+		sut, err := NewListCache(ListCacheTypeWhitelist, map[string][]string{
+			"gr1": {source},
+		}, 0, 0, 0, 3, 0, WithFormats(map[string]config.ListFormat{source: config.ListFormatAdblock}))
+		Expect(err).Should(Succeed())
+
+		for _, domain := range []string{"allowed.com", "also-allowed.com"} {
+			found, _ := sut.Match(domain, []string{"gr1"})
+			Expect(found).Should(BeTrue())
+		}
+	})
+})
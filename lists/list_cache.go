@@ -9,11 +9,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/0xERR0R/blocky/cache/stringcache"
+	"github.com/0xERR0R/blocky/config"
 
 	"github.com/avast/retry-go/v4"
 
@@ -23,6 +25,7 @@ import (
 
 	"github.com/0xERR0R/blocky/evt"
 	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/util"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,20 +47,89 @@ type Matcher interface {
 // ListCache generic cache of strings divided in groups
 type ListCache struct {
 	groupCaches map[string]stringcache.StringCache
-	lock        sync.RWMutex
+	// Adblock Plus exceptions of the blacklist sources per group
+	exceptionCaches map[string]stringcache.StringCache
+	lock            sync.RWMutex
 
 	groupToLinks     map[string][]string
 	refreshPeriod    time.Duration
+	refreshJitter    uint
 	downloadTimeout  time.Duration
 	downloadAttempts int
 	downloadCooldown time.Duration
 	listType         ListCacheType
+
+	hitCounting bool
+	hits        map[string]map[string]uint64
+	hitsLock    sync.Mutex
+
+	refreshWindows map[string]config.RefreshWindow
+	deferred       map[string]bool
+	deferredLock   sync.Mutex
+
+	// entries, which are also in the same group of this cache, are logged as warning, e.g. whitelisted
+	// entries of a blacklist
+	conflicts *ListCache
+
+	// format per source, other sources are detected automatically
+	formats map[string]config.ListFormat
+
+	asyncLoading bool
+	// closed after the first load attempt
+	attempted chan struct{}
+	// closed after all groups are loaded, groups which failed on the first attempt are retried
+	loaded      chan struct{}
+	retryPeriod time.Duration
+}
+
+// initialLoadRetryPeriod is the delay between the load attempts of groups, which failed on the initial load
+const initialLoadRetryPeriod = time.Minute
+
+// ListCacheOption configures optional features of the list cache
+type ListCacheOption func(c *ListCache)
+
+// WithHitCounting enables the counting of matches per group and source.
+// Each source of a group is checked separately, which makes the match more expensive
+func WithHitCounting() ListCacheOption {
+	return func(c *ListCache) {
+		c.hitCounting = true
+	}
+}
+
+// WithRefreshWindows defers the periodic refreshes of the groups until their daily time window.
+// The initial load and manually triggered refreshes are not deferred
+func WithRefreshWindows(windows map[string]config.RefreshWindow) ListCacheOption {
+	return func(c *ListCache) {
+		c.refreshWindows = windows
+	}
+}
+
+// WithConflictWarnings logs the entries, which are also in the same group of the passed cache, as warning on each
+// refresh, e.g. the whitelisted domains of a blacklist. The entries are compared exactly, they are not removed
+func WithConflictWarnings(conflicts *ListCache) ListCacheOption {
+	return func(c *ListCache) {
+		c.conflicts = conflicts
+	}
+}
+
+// SourceHits contains the amount of matches of one source of a group
+type SourceHits struct {
+	Group  string
+	Source string
+	Hits   uint64
 }
 
 // Configuration returns current configuration and stats
 func (b *ListCache) Configuration() (result []string) {
 	if b.refreshPeriod > 0 {
 		result = append(result, fmt.Sprintf("refresh period: %s", durafmt.Parse(b.refreshPeriod)))
+		result = append(result, fmt.Sprintf("refresh jitter: %d%%", b.refreshJitter))
+
+		for _, group := range sortedGroups(b.refreshWindows) {
+			if _, ok := b.groupToLinks[group]; ok {
+				result = append(result, fmt.Sprintf("refresh window %s: %s", group, b.refreshWindows[group]))
+			}
+		}
 	} else {
 		result = append(result, "refresh: disabled")
 	}
@@ -67,79 +139,245 @@ func (b *ListCache) Configuration() (result []string) {
 		result = append(result, fmt.Sprintf("  %s:", group))
 
 		for _, link := range links {
-			if strings.Contains(link, "\n") {
-				link = "[INLINE DEFINITION]"
+			if format, ok := b.formats[link]; ok {
+				result = append(result, fmt.Sprintf("   - %s (format: %s)", sourceName(link), format))
+			} else {
+				result = append(result, fmt.Sprintf("   - %s", sourceName(link)))
 			}
-
-			result = append(result, fmt.Sprintf("   - %s", link))
 		}
 	}
 
 	result = append(result, "group caches:")
 
-	var total int
+	var total, memory int
 
 	for group, cache := range b.groupCaches {
 		result = append(result, fmt.Sprintf("  %s: %d entries", group, cache.ElementCount()))
 		total += cache.ElementCount()
+		memory += cache.MemorySize()
 	}
 
 	result = append(result, fmt.Sprintf("  TOTAL: %d entries", total))
+	result = append(result, fmt.Sprintf("  MEMORY: ~%d KB", memory/1024))
 
 	return result
 }
 
+// WithFormats defines the format per source (URL, file path or inline definition)
+func WithFormats(formats map[string]config.ListFormat) ListCacheOption {
+	return func(c *ListCache) {
+		c.formats = formats
+	}
+}
+
+// WithAsyncLoading loads the lists in the background, NewListCache returns without waiting for the initial load.
+// An initial load error is only logged
+func WithAsyncLoading() ListCacheOption {
+	return func(c *ListCache) {
+		c.asyncLoading = true
+	}
+}
+
+// withRetryPeriod changes the delay between the load attempts of failed groups
+func withRetryPeriod(period time.Duration) ListCacheOption {
+	return func(c *ListCache) {
+		c.retryPeriod = period
+	}
+}
+
+// Loaded returns a channel which is closed after the initial load of all groups. Groups which failed to load
+// (e.g. the server was not reachable) are retried, the channel stays open until they are loaded
+func (b *ListCache) Loaded() <-chan struct{} {
+	return b.loaded
+}
+
 // NewListCache creates new list instance
-func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeriod time.Duration,
-	downloadTimeout time.Duration, downloadAttempts int, downloadCooldown time.Duration) (*ListCache, error) {
+func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeriod time.Duration, refreshJitter uint,
+	downloadTimeout time.Duration, downloadAttempts int, downloadCooldown time.Duration,
+	opts ...ListCacheOption) (*ListCache, error) {
 	groupCaches := make(map[string]stringcache.StringCache)
 
 	b := &ListCache{
 		groupToLinks:     groupToLinks,
 		groupCaches:      groupCaches,
+		exceptionCaches:  make(map[string]stringcache.StringCache),
 		refreshPeriod:    refreshPeriod,
+		refreshJitter:    refreshJitter,
 		downloadTimeout:  downloadTimeout,
 		downloadAttempts: downloadAttempts,
 		downloadCooldown: downloadCooldown,
 		listType:         t,
+		hits:             make(map[string]map[string]uint64),
+		deferred:         make(map[string]bool),
+		attempted:        make(chan struct{}),
+		loaded:           make(chan struct{}),
+		retryPeriod:      initialLoadRetryPeriod,
+	}
+
+	for _, opt := range opts {
+		opt(b)
 	}
+
+	if b.asyncLoading {
+		go func() {
+			// the other cache must be loaded before the entries are compared
+			if b.conflicts != nil {
+				<-b.conflicts.attempted
+			}
+
+			_ = b.initialLoad()
+		}()
+
+		return b, nil
+	}
+
+	return b, b.initialLoad()
+}
+
+// initialLoad loads all groups and starts the periodic refresh, failed groups are retried in the background
+func (b *ListCache) initialLoad() error {
 	initError := b.refresh(true)
 
-	if initError == nil {
-		go periodicUpdate(b)
+	close(b.attempted)
+
+	if missing := b.missingGroups(); len(missing) > 0 {
+		go b.retryLoad(missing)
+
+		return initError
 	}
 
-	return b, initError
+	close(b.loaded)
+
+	go periodicUpdate(b)
+
+	return initError
 }
 
-// periodicUpdate triggers periodical refresh (and download) of list entries
+// retryLoad loads the passed groups until all groups are loaded and starts the periodic refresh afterwards
+func (b *ListCache) retryLoad(groups []string) {
+	for len(groups) > 0 {
+		logger().WithField("list_type", b.listType).Warnf("initial load of groups '%s' failed, retrying in %s",
+			strings.Join(groups, ", "), durafmt.Parse(b.retryPeriod))
+
+		time.Sleep(b.retryPeriod)
+
+		for _, group := range groups {
+			_, _ = b.refreshGroup(group, b.groupToLinks[group], true)
+		}
+
+		groups = b.missingGroups()
+	}
+
+	close(b.loaded)
+
+	periodicUpdate(b)
+}
+
+// missingGroups returns the sorted groups without cache, e.g. the download failed with a temporary error
+func (b *ListCache) missingGroups() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	var result []string
+
+	for group := range b.groupToLinks {
+		if _, ok := b.groupCaches[group]; !ok {
+			result = append(result, group)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// periodicUpdate triggers periodical refresh (and download) of list entries.
+// Each period is reduced by a random jitter to avoid simultaneous refreshes of multiple instances
 func periodicUpdate(cache *ListCache) {
 	if cache.refreshPeriod > 0 {
-		ticker := time.NewTicker(cache.refreshPeriod)
-		defer ticker.Stop()
-
 		for {
-			<-ticker.C
-			cache.Refresh()
+			time.Sleep(util.ApplyJitter(cache.refreshPeriod, cache.refreshJitter))
+			cache.scheduledRefresh(time.Now())
 		}
 	}
 }
 
+// scheduledRefresh refreshes all groups, groups outside of their refresh window are refreshed when the window opens
+func (b *ListCache) scheduledRefresh(now time.Time) {
+	for group, links := range b.groupToLinks {
+		if window, ok := b.refreshWindows[group]; ok {
+			if delay := window.Delay(now); delay > 0 {
+				b.deferRefresh(group, links, delay)
+
+				continue
+			}
+		}
+
+		_, _ = b.refreshGroup(group, links, false)
+	}
+}
+
+// deferRefresh refreshes the group after the delay, a group is deferred only once
+func (b *ListCache) deferRefresh(group string, links []string, delay time.Duration) {
+	b.deferredLock.Lock()
+	defer b.deferredLock.Unlock()
+
+	if b.deferred[group] {
+		return
+	}
+
+	b.deferred[group] = true
+
+	logger().WithFields(logrus.Fields{
+		"list_type": b.listType,
+		"group":     group,
+	}).Infof("refresh of group deferred by %s until its refresh window %s", durafmt.Parse(delay.Round(time.Second)),
+		b.refreshWindows[group])
+
+	time.AfterFunc(delay, func() {
+		b.deferredLock.Lock()
+		delete(b.deferred, group)
+		b.deferredLock.Unlock()
+
+		_, _ = b.refreshGroup(group, links, false)
+	})
+}
+
+func sortedGroups(windows map[string]config.RefreshWindow) []string {
+	groups := make([]string, 0, len(windows))
+	for group := range windows {
+		groups = append(groups, group)
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
 func logger() *logrus.Entry {
 	return log.PrefixedLog("list_cache")
 }
 
 type groupCache struct {
+	link  string
 	cache []string
-	err   error
+	// Adblock Plus exception rules (@@||domain^)
+	exceptions []string
+	err        error
+}
+
+// SourceResult contains the result of the refresh of one source (link, file or inline definition) of a group
+type SourceResult struct {
+	Source string
+	Count  int
+	Err    error
 }
 
 // downloads and reads files with domain names and creates cache for them
-func (b *ListCache) createCacheForGroup(links []string) (stringcache.StringCache, error) {
+func (b *ListCache) createCacheForGroup(group string,
+	links []string) (cache, exceptions stringcache.StringCache, results []SourceResult, err error) {
 	var wg sync.WaitGroup
 
-	var err error
-
 	c := make(chan groupCache, len(links))
 	// loop over links (http/local) or inline definitions
 	for _, link := range links {
@@ -149,29 +387,235 @@ func (b *ListCache) createCacheForGroup(links []string) (stringcache.StringCache
 	}
 
 	wg.Wait()
+	close(c)
 
 	factory := stringcache.NewChainedCacheFactory()
+	exceptionFactory := stringcache.NewChainedCacheFactory()
+	results = make([]SourceResult, 0, len(links))
+	sources := make(sourceCaches, 0, len(links))
+	temporaryErr := false
+	hasExceptions := false
+	conflicts := b.conflictingEntries(group)
+
+	for res := range c {
+		// exceptions of a whitelist source are whitelist entries
+		if b.listType == ListCacheTypeWhitelist {
+			res.cache = append(res.cache, res.exceptions...)
+			res.exceptions = nil
+		}
 
-Loop:
-	for {
-		select {
-		case res := <-c:
-			if res.err != nil {
-				err = multierror.Append(err, res.err)
-			}
-			if res.cache == nil {
-				return nil, err
-			}
-			for _, entry := range res.cache {
-				factory.AddEntry(entry)
-			}
-		default:
-			close(c)
-			break Loop
+		for _, entry := range res.exceptions {
+			exceptionFactory.AddEntry(entry)
+
+			hasExceptions = true
+		}
+
+		b.warnConflicts(group, res.link, res.cache, conflicts)
+
+		results = append(results, SourceResult{Source: sourceName(res.link), Count: len(res.cache), Err: res.err})
+
+		if res.err != nil {
+			err = multierror.Append(err, res.err)
+		}
+
+		if res.cache == nil {
+			temporaryErr = true
 		}
+
+		if b.hitCounting {
+			sources = append(sources, newSourceCache(sourceName(res.link), res.cache))
+
+			continue
+		}
+
+		for _, entry := range res.cache {
+			factory.AddEntry(entry)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Source < results[j].Source
+	})
+
+	if temporaryErr {
+		return nil, nil, results, err
+	}
+
+	if hasExceptions {
+		exceptions = exceptionFactory.Create()
 	}
 
-	return factory.Create(), err
+	if b.hitCounting {
+		sort.Slice(sources, func(i, j int) bool {
+			return sources[i].source < sources[j].source
+		})
+
+		return sources, exceptions, results, err
+	}
+
+	return factory.Create(), exceptions, results, err
+}
+
+// conflictingEntries returns the entries of the group in the other cache, nil if conflicts are not logged
+func (b *ListCache) conflictingEntries(group string) map[string]struct{} {
+	if b.conflicts == nil {
+		return nil
+	}
+
+	b.conflicts.lock.RLock()
+	cache, found := b.conflicts.groupCaches[group]
+	b.conflicts.lock.RUnlock()
+
+	if !found {
+		return nil
+	}
+
+	result := make(map[string]struct{}, cache.ElementCount())
+
+	cache.ForEach(func(entry string) {
+		result[entry] = struct{}{}
+	})
+
+	return result
+}
+
+// warnConflicts logs the entries of the source, which are also in the other cache
+func (b *ListCache) warnConflicts(group, link string, entries []string, conflicts map[string]struct{}) {
+	const maxLoggedEntries = 10
+
+	if len(conflicts) == 0 {
+		return
+	}
+
+	var found []string
+
+	for _, entry := range entries {
+		if _, ok := conflicts[entry]; ok {
+			found = append(found, entry)
+		}
+	}
+
+	if len(found) == 0 {
+		return
+	}
+
+	count := len(found)
+
+	if len(found) > maxLoggedEntries {
+		found = append(found[:maxLoggedEntries], "...")
+	}
+
+	logger().WithFields(logrus.Fields{
+		"list_type": b.listType,
+		"group":     group,
+		"source":    sourceName(link),
+		"count":     count,
+	}).Warnf("entries are also on the %s of the group: %s", b.conflicts.listType, strings.Join(found, ", "))
+}
+
+// sourceName returns the link or a placeholder for inline definitions
+func sourceName(link string) string {
+	if strings.Contains(link, "\n") {
+		return "[INLINE DEFINITION]"
+	}
+
+	return link
+}
+
+// sourceCache contains the entries of one source of a group
+type sourceCache struct {
+	source string
+	cache  stringcache.StringCache
+}
+
+func newSourceCache(source string, entries []string) sourceCache {
+	factory := stringcache.NewChainedCacheFactory()
+
+	for _, entry := range entries {
+		factory.AddEntry(entry)
+	}
+
+	return sourceCache{source: source, cache: factory.Create()}
+}
+
+// sourceCaches is a group cache which keeps the entries of each source separately,
+// so the matching source can be determined
+type sourceCaches []sourceCache
+
+func (c sourceCaches) ElementCount() (count int) {
+	for _, s := range c {
+		count += s.cache.ElementCount()
+	}
+
+	return count
+}
+
+func (c sourceCaches) MemorySize() (size int) {
+	for _, s := range c {
+		size += s.cache.MemorySize()
+	}
+
+	return size
+}
+
+func (c sourceCaches) Contains(searchString string) bool {
+	_, found := c.matchingSource(searchString)
+
+	return found
+}
+
+// ForEach calls the function for each entry, the sorted entries of the sources are merged and passed once
+func (c sourceCaches) ForEach(fn func(entry string)) {
+	caches := make([]stringcache.StringCache, 0, len(c))
+
+	for _, s := range c {
+		caches = append(caches, s.cache)
+	}
+
+	stringcache.ForEachMerged(caches, fn)
+}
+
+// matchingSource returns the first source containing the passed string
+func (c sourceCaches) matchingSource(searchString string) (string, bool) {
+	for _, s := range c {
+		if s.cache.Contains(searchString) {
+			return s.source, true
+		}
+	}
+
+	return "", false
+}
+
+// ForEachEntry calls the function for each loaded entry of the group, returns false if the group is unknown.
+// The lock is not held while iterating, a refresh replaces the cache of the group
+func (b *ListCache) ForEachEntry(group string, fn func(entry string)) bool {
+	if _, found := b.groupToLinks[group]; !found {
+		return false
+	}
+
+	b.lock.RLock()
+	c, found := b.groupCaches[group]
+	b.lock.RUnlock()
+
+	if found {
+		c.ForEach(fn)
+	}
+
+	return true
+}
+
+// MatchException returns true if the domain is an Adblock Plus exception (@@||domain^) of one passed group
+func (b *ListCache) MatchException(domain string, groupsToCheck []string) (found bool, group string) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, g := range groupsToCheck {
+		if c, ok := b.exceptionCaches[g]; ok && c.Contains(domain) {
+			return true, g
+		}
+	}
+
+	return false, ""
 }
 
 // Match matches passed domain name against cached list entries
@@ -180,7 +624,22 @@ func (b *ListCache) Match(domain string, groupsToCheck []string) (found bool, gr
 	defer b.lock.RUnlock()
 
 	for _, g := range groupsToCheck {
-		if c, ok := b.groupCaches[g]; ok && c.Contains(domain) {
+		c, ok := b.groupCaches[g]
+		if !ok {
+			continue
+		}
+
+		if sources, ok := c.(sourceCaches); ok {
+			if source, found := sources.matchingSource(domain); found {
+				b.countHit(g, source)
+
+				return true, g
+			}
+
+			continue
+		}
+
+		if c.Contains(domain) {
 			return true, g
 		}
 	}
@@ -188,43 +647,143 @@ func (b *ListCache) Match(domain string, groupsToCheck []string) (found bool, gr
 	return false, ""
 }
 
+func (b *ListCache) countHit(group, source string) {
+	b.hitsLock.Lock()
+
+	if b.hits[group] == nil {
+		b.hits[group] = make(map[string]uint64)
+	}
+
+	b.hits[group][source]++
+
+	b.hitsLock.Unlock()
+
+	evt.Bus().Publish(evt.BlockingListSourceHit, b.listType, group, source)
+}
+
+// Hits returns the amount of matches per group and source since the start, sorted by group and source.
+// Sources without matches are included, the result is empty if hit counting is disabled
+func (b *ListCache) Hits() []SourceHits {
+	b.hitsLock.Lock()
+	defer b.hitsLock.Unlock()
+
+	result := make([]SourceHits, 0, len(b.hits))
+
+	for group, sources := range b.hits {
+		for source, hits := range sources {
+			result = append(result, SourceHits{Group: group, Source: source, Hits: hits})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Group != result[j].Group {
+			return result[i].Group < result[j].Group
+		}
+
+		return result[i].Source < result[j].Source
+	})
+
+	return result
+}
+
+// initHits adds the sources of a group with zero hits, so sources without matches are visible
+func (b *ListCache) initHits(group string, results []SourceResult) {
+	b.hitsLock.Lock()
+	defer b.hitsLock.Unlock()
+
+	if b.hits[group] == nil {
+		b.hits[group] = make(map[string]uint64)
+	}
+
+	for _, r := range results {
+		if _, ok := b.hits[group][r.Source]; !ok {
+			b.hits[group][r.Source] = 0
+		}
+	}
+}
+
 // Refresh triggers the refresh of a list
 func (b *ListCache) Refresh() {
 	_ = b.refresh(false)
 }
+
+// RefreshGroup triggers the refresh of one group and returns the results of its sources,
+// found is false if the group is not defined
+func (b *ListCache) RefreshGroup(group string) (results []SourceResult, found bool) {
+	links, found := b.groupToLinks[group]
+	if !found {
+		return nil, false
+	}
+
+	results, _ = b.refreshGroup(group, links, false)
+
+	return results, true
+}
+
 func (b *ListCache) refresh(init bool) error {
 	var err error
 
 	for group, links := range b.groupToLinks {
-		cacheForGroup, e := b.createCacheForGroup(links)
-		if e != nil {
-			err = multierror.Append(err, multierror.Prefix(e, fmt.Sprintf("can't create cache group '%s':", group)))
+		if _, e := b.refreshGroup(group, links, init); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+
+	return err
+}
+
+func (b *ListCache) refreshGroup(group string, links []string, init bool) ([]SourceResult, error) {
+	var err error
+
+	cacheForGroup, exceptions, results, e := b.createCacheForGroup(group, links)
+	if e != nil {
+		err = multierror.Prefix(e, fmt.Sprintf("can't create cache group '%s':", group))
+
+		logger().WithFields(logrus.Fields{
+			"list_type": b.listType,
+			"group":     group,
+		}).Errorf("refresh of group failed: %s", e)
+
+		evt.Bus().Publish(evt.BlockingCacheGroupRefreshFailed, b.listType, group, e)
+	}
+
+	if cacheForGroup != nil {
+		b.lock.Lock()
+		b.groupCaches[group] = cacheForGroup
+
+		if exceptions != nil {
+			b.exceptionCaches[group] = exceptions
+		} else {
+			delete(b.exceptionCaches, group)
 		}
+		b.lock.Unlock()
 
-		if cacheForGroup != nil {
-			b.lock.Lock()
-			b.groupCaches[group] = cacheForGroup
-			b.lock.Unlock()
+		if b.hitCounting {
+			b.initHits(group, results)
+		}
+	} else {
+		if init {
+			msg := "Populating group cache failed for group " + group
+			logger().Warn(msg)
 		} else {
-			if init {
-				msg := "Populating group cache failed for group " + group
-				logger().Warn(msg)
-			} else {
-				logger().Warn("Populating of group cache failed, leaving items from last successful download in cache")
-			}
+			logger().Warn("Populating of group cache failed, leaving items from last successful download in cache")
 		}
+	}
 
-		if b.groupCaches[group] != nil {
-			evt.Bus().Publish(evt.BlockingCacheGroupChanged, b.listType, group, b.groupCaches[group].ElementCount())
+	b.lock.RLock()
+	defer b.lock.RUnlock()
 
-			logger().WithFields(logrus.Fields{
-				"group":       group,
-				"total_count": b.groupCaches[group].ElementCount(),
-			}).Info("group import finished")
-		}
+	if b.groupCaches[group] != nil {
+		evt.Bus().Publish(evt.BlockingCacheGroupChanged, b.listType, group, b.groupCaches[group].ElementCount())
+		evt.Bus().Publish(evt.BlockingCacheGroupMemoryChanged, b.listType, group, b.groupCaches[group].MemorySize())
+
+		logger().WithFields(logrus.Fields{
+			"group":       group,
+			"total_count": b.groupCaches[group].ElementCount(),
+		}).Info("group import finished")
 	}
 
-	return err
+	return results, err
 }
 
 func (b *ListCache) downloadFile(link string) (io.ReadCloser, error) {
@@ -293,6 +852,7 @@ func (b *ListCache) processFile(link string, ch chan<- groupCache, wg *sync.Wait
 	defer wg.Done()
 
 	result := groupCache{
+		link:  link,
 		cache: []string{},
 	}
 
@@ -318,27 +878,27 @@ func (b *ListCache) processFile(link string, ch chan<- groupCache, wg *sync.Wait
 	}
 	defer r.Close()
 
-	var count int
-
 	scanner := bufio.NewScanner(r)
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// skip comments
-		if line := processLine(line); line != "" {
-			result.cache = append(result.cache, line)
+	format := b.formats[link]
 
-			count++
-		}
+	for scanner.Scan() {
+		parseLine(format, strings.TrimSpace(scanner.Text()), &result)
 	}
 
 	if err := scanner.Err(); err != nil {
 		logger().Warn("can't parse file: ", err)
 	} else {
-		logger().WithFields(logrus.Fields{
+		fields := logrus.Fields{
 			"source": link,
-			"count":  count,
-		}).Info("file imported")
+			"count":  len(result.cache),
+		}
+
+		if len(result.exceptions) > 0 {
+			fields["exceptions"] = len(result.exceptions)
+		}
+
+		logger().WithFields(fields).Info("file imported")
 	}
 	ch <- result
 }
@@ -358,25 +918,3 @@ func (b *ListCache) getLinkReader(link string) (r io.ReadCloser, err error) {
 
 	return
 }
-
-// return only first column (see hosts format)
-func processLine(line string) string {
-	if strings.HasPrefix(line, "#") {
-		return ""
-	}
-
-	parts := strings.Fields(line)
-
-	if len(parts) > 0 {
-		host := parts[len(parts)-1]
-
-		ip := net.ParseIP(host)
-		if ip != nil {
-			return ip.String()
-		}
-
-		return strings.TrimSpace(strings.ToLower(host))
-	}
-
-	return ""
-}
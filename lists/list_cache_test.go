@@ -1,17 +1,23 @@
 package lists
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/0xERR0R/blocky/config"
 	. "github.com/0xERR0R/blocky/evt"
 
 	. "github.com/0xERR0R/blocky/helpertest"
+	"github.com/0xERR0R/blocky/log"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 )
 
 var _ = Describe("ListCache", func() {
@@ -46,7 +52,7 @@ var _ = Describe("ListCache", func() {
 				lists := map[string][]string{
 					"gr0": {emptyFile.Name()},
 				}
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Second)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Second)
 
 				found, group := sut.Match("", []string{"gr0"})
 				Expect(found).Should(BeFalse())
@@ -59,7 +65,7 @@ var _ = Describe("ListCache", func() {
 				lists := map[string][]string{
 					"gr1": {emptyFile.Name()},
 				}
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Second)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Second)
 
 				found, group := sut.Match("google.com", []string{"gr1"})
 				Expect(found).Should(BeFalse())
@@ -90,7 +96,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {s.URL},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 400*time.Millisecond, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 400*time.Millisecond, 3, time.Millisecond)
 				Eventually(func(g Gomega) {
 					found, group := sut.Match("blocked1.com", []string{"gr1"})
 					g.Expect(found).Should(BeTrue())
@@ -119,7 +125,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {s.URL, emptyFile.Name()},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 4*time.Hour, 100*time.Millisecond, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 4*time.Hour, 0, 100*time.Millisecond, 3, time.Millisecond)
 				By("Lists loaded without timeout", func() {
 					Eventually(func(g Gomega) {
 						found, group := sut.Match("blocked1.com", []string{"gr1"})
@@ -157,7 +163,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {s.URL},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
 				By("Lists loaded without err", func() {
 					Eventually(func(g Gomega) {
 						found, group := sut.Match("blocked1.com", []string{"gr1"})
@@ -177,6 +183,34 @@ var _ = Describe("ListCache", func() {
 				})
 			})
 		})
+		When("list group can't be refreshed", func() {
+			It("should publish refresh failed event", func() {
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusNotFound)
+				}))
+				defer s.Close()
+
+				var (
+					failedGroup string
+					failedErr   error
+				)
+
+				_ = Bus().SubscribeOnce(BlockingCacheGroupRefreshFailed, func(_ ListCacheType, group string, err error) {
+					failedGroup = group
+					failedErr = err
+				})
+
+				lists := map[string][]string{
+					"gr1": {s.URL},
+				}
+
+				_, err := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 1, time.Millisecond)
+				Expect(err).Should(HaveOccurred())
+
+				Expect(failedGroup).Should(Equal("gr1"))
+				Expect(failedErr).Should(MatchError(ContainSubstring("got status code 404")))
+			})
+		})
 		When("Configuration has 3 external urls", func() {
 			It("should download the list and match against", func() {
 				lists := map[string][]string{
@@ -184,7 +218,7 @@ var _ = Describe("ListCache", func() {
 					"gr2": {server3.URL},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
 
 				found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 				Expect(found).Should(BeTrue())
@@ -205,7 +239,7 @@ var _ = Describe("ListCache", func() {
 					"withDeadLink": {"http://wrong.host.name"},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
 
 				found, group := sut.Match("blocked1.com", []string{})
 				Expect(found).Should(BeFalse())
@@ -224,13 +258,72 @@ var _ = Describe("ListCache", func() {
 					resultCnt = cnt
 				})
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 30*time.Second, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
 
 				found, group := sut.Match("blocked1.com", []string{})
 				Expect(found).Should(BeFalse())
 				Expect(group).Should(BeEmpty())
 				Expect(resultCnt).Should(Equal(3))
 			})
+			It("event should be fired and contain the estimated memory size", func() {
+				lists := map[string][]string{
+					"gr1": {server1.URL},
+				}
+
+				resultSize := 0
+
+				_ = Bus().SubscribeOnce(BlockingCacheGroupMemoryChanged, func(listType ListCacheType, group string, size int) {
+					resultSize = size
+				})
+
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
+
+				Expect(resultSize).Should(BeNumerically(">", 0))
+				Expect(resultSize).Should(Equal(sut.groupCaches["gr1"].MemorySize()))
+			})
+		})
+		When("whitelist is defined with external url", func() {
+			It("should download and refresh the list like a blacklist", func() {
+				var (
+					lock sync.Mutex
+					body = "allowed1.com"
+				)
+
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					lock.Lock()
+					defer lock.Unlock()
+
+					_, _ = rw.Write([]byte(body))
+				}))
+				defer s.Close()
+
+				var changedType ListCacheType
+
+				_ = Bus().SubscribeOnce(BlockingCacheGroupChanged, func(listType ListCacheType, group string, cnt int) {
+					changedType = listType
+				})
+
+				sut, err := NewListCache(ListCacheTypeWhitelist, map[string][]string{"gr1": {s.URL}},
+					0, 0, 30*time.Second, 3, time.Millisecond)
+				Expect(err).Should(Succeed())
+				Expect(changedType).Should(Equal(ListCacheTypeWhitelist))
+
+				found, group := sut.Match("allowed1.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+
+				lock.Lock()
+				body = "allowed2.com"
+				lock.Unlock()
+
+				sut.Refresh()
+
+				found, _ = sut.Match("allowed1.com", []string{"gr1"})
+				Expect(found).Should(BeFalse())
+
+				found, _ = sut.Match("allowed2.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+			})
 		})
 		When("multiple groups are passed", func() {
 			It("should match", func() {
@@ -239,7 +332,7 @@ var _ = Describe("ListCache", func() {
 					"gr2": {"file://" + file3.Name()},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 0, 3, time.Millisecond)
 
 				found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 				Expect(found).Should(BeTrue())
@@ -260,7 +353,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {"inlinedomain1.com\n#some comment\n#inlinedomain2.com"},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 0, 3, time.Millisecond)
 
 				found, group := sut.Match("inlinedomain1.com", []string{"gr1"})
 				Expect(found).Should(BeTrue())
@@ -277,7 +370,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {"/^apple\\.(de|com)$/\n"},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 0, 3, time.Millisecond)
 
 				found, group := sut.Match("apple.com", []string{"gr1"})
 				Expect(found).Should(BeTrue())
@@ -288,6 +381,289 @@ var _ = Describe("ListCache", func() {
 				Expect(group).Should(Equal("gr1"))
 			})
 		})
+		When("hit counting is enabled", func() {
+			It("should count the matches per source", func() {
+				lists := map[string][]string{
+					"gr1": {server1.URL, server2.URL},
+					"gr2": {server3.URL},
+				}
+
+				var hitSource string
+
+				_ = Bus().SubscribeOnce(BlockingListSourceHit, func(_ ListCacheType, group, source string) {
+					hitSource = source
+				})
+
+				sut, err := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond,
+					WithHitCounting())
+				Expect(err).Should(Succeed())
+
+				found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+				Expect(hitSource).Should(Equal(server1.URL))
+
+				found, group = sut.Match("blocked2.com", []string{"gr1", "gr2"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+
+				_, _ = sut.Match("blocked1.com", []string{"gr1"})
+				_, _ = sut.Match("unknown.com", []string{"gr1", "gr2"})
+
+				Expect(sut.Hits()).Should(ConsistOf(
+					SourceHits{Group: "gr1", Source: server1.URL, Hits: 2},
+					SourceHits{Group: "gr1", Source: server2.URL, Hits: 1},
+					SourceHits{Group: "gr2", Source: server3.URL, Hits: 0},
+				))
+			})
+		})
+		When("conflict warnings are enabled", func() {
+			var (
+				whitelist *ListCache
+				hook      *test.Hook
+			)
+
+			BeforeEach(func() {
+				whitelist, _ = NewListCache(ListCacheTypeWhitelist, map[string][]string{
+					"gr1": {"both.com\nallowed.com\n/^ads\\./"},
+				}, 0, 0, 0, 3, time.Millisecond)
+
+				hook = test.NewGlobal()
+				log.Log().AddHook(hook)
+				DeferCleanup(hook.Reset)
+
+				level := log.Log().GetLevel()
+				log.Log().SetLevel(logrus.WarnLevel)
+				DeferCleanup(func() { log.Log().SetLevel(level) })
+			})
+
+			createBlacklist := func() *ListCache {
+				sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {"both.com\nblocked.com\nads.example.com\n/ads/"},
+					"gr2": {"both.com\n"},
+				}, 0, 0, 0, 3, time.Millisecond, WithConflictWarnings(whitelist))
+				Expect(err).Should(Succeed())
+
+				return sut
+			}
+
+			It("should keep the entries, the whitelist is checked on each query", func() {
+				sut := createBlacklist()
+
+				found, _ := sut.Match("both.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+
+				found, _ = sut.Match("blocked.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+			})
+
+			It("should log the exact entries, which are on the whitelist of the same group", func() {
+				createBlacklist()
+
+				Expect(hook.AllEntries()).Should(ContainElement(And(
+					HaveField("Level", logrus.WarnLevel),
+					HaveField("Message", Equal("entries are also on the whitelist of the group: both.com")),
+					HaveField("Data", HaveKeyWithValue("group", "gr1")),
+				)))
+				Expect(hook.AllEntries()).Should(HaveLen(1))
+			})
+		})
+		When("lists are loaded asynchronously", func() {
+			It("should return before the lists are loaded and close the loaded channel afterwards", func() {
+				release := make(chan struct{})
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					<-release
+					_, _ = rw.Write([]byte("blocked1.com"))
+				}))
+				defer s.Close()
+
+				sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {s.URL},
+				}, 0, 0, 30*time.Second, 3, time.Millisecond, WithAsyncLoading())
+				Expect(err).Should(Succeed())
+
+				Consistently(sut.Loaded(), "100ms").ShouldNot(BeClosed())
+				found, _ := sut.Match("blocked1.com", []string{"gr1"})
+				Expect(found).Should(BeFalse())
+
+				close(release)
+
+				Eventually(sut.Loaded(), "1s").Should(BeClosed())
+				found, _ = sut.Match("blocked1.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+			})
+
+			It("should close the loaded channel of synchronously loaded lists", func() {
+				sut, _ := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {file1.Name()},
+				}, 0, 0, 30*time.Second, 3, time.Millisecond)
+
+				Expect(sut.Loaded()).Should(BeClosed())
+			})
+
+			It("should retry failed groups and close the loaded channel after they are loaded", func() {
+				var available int32
+
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					if atomic.LoadInt32(&available) == 0 {
+						// timeout of the client
+						time.Sleep(100 * time.Millisecond)
+					}
+					_, _ = rw.Write([]byte("blocked1.com"))
+				}))
+				defer s.Close()
+
+				sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {s.URL},
+					"gr2": {file1.Name()},
+				}, 0, 0, 20*time.Millisecond, 1, time.Millisecond, WithAsyncLoading(), withRetryPeriod(50*time.Millisecond))
+				Expect(err).Should(Succeed())
+
+				Eventually(sut.attempted, "1s").Should(BeClosed())
+				Consistently(sut.Loaded(), "200ms").ShouldNot(BeClosed())
+				Expect(sut.missingGroups()).Should(Equal([]string{"gr1"}))
+
+				atomic.StoreInt32(&available, 1)
+
+				Eventually(sut.Loaded(), "1s").Should(BeClosed())
+				found, group := sut.Match("blocked1.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+			})
+
+			It("should not wait for sources with a permanent error", func() {
+				sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {"/not/existing/file"},
+				}, 0, 0, 30*time.Second, 1, time.Millisecond)
+				Expect(err).Should(HaveOccurred())
+
+				Expect(sut.Loaded()).Should(BeClosed())
+			})
+		})
+		When("entries of a group are iterated", func() {
+			It("should pass the deduplicated entries of all sources", func() {
+				sut, _ := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {server1.URL, server3.URL, "/^regex\\.com$/\n"},
+				}, 0, 0, 30*time.Second, 3, time.Millisecond)
+
+				var entries []string
+				Expect(sut.ForEachEntry("gr1", func(entry string) {
+					entries = append(entries, entry)
+				})).Should(BeTrue())
+
+				Expect(entries).Should(Equal([]string{
+					"192.168.178.55", "blocked1.com", "blocked1a.com", "blocked3.com", "/^regex\\.com$/",
+				}))
+
+				Expect(sut.ForEachEntry("unknown", func(string) {})).Should(BeFalse())
+			})
+			It("should deduplicate and merge the sorted entries of the sources with hit counting", func() {
+				sut, _ := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {server3.URL, "/^regex\\.com$/\nblocked0.com", server1.URL, "/^regex\\.com$/"},
+				}, 0, 0, 30*time.Second, 3, time.Millisecond, WithHitCounting())
+
+				var entries []string
+				sut.ForEachEntry("gr1", func(entry string) {
+					entries = append(entries, entry)
+				})
+
+				Expect(entries).Should(Equal([]string{
+					"192.168.178.55", "blocked0.com", "blocked1.com", "blocked1a.com", "blocked3.com", "/^regex\\.com$/",
+				}))
+			})
+		})
+		When("list formats are defined", func() {
+			It("should parse each source with its format", func() {
+				hosts := TestServer("0.0.0.0 ads.com www.ads.com\n127.0.0.1 localhost")
+				defer hosts.Close()
+
+				adblock := TestServer("[Adblock Plus 2.0]\n||tracker.com^\n! comment")
+				defer adblock.Close()
+
+				sut, err := NewListCache(ListCacheTypeBlacklist, map[string][]string{
+					"gr1": {hosts.URL, adblock.URL},
+				}, 0, 0, 30*time.Second, 3, time.Millisecond, WithFormats(map[string]config.ListFormat{
+					hosts.URL: config.ListFormatHosts,
+				}))
+				Expect(err).Should(Succeed())
+
+				var entries []string
+				sut.ForEachEntry("gr1", func(entry string) {
+					entries = append(entries, entry)
+				})
+
+				Expect(entries).Should(Equal([]string{"ads.com", "www.ads.com", "/(^|\\.)tracker\\.com$/"}))
+				Expect(sut.Configuration()).Should(ContainElement(fmt.Sprintf("   - %s (format: hosts)", hosts.URL)))
+			})
+		})
+		When("hit counting is disabled", func() {
+			It("should not count the matches", func() {
+				lists := map[string][]string{
+					"gr1": {server1.URL},
+				}
+
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 30*time.Second, 3, time.Millisecond)
+
+				found, _ := sut.Match("blocked1.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+				Expect(sut.Hits()).Should(BeEmpty())
+			})
+		})
+		When("refresh window is defined", func() {
+			var (
+				downloads int32
+				sut       *ListCache
+			)
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&downloads, 0)
+
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					atomic.AddInt32(&downloads, 1)
+					_, _ = rw.Write([]byte("blocked1.com"))
+				}))
+				DeferCleanup(s.Close)
+
+				var err error
+				sut, err = NewListCache(ListCacheTypeBlacklist, map[string][]string{"gr1": {s.URL}},
+					0, 0, 30*time.Second, 3, time.Millisecond,
+					WithRefreshWindows(map[string]config.RefreshWindow{"gr1": {Start: time.Hour, End: 2 * time.Hour}}))
+				Expect(err).Should(Succeed())
+				Expect(atomic.LoadInt32(&downloads)).Should(BeEquivalentTo(1))
+			})
+
+			day := func(hour, minute int) time.Time {
+				return time.Date(2022, 3, 1, hour, minute, 0, 0, time.Local)
+			}
+
+			It("should refresh the group within the window", func() {
+				sut.scheduledRefresh(day(1, 30))
+
+				Expect(atomic.LoadInt32(&downloads)).Should(BeEquivalentTo(2))
+			})
+
+			It("should defer the refresh until the window opens", func() {
+				// the window opens in 100ms
+				now := day(1, 0).Add(-100 * time.Millisecond)
+
+				sut.scheduledRefresh(now)
+				sut.scheduledRefresh(now)
+				Expect(atomic.LoadInt32(&downloads)).Should(BeEquivalentTo(1))
+
+				Eventually(func() int32 {
+					return atomic.LoadInt32(&downloads)
+				}).Should(BeEquivalentTo(2))
+				Consistently(func() int32 {
+					return atomic.LoadInt32(&downloads)
+				}, "200ms").Should(BeEquivalentTo(2))
+			})
+
+			It("should not defer manual refreshes", func() {
+				sut.Refresh()
+
+				Expect(atomic.LoadInt32(&downloads)).Should(BeEquivalentTo(2))
+			})
+		})
 	})
 	Describe("Configuration", func() {
 		When("refresh is enabled", func() {
@@ -297,10 +673,10 @@ var _ = Describe("ListCache", func() {
 					"gr2": {"inline\ndefinition\n"},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, 0, 0, 0, 3, time.Millisecond)
 
 				c := sut.Configuration()
-				Expect(c).Should(HaveLen(11))
+				Expect(c).Should(HaveLen(12))
 			})
 		})
 		When("refresh is disabled", func() {
@@ -309,7 +685,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {"file1", "file2"},
 				}
 
-				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, -1, 0, 3, time.Millisecond)
+				sut, _ := NewListCache(ListCacheTypeBlacklist, lists, -1, 0, 0, 3, time.Millisecond)
 
 				c := sut.Configuration()
 				Expect(c).Should(ContainElement("refresh: disabled"))
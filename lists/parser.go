@@ -0,0 +1,103 @@
+package lists
+
+import (
+	"net"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+)
+
+// names of hosts files, which are not blocked (e.g. "127.0.0.1 localhost")
+var localHostNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+}
+
+// parseLine adds the entries of the line in the format of the source to the result, comments and empty lines
+// are skipped
+func parseLine(format config.ListFormat, line string, result *groupCache) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	switch format {
+	case config.ListFormatDomains:
+		result.cache = parseDomainLine(line, result.cache)
+	case config.ListFormatHosts:
+		result.cache = parseHostsLine(line, result.cache)
+	case config.ListFormatAdblock:
+		parseAdblockLine(line, result)
+	default:
+		if isAdblockLine(line) {
+			parseAdblockLine(line, result)
+
+			return
+		}
+
+		// the last column is the domain of a domain line and the name of a hosts line
+		parts := strings.Fields(line)
+
+		result.cache = append(result.cache, normalizeEntry(parts[len(parts)-1]))
+	}
+}
+
+// parseDomainLine appends the first column without trailing comment, regexes are appended unchanged
+func parseDomainLine(line string, entries []string) []string {
+	if regexPattern(line) {
+		return append(entries, line)
+	}
+
+	parts := strings.Fields(stripComment(line))
+	if len(parts) == 0 {
+		return entries
+	}
+
+	return append(entries, normalizeEntry(parts[0]))
+}
+
+// parseHostsLine appends all names after the IP address, local names are skipped
+func parseHostsLine(line string, entries []string) []string {
+	parts := strings.Fields(stripComment(line))
+	if len(parts) < 2 || net.ParseIP(parts[0]) == nil {
+		return entries
+	}
+
+	for _, name := range parts[1:] {
+		name = strings.ToLower(name)
+
+		if !localHostNames[name] && net.ParseIP(name) == nil {
+			entries = append(entries, name)
+		}
+	}
+
+	return entries
+}
+
+func regexPattern(line string) bool {
+	return len(line) > 1 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/")
+}
+
+func stripComment(line string) string {
+	if idx := strings.IndexByte(line, '#'); idx >= 0 {
+		return line[:idx]
+	}
+
+	return line
+}
+
+func normalizeEntry(entry string) string {
+	if ip := net.ParseIP(entry); ip != nil {
+		return ip.String()
+	}
+
+	return strings.ToLower(entry)
+}
@@ -0,0 +1,62 @@
+package lists
+
+import (
+	"github.com/0xERR0R/blocky/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parser", func() {
+	parse := func(format config.ListFormat, lines ...string) []string {
+		var result groupCache
+
+		for _, line := range lines {
+			parseLine(format, line, &result)
+		}
+
+		return result.cache
+	}
+
+	Describe("auto format", func() {
+		It("should take the last column of domain and hosts lines", func() {
+			Expect(parse(config.ListFormatAuto,
+				"# comment", "", "Example.com", "0.0.0.0 ads.com", "2001:0db8::1", "/^regex\\.com$/",
+			)).Should(Equal([]string{"example.com", "ads.com", "2001:db8::1", "/^regex\\.com$/"}))
+		})
+		It("should detect Adblock Plus rules", func() {
+			Expect(parse(config.ListFormatAuto,
+				"[Adblock Plus 2.0]", "! comment", "||tracker.com^", "@@||allowed.com^",
+			)).Should(Equal([]string{"/(^|\\.)tracker\\.com$/"}))
+		})
+	})
+
+	Describe("domains format", func() {
+		It("should take the first column without comment", func() {
+			Expect(parse(config.ListFormatDomains,
+				"ads.com # ad server", "Tracker.com", "/^Regex/", "   ", "2001:0DB8::1",
+			)).Should(Equal([]string{"ads.com", "tracker.com", "/^Regex/", "2001:db8::1"}))
+		})
+	})
+
+	Describe("hosts format", func() {
+		It("should take all names after the IP address", func() {
+			Expect(parse(config.ListFormatHosts,
+				"0.0.0.0 ads.com www.ads.com # comment",
+				"127.0.0.1 localhost",
+				"::1 ip6-localhost ip6-loopback",
+				"0.0.0.0 0.0.0.0",
+				"no-ip.com",
+			)).Should(Equal([]string{"ads.com", "www.ads.com"}))
+		})
+	})
+
+	Describe("adblock format", func() {
+		It("should take the domain rules", func() {
+			Expect(parse(config.ListFormatAdblock,
+				"! Title: test", "||Ads.com^", "||tracker.org^|", "||cdn.com/ads.js", "||*.wild.com^",
+				"example.com##.banner", "ads2.com", "||opt.com^$third-party",
+			)).Should(Equal([]string{"/(^|\\.)ads\\.com$/", "/(^|\\.)tracker\\.org$/"}))
+		})
+	})
+})
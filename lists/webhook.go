@@ -0,0 +1,67 @@
+package lists
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/0xERR0R/blocky/evt"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// refreshFailedNotification is the JSON payload sent to the refresh failure webhook
+type refreshFailedNotification struct {
+	ListType  string    `json:"listType"`
+	Group     string    `json:"group"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RegisterRefreshFailureWebhook sends a POST request with JSON payload to the passed URL
+// each time a list group can't be refreshed. The request is sent asynchronously.
+func RegisterRefreshFailureWebhook(url string) error {
+	return evt.Bus().SubscribeAsync(evt.BlockingCacheGroupRefreshFailed, newRefreshFailureWebhook(url), false)
+}
+
+// newRefreshFailureWebhook returns the event handler sending the notifications to the passed URL
+func newRefreshFailureWebhook(url string) func(listType ListCacheType, group string, refreshErr error) {
+	client := http.Client{
+		Timeout: webhookTimeout,
+	}
+
+	return func(listType ListCacheType, group string, refreshErr error) {
+		sendRefreshFailedNotification(&client, url, refreshFailedNotification{
+			ListType:  listType.String(),
+			Group:     group,
+			Error:     refreshErr.Error(),
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+func sendRefreshFailedNotification(client *http.Client, url string, n refreshFailedNotification) {
+	logger := logger().WithField("webhook", url)
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		logger.Error("can't create webhook payload: ", err)
+
+		return
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Error("can't send webhook notification: ", err)
+
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		logger.Error("webhook notification failed: ", fmt.Errorf("got status code %d", resp.StatusCode))
+	}
+}
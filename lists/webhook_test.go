@@ -0,0 +1,78 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/0xERR0R/blocky/evt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Refresh failure webhook", func() {
+	var (
+		server   *httptest.Server
+		lock     sync.Mutex
+		received []refreshFailedNotification
+	)
+
+	BeforeEach(func() {
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			var n refreshFailedNotification
+			err := json.NewDecoder(req.Body).Decode(&n)
+			Expect(err).Should(Succeed())
+
+			lock.Lock()
+			defer lock.Unlock()
+			received = append(received, n)
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// subscribes the webhook like RegisterRefreshFailureWebhook, unsubscribed after the test
+	subscribe := func(url string) {
+		handler := newRefreshFailureWebhook(url)
+		Expect(Bus().SubscribeAsync(BlockingCacheGroupRefreshFailed, handler, false)).Should(Succeed())
+		DeferCleanup(func() {
+			Bus().WaitAsync()
+			Expect(Bus().Unsubscribe(BlockingCacheGroupRefreshFailed, handler)).Should(Succeed())
+		})
+	}
+
+	When("webhook is registered", func() {
+		It("should send a notification if a group refresh fails", func() {
+			subscribe(server.URL)
+
+			Bus().Publish(BlockingCacheGroupRefreshFailed, ListCacheTypeBlacklist, "gr1", errors.New("boom"))
+
+			Eventually(func(g Gomega) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				g.Expect(received).Should(HaveLen(1))
+				g.Expect(received[0].ListType).Should(Equal("blacklist"))
+				g.Expect(received[0].Group).Should(Equal("gr1"))
+				g.Expect(received[0].Error).Should(Equal("boom"))
+			}, "1s").Should(Succeed())
+		})
+	})
+
+	When("webhook target is not reachable", func() {
+		It("should not block the publisher", func() {
+			subscribe("http://127.0.0.1:1/unreachable")
+
+			start := time.Now()
+			Bus().Publish(BlockingCacheGroupRefreshFailed, ListCacheTypeWhitelist, "gr2", errors.New("boom"))
+
+			Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+		})
+	})
+})
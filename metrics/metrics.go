@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/0xERR0R/blocky/config"
 
 	"github.com/go-chi/chi/v5"
@@ -10,18 +14,45 @@ import (
 )
 
 // nolint
-var reg = prometheus.NewRegistry()
+var (
+	reg = prometheus.NewRegistry()
+
+	// registerer adds the configured prefix and static labels to the blocky metrics
+	registerer prometheus.Registerer = reg
+
+	metricNamePrefixRegex = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+	labelNameRegex        = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+)
 
 // RegisterMetric registers prometheus collector
 func RegisterMetric(c prometheus.Collector) {
-	_ = reg.Register(c)
+	_ = registerer.Register(c)
+}
+
+// ValidateConfig checks the metric name prefix and the names of the static labels
+func ValidateConfig(cfg config.PrometheusConfig) error {
+	if cfg.Prefix != "" && !metricNamePrefixRegex.MatchString(cfg.Prefix) {
+		return fmt.Errorf("invalid prometheus metric prefix '%s'", cfg.Prefix)
+	}
+
+	for name := range cfg.Labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid prometheus label name '%s'", name)
+		}
+	}
+
+	return nil
 }
 
 // Start starts prometheus endpoint
 func Start(router *chi.Mux, cfg config.PrometheusConfig) {
 	if cfg.Enable {
-		_ = reg.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
-		_ = reg.Register(collectors.NewGoCollector())
+		labeled := prometheus.WrapRegistererWith(cfg.Labels, reg)
+		registerer = prometheus.WrapRegistererWithPrefix(cfg.Prefix, labeled)
+
+		// the runtime metrics keep their standard names
+		_ = labeled.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		_ = labeled.Register(collectors.NewGoCollector())
 		router.Handle(cfg.Path, promhttp.InstrumentMetricHandler(reg,
 			promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
 	}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/0xERR0R/blocky/evt"
@@ -16,6 +17,16 @@ func RegisterEventListeners() {
 	registerBlockingEventListeners()
 	registerCachingEventListeners()
 	registerApplicationEventListeners()
+	registerHealthProbeEventListeners()
+	registerUpstreamLimitEventListeners()
+	registerUpstreamRateLimitEventListeners()
+	registerUpstreamInFlightEventListeners()
+	registerQueryLogEventListeners()
+	registerServerConnectionEventListeners()
+	registerClientACLEventListeners()
+	registerQueryNameLimitsEventListeners()
+	registerResolverPanicEventListeners()
+	registerDNSCryptEventListeners()
 }
 
 func registerApplicationEventListeners() {
@@ -38,6 +49,281 @@ func versionNumberGauge() *prometheus.GaugeVec {
 	return blacklistCnt
 }
 
+func registerHealthProbeEventListeners() {
+	successGauge := healthProbeSuccessGauge()
+	durationGauge := healthProbeDurationGauge()
+
+	RegisterMetric(successGauge)
+	RegisterMetric(durationGauge)
+
+	subscribe(evt.HealthProbeFinished, func(success bool, duration time.Duration) {
+		if success {
+			successGauge.Set(1)
+		} else {
+			successGauge.Set(0)
+		}
+
+		durationGauge.Set(float64(duration.Milliseconds()))
+	})
+}
+
+func healthProbeSuccessGauge() prometheus.Gauge {
+	return prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "blocky_health_probe_success",
+			Help: "1 if the last health probe query was successful, 0 otherwise",
+		},
+	)
+}
+
+func healthProbeDurationGauge() prometheus.Gauge {
+	return prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "blocky_health_probe_duration_ms",
+			Help: "Duration of the last health probe query in ms",
+		},
+	)
+}
+
+func registerUpstreamLimitEventListeners() {
+	queuedCount := upstreamLimitQueuedCount()
+	rejectedCount := upstreamLimitRejectedCount()
+
+	RegisterMetric(queuedCount)
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.UpstreamLimitQueued, func() {
+		queuedCount.Inc()
+	})
+
+	subscribe(evt.UpstreamLimitRejected, func() {
+		rejectedCount.Inc()
+	})
+}
+
+func upstreamLimitQueuedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_upstream_limit_queued_total",
+			Help: "Number of requests which waited for a free slot of the upstream concurrency limit",
+		},
+	)
+}
+
+func upstreamLimitRejectedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_upstream_limit_rejected_total",
+			Help: "Number of requests rejected with SERVFAIL, because the upstream concurrency limit was reached",
+		},
+	)
+}
+
+func registerUpstreamRateLimitEventListeners() {
+	queuedCount := upstreamRateLimitQueuedCount()
+	rejectedCount := upstreamRateLimitRejectedCount()
+
+	RegisterMetric(queuedCount)
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.UpstreamRateLimitQueued, func(upstream string) {
+		queuedCount.WithLabelValues(upstream).Inc()
+	})
+
+	subscribe(evt.UpstreamRateLimitRejected, func(upstream string) {
+		rejectedCount.WithLabelValues(upstream).Inc()
+	})
+}
+
+func upstreamRateLimitQueuedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_upstream_rate_limit_queued_total",
+			Help: "Number of queries which waited, because the rate limit of the upstream was reached",
+		}, []string{"upstream"},
+	)
+}
+
+func upstreamRateLimitRejectedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_upstream_rate_limit_rejected_total",
+			Help: "Number of queries which weren't sent, because the rate limit of the upstream was reached",
+		}, []string{"upstream"},
+	)
+}
+
+func registerUpstreamInFlightEventListeners() {
+	rejectedCount := upstreamInFlightRejectedCount()
+
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.UpstreamInFlightRejected, func(upstream string) {
+		rejectedCount.WithLabelValues(upstream).Inc()
+	})
+}
+
+func upstreamInFlightRejectedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_upstream_in_flight_rejected_total",
+			Help: "Number of queries which weren't sent, because the max concurrent queries to the upstream were reached",
+		}, []string{"upstream"},
+	)
+}
+
+func registerServerConnectionEventListeners() {
+	connections := serverConnectionsGauge()
+	rejectedCount := serverConnectionsRejectedCount()
+
+	RegisterMetric(connections)
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.ServerConnectionsChanged, func(server string, count int) {
+		connections.WithLabelValues(server).Set(float64(count))
+	})
+
+	subscribe(evt.ServerConnectionRejected, func(server string) {
+		rejectedCount.WithLabelValues(server).Inc()
+	})
+}
+
+func serverConnectionsGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "blocky_server_connections",
+			Help: "Number of open connections of the encrypted DNS servers",
+		}, []string{"server"},
+	)
+}
+
+func serverConnectionsRejectedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_server_connections_rejected_total",
+			Help: "Number of connections closed, because the connection limit was reached",
+		}, []string{"server"},
+	)
+}
+
+func registerClientACLEventListeners() {
+	rejectedCount := clientACLRejectedCount()
+
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.ClientACLRejected, func(_ string) {
+		rejectedCount.Inc()
+	})
+}
+
+func clientACLRejectedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_client_acl_rejected_total",
+			Help: "Number of queries refused, because the client is not allowed",
+		},
+	)
+}
+
+func registerQueryNameLimitsEventListeners() {
+	rejectedCount := queryNameLimitRejectedCount()
+
+	RegisterMetric(rejectedCount)
+
+	subscribe(evt.QueryNameLimitExceeded, func(limit string) {
+		rejectedCount.WithLabelValues(limit).Inc()
+	})
+}
+
+func queryNameLimitRejectedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_query_name_limit_rejected_total",
+			Help: "Number of queries rejected, because the question name exceeds the length or label limit",
+		}, []string{"limit"},
+	)
+}
+
+func registerResolverPanicEventListeners() {
+	panicCount := resolverPanicCount()
+
+	RegisterMetric(panicCount)
+
+	subscribe(evt.ResolverPanicRecovered, func(resolver string) {
+		panicCount.WithLabelValues(resolver).Inc()
+	})
+}
+
+func resolverPanicCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_resolver_panic_total",
+			Help: "Number of recovered panics, partitioned by resolver",
+		}, []string{"resolver"},
+	)
+}
+
+func registerDNSCryptEventListeners() {
+	handshakeGauge := dnscryptHandshakeSuccessGauge()
+
+	RegisterMetric(handshakeGauge)
+
+	subscribe(evt.DNSCryptHandshakeFinished, func(upstream string, success bool) {
+		if success {
+			handshakeGauge.WithLabelValues(upstream).Set(1)
+		} else {
+			handshakeGauge.WithLabelValues(upstream).Set(0)
+		}
+	})
+}
+
+func dnscryptHandshakeSuccessGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "blocky_dnscrypt_handshake_success",
+			Help: "1 if the last certificate fetch (handshake) of the DNSCrypt upstream was successful, 0 otherwise",
+		}, []string{"upstream"},
+	)
+}
+
+func registerQueryLogEventListeners() {
+	connectedGauge := queryLogDatabaseConnectedGauge()
+	droppedCounter := queryLogDroppedCounter()
+
+	RegisterMetric(connectedGauge)
+	RegisterMetric(droppedCounter)
+
+	subscribe(evt.QueryLogEntriesDropped, func(writer string, amount int) {
+		droppedCounter.WithLabelValues(writer).Add(float64(amount))
+	})
+
+	subscribe(evt.QueryLogDatabaseConnectionChanged, func(connected bool) {
+		if connected {
+			connectedGauge.Set(1)
+		} else {
+			connectedGauge.Set(0)
+		}
+	})
+}
+
+func queryLogDroppedCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_query_log_dropped_total",
+			Help: "Number of query log entries dropped, because the target was not available",
+		}, []string{"writer"},
+	)
+}
+
+func queryLogDatabaseConnectedGauge() prometheus.Gauge {
+	return prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "blocky_query_log_database_connected",
+			Help: "1 if the query log database is available, 0 otherwise",
+		},
+	)
+}
+
 func registerBlockingEventListeners() {
 	enabledGauge := enabledGauge()
 
@@ -51,6 +337,8 @@ func registerBlockingEventListeners() {
 		}
 	})
 
+	registerBlockingStatusEventListeners()
+
 	blacklistCnt := blacklistGauge()
 
 	whitelistCnt := whitelistGauge()
@@ -61,6 +349,30 @@ func registerBlockingEventListeners() {
 	RegisterMetric(whitelistCnt)
 	RegisterMetric(lastListGroupRefresh)
 
+	listMemory := listCacheMemoryGauge()
+
+	RegisterMetric(listMemory)
+
+	subscribe(evt.BlockingCacheGroupMemoryChanged, func(listType lists.ListCacheType, groupName string, size int) {
+		listMemory.WithLabelValues(listType.String(), groupName).Set(float64(size))
+	})
+
+	dryRunCnt := dryRunMatchCount()
+
+	RegisterMetric(dryRunCnt)
+
+	subscribe(evt.BlockingDryRunMatch, func(groupName string) {
+		dryRunCnt.WithLabelValues(groupName).Inc()
+	})
+
+	listSourceHitCnt := listSourceHitCount()
+
+	RegisterMetric(listSourceHitCnt)
+
+	subscribe(evt.BlockingListSourceHit, func(listType lists.ListCacheType, groupName string, source string) {
+		listSourceHitCnt.WithLabelValues(listType.String(), groupName, source).Inc()
+	})
+
 	subscribe(evt.BlockingCacheGroupChanged, func(listType lists.ListCacheType, groupName string, cnt int) {
 		lastListGroupRefresh.Set(float64(time.Now().Unix()))
 		switch listType {
@@ -72,6 +384,61 @@ func registerBlockingEventListeners() {
 	})
 }
 
+func registerBlockingStatusEventListeners() {
+	var (
+		lock         sync.RWMutex
+		autoEnableAt time.Time
+	)
+
+	groupEnabled := groupEnabledGauge()
+	autoEnableSeconds := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "blocky_blocking_auto_enable_seconds",
+			Help: "Remaining seconds until blocking will be enabled again, 0 if not temporarily disabled",
+		}, func() float64 {
+			lock.RLock()
+			defer lock.RUnlock()
+
+			if remaining := time.Until(autoEnableAt); remaining > 0 {
+				return remaining.Seconds()
+			}
+
+			return 0
+		})
+
+	RegisterMetric(groupEnabled)
+	RegisterMetric(autoEnableSeconds)
+
+	subscribe(evt.BlockingStatusChanged, func(groups []string, disabledGroups []string, enableAt time.Time) {
+		disabled := make(map[string]bool, len(disabledGroups))
+		for _, g := range disabledGroups {
+			disabled[g] = true
+		}
+
+		for _, g := range groups {
+			if disabled[g] {
+				groupEnabled.WithLabelValues(g).Set(0)
+			} else {
+				groupEnabled.WithLabelValues(g).Set(1)
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		autoEnableAt = enableAt
+	})
+}
+
+func groupEnabledGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "blocky_blocking_group_enabled",
+			Help: "1 if blocking is enabled for the group, 0 otherwise",
+		}, []string{"group"},
+	)
+}
+
 func enabledGauge() prometheus.Gauge {
 	enabledGauge := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "blocky_blocking_enabled",
@@ -104,6 +471,33 @@ func whitelistGauge() *prometheus.GaugeVec {
 	return whitelistCnt
 }
 
+func listCacheMemoryGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "blocky_list_cache_memory_bytes",
+			Help: "Estimated memory usage of the cached list entries in bytes",
+		}, []string{"type", "group"},
+	)
+}
+
+func dryRunMatchCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_dry_run_blocked_total",
+			Help: "Number of requests which would be blocked by a group in dry run mode",
+		}, []string{"group"},
+	)
+}
+
+func listSourceHitCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_list_source_hits_total",
+			Help: "Number of matches per list source, only counted if blocking.hitCounting is enabled",
+		}, []string{"type", "group", "source"},
+	)
+}
+
 func lastListGroupRefresh() prometheus.Gauge {
 	return prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -118,16 +512,22 @@ func registerCachingEventListeners() {
 	prefetchDomainCount := prefetchDomainCacheCount()
 	hitCount := cacheHitCount()
 	missCount := cacheMissCount()
+	staleCount := cacheStaleServedCount()
 	prefetchCount := domainPrefetchCount()
 	prefetchHitCount := domainPrefetchHitCount()
+	prefetchUsedCount := domainPrefetchUsedCount()
+	prefetchUnusedCount := domainPrefetchUnusedCount()
 	failedDownloadCount := failedDownloadCount()
 
 	RegisterMetric(entryCount)
 	RegisterMetric(prefetchDomainCount)
 	RegisterMetric(hitCount)
 	RegisterMetric(missCount)
+	RegisterMetric(staleCount)
 	RegisterMetric(prefetchCount)
 	RegisterMetric(prefetchHitCount)
+	RegisterMetric(prefetchUsedCount)
+	RegisterMetric(prefetchUnusedCount)
 	RegisterMetric(failedDownloadCount)
 
 	subscribe(evt.CachingDomainsToPrefetchCountChanged, func(cnt int) {
@@ -142,6 +542,10 @@ func registerCachingEventListeners() {
 		hitCount.Inc()
 	})
 
+	subscribe(evt.CachingStaleAnswerServed, func(_ string) {
+		staleCount.Inc()
+	})
+
 	subscribe(evt.CachingDomainPrefetched, func(_ string) {
 		prefetchCount.Inc()
 	})
@@ -150,6 +554,14 @@ func registerCachingEventListeners() {
 		prefetchHitCount.Inc()
 	})
 
+	subscribe(evt.CachingPrefetchedEntryExpired, func(_ string, used bool) {
+		if used {
+			prefetchUsedCount.Inc()
+		} else {
+			prefetchUnusedCount.Inc()
+		}
+	})
+
 	subscribe(evt.CachingResultCacheChanged, func(cnt int) {
 		entryCount.Set(float64(cnt))
 	})
@@ -184,6 +596,15 @@ func cacheMissCount() prometheus.Counter {
 	)
 }
 
+func cacheStaleServedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_cache_stale_served_count",
+			Help: "Expired answers served from cache because the upstream failed",
+		},
+	)
+}
+
 func domainPrefetchCount() prometheus.Counter {
 	return prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -211,6 +632,24 @@ func cacheEntryCount() prometheus.Gauge {
 	)
 }
 
+func domainPrefetchUsedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_prefetch_used_count",
+			Help: "Prefetched responses returned from cache at least once before expiration",
+		},
+	)
+}
+
+func domainPrefetchUnusedCount() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_prefetch_unused_count",
+			Help: "Prefetched responses expired without being returned from cache",
+		},
+	)
+}
+
 func prefetchDomainCacheCount() prometheus.Gauge {
 	return prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"testing"
+
+	. "github.com/0xERR0R/blocky/log"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetrics(t *testing.T) {
+	ConfigureLogger(LevelFatal, FormatTypeText, true)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics Suite")
+}
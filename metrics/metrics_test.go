@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/0xERR0R/blocky/config"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ = Describe("Metrics", func() {
+	var router *chi.Mux
+
+	BeforeEach(func() {
+		oldReg, oldRegisterer := reg, registerer
+		DeferCleanup(func() {
+			reg, registerer = oldReg, oldRegisterer
+		})
+
+		reg = prometheus.NewRegistry()
+		registerer = reg
+		router = chi.NewRouter()
+	})
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Code).Should(Equal(http.StatusOK))
+
+		return rec.Body.String()
+	}
+
+	Describe("Start", func() {
+		It("should apply the prefix and the static labels to the blocky metrics", func() {
+			Start(router, config.PrometheusConfig{
+				Enable: true,
+				Path:   "/metrics",
+				Prefix: "test_",
+				Labels: map[string]string{"instance": "dns1"},
+			})
+
+			gauge := healthProbeSuccessGauge()
+			RegisterMetric(gauge)
+			gauge.Set(1)
+
+			body := scrape()
+			Expect(body).Should(ContainSubstring("\ntest_blocky_health_probe_success{instance=\"dns1\"} 1\n"))
+			Expect(body).ShouldNot(ContainSubstring("\nblocky_health_probe_success"))
+		})
+
+		It("should keep the standard names of the runtime metrics", func() {
+			Start(router, config.PrometheusConfig{
+				Enable: true,
+				Path:   "/metrics",
+				Prefix: "test_",
+				Labels: map[string]string{"instance": "dns1"},
+			})
+
+			body := scrape()
+			Expect(body).Should(MatchRegexp(`\ngo_goroutines\{instance="dns1"\} \d+\n`))
+			Expect(body).ShouldNot(ContainSubstring("test_go_goroutines"))
+		})
+
+		It("should not change the metrics without prefix and labels", func() {
+			Start(router, config.PrometheusConfig{
+				Enable: true,
+				Path:   "/metrics",
+			})
+
+			gauge := healthProbeSuccessGauge()
+			RegisterMetric(gauge)
+			gauge.Set(0)
+
+			Expect(scrape()).Should(ContainSubstring("\nblocky_health_probe_success 0\n"))
+		})
+	})
+
+	Describe("ValidateConfig", func() {
+		It("should accept a valid prefix and labels", func() {
+			Expect(ValidateConfig(config.PrometheusConfig{
+				Prefix: "test_",
+				Labels: map[string]string{"instance": "dns1"},
+			})).Should(Succeed())
+		})
+		It("should reject an invalid prefix", func() {
+			Expect(ValidateConfig(config.PrometheusConfig{Prefix: "1-test"})).
+				Should(MatchError("invalid prometheus metric prefix '1-test'"))
+		})
+		It("should reject reserved label names", func() {
+			Expect(ValidateConfig(config.PrometheusConfig{Labels: map[string]string{"__name": "x"}})).
+				Should(MatchError("invalid prometheus label name '__name'"))
+		})
+	})
+})
@@ -16,6 +16,8 @@ import (
 // CONDITIONAL // the query was resolved by the conditional upstream resolver
 // CUSTOMDNS // the query was resolved by a custom rule
 // HOSTSFILE // the query was resolved by looking up the hosts file
+// SECONDARYZONE // the query was answered from a zone transferred from the primary DNS server
+// MDNS // the query was resolved with a multicast DNS query on the LAN
 // )
 type ResponseType int
 
@@ -24,6 +26,12 @@ type Response struct {
 	Res    *dns.Msg
 	Reason string
 	RType  ResponseType
+	// UpstreamRcode raw response code of the upstream server, nil if the response wasn't resolved by an upstream
+	UpstreamRcode *int
+	// Stale is set if the answer was served from an expired cache entry (serve-stale)
+	Stale bool
+	// Authenticated is set if the upstream validated the answer (AD bit), independent of the client's flags
+	Authenticated bool
 }
 
 // RequestProtocol represents the server protocol ENUM(
@@ -41,4 +49,19 @@ type Request struct {
 	Req             *dns.Msg
 	Log             *logrus.Entry
 	RequestTS       time.Time
+	Timings         *ResolverTimings
+}
+
+// ResolverTiming contains the time spent in one resolver of the chain
+type ResolverTiming struct {
+	Resolver string
+	// Duration time spent in the resolver without the next resolvers
+	Duration time.Duration
+	// Total time spent in the resolver including the next resolvers
+	Total time.Duration
+}
+
+// ResolverTimings collects the time spent in each resolver of the chain. Only requests with timings are measured
+type ResolverTimings struct {
+	Entries []ResolverTiming
 }
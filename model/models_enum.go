@@ -95,9 +95,15 @@ const (
 	// ResponseTypeHOSTSFILE is a ResponseType of type HOSTSFILE.
 	// the query was resolved by looking up the hosts file
 	ResponseTypeHOSTSFILE
+	// ResponseTypeSECONDARYZONE is a ResponseType of type SECONDARYZONE.
+	// the query was answered from a zone transferred from the primary DNS server
+	ResponseTypeSECONDARYZONE
+	// ResponseTypeMDNS is a ResponseType of type MDNS.
+	// the query was resolved with a multicast DNS query on the LAN
+	ResponseTypeMDNS
 )
 
-const _ResponseTypeName = "RESOLVEDCACHEDBLOCKEDCONDITIONALCUSTOMDNSHOSTSFILE"
+const _ResponseTypeName = "RESOLVEDCACHEDBLOCKEDCONDITIONALCUSTOMDNSHOSTSFILESECONDARYZONEMDNS"
 
 var _ResponseTypeNames = []string{
 	_ResponseTypeName[0:8],
@@ -106,6 +112,8 @@ var _ResponseTypeNames = []string{
 	_ResponseTypeName[21:32],
 	_ResponseTypeName[32:41],
 	_ResponseTypeName[41:50],
+	_ResponseTypeName[50:63],
+	_ResponseTypeName[63:67],
 }
 
 // ResponseTypeNames returns a list of possible string values of ResponseType.
@@ -122,6 +130,8 @@ var _ResponseTypeMap = map[ResponseType]string{
 	3: _ResponseTypeName[21:32],
 	4: _ResponseTypeName[32:41],
 	5: _ResponseTypeName[41:50],
+	6: _ResponseTypeName[50:63],
+	7: _ResponseTypeName[63:67],
 }
 
 // String implements the Stringer interface.
@@ -139,6 +149,8 @@ var _ResponseTypeValue = map[string]ResponseType{
 	_ResponseTypeName[21:32]: 3,
 	_ResponseTypeName[32:41]: 4,
 	_ResponseTypeName[41:50]: 5,
+	_ResponseTypeName[50:63]: 6,
+	_ResponseTypeName[63:67]: 7,
 }
 
 // ParseResponseType attempts to convert a string to a ResponseType
@@ -0,0 +1,97 @@
+package querylog
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DatabaseReader reads the entries written by DatabaseWriter
+type DatabaseReader struct {
+	db *gorm.DB
+}
+
+// NewDatabaseReader creates a new reader for the database of the passed type (mysql or postgresql)
+func NewDatabaseReader(dbType string, target string) (*DatabaseReader, error) {
+	switch dbType {
+	case "mysql":
+		return newDatabaseReader(mysql.Open(target))
+	case "postgresql":
+		return newDatabaseReader(postgres.Open(target))
+	}
+
+	return nil, fmt.Errorf("incorrect database type provided: %s", dbType)
+}
+
+func newDatabaseReader(target gorm.Dialector) (*DatabaseReader, error) {
+	db, err := gorm.Open(target, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create database connection: %w", err)
+	}
+
+	return &DatabaseReader{db: db}, nil
+}
+
+// Last returns max. limit newest records (all records if limit is 0)
+func (d *DatabaseReader) Last(filter Filter, limit int) ([]*Record, error) {
+	query := d.db.Model(&logEntry{}).Order("request_ts desc")
+
+	if filter.Client != "" {
+		client := likePattern(filter.Client)
+		query = query.Where("LOWER(client_name) LIKE ? OR LOWER(client_ip) LIKE ?", client, client)
+	}
+
+	if filter.Domain != "" {
+		query = query.Where("LOWER(question_name) LIKE ?", likePattern(filter.Domain))
+	}
+
+	if filter.Reason != "" {
+		query = query.Where("LOWER(reason) LIKE ?", likePattern(filter.Reason))
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var entries []logEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("can't read query log entries: %w", err)
+	}
+
+	records := make([]*Record, len(entries))
+
+	// entries are ordered descending, records chronologically
+	for i := range entries {
+		records[len(entries)-1-i] = databaseEntryToRecord(&entries[i])
+	}
+
+	return records, nil
+}
+
+func likePattern(s string) string {
+	return "%" + strings.ToLower(s) + "%"
+}
+
+func databaseEntryToRecord(e *logEntry) *Record {
+	var ts string
+	if e.RequestTS != nil {
+		ts = e.RequestTS.Local().Format("2006-01-02 15:04:05")
+	}
+
+	return &Record{
+		Time:         ts,
+		ClientIP:     e.ClientIP,
+		ClientName:   e.ClientName,
+		DurationMs:   fmt.Sprintf("%d", e.DurationMs),
+		Reason:       e.Reason,
+		Question:     fmt.Sprintf("%s (%s)", e.QuestionType, e.QuestionName),
+		Answer:       e.Answer,
+		ResponseCode: e.ResponseCode,
+	}
+}
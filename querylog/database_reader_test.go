@@ -0,0 +1,89 @@
+package querylog
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatabaseReader", func() {
+	var reader *DatabaseReader
+
+	BeforeEach(func() {
+		writer, err := newDatabaseWriter(sqlite.Open("file:database_reader?mode=memory&cache=shared"), 7,
+			time.Millisecond)
+		Expect(err).Should(Succeed())
+
+		DeferCleanup(func() {
+			writer.db.Where("1 = 1").Delete(&logEntry{})
+		})
+
+		write := func(client, question, reason string, start time.Time) {
+			res, err := util.NewMsgWithAnswer(question, 123, dns.TypeA, "123.124.122.122")
+			Expect(err).Should(Succeed())
+
+			writer.Write(&LogEntry{
+				Request: &model.Request{
+					ClientNames: []string{client},
+					Req:         util.NewMsgWithQuestion(question, dns.TypeA),
+					Log:         logrus.NewEntry(logrus.New()),
+				},
+				Response:   &model.Response{Res: res, Reason: reason, RType: model.ResponseTypeRESOLVED},
+				Start:      start,
+				DurationMs: 20,
+			})
+		}
+
+		now := time.Now()
+		write("client1", "google.de.", "Resolved", now.Add(-3*time.Second))
+		write("client2", "doubleclick.net.", "BLOCKED (ads)", now.Add(-2*time.Second))
+		write("client1", "heise.de.", "CACHED", now.Add(-time.Second))
+
+		Eventually(func() (res int64) {
+			writer.db.Model(&logEntry{}).Count(&res)
+
+			return res
+		}, "1s").Should(BeNumerically("==", 3))
+
+		reader, err = newDatabaseReader(sqlite.Open("file:database_reader?mode=memory&cache=shared"))
+		Expect(err).Should(Succeed())
+	})
+
+	When("incorrect database type is passed", func() {
+		It("should return error", func() {
+			_, err := NewDatabaseReader("wrong", "")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	It("should return the newest entries in chronological order", func() {
+		records, err := reader.Last(Filter{}, 2)
+		Expect(err).Should(Succeed())
+		Expect(records).Should(HaveLen(2))
+		Expect(records[0].Question).Should(Equal("A (doubleclick.net)"))
+		Expect(records[0].ClientName).Should(Equal("client2"))
+		Expect(records[0].Reason).Should(Equal("BLOCKED (ads)"))
+		Expect(records[1].Question).Should(Equal("A (heise.de)"))
+		Expect(records[1].DurationMs).Should(Equal("20"))
+	})
+
+	It("should return only entries matching the filter", func() {
+		records, err := reader.Last(Filter{Client: "CLIENT1", Domain: ".de"}, 0)
+		Expect(err).Should(Succeed())
+		Expect(records).Should(HaveLen(2))
+		Expect(records[0].Question).Should(Equal("A (google.de)"))
+		Expect(records[1].Question).Should(Equal("A (heise.de)"))
+
+		records, err = reader.Last(Filter{Reason: "blocked"}, 0)
+		Expect(err).Should(Succeed())
+		Expect(records).Should(HaveLen(1))
+		Expect(records[0].Question).Should(Equal("A (doubleclick.net)"))
+	})
+})
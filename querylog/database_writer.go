@@ -8,6 +8,7 @@ import (
 
 	"gorm.io/gorm/logger"
 
+	"github.com/0xERR0R/blocky/evt"
 	"github.com/0xERR0R/blocky/log"
 
 	"github.com/0xERR0R/blocky/util"
@@ -18,6 +19,22 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	databaseWriterLogger = "database_writer"
+
+	// max amount of entries, which are kept in memory while the database is not available
+	dbMaxPendingEntries = 10000
+
+	// max amount of entries per INSERT statement, the databases limit the bind parameters per statement (65535)
+	dbWriteBatchSize = 1000
+
+	// max time between two attempts to write to the database after failures
+	dbMaxRetryPeriod = 5 * time.Minute
+
+	// amount of consecutive failed attempts, after which new entries are written to the console
+	dbFallbackAttempts = 5
+)
+
 type logEntry struct {
 	RequestTS     *time.Time `gorm:"index"`
 	ClientIP      string
@@ -38,6 +55,14 @@ type DatabaseWriter struct {
 	pendingEntries   []*logEntry
 	lock             sync.RWMutex
 	dbFlushPeriod    time.Duration
+	// amount of consecutive failed attempts to write to the database
+	failures    uint
+	nextAttempt time.Time
+	// console writer for new entries after sustained failures, until the pending entries could be written
+	fallback       Writer
+	fallbackActive bool
+	// amount of entries dropped since the last successful write
+	dropped int
 }
 
 func NewDatabaseWriter(dbType string, target string, logRetentionDays uint64,
@@ -77,7 +102,10 @@ func newDatabaseWriter(target gorm.Dialector, logRetentionDays uint64,
 	w := &DatabaseWriter{
 		db:               db,
 		logRetentionDays: logRetentionDays,
-		dbFlushPeriod:    dbFlushPeriod}
+		dbFlushPeriod:    dbFlushPeriod,
+		fallback:         NewLoggerWriter()}
+
+	evt.Bus().Publish(evt.QueryLogDatabaseConnectionChanged, true)
 
 	go w.periodicFlush()
 
@@ -115,13 +143,34 @@ func (d *DatabaseWriter) Write(entry *LogEntry) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	if d.fallbackActive {
+		d.fallback.Write(entry)
+
+		return
+	}
+
 	d.pendingEntries = append(d.pendingEntries, e)
+
+	if len(d.pendingEntries) > dbMaxPendingEntries {
+		// drop the oldest entries
+		dropped := len(d.pendingEntries) - dbMaxPendingEntries
+		d.pendingEntries = d.pendingEntries[dropped:]
+
+		if d.dropped == 0 {
+			log.PrefixedLog(databaseWriterLogger).Warnf("more than %d pending entries, dropping the oldest entries",
+				dbMaxPendingEntries)
+		}
+
+		d.dropped += dropped
+
+		evt.Bus().Publish(evt.QueryLogEntriesDropped, "database", dropped)
+	}
 }
 
 func (d *DatabaseWriter) CleanUp() {
 	deletionDate := time.Now().AddDate(0, 0, int(-d.logRetentionDays))
 
-	log.PrefixedLog("database_writer").Debugf("deleting log entries with request_ts < %s", deletionDate)
+	log.PrefixedLog(databaseWriterLogger).Debugf("deleting log entries with request_ts < %s", deletionDate)
 	d.db.Where("request_ts < ?", deletionDate).Delete(&logEntry{})
 }
 
@@ -129,12 +178,66 @@ func (d *DatabaseWriter) doDBWrite() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	if len(d.pendingEntries) > 0 {
-		log.Log().Tracef("%d entries to write", len(d.pendingEntries))
+	if len(d.pendingEntries) == 0 || (d.failures > 0 && time.Now().Before(d.nextAttempt)) {
+		return
+	}
+
+	log.Log().Tracef("%d entries to write", len(d.pendingEntries))
+
+	// write bulk in one transaction
+	if err := d.db.CreateInBatches(d.pendingEntries, dbWriteBatchSize).Error; err != nil {
+		d.onWriteError(err)
+
+		return
+	}
+
+	// clear the slice with pending entries
+	d.pendingEntries = nil
+
+	if d.dropped > 0 {
+		log.PrefixedLog(databaseWriterLogger).Warnf("%d entries were dropped while the database was not available",
+			d.dropped)
+
+		d.dropped = 0
+	}
+
+	if d.failures > 0 {
+		log.PrefixedLog(databaseWriterLogger).Infof("database is available again after %d failed attempts", d.failures)
+
+		d.failures = 0
+		d.fallbackActive = false
+
+		evt.Bus().Publish(evt.QueryLogDatabaseConnectionChanged, true)
+	}
+}
+
+// onWriteError keeps the pending entries and schedules the next attempt with exponential backoff,
+// must be called with acquired lock
+func (d *DatabaseWriter) onWriteError(err error) {
+	logger := log.PrefixedLog(databaseWriterLogger)
+
+	d.failures++
+
+	if d.failures == 1 {
+		logger.Warn("can't write to database, keeping entries until database is available: ", err)
+
+		evt.Bus().Publish(evt.QueryLogDatabaseConnectionChanged, false)
+	}
+
+	retryPeriod := d.dbFlushPeriod
+	for i := uint(1); i < d.failures && retryPeriod < dbMaxRetryPeriod; i++ {
+		retryPeriod *= 2
+	}
+
+	if retryPeriod > dbMaxRetryPeriod {
+		retryPeriod = dbMaxRetryPeriod
+	}
+
+	d.nextAttempt = time.Now().Add(retryPeriod)
+
+	if d.failures >= dbFallbackAttempts && !d.fallbackActive {
+		logger.Errorf("can't write to database after %d attempts, using console as fallback: %v", d.failures, err)
 
-		// write bulk
-		d.db.Create(d.pendingEntries)
-		// clear the slice with pending entries
-		d.pendingEntries = nil
+		d.fallbackActive = true
 	}
 }
@@ -3,6 +3,7 @@ package querylog
 import (
 	"time"
 
+	. "github.com/0xERR0R/blocky/evt"
 	"github.com/0xERR0R/blocky/model"
 	"github.com/0xERR0R/blocky/util"
 	"github.com/miekg/dns"
@@ -106,6 +107,115 @@ var _ = Describe("DatabaseWriter", func() {
 			})
 		})
 
+		When("database is not available at runtime", func() {
+			var (
+				writer *DatabaseWriter
+				entry  *LogEntry
+			)
+
+			BeforeEach(func() {
+				var err error
+				writer, err = newDatabaseWriter(sqlite.Open("file:runtime_failure?mode=memory&cache=shared"), 7,
+					10*time.Millisecond)
+				Expect(err).Should(Succeed())
+
+				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+				Expect(err).Should(Succeed())
+
+				entry = &LogEntry{
+					Request: &model.Request{
+						Req: util.NewMsgWithQuestion("google.de.", dns.TypeA),
+						Log: logrus.NewEntry(logrus.New()),
+					},
+					Response:   &model.Response{Res: res, Reason: "Resolved", RType: model.ResponseTypeRESOLVED},
+					Start:      time.Now(),
+					DurationMs: 20,
+				}
+			})
+
+			pendingCount := func() int {
+				writer.lock.RLock()
+				defer writer.lock.RUnlock()
+
+				return len(writer.pendingEntries)
+			}
+
+			isFallbackActive := func() bool {
+				writer.lock.RLock()
+				defer writer.lock.RUnlock()
+
+				return writer.fallbackActive
+			}
+
+			It("should keep the entries and write them after the database is available again", func() {
+				connected := make(chan bool, 10)
+				handler := func(c bool) { connected <- c }
+				Expect(Bus().Subscribe(QueryLogDatabaseConnectionChanged, handler)).Should(Succeed())
+				DeferCleanup(func() {
+					Expect(Bus().Unsubscribe(QueryLogDatabaseConnectionChanged, handler)).Should(Succeed())
+				})
+
+				Expect(writer.db.Migrator().DropTable(&logEntry{})).Should(Succeed())
+
+				writer.Write(entry)
+
+				Eventually(connected, "1s").Should(Receive(BeFalse()))
+				Expect(pendingCount()).Should(Equal(1))
+
+				Expect(writer.db.AutoMigrate(&logEntry{})).Should(Succeed())
+
+				Eventually(connected, "1s").Should(Receive(BeTrue()))
+				Expect(pendingCount()).Should(BeZero())
+
+				var res int64
+				writer.db.Find(&logEntry{}).Count(&res)
+				Expect(res).Should(BeNumerically("==", 1))
+			})
+
+			It("should drop the oldest entries and write the pending entries in batches", func() {
+				var dropped int
+				handler := func(writer string, amount int) {
+					Expect(writer).Should(Equal("database"))
+					dropped += amount
+				}
+				Expect(Bus().Subscribe(QueryLogEntriesDropped, handler)).Should(Succeed())
+				DeferCleanup(func() {
+					Expect(Bus().Unsubscribe(QueryLogEntriesDropped, handler)).Should(Succeed())
+				})
+
+				Expect(writer.db.Migrator().DropTable(&logEntry{})).Should(Succeed())
+
+				for i := 0; i < dbMaxPendingEntries+5; i++ {
+					writer.Write(entry)
+				}
+
+				Expect(pendingCount()).Should(Equal(dbMaxPendingEntries))
+				Expect(dropped).Should(Equal(5))
+
+				Expect(writer.db.AutoMigrate(&logEntry{})).Should(Succeed())
+
+				Eventually(pendingCount, "2s").Should(BeZero())
+
+				var res int64
+				writer.db.Find(&logEntry{}).Count(&res)
+				Expect(res).Should(BeNumerically("==", dbMaxPendingEntries))
+			})
+
+			It("should use console as fallback after sustained failures", func() {
+				db, err := writer.db.DB()
+				Expect(err).Should(Succeed())
+				Expect(db.Close()).Should(Succeed())
+
+				writer.Write(entry)
+
+				Eventually(isFallbackActive, "2s").Should(BeTrue())
+
+				// new entries are not kept in memory
+				writer.Write(entry)
+				Expect(pendingCount()).Should(Equal(1))
+			})
+		})
+
 		When("mysql connection parameters wrong", func() {
 			It("should be log with fatal", func() {
 				_, err := NewDatabaseWriter("mysql", "wrong param", 7, 1)
@@ -0,0 +1,244 @@
+package querylog
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	loggerPrefixDnstapWriter = "dnstapQueryLogWriter"
+	dnstapIdentity           = "blocky"
+	dnstapRetryInterval      = 5 * time.Second
+	dnstapFlushTimeout       = time.Second
+	// max time to flush the pending messages on close, the output retries forever if the receiver is not available
+	dnstapCloseTimeout = 5 * time.Second
+)
+
+// DnstapWriter sends client queries and responses as DNSTAP messages over a frame stream socket. The messages are
+// dropped if the output buffer is full (e.g. the receiver is not available), so a slow receiver doesn't block
+// the query logging
+type DnstapWriter struct {
+	output *dnstap.FrameStreamSockOutput
+	logger *logrus.Entry
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewDnstapWriter creates a new writer instance. Target is either a unix socket (unix:///path/to/socket)
+// or a TCP address (tcp://host:port)
+func NewDnstapWriter(target string) (*DnstapWriter, error) {
+	return newDnstapWriter(target, dnstapRetryInterval)
+}
+
+func newDnstapWriter(target string, retryInterval time.Duration) (*DnstapWriter, error) {
+	addr, err := parseDnstapTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.PrefixedLog(loggerPrefixDnstapWriter).WithField("target", target)
+
+	output, err := dnstap.NewFrameStreamSockOutput(addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't create dnstap output: %w", err)
+	}
+
+	output.SetRetryInterval(retryInterval)
+	output.SetFlushTimeout(dnstapFlushTimeout)
+	output.SetLogger(logger)
+
+	go output.RunOutputLoop()
+
+	return &DnstapWriter{
+		output: output,
+		logger: logger,
+	}, nil
+}
+
+func parseDnstapTarget(target string) (net.Addr, error) {
+	switch {
+	case strings.HasPrefix(target, "unix://"):
+		return &net.UnixAddr{Name: strings.TrimPrefix(target, "unix://"), Net: "unix"}, nil
+	case strings.HasPrefix(target, "/"):
+		return &net.UnixAddr{Name: target, Net: "unix"}, nil
+	case strings.HasPrefix(target, "tcp://"):
+		target = strings.TrimPrefix(target, "tcp://")
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", target)
+	if err != nil {
+		return nil, fmt.Errorf("wrong dnstap target '%s', use unix:///path/to/socket or tcp://host:port: %w", target, err)
+	}
+
+	return addr, nil
+}
+
+func (d *DnstapWriter) Write(entry *LogEntry) {
+	queryMsg, err := entry.Request.Req.Pack()
+	if err != nil {
+		util.LogOnErrorWithEntry(d.logger, "can't pack query message: ", err)
+
+		return
+	}
+
+	responseMsg, err := entry.Response.Res.Pack()
+	if err != nil {
+		util.LogOnErrorWithEntry(d.logger, "can't pack response message: ", err)
+
+		return
+	}
+
+	responseTime := entry.Start.Add(time.Duration(entry.DurationMs) * time.Millisecond)
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	if d.closed {
+		return
+	}
+
+	querySent := d.send(createDnstapMessage(dnstap.Message_CLIENT_QUERY, entry.Request, entry.Start, queryMsg, nil))
+	responseSent := d.send(createDnstapMessage(dnstap.Message_CLIENT_RESPONSE, entry.Request, entry.Start, queryMsg,
+		&dnstapResponse{msg: responseMsg, ts: responseTime}))
+
+	if !querySent || !responseSent {
+		d.logger.Debug("dnstap output buffer is full, dropping the message")
+
+		evt.Bus().Publish(evt.QueryLogEntriesDropped, "dnstap", 1)
+	}
+}
+
+type dnstapResponse struct {
+	msg []byte
+	ts  time.Time
+}
+
+func createDnstapMessage(t dnstap.Message_Type, request *model.Request, queryTime time.Time,
+	queryMsg []byte, response *dnstapResponse) *dnstap.Message {
+	family := dnstap.SocketFamily_INET
+	queryAddress := request.ClientIP.To4()
+
+	if queryAddress == nil {
+		family = dnstap.SocketFamily_INET6
+		queryAddress = request.ClientIP.To16()
+	}
+
+	protocol := dnstap.SocketProtocol_UDP
+	if request.Protocol == model.RequestProtocolTCP {
+		protocol = dnstap.SocketProtocol_TCP
+	}
+
+	qTimeSec := uint64(queryTime.Unix())
+	qTimeNsec := uint32(queryTime.Nanosecond())
+
+	msg := &dnstap.Message{
+		Type:           &t,
+		SocketFamily:   &family,
+		SocketProtocol: &protocol,
+		QueryAddress:   queryAddress,
+		QueryTimeSec:   &qTimeSec,
+		QueryTimeNsec:  &qTimeNsec,
+	}
+
+	if len(request.Req.Question) > 0 {
+		zone, err := packDomainName(request.Req.Question[0].Name)
+		if err == nil {
+			msg.QueryZone = zone
+		}
+	}
+
+	if response == nil {
+		msg.QueryMessage = queryMsg
+	} else {
+		rTimeSec := uint64(response.ts.Unix())
+		rTimeNsec := uint32(response.ts.Nanosecond())
+		msg.ResponseMessage = response.msg
+		msg.ResponseTimeSec = &rTimeSec
+		msg.ResponseTimeNsec = &rTimeNsec
+	}
+
+	return msg
+}
+
+func packDomainName(name string) ([]byte, error) {
+	buf := make([]byte, len(name)+2)
+
+	n, err := dns.PackDomainName(dns.Fqdn(name), buf, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// send passes the message to the output without waiting, returns false if the output buffer is full
+func (d *DnstapWriter) send(msg *dnstap.Message) bool {
+	dnstapType := dnstap.Dnstap_MESSAGE
+	identity := []byte(dnstapIdentity)
+	version := []byte(util.Version)
+
+	b, err := proto.Marshal(&dnstap.Dnstap{
+		Type:     &dnstapType,
+		Identity: identity,
+		Version:  version,
+		Message:  msg,
+	})
+	if err != nil {
+		util.LogOnErrorWithEntry(d.logger, "can't marshal dnstap message: ", err)
+
+		return true
+	}
+
+	select {
+	case d.output.GetOutputChannel() <- b:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *DnstapWriter) CleanUp() {
+	// Nothing to do, the messages are not stored
+}
+
+// Close flushes the pending messages and closes the connection. Waits up to the close timeout, if the receiver
+// is not available
+func (d *DnstapWriter) Close() error {
+	d.lock.Lock()
+
+	if d.closed {
+		d.lock.Unlock()
+
+		return nil
+	}
+
+	d.closed = true
+	d.lock.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		d.output.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(dnstapCloseTimeout):
+		return fmt.Errorf("can't flush the dnstap messages within %s", dnstapCloseTimeout)
+	}
+}
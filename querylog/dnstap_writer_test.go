@@ -0,0 +1,181 @@
+package querylog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+)
+
+var _ = Describe("DnstapWriter", func() {
+	Describe("dnstap query log", func() {
+		var (
+			tmpDir string
+			frames chan []byte
+		)
+
+		newEntry := func() *LogEntry {
+			res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+			Expect(err).Should(Succeed())
+
+			return &LogEntry{
+				Request: &model.Request{
+					ClientIP: net.ParseIP("192.168.178.25"),
+					Protocol: model.RequestProtocolUDP,
+					Req:      util.NewMsgWithQuestion("example.com.", dns.TypeA),
+					Log:      logrus.NewEntry(logrus.New()),
+				},
+				Response:   &model.Response{Res: res, Reason: "Resolved", RType: model.ResponseTypeRESOLVED},
+				Start:      time.Now(),
+				DurationMs: 20,
+			}
+		}
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "dnstap")
+			Expect(err).Should(Succeed())
+
+			frames = make(chan []byte, 10)
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		When("New log entry was created", func() {
+			It("should send client query and client response over unix socket", func() {
+				socketPath := filepath.Join(tmpDir, "dnstap.sock")
+				input, err := dnstap.NewFrameStreamSockInputFromPath(socketPath)
+				Expect(err).Should(Succeed())
+
+				go input.ReadInto(frames)
+
+				writer, err := NewDnstapWriter("unix://" + socketPath)
+				Expect(err).Should(Succeed())
+				DeferCleanup(writer.Close)
+
+				writer.Write(newEntry())
+
+				readMessage := func() *dnstap.Message {
+					var frame []byte
+					Eventually(frames, "5s").Should(Receive(&frame))
+
+					dt := &dnstap.Dnstap{}
+					Expect(proto.Unmarshal(frame, dt)).Should(Succeed())
+					Expect(string(dt.Identity)).Should(Equal("blocky"))
+
+					return dt.Message
+				}
+
+				query := readMessage()
+				Expect(query.GetType()).Should(Equal(dnstap.Message_CLIENT_QUERY))
+				Expect(query.GetSocketFamily()).Should(Equal(dnstap.SocketFamily_INET))
+				Expect(query.GetSocketProtocol()).Should(Equal(dnstap.SocketProtocol_UDP))
+				Expect(net.IP(query.QueryAddress).String()).Should(Equal("192.168.178.25"))
+
+				queryMsg := new(dns.Msg)
+				Expect(queryMsg.Unpack(query.QueryMessage)).Should(Succeed())
+				Expect(queryMsg.Question[0].Name).Should(Equal("example.com."))
+
+				response := readMessage()
+				Expect(response.GetType()).Should(Equal(dnstap.Message_CLIENT_RESPONSE))
+
+				responseMsg := new(dns.Msg)
+				Expect(responseMsg.Unpack(response.ResponseMessage)).Should(Succeed())
+				Expect(responseMsg.Answer).Should(HaveLen(1))
+			})
+		})
+
+		When("target is not valid", func() {
+			It("should return error", func() {
+				_, err := NewDnstapWriter("tcp://wrong:host:port")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+
+		When("the receiver doesn't read the messages", func() {
+			It("should drop the messages without blocking and flush the pending messages on close", func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).Should(Succeed())
+				DeferCleanup(listener.Close)
+
+				// the receiver accepts the connection, but doesn't answer the handshake
+				stalled := make(chan net.Conn, 1)
+				go func() {
+					conn, err := listener.Accept()
+					if err == nil {
+						stalled <- conn
+					}
+				}()
+
+				var dropped int
+				handler := func(writer string, amount int) {
+					Expect(writer).Should(Equal("dnstap"))
+					dropped += amount
+				}
+				Expect(Bus().Subscribe(QueryLogEntriesDropped, handler)).Should(Succeed())
+				DeferCleanup(func() {
+					Expect(Bus().Unsubscribe(QueryLogEntriesDropped, handler)).Should(Succeed())
+				})
+
+				writer, err := newDnstapWriter("tcp://"+listener.Addr().String(), 10*time.Millisecond)
+				Expect(err).Should(Succeed())
+
+				for i := 0; i < 50; i++ {
+					writer.Write(newEntry())
+				}
+
+				Expect(dropped).Should(BeNumerically(">", 0))
+
+				var conn net.Conn
+				Eventually(stalled, "1s").Should(Receive(&conn))
+				DeferCleanup(conn.Close)
+
+				// the receiver continues with the handshake and reads the pending messages
+				reader, err := dnstap.NewReader(conn, &dnstap.ReaderOptions{Bidirectional: true})
+				Expect(err).Should(Succeed())
+
+				frames = make(chan []byte, 100)
+				go func() {
+					buf := make([]byte, dns.MaxMsgSize)
+					for {
+						n, err := reader.ReadFrame(buf)
+						if err != nil {
+							return
+						}
+						frames <- append([]byte{}, buf[:n]...)
+					}
+				}()
+
+				Expect(writer.Close()).Should(Succeed())
+				Eventually(frames).ShouldNot(BeEmpty())
+
+				// entries after close are ignored
+				writer.Write(newEntry())
+				Expect(writer.Close()).Should(Succeed())
+			})
+		})
+
+		When("Cleanup is called", func() {
+			It("should do nothing", func() {
+				writer, err := NewDnstapWriter("unix://" + filepath.Join(tmpDir, "dnstap.sock"))
+				Expect(err).Should(Succeed())
+				writer.CleanUp()
+			})
+		})
+	})
+})
@@ -0,0 +1,298 @@
+package querylog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+)
+
+// period between two checks for new entries while following the log files
+const followPeriod = 500 * time.Millisecond
+
+// CSVReader reads the log files written by FileWriter
+type CSVReader struct {
+	target string
+	fields []config.QueryLogField
+}
+
+// NewCSVReader creates a new reader for the log files in the target directory. The fields must have the same order
+// as the configured CSV fields, all fields are expected in default order if no fields are passed
+func NewCSVReader(target string, fields []config.QueryLogField) (*CSVReader, error) {
+	if _, err := os.Stat(target); err != nil {
+		return nil, fmt.Errorf("can't read query log directory '%s': %w", target, err)
+	}
+
+	if len(fields) == 0 {
+		fields = defaultQueryLogFields()
+	}
+
+	return &CSVReader{
+		target: target,
+		fields: fields,
+	}, nil
+}
+
+// Last returns max. limit newest records (all records if limit is 0). The log files are read day by day,
+// starting with the newest day
+func (r *CSVReader) Last(filter Filter, limit int) ([]*Record, error) {
+	filesPerDay, err := r.logFilesPerDay()
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]string, 0, len(filesPerDay))
+	for day := range filesPerDay {
+		days = append(days, day)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+
+	var result []*Record
+
+	for _, day := range days {
+		var records []*Record
+
+		for _, file := range filesPerDay[day] {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("can't read query log file '%s': %w", file, err)
+			}
+
+			records = append(records, r.parse(content, filter)...)
+		}
+
+		// entries of per client files are interleaved
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Time < records[j].Time
+		})
+
+		result = append(records, result...)
+
+		if limit > 0 && len(result) >= limit {
+			return result[len(result)-limit:], nil
+		}
+	}
+
+	return result, nil
+}
+
+// Follow calls fn for each new record matching the filter, which is written to the log files, until stop is closed
+func (r *CSVReader) Follow(filter Filter, stop <-chan struct{}, fn func(*Record)) error {
+	offsets := make(map[string]int64)
+
+	files, err := r.logFiles()
+	if err != nil {
+		return err
+	}
+
+	// only entries written after the start are relevant
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			offsets[file] = info.Size()
+		}
+	}
+
+	ticker := time.NewTicker(followPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := r.readNewRecords(offsets, filter, fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *CSVReader) readNewRecords(offsets map[string]int64, filter Filter, fn func(*Record)) error {
+	files, err := r.logFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		offset, known := offsets[file]
+
+		if !known && rotationIndex(file) != math.MaxInt32 {
+			// the entries of a newly rotated file were already read from the current file
+			if info, err := os.Stat(file); err == nil {
+				offsets[file] = info.Size()
+			}
+
+			continue
+		}
+
+		content, err := readFrom(file, &offset)
+		if err != nil {
+			return fmt.Errorf("can't read query log file '%s': %w", file, err)
+		}
+
+		offsets[file] = offset
+
+		for _, record := range r.parse(content, filter) {
+			fn(record)
+		}
+	}
+
+	return nil
+}
+
+// readFrom returns all complete lines of the file after the offset and moves the offset behind the last line.
+// The file is read from the beginning if it is smaller than the offset (e.g. after rotation)
+func readFrom(file string, offset *int64) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() < *offset {
+		*offset = 0
+	}
+
+	if info.Size() == *offset {
+		return nil, nil
+	}
+
+	if _, err := f.Seek(*offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// an incomplete line is read with the next call
+	content = content[:bytes.LastIndexByte(content, '\n')+1]
+	*offset += int64(len(content))
+
+	return content, nil
+}
+
+func (r *CSVReader) parse(content []byte, filter Filter) (records []*Record) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, _ := reader.ReadAll()
+
+	for _, row := range rows {
+		record := r.toRecord(row)
+
+		if filter.Matches(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+func (r *CSVReader) toRecord(row []string) *Record {
+	record := &Record{}
+
+	for i, field := range r.fields {
+		if i >= len(row) {
+			break
+		}
+
+		switch field {
+		case config.QueryLogFieldTime:
+			record.Time = row[i]
+		case config.QueryLogFieldClientIP:
+			record.ClientIP = row[i]
+		case config.QueryLogFieldClientName:
+			record.ClientName = row[i]
+		case config.QueryLogFieldDuration:
+			record.DurationMs = row[i]
+		case config.QueryLogFieldReason:
+			record.Reason = row[i]
+		case config.QueryLogFieldQuestion:
+			record.Question = row[i]
+		case config.QueryLogFieldAnswer:
+			record.Answer = row[i]
+		case config.QueryLogFieldResponseCode:
+			record.ResponseCode = row[i]
+		}
+	}
+
+	return record
+}
+
+// logFilesPerDay returns the log files grouped by the date in the file name
+func (r *CSVReader) logFilesPerDay() (map[string][]string, error) {
+	files, err := r.logFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string)
+
+	for _, file := range files {
+		day := filepath.Base(file)[:10]
+		result[day] = append(result[day], file)
+	}
+
+	return result, nil
+}
+
+// logFiles returns the log files, which names start with a date. Rotated files (e.g. 2022-01-02_ALL.1.log)
+// are returned before the current file of the same day
+func (r *CSVReader) logFiles() ([]string, error) {
+	infos, err := ioutil.ReadDir(r.target)
+	if err != nil {
+		return nil, fmt.Errorf("can't list query log directory '%s': %w", r.target, err)
+	}
+
+	var files []string
+
+	for _, info := range infos {
+		name := info.Name()
+
+		if info.IsDir() || !strings.HasSuffix(name, ".log") || len(name) <= 10 {
+			continue
+		}
+
+		if _, err := time.Parse("2006-01-02", name[:10]); err == nil {
+			files = append(files, filepath.Join(r.target, name))
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return rotationIndex(files[i]) < rotationIndex(files[j])
+	})
+
+	return files, nil
+}
+
+// rotationIndex returns the index of a rotated file, the current file has the highest index
+func rotationIndex(file string) int {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(file), ".log"), ".")
+	if len(parts) > 1 {
+		if idx, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+			return idx
+		}
+	}
+
+	return math.MaxInt32
+}
@@ -0,0 +1,204 @@
+package querylog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CSVReader", func() {
+	var (
+		tmpDir string
+		writer *FileWriter
+		err    error
+	)
+
+	newEntry := func(client, question, reason string, start time.Time) *LogEntry {
+		res, err := util.NewMsgWithAnswer(question, 123, dns.TypeA, "123.124.122.122")
+		Expect(err).Should(Succeed())
+
+		return &LogEntry{
+			Request: &model.Request{
+				ClientNames: []string{client},
+				Req:         util.NewMsgWithQuestion(question, dns.TypeA),
+			},
+			Response: &model.Response{
+				Res:    res,
+				Reason: reason,
+				RType:  model.ResponseTypeRESOLVED,
+			},
+			Start:      start,
+			DurationMs: 20,
+		}
+	}
+
+	BeforeEach(func() {
+		tmpDir, err = ioutil.TempDir("", "fileReader")
+		Expect(err).Should(Succeed())
+
+		writer, err = NewCSVWriter(config.QueryLogConfig{Target: tmpDir, Type: config.QueryLogTypeCsvClient})
+		Expect(err).Should(Succeed())
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	When("target dir does not exist", func() {
+		It("should return error", func() {
+			_, err = NewCSVReader("wrongdir", nil)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Last entries", func() {
+		BeforeEach(func() {
+			now := time.Now()
+
+			writer.Write(newEntry("client1", "google.de.", "Resolved", now.AddDate(0, 0, -1)))
+			writer.Write(newEntry("client1", "example.com.", "Resolved", now.Add(-2*time.Second)))
+			writer.Write(newEntry("client2", "doubleclick.net.", "BLOCKED (ads)", now.Add(-time.Second)))
+			writer.Write(newEntry("client1", "heise.de.", "CACHED", now))
+		})
+
+		It("should return the newest entries of all days and clients in chronological order", func() {
+			reader, err := NewCSVReader(tmpDir, nil)
+			Expect(err).Should(Succeed())
+
+			records, err := reader.Last(Filter{}, 3)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(HaveLen(3))
+			Expect(records[0].Question).Should(Equal("A (example.com.)"))
+			Expect(records[1].Question).Should(Equal("A (doubleclick.net.)"))
+			Expect(records[1].ClientName).Should(Equal("client2"))
+			Expect(records[1].Reason).Should(Equal("BLOCKED (ads)"))
+			Expect(records[2].Question).Should(Equal("A (heise.de.)"))
+			Expect(records[2].DurationMs).Should(Equal("20"))
+
+			records, err = reader.Last(Filter{}, 0)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(HaveLen(4))
+			Expect(records[0].Question).Should(Equal("A (google.de.)"))
+		})
+
+		It("should return only entries matching the filter", func() {
+			reader, err := NewCSVReader(tmpDir, nil)
+			Expect(err).Should(Succeed())
+
+			records, err := reader.Last(Filter{Client: "CLIENT1", Domain: ".de"}, 10)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(HaveLen(2))
+			Expect(records[0].Question).Should(Equal("A (google.de.)"))
+			Expect(records[1].Question).Should(Equal("A (heise.de.)"))
+
+			records, err = reader.Last(Filter{Reason: "blocked"}, 10)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(HaveLen(1))
+			Expect(records[0].Question).Should(Equal("A (doubleclick.net.)"))
+		})
+
+		It("should use the configured fields", func() {
+			writer, err = NewCSVWriter(config.QueryLogConfig{
+				Target:    tmpDir,
+				Type:      config.QueryLogTypeCsv,
+				CSVFields: []config.QueryLogField{config.QueryLogFieldQuestion, config.QueryLogFieldReason},
+			})
+			Expect(err).Should(Succeed())
+			Expect(os.RemoveAll(tmpDir)).Should(Succeed())
+			Expect(os.Mkdir(tmpDir, 0755)).Should(Succeed())
+
+			writer.Write(newEntry("client1", "google.de.", "Resolved", time.Now()))
+
+			reader, err := NewCSVReader(tmpDir,
+				[]config.QueryLogField{config.QueryLogFieldQuestion, config.QueryLogFieldReason})
+			Expect(err).Should(Succeed())
+
+			records, err := reader.Last(Filter{}, 10)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(Equal([]*Record{{Question: "A (google.de.)", Reason: "Resolved"}}))
+		})
+	})
+
+	When("log files were rotated", func() {
+		It("should return the entries of the rotated files first", func() {
+			writer, err = NewCSVWriter(config.QueryLogConfig{Target: tmpDir, Type: config.QueryLogTypeCsv, MaxFileSize: 1})
+			Expect(err).Should(Succeed())
+
+			now := time.Now()
+
+			writer.Write(newEntry("client1", "first.com.", "Resolved", now))
+			writer.Write(newEntry("client1", "second.com.", "Resolved", now))
+			writer.Write(newEntry("client1", "third.com.", "Resolved", now))
+
+			files, err := filepath.Glob(filepath.Join(tmpDir, "*.log"))
+			Expect(err).Should(Succeed())
+			Expect(files).Should(HaveLen(3))
+
+			reader, err := NewCSVReader(tmpDir, nil)
+			Expect(err).Should(Succeed())
+
+			records, err := reader.Last(Filter{}, 10)
+			Expect(err).Should(Succeed())
+			Expect(records).Should(HaveLen(3))
+			Expect(records[0].Question).Should(Equal("A (first.com.)"))
+			Expect(records[1].Question).Should(Equal("A (second.com.)"))
+			Expect(records[2].Question).Should(Equal("A (third.com.)"))
+		})
+	})
+
+	Describe("Follow", func() {
+		It("should return only new entries matching the filter", func() {
+			writer.Write(newEntry("client1", "old.com.", "Resolved", time.Now()))
+
+			reader, err := NewCSVReader(tmpDir, nil)
+			Expect(err).Should(Succeed())
+
+			var (
+				lock    sync.Mutex
+				records []*Record
+			)
+
+			stop := make(chan struct{})
+			done := make(chan error)
+
+			go func() {
+				done <- reader.Follow(Filter{Client: "client1"}, stop, func(r *Record) {
+					lock.Lock()
+					defer lock.Unlock()
+
+					records = append(records, r)
+				})
+			}()
+
+			// wait for the initialization of the offsets
+			time.Sleep(100 * time.Millisecond)
+
+			writer.Write(newEntry("client1", "new.com.", "Resolved", time.Now()))
+			writer.Write(newEntry("client2", "other.com.", "Resolved", time.Now()))
+
+			Eventually(func() []string {
+				lock.Lock()
+				defer lock.Unlock()
+
+				questions := make([]string, 0, len(records))
+				for _, r := range records {
+					questions = append(questions, r.Question)
+				}
+
+				return questions
+			}, "2s").Should(Equal([]string{"A (new.com.)"}))
+
+			close(stop)
+			Eventually(done, "2s").Should(Receive(BeNil()))
+		})
+	})
+})
@@ -8,9 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/log"
 	"github.com/0xERR0R/blocky/util"
 	"github.com/miekg/dns"
@@ -25,24 +27,62 @@ type FileWriter struct {
 	target           string
 	perClient        bool
 	logRetentionDays uint64
+	maxFileSize      uint64
+	fields           []config.QueryLogField
+	timeFormat       config.QueryLogTimeFormat
+	timeZone         config.QueryLogTimeZone
 }
 
-func NewCSVWriter(target string, perClient bool, logRetentionDays uint64) (*FileWriter, error) {
-	if _, err := os.Stat(target); target != "" && err != nil && os.IsNotExist(err) {
-		return nil, fmt.Errorf("query log directory '%s' does not exist or is not writable", target)
+// NewCSVWriter creates a new CSV writer for the configured target, type 'csv-client' writes one file
+// per client. The columns are written in the order of the configured fields, all fields are written
+// in default order if no fields are configured. If the max file size is > 0, a file with at least
+// this size is rotated. Timestamps and file dates use the configured format and time zone
+func NewCSVWriter(cfg config.QueryLogConfig) (*FileWriter, error) {
+	if _, err := os.Stat(cfg.Target); cfg.Target != "" && err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("query log directory '%s' does not exist or is not writable", cfg.Target)
+	}
+
+	fields := cfg.CSVFields
+	if len(fields) == 0 {
+		fields = defaultQueryLogFields()
 	}
 
 	return &FileWriter{
-		target:           target,
-		perClient:        perClient,
-		logRetentionDays: logRetentionDays,
+		target:           cfg.Target,
+		perClient:        cfg.Type == config.QueryLogTypeCsvClient,
+		logRetentionDays: cfg.LogRetentionDays,
+		maxFileSize:      uint64(cfg.MaxFileSize),
+		fields:           fields,
+		timeFormat:       cfg.TimeFormat,
+		timeZone:         cfg.TimeZone,
 	}, nil
 }
 
+// defaultQueryLogFields returns all fields without the source fields, they must be selected explicitly
+func defaultQueryLogFields() []config.QueryLogField {
+	names := config.QueryLogFieldNames()
+	fields := make([]config.QueryLogField, 0, len(names))
+
+	for _, name := range names {
+		field, _ := config.ParseQueryLogField(name)
+		if !IsSourceField(field) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// IsSourceField returns true if the field is only set with the source of the entry
+func IsSourceField(field config.QueryLogField) bool {
+	return field == config.QueryLogFieldUpstreamResponseCode || field == config.QueryLogFieldCached ||
+		field == config.QueryLogFieldStale
+}
+
 func (d *FileWriter) Write(entry *LogEntry) {
 	var clientPrefix string
 
-	dateString := entry.Start.Format("2006-01-02")
+	dateString := d.entryTime(entry).Format("2006-01-02")
 
 	if d.perClient {
 		clientPrefix = strings.Join(entry.Request.ClientNames, "-")
@@ -53,7 +93,7 @@ func (d *FileWriter) Write(entry *LogEntry) {
 	fileName := fmt.Sprintf("%s_%s.log", dateString, escape(clientPrefix))
 	writePath := filepath.Join(d.target, fileName)
 
-	file, err := os.OpenFile(writePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	file, err := d.openFile(writePath)
 
 	util.LogOnErrorWithEntry(log.PrefixedLog(loggerPrefixFileWriter).WithField("file_name", writePath),
 		"can't create/open file", err)
@@ -61,7 +101,7 @@ func (d *FileWriter) Write(entry *LogEntry) {
 	if err == nil {
 		writer := createCsvWriter(file)
 
-		err := writer.Write(createQueryLogRow(entry))
+		err := writer.Write(d.createQueryLogRow(entry))
 		util.LogOnErrorWithEntry(log.PrefixedLog(loggerPrefixFileWriter).WithField("file_name", writePath),
 			"can't write to file", err)
 		writer.Flush()
@@ -70,6 +110,40 @@ func (d *FileWriter) Write(entry *LogEntry) {
 	}
 }
 
+// openFile opens the log file for appending. If the file reached the max file size, it is renamed to
+// the next free index (e.g. 2022-01-02_ALL.1.log) and a new file is created
+func (d *FileWriter) openFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil || d.maxFileSize == 0 {
+		return file, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || uint64(info.Size()) < d.maxFileSize {
+		return file, nil
+	}
+
+	_ = file.Close()
+
+	if err := rotateFile(path); err != nil {
+		log.PrefixedLog(loggerPrefixFileWriter).WithField("file_name", path).Warn("can't rotate file: ", err)
+	}
+
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+}
+
+func rotateFile(path string) error {
+	base := strings.TrimSuffix(path, ".log")
+
+	for i := 1; ; i++ {
+		rotated := fmt.Sprintf("%s.%d.log", base, i)
+
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			return os.Rename(path, rotated)
+		}
+	}
+}
+
 // CleanUp deletes old log files
 func (d *FileWriter) CleanUp() {
 	logger := log.PrefixedLog(loggerPrefixFileWriter)
@@ -101,20 +175,65 @@ func (d *FileWriter) CleanUp() {
 	}
 }
 
-func createQueryLogRow(logEntry *LogEntry) []string {
+// entryTime returns the start time of the entry in the configured time zone
+func (d *FileWriter) entryTime(logEntry *LogEntry) time.Time {
+	if d.timeZone == config.QueryLogTimeZoneUtc {
+		return logEntry.Start.UTC()
+	}
+
+	return logEntry.Start.Local()
+}
+
+func (d *FileWriter) createQueryLogRow(logEntry *LogEntry) []string {
+	row := make([]string, 0, len(d.fields))
+
+	for _, field := range d.fields {
+		row = append(row, d.queryLogFieldValue(logEntry, field))
+	}
+
+	return row
+}
+
+func (d *FileWriter) queryLogFieldValue(logEntry *LogEntry, field config.QueryLogField) string {
 	request := logEntry.Request
 	response := logEntry.Response
 
-	return []string{
-		logEntry.Start.Format("2006-01-02 15:04:05"),
-		request.ClientIP.String(),
-		strings.Join(request.ClientNames, "; "),
-		fmt.Sprintf("%d", logEntry.DurationMs),
-		response.Reason,
-		util.QuestionToString(request.Req.Question),
-		util.AnswerToString(response.Res.Answer),
-		dns.RcodeToString[response.Res.Rcode],
+	switch field {
+	case config.QueryLogFieldTime:
+		if d.timeFormat == config.QueryLogTimeFormatRfc3339 {
+			return d.entryTime(logEntry).Format(time.RFC3339)
+		}
+
+		return d.entryTime(logEntry).Format("2006-01-02 15:04:05")
+	case config.QueryLogFieldClientIP:
+		return request.ClientIP.String()
+	case config.QueryLogFieldClientName:
+		return strings.Join(request.ClientNames, "; ")
+	case config.QueryLogFieldDuration:
+		return fmt.Sprintf("%d", logEntry.DurationMs)
+	case config.QueryLogFieldReason:
+		return response.Reason
+	case config.QueryLogFieldQuestion:
+		return util.QuestionToString(request.Req.Question)
+	case config.QueryLogFieldAnswer:
+		return util.AnswerToString(response.Res.Answer)
+	case config.QueryLogFieldResponseCode:
+		return dns.RcodeToString[response.Res.Rcode]
+	case config.QueryLogFieldUpstreamResponseCode:
+		if logEntry.Source != nil {
+			return logEntry.Source.UpstreamResponseCode
+		}
+	case config.QueryLogFieldCached:
+		if logEntry.Source != nil {
+			return strconv.FormatBool(logEntry.Source.Cached)
+		}
+	case config.QueryLogFieldStale:
+		if logEntry.Source != nil {
+			return strconv.FormatBool(logEntry.Source.Stale)
+		}
 	}
+
+	return ""
 }
 
 func createCsvWriter(file io.Writer) *csv.Writer {
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/log"
 
 	"github.com/0xERR0R/blocky/model"
@@ -34,7 +35,7 @@ var _ = Describe("FileWriter", func() {
 	Describe("CSV writer", func() {
 		When("target dir does not exist", func() {
 			It("should return error", func() {
-				_, err = NewCSVWriter("wrongdir", false, 0)
+				_, err = NewCSVWriter(config.QueryLogConfig{Target: "wrongdir", Type: config.QueryLogTypeCsv})
 				Expect(err).Should(HaveOccurred())
 			})
 		})
@@ -42,7 +43,7 @@ var _ = Describe("FileWriter", func() {
 			It("should be logged in one file", func() {
 				tmpDir, err = ioutil.TempDir("", "queryLoggingResolver")
 				Expect(err).Should(Succeed())
-				writer, _ := NewCSVWriter(tmpDir, false, 0)
+				writer, _ := NewCSVWriter(config.QueryLogConfig{Target: tmpDir, Type: config.QueryLogTypeCsv})
 				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
 
 				Expect(err).Should(Succeed())
@@ -89,7 +90,7 @@ var _ = Describe("FileWriter", func() {
 			It("should be logged in separate files per client", func() {
 				tmpDir, err = ioutil.TempDir("", "queryLoggingResolver")
 				Expect(err).Should(Succeed())
-				writer, _ := NewCSVWriter(tmpDir, true, 0)
+				writer, _ := NewCSVWriter(config.QueryLogConfig{Target: tmpDir, Type: config.QueryLogTypeCsvClient})
 				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
 
 				Expect(err).Should(Succeed())
@@ -136,11 +137,127 @@ var _ = Describe("FileWriter", func() {
 
 			})
 		})
+		When("CSV fields are configured", func() {
+			It("should write the columns in configured order", func() {
+				writer, _ := NewCSVWriter(config.QueryLogConfig{
+					Target: tmpDir,
+					Type:   config.QueryLogTypeCsv,
+					CSVFields: []config.QueryLogField{
+						config.QueryLogFieldResponseCode,
+						config.QueryLogFieldQuestion,
+						config.QueryLogFieldClientName,
+					},
+				})
+				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+
+				Expect(err).Should(Succeed())
+
+				writer.Write(&LogEntry{
+					Request: &model.Request{
+						ClientNames: []string{"client1"},
+						Req:         util.NewMsgWithQuestion("google.de.", dns.TypeA),
+						RequestTS:   time.Time{},
+					},
+					Response: &model.Response{
+						Res:    res,
+						Reason: "Resolved",
+						RType:  model.ResponseTypeRESOLVED,
+					},
+					Start:      time.Now(),
+					DurationMs: 20,
+				})
+
+				csvLines := readCsv(filepath.Join(tmpDir, fmt.Sprintf("%s_ALL.log", time.Now().Format("2006-01-02"))))
+				Expect(csvLines).Should(HaveLen(1))
+				Expect(csvLines[0]).Should(Equal([]string{"NOERROR", "A (google.de.)", "client1"}))
+			})
+		})
+		When("time format and time zone are configured", func() {
+			It("should write the timestamp in RFC3339 format and UTC", func() {
+				writer, _ := NewCSVWriter(config.QueryLogConfig{
+					Target:     tmpDir,
+					Type:       config.QueryLogTypeCsv,
+					CSVFields:  []config.QueryLogField{config.QueryLogFieldTime},
+					TimeFormat: config.QueryLogTimeFormatRfc3339,
+					TimeZone:   config.QueryLogTimeZoneUtc,
+				})
+				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+
+				Expect(err).Should(Succeed())
+
+				// 2022-03-02 01:30 UTC is still the previous day in UTC-5
+				start := time.Date(2022, 3, 1, 20, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+
+				writer.Write(&LogEntry{
+					Request: &model.Request{
+						Req: util.NewMsgWithQuestion("google.de.", dns.TypeA),
+					},
+					Response: &model.Response{
+						Res:    res,
+						Reason: "Resolved",
+						RType:  model.ResponseTypeRESOLVED,
+					},
+					Start:      start,
+					DurationMs: 20,
+				})
+
+				csvLines := readCsv(filepath.Join(tmpDir, "2022-03-02_ALL.log"))
+				Expect(csvLines).Should(HaveLen(1))
+				Expect(csvLines[0]).Should(Equal([]string{"2022-03-02T01:30:00Z"}))
+			})
+		})
+		When("CSV fields are not configured", func() {
+			It("should write all columns in default order", func() {
+				writer, _ := NewCSVWriter(config.QueryLogConfig{Target: tmpDir, Type: config.QueryLogTypeCsv})
+
+				Expect(writer.fields).Should(HaveLen(8))
+				Expect(writer.fields[0]).Should(Equal(config.QueryLogFieldTime))
+				Expect(writer.fields[7]).Should(Equal(config.QueryLogFieldResponseCode))
+				Expect(writer.fields).ShouldNot(ContainElement(config.QueryLogFieldCached))
+				Expect(writer.fields).ShouldNot(ContainElement(config.QueryLogFieldStale))
+			})
+		})
+		When("source fields are configured", func() {
+			It("should write the upstream response code and if the answer was cached", func() {
+				writer, _ := NewCSVWriter(config.QueryLogConfig{
+					Target: tmpDir,
+					Type:   config.QueryLogTypeCsv,
+					CSVFields: []config.QueryLogField{
+						config.QueryLogFieldResponseCode,
+						config.QueryLogFieldUpstreamResponseCode,
+						config.QueryLogFieldCached,
+						config.QueryLogFieldStale,
+					},
+				})
+
+				res := new(dns.Msg)
+				res.Rcode = dns.RcodeNameError
+				rcode := dns.RcodeServerFailure
+				response := &model.Response{Res: res, Reason: "Resolved", UpstreamRcode: &rcode}
+
+				for _, source := range []*LogEntrySource{NewLogEntrySource(response), nil} {
+					writer.Write(&LogEntry{
+						Request:  &model.Request{Req: util.NewMsgWithQuestion("google.de.", dns.TypeA)},
+						Response: response,
+						Start:    time.Now(),
+						Source:   source,
+					})
+				}
+
+				csvLines := readCsv(filepath.Join(tmpDir, fmt.Sprintf("%s_ALL.log", time.Now().Format("2006-01-02"))))
+				Expect(csvLines).Should(Equal([][]string{
+					{"NXDOMAIN", "SERVFAIL", "false", "false"},
+					{"NXDOMAIN", "", "", ""},
+				}))
+			})
+		})
 		When("Cleanup is called", func() {
 			It("should delete old files", func() {
 				tmpDir, err = ioutil.TempDir("", "queryLoggingResolver")
 				Expect(err).Should(Succeed())
-				writer, _ := NewCSVWriter(tmpDir, false, 1)
+				writer, _ := NewCSVWriter(config.QueryLogConfig{
+					Target: tmpDir, Type: config.QueryLogTypeCsv, LogRetentionDays: 1,
+				})
 				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
 
 				Expect(err).Should(Succeed())
@@ -188,6 +305,66 @@ var _ = Describe("FileWriter", func() {
 				Expect(files).Should(HaveLen(1))
 			})
 		})
+		When("max file size is configured", func() {
+			var writer *FileWriter
+
+			writeEntry := func(start time.Time) {
+				res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+				Expect(err).Should(Succeed())
+
+				writer.Write(&LogEntry{
+					Request: &model.Request{
+						ClientNames: []string{"client1"},
+						Req:         util.NewMsgWithQuestion("google.de.", dns.TypeA),
+						RequestTS:   time.Now(),
+					},
+					Response: &model.Response{
+						Res:    res,
+						Reason: "Resolved",
+						RType:  model.ResponseTypeRESOLVED,
+					},
+					Start:      start,
+					DurationMs: 20,
+				})
+			}
+
+			BeforeEach(func() {
+				// each entry is larger than max file size -> each entry is written in a new file
+				writer, err = NewCSVWriter(config.QueryLogConfig{
+					Target: tmpDir, Type: config.QueryLogTypeCsv, LogRetentionDays: 1, MaxFileSize: 10,
+				})
+				Expect(err).Should(Succeed())
+			})
+
+			It("should rotate the file with an index suffix", func() {
+				for i := 0; i < 3; i++ {
+					writeEntry(time.Now())
+				}
+
+				today := time.Now().Format("2006-01-02")
+
+				Expect(readCsv(filepath.Join(tmpDir, today+"_ALL.log"))).Should(HaveLen(1))
+				Expect(readCsv(filepath.Join(tmpDir, today+"_ALL.1.log"))).Should(HaveLen(1))
+				Expect(readCsv(filepath.Join(tmpDir, today+"_ALL.2.log"))).Should(HaveLen(1))
+			})
+
+			It("should delete old rotated files on cleanup", func() {
+				writeEntry(time.Now())
+				writeEntry(time.Now().AddDate(0, 0, -2))
+				writeEntry(time.Now().AddDate(0, 0, -2))
+
+				files, err := ioutil.ReadDir(tmpDir)
+				Expect(err).Should(Succeed())
+				Expect(files).Should(HaveLen(3))
+
+				writer.CleanUp()
+
+				files, err = ioutil.ReadDir(tmpDir)
+				Expect(err).Should(Succeed())
+				Expect(files).Should(HaveLen(1))
+				Expect(files[0].Name()).Should(Equal(time.Now().Format("2006-01-02") + "_ALL.log"))
+			})
+		})
 	})
 
 })
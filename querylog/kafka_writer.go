@@ -0,0 +1,241 @@
+package querylog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	loggerPrefixKafkaWriter = "kafkaQueryLogWriter"
+
+	kafkaFlushPeriod = time.Second
+
+	// max amount of messages, which are produced with one request
+	kafkaMaxBatchSize = 1000
+
+	// entries are already collected by the writer, the producer shouldn't wait for more messages
+	kafkaBatchTimeout = 10 * time.Millisecond
+
+	// max amount of entries, which are kept in memory while a batch is produced
+	kafkaMaxPendingEntries = 10000
+
+	kafkaDialTimeout  = 5 * time.Second
+	kafkaWriteTimeout = 10 * time.Second
+)
+
+// kafkaProducer produces messages to a Kafka topic
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaLogEntry is the JSON representation of a query log entry
+type kafkaLogEntry struct {
+	RequestTS     time.Time `json:"requestTs"`
+	ClientIP      string    `json:"clientIp"`
+	ClientNames   []string  `json:"clientNames"`
+	DurationMs    int64     `json:"durationMs"`
+	Reason        string    `json:"reason"`
+	ResponseType  string    `json:"responseType"`
+	QuestionType  string    `json:"questionType"`
+	QuestionName  string    `json:"questionName"`
+	EffectiveTLDP string    `json:"effectiveTldp"`
+	Answer        string    `json:"answer"`
+	ResponseCode  string    `json:"responseCode"`
+	// only with enabled source fields
+	UpstreamResponseCode *string `json:"upstreamResponseCode,omitempty"`
+	Cached               *bool   `json:"cached,omitempty"`
+	Stale                *bool   `json:"stale,omitempty"`
+}
+
+// KafkaWriter produces each query log entry as JSON message to a Kafka topic. The entries are produced in batches,
+// if the production fails, the entries of the batch are written to the console
+type KafkaWriter struct {
+	producer       kafkaProducer
+	logger         *logrus.Entry
+	lock           sync.Mutex
+	pendingEntries []*LogEntry
+	fallback       Writer
+}
+
+// NewKafkaWriter creates a new writer instance. Target contains the brokers and the topic
+// (host:port[,host:port...]/topic), at least one of the brokers must be reachable
+func NewKafkaWriter(target string) (*KafkaWriter, error) {
+	brokers, topic, err := parseKafkaTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKafkaBrokers(brokers); err != nil {
+		return nil, err
+	}
+
+	w := newKafkaWriter(&kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchSize:    kafkaMaxBatchSize,
+		BatchTimeout: kafkaBatchTimeout,
+		WriteTimeout: kafkaWriteTimeout,
+		RequiredAcks: kafka.RequireOne,
+	}, log.PrefixedLog(loggerPrefixKafkaWriter).WithField("target", target))
+
+	go w.periodicFlush()
+
+	return w, nil
+}
+
+func newKafkaWriter(producer kafkaProducer, logger *logrus.Entry) *KafkaWriter {
+	return &KafkaWriter{
+		producer: producer,
+		logger:   logger,
+		fallback: NewLoggerWriter(),
+	}
+}
+
+func parseKafkaTarget(target string) (brokers []string, topic string, err error) {
+	idx := strings.LastIndex(target, "/")
+	if idx < 0 || idx == len(target)-1 {
+		return nil, "", fmt.Errorf("wrong kafka target '%s', use host:port[,host:port...]/topic", target)
+	}
+
+	topic = target[idx+1:]
+
+	for _, broker := range strings.Split(target[:idx], ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+
+	if len(brokers) == 0 {
+		return nil, "", fmt.Errorf("wrong kafka target '%s', no broker defined", target)
+	}
+
+	return brokers, topic, nil
+}
+
+// checkKafkaBrokers returns an error if none of the brokers is reachable
+func checkKafkaBrokers(brokers []string) (err error) {
+	for _, broker := range brokers {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaDialTimeout)
+
+		var conn *kafka.Conn
+
+		conn, err = kafka.DialContext(ctx, "tcp", broker)
+
+		cancel()
+
+		if err == nil {
+			return conn.Close()
+		}
+	}
+
+	return fmt.Errorf("can't connect to kafka broker: %w", err)
+}
+
+func (k *KafkaWriter) periodicFlush() {
+	ticker := time.NewTicker(kafkaFlushPeriod)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		k.flush()
+	}
+}
+
+func (k *KafkaWriter) Write(entry *LogEntry) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.pendingEntries = append(k.pendingEntries, entry)
+
+	if len(k.pendingEntries) > kafkaMaxPendingEntries {
+		// drop the oldest entries
+		k.pendingEntries = k.pendingEntries[len(k.pendingEntries)-kafkaMaxPendingEntries:]
+	}
+}
+
+func (k *KafkaWriter) flush() {
+	k.lock.Lock()
+	entries := k.pendingEntries
+	k.pendingEntries = nil
+	k.lock.Unlock()
+
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > kafkaMaxBatchSize {
+			n = kafkaMaxBatchSize
+		}
+
+		k.produce(entries[:n])
+
+		entries = entries[n:]
+	}
+}
+
+func (k *KafkaWriter) produce(entries []*LogEntry) {
+	messages := make([]kafka.Message, 0, len(entries))
+
+	for _, entry := range entries {
+		value, err := json.Marshal(toKafkaLogEntry(entry))
+		if err != nil {
+			util.LogOnErrorWithEntry(k.logger, "can't marshal query log entry: ", err)
+
+			continue
+		}
+
+		messages = append(messages, kafka.Message{Key: []byte(entry.Request.ClientIP.String()), Value: value})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaWriteTimeout)
+	defer cancel()
+
+	if err := k.producer.WriteMessages(ctx, messages...); err != nil {
+		k.logger.Warnf("can't produce %d messages, using console as fallback: %v", len(messages), err)
+
+		for _, entry := range entries {
+			k.fallback.Write(entry)
+		}
+	}
+}
+
+func toKafkaLogEntry(entry *LogEntry) *kafkaLogEntry {
+	domain := util.ExtractDomain(entry.Request.Req.Question[0])
+	eTLD, _ := publicsuffix.EffectiveTLDPlusOne(domain)
+
+	result := &kafkaLogEntry{
+		RequestTS:     entry.Start,
+		ClientIP:      entry.Request.ClientIP.String(),
+		ClientNames:   entry.Request.ClientNames,
+		DurationMs:    entry.DurationMs,
+		Reason:        entry.Response.Reason,
+		ResponseType:  entry.Response.RType.String(),
+		QuestionType:  dns.TypeToString[entry.Request.Req.Question[0].Qtype],
+		QuestionName:  domain,
+		EffectiveTLDP: eTLD,
+		Answer:        util.AnswerToString(entry.Response.Res.Answer),
+		ResponseCode:  dns.RcodeToString[entry.Response.Res.Rcode],
+	}
+
+	if entry.Source != nil {
+		result.UpstreamResponseCode = &entry.Source.UpstreamResponseCode
+		result.Cached = &entry.Source.Cached
+		result.Stale = &entry.Source.Stale
+	}
+
+	return result
+}
+
+func (k *KafkaWriter) CleanUp() {
+	// Nothing to do
+}
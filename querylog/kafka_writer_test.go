@@ -0,0 +1,204 @@
+package querylog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// producerMock stores the produced messages or fails with the configured error
+type producerMock struct {
+	lock     sync.Mutex
+	err      error
+	batches  [][]kafka.Message
+	messages []kafka.Message
+}
+
+func (p *producerMock) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.batches = append(p.batches, msgs)
+	p.messages = append(p.messages, msgs...)
+
+	return nil
+}
+
+// writerMock stores the written entries
+type writerMock struct {
+	entries []*LogEntry
+}
+
+func (w *writerMock) Write(entry *LogEntry) {
+	w.entries = append(w.entries, entry)
+}
+
+func (w *writerMock) CleanUp() {}
+
+var _ = Describe("KafkaWriter", func() {
+	var (
+		writer   *KafkaWriter
+		producer *producerMock
+		fallback *writerMock
+	)
+
+	newEntry := func(clientIP string) *LogEntry {
+		res, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+		Expect(err).Should(Succeed())
+
+		return &LogEntry{
+			Request: &model.Request{
+				ClientIP:    net.ParseIP(clientIP),
+				ClientNames: []string{"client1"},
+				Req:         util.NewMsgWithQuestion("www.example.com.", dns.TypeA),
+				Log:         logrus.NewEntry(log.Log()),
+			},
+			Response: &model.Response{
+				Res:    res,
+				Reason: "Resolved",
+				RType:  model.ResponseTypeRESOLVED,
+			},
+			Start:      time.Date(2022, 3, 1, 10, 20, 30, 0, time.UTC),
+			DurationMs: 20,
+		}
+	}
+
+	BeforeEach(func() {
+		producer = &producerMock{}
+		fallback = &writerMock{}
+		writer = newKafkaWriter(producer, log.PrefixedLog(loggerPrefixKafkaWriter))
+		writer.fallback = fallback
+	})
+
+	When("entries are written", func() {
+		It("should produce them as JSON messages on flush", func() {
+			writer.Write(newEntry("192.168.178.25"))
+			writer.Write(newEntry("192.168.178.26"))
+
+			Expect(producer.messages).Should(BeEmpty())
+
+			writer.flush()
+
+			Expect(producer.batches).Should(HaveLen(1))
+			Expect(producer.messages).Should(HaveLen(2))
+			Expect(string(producer.messages[0].Key)).Should(Equal("192.168.178.25"))
+
+			var e kafkaLogEntry
+			Expect(json.Unmarshal(producer.messages[0].Value, &e)).Should(Succeed())
+			Expect(e).Should(Equal(kafkaLogEntry{
+				RequestTS:     time.Date(2022, 3, 1, 10, 20, 30, 0, time.UTC),
+				ClientIP:      "192.168.178.25",
+				ClientNames:   []string{"client1"},
+				DurationMs:    20,
+				Reason:        "Resolved",
+				ResponseType:  "RESOLVED",
+				QuestionType:  "A",
+				QuestionName:  "www.example.com",
+				EffectiveTLDP: "example.com",
+				Answer:        "A (123.124.122.122)",
+				ResponseCode:  "NOERROR",
+			}))
+
+			writer.flush()
+			Expect(producer.batches).Should(HaveLen(1))
+		})
+
+		It("should add the source fields only if the entry has a source", func() {
+			entry := newEntry("192.168.178.25")
+			rcode := dns.RcodeServerFailure
+			entry.Response.UpstreamRcode = &rcode
+			entry.Source = NewLogEntrySource(entry.Response)
+
+			writer.Write(entry)
+			writer.Write(newEntry("192.168.178.26"))
+			writer.flush()
+
+			Expect(string(producer.messages[0].Value)).Should(ContainSubstring(`"upstreamResponseCode":"SERVFAIL","cached":false`))
+			Expect(string(producer.messages[1].Value)).ShouldNot(ContainSubstring("cached"))
+		})
+
+		It("should produce large amounts of entries in multiple batches", func() {
+			for i := 0; i < kafkaMaxBatchSize+1; i++ {
+				writer.Write(newEntry("192.168.178.25"))
+			}
+
+			writer.flush()
+
+			Expect(producer.batches).Should(HaveLen(2))
+			Expect(producer.batches[1]).Should(HaveLen(1))
+		})
+
+		It("should keep only the newest entries if too many entries are pending", func() {
+			for i := 0; i < kafkaMaxPendingEntries+10; i++ {
+				writer.Write(newEntry("192.168.178.25"))
+			}
+
+			Expect(writer.pendingEntries).Should(HaveLen(kafkaMaxPendingEntries))
+		})
+	})
+
+	When("messages can't be produced", func() {
+		It("should write the entries to the fallback", func() {
+			producer.err = errors.New("broker not available")
+
+			e := newEntry("192.168.178.25")
+			writer.Write(e)
+			writer.flush()
+
+			Expect(fallback.entries).Should(Equal([]*LogEntry{e}))
+			Expect(writer.pendingEntries).Should(BeEmpty())
+		})
+	})
+
+	Describe("Target", func() {
+		It("should parse brokers and topic", func() {
+			brokers, topic, err := parseKafkaTarget("kafka1:9092, kafka2:9092/blocky-querylog")
+			Expect(err).Should(Succeed())
+			Expect(brokers).Should(Equal([]string{"kafka1:9092", "kafka2:9092"}))
+			Expect(topic).Should(Equal("blocky-querylog"))
+		})
+
+		It("should fail without topic", func() {
+			_, _, err := parseKafkaTarget("kafka1:9092")
+			Expect(err).Should(HaveOccurred())
+
+			_, _, err = parseKafkaTarget("kafka1:9092/")
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail without broker", func() {
+			_, _, err := parseKafkaTarget(" ,/topic")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	When("no broker is reachable", func() {
+		It("should fail on creation", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).Should(Succeed())
+			addr := listener.Addr().String()
+			Expect(listener.Close()).Should(Succeed())
+
+			_, err = NewKafkaWriter(addr + "/topic")
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("can't connect to kafka broker"))
+		})
+	})
+})
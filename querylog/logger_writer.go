@@ -20,17 +20,23 @@ func NewLoggerWriter() *LoggerWriter {
 }
 
 func (d *LoggerWriter) Write(entry *LogEntry) {
-	d.logger.WithFields(
-		logrus.Fields{
-			"client_ip":       entry.Request.ClientIP,
-			"client_names":    strings.Join(entry.Request.ClientNames, "; "),
-			"response_reason": entry.Response.Reason,
-			"question":        util.QuestionToString(entry.Request.Req.Question),
-			"response_code":   dns.RcodeToString[entry.Response.Res.Rcode],
-			"answer":          util.AnswerToString(entry.Response.Res.Answer),
-			"duration_ms":     entry.DurationMs,
-		},
-	).Infof("query resolved")
+	fields := logrus.Fields{
+		"client_ip":       entry.Request.ClientIP,
+		"client_names":    strings.Join(entry.Request.ClientNames, "; "),
+		"response_reason": entry.Response.Reason,
+		"question":        util.QuestionToString(entry.Request.Req.Question),
+		"response_code":   dns.RcodeToString[entry.Response.Res.Rcode],
+		"answer":          util.AnswerToString(entry.Response.Res.Answer),
+		"duration_ms":     entry.DurationMs,
+	}
+
+	if entry.Source != nil {
+		fields["upstream_response_code"] = entry.Source.UpstreamResponseCode
+		fields["cached"] = entry.Source.Cached
+		fields["stale"] = entry.Source.Stale
+	}
+
+	d.logger.WithFields(fields).Infof("query resolved")
 }
 
 func (d *LoggerWriter) CleanUp() {
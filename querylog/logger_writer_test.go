@@ -43,9 +43,30 @@ var _ = Describe("LoggerWriter", func() {
 
 				Expect(hook.Entries).Should(HaveLen(1))
 				Expect(hook.LastEntry().Message).Should(Equal("query resolved"))
+				Expect(hook.LastEntry().Data).ShouldNot(HaveKey("cached"))
 
 			})
 		})
+		When("the entry has a source", func() {
+			It("should log the upstream response code and if the answer was cached", func() {
+				writer := NewLoggerWriter()
+				logger, hook := test.NewNullLogger()
+				writer.logger = logger.WithField("k", "v")
+
+				response := &model.Response{Res: new(dns.Msg), Reason: "CACHED STALE", RType: model.ResponseTypeCACHED,
+					Stale: true}
+				writer.Write(&LogEntry{
+					Request:  &model.Request{Req: util.NewMsgWithQuestion("google.de.", dns.TypeA)},
+					Response: response,
+					Start:    time.Now(),
+					Source:   NewLogEntrySource(response),
+				})
+
+				Expect(hook.LastEntry().Data).Should(HaveKeyWithValue("cached", true))
+				Expect(hook.LastEntry().Data).Should(HaveKeyWithValue("stale", true))
+				Expect(hook.LastEntry().Data).Should(HaveKeyWithValue("upstream_response_code", ""))
+			})
+		})
 		When("Cleanup is called", func() {
 			It("should do nothing", func() {
 				writer := NewLoggerWriter()
@@ -0,0 +1,59 @@
+package querylog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+)
+
+// Record is a query log entry, which was read from the query log target
+type Record struct {
+	Time         string
+	ClientIP     string
+	ClientName   string
+	DurationMs   string
+	Reason       string
+	Question     string
+	Answer       string
+	ResponseCode string
+}
+
+// Filter selects query log records. Each non empty value must be contained (case insensitive) in the corresponding
+// value of the record: client in the client name or IP, domain in the question and reason in the reason
+type Filter struct {
+	Client string
+	Domain string
+	Reason string
+}
+
+// Matches checks if the record matches all values of the filter
+func (f Filter) Matches(r *Record) bool {
+	return (containsIgnoreCase(r.ClientName, f.Client) || containsIgnoreCase(r.ClientIP, f.Client)) &&
+		containsIgnoreCase(r.Question, f.Domain) &&
+		containsIgnoreCase(r.Reason, f.Reason)
+}
+
+func containsIgnoreCase(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Reader reads entries from a query log target
+type Reader interface {
+	// Last returns max. limit newest records matching the filter in chronological order
+	Last(filter Filter, limit int) ([]*Record, error)
+}
+
+// NewReader creates a reader for the configured query log target
+func NewReader(cfg config.QueryLogConfig) (Reader, error) {
+	switch cfg.Type {
+	case config.QueryLogTypeCsv, config.QueryLogTypeCsvClient:
+		return NewCSVReader(cfg.Target, cfg.CSVFields)
+	case config.QueryLogTypeMysql:
+		return NewDatabaseReader("mysql", cfg.Target)
+	case config.QueryLogTypePostgresql:
+		return NewDatabaseReader("postgresql", cfg.Target)
+	}
+
+	return nil, fmt.Errorf("query log type '%s' can't be read, only CSV and database query logs are supported", cfg.Type)
+}
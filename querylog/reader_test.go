@@ -0,0 +1,55 @@
+package querylog
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/0xERR0R/blocky/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	Describe("Filter", func() {
+		record := &Record{
+			ClientIP:   "192.168.178.25",
+			ClientName: "laptop",
+			Question:   "A (google.de.)",
+			Reason:     "BLOCKED (ads)",
+		}
+
+		It("should match all records without values", func() {
+			Expect(Filter{}.Matches(record)).Should(BeTrue())
+		})
+
+		It("should match client name or client IP", func() {
+			Expect(Filter{Client: "LAPTOP"}.Matches(record)).Should(BeTrue())
+			Expect(Filter{Client: "192.168.178"}.Matches(record)).Should(BeTrue())
+			Expect(Filter{Client: "phone"}.Matches(record)).Should(BeFalse())
+		})
+
+		It("should match all values", func() {
+			Expect(Filter{Domain: "google", Reason: "blocked"}.Matches(record)).Should(BeTrue())
+			Expect(Filter{Domain: "google", Reason: "cached"}.Matches(record)).Should(BeFalse())
+		})
+	})
+
+	Describe("Reader creation", func() {
+		It("should create a CSV reader for CSV query logs", func() {
+			tmpDir, err := ioutil.TempDir("", "reader")
+			Expect(err).Should(Succeed())
+			DeferCleanup(os.RemoveAll, tmpDir)
+
+			reader, err := NewReader(config.QueryLogConfig{Type: config.QueryLogTypeCsvClient, Target: tmpDir})
+			Expect(err).Should(Succeed())
+			Expect(reader).Should(BeAssignableToTypeOf(&CSVReader{}))
+		})
+
+		It("should fail for query log types without stored entries", func() {
+			_, err := NewReader(config.QueryLogConfig{Type: config.QueryLogTypeConsole})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("can't be read"))
+		})
+	})
+})
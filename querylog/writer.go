@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
 )
 
 type LogEntry struct {
@@ -11,6 +12,28 @@ type LogEntry struct {
 	Response   *model.Response
 	Start      time.Time
 	DurationMs int64
+	// optional, only set if the source fields are enabled
+	Source *LogEntrySource
+}
+
+// LogEntrySource contains the source of the answer
+type LogEntrySource struct {
+	// raw response code of the upstream server, empty if the response wasn't resolved by an upstream
+	UpstreamResponseCode string
+	Cached               bool
+	// answer was served from an expired cache entry
+	Stale bool
+}
+
+// NewLogEntrySource returns the source of the response
+func NewLogEntrySource(response *model.Response) *LogEntrySource {
+	result := &LogEntrySource{Cached: response.RType == model.ResponseTypeCACHED, Stale: response.Stale}
+
+	if response.UpstreamRcode != nil {
+		result.UpstreamResponseCode = dns.RcodeToString[*response.UpstreamRcode]
+	}
+
+	return result
 }
 
 type Writer interface {
@@ -285,9 +285,10 @@ func convertMessage(message *redisMessage, ttl time.Duration) (*CacheMessage, er
 		res := &CacheMessage{
 			Key: message.Key,
 			Response: &model.Response{
-				RType:  model.ResponseTypeCACHED,
-				Reason: cacheReason,
-				Res:    &msg,
+				RType:         model.ResponseTypeCACHED,
+				Reason:        cacheReason,
+				Res:           &msg,
+				Authenticated: msg.AuthenticatedData,
 			},
 		}
 
@@ -24,6 +24,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// max. amount of recorded blocked requests for the block page
+const blockedRequestsCacheSize = 10000
+
 func createBlockHandler(cfg config.BlockingConfig) blockHandler {
 	cfgBlockType := cfg.BlockType
 
@@ -86,20 +89,127 @@ type BlockingResolver struct {
 	redisClient         *redis.Client
 	redisEnabled        bool
 	fqdnIPCache         expirationcache.ExpiringCache
+	dryRunGroups        map[string]bool
+	blockedTLDs         map[string]map[string]bool
+	blockedRequests     expirationcache.ExpiringCache
+	alwaysOnGroups      map[string]bool
+	dynamicBlocks       *dynamicBlocks
+	// reverse names of the custom block IPs, answered with the configured sinkhole PTR name
+	sinkholeReverseNames map[string]bool
+	// closed after the initial load of the lists, the blacklist is loaded after the whitelist
+	listsLoaded <-chan struct{}
+}
+
+// blockCheckResult contains the result of a check against white and black lists
+type blockCheckResult struct {
+	whitelisted bool
+	reason      string
+	group       string
+	question    dns.Question
+	// set if a CNAME target of the response is blocked
+	cnameAction config.CNAMEBlockAction
+	cnameTarget string
+	response    *dns.Msg
+}
+
+// checkListFormatSources returns an error if a source with configured format is not defined in a list
+func checkListFormatSources(cfg *config.BlockingConfig) error {
+	sources := make(map[string]bool)
+
+	for _, groups := range []map[string][]string{cfg.BlackLists, cfg.WhiteLists} {
+		for _, links := range groups {
+			for _, link := range links {
+				sources[link] = true
+			}
+		}
+	}
+
+	for source := range cfg.ListFormats {
+		if !sources[source] {
+			return fmt.Errorf("blocking resolver: list format source '%s' is not defined in a list", source)
+		}
+	}
+
+	return nil
 }
 
 // NewBlockingResolver returns a new configured instance of the resolver
 func NewBlockingResolver(cfg config.BlockingConfig, redis *redis.Client) (ChainedResolver, error) {
 	blockHandler := createBlockHandler(cfg)
+
+	if cfg.RefreshFailureWebhook != "" {
+		util.LogOnError("blocking resolver: can't register refresh failure webhook: ",
+			lists.RegisterRefreshFailureWebhook(cfg.RefreshFailureWebhook))
+	}
+
 	refreshPeriod := time.Duration(cfg.RefreshPeriod)
 	timeout := time.Duration(cfg.DownloadTimeout)
 	cooldown := time.Duration(cfg.DownloadCooldown)
-	blacklistMatcher, blErr := lists.NewListCache(lists.ListCacheTypeBlacklist, cfg.BlackLists, refreshPeriod,
-		timeout, cfg.DownloadAttempts, cooldown)
-	whitelistMatcher, wlErr := lists.NewListCache(lists.ListCacheTypeWhitelist, cfg.WhiteLists, refreshPeriod,
-		timeout, cfg.DownloadAttempts, cooldown)
+
+	var listOpts []lists.ListCacheOption
+	if cfg.HitCounting {
+		listOpts = append(listOpts, lists.WithHitCounting())
+	}
+
+	for g := range cfg.RefreshWindows {
+		_, isBlacklist := cfg.BlackLists[g]
+		_, isWhitelist := cfg.WhiteLists[g]
+
+		if !isBlacklist && !isWhitelist {
+			return nil, fmt.Errorf("blocking resolver: refresh window group '%s' is unknown", g)
+		}
+	}
+
+	for g := range cfg.BlockedQueryTypes {
+		_, isBlacklist := cfg.BlackLists[g]
+		_, isWhitelist := cfg.WhiteLists[g]
+		_, hasBlockedTLDs := cfg.BlockedTLDs[g]
+
+		if !isBlacklist && !isWhitelist && !hasBlockedTLDs {
+			return nil, fmt.Errorf("blocking resolver: blocked query types group '%s' is unknown", g)
+		}
+	}
+
+	for g := range cfg.CNAMEBlockAction {
+		if _, isBlacklist := cfg.BlackLists[g]; !isBlacklist {
+			return nil, fmt.Errorf("blocking resolver: CNAME block action group '%s' is unknown", g)
+		}
+	}
+
+	if len(cfg.RefreshWindows) > 0 {
+		listOpts = append(listOpts, lists.WithRefreshWindows(cfg.RefreshWindows))
+	}
+
+	if len(cfg.ListFormats) > 0 {
+		if err := checkListFormatSources(&cfg); err != nil {
+			return nil, err
+		}
+
+		listOpts = append(listOpts, lists.WithFormats(cfg.ListFormats))
+	}
+
+	if cfg.ListLoading != config.ListLoadingModeWait {
+		listOpts = append(listOpts, lists.WithAsyncLoading())
+	}
+
+	whitelistMatcher, wlErr := lists.NewListCache(lists.ListCacheTypeWhitelist, cfg.WhiteLists,
+		refreshPeriod, cfg.RefreshJitter, timeout, cfg.DownloadAttempts, cooldown, listOpts...)
+
+	// the whitelist always wins, it is checked before the blacklist for each query
+	blacklistOpts := listOpts
+	if cfg.ListConflicts == config.ListConflictModeWarn {
+		blacklistOpts = append(listOpts[:len(listOpts):len(listOpts)], lists.WithConflictWarnings(whitelistMatcher))
+	}
+
+	blacklistMatcher, blErr := lists.NewListCache(lists.ListCacheTypeBlacklist, cfg.BlackLists,
+		refreshPeriod, cfg.RefreshJitter, timeout, cfg.DownloadAttempts, cooldown, blacklistOpts...)
 	whitelistOnlyGroups := determineWhitelistOnlyGroups(&cfg)
 
+	dryRunGroups := make(map[string]bool, len(cfg.DryRunGroups))
+	for _, g := range cfg.DryRunGroups {
+		dryRunGroups[g] = true
+	}
+
 	var err error
 	if blErr != nil {
 		err = multierror.Append(err, blErr)
@@ -113,6 +223,19 @@ func NewBlockingResolver(cfg config.BlockingConfig, redis *redis.Client) (Chaine
 		return nil, multierror.Prefix(err, "blocking resolver: ")
 	}
 
+	alwaysOnGroups := make(map[string]bool, len(cfg.AlwaysOnGroups))
+
+	for _, g := range cfg.AlwaysOnGroups {
+		_, isBlacklist := cfg.BlackLists[g]
+		_, hasBlockedTLDs := cfg.BlockedTLDs[g]
+
+		if !isBlacklist && !hasBlockedTLDs {
+			return nil, fmt.Errorf("blocking resolver: always-on group '%s' is unknown", g)
+		}
+
+		alwaysOnGroups[g] = true
+	}
+
 	cgb := make(map[string][]string)
 
 	for identifier, cfgGroups := range cfg.ClientGroupsBlock {
@@ -139,12 +262,32 @@ func NewBlockingResolver(cfg config.BlockingConfig, redis *redis.Client) (Chaine
 		clientGroupsBlock: cgb,
 		redisClient:       redis,
 		redisEnabled:      (redis != nil),
+		dryRunGroups:      dryRunGroups,
+		blockedTLDs:       createBlockedTLDs(cfg.BlockedTLDs),
+		alwaysOnGroups:    alwaysOnGroups,
+		dynamicBlocks:     newDynamicBlocks(cfg.DynamicBlocksFile, time.Duration(cfg.DynamicBlockTTL)),
+		listsLoaded:       blacklistMatcher.Loaded(),
+	}
+
+	if h, ok := blockHandler.(ipBlockHandler); ok && cfg.SinkholePTR != "" {
+		res.sinkholeReverseNames = make(map[string]bool, len(h.destinations))
+
+		for _, ip := range h.destinations {
+			reverseName, _ := dns.ReverseAddr(ip.String())
+			res.sinkholeReverseNames[reverseName] = true
+		}
+	}
+
+	if cfg.BlockPage.IsEnabled() {
+		res.blockedRequests = expirationcache.NewCache(expirationcache.WithMaxSize(blockedRequestsCacheSize))
 	}
 
 	if res.redisEnabled {
 		setupRedisEnabledSubscriber(res)
 	}
 
+	res.publishBlockingStatus()
+
 	_ = evt.Bus().Subscribe(evt.ApplicationStarted, func(_ ...string) {
 		go res.initFQDNIPCache()
 	})
@@ -152,6 +295,25 @@ func NewBlockingResolver(cfg config.BlockingConfig, redis *redis.Client) (Chaine
 	return res, nil
 }
 
+// creates a set of lower case TLDs without dots per group
+func createBlockedTLDs(groupToTLDs map[string][]string) map[string]map[string]bool {
+	result := make(map[string]map[string]bool, len(groupToTLDs))
+
+	for group, tlds := range groupToTLDs {
+		set := make(map[string]bool, len(tlds))
+
+		for _, tld := range tlds {
+			if tld = strings.ToLower(strings.Trim(strings.TrimSpace(tld), ".")); tld != "" {
+				set[tld] = true
+			}
+		}
+
+		result[group] = set
+	}
+
+	return result
+}
+
 func setupRedisEnabledSubscriber(c *BlockingResolver) {
 	logger := logger("blocking_resolver")
 
@@ -179,6 +341,85 @@ func (r *BlockingResolver) RefreshLists() {
 	r.whitelistMatcher.Refresh()
 }
 
+// RefreshListGroup triggers the refresh of the black and white lists of one group
+func (r *BlockingResolver) RefreshListGroup(group string) ([]api.ListRefreshResult, error) {
+	blResults, blFound := r.blacklistMatcher.RefreshGroup(group)
+	wlResults, wlFound := r.whitelistMatcher.RefreshGroup(group)
+
+	if !blFound && !wlFound {
+		return nil, fmt.Errorf("list group '%s' is unknown", group)
+	}
+
+	result := make([]api.ListRefreshResult, 0, len(blResults)+len(wlResults))
+	result = appendListRefreshResults(result, lists.ListCacheTypeBlacklist, blResults)
+	result = appendListRefreshResults(result, lists.ListCacheTypeWhitelist, wlResults)
+
+	return result, nil
+}
+
+// ExportList calls the function for each blacklist entry of the group
+func (r *BlockingResolver) ExportList(group string, fn func(entry string)) error {
+	if !r.blacklistMatcher.ForEachEntry(group, fn) {
+		return fmt.Errorf("blacklist group '%s' is unknown", group)
+	}
+
+	return nil
+}
+
+// BlockDomain blocks the domain with all subdomains for all clients until the TTL expires
+func (r *BlockingResolver) BlockDomain(domain string, ttl time.Duration) error {
+	if err := r.dynamicBlocks.block(domain, ttl); err != nil {
+		return err
+	}
+
+	log.Log().Infof("domain '%s' is blocked dynamically", log.EscapeInput(domain))
+
+	return nil
+}
+
+// DynamicBlocks returns the domains blocked at runtime
+func (r *BlockingResolver) DynamicBlocks() []api.DynamicBlock {
+	return r.dynamicBlocks.list()
+}
+
+// ListHits returns the amount of matches per list source, empty if hit counting is disabled
+func (r *BlockingResolver) ListHits() []api.ListSourceHits {
+	result := make([]api.ListSourceHits, 0)
+	result = appendListSourceHits(result, lists.ListCacheTypeBlacklist, r.blacklistMatcher.Hits())
+	result = appendListSourceHits(result, lists.ListCacheTypeWhitelist, r.whitelistMatcher.Hits())
+
+	return result
+}
+
+func appendListSourceHits(result []api.ListSourceHits, listType lists.ListCacheType,
+	hits []lists.SourceHits) []api.ListSourceHits {
+	for _, h := range hits {
+		result = append(result, api.ListSourceHits{
+			ListType: listType.String(),
+			Group:    h.Group,
+			Source:   h.Source,
+			Hits:     h.Hits,
+		})
+	}
+
+	return result
+}
+
+func appendListRefreshResults(result []api.ListRefreshResult, listType lists.ListCacheType,
+	sourceResults []lists.SourceResult) []api.ListRefreshResult {
+	for _, s := range sourceResults {
+		r := api.ListRefreshResult{ListType: listType.String(), Source: s.Source, Entries: s.Count}
+
+		if s.Err != nil {
+			r.Error = s.Err.Error()
+		}
+
+		result = append(result, r)
+	}
+
+	return result
+}
+
 // nolint:prealloc
 func (r *BlockingResolver) retrieveAllBlockingGroups() []string {
 	groups := make(map[string]bool)
@@ -187,6 +428,10 @@ func (r *BlockingResolver) retrieveAllBlockingGroups() []string {
 		groups[group] = true
 	}
 
+	for group := range r.cfg.BlockedTLDs {
+		groups[group] = true
+	}
+
 	var result []string
 	for k := range groups {
 		result = append(result, k)
@@ -214,6 +459,7 @@ func (r *BlockingResolver) internalEnableBlocking() {
 	s.disabledGroups = []string{}
 
 	evt.Bus().Publish(evt.BlockingEnabledEvent, true)
+	r.publishBlockingStatus()
 }
 
 // DisableBlocking deactivates the blocking for a particular duration (or forever if 0).
@@ -231,20 +477,33 @@ func (r *BlockingResolver) DisableBlocking(duration time.Duration, disableGroups
 }
 
 func (r *BlockingResolver) internalDisableBlocking(duration time.Duration, disableGroups []string) error {
+	allBlockingGroups := r.retrieveAllBlockingGroups()
+
+	for _, g := range disableGroups {
+		i := sort.SearchStrings(allBlockingGroups, g)
+		if !(i < len(allBlockingGroups) && allBlockingGroups[i] == g) {
+			return fmt.Errorf("group '%s' is unknown", g)
+		}
+
+		if r.alwaysOnGroups[g] {
+			return fmt.Errorf("group '%s' is always on and can't be disabled", g)
+		}
+	}
+
 	s := r.status
 	s.enableTimer.Stop()
 	s.enabled = false
-	allBlockingGroups := r.retrieveAllBlockingGroups()
 
 	if len(disableGroups) == 0 {
-		s.disabledGroups = allBlockingGroups
-	} else {
-		for _, g := range disableGroups {
-			i := sort.SearchStrings(allBlockingGroups, g)
-			if !(i < len(allBlockingGroups) && allBlockingGroups[i] == g) {
-				return fmt.Errorf("group '%s' is unknown", g)
+		// always-on groups stay active, if all groups are disabled
+		s.disabledGroups = make([]string, 0, len(allBlockingGroups))
+
+		for _, g := range allBlockingGroups {
+			if !r.alwaysOnGroups[g] {
+				s.disabledGroups = append(s.disabledGroups, g)
 			}
 		}
+	} else {
 		s.disabledGroups = disableGroups
 	}
 
@@ -263,9 +522,21 @@ func (r *BlockingResolver) internalDisableBlocking(duration time.Duration, disab
 		})
 	}
 
+	r.publishBlockingStatus()
+
 	return nil
 }
 
+// publishBlockingStatus publishes the blocking state of all groups and the time of automatic enabling
+func (r *BlockingResolver) publishBlockingStatus() {
+	var autoEnableAt time.Time
+	if !r.status.enabled && r.status.disableEnd.After(time.Now()) {
+		autoEnableAt = r.status.disableEnd
+	}
+
+	evt.Bus().Publish(evt.BlockingStatusChanged, r.retrieveAllBlockingGroups(), r.status.disabledGroups, autoEnableAt)
+}
+
 // BlockingStatus returns the current blocking status
 func (r *BlockingResolver) BlockingStatus() api.BlockingStatus {
 	var autoEnableDuration time.Duration
@@ -277,7 +548,23 @@ func (r *BlockingResolver) BlockingStatus() api.BlockingStatus {
 		Enabled:         r.status.enabled,
 		DisabledGroups:  r.status.disabledGroups,
 		AutoEnableInSec: uint(autoEnableDuration.Seconds()),
+		AlwaysOnGroups:  r.sortedAlwaysOnGroups(),
+	}
+}
+
+func (r *BlockingResolver) sortedAlwaysOnGroups() []string {
+	if len(r.alwaysOnGroups) == 0 {
+		return nil
+	}
+
+	result := make([]string, 0, len(r.alwaysOnGroups))
+	for g := range r.alwaysOnGroups {
+		result = append(result, g)
 	}
+
+	sort.Strings(result)
+
+	return result
 }
 
 // returns groups, which have only whitelist entries
@@ -286,7 +573,8 @@ func determineWhitelistOnlyGroups(cfg *config.BlockingConfig) (result map[string
 
 	for g, links := range cfg.WhiteLists {
 		if len(links) > 0 {
-			if _, found := cfg.BlackLists[g]; !found {
+			_, hasBlockedTLDs := cfg.BlockedTLDs[g]
+			if _, found := cfg.BlackLists[g]; !found && !hasBlockedTLDs {
 				result[g] = true
 			}
 		}
@@ -297,15 +585,86 @@ func determineWhitelistOnlyGroups(cfg *config.BlockingConfig) (result map[string
 
 // sets answer and/or return code for DNS response, if request should be blocked
 func (r *BlockingResolver) handleBlocked(logger *logrus.Entry,
-	request *model.Request, question dns.Question, reason string) (*model.Response, error) {
+	request *model.Request, res blockCheckResult) (*model.Response, error) {
 	response := new(dns.Msg)
 	response.SetReply(request.Req)
 
-	r.blockHandler.handleBlock(question, response)
+	text, hasText := r.blockTXTResponse(res.group)
 
-	logger.Debugf("blocking request '%s'", reason)
+	switch {
+	case hasText && res.question.Qtype == dns.TypeTXT:
+		response.Answer = append(response.Answer, r.createBlockTXTAnswer(res.question, text))
+	case res.cnameTarget != "" && res.cnameAction == config.CNAMEBlockActionNxdomain:
+		response.Rcode = dns.RcodeNameError
+	case res.cnameTarget != "" && res.cnameAction == config.CNAMEBlockActionCname:
+		response.Answer = cnameChainUntil(res.question.Name, res.cnameTarget, res.response.Answer)
+	default:
+		r.blockHandler.handleBlock(res.question, response)
+	}
 
-	return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: reason}, nil
+	logger.Debugf("blocking request '%s'", res.reason)
+
+	if r.blockedRequests != nil {
+		r.blockedRequests.Put(blockedRequestKey(request.ClientIP, res.question.Name), res.reason,
+			time.Duration(r.cfg.BlockTTL))
+	}
+
+	return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: res.reason}, nil
+}
+
+// BlockedRequest returns the reason of a recently blocked request of the client for the domain.
+// The requests are only recorded if the block page is enabled
+func (r *BlockingResolver) BlockedRequest(clientIP net.IP, domain string) (reason string, found bool) {
+	if r.blockedRequests == nil {
+		return "", false
+	}
+
+	val, _ := r.blockedRequests.Get(blockedRequestKey(clientIP, domain))
+	if val == nil {
+		return "", false
+	}
+
+	return val.(string), true
+}
+
+func blockedRequestKey(clientIP net.IP, domain string) string {
+	return clientIP.String() + " " + strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// blockTXTResponse returns the configured TXT response text of the group, the text of the "default" entry
+// is used for groups without own text
+func (r *BlockingResolver) blockTXTResponse(group string) (text string, found bool) {
+	if text, found = r.cfg.BlockTXTResponse[group]; found {
+		return text, found
+	}
+
+	text, found = r.cfg.BlockTXTResponse["default"]
+
+	return text, found
+}
+
+// createBlockTXTAnswer creates a TXT record with the text, split in strings of max. 255 characters
+func (r *BlockingResolver) createBlockTXTAnswer(question dns.Question, text string) dns.RR {
+	const maxTXTStringLen = 255
+
+	var parts []string
+
+	for len(text) > maxTXTStringLen {
+		parts = append(parts, text[:maxTXTStringLen])
+		text = text[maxTXTStringLen:]
+	}
+
+	parts = append(parts, text)
+
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   question.Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    uint32(time.Duration(r.cfg.BlockTTL).Seconds()),
+		},
+		Txt: parts,
+	}
 }
 
 // Configuration returns the current resolver configuration
@@ -327,6 +686,66 @@ func (r *BlockingResolver) Configuration() (result []string) {
 
 		result = append(result, fmt.Sprintf("FailStartOnListError = %t", r.cfg.FailStartOnListError))
 
+		if r.cfg.HitCounting {
+			result = append(result, "hitCounting = true")
+		}
+
+		if len(r.alwaysOnGroups) > 0 {
+			result = append(result, fmt.Sprintf("alwaysOnGroups = \"%s\"", strings.Join(r.sortedAlwaysOnGroups(), ";")))
+		}
+
+		if len(r.cfg.DryRunGroups) > 0 {
+			result = append(result, fmt.Sprintf("dryRunGroups = \"%s\"", strings.Join(r.cfg.DryRunGroups, ";")))
+		}
+
+		if r.cfg.RefreshFailureWebhook != "" {
+			result = append(result, fmt.Sprintf("refreshFailureWebhook = %s", util.RedactURL(r.cfg.RefreshFailureWebhook)))
+		}
+
+		if r.cfg.DynamicBlocksFile != "" {
+			result = append(result, fmt.Sprintf("dynamicBlocksFile = %s", r.cfg.DynamicBlocksFile))
+		}
+
+		if len(r.sinkholeReverseNames) > 0 {
+			result = append(result, fmt.Sprintf("sinkholePtr = %s", r.cfg.SinkholePTR))
+		}
+
+		result = append(result, fmt.Sprintf("listConflicts = %s", r.cfg.ListConflicts))
+
+		if r.cfg.ListLoading == config.ListLoadingModeHold {
+			result = append(result, fmt.Sprintf("listLoading = %s (%s)", r.cfg.ListLoading, r.cfg.ListLoadingHoldTime.String()))
+		} else {
+			result = append(result, fmt.Sprintf("listLoading = %s", r.cfg.ListLoading))
+		}
+
+		if len(r.cfg.BlockTXTResponse) > 0 {
+			result = append(result, "blockTxtResponse:")
+			for group, text := range r.cfg.BlockTXTResponse {
+				result = append(result, fmt.Sprintf("  %s = \"%s\"", group, text))
+			}
+		}
+
+		if len(r.cfg.CNAMEBlockAction) > 0 {
+			result = append(result, "cnameBlockAction:")
+			for group, action := range r.cfg.CNAMEBlockAction {
+				result = append(result, fmt.Sprintf("  %s = %s", group, action))
+			}
+		}
+
+		if len(r.cfg.BlockedQueryTypes) > 0 {
+			result = append(result, "blockedQueryTypes:")
+			for group, types := range r.cfg.BlockedQueryTypes {
+				result = append(result, fmt.Sprintf("  %s = \"%s\"", group, types))
+			}
+		}
+
+		if len(r.cfg.BlockedTLDs) > 0 {
+			result = append(result, "blockedTLDs:")
+			for group, tlds := range r.cfg.BlockedTLDs {
+				result = append(result, fmt.Sprintf("  %s = \"%s\"", group, strings.Join(tlds, ";")))
+			}
+		}
+
 		result = append(result, "blacklist:")
 		for _, c := range r.blacklistMatcher.Configuration() {
 			result = append(result, fmt.Sprintf("  %s", c))
@@ -343,74 +762,275 @@ func (r *BlockingResolver) Configuration() (result []string) {
 	return result
 }
 
-func (r *BlockingResolver) hasWhiteListOnlyAllowed(groupsToCheck []string) bool {
+func (r *BlockingResolver) hasWhiteListOnlyAllowed(groupsToCheck []string) (bool, string) {
 	for _, group := range groupsToCheck {
 		if _, found := r.whitelistOnlyGroups[group]; found {
-			return true
+			return true, group
 		}
 	}
 
-	return false
+	return false, ""
 }
 
-func (r *BlockingResolver) handleBlacklist(groupsToCheck []string,
-	request *model.Request, logger *logrus.Entry) (*model.Response, error) {
-	logger.WithField("groupsToCheck", strings.Join(groupsToCheck, "; ")).Debug("checking groups for request")
-	whitelistOnlyAllowed := r.hasWhiteListOnlyAllowed(groupsToCheck)
-
+// checks the domains of the request's questions against white and black lists of passed groups
+func (r *BlockingResolver) checkQuestions(groupsToCheck []string, request *model.Request,
+	logger *logrus.Entry) (result blockCheckResult) {
 	for _, question := range request.Req.Question {
 		domain := util.ExtractDomain(question)
 		logger := logger.WithField("domain", domain)
+		// the whitelists of all groups apply, the blocking only of the groups blocking the query type
+		blockingGroups := r.groupsBlockingType(groupsToCheck, question.Qtype)
+		whitelistOnlyAllowed, whitelistOnlyGroup := r.hasWhiteListOnlyAllowed(blockingGroups)
 
 		if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, domain); whitelisted {
 			logger.WithField("group", group).Debugf("domain is whitelisted")
-			return r.next.Resolve(request)
+
+			return blockCheckResult{whitelisted: true}
+		}
+
+		if excepted, group := r.blacklistMatcher.MatchException(domain, groupsToCheck); excepted {
+			logger.WithField("group", group).Debugf("domain is an exception rule of the blacklist")
+
+			return blockCheckResult{whitelisted: true}
 		}
 
 		if whitelistOnlyAllowed {
-			return r.handleBlocked(logger, request, question, "BLOCKED (WHITELIST ONLY)")
+			return blockCheckResult{reason: "BLOCKED (WHITELIST ONLY)", group: whitelistOnlyGroup, question: question}
+		}
+
+		if blocked, group := r.matches(blockingGroups, r.blacklistMatcher, domain); blocked {
+			return blockCheckResult{reason: fmt.Sprintf("BLOCKED (%s)", group), group: group, question: question}
+		}
+
+		if blocked, group := r.matchesTLD(blockingGroups, domain); blocked {
+			return blockCheckResult{reason: fmt.Sprintf("BLOCKED TLD (%s)", group), group: group, question: question}
 		}
+	}
+
+	return result
+}
 
-		if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, domain); blocked {
-			return r.handleBlocked(logger, request, question, fmt.Sprintf("BLOCKED (%s)", group))
+// answerSinkholePTR returns the PTR answer for reverse lookups of the custom block IPs or nil
+func (r *BlockingResolver) answerSinkholePTR(request *model.Request) *model.Response {
+	question := request.Req.Question[0]
+
+	if question.Qtype != dns.TypePTR || !r.sinkholeReverseNames[strings.ToLower(dns.Fqdn(question.Name))] {
+		return nil
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+	response.Answer = []dns.RR{&dns.PTR{
+		Hdr: dns.RR_Header{
+			Name:   question.Name,
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    uint32(time.Duration(r.cfg.BlockTTL).Seconds()),
+		},
+		Ptr: dns.Fqdn(r.cfg.SinkholePTR),
+	}}
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "SINKHOLE PTR"}
+}
+
+// checkDynamicBlocks checks the questions against the domains blocked at runtime, they apply to all clients
+func (r *BlockingResolver) checkDynamicBlocks(request *model.Request) (result blockCheckResult) {
+	for _, question := range request.Req.Question {
+		if r.dynamicBlocks.match(util.ExtractDomain(question)) {
+			return blockCheckResult{reason: "BLOCKED (DYNAMIC)", question: question}
 		}
 	}
 
-	return nil, nil
+	return result
+}
+
+// checks the IPs and CNAMEs of the response against white and black lists of passed groups
+func (r *BlockingResolver) checkResponse(groupsToCheck []string, request *model.Request, response *dns.Msg,
+	logger *logrus.Entry) (result blockCheckResult) {
+	blockingGroups := r.groupsBlockingType(groupsToCheck, request.Req.Question[0].Qtype)
+
+	for _, rr := range response.Answer {
+		entryToCheck, tName := extractEntryToCheckFromResponse(rr)
+		if len(entryToCheck) > 0 {
+			logger := logger.WithField("response_entry", entryToCheck)
+
+			if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, entryToCheck); whitelisted {
+				logger.WithField("group", group).Debugf("%s is whitelisted", tName)
+			} else if blocked, group := r.matches(blockingGroups, r.blacklistMatcher, entryToCheck); blocked {
+				result := blockCheckResult{
+					reason:   fmt.Sprintf("BLOCKED %s (%s)", tName, group),
+					group:    group,
+					question: request.Req.Question[0],
+				}
+
+				if _, isCNAME := rr.(*dns.CNAME); isCNAME {
+					result.cnameAction = r.cfg.CNAMEBlockAction[group]
+					result.cnameTarget = entryToCheck
+					result.response = response
+
+					if result.cnameAction == config.CNAMEBlockActionOriginal {
+						logger.WithField("group", group).Debug("CNAME target is blocked, keeping the original answer")
+
+						continue
+					}
+				}
+
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// waitForLists returns true if the initial load of the lists is complete, in hold mode it waits up to the hold time.
+// In wait mode the server starts after the first load attempt, failed groups are not waited for
+func (r *BlockingResolver) waitForLists() bool {
+	select {
+	case <-r.listsLoaded:
+		return true
+	default:
+	}
+
+	if r.cfg.ListLoading == config.ListLoadingModeWait {
+		return true
+	}
+
+	if r.cfg.ListLoading != config.ListLoadingModeHold {
+		return false
+	}
+
+	timer := time.NewTimer(time.Duration(r.cfg.ListLoadingHoldTime))
+	defer timer.Stop()
+
+	select {
+	case <-r.listsLoaded:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 // Resolve checks the query against the blacklist and delegates to next resolver if domain is not blocked
 func (r *BlockingResolver) Resolve(request *model.Request) (*model.Response, error) {
 	logger := withPrefix(request.Log, "blacklist_resolver")
-	groupsToCheck := r.groupsToCheckForClient(request)
+
+	if response := r.answerSinkholePTR(request); response != nil {
+		logger.Debug("answering PTR query of sinkhole IP")
+
+		return response, nil
+	}
+
+	if res := r.checkDynamicBlocks(request); res.reason != "" {
+		return r.handleBlocked(logger.WithField("domain", util.ExtractDomain(res.question)), request, res)
+	}
+
+	if !r.waitForLists() {
+		if r.cfg.ListLoading == config.ListLoadingModePassThrough {
+			logger.Debug("lists are loading, query is resolved without blocking")
+
+			return r.next.Resolve(request)
+		}
+
+		logger.Debug("lists are loading, query is refused")
+
+		response := new(dns.Msg)
+		response.SetRcode(request.Req, dns.RcodeRefused)
+
+		return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: "LISTS LOADING"}, nil
+	}
+
+	groupsToCheck, dryRunGroups := r.splitDryRunGroups(r.groupsToCheckForClient(request))
 
 	if len(groupsToCheck) > 0 {
-		resp, err := r.handleBlacklist(groupsToCheck, request, logger)
-		if resp != nil || err != nil {
-			return resp, err
+		logger.WithField("groupsToCheck", strings.Join(groupsToCheck, "; ")).Debug("checking groups for request")
+
+		res := r.checkQuestions(groupsToCheck, request, logger)
+		if res.whitelisted {
+			return r.next.Resolve(request)
+		}
+
+		if res.reason != "" {
+			return r.handleBlocked(logger.WithField("domain", util.ExtractDomain(res.question)), request, res)
 		}
 	}
 
-	respFromNext, err := r.next.Resolve(request)
+	var dryRun blockCheckResult
+	if len(dryRunGroups) > 0 {
+		dryRun = r.checkQuestions(dryRunGroups, request, logger)
+	}
 
-	if err == nil && len(groupsToCheck) > 0 && respFromNext.Res != nil {
-		for _, rr := range respFromNext.Res.Answer {
-			entryToCheck, tName := extractEntryToCheckFromResponse(rr)
-			if len(entryToCheck) > 0 {
-				logger := logger.WithField("response_entry", entryToCheck)
+	respFromNext, err := r.next.Resolve(request)
 
-				if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, entryToCheck); whitelisted {
-					logger.WithField("group", group).Debugf("%s is whitelisted", tName)
-				} else if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, entryToCheck); blocked {
-					return r.handleBlocked(logger, request, request.Req.Question[0], fmt.Sprintf("BLOCKED %s (%s)", tName, group))
-				}
+	if err == nil && respFromNext.Res != nil {
+		if len(groupsToCheck) > 0 {
+			if res := r.checkResponse(groupsToCheck, request, respFromNext.Res, logger); res.reason != "" {
+				return r.handleBlocked(logger, request, res)
 			}
 		}
+
+		if len(dryRunGroups) > 0 && !dryRun.whitelisted && dryRun.reason == "" {
+			dryRun = r.checkResponse(dryRunGroups, request, respFromNext.Res, logger)
+		}
+
+		if dryRun.reason != "" {
+			r.handleDryRun(logger, respFromNext, dryRun)
+		}
 	}
 
 	return respFromNext, err
 }
 
+// splits passed groups in groups with active blocking and groups in dry run mode
+func (r *BlockingResolver) splitDryRunGroups(groups []string) (blockingGroups, dryRunGroups []string) {
+	for _, g := range groups {
+		if r.dryRunGroups[g] {
+			dryRunGroups = append(dryRunGroups, g)
+		} else {
+			blockingGroups = append(blockingGroups, g)
+		}
+	}
+
+	return
+}
+
+// logs the match of a group in dry run mode and notes it in the response's reason
+func (r *BlockingResolver) handleDryRun(logger *logrus.Entry, response *model.Response, res blockCheckResult) {
+	logger.WithField("group", res.group).Infof("dry run: request would be blocked '%s'", res.reason)
+
+	evt.Bus().Publish(evt.BlockingDryRunMatch, res.group)
+
+	response.Reason = fmt.Sprintf("%s, WOULD BE %s", response.Reason, res.reason)
+}
+
+// cnameChainUntil returns the CNAME records of the chain starting with name until the CNAME pointing to the target
+func cnameChainUntil(name, target string, answer []dns.RR) (result []dns.RR) {
+	for {
+		var next *dns.CNAME
+
+		for _, rr := range answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+				next = cname
+
+				break
+			}
+		}
+
+		// stop at the end of the chain or the blocked target, max. one loop over all records to handle cycles
+		if next == nil || len(result) == len(answer) {
+			return result
+		}
+
+		result = append(result, next)
+
+		if util.ExtractDomainOnly(next.Target) == target {
+			return result
+		}
+
+		name = next.Target
+	}
+}
+
 func extractEntryToCheckFromResponse(rr dns.RR) (entryToCheck string, tName string) {
 	switch v := rr.(type) {
 	case *dns.A:
@@ -491,6 +1111,23 @@ func (r *BlockingResolver) groupsToCheckForClient(request *model.Request) []stri
 	return result
 }
 
+// groupsBlockingType returns the groups, which block queries of the type. Groups without blocked query types block all
+func (r *BlockingResolver) groupsBlockingType(groups []string, qType uint16) []string {
+	if len(r.cfg.BlockedQueryTypes) == 0 {
+		return groups
+	}
+
+	result := make([]string, 0, len(groups))
+
+	for _, g := range groups {
+		if types, found := r.cfg.BlockedQueryTypes[g]; !found || types.Contains(qType) {
+			result = append(result, g)
+		}
+	}
+
+	return result
+}
+
 func (r *BlockingResolver) matches(groupsToCheck []string, m lists.Matcher,
 	domain string) (blocked bool, group string) {
 	if len(groupsToCheck) > 0 {
@@ -503,6 +1140,23 @@ func (r *BlockingResolver) matches(groupsToCheck []string, m lists.Matcher,
 	return false, ""
 }
 
+// checks the last label of the domain against the blocked TLDs of passed groups
+func (r *BlockingResolver) matchesTLD(groupsToCheck []string, domain string) (blocked bool, group string) {
+	if len(r.blockedTLDs) == 0 {
+		return false, ""
+	}
+
+	tld := domain[strings.LastIndex(domain, ".")+1:]
+
+	for _, g := range groupsToCheck {
+		if r.blockedTLDs[g][tld] {
+			return true, g
+		}
+	}
+
+	return false, ""
+}
+
 type blockHandler interface {
 	handleBlock(question dns.Question, response *dns.Msg)
 }
@@ -529,7 +1183,7 @@ func (b zeroIPBlockHandler) handleBlock(question dns.Question, response *dns.Msg
 	case dns.TypeA:
 		zeroIP = net.IPv4zero
 	default:
-		response.Rcode = dns.RcodeNameError
+		// no address record type: NODATA (NOERROR with empty answer)
 		return
 	}
 
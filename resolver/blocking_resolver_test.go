@@ -1,6 +1,11 @@
 package resolver
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/0xERR0R/blocky/api"
 	"github.com/0xERR0R/blocky/config"
 	. "github.com/0xERR0R/blocky/evt"
 	. "github.com/0xERR0R/blocky/helpertest"
@@ -13,6 +18,8 @@ import (
 	"github.com/creasty/defaults"
 
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
@@ -107,6 +114,89 @@ var _ = Describe("BlockingResolver", func() {
 		})
 	})
 
+	Describe("Refresh of one list group", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"gr1": {group1File.Name(), "/wrong/path/to/file"},
+					"gr2": {group2File.Name()},
+				},
+				WhiteLists: map[string][]string{
+					"gr1": {"whitelisted.com\nother.com\n"},
+				},
+			}
+		})
+		When("group is defined", func() {
+			It("should refresh only this group and return the result per list", func() {
+				refreshed := make(map[string]bool)
+				handler := func(_ lists.ListCacheType, group string, _ int) {
+					refreshed[group] = true
+				}
+				Expect(Bus().Subscribe(BlockingCacheGroupChanged, handler)).Should(Succeed())
+				DeferCleanup(func() {
+					Expect(Bus().Unsubscribe(BlockingCacheGroupChanged, handler)).Should(Succeed())
+				})
+
+				results, err := sut.RefreshListGroup("gr1")
+				Expect(err).Should(Succeed())
+				Expect(refreshed).Should(Equal(map[string]bool{"gr1": true}))
+
+				Expect(results).Should(HaveLen(3))
+				Expect(results[0]).Should(Equal(api.ListRefreshResult{
+					ListType: "blacklist", Source: group1File.Name(), Entries: 1,
+				}))
+				Expect(results[1].Source).Should(Equal("/wrong/path/to/file"))
+				Expect(results[1].Entries).Should(BeZero())
+				Expect(results[1].Error).Should(ContainSubstring("no such file or directory"))
+				Expect(results[2]).Should(Equal(api.ListRefreshResult{
+					ListType: "whitelist", Source: "[INLINE DEFINITION]", Entries: 2,
+				}))
+			})
+		})
+		When("group is not defined", func() {
+			It("should return an error", func() {
+				_, err := sut.RefreshListGroup("unknown")
+				Expect(err).Should(MatchError("list group 'unknown' is unknown"))
+			})
+		})
+	})
+
+	Describe("Hit counting", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"gr1": {group1File.Name()},
+				},
+				WhiteLists: map[string][]string{
+					"gr1": {"whitelisted.com\n"},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1"},
+				},
+				HitCounting: true,
+			}
+		})
+		When("hit counting is enabled", func() {
+			It("should return the matches per list source", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "client1"))
+				Expect(resp.Reason).Should(Equal("BLOCKED (gr1)"))
+
+				Expect(sut.ListHits()).Should(Equal([]api.ListSourceHits{
+					{ListType: "blacklist", Group: "gr1", Source: group1File.Name(), Hits: 1},
+					{ListType: "whitelist", Group: "gr1", Source: "[INLINE DEFINITION]", Hits: 0},
+				}))
+			})
+
+			It("should print the hit counting configuration", func() {
+				Expect(sut.Configuration()).Should(ContainElement("hitCounting = true"))
+			})
+		})
+	})
+
 	Describe("Blocking with full-qualified client name", func() {
 		BeforeEach(func() {
 			sutConfig = config.BlockingConfig{
@@ -201,17 +291,17 @@ var _ = Describe("BlockingResolver", func() {
 
 				Expect(resp.Res.Answer).Should(BeDNSRecord("domain1.com.", dns.TypeAAAA, 21600, "::"))
 			})
-			It("should block the HTTPS query if domain is on the black list", func() {
+			It("should block the HTTPS query with NODATA if domain is on the black list", func() {
 				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeHTTPS, "1.2.1.2", "client1"))
 
-				expectedReturnCode = dns.RcodeNameError
-				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
 			})
-			It("should block the MX query if domain is on the black list", func() {
+			It("should block the MX query with NODATA if domain is on the black list", func() {
 				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeMX, "1.2.1.2", "client1"))
 
-				expectedReturnCode = dns.RcodeNameError
-				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
 			})
 		})
 
@@ -310,6 +400,15 @@ var _ = Describe("BlockingResolver", func() {
 				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
 				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
 			})
+
+			It("should return NXDOMAIN for all query types", func() {
+				for _, qType := range []uint16{dns.TypeAAAA, dns.TypeMX, dns.TypeHTTPS} {
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", qType, "1.2.1.2", "unknown"))
+
+					Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+					Expect(resp.Res.Answer).Should(BeEmpty())
+				}
+			})
 		})
 
 		When("BlockTTL is set", func() {
@@ -374,6 +473,14 @@ var _ = Describe("BlockingResolver", func() {
 				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
 				Expect(resp.Res.Answer).Should(BeDNSRecord("blocked3.com.", dns.TypeAAAA, 21600, "2001:db8:85a3::8a2e:370:7334"))
 			})
+
+			It("should return NODATA for other query types if query is blocked", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeMX, "1.2.1.2", "unknown"))
+
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
 		})
 
 		When("BlockType is custom IP only for ipv4", func() {
@@ -397,6 +504,33 @@ var _ = Describe("BlockingResolver", func() {
 				Expect(resp.Res.Answer).Should(BeDNSRecord("blocked3.com.", dns.TypeAAAA, 21600, "::"))
 			})
 
+			It("should use fallback for other query types and return NODATA", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeSRV, "1.2.1.2", "unknown"))
+
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+
+		When("BlockType is custom IP only for ipv6", func() {
+			BeforeEach(func() {
+				sutConfig = config.BlockingConfig{
+					BlackLists: map[string][]string{
+						"defaultGroup": {defaultGroupFile.Name()},
+					},
+					ClientGroupsBlock: map[string][]string{
+						"default": {"defaultGroup"},
+					},
+					BlockType: "2001:db8::1",
+					BlockTTL:  config.Duration(6 * time.Hour),
+				}
+			})
+
+			It("should use fallback for ipv4 and return zero ip", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("blocked3.com.", dns.TypeA, 21600, "0.0.0.0"))
+			})
 		})
 
 		When("Blacklist contains IP", func() {
@@ -441,6 +575,157 @@ var _ = Describe("BlockingResolver", func() {
 		})
 	})
 
+	Describe("CNAME block action", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"defaultGroup"},
+				},
+				BlockType: "ZeroIP",
+				BlockTTL:  config.Duration(time.Minute),
+			}
+
+			// multi-level chain, only the middle name is blocked
+			rr1, _ := dns.NewRR("example.com 300 IN CNAME domain.com")
+			rr2, _ := dns.NewRR("domain.com 300 IN CNAME badcnamedomain.com")
+			rr3, _ := dns.NewRR("badcnamedomain.com 300 IN CNAME cdn.net")
+			rr4, _ := dns.NewRR("cdn.net 300 IN A 125.125.125.125")
+			mockAnswer = new(dns.Msg)
+			mockAnswer.Answer = []dns.RR{rr1, rr2, rr3, rr4}
+		})
+
+		resolve := func() {
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+		}
+
+		When("no action is defined", func() {
+			It("should answer as a blocked query", func() {
+				resolve()
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED CNAME (defaultGroup)"))
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 60, "0.0.0.0"))
+			})
+		})
+
+		When("action is nxdomain", func() {
+			BeforeEach(func() {
+				sutConfig.CNAMEBlockAction = map[string]config.CNAMEBlockAction{
+					"defaultGroup": config.CNAMEBlockActionNxdomain,
+				}
+				expectedReturnCode = dns.RcodeNameError
+			})
+			It("should answer with NXDOMAIN", func() {
+				resolve()
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+
+		When("action is cname", func() {
+			BeforeEach(func() {
+				sutConfig.CNAMEBlockAction = map[string]config.CNAMEBlockAction{
+					"defaultGroup": config.CNAMEBlockActionCname,
+				}
+			})
+			It("should return the CNAME chain up to the blocked name", func() {
+				resolve()
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].String()).Should(Equal("example.com.\t300\tIN\tCNAME\tdomain.com."))
+				Expect(resp.Res.Answer[1].String()).Should(Equal("domain.com.\t300\tIN\tCNAME\tbadcnamedomain.com."))
+			})
+			It("should follow the chain independent of the record order", func() {
+				mockAnswer.Answer = []dns.RR{
+					mockAnswer.Answer[3], mockAnswer.Answer[1], mockAnswer.Answer[2], mockAnswer.Answer[0],
+				}
+
+				resolve()
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].Header().Name).Should(Equal("example.com."))
+				Expect(resp.Res.Answer[1].Header().Name).Should(Equal("domain.com."))
+			})
+		})
+
+		When("action is original", func() {
+			BeforeEach(func() {
+				sutConfig.CNAMEBlockAction = map[string]config.CNAMEBlockAction{
+					"defaultGroup": config.CNAMEBlockActionOriginal,
+				}
+			})
+			It("should return the original answer", func() {
+				resolve()
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				Expect(resp.Res.Answer).Should(HaveLen(4))
+			})
+			It("should still block IPs of the response", func() {
+				rr, _ := dns.NewRR("cdn.net 300 IN A 123.145.123.145")
+				mockAnswer.Answer[3] = rr
+
+				resolve()
+				Expect(resp.Reason).Should(Equal("BLOCKED IP (defaultGroup)"))
+			})
+			It("should print the action", func() {
+				Expect(sut.Configuration()).Should(ContainElements("cnameBlockAction:", "  defaultGroup = original"))
+			})
+		})
+	})
+
+	Describe("Blocked query types", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"tracking":     {group1File.Name()},
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"tracking", "defaultGroup"},
+				},
+				BlockedQueryTypes: map[string]config.QueryTypes{"tracking": {dns.TypeA, dns.TypeAAAA}},
+				BlockType:         "ZeroIP",
+				BlockTTL:          config.Duration(time.Minute),
+			}
+		})
+
+		When("the query type is blocked by the group", func() {
+			It("should block the query", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeAAAA, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED (tracking)"))
+			})
+		})
+
+		When("the query type is not blocked by the group", func() {
+			It("should resolve the query", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				m.AssertExpectations(GinkgoT())
+			})
+
+			It("should not block the IPs of the response", func() {
+				rr, _ := dns.NewRR("example.com 300 IN CNAME domain1.com")
+				mockAnswer.Answer = []dns.RR{rr}
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+		})
+
+		When("the group has no blocked query types", func() {
+			It("should block all query types", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+			})
+		})
+
+		It("should print the blocked query types", func() {
+			Expect(sut.Configuration()).Should(ContainElements("blockedQueryTypes:", "  tracking = \"A, AAAA\""))
+		})
+	})
+
 	Describe("Whitelisting", func() {
 		When("Requested domain is on black and white list", func() {
 			BeforeEach(func() {
@@ -582,6 +867,646 @@ var _ = Describe("BlockingResolver", func() {
 
 	})
 
+	Describe("Blocking TLDs", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlockedTLDs: map[string][]string{
+					"phishing": {"zip", ".MOV"},
+				},
+				WhiteLists: map[string][]string{
+					"phishing": {"allowed.zip\n"},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"phishing"},
+				},
+			}
+		})
+		When("domain has a blocked TLD", func() {
+			It("should block the query case-insensitively", func() {
+				resp, err = sut.Resolve(newRequestWithClient("Some.Domain.ZIP.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED TLD (phishing)"))
+				Expect(resp.Res.Answer).Should(BeDNSRecord("Some.Domain.ZIP.", dns.TypeA, 60, "0.0.0.0"))
+
+				resp, err = sut.Resolve(newRequestWithClient("video.mov.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			})
+		})
+		When("domain with blocked TLD is whitelisted", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequestWithClient("allowed.zip.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+		When("domain only contains a blocked TLD as label", func() {
+			It("should not block the query", func() {
+				resp, err = sut.Resolve(newRequestWithClient("zip.example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+		})
+		When("blocking is disabled for the TLD group", func() {
+			It("should not block the query", func() {
+				Expect(sut.DisableBlocking(0, []string{"phishing"})).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("domain.zip.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+		})
+	})
+
+	Describe("Block page", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "192.168.178.2",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"gr1": {group1File.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1"},
+				},
+				BlockPage: config.BlockPageConfig{Port: config.ListenConfig{"8080"}},
+			}
+		})
+		When("block page is enabled", func() {
+			It("should record the blocked requests per client", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "client1"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+
+				reason, found := sut.BlockedRequest(net.ParseIP("1.2.1.2"), "DOMAIN1.com")
+				Expect(found).Should(BeTrue())
+				Expect(reason).Should(Equal("BLOCKED (gr1)"))
+
+				_, found = sut.BlockedRequest(net.ParseIP("1.2.1.3"), "domain1.com")
+				Expect(found).Should(BeFalse())
+			})
+		})
+		When("block page is disabled", func() {
+			BeforeEach(func() {
+				sutConfig.BlockPage = config.BlockPageConfig{}
+			})
+			It("should not record the blocked requests", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "client1"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+
+				_, found := sut.BlockedRequest(net.ParseIP("1.2.1.2"), "domain1.com")
+				Expect(found).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("TXT block response", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"gr1":          {group1File.Name()},
+					"gr2":          {group2File.Name()},
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1", "gr2", "defaultGroup"},
+				},
+				BlockTXTResponse: map[string]string{
+					"gr1":     "blocked by gr1",
+					"default": "blocked by blocky",
+				},
+			}
+		})
+		expectTXT := func(name string, txt ...string) {
+			Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			Expect(resp.Res.Answer).Should(HaveLen(1))
+			Expect(resp.Res.Answer[0].Header().Name).Should(Equal(name))
+			Expect(resp.Res.Answer[0].Header().Ttl).Should(BeNumerically("==", 60))
+			Expect(resp.Res.Answer[0].(*dns.TXT).Txt).Should(Equal(txt))
+		}
+		When("TXT query is blocked by a group with own text", func() {
+			It("should return the text of the group", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+
+				expectTXT("domain1.com.", "blocked by gr1")
+			})
+		})
+		When("TXT query is blocked by a group without own text", func() {
+			It("should return the default text", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked2.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+
+				expectTXT("blocked2.com.", "blocked by blocky")
+			})
+		})
+		When("text is longer than 255 characters", func() {
+			BeforeEach(func() {
+				sutConfig.BlockTXTResponse = map[string]string{"default": strings.Repeat("x", 300)}
+			})
+			It("should split the text in multiple strings", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+
+				expectTXT("blocked3.com.", strings.Repeat("x", 255), strings.Repeat("x", 45))
+			})
+		})
+		When("no text is defined for the group", func() {
+			BeforeEach(func() {
+				sutConfig.BlockTXTResponse = map[string]string{"gr1": "blocked by gr1"}
+			})
+			It("should return the response of the block type", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked2.com.", dns.TypeTXT, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+		When("other query type is blocked", func() {
+			It("should return the response of the block type", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("domain1.com.", dns.TypeA, 60, "0.0.0.0"))
+			})
+		})
+	})
+
+	Describe("Block response per query type", func() {
+		// expected answer for address queries, empty for NXDOMAIN
+		type expectation struct {
+			a    string
+			aaaa string
+		}
+
+		DescribeTable("should answer address queries by block type and other queries with NODATA or NXDOMAIN",
+			func(blockType string, expected expectation) {
+				sutConfig = config.BlockingConfig{
+					BlockType: blockType,
+					BlockTTL:  config.Duration(time.Minute),
+					BlackLists: map[string][]string{
+						"defaultGroup": {defaultGroupFile.Name()},
+					},
+					ClientGroupsBlock: map[string][]string{
+						"default": {"defaultGroup"},
+					},
+				}
+
+				tmp, _ := NewBlockingResolver(sutConfig, nil)
+				sut = tmp.(*BlockingResolver)
+				sut.Next(m)
+				sut.RefreshLists()
+
+				nxDomain := expected.a == ""
+				if nxDomain {
+					expectedReturnCode = dns.RcodeNameError
+				}
+
+				for _, qType := range []uint16{
+					dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT, dns.TypeSRV,
+					dns.TypeHTTPS, dns.TypeSVCB, dns.TypePTR, dns.TypeCNAME, dns.TypeNS,
+				} {
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", qType, "1.2.1.2", "unknown"))
+					Expect(err).Should(Succeed())
+
+					Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED), dns.TypeToString[qType])
+					Expect(resp.Res.Rcode).Should(Equal(expectedReturnCode), dns.TypeToString[qType])
+
+					switch {
+					case nxDomain:
+						Expect(resp.Res.Answer).Should(BeEmpty(), dns.TypeToString[qType])
+					case qType == dns.TypeA:
+						Expect(resp.Res.Answer).Should(BeDNSRecord("blocked3.com.", dns.TypeA, 60, expected.a))
+					case qType == dns.TypeAAAA:
+						Expect(resp.Res.Answer).Should(BeDNSRecord("blocked3.com.", dns.TypeAAAA, 60, expected.aaaa))
+					default:
+						Expect(resp.Res.Answer).Should(BeEmpty(), dns.TypeToString[qType])
+					}
+				}
+
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			},
+			Entry("zero IP", "ZEROIP", expectation{a: "0.0.0.0", aaaa: "::"}),
+			Entry("NXDOMAIN", "NXDOMAIN", expectation{}),
+			Entry("custom IPs", "12.12.12.12, 2001:db8::1", expectation{a: "12.12.12.12", aaaa: "2001:db8::1"}),
+			Entry("custom IPv4 only", "12.12.12.12", expectation{a: "12.12.12.12", aaaa: "::"}),
+			Entry("custom IPv6 only", "2001:db8::1", expectation{a: "0.0.0.0", aaaa: "2001:db8::1"}),
+		)
+	})
+
+	Describe("Sinkhole PTR", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType:   "12.12.12.12, 2001:db8::1",
+				BlockTTL:    config.Duration(time.Minute),
+				SinkholePTR: "blocked.blocky",
+			}
+		})
+
+		When("PTR of a block IP is queried", func() {
+			It("should return the sinkhole name", func() {
+				for _, name := range []string{"12.12.12.12.in-addr.arpa.",
+					"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."} {
+					resp, err = sut.Resolve(newRequestWithClient(name, dns.TypePTR, "1.2.1.2", "unknown"))
+
+					Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+					Expect(resp.Reason).Should(Equal("SINKHOLE PTR"))
+					Expect(resp.Res.Answer).Should(BeDNSRecord(name, dns.TypePTR, 60, "blocked.blocky."))
+				}
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+		})
+
+		When("PTR of another IP is queried", func() {
+			It("should delegate to the next resolver", func() {
+				resp, err = sut.Resolve(newRequestWithClient("13.12.12.12.in-addr.arpa.", dns.TypePTR, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+
+		When("block type is zero IP", func() {
+			BeforeEach(func() {
+				sutConfig.BlockType = "ZEROIP"
+			})
+
+			It("should not answer PTR queries", func() {
+				resp, err = sut.Resolve(newRequestWithClient("0.0.0.0.in-addr.arpa.", dns.TypePTR, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+		})
+	})
+
+	Describe("Dry run", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"gr1":          {group1File.Name()},
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1", "defaultGroup"},
+				},
+				DryRunGroups: []string{"gr1"},
+			}
+		})
+		When("domain is on the black list of a group in dry run mode", func() {
+			It("should delegate to next resolver and note the match in the reason", func() {
+				var dryRunGroup string
+
+				err = Bus().SubscribeOnce(BlockingDryRunMatch, func(group string) {
+					dryRunGroup = group
+				})
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				m.AssertExpectations(GinkgoT())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				Expect(resp.Reason).Should(HaveSuffix("WOULD BE BLOCKED (gr1)"))
+				Expect(dryRunGroup).Should(Equal("gr1"))
+			})
+		})
+		When("domain is on the black list of a group with active blocking", func() {
+			It("should block the query", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+			})
+		})
+		When("response contains an IP on the black list of a group in dry run mode", func() {
+			BeforeEach(func() {
+				sutConfig.DryRunGroups = []string{"defaultGroup"}
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 300, dns.TypeA, "123.145.123.145")
+			})
+			It("should not block the response", func() {
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 300, "123.145.123.145"))
+				Expect(resp.Reason).Should(HaveSuffix("WOULD BE BLOCKED IP (defaultGroup)"))
+			})
+		})
+	})
+
+	Describe("Always-on groups", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"defaultGroup": {defaultGroupFile.Name()},
+					"group1":       {group1File.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"defaultGroup", "group1"},
+				},
+				AlwaysOnGroups: []string{"group1"},
+				BlockType:      "ZeroIP",
+			}
+		})
+		When("blocking is disabled for all groups", func() {
+			It("should keep blocking with always-on groups", func() {
+				Expect(sut.DisableBlocking(0, []string{})).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "unknown"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+
+				status := sut.BlockingStatus()
+				Expect(status.Enabled).Should(BeFalse())
+				Expect(status.DisabledGroups).Should(Equal([]string{"default", "defaultGroup"}))
+				Expect(status.AlwaysOnGroups).Should(Equal([]string{"group1"}))
+			})
+		})
+		When("an always-on group should be disabled", func() {
+			It("should return an error", func() {
+				Expect(sut.DisableBlocking(0, []string{"group1"})).
+					Should(MatchError("group 'group1' is always on and can't be disabled"))
+				Expect(sut.BlockingStatus().Enabled).Should(BeTrue())
+			})
+		})
+		It("should print the always-on groups", func() {
+			Expect(sut.Configuration()).Should(ContainElement("alwaysOnGroups = \"group1\""))
+		})
+	})
+
+	Describe("Dynamic blocks", func() {
+		var blocksFile string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "blocks")
+			Expect(err).Should(Succeed())
+			DeferCleanup(os.RemoveAll, dir)
+
+			blocksFile = filepath.Join(dir, "blocks.json")
+
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				WhiteLists: map[string][]string{
+					"whitelistGroup": {"example.com"},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"defaultGroup"},
+					"1.2.1.3": {"whitelistGroup"},
+				},
+				BlockType:         "ZeroIP",
+				BlockTTL:          config.Duration(time.Minute),
+				DynamicBlocksFile: blocksFile,
+				DynamicBlockTTL:   config.Duration(time.Hour),
+			}
+		})
+		When("a domain is blocked via API", func() {
+			It("should block the domain and all subdomains for all clients", func() {
+				Expect(sut.BlockDomain("Example.com.", 0)).Should(Succeed())
+
+				for _, client := range []string{"1.2.1.2", "1.2.1.3"} {
+					resp, err = sut.Resolve(newRequestWithClient("sub.example.com.", dns.TypeA, client))
+					Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+					Expect(resp.Reason).Should(Equal("BLOCKED (DYNAMIC)"))
+					Expect(resp.Res.Answer).Should(BeDNSRecord("sub.example.com.", dns.TypeA, 60, "0.0.0.0"))
+				}
+
+				resp, err = sut.Resolve(newRequestWithClient("otherexample.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+			It("should keep blocking if blocking is disabled", func() {
+				Expect(sut.BlockDomain("example.com", 0)).Should(Succeed())
+				Expect(sut.DisableBlocking(0, []string{})).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			})
+			It("should return the current dynamic block set", func() {
+				Expect(sut.BlockDomain("example.com", 30*time.Minute)).Should(Succeed())
+				Expect(sut.BlockDomain("blocked.org", 0)).Should(Succeed())
+
+				blocks := sut.DynamicBlocks()
+				Expect(blocks).Should(HaveLen(2))
+				Expect(blocks[0].Domain).Should(Equal("blocked.org"))
+				Expect(blocks[0].RemainingTTLInSec).Should(BeNumerically("~", 3600, 1))
+				Expect(blocks[1].Domain).Should(Equal("example.com"))
+				Expect(blocks[1].RemainingTTLInSec).Should(BeNumerically("~", 1800, 1))
+			})
+			It("should be restored by a new instance", func() {
+				Expect(sut.BlockDomain("example.com", 0)).Should(Succeed())
+				Expect(blocksFile).Should(BeAnExistingFile())
+
+				tmp, err := NewBlockingResolver(sutConfig, nil)
+				Expect(err).Should(Succeed())
+				Expect(tmp.(*BlockingResolver).DynamicBlocks()).Should(HaveLen(1))
+			})
+		})
+		When("the block is expired", func() {
+			It("should delegate the request and remove the entry", func() {
+				Expect(sut.BlockDomain("example.com", time.Millisecond)).Should(Succeed())
+
+				Eventually(func() ResponseType {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+
+					return resp.RType
+				}, "1s").Should(Equal(ResponseTypeRESOLVED))
+				Expect(sut.DynamicBlocks()).Should(BeEmpty())
+			})
+		})
+		When("the domain or TTL is invalid", func() {
+			It("should return an error", func() {
+				Expect(sut.BlockDomain("", 0)).Should(MatchError("invalid domain ''"))
+				Expect(sut.BlockDomain("example.com", -time.Second)).Should(MatchError("invalid TTL '-1s'"))
+				Expect(sut.DynamicBlocks()).Should(BeEmpty())
+			})
+		})
+		It("should print the dynamic blocks file", func() {
+			Expect(sut.Configuration()).Should(ContainElement("dynamicBlocksFile = " + blocksFile))
+		})
+	})
+
+	Describe("Queries during list loading", func() {
+		var (
+			release   chan struct{}
+			newSut    func(mode config.ListLoadingMode) *BlockingResolver
+			slowLists map[string][]string
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				<-release
+				_, _ = rw.Write([]byte("blocked3.com"))
+			}))
+			DeferCleanup(s.Close)
+			DeferCleanup(func() {
+				select {
+				case <-release:
+				default:
+					close(release)
+				}
+			})
+
+			slowLists = map[string][]string{"defaultGroup": {s.URL}}
+
+			newSut = func(mode config.ListLoadingMode) *BlockingResolver {
+				tmp, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:          slowLists,
+					ClientGroupsBlock:   map[string][]string{"default": {"defaultGroup"}},
+					BlockType:           "ZeroIP",
+					BlockTTL:            config.Duration(time.Minute),
+					DownloadTimeout:     config.Duration(10 * time.Second),
+					DownloadAttempts:    1,
+					ListLoading:         mode,
+					ListLoadingHoldTime: config.Duration(100 * time.Millisecond),
+				}, nil)
+				Expect(err).Should(Succeed())
+
+				r := tmp.(*BlockingResolver)
+				r.Next(m)
+
+				return r
+			}
+		})
+
+		When("mode is passThrough", func() {
+			It("should resolve without blocking until the lists are loaded", func() {
+				r := newSut(config.ListLoadingModePassThrough)
+
+				resp, err = r.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+
+				close(release)
+				Eventually(r.listsLoaded, "1s").Should(BeClosed())
+
+				resp, err = r.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			})
+		})
+
+		When("mode is refuse", func() {
+			BeforeEach(func() {
+				expectedReturnCode = dns.RcodeRefused
+			})
+			It("should refuse queries until the lists are loaded", func() {
+				r := newSut(config.ListLoadingModeRefuse)
+
+				resp, err = r.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("LISTS LOADING"))
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+			It("should refuse queries if the initial load of a group failed", func() {
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					// timeout of the client
+					time.Sleep(100 * time.Millisecond)
+				}))
+				DeferCleanup(s.Close)
+
+				tmp, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:        map[string][]string{"defaultGroup": {s.URL}},
+					ClientGroupsBlock: map[string][]string{"default": {"defaultGroup"}},
+					BlockType:         "ZeroIP",
+					DownloadTimeout:   config.Duration(10 * time.Millisecond),
+					DownloadAttempts:  1,
+					ListLoading:       config.ListLoadingModeRefuse,
+				}, nil)
+				Expect(err).Should(Succeed())
+
+				r := tmp.(*BlockingResolver)
+				r.Next(m)
+
+				Consistently(r.listsLoaded, "300ms").ShouldNot(BeClosed())
+
+				resp, err = r.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.Reason).Should(Equal("LISTS LOADING"))
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+		})
+
+		When("mode is hold", func() {
+			It("should answer the query if the lists are loaded within the hold time", func() {
+				r := newSut(config.ListLoadingModeHold)
+
+				time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+				resp, err = r.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+			})
+			It("should refuse the query after the hold time", func() {
+				expectedReturnCode = dns.RcodeRefused
+
+				r := newSut(config.ListLoadingModeHold)
+
+				start := time.Now()
+				resp, err = r.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+				Expect(time.Since(start)).Should(BeNumerically(">=", 100*time.Millisecond))
+				Expect(resp.Reason).Should(Equal("LISTS LOADING"))
+			})
+		})
+
+		When("mode is wait", func() {
+			It("should return after the lists are loaded", func() {
+				time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+				r := newSut(config.ListLoadingModeWait)
+				Expect(r.listsLoaded).Should(BeClosed())
+
+				resp, err = r.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2"))
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			})
+		})
+	})
+
+	Describe("Adblock Plus exception rules", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType: "ZEROIP",
+				BlockTTL:  config.Duration(time.Minute),
+				BlackLists: map[string][]string{
+					"ads":   {"||ads.com^\n@@||allowed.com^\n"},
+					"other": {"allowed.com\n"},
+				},
+				ClientGroupsBlock: map[string][]string{"default": {"ads", "other"}},
+			}
+		})
+		It("should not block the exceptions of a group", func() {
+			resp, err = sut.Resolve(newRequestWithClient("ads.com.", dns.TypeA, "1.2.1.2"))
+			Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+
+			resp, err = sut.Resolve(newRequestWithClient("allowed.com.", dns.TypeA, "1.2.1.2"))
+			Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+		})
+	})
+
+	Describe("Export of a list group", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlockType:  "ZEROIP",
+				BlockTTL:   config.Duration(time.Minute),
+				BlackLists: map[string][]string{"gr1": {group1File.Name(), group2File.Name()}},
+				WhiteLists: map[string][]string{"gr2": {"allowed.com\n"}},
+			}
+		})
+		It("should pass the blacklist entries of the group", func() {
+			var entries []string
+			Expect(sut.ExportList("gr1", func(entry string) {
+				entries = append(entries, entry)
+			})).Should(Succeed())
+
+			Expect(entries).Should(Equal([]string{"blocked2.com", "domain1.com"}))
+		})
+		It("should fail for an unknown or whitelist group", func() {
+			Expect(sut.ExportList("gr2", func(string) {})).Should(MatchError("blacklist group 'gr2' is unknown"))
+		})
+	})
+
 	Describe("Control status via API", func() {
 		BeforeEach(func() {
 			sutConfig = config.BlockingConfig{
@@ -783,6 +1708,40 @@ var _ = Describe("BlockingResolver", func() {
 			})
 		})
 
+		When("Blocking status is changed", func() {
+			It("should publish status of all groups and time of automatic enabling", func() {
+				var (
+					allGroups, disabledGroups []string
+					autoEnableAt              time.Time
+				)
+
+				err := Bus().SubscribeOnce(BlockingStatusChanged, func(groups, disabled []string, enableAt time.Time) {
+					allGroups = groups
+					disabledGroups = disabled
+					autoEnableAt = enableAt
+				})
+				Expect(err).Should(Succeed())
+
+				err = sut.DisableBlocking(time.Minute, []string{"group1"})
+				Expect(err).Should(Succeed())
+
+				Expect(allGroups).Should(ConsistOf("default", "defaultGroup", "group1"))
+				Expect(disabledGroups).Should(ConsistOf("group1"))
+				Expect(time.Until(autoEnableAt)).Should(BeNumerically("~", time.Minute, time.Second))
+
+				err = Bus().SubscribeOnce(BlockingStatusChanged, func(_, disabled []string, enableAt time.Time) {
+					disabledGroups = disabled
+					autoEnableAt = enableAt
+				})
+				Expect(err).Should(Succeed())
+
+				sut.EnableBlocking()
+
+				Expect(disabledGroups).Should(BeEmpty())
+				Expect(autoEnableAt.IsZero()).Should(BeTrue())
+			})
+		})
+
 		When("Disable blocking is called with wrong group name", func() {
 			It("should fail", func() {
 				err := sut.DisableBlocking(500*time.Millisecond, []string{"unknownGroupName"})
@@ -872,6 +1831,56 @@ var _ = Describe("BlockingResolver", func() {
 				Expect(err).Should(HaveOccurred())
 			})
 		})
+		When("always-on group is unknown", func() {
+			It("should return an error", func() {
+				_, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:     map[string][]string{"gr1": {group1File.Name()}},
+					AlwaysOnGroups: []string{"unknown"},
+					BlockType:      "zeroIp",
+				}, nil)
+				Expect(err).Should(MatchError("blocking resolver: always-on group 'unknown' is unknown"))
+			})
+		})
+		When("refresh window group is unknown", func() {
+			It("should return an error", func() {
+				_, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:     map[string][]string{"gr1": {group1File.Name()}},
+					RefreshWindows: map[string]config.RefreshWindow{"unknown": {Start: time.Hour, End: 2 * time.Hour}},
+					BlockType:      "zeroIp",
+				}, nil)
+				Expect(err).Should(MatchError("blocking resolver: refresh window group 'unknown' is unknown"))
+			})
+		})
+		When("list format source is not defined in a list", func() {
+			It("should return an error", func() {
+				_, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:  map[string][]string{"gr1": {group1File.Name()}},
+					ListFormats: map[string]config.ListFormat{"unknown.txt": config.ListFormatHosts},
+					BlockType:   "zeroIp",
+				}, nil)
+				Expect(err).Should(MatchError("blocking resolver: list format source 'unknown.txt' is not defined in a list"))
+			})
+		})
+		When("blocked query types group is unknown", func() {
+			It("should return an error", func() {
+				_, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:        map[string][]string{"gr1": {group1File.Name()}},
+					BlockedQueryTypes: map[string]config.QueryTypes{"unknown": {dns.TypeA}},
+					BlockType:         "zeroIp",
+				}, nil)
+				Expect(err).Should(MatchError("blocking resolver: blocked query types group 'unknown' is unknown"))
+			})
+		})
+		When("CNAME block action group is unknown", func() {
+			It("should return an error", func() {
+				_, err := NewBlockingResolver(config.BlockingConfig{
+					BlackLists:       map[string][]string{"gr1": {group1File.Name()}},
+					CNAMEBlockAction: map[string]config.CNAMEBlockAction{"unknown": config.CNAMEBlockActionNxdomain},
+					BlockType:        "zeroIp",
+				}, nil)
+				Expect(err).Should(MatchError("blocking resolver: CNAME block action group 'unknown' is unknown"))
+			})
+		})
 	})
 
 	Describe("Redis is configured", func() {
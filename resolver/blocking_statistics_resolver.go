@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/hako/durafmt"
+)
+
+// blockedHour contains the amount of blocked queries in the hour beginning with start
+type blockedHour struct {
+	start time.Time
+	count uint
+}
+
+// BlockingStatisticsResolver counts the blocked queries per hour. The counts are kept in a ring buffer with one
+// entry per hour of the retention, older counts are overwritten
+type BlockingStatisticsResolver struct {
+	NextResolver
+	retention time.Duration
+	lock      sync.Mutex
+	hours     []blockedHour
+	now       func() time.Time
+}
+
+// NewBlockingStatisticsResolver returns new resolver instance
+func NewBlockingStatisticsResolver(cfg config.BlockingStatisticsConfig) ChainedResolver {
+	r := &BlockingStatisticsResolver{
+		retention: time.Duration(cfg.Retention),
+		now:       time.Now,
+	}
+
+	if r.retention > 0 {
+		hours := int((r.retention + time.Hour - 1) / time.Hour)
+		r.hours = make([]blockedHour, hours)
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *BlockingStatisticsResolver) Configuration() (result []string) {
+	if len(r.hours) == 0 {
+		return []string{"deactivated"}
+	}
+
+	return []string{fmt.Sprintf("retention = %s", durafmt.Parse(r.retention))}
+}
+
+// Resolve passes the request to the next resolver and counts the response if it was blocked
+func (r *BlockingStatisticsResolver) Resolve(request *model.Request) (*model.Response, error) {
+	resp, err := r.next.Resolve(request)
+
+	if err == nil && len(r.hours) > 0 && resp.RType == model.ResponseTypeBLOCKED {
+		r.countBlocked()
+	}
+
+	return resp, err
+}
+
+// BlockingStatistics returns the amount of blocked queries per hour or per day within the retention, oldest first.
+// Intervals without blocked queries are included with a count of 0
+func (r *BlockingStatisticsResolver) BlockingStatistics(daily bool) []api.BlockingStatistics {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result := make([]api.BlockingStatistics, 0, len(r.hours))
+	current := r.now().Truncate(time.Hour)
+
+	for i := len(r.hours) - 1; i >= 0; i-- {
+		start := current.Add(-time.Duration(i) * time.Hour)
+
+		var count uint
+		if slot := r.hours[r.hourIndex(start)]; slot.start.Equal(start) {
+			count = slot.count
+		}
+
+		if daily {
+			y, m, d := start.Date()
+			start = time.Date(y, m, d, 0, 0, 0, 0, start.Location())
+
+			if last := len(result) - 1; last >= 0 && result[last].Start.Equal(start) {
+				result[last].Blocked += count
+
+				continue
+			}
+		}
+
+		result = append(result, api.BlockingStatistics{Start: start, Blocked: count})
+	}
+
+	return result
+}
+
+func (r *BlockingStatisticsResolver) countBlocked() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hour := r.now().Truncate(time.Hour)
+
+	slot := &r.hours[r.hourIndex(hour)]
+	if !slot.start.Equal(hour) {
+		// slot contains an hour, which is older than the retention
+		*slot = blockedHour{start: hour}
+	}
+
+	slot.count++
+}
+
+func (r *BlockingStatisticsResolver) hourIndex(hour time.Time) int {
+	return int(hour.Unix()/int64(time.Hour.Seconds())) % len(r.hours)
+}
@@ -0,0 +1,134 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("BlockingStatisticsResolver", func() {
+	var (
+		sut   *BlockingStatisticsResolver
+		cfg   config.BlockingStatisticsConfig
+		m     *resolverMock
+		now   time.Time
+		rType ResponseType
+	)
+
+	BeforeEach(func() {
+		cfg = config.BlockingStatisticsConfig{Retention: config.Duration(48 * time.Hour)}
+		now = time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC)
+		rType = ResponseTypeBLOCKED
+	})
+
+	JustBeforeEach(func() {
+		sut = NewBlockingStatisticsResolver(cfg).(*BlockingStatisticsResolver)
+		sut.now = func() time.Time { return now }
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), RType: rType}, nil)
+		sut.Next(m)
+	})
+
+	// resolveAt resolves the amount of queries at the passed time
+	resolveAt := func(t time.Time, count int) {
+		now = t
+
+		for i := 0; i < count; i++ {
+			_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+		}
+	}
+
+	When("queries are blocked", func() {
+		It("should count them per hour", func() {
+			resolveAt(time.Date(2022, 3, 1, 22, 10, 0, 0, time.UTC), 2)
+			resolveAt(time.Date(2022, 3, 2, 9, 59, 0, 0, time.UTC), 1)
+			resolveAt(time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC), 3)
+
+			stats := sut.BlockingStatistics(false)
+			Expect(stats).Should(HaveLen(48))
+			Expect(stats[0].Start).Should(Equal(time.Date(2022, 2, 28, 11, 0, 0, 0, time.UTC)))
+			Expect(stats[35]).Should(Equal(api.BlockingStatistics{
+				Start: time.Date(2022, 3, 1, 22, 0, 0, 0, time.UTC), Blocked: 2,
+			}))
+			Expect(stats[46]).Should(Equal(api.BlockingStatistics{
+				Start: time.Date(2022, 3, 2, 9, 0, 0, 0, time.UTC), Blocked: 1,
+			}))
+			Expect(stats[47]).Should(Equal(api.BlockingStatistics{
+				Start: time.Date(2022, 3, 2, 10, 0, 0, 0, time.UTC), Blocked: 3,
+			}))
+		})
+
+		It("should aggregate them per day", func() {
+			resolveAt(time.Date(2022, 3, 1, 22, 10, 0, 0, time.UTC), 2)
+			resolveAt(time.Date(2022, 3, 2, 9, 59, 0, 0, time.UTC), 1)
+			resolveAt(time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC), 3)
+
+			Expect(sut.BlockingStatistics(true)).Should(Equal([]api.BlockingStatistics{
+				{Start: time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC), Blocked: 0},
+				{Start: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Blocked: 2},
+				{Start: time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), Blocked: 4},
+			}))
+		})
+
+		It("should drop counts older than the retention", func() {
+			resolveAt(time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC), 3)
+			resolveAt(time.Date(2022, 3, 4, 10, 30, 0, 0, time.UTC), 1)
+
+			var total uint
+			for _, s := range sut.BlockingStatistics(false) {
+				total += s.Blocked
+			}
+
+			Expect(total).Should(Equal(uint(1)))
+		})
+	})
+
+	When("queries are not blocked", func() {
+		BeforeEach(func() {
+			rType = ResponseTypeRESOLVED
+		})
+		It("should not count them", func() {
+			resolveAt(now, 3)
+
+			for _, s := range sut.BlockingStatistics(false) {
+				Expect(s.Blocked).Should(BeZero())
+			}
+		})
+	})
+
+	When("statistics are disabled", func() {
+		BeforeEach(func() {
+			cfg = config.BlockingStatisticsConfig{}
+		})
+		It("should pass the queries and return no statistics", func() {
+			resolveAt(now, 1)
+
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 1)
+			Expect(sut.BlockingStatistics(false)).Should(BeEmpty())
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("resolver is enabled", func() {
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"retention = 2 days"}))
+			})
+		})
+
+		When("resolver is disabled", func() {
+			BeforeEach(func() {
+				cfg = config.BlockingStatisticsConfig{}
+			})
+			It("should return 'deactivated'", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+			})
+		})
+	})
+})
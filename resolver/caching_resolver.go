@@ -2,10 +2,14 @@ package resolver
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/hako/durafmt"
 
+	"github.com/0xERR0R/blocky/api"
 	"github.com/0xERR0R/blocky/cache/expirationcache"
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/evt"
@@ -17,16 +21,35 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// dnssecCacheKeySuffix marks the cache keys of queries with DO bit
+	dnssecCacheKeySuffix = "\x00"
+
+	// TTL of stale answers in the responses (RFC 8767)
+	staleAnswerTTL = 30
+)
+
 // CachingResolver caches answers from dns queries with their TTL time,
 // to avoid external resolver calls for recurrent queries
 type CachingResolver struct {
 	NextResolver
 	minCacheTimeSec, maxCacheTimeSec int
 	cacheTimeNegative                time.Duration
+	cacheTimeServFail                time.Duration
+	forceTTL                         time.Duration
+	clientMaxTTL                     time.Duration
+	domainTTLs                       map[string]time.Duration
 	resultCache                      expirationcache.ExpiringCache
+	shards                           uint
 	prefetchExpires                  time.Duration
 	prefetchThreshold                int
+	prefetchJitter                   uint
 	prefetchingNameCache             expirationcache.ExpiringCache
+	staleCache                       expirationcache.ExpiringCache
+	staleRetention                   time.Duration
+	staleMaxAge                      time.Duration
+	noCacheDomains                   map[string]bool
+	noCacheClients                   []string
 	redisClient                      *redis.Client
 	redisEnabled                     bool
 }
@@ -35,6 +58,17 @@ type CachingResolver struct {
 type cacheValue struct {
 	answer   []dns.RR
 	prefetch bool
+	// served is set to 1 if a prefetched answer was returned from cache, must be accessed atomically
+	served *int32
+	// authenticated is set if the upstream marked the answer as authenticated (AD bit)
+	authenticated bool
+}
+
+// staleValue is an answer, which is kept after its expiration for serve-stale
+type staleValue struct {
+	answer        []dns.RR
+	authenticated bool
+	expiresAt     time.Time
 }
 
 // NewCachingResolver creates a new resolver instance
@@ -43,10 +77,27 @@ func NewCachingResolver(cfg config.CachingConfig, redis *redis.Client) ChainedRe
 		minCacheTimeSec:   int(time.Duration(cfg.MinCachingTime).Seconds()),
 		maxCacheTimeSec:   int(time.Duration(cfg.MaxCachingTime).Seconds()),
 		cacheTimeNegative: time.Duration(cfg.CacheTimeNegative),
+		cacheTimeServFail: time.Duration(cfg.CacheTimeServFail),
+		forceTTL:          time.Duration(cfg.ForceTTL),
+		clientMaxTTL:      time.Duration(cfg.ClientMaxTTL),
+		domainTTLs:        make(map[string]time.Duration, len(cfg.DomainTTL)),
+		shards:            cfg.Shards,
+		staleRetention:    time.Duration(cfg.StaleRetention),
+		staleMaxAge:       time.Duration(cfg.StaleMaxAge),
+		noCacheDomains:    make(map[string]bool, len(cfg.NoCacheDomains)),
+		noCacheClients:    cfg.NoCacheClients,
 		redisClient:       redis,
 		redisEnabled:      (redis != nil),
 	}
 
+	for domain, ttl := range cfg.DomainTTL {
+		c.domainTTLs[strings.ToLower(strings.TrimSuffix(domain, "."))] = time.Duration(ttl)
+	}
+
+	for _, domain := range cfg.NoCacheDomains {
+		c.noCacheDomains[strings.ToLower(strings.TrimSuffix(domain, "."))] = true
+	}
+
 	configureCaches(c, &cfg)
 
 	if c.redisEnabled {
@@ -66,12 +117,19 @@ func configureCaches(c *CachingResolver, cfg *config.CachingConfig) {
 
 		c.prefetchThreshold = cfg.PrefetchThreshold
 
+		c.prefetchJitter = cfg.PrefetchJitter
+
 		c.prefetchingNameCache = expirationcache.NewCache(expirationcache.WithCleanUpInterval(time.Minute),
 			expirationcache.WithMaxSize(uint(cfg.PrefetchMaxItemsCount)))
-		c.resultCache = expirationcache.NewCache(cleanupOption, maxSizeOption,
+		c.resultCache = expirationcache.NewShardedCache(cfg.Shards, cleanupOption, maxSizeOption,
 			expirationcache.WithOnExpiredFn(c.onExpired))
 	} else {
-		c.resultCache = expirationcache.NewCache(cleanupOption, maxSizeOption)
+		c.resultCache = expirationcache.NewShardedCache(cfg.Shards, cleanupOption, maxSizeOption)
+	}
+
+	if c.staleRetention > 0 {
+		// separate cache, the expiration of the result cache triggers the prefetching
+		c.staleCache = expirationcache.NewShardedCache(cfg.Shards, cleanupOption, maxSizeOption)
 	}
 }
 
@@ -95,20 +153,35 @@ func (r *CachingResolver) isPrefetchingDomain(cacheKey string) bool {
 }
 
 func (r *CachingResolver) onExpired(cacheKey string) (val interface{}, ttl time.Duration) {
-	qType, domainName := util.ExtractCacheKey(cacheKey)
+	qType, domainName, dnssec := extractCacheKey(cacheKey)
 
 	logger := logger("caching_resolver")
 
+	r.trackPrefetchUsage(cacheKey, domainName, logger)
+
 	if r.isPrefetchingDomain(cacheKey) {
 		logger.Debugf("prefetching '%s' (%s)", util.Obfuscate(domainName), dns.TypeToString[qType])
 
 		req := newRequest(fmt.Sprintf("%s.", domainName), qType, logger)
+		if dnssec {
+			req.Req.SetEdns0(dns.DefaultMsgSize, true)
+		}
+
 		response, err := r.next.Resolve(req)
 
 		if err == nil {
 			if response.Res.Rcode == dns.RcodeSuccess {
 				evt.Bus().Publish(evt.CachingDomainPrefetched, domainName)
-				return cacheValue{response.Res.Answer, true}, time.Duration(r.adjustTTLs(response.Res.Answer)) * time.Second
+				// next prefetch is scheduled with jitter to spread the prefetch queries over time
+				ttl := time.Duration(r.adjustTTLs(domainName, response.Res.Answer)) * time.Second
+				r.putStale(cacheKey, response.Res.Answer, response.Authenticated, ttl)
+
+				return cacheValue{
+					answer:        response.Res.Answer,
+					prefetch:      true,
+					served:        new(int32),
+					authenticated: response.Authenticated,
+				}, util.ApplyJitter(ttl, r.prefetchJitter)
 			}
 		} else {
 			util.LogOnError(fmt.Sprintf("can't prefetch '%s' ", domainName), err)
@@ -118,6 +191,18 @@ func (r *CachingResolver) onExpired(cacheKey string) (val interface{}, ttl time.
 	return nil, 0
 }
 
+// trackPrefetchUsage publishes if the expiring prefetched answer was returned from cache before its expiration
+func (r *CachingResolver) trackPrefetchUsage(cacheKey, domainName string, logger *logrus.Entry) {
+	val, _ := r.resultCache.Get(cacheKey)
+
+	if v, ok := val.(cacheValue); ok && v.prefetch && v.served != nil {
+		used := atomic.LoadInt32(v.served) > 0
+
+		logger.Debugf("prefetched answer for '%s' expired, used: %t", util.Obfuscate(domainName), used)
+		evt.Bus().Publish(evt.CachingPrefetchedEntryExpired, domainName, used)
+	}
+}
+
 // Configuration returns a current resolver configuration
 func (r *CachingResolver) Configuration() (result []string) {
 	if r.maxCacheTimeSec < 0 {
@@ -131,12 +216,66 @@ func (r *CachingResolver) Configuration() (result []string) {
 
 	result = append(result, fmt.Sprintf("cacheTimeNegative = %s", durafmt.Parse(r.cacheTimeNegative)))
 
+	result = append(result, fmt.Sprintf("cacheTimeServFail = %s", durafmt.Parse(r.cacheTimeServFail)))
+
+	if r.forceTTL > 0 {
+		result = append(result, fmt.Sprintf("forceTtl = %s", durafmt.Parse(r.forceTTL)))
+	}
+
+	if r.clientMaxTTL > 0 {
+		result = append(result, fmt.Sprintf("clientMaxTtl = %s", durafmt.Parse(r.clientMaxTTL)))
+	}
+
+	if len(r.domainTTLs) > 0 {
+		result = append(result, "domainTtl")
+
+		domains := make([]string, 0, len(r.domainTTLs))
+		for domain := range r.domainTTLs {
+			domains = append(domains, domain)
+		}
+
+		sort.Strings(domains)
+
+		for _, domain := range domains {
+			result = append(result, fmt.Sprintf("  %s = %s", domain, durafmt.Parse(r.domainTTLs[domain])))
+		}
+	}
+
 	result = append(result, fmt.Sprintf("prefetching = %t", r.prefetchingNameCache != nil))
 
 	if r.prefetchingNameCache != nil {
 		result = append(result, fmt.Sprintf("prefetchExpires = %s", durafmt.Parse(r.prefetchExpires)))
 
 		result = append(result, fmt.Sprintf("prefetchThreshold = %d", r.prefetchThreshold))
+
+		result = append(result, fmt.Sprintf("prefetchJitter = %d%%", r.prefetchJitter))
+	}
+
+	if r.shards > 1 {
+		result = append(result, fmt.Sprintf("shards = %d", r.shards))
+	}
+
+	if r.staleCache != nil {
+		result = append(result, fmt.Sprintf("staleRetention = %s", durafmt.Parse(r.staleRetention)))
+
+		if r.staleMaxAge > 0 {
+			result = append(result, fmt.Sprintf("staleMaxAge = %s", durafmt.Parse(r.staleMaxAge)))
+		}
+	}
+
+	if len(r.noCacheDomains) > 0 {
+		domains := make([]string, 0, len(r.noCacheDomains))
+		for domain := range r.noCacheDomains {
+			domains = append(domains, domain)
+		}
+
+		sort.Strings(domains)
+
+		result = append(result, fmt.Sprintf("noCacheDomains = %v", domains))
+	}
+
+	if len(r.noCacheClients) > 0 {
+		result = append(result, fmt.Sprintf("noCacheClients = %v", r.noCacheClients))
 	}
 
 	result = append(result, fmt.Sprintf("cache items count = %d", r.resultCache.TotalCount()))
@@ -155,12 +294,24 @@ func (r *CachingResolver) Resolve(request *model.Request) (response *model.Respo
 		return r.next.Resolve(request)
 	}
 
+	if r.isNoCacheRequest(request) {
+		logger.Debug("skip cache for no-cache domain or client")
+
+		return r.next.Resolve(request)
+	}
+
+	if r.isClientSpecificRequest(request) {
+		logger.Debug("skip cache for client specific answer")
+
+		return r.next.Resolve(request)
+	}
+
 	resp := new(dns.Msg)
 	resp.SetReply(request.Req)
 
 	for _, question := range request.Req.Question {
 		domain := util.ExtractDomain(question)
-		cacheKey := util.GenerateCacheKey(question.Qtype, domain)
+		cacheKey := generateCacheKey(question.Qtype, domain, isDNSSECRequested(request.Req))
 		logger := logger.WithField("domain", util.Obfuscate(domain))
 
 		r.trackQueryDomainNameCount(domain, cacheKey, logger)
@@ -177,15 +328,28 @@ func (r *CachingResolver) Resolve(request *model.Request) (response *model.Respo
 				if v.prefetch {
 					// Hit from prefetch cache
 					evt.Bus().Publish(evt.CachingPrefetchCacheHit, domain)
+
+					if v.served != nil {
+						atomic.StoreInt32(v.served, 1)
+					}
 				}
 
 				// Answer from successful request
-				resp.Answer = v.answer
-				for _, rr := range resp.Answer {
-					rr.Header().Ttl = uint32(ttl.Seconds())
+				resp.Answer = decrementTTLs(v.answer, ttl)
+
+				if isDNSSECRequested(request.Req) {
+					resp.SetEdns0(request.Req.IsEdns0().UDPSize(), true)
 				}
 
-				return &model.Response{Res: resp, RType: model.ResponseTypeCACHED, Reason: "CACHED"}, nil
+				// AD bit is only set if the client can process it (RFC 6840)
+				resp.AuthenticatedData = v.authenticated && (request.Req.AuthenticatedData ||
+					isDNSSECRequested(request.Req))
+
+				resp.Answer = r.limitClientTTLs(domain, resp.Answer)
+
+				return &model.Response{
+					Res: resp, RType: model.ResponseTypeCACHED, Reason: "CACHED", Authenticated: v.authenticated,
+				}, nil
 			}
 			// Answer with response code != OK
 			resp.Rcode = val.(int)
@@ -198,14 +362,75 @@ func (r *CachingResolver) Resolve(request *model.Request) (response *model.Respo
 		logger.WithField("next_resolver", Name(r.next)).Debug("not in cache: go to next resolver")
 		response, err = r.next.Resolve(request)
 
-		if err == nil {
+		if err != nil || response.Res.Rcode == dns.RcodeServerFailure {
+			if stale := r.staleAnswer(cacheKey, request); stale != nil {
+				logger.Debug("upstream failed, serving stale answer")
+
+				evt.Bus().Publish(evt.CachingStaleAnswerServed, domain)
+
+				return stale, nil
+			}
+		}
+
+		// truncated responses are incomplete, the client repeats the query via TCP. Only answers of upstreams are
+		// cached, not the responses of blocky without upstream answer (e.g. SERVFAIL of the upstream limit)
+		if err == nil && !response.Res.Truncated && response.UpstreamRcode != nil {
 			r.putInCache(cacheKey, response, false, r.redisEnabled)
+
+			response.Res.Answer = r.limitClientTTLs(domain, response.Res.Answer)
 		}
 	}
 
 	return response, err
 }
 
+// CacheEntries returns all cached entries with a domain name containing the filter, sorted by name and type
+func (r *CachingResolver) CacheEntries(filter string) []api.CacheEntry {
+	filter = strings.ToLower(filter)
+	result := []api.CacheEntry{}
+
+	r.resultCache.Iterate(func(key string, val interface{}, ttl time.Duration) {
+		qType, domain, dnssec := extractCacheKey(key)
+
+		if !strings.Contains(domain, filter) {
+			return
+		}
+
+		entry := api.CacheEntry{
+			Name:              domain,
+			Type:              dns.TypeToString[qType],
+			RecordTypes:       []string{},
+			ReturnCode:        dns.RcodeToString[dns.RcodeSuccess],
+			RemainingTTLInSec: uint(ttl.Seconds()),
+			DNSSEC:            dnssec,
+		}
+
+		if v, ok := val.(cacheValue); ok {
+			for _, rr := range v.answer {
+				entry.RecordTypes = append(entry.RecordTypes, dns.TypeToString[rr.Header().Rrtype])
+			}
+		} else if rcode, ok := val.(int); ok {
+			entry.ReturnCode = dns.RcodeToString[rcode]
+		}
+
+		result = append(result, entry)
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+
+		return !result[i].DNSSEC && result[j].DNSSEC
+	})
+
+	return result
+}
+
 func (r *CachingResolver) trackQueryDomainNameCount(domain string, cacheKey string, logger *logrus.Entry) {
 	if r.prefetchingNameCache != nil {
 		var domainCount int
@@ -225,12 +450,27 @@ func (r *CachingResolver) putInCache(cacheKey string, response *model.Response,
 
 	if response.Res.Rcode == dns.RcodeSuccess {
 		// put value into cache
-		r.resultCache.Put(cacheKey, cacheValue{answer, prefetch}, time.Duration(r.adjustTTLs(answer))*time.Second)
+		_, domain, _ := extractCacheKey(cacheKey)
+		maxTTL := time.Duration(r.adjustTTLs(domain, answer)) * time.Second
+		cached := copyRRs(answer)
+
+		r.resultCache.Put(cacheKey, cacheValue{
+			answer:        cached,
+			prefetch:      prefetch,
+			authenticated: response.Authenticated,
+		}, maxTTL)
+
+		r.putStale(cacheKey, cached, response.Authenticated, maxTTL)
 	} else if response.Res.Rcode == dns.RcodeNameError {
 		if r.cacheTimeNegative > 0 {
 			// put return code if NXDOMAIN
 			r.resultCache.Put(cacheKey, response.Res.Rcode, r.cacheTimeNegative)
 		}
+	} else if response.Res.Rcode == dns.RcodeServerFailure {
+		if r.cacheTimeServFail > 0 {
+			// put return code if SERVFAIL
+			r.resultCache.Put(cacheKey, response.Res.Rcode, r.cacheTimeServFail)
+		}
 	}
 
 	evt.Bus().Publish(evt.CachingResultCacheChanged, r.resultCache.TotalCount())
@@ -238,12 +478,234 @@ func (r *CachingResolver) putInCache(cacheKey string, response *model.Response,
 	if publish && r.redisClient != nil {
 		res := *response.Res
 		res.Answer = answer
+		res.AuthenticatedData = response.Authenticated
 		r.redisClient.PublishCache(cacheKey, &res)
 	}
 }
 
-func (r *CachingResolver) adjustTTLs(answer []dns.RR) (maxTTL uint32) {
+// putStale keeps the answer for the stale retention time after its expiration
+func (r *CachingResolver) putStale(cacheKey string, answer []dns.RR, authenticated bool, ttl time.Duration) {
+	if r.staleCache == nil || ttl <= 0 {
+		return
+	}
+
+	r.staleCache.Put(cacheKey, staleValue{
+		answer:        answer,
+		authenticated: authenticated,
+		expiresAt:     time.Now().Add(ttl),
+	}, ttl+r.staleRetention)
+}
+
+// staleAnswer returns the kept answer, if it expired not longer than the max. stale age ago (RFC 8767)
+func (r *CachingResolver) staleAnswer(cacheKey string, request *model.Request) *model.Response {
+	if r.staleCache == nil {
+		return nil
+	}
+
+	val, _ := r.staleCache.Get(cacheKey)
+
+	v, ok := val.(staleValue)
+	if !ok || (r.staleMaxAge > 0 && time.Since(v.expiresAt) > r.staleMaxAge) {
+		return nil
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(request.Req)
+	resp.Answer = copyRRs(v.answer)
+
+	for _, rr := range resp.Answer {
+		rr.Header().Ttl = staleAnswerTTL
+	}
+
+	if isDNSSECRequested(request.Req) {
+		resp.SetEdns0(request.Req.IsEdns0().UDPSize(), true)
+	}
+
+	resp.AuthenticatedData = v.authenticated && (request.Req.AuthenticatedData || isDNSSECRequested(request.Req))
+
+	return &model.Response{
+		Res: resp, RType: model.ResponseTypeCACHED, Reason: "CACHED STALE", Stale: true, Authenticated: v.authenticated,
+	}
+}
+
+// decrementTTLs returns copies of the cached records with TTLs reduced by the time elapsed since caching.
+// The cache entry expires with the max TTL of the records, so the elapsed time is max TTL - remaining time
+func decrementTTLs(answer []dns.RR, remaining time.Duration) []dns.RR {
+	var maxTTL uint32
+
+	for _, rr := range answer {
+		if rr.Header().Ttl > maxTTL {
+			maxTTL = rr.Header().Ttl
+		}
+	}
+
+	var elapsed uint32
+	if remainingSec := uint32(remaining.Seconds()); maxTTL > remainingSec {
+		elapsed = maxTTL - remainingSec
+	}
+
+	result := copyRRs(answer)
+
+	for _, rr := range result {
+		if rr.Header().Ttl > elapsed {
+			rr.Header().Ttl -= elapsed
+		} else {
+			rr.Header().Ttl = 0
+		}
+	}
+
+	return result
+}
+
+// limitClientTTLs returns copies of the records with TTLs reduced to the max client TTL, the cached records
+// (and the records published to redis) keep their TTLs. Domains with own TTL are not limited
+func (r *CachingResolver) limitClientTTLs(domain string, answer []dns.RR) []dns.RR {
+	if r.clientMaxTTL <= 0 {
+		return answer
+	}
+
+	if _, found := r.domainTTL(domain); found {
+		return answer
+	}
+
+	maxTTL := uint32(r.clientMaxTTL.Seconds())
+	result := copyRRs(answer)
+
+	for _, rr := range result {
+		if rr.Header().Ttl > maxTTL {
+			rr.Header().Ttl = maxTTL
+		}
+	}
+
+	return result
+}
+
+// isDNSSECRequested checks if the DO bit is set (the client requests DNSSEC records)
+func isDNSSECRequested(msg *dns.Msg) bool {
+	opt := msg.IsEdns0()
+
+	return opt != nil && opt.Do()
+}
+
+// generateCacheKey returns the cache key of the query. Answers of queries with DO bit contain the DNSSEC records
+// (e.g. RRSIG) and are cached separately
+func generateCacheKey(qType uint16, domain string, dnssec bool) string {
+	key := util.GenerateCacheKey(qType, domain)
+	if dnssec {
+		key += dnssecCacheKeySuffix
+	}
+
+	return key
+}
+
+// extractCacheKey returns query type, domain and DO bit of the cache key
+func extractCacheKey(key string) (qType uint16, domain string, dnssec bool) {
+	dnssec = strings.HasSuffix(key, dnssecCacheKeySuffix)
+	qType, domain = util.ExtractCacheKey(strings.TrimSuffix(key, dnssecCacheKeySuffix))
+
+	return
+}
+
+// copyRRs creates deep copies of the records, cached records must not be changed by the response processing
+func copyRRs(answer []dns.RR) []dns.RR {
+	result := make([]dns.RR, len(answer))
+
+	for i, rr := range answer {
+		result[i] = dns.Copy(rr)
+	}
+
+	return result
+}
+
+// isNoCacheRequest checks if the client or a queried domain (or its parent domain) is configured as never cached.
+// These queries bypass the cache lookup and store
+func (r *CachingResolver) isNoCacheRequest(request *model.Request) bool {
+	for _, client := range r.noCacheClients {
+		if clientMatches(client, request) {
+			return true
+		}
+	}
+
+	for _, question := range request.Req.Question {
+		for domain := util.ExtractDomain(question); len(r.noCacheDomains) > 0; {
+			if r.noCacheDomains[domain] {
+				return true
+			}
+
+			i := strings.Index(domain, ".")
+			if i < 0 {
+				break
+			}
+
+			domain = domain[i+1:]
+		}
+	}
+
+	return false
+}
+
+// clientSpecificResolver is implemented by resolvers, which answer a query depending on the client
+type clientSpecificResolver interface {
+	isClientSpecific(request *model.Request) bool
+}
+
+// isClientSpecificRequest checks if a next resolver of the chain answers the request depending on the client (e.g.
+// client specific conditional upstreams). These answers must not be served to other clients from the cache
+func (r *CachingResolver) isClientSpecificRequest(request *model.Request) bool {
+	for res := r.GetNext(); res != nil; {
+		if csr, ok := res.(clientSpecificResolver); ok && csr.isClientSpecific(request) {
+			return true
+		}
+
+		cr, ok := res.(ChainedResolver)
+		if !ok {
+			return false
+		}
+
+		res = cr.GetNext()
+	}
+
+	return false
+}
+
+// domainTTL returns the configured TTL of the domain or its nearest parent domain
+func (r *CachingResolver) domainTTL(domain string) (time.Duration, bool) {
+	for len(r.domainTTLs) > 0 {
+		if ttl, found := r.domainTTLs[domain]; found {
+			return ttl, true
+		}
+
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			break
+		}
+
+		domain = domain[i+1:]
+	}
+
+	return 0, false
+}
+
+func (r *CachingResolver) adjustTTLs(domain string, answer []dns.RR) (maxTTL uint32) {
+	if ttl, found := r.domainTTL(domain); found {
+		// fixed TTL of the domain, all other TTL settings are ignored
+		for _, a := range answer {
+			a.Header().Ttl = uint32(ttl.Seconds())
+			maxTTL = a.Header().Ttl
+		}
+
+		return
+	}
+
 	for _, a := range answer {
+		if r.forceTTL > 0 {
+			// fixed TTL, min and max values are ignored
+			a.Header().Ttl = uint32(r.forceTTL.Seconds())
+			maxTTL = a.Header().Ttl
+
+			continue
+		}
+
 		// if TTL < mitTTL -> adjust the value, set minTTL
 		if r.minCacheTimeSec > 0 {
 			if a.Header().Ttl < uint32(r.minCacheTimeSec) {
@@ -1,8 +1,10 @@
 package resolver
 
 import (
+	"errors"
 	"time"
 
+	"github.com/0xERR0R/blocky/api"
 	"github.com/0xERR0R/blocky/cache/expirationcache"
 	"github.com/0xERR0R/blocky/config"
 	. "github.com/0xERR0R/blocky/evt"
@@ -46,7 +48,9 @@ var _ = Describe("CachingResolver", func() {
 	JustBeforeEach(func() {
 		sut = NewCachingResolver(sutConfig, nil)
 		m = &resolverMock{}
-		m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer}, nil)
+		m.On("Resolve", mock.Anything).Return(&Response{
+			Res: mockAnswer, UpstreamRcode: &mockAnswer.Rcode, Authenticated: mockAnswer.AuthenticatedData,
+		}, nil)
 		sut.Next(m)
 	})
 
@@ -109,6 +113,103 @@ var _ = Describe("CachingResolver", func() {
 
 			})
 		})
+		When("prefetching with jitter is enabled", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{
+					Prefetching:       true,
+					PrefetchExpires:   config.Duration(time.Minute * 120),
+					PrefetchThreshold: 1,
+					PrefetchJitter:    50,
+				}
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 100, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should reduce the TTL of prefetched entries by up to the jitter", func() {
+				for i := 0; i < 3; i++ {
+					_, _ = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				}
+
+				val, ttl := sut.(*CachingResolver).onExpired(util.GenerateCacheKey(dns.TypeA, "example.com"))
+				Expect(val).ShouldNot(BeNil())
+				Expect(ttl).Should(BeNumerically(">=", 50*time.Second))
+				Expect(ttl).Should(BeNumerically("<=", 100*time.Second))
+			})
+		})
+		When("prefetching a query with DO bit", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{
+					Prefetching:       true,
+					PrefetchExpires:   config.Duration(time.Minute * 120),
+					PrefetchThreshold: 1,
+				}
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 100, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should prefetch with DO bit", func() {
+				for i := 0; i < 3; i++ {
+					req := newRequest("example.com.", dns.TypeA)
+					req.Req.SetEdns0(4096, true)
+					_, _ = sut.Resolve(req)
+				}
+
+				val, _ := sut.(*CachingResolver).onExpired(generateCacheKey(dns.TypeA, "example.com", true))
+				Expect(val).ShouldNot(BeNil())
+				Expect(m.Calls).Should(HaveLen(2))
+				Expect(isDNSSECRequested(m.Calls[1].Arguments.Get(0).(*Request).Req)).Should(BeTrue())
+			})
+		})
+		When("prefetched entry expires", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{
+					Prefetching:       true,
+					PrefetchExpires:   config.Duration(time.Minute * 120),
+					PrefetchThreshold: 1,
+				}
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 100, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should publish if the prefetched answer was returned from cache", func() {
+				cacheKey := util.GenerateCacheKey(dns.TypeA, "example.com")
+				cr := sut.(*CachingResolver)
+
+				var expired []bool
+				handler := func(_ string, used bool) {
+					expired = append(expired, used)
+				}
+				Expect(Bus().Subscribe(CachingPrefetchedEntryExpired, handler)).Should(Succeed())
+				DeferCleanup(func() {
+					Expect(Bus().Unsubscribe(CachingPrefetchedEntryExpired, handler)).Should(Succeed())
+				})
+
+				prefetch := func() {
+					val, ttl := cr.onExpired(cacheKey)
+					Expect(val).ShouldNot(BeNil())
+					cr.resultCache.Put(cacheKey, val, ttl)
+				}
+
+				for i := 0; i < 3; i++ {
+					_, _ = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				}
+
+				By("answer from upstream is not a prefetched entry", func() {
+					prefetch()
+					Expect(expired).Should(BeEmpty())
+				})
+
+				By("prefetched entry without query is unused", func() {
+					prefetch()
+					Expect(expired).Should(Equal([]bool{false}))
+				})
+
+				By("prefetched entry returned from cache is used", func() {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+
+					prefetch()
+					Expect(expired).Should(Equal([]bool{false, true}))
+				})
+			})
+		})
 		When("min caching time is defined", func() {
 			BeforeEach(func() {
 				sutConfig = config.CachingConfig{
@@ -307,6 +408,41 @@ var _ = Describe("CachingResolver", func() {
 				})
 			})
 		})
+		When("response contains records with different TTLs", func() {
+			BeforeEach(func() {
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 600, dns.TypeA, "1.1.1.1")
+				rr, _ := dns.NewRR("example.com. 300 IN A 2.2.2.2")
+				mockAnswer.Answer = append(mockAnswer.Answer, rr)
+			})
+			It("should decrement the TTL of each record by the elapsed time", func() {
+				By("first request", func() {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+					Expect(resp.Res.Answer[0].Header().Ttl).Should(BeNumerically("==", 600))
+					Expect(resp.Res.Answer[1].Header().Ttl).Should(BeNumerically("==", 300))
+				})
+
+				By("second request", func() {
+					Eventually(func(g Gomega) {
+						resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+						g.Expect(err).Should(Succeed())
+						g.Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+						g.Expect(m.Calls).Should(HaveLen(1))
+						g.Expect(resp.Res.Answer[0].Header().Ttl).Should(BeNumerically("==", 599))
+						g.Expect(resp.Res.Answer[1].Header().Ttl).Should(BeNumerically("==", 299))
+					}, "1100ms").Should(Succeed())
+				})
+
+				By("changes of the response should not affect cached records", func() {
+					resp.Res.Answer[0].Header().Ttl = 1
+
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.Res.Answer[0].Header().Ttl).Should(BeNumerically(">=", 598))
+				})
+			})
+		})
 		When("Entry expires in cache", func() {
 			BeforeEach(func() {
 				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 1, dns.TypeA, "1.1.1.1")
@@ -347,6 +483,298 @@ var _ = Describe("CachingResolver", func() {
 		})
 	})
 
+	Describe("Forced TTL", func() {
+		BeforeEach(func() {
+			sutConfig = config.CachingConfig{
+				MinCachingTime: config.Duration(time.Minute * 5),
+				ForceTTL:       config.Duration(time.Minute),
+			}
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 1800, dns.TypeA, "123.122.121.120")
+			mockAnswer.Answer = append(mockAnswer.Answer, dns.Copy(mockAnswer.Answer[0]))
+			mockAnswer.Answer[1].Header().Ttl = 5
+		})
+
+		It("should override the TTL of all answers, ignoring min caching time", func() {
+			By("first request", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				for _, rr := range resp.Res.Answer {
+					Expect(rr.Header().Ttl).Should(Equal(uint32(60)))
+				}
+			})
+
+			By("second request", func() {
+				Eventually(func(g Gomega) {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					g.Expect(err).Should(Succeed())
+					g.Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+					g.Expect(m.Calls).Should(HaveLen(1))
+					// ttl is smaller
+					g.Expect(resp.Res.Answer).Should(HaveLen(2))
+					for _, rr := range resp.Res.Answer {
+						g.Expect(rr.Header().Ttl).Should(Equal(uint32(59)))
+					}
+				}, "1500ms").Should(Succeed())
+			})
+		})
+
+		It("should return the forced TTL in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("forceTtl = 1 minute"))
+		})
+	})
+
+	Describe("Client max TTL", func() {
+		BeforeEach(func() {
+			sutConfig = config.CachingConfig{
+				ClientMaxTTL: config.Duration(time.Minute),
+			}
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 1800, dns.TypeA, "123.122.121.120")
+			mockAnswer.Answer = append(mockAnswer.Answer, dns.Copy(mockAnswer.Answer[0]))
+			mockAnswer.Answer[1].Header().Ttl = 5
+		})
+
+		It("should limit the TTL in the responses, but cache with the TTL of the answer", func() {
+			By("first request", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].Header().Ttl).Should(Equal(uint32(60)))
+				Expect(resp.Res.Answer[1].Header().Ttl).Should(Equal(uint32(5)))
+			})
+
+			By("second request", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(m.Calls).Should(HaveLen(1))
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].Header().Ttl).Should(Equal(uint32(60)))
+				Expect(resp.Res.Answer[1].Header().Ttl).Should(BeNumerically("<=", 5))
+			})
+
+			By("cache entry", func() {
+				entries := sut.(*CachingResolver).CacheEntries("example.com")
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].RemainingTTLInSec).Should(BeNumerically(">", 60))
+			})
+		})
+
+		It("should return the client max TTL in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("clientMaxTtl = 1 minute"))
+		})
+	})
+
+	Describe("Domain TTL", func() {
+		BeforeEach(func() {
+			sutConfig = config.CachingConfig{
+				MinCachingTime: config.Duration(time.Hour),
+				ClientMaxTTL:   config.Duration(time.Minute),
+				DomainTTL:      map[string]config.Duration{"Example.com.": config.Duration(10 * time.Second)},
+			}
+		})
+
+		When("the domain or a parent domain has an own TTL", func() {
+			BeforeEach(func() {
+				mockAnswer, _ = util.NewMsgWithAnswer("www.example.com.", 1800, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should cache and return the answer with this TTL", func() {
+				resp, err = sut.Resolve(newRequest("www.example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("www.example.com.", dns.TypeA, 10, "123.122.121.120"))
+
+				entries := sut.(*CachingResolver).CacheEntries("example.com")
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].RemainingTTLInSec).Should(BeNumerically("<=", 10))
+
+				resp, err = sut.Resolve(newRequest("www.example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(resp.Res.Answer[0].Header().Ttl).Should(BeNumerically("<=", 10))
+			})
+		})
+
+		When("the domain has no own TTL", func() {
+			BeforeEach(func() {
+				mockAnswer, _ = util.NewMsgWithAnswer("example.org.", 1800, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should apply the other TTL settings", func() {
+				resp, err = sut.Resolve(newRequest("example.org.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.org.", dns.TypeA, 60, "123.122.121.120"))
+
+				entries := sut.(*CachingResolver).CacheEntries("example.org")
+				Expect(entries[0].RemainingTTLInSec).Should(BeNumerically(">", 1800))
+			})
+		})
+
+		It("should return the domain TTLs in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElements("domainTtl", "  example.com = 10 seconds"))
+		})
+	})
+
+	Describe("No-cache domains and clients", func() {
+		BeforeEach(func() {
+			sutConfig = config.CachingConfig{
+				NoCacheDomains: []string{"DynDNS.example.com."},
+				NoCacheClients: []string{"always-fresh*", "192.168.178.0/24"},
+			}
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 1800, dns.TypeA, "123.122.121.120")
+		})
+
+		When("the domain or a parent domain is not cached", func() {
+			BeforeEach(func() {
+				mockAnswer, _ = util.NewMsgWithAnswer("home.dyndns.example.com.", 1800, dns.TypeA, "123.122.121.120")
+			})
+
+			It("should always query the next resolver", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequest("home.dyndns.example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				}
+
+				Expect(m.Calls).Should(HaveLen(2))
+				Expect(sut.(*CachingResolver).CacheEntries("")).Should(BeEmpty())
+			})
+		})
+
+		When("the client is not cached", func() {
+			It("should always query the next resolver for the client name", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.0.0.1", "always-fresh-tv"))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				}
+
+				Expect(m.Calls).Should(HaveLen(2))
+				Expect(sut.(*CachingResolver).CacheEntries("")).Should(BeEmpty())
+			})
+
+			It("should always query the next resolver for the client IP", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10", "client1"))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+				}
+
+				Expect(m.Calls).Should(HaveLen(2))
+			})
+		})
+
+		When("neither domain nor client are excluded", func() {
+			It("should cache the answer", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.0.0.1", "client1"))
+					Expect(err).Should(Succeed())
+				}
+
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(m.Calls).Should(HaveLen(1))
+			})
+		})
+
+		It("should return the no-cache settings in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElements(
+				"noCacheDomains = [dyndns.example.com]",
+				"noCacheClients = [always-fresh* 192.168.178.0/24]"))
+		})
+	})
+
+	Describe("Serve stale", func() {
+		var cacheKey string
+
+		BeforeEach(func() {
+			sutConfig = config.CachingConfig{
+				StaleRetention: config.Duration(time.Hour),
+				StaleMaxAge:    config.Duration(10 * time.Minute),
+			}
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 300, dns.TypeA, "123.122.121.120")
+			cacheKey = generateCacheKey(dns.TypeA, "example.com", false)
+		})
+
+		JustBeforeEach(func() {
+			_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+
+			// the answer expired and the upstream fails
+			sut.(*CachingResolver).resultCache.Clear()
+
+			m.ExpectedCalls = nil
+			m.On("Resolve", mock.Anything).Return(nil, errors.New("upstream failed"))
+		})
+
+		When("the answer expired within the max. stale age", func() {
+			It("should return the stale answer with a short TTL", func() {
+				domain := ""
+				_ = Bus().SubscribeOnce(CachingStaleAnswerServed, func(d string) {
+					domain = d
+				})
+
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(resp.Reason).Should(Equal("CACHED STALE"))
+				Expect(resp.Stale).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, staleAnswerTTL, "123.122.121.120"))
+				Expect(domain).Should(Equal("example.com"))
+			})
+		})
+
+		When("the answer expired before the max. stale age", func() {
+			It("should return the error of the upstream", func() {
+				c := sut.(*CachingResolver)
+				v, _ := c.staleCache.Get(cacheKey)
+				stale := v.(staleValue)
+				stale.expiresAt = time.Now().Add(-20 * time.Minute)
+				c.staleCache.Put(cacheKey, stale, time.Hour)
+
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError("upstream failed"))
+
+				err = nil
+			})
+		})
+
+		When("the upstream answers", func() {
+			It("should not return the stale answer", func() {
+				m.ExpectedCalls = nil
+				m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer, UpstreamRcode: &mockAnswer.Rcode}, nil)
+
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Reason).ShouldNot(Equal("CACHED STALE"))
+				Expect(resp.Stale).Should(BeFalse())
+			})
+		})
+
+		It("should return the stale settings in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElements("staleRetention = 1 hour", "staleMaxAge = 10 minutes"))
+		})
+	})
+
+	Describe("Truncated responses", func() {
+		BeforeEach(func() {
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 300, dns.TypeA, "123.122.121.120")
+			mockAnswer.Truncated = true
+		})
+
+		It("should not cache the response", func() {
+			for i := 0; i < 2; i++ {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Truncated).Should(BeTrue())
+			}
+
+			Expect(m.Calls).Should(HaveLen(2))
+			Expect(sut.(*CachingResolver).CacheEntries("")).Should(BeEmpty())
+		})
+	})
+
 	Describe("Negative cache (caching if upstream resolver returns NXDOMAIN)", func() {
 		When("Upstream resolver returns NXDOMAIN with caching", func() {
 			BeforeEach(func() {
@@ -407,6 +835,85 @@ var _ = Describe("CachingResolver", func() {
 		})
 	})
 
+	Describe("SERVFAIL cache", func() {
+		BeforeEach(func() {
+			mockAnswer.Rcode = dns.RcodeServerFailure
+		})
+		When("Upstream resolver returns SERVFAIL with caching", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{
+					CacheTimeServFail: config.Duration(time.Minute),
+				}
+			})
+
+			It("response should be cached", func() {
+				By("first request", func() {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+					Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+					Expect(m.Calls).Should(HaveLen(1))
+				})
+
+				By("second request", func() {
+					Eventually(func(g Gomega) {
+						resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+						g.Expect(err).Should(Succeed())
+						g.Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+						g.Expect(resp.Reason).Should(Equal("CACHED NEGATIVE"))
+						g.Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+						// still one call to resolver
+						g.Expect(m.Calls).Should(HaveLen(1))
+					}, "500ms").Should(Succeed())
+				})
+			})
+		})
+		When("blocky answers with SERVFAIL without upstream answer", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{
+					CacheTimeServFail: config.Duration(time.Minute),
+				}
+			})
+
+			JustBeforeEach(func() {
+				m = &resolverMock{}
+				m.On("Resolve", mock.Anything).Return(&Response{
+					Res: mockAnswer, RType: ResponseTypeRESOLVED, Reason: "UPSTREAM LIMIT EXCEEDED",
+				}, nil)
+				sut.Next(m)
+			})
+
+			It("response shouldn't be cached", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.Reason).Should(Equal("UPSTREAM LIMIT EXCEEDED"))
+				}
+
+				Expect(m.Calls).Should(HaveLen(2))
+			})
+		})
+		When("Upstream resolver returns SERVFAIL without caching", func() {
+			It("response shouldn't be cached", func() {
+				By("first request", func() {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+					Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+					Expect(m.Calls).Should(HaveLen(1))
+				})
+
+				By("second request", func() {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+					Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+					Expect(m.Calls).Should(HaveLen(2))
+				})
+			})
+		})
+	})
+
 	Describe("Not A / AAAA queries should also cached", func() {
 		When("MX query will be performed", func() {
 			BeforeEach(func() {
@@ -437,6 +944,182 @@ var _ = Describe("CachingResolver", func() {
 		})
 	})
 
+	Describe("DNSSEC records", func() {
+		var rrsig dns.RR
+
+		dnssecRequest := func(question string, qType uint16) *Request {
+			req := newRequest(question, qType)
+			req.Req.SetEdns0(4096, true)
+
+			return req
+		}
+
+		BeforeEach(func() {
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 180, dns.TypeA, "123.122.121.120")
+
+			rrsig, err = dns.NewRR("example.com. 180 IN RRSIG A 13 2 180 20220401000000 20220301000000 " +
+				"12345 example.com. dGVzdA==")
+			Expect(err).Should(Succeed())
+
+			mockAnswer.Answer = append(mockAnswer.Answer, rrsig)
+			mockAnswer.AuthenticatedData = true
+		})
+
+		When("DNSSEC records were requested", func() {
+			It("should return the cached signatures and AD bit to clients with DO bit", func() {
+				By("first request", func() {
+					resp, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(m.Calls).Should(HaveLen(1))
+				})
+
+				By("second request with DO bit", func() {
+					resp, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+					Expect(m.Calls).Should(HaveLen(1))
+					Expect(resp.Res.Answer).Should(HaveLen(2))
+					Expect(resp.Res.Answer[1].Header().Rrtype).Should(Equal(dns.TypeRRSIG))
+					Expect(resp.Res.AuthenticatedData).Should(BeTrue())
+					Expect(resp.Res.IsEdns0()).ShouldNot(BeNil())
+					Expect(resp.Res.IsEdns0().Do()).Should(BeTrue())
+				})
+
+				By("request without DO bit", func() {
+					// answers with DNSSEC records are cached separately
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).ShouldNot(Equal(ResponseTypeCACHED))
+					Expect(m.Calls).Should(HaveLen(2))
+				})
+			})
+		})
+
+		When("client requested neither AD nor DO bit", func() {
+			It("should clear the AD bit and keep the validation state of the cached answer", func() {
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(resp.Res.AuthenticatedData).Should(BeFalse())
+				Expect(resp.Authenticated).Should(BeTrue())
+				Expect(m.Calls).Should(HaveLen(1))
+			})
+		})
+
+		When("cached answer was resolved without DO bit", func() {
+			It("should resolve the query of a client with DO bit again", func() {
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(m.Calls).Should(HaveLen(1))
+
+				resp, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).ShouldNot(Equal(ResponseTypeCACHED))
+				Expect(m.Calls).Should(HaveLen(2))
+
+				// both answers are cached
+				resp, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(resp.Res.IsEdns0().Do()).Should(BeTrue())
+
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(resp.Res.IsEdns0()).Should(BeNil())
+				Expect(m.Calls).Should(HaveLen(2))
+			})
+		})
+
+		When("DNSKEY query will be performed", func() {
+			BeforeEach(func() {
+				dnskey, err := dns.NewRR("example.com. 3600 IN DNSKEY 257 3 13 dGVzdA==")
+				Expect(err).Should(Succeed())
+
+				mockAnswer = new(dns.Msg)
+				mockAnswer.Answer = []dns.RR{dnskey}
+			})
+
+			It("should be cached and returned untouched", func() {
+				_, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeDNSKEY))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(dnssecRequest("example.com.", dns.TypeDNSKEY))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCACHED))
+				Expect(m.Calls).Should(HaveLen(1))
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].Header().Rrtype).Should(Equal(dns.TypeDNSKEY))
+			})
+		})
+	})
+
+	Describe("Cache entries", func() {
+		var inspector api.CacheInspector
+
+		JustBeforeEach(func() {
+			inspector = sut.(api.CacheInspector)
+		})
+
+		When("responses are cached", func() {
+			BeforeEach(func() {
+				mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 180, dns.TypeA, "123.122.121.120")
+			})
+			It("should return matching entries sorted by name", func() {
+				for _, domain := range []string{"example.org.", "example.com.", "other.net."} {
+					_, err = sut.Resolve(newRequest(domain, dns.TypeA))
+					Expect(err).Should(Succeed())
+				}
+
+				entries := inspector.CacheEntries("EXAMPLE")
+				Expect(entries).Should(HaveLen(2))
+				Expect(entries[0].Name).Should(Equal("example.com"))
+				Expect(entries[0].Type).Should(Equal("A"))
+				Expect(entries[0].RecordTypes).Should(Equal([]string{"A"}))
+				Expect(entries[0].ReturnCode).Should(Equal("NOERROR"))
+				Expect(entries[0].RemainingTTLInSec).Should(BeNumerically("~", 180, 1))
+				Expect(entries[1].Name).Should(Equal("example.org"))
+
+				Expect(inspector.CacheEntries("")).Should(HaveLen(3))
+			})
+
+			It("should return separate entries for queries with DO bit", func() {
+				req := newRequest("example.com.", dns.TypeA)
+				req.Req.SetEdns0(4096, true)
+
+				_, err = sut.Resolve(req)
+				Expect(err).Should(Succeed())
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+
+				entries := inspector.CacheEntries("")
+				Expect(entries).Should(HaveLen(2))
+				Expect(entries[0].Name).Should(Equal("example.com"))
+				Expect(entries[0].DNSSEC).Should(BeFalse())
+				Expect(entries[1].Name).Should(Equal("example.com"))
+				Expect(entries[1].DNSSEC).Should(BeTrue())
+			})
+		})
+		When("negative response is cached", func() {
+			BeforeEach(func() {
+				mockAnswer.Rcode = dns.RcodeNameError
+			})
+			It("should return the return code", func() {
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeAAAA))
+				Expect(err).Should(Succeed())
+
+				entries := inspector.CacheEntries("")
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Type).Should(Equal("AAAA"))
+				Expect(entries[0].RecordTypes).Should(BeEmpty())
+				Expect(entries[0].ReturnCode).Should(Equal("NXDOMAIN"))
+			})
+		})
+	})
+
 	Describe("Configuration output", func() {
 		When("resolver is enabled", func() {
 			BeforeEach(func() {
@@ -448,6 +1131,15 @@ var _ = Describe("CachingResolver", func() {
 			})
 		})
 
+		When("cache is sharded", func() {
+			BeforeEach(func() {
+				sutConfig = config.CachingConfig{Shards: 4}
+			})
+			It("should return the shard count", func() {
+				Expect(sut.Configuration()).Should(ContainElement("shards = 4"))
+			})
+		})
+
 		When("resolver is disabled", func() {
 			BeforeEach(func() {
 				sutConfig = config.CachingConfig{
@@ -510,7 +1202,7 @@ var _ = Describe("CachingResolver", func() {
 
 				sut = NewCachingResolver(sutConfig, redisClient)
 				m = &resolverMock{}
-				m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer}, nil)
+				m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer, UpstreamRcode: &mockAnswer.Rcode}, nil)
 				sut.Next(m)
 			})
 
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+const clientACLResolverLogger = "client_acl_resolver"
+
+// ClientACLResolver refuses the queries of clients, which are not in the allowed networks.
+// Loopback clients (e.g. health probe, unix domain socket) and internal requests without client IP (REST API query)
+// are always allowed
+type ClientACLResolver struct {
+	NextResolver
+	allowed []*net.IPNet
+}
+
+// NewClientACLResolver returns new resolver instance
+func NewClientACLResolver(cfg config.ClientACLConfig) ChainedResolver {
+	r := &ClientACLResolver{}
+
+	for _, client := range cfg.AllowedClients {
+		if _, network, err := net.ParseCIDR(client); err == nil {
+			r.allowed = append(r.allowed, network)
+		} else if ip := net.ParseIP(client); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			r.allowed = append(r.allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *ClientACLResolver) Configuration() (result []string) {
+	if len(r.allowed) == 0 {
+		return []string{"deactivated"}
+	}
+
+	networks := make([]string, len(r.allowed))
+	for i, network := range r.allowed {
+		networks[i] = network.String()
+	}
+
+	return []string{fmt.Sprintf("allowedClients = \"%s\"", strings.Join(networks, ";"))}
+}
+
+// Resolve returns REFUSED if the client is not allowed, otherwise delegates to the next resolver
+func (r *ClientACLResolver) Resolve(request *model.Request) (*model.Response, error) {
+	if len(r.allowed) == 0 || r.isAllowed(request.ClientIP) {
+		return r.next.Resolve(request)
+	}
+
+	withPrefix(request.Log, clientACLResolverLogger).
+		WithField("client_ip", request.ClientIP).
+		Info("query refused, client is not allowed")
+
+	evt.Bus().Publish(evt.ClientACLRejected, request.ClientIP.String())
+
+	response := new(dns.Msg)
+	response.SetRcode(request.Req, dns.RcodeRefused)
+
+	return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: "CLIENT NOT ALLOWED"}, nil
+}
+
+func (r *ClientACLResolver) isAllowed(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() {
+		return true
+	}
+
+	for _, network := range r.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
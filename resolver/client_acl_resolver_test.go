@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("ClientACLResolver", func() {
+	var (
+		sut ChainedResolver
+		cfg config.ClientACLConfig
+		m   *resolverMock
+	)
+
+	BeforeEach(func() {
+		cfg = config.ClientACLConfig{AllowedClients: []string{"192.168.178.0/24", "10.0.0.1", "fd00::/8"}}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewClientACLResolver(cfg)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	When("allowed clients are defined", func() {
+		It("should delegate the queries of allowed clients", func() {
+			for _, ip := range []string{"192.168.178.25", "10.0.0.1", "fd00::1", "127.0.0.1", "::1"} {
+				resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, ip))
+				Expect(err).Should(Succeed())
+				Expect(resp.Reason).Should(Equal("RESOLVED"), ip)
+			}
+
+			Expect(m.Calls).Should(HaveLen(5))
+		})
+
+		It("should delegate internal requests without client IP", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+
+		It("should refuse the queries of other clients", func() {
+			var rejected string
+
+			_ = Bus().SubscribeOnce(ClientACLRejected, func(ip string) {
+				rejected = ip
+			})
+
+			resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.0.0.2"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			Expect(resp.Reason).Should(Equal("CLIENT NOT ALLOWED"))
+			Expect(rejected).Should(Equal("10.0.0.2"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should return configuration", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{
+				`allowedClients = "192.168.178.0/24;10.0.0.1/32;fd00::/8"`,
+			}))
+		})
+	})
+
+	When("no allowed clients are defined", func() {
+		BeforeEach(func() {
+			cfg = config.ClientACLConfig{}
+		})
+
+		It("should delegate all queries", func() {
+			resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.0.0.2"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+
+		It("should return 'deactivated'", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+})
@@ -1,9 +1,13 @@
 package resolver
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xERR0R/blocky/cache/expirationcache"
@@ -15,20 +19,41 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// ARP table of the kernel with the MAC addresses of the IPv4 neighbors
+	arpTableFile = "/proc/net/arp"
+
+	// failed reads of the ARP or IPv6 neighbor table are logged as warning once per interval, e.g. the tables are
+	// missing on non-Linux hosts
+	arpTableWarnInterval = time.Hour
+
+	clientNamesCacheTime = time.Hour
+
+	// the names are cached shorter with MAC mapping: the IP address can be assigned to another client via DHCP and
+	// the unknown MAC address of a new client is in the ARP table after its first packets
+	macMappingCacheTime = time.Minute
+)
+
 // ClientNamesResolver tries to determine client name by asking responsible DNS server via rDNS (reverse lookup)
 type ClientNamesResolver struct {
+	// unix time in nanoseconds of the last neighbor table warning, first field for the 64-bit alignment of atomic access
+	arpTableWarned   int64
 	cache            expirationcache.ExpiringCache
 	externalResolver Resolver
 	singleNameOrder  []uint
 	clientIPMapping  map[string][]net.IP
+	clientMACMapping map[string][]config.MACAddress
+	arpTable         string
+	// returns the MAC address of an IPv6 client from the neighbor table
+	ipv6Neighbors func(ip net.IP) (net.HardwareAddr, error)
 	NextResolver
 }
 
-// NewClientNamesResolver creates new resolver instance
-func NewClientNamesResolver(cfg config.ClientLookupConfig) ChainedResolver {
+// NewClientNamesResolver creates new resolver instance, the lookup upstream uses the upstream settings of the chain
+func NewClientNamesResolver(cfg config.ClientLookupConfig, settings *UpstreamSettings) ChainedResolver {
 	var r Resolver
 	if (config.Upstream{}) != cfg.Upstream {
-		r = NewUpstreamResolver(cfg.Upstream)
+		r = NewUpstreamResolver(cfg.Upstream, settings)
 	}
 
 	return &ClientNamesResolver{
@@ -36,12 +61,15 @@ func NewClientNamesResolver(cfg config.ClientLookupConfig) ChainedResolver {
 		externalResolver: r,
 		singleNameOrder:  cfg.SingleNameOrder,
 		clientIPMapping:  cfg.ClientnameIPMapping,
+		clientMACMapping: cfg.ClientnameMACMapping,
+		arpTable:         arpTableFile,
+		ipv6Neighbors:    lookupIPv6MAC,
 	}
 }
 
 // Configuration returns current resolver configuration
 func (r *ClientNamesResolver) Configuration() (result []string) {
-	if r.externalResolver != nil || len(r.clientIPMapping) > 0 {
+	if r.externalResolver != nil || len(r.clientIPMapping) > 0 || len(r.clientMACMapping) > 0 {
 		result = append(result, fmt.Sprintf("singleNameOrder = \"%v\"", r.singleNameOrder))
 
 		if r.externalResolver != nil {
@@ -57,6 +85,14 @@ func (r *ClientNamesResolver) Configuration() (result []string) {
 				result = append(result, fmt.Sprintf("%s -> %s", k, v))
 			}
 		}
+
+		if len(r.clientMACMapping) > 0 {
+			result = append(result, "client MAC mapping:")
+
+			for k, v := range r.clientMACMapping {
+				result = append(result, fmt.Sprintf("%s -> %s", k, v))
+			}
+		}
 	} else {
 		result = []string{"deactivated, use only IP address"}
 	}
@@ -95,15 +131,28 @@ func (r *ClientNamesResolver) getClientNames(request *model.Request) []string {
 	}
 
 	names := r.resolveClientNames(ip, withPrefix(request.Log, "client_names_resolver"))
-	r.cache.Put(ip.String(), names, time.Hour)
+	r.cache.Put(ip.String(), names, r.cacheTime())
 
 	return names
 }
 
+// cacheTime returns the cache time of the resolved client names
+func (r *ClientNamesResolver) cacheTime() time.Duration {
+	if len(r.clientMACMapping) > 0 {
+		return macMappingCacheTime
+	}
+
+	return clientNamesCacheTime
+}
+
 // tries to resolve client name from mapping, performs reverse DNS lookup otherwise
 func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry) (result []string) {
-	// try client mapping first
-	result = r.getNameFromIPMapping(ip, result)
+	// try client mappings first, the MAC address is stable if the client gets another IP address via DHCP
+	result = r.getNameFromMACMapping(ip, logger)
+
+	if len(result) == 0 {
+		result = r.getNameFromIPMapping(ip, result)
+	}
 
 	if len(result) > 0 {
 		return
@@ -167,6 +216,100 @@ func (r *ClientNamesResolver) getNameFromIPMapping(ip net.IP, result []string) [
 	return result
 }
 
+// returns the mapped names of the client's MAC address, nothing if the MAC address is unknown
+func (r *ClientNamesResolver) getNameFromMACMapping(ip net.IP, logger *logrus.Entry) (result []string) {
+	if len(r.clientMACMapping) == 0 {
+		return nil
+	}
+
+	var (
+		mac   net.HardwareAddr
+		err   error
+		table string
+	)
+
+	if ip.To4() != nil {
+		mac, err = lookupMAC(r.arpTable, ip)
+		table = "ARP table"
+	} else {
+		mac, err = r.ipv6Neighbors(ip)
+		table = "IPv6 neighbor table"
+	}
+
+	if err != nil {
+		r.logNeighborTableError(logger, table, err)
+
+		return nil
+	}
+
+	if mac == nil {
+		logger.Debugf("MAC address of client '%s' is unknown", ip)
+
+		return nil
+	}
+
+	for name, macs := range r.clientMACMapping {
+		for _, m := range macs {
+			if bytes.Equal(m, mac) {
+				result = append(result, name)
+			}
+		}
+	}
+
+	return result
+}
+
+// logNeighborTableError logs the error as warning once per interval and as debug message otherwise
+func (r *ClientNamesResolver) logNeighborTableError(logger *logrus.Entry, table string, err error) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&r.arpTableWarned)
+
+	if now-last < int64(arpTableWarnInterval) || !atomic.CompareAndSwapInt64(&r.arpTableWarned, last, now) {
+		logger.Debugf("can't read %s: %s", table, err)
+
+		return
+	}
+
+	logger.Warnf("can't read %s: %s", table, err)
+}
+
+// lookupMAC returns the MAC address of the IP address from the ARP table (format of /proc/net/arp), nil if the
+// address is not in the table or the entry is incomplete
+func lookupMAC(arpTable string, ip net.IP) (net.HardwareAddr, error) {
+	f, err := os.Open(arpTable)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	// skip the header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		// IP address, HW type, flags, HW address, mask, device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !ip.Equal(net.ParseIP(fields[0])) {
+			continue
+		}
+
+		// flags 0x0: the address is not resolved (yet)
+		if fields[2] == "0x0" {
+			return nil, nil
+		}
+
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAC address '%s' of '%s': %w", fields[3], fields[0], err)
+		}
+
+		return mac, nil
+	}
+
+	return nil, scanner.Err()
+}
+
 // FlushCache reset client name cache
 func (r *ClientNamesResolver) FlushCache() {
 	r.cache.Clear()
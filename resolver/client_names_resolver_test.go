@@ -4,9 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	"github.com/0xERR0R/blocky/log"
 	"github.com/0xERR0R/blocky/util"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 
 	. "github.com/0xERR0R/blocky/model"
 
@@ -46,7 +51,7 @@ var _ = Describe("ClientResolver", func() {
 	})
 
 	JustBeforeEach(func() {
-		sut = NewClientNamesResolver(sutConfig).(*ClientNamesResolver)
+		sut = NewClientNamesResolver(sutConfig, NewUpstreamSettings(&config.Config{})).(*ClientNamesResolver)
 		m = &resolverMock{}
 		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 		sut.Next(m)
@@ -117,6 +122,158 @@ var _ = Describe("ClientResolver", func() {
 		})
 	})
 
+	Describe("Resolve client name with MAC address mapping", func() {
+		var (
+			arpTable      string
+			ipv6Neighbors func(ip net.IP) (net.HardwareAddr, error)
+		)
+
+		BeforeEach(func() {
+			sutConfig = config.ClientLookupConfig{
+				Upstream: mockReverseUpstream,
+				ClientnameIPMapping: map[string][]net.IP{
+					"client7": {net.ParseIP("192.168.178.30")},
+				},
+				ClientnameMACMapping: map[string][]config.MACAddress{
+					"laptop": {config.MACAddress{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}},
+					"phone":  {config.MACAddress{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}},
+				},
+			}
+
+			file := TempFile(`IP address       HW type     Flags       HW address            Mask     Device
+192.168.178.29   0x1         0x2         aa:bb:cc:dd:ee:01     *        eth0
+192.168.178.30   0x1         0x2         aa:bb:cc:dd:ee:03     *        eth0
+192.168.178.31   0x1         0x0         00:00:00:00:00:00     *        eth0
+`)
+			DeferCleanup(file.Close)
+
+			arpTable = file.Name()
+
+			ipv6Neighbors = func(ip net.IP) (net.HardwareAddr, error) {
+				if ip.Equal(net.ParseIP("fe80::1")) {
+					return net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}, nil
+				}
+
+				return nil, nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			sut.arpTable = arpTable
+			sut.ipv6Neighbors = ipv6Neighbors
+		})
+
+		It("should resolve defined name of the MAC address from the ARP table", func() {
+			request := newRequestWithClient("google.de.", dns.TypeA, "192.168.178.29")
+			resp, err = sut.Resolve(request)
+
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(request.ClientNames).Should(Equal([]string{"laptop"}))
+			Expect(mockReverseUpstreamCallCount).Should(Equal(0))
+		})
+
+		It("should cache the names shortly, the IP address can be assigned to another client", func() {
+			for _, ip := range []string{"192.168.178.29", "192.168.178.31"} {
+				resp, err = sut.Resolve(newRequestWithClient("google.de.", dns.TypeA, ip))
+				Expect(err).Should(Succeed())
+
+				names, ttl := sut.cache.Get(ip)
+				Expect(names).ShouldNot(BeNil())
+				Expect(ttl).Should(BeNumerically("<=", time.Minute))
+			}
+		})
+
+		It("should use the IP mapping if the MAC address is not mapped", func() {
+			request := newRequestWithClient("google.de.", dns.TypeA, "192.168.178.30")
+			resp, err = sut.Resolve(request)
+
+			Expect(request.ClientNames).Should(Equal([]string{"client7"}))
+			Expect(mockReverseUpstreamCallCount).Should(Equal(0))
+		})
+
+		It("should use fallback if the ARP entry is incomplete", func() {
+			request := newRequestWithClient("google.de.", dns.TypeA, "192.168.178.31")
+			resp, err = sut.Resolve(request)
+
+			Expect(request.ClientNames).Should(Equal([]string{"192.168.178.31"}))
+			Expect(mockReverseUpstreamCallCount).Should(Equal(1))
+		})
+
+		It("should use fallback if the IP address is not in the ARP table", func() {
+			request := newRequestWithClient("google.de.", dns.TypeA, "2a02:590:505:4700:2e4f:1503:ce74:df78")
+			resp, err = sut.Resolve(request)
+
+			Expect(request.ClientNames).Should(Equal([]string{"2a02:590:505:4700:2e4f:1503:ce74:df78"}))
+			Expect(mockReverseUpstreamCallCount).Should(Equal(1))
+		})
+
+		It("should resolve defined name of the MAC address from the IPv6 neighbor table", func() {
+			request := newRequestWithClient("google.de.", dns.TypeA, "fe80::1")
+			resp, err = sut.Resolve(request)
+
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(request.ClientNames).Should(Equal([]string{"phone"}))
+			Expect(mockReverseUpstreamCallCount).Should(Equal(0))
+		})
+
+		When("the IPv6 neighbor table can't be read", func() {
+			BeforeEach(func() {
+				ipv6Neighbors = func(net.IP) (net.HardwareAddr, error) {
+					return nil, errors.New("netlink error")
+				}
+			})
+
+			It("should use fallback for client name and log the error", func() {
+				hook := test.NewGlobal()
+				log.Log().AddHook(hook)
+				defer hook.Reset()
+
+				level := log.Log().GetLevel()
+				log.Log().SetLevel(logrus.WarnLevel)
+				defer log.Log().SetLevel(level)
+
+				request := newRequestWithClient("google.de.", dns.TypeA, "fe80::1")
+				resp, err = sut.Resolve(request)
+
+				Expect(request.ClientNames).Should(Equal([]string{"fe80::1"}))
+				Expect(mockReverseUpstreamCallCount).Should(Equal(1))
+				Expect(hook.LastEntry().Message).Should(Equal("can't read IPv6 neighbor table: netlink error"))
+			})
+		})
+
+		When("the ARP table can't be read", func() {
+			BeforeEach(func() {
+				arpTable = "/notexisting/arp"
+			})
+
+			It("should use fallback for client name", func() {
+				request := newRequestWithClient("google.de.", dns.TypeA, "192.168.178.29")
+				resp, err = sut.Resolve(request)
+
+				Expect(request.ClientNames).Should(Equal([]string{"192.168.178.29"}))
+				Expect(mockReverseUpstreamCallCount).Should(Equal(1))
+			})
+
+			It("should log the error as warning only once per interval", func() {
+				hook := test.NewGlobal()
+				log.Log().AddHook(hook)
+				defer hook.Reset()
+
+				level := log.Log().GetLevel()
+				log.Log().SetLevel(logrus.WarnLevel)
+				defer log.Log().SetLevel(level)
+
+				for _, ip := range []string{"192.168.178.29", "192.168.178.30", "192.168.178.31"} {
+					resp, err = sut.Resolve(newRequestWithClient("google.de.", dns.TypeA, ip))
+					Expect(err).Should(Succeed())
+				}
+
+				Expect(hook.AllEntries()).Should(HaveLen(1))
+				Expect(hook.LastEntry().Message).Should(ContainSubstring("can't read ARP table"))
+			})
+		})
+	})
+
 	Describe("Resolve client name via rDNS lookup", func() {
 		AfterEach(func() {
 			// next resolver will be called
@@ -307,6 +464,20 @@ var _ = Describe("ClientResolver", func() {
 			})
 		})
 
+		When("only MAC mapping is defined", func() {
+			BeforeEach(func() {
+				sutConfig = config.ClientLookupConfig{
+					ClientnameMACMapping: map[string][]config.MACAddress{
+						"laptop": {config.MACAddress{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}},
+					},
+				}
+			})
+			It("should return configuration", func() {
+				c := sut.Configuration()
+				Expect(c).Should(ContainElements("client MAC mapping:", "laptop -> [aa:bb:cc:dd:ee:01]"))
+			})
+		})
+
 		When("resolver is disabled", func() {
 			BeforeEach(func() {
 				sutConfig = config.ClientLookupConfig{}
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/0xERR0R/blocky/config"
@@ -13,43 +14,111 @@ import (
 )
 
 // ConditionalUpstreamResolver delegates DNS question to other DNS resolver dependent on domain name in question
+// and optionally on the client
 type ConditionalUpstreamResolver struct {
 	NextResolver
+	mapping       map[string]Resolver
+	clientMapping []clientConditionalMapping
+	rewrite       map[string]string
+	// domains, where NXDOMAIN or empty answers are passed to the next resolver
+	fallthroughDomains map[string]bool
+	// domains, where errors or SERVFAIL of the conditional upstream are passed to the next resolver
+	fallbackDomains map[string]bool
+}
+
+// clientConditionalMapping contains the conditional mapping for clients matching the client identifier
+// (client name with wildcards, IP address or CIDR)
+type clientConditionalMapping struct {
+	client  string
 	mapping map[string]Resolver
-	rewrite map[string]string
 }
 
-// NewConditionalUpstreamResolver returns new resolver instance
-func NewConditionalUpstreamResolver(cfg config.ConditionalUpstreamConfig) ChainedResolver {
-	m := make(map[string]Resolver)
+// NewConditionalUpstreamResolver returns new resolver instance with the upstream settings of the chain
+func NewConditionalUpstreamResolver(cfg config.ConditionalUpstreamConfig, settings *UpstreamSettings) ChainedResolver {
 	rewrite := make(map[string]string)
 
-	for domain, upstream := range cfg.Mapping.Upstreams {
-		upstreams := make(map[string][]config.Upstream)
-		upstreams[upstreamDefaultCfgName] = upstream
-		m[strings.ToLower(domain)] = NewParallelBestResolver(upstreams)
-	}
-
 	for k, v := range cfg.Rewrite {
 		rewrite[strings.ToLower(k)] = strings.ToLower(v)
 	}
 
-	return &ConditionalUpstreamResolver{mapping: m, rewrite: rewrite}
+	fallthroughDomains := make(map[string]bool, len(cfg.Fallthrough))
+
+	for _, domain := range cfg.Fallthrough {
+		fallthroughDomains[strings.ToLower(domain)] = true
+	}
+
+	fallbackDomains := make(map[string]bool, len(cfg.Fallback))
+
+	for _, domain := range cfg.Fallback {
+		fallbackDomains[strings.ToLower(domain)] = true
+	}
+
+	var clientMapping []clientConditionalMapping
+
+	for client, mapping := range cfg.ClientMapping {
+		clientMapping = append(clientMapping, clientConditionalMapping{
+			client:  client,
+			mapping: createConditionalMapping(mapping, settings),
+		})
+	}
+
+	// sort for deterministic order if multiple client identifiers match
+	sort.Slice(clientMapping, func(i, j int) bool {
+		return clientMapping[i].client < clientMapping[j].client
+	})
+
+	return &ConditionalUpstreamResolver{
+		mapping:            createConditionalMapping(cfg.Mapping, settings),
+		clientMapping:      clientMapping,
+		rewrite:            rewrite,
+		fallthroughDomains: fallthroughDomains,
+		fallbackDomains:    fallbackDomains,
+	}
+}
+
+func createConditionalMapping(cfg config.ConditionalUpstreamMapping, settings *UpstreamSettings) map[string]Resolver {
+	m := make(map[string]Resolver)
+
+	for domain, upstream := range cfg.Upstreams {
+		upstreams := make(map[string][]config.Upstream)
+		upstreams[upstreamDefaultCfgName] = upstream
+		m[strings.ToLower(domain)] = NewParallelBestResolver(upstreams, settings)
+	}
+
+	return m
 }
 
 // Configuration returns current configuration
 func (r *ConditionalUpstreamResolver) Configuration() (result []string) {
-	if len(r.mapping) > 0 {
+	if len(r.mapping) > 0 || len(r.clientMapping) > 0 {
 		for key, val := range r.mapping {
 			result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
 		}
 
+		if len(r.clientMapping) > 0 {
+			result = append(result, "clientMapping:")
+			for _, cm := range r.clientMapping {
+				result = append(result, fmt.Sprintf("  %s:", cm.client))
+				for key, val := range cm.mapping {
+					result = append(result, fmt.Sprintf("    %s = \"%s\"", key, val))
+				}
+			}
+		}
+
 		if len(r.rewrite) > 0 {
 			result = append(result, "rewrite:")
 			for key, val := range r.rewrite {
 				result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
 			}
 		}
+
+		if len(r.fallthroughDomains) > 0 {
+			result = append(result, fmt.Sprintf("fallthrough = %v", sortedDomains(r.fallthroughDomains)))
+		}
+
+		if len(r.fallbackDomains) > 0 {
+			result = append(result, fmt.Sprintf("fallback = %v", sortedDomains(r.fallbackDomains)))
+		}
 	} else {
 		result = []string{"deactivated"}
 	}
@@ -57,6 +126,17 @@ func (r *ConditionalUpstreamResolver) Configuration() (result []string) {
 	return
 }
 
+func sortedDomains(domains map[string]bool) []string {
+	result := make([]string, 0, len(domains))
+	for domain := range domains {
+		result = append(result, domain)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
 func (r *ConditionalUpstreamResolver) applyRewrite(domain string) string {
 	for k, v := range r.rewrite {
 		if strings.HasSuffix(domain, "."+k) {
@@ -71,28 +151,21 @@ func (r *ConditionalUpstreamResolver) applyRewrite(domain string) string {
 func (r *ConditionalUpstreamResolver) Resolve(request *model.Request) (*model.Response, error) {
 	logger := withPrefix(request.Log, "conditional_resolver")
 
-	if len(r.mapping) > 0 {
+	if len(r.mapping) > 0 || len(r.clientMapping) > 0 {
 		domainFromQuestion := r.applyRewrite(util.ExtractDomain(request.Req.Question[0]))
-		domain := domainFromQuestion
-
-		if !strings.Contains(domainFromQuestion, ".") {
-			if resolver, found := r.mapping["."]; found {
-				return r.internalResolve(resolver, domainFromQuestion, domain, request)
-			}
-		} else {
-			// try with domain with and without sub-domains
-			for len(domain) > 0 {
-				if resolver, found := r.mapping[domain]; found {
-					return r.internalResolve(resolver, domainFromQuestion, domain, request)
-				}
 
-				if i := strings.Index(domain, "."); i >= 0 {
-					domain = domain[i+1:]
-				} else {
-					break
+		// client specific mappings have precedence over the general mapping
+		for _, cm := range r.clientMapping {
+			if clientMatches(cm.client, request) {
+				if resolver, domain, found := findConditionalResolver(cm.mapping, domainFromQuestion); found {
+					return r.resolveConditional(resolver, domainFromQuestion, domain, request)
 				}
 			}
 		}
+
+		if resolver, domain, found := findConditionalResolver(r.mapping, domainFromQuestion); found {
+			return r.resolveConditional(resolver, domainFromQuestion, domain, request)
+		}
 	}
 
 	logger.WithField("next_resolver", Name(r.next)).Trace("go to next resolver")
@@ -100,6 +173,89 @@ func (r *ConditionalUpstreamResolver) Resolve(request *model.Request) (*model.Re
 	return r.next.Resolve(request)
 }
 
+// isClientSpecific checks if the domain of the request is mapped for some clients, the answer depends on the client
+func (r *ConditionalUpstreamResolver) isClientSpecific(request *model.Request) bool {
+	if len(r.clientMapping) == 0 {
+		return false
+	}
+
+	domainFromQuestion := r.applyRewrite(util.ExtractDomain(request.Req.Question[0]))
+
+	for _, cm := range r.clientMapping {
+		if _, _, found := findConditionalResolver(cm.mapping, domainFromQuestion); found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findConditionalResolver returns the resolver for the domain with and without sub-domains
+func findConditionalResolver(mapping map[string]Resolver, domainFromQuestion string) (Resolver, string, bool) {
+	domain := domainFromQuestion
+
+	if !strings.Contains(domainFromQuestion, ".") {
+		resolver, found := mapping["."]
+
+		return resolver, domain, found
+	}
+
+	// try with domain with and without sub-domains
+	for len(domain) > 0 {
+		if resolver, found := mapping[domain]; found {
+			return resolver, domain, true
+		}
+
+		if i := strings.Index(domain, "."); i >= 0 {
+			domain = domain[i+1:]
+		} else {
+			break
+		}
+	}
+
+	return nil, "", false
+}
+
+// clientMatches checks if the client name, IP or CIDR matches the client identifier
+func clientMatches(client string, request *model.Request) bool {
+	for _, cName := range request.ClientNames {
+		if util.ClientNameMatchesGroupName(client, cName) {
+			return true
+		}
+	}
+
+	return client == request.ClientIP.String() || util.CidrContainsIP(client, request.ClientIP)
+}
+
+// resolveConditional resolves the query with the conditional resolver. The query is passed with the original question
+// to the next resolver, for fallthrough domains if the conditional upstream returns NXDOMAIN or an empty answer and
+// for fallback domains if the conditional upstream fails or returns SERVFAIL
+func (r *ConditionalUpstreamResolver) resolveConditional(reso Resolver, doFQ, do string,
+	req *model.Request) (*model.Response, error) {
+	if !r.fallthroughDomains[do] && !r.fallbackDomains[do] {
+		return r.internalResolve(reso, doFQ, do, req)
+	}
+
+	question := req.Req.Question[0].Name
+	logger := withPrefix(req.Log, "conditional_resolver").WithField("domain", do)
+
+	response, err := r.internalResolve(reso, doFQ, do, req)
+
+	switch {
+	case r.fallthroughDomains[do] && err == nil && (response.Res.Rcode == dns.RcodeNameError ||
+		(response.Res.Rcode == dns.RcodeSuccess && len(response.Res.Answer) == 0)):
+		logger.Debug("no answer from conditional upstream, fall through to next resolver")
+	case r.fallbackDomains[do] && (err != nil || response.Res.Rcode == dns.RcodeServerFailure):
+		logger.WithError(err).Debug("conditional upstream failed, fall back to next resolver")
+	default:
+		return response, err
+	}
+
+	req.Req.Question[0].Name = question
+
+	return r.next.Resolve(req)
+}
+
 func (r *ConditionalUpstreamResolver) internalResolve(reso Resolver, doFQ, do string,
 	req *model.Request) (*model.Response, error) {
 	// internal request resolution
@@ -47,7 +47,7 @@ var _ = Describe("ConditionalUpstreamResolver", func() {
 						return response
 					})},
 				}},
-		})
+		}, NewUpstreamSettings(&config.Config{}))
 		m = &resolverMock{}
 		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 		sut.Next(m)
@@ -113,6 +113,278 @@ var _ = Describe("ConditionalUpstreamResolver", func() {
 			})
 		})
 	})
+	Describe("Client specific conditional mapping", func() {
+		BeforeEach(func() {
+			upstream := func(ip string) config.Upstream {
+				return TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+					response, _ = util.NewMsgWithAnswer(request.Question[0].Name, 123, dns.TypeA, ip)
+
+					return response
+				})
+			}
+
+			sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+				Mapping: config.ConditionalUpstreamMapping{
+					Upstreams: map[string][]config.Upstream{
+						"internal.corp": {upstream("192.168.178.1")},
+					}},
+				ClientMapping: map[string]config.ConditionalUpstreamMapping{
+					"vpn-*": {Upstreams: map[string][]config.Upstream{
+						"internal.corp": {upstream("10.8.0.1")},
+					}},
+					"10.9.0.0/24": {Upstreams: map[string][]config.Upstream{
+						"vpn.corp": {upstream("10.9.0.1")},
+					}},
+				},
+			}, NewUpstreamSettings(&config.Config{}))
+			sut.Next(m)
+		})
+
+		When("client name matches the client mapping", func() {
+			It("should use the client specific resolver", func() {
+				resp, err = sut.Resolve(newRequestWithClient("host.internal.corp.", dns.TypeA, "192.168.178.5", "vpn-laptop"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "10.8.0.1"))
+				Expect(resp.RType).Should(Equal(ResponseTypeCONDITIONAL))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+		})
+		When("client IP matches the client mapping", func() {
+			It("should use the client specific resolver", func() {
+				resp, err = sut.Resolve(newRequestWithClient("vpn.corp.", dns.TypeA, "10.9.0.5"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("vpn.corp.", dns.TypeA, 123, "10.9.0.1"))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+			It("should fall back to the general mapping for other domains", func() {
+				resp, err = sut.Resolve(newRequestWithClient("host.internal.corp.", dns.TypeA, "10.9.0.5"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "192.168.178.1"))
+			})
+		})
+		When("client doesn't match the client mapping", func() {
+			It("should use the general mapping", func() {
+				resp, err = sut.Resolve(newRequestWithClient("host.internal.corp.", dns.TypeA, "192.168.178.5", "laptop"))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "192.168.178.1"))
+			})
+			It("should delegate to next resolver if only a client mapping exists for the domain", func() {
+				resp, err = sut.Resolve(newRequestWithClient("vpn.corp.", dns.TypeA, "192.168.178.5", "laptop"))
+
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+		When("caching resolver is in front of the resolver", func() {
+			It("should not serve the client specific answer to other clients", func() {
+				chain := Chain(NewCachingResolver(config.CachingConfig{}, nil), sut)
+
+				resp, err = Resolve(chain, newRequestWithClient("host.internal.corp.", dns.TypeA, "192.168.178.5", "vpn-laptop"))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "10.8.0.1"))
+
+				resp, err = Resolve(chain, newRequestWithClient("host.internal.corp.", dns.TypeA, "192.168.178.6", "laptop"))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "192.168.178.1"))
+				Expect(resp.RType).Should(Equal(ResponseTypeCONDITIONAL))
+
+				resp, err = Resolve(chain, newRequestWithClient("host.internal.corp.", dns.TypeA, "192.168.178.5", "vpn-laptop"))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.internal.corp.", dns.TypeA, 123, "10.8.0.1"))
+			})
+			It("should cache the answers of domains without client mapping", func() {
+				rcode := dns.RcodeSuccess
+				answer, _ := util.NewMsgWithAnswer("other.corp.", 123, dns.TypeA, "192.168.178.2")
+				next := &resolverMock{}
+				next.On("Resolve", mock.Anything).Return(&Response{Res: answer, UpstreamRcode: &rcode}, nil)
+				sut.Next(next)
+
+				chain := Chain(NewCachingResolver(config.CachingConfig{}, nil), sut)
+
+				for i := 0; i < 2; i++ {
+					resp, err = Resolve(chain, newRequestWithClient("other.corp.", dns.TypeA, "192.168.178.5", "vpn-laptop"))
+					Expect(err).Should(Succeed())
+					Expect(resp.Res.Answer).Should(BeDNSRecord("other.corp.", dns.TypeA, 123, "192.168.178.2"))
+				}
+
+				next.AssertNumberOfCalls(GinkgoT(), "Resolve", 1)
+			})
+		})
+		It("should print the client mapping in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("clientMapping:"))
+		})
+	})
+
+	Describe("Fallthrough to next resolver", func() {
+		var fallthroughDomains []string
+
+		BeforeEach(func() {
+			fallthroughDomains = []string{"Corp.lan"}
+		})
+
+		JustBeforeEach(func() {
+			internal := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+				switch request.Question[0].Name {
+				case "unknown.corp.lan.":
+					response = new(dns.Msg)
+					response.SetRcode(request, dns.RcodeNameError)
+				case "empty.corp.lan.":
+					response = new(dns.Msg)
+					response.SetReply(request)
+				default:
+					response, _ = util.NewMsgWithAnswer(request.Question[0].Name, 123, dns.TypeA, "10.0.0.1")
+				}
+
+				return response
+			})
+
+			sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+				Rewrite: map[string]string{"corp.example.com": "corp.lan"},
+				Mapping: config.ConditionalUpstreamMapping{
+					Upstreams: map[string][]config.Upstream{"corp.lan": {internal}},
+				},
+				Fallthrough: fallthroughDomains,
+			}, NewUpstreamSettings(&config.Config{}))
+			sut.Next(m)
+		})
+
+		When("conditional upstream returns an answer", func() {
+			It("should return the answer", func() {
+				resp, err = sut.Resolve(newRequest("host.corp.lan.", dns.TypeA))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.corp.lan.", dns.TypeA, 123, "10.0.0.1"))
+				Expect(resp.RType).Should(Equal(ResponseTypeCONDITIONAL))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+		})
+
+		When("conditional upstream returns NXDOMAIN", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequest("unknown.corp.lan.", dns.TypeA))
+
+				m.AssertExpectations(GinkgoT())
+				Expect(resp.RType).ShouldNot(Equal(ResponseTypeCONDITIONAL))
+			})
+		})
+
+		When("conditional upstream returns an empty answer", func() {
+			It("should delegate the original question to next resolver", func() {
+				request := newRequest("empty.corp.example.com.", dns.TypeA)
+				resp, err = sut.Resolve(request)
+
+				m.AssertExpectations(GinkgoT())
+				Expect(request.Req.Question[0].Name).Should(Equal("empty.corp.example.com."))
+			})
+		})
+
+		When("domain is not configured for fallthrough", func() {
+			BeforeEach(func() {
+				fallthroughDomains = nil
+			})
+			It("should return NXDOMAIN of the conditional upstream", func() {
+				resp, err = sut.Resolve(newRequest("unknown.corp.lan.", dns.TypeA))
+
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+		})
+
+		It("should print the fallthrough domains in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("fallthrough = [corp.lan]"))
+		})
+	})
+
+	Describe("Fallback to next resolver", func() {
+		var fallbackDomains []string
+
+		BeforeEach(func() {
+			fallbackDomains = []string{"Corp.lan"}
+		})
+
+		JustBeforeEach(func() {
+			internal := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+				switch request.Question[0].Name {
+				case "broken.corp.lan.":
+					// invalid response
+					return nil
+				case "servfail.corp.lan.":
+					response = new(dns.Msg)
+					response.SetRcode(request, dns.RcodeServerFailure)
+				case "unknown.corp.lan.":
+					response = new(dns.Msg)
+					response.SetRcode(request, dns.RcodeNameError)
+				default:
+					response, _ = util.NewMsgWithAnswer(request.Question[0].Name, 123, dns.TypeA, "10.0.0.1")
+				}
+
+				return response
+			})
+
+			sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+				Rewrite: map[string]string{"corp.example.com": "corp.lan"},
+				Mapping: config.ConditionalUpstreamMapping{
+					Upstreams: map[string][]config.Upstream{"corp.lan": {internal}},
+				},
+				Fallback: fallbackDomains,
+			}, NewUpstreamSettings(&config.Config{}))
+			sut.Next(m)
+		})
+
+		When("conditional upstream returns an answer", func() {
+			It("should return the answer", func() {
+				resp, err = sut.Resolve(newRequest("host.corp.lan.", dns.TypeA))
+
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.corp.lan.", dns.TypeA, 123, "10.0.0.1"))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+		})
+
+		When("conditional upstream fails", func() {
+			It("should delegate the original question to next resolver", func() {
+				request := newRequest("broken.corp.example.com.", dns.TypeA)
+				resp, err = sut.Resolve(request)
+
+				m.AssertExpectations(GinkgoT())
+				Expect(request.Req.Question[0].Name).Should(Equal("broken.corp.example.com."))
+			})
+		})
+
+		When("conditional upstream returns SERVFAIL", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequest("servfail.corp.lan.", dns.TypeA))
+
+				m.AssertExpectations(GinkgoT())
+				Expect(resp.RType).ShouldNot(Equal(ResponseTypeCONDITIONAL))
+			})
+		})
+
+		When("conditional upstream returns NXDOMAIN", func() {
+			It("should return NXDOMAIN of the conditional upstream", func() {
+				resp, err = sut.Resolve(newRequest("unknown.corp.lan.", dns.TypeA))
+
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+				Expect(m.Calls).Should(BeEmpty())
+			})
+		})
+
+		When("domain is not configured for fallback", func() {
+			BeforeEach(func() {
+				fallbackDomains = nil
+			})
+			It("should return the error of the conditional upstream", func() {
+				_, err = sut.Resolve(newRequest("broken.corp.lan.", dns.TypeA))
+
+				Expect(err).Should(HaveOccurred())
+				Expect(m.Calls).Should(BeEmpty())
+
+				err = nil
+			})
+		})
+
+		It("should print the fallback domains in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("fallback = [corp.lan]"))
+		})
+	})
+
 	Describe("Delegation to next resolver", func() {
 		When("Query doesn't match defined mapping", func() {
 			It("should delegate to next resolver", func() {
@@ -132,7 +404,7 @@ var _ = Describe("ConditionalUpstreamResolver", func() {
 		})
 		When("resolver is disabled", func() {
 			BeforeEach(func() {
-				sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{})
+				sut = NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{}, NewUpstreamSettings(&config.Config{}))
 			})
 			It("should return 'disabled'", func() {
 				c := sut.Configuration()
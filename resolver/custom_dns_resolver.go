@@ -2,8 +2,11 @@ package resolver
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/0xERR0R/blocky/config"
@@ -18,35 +21,125 @@ import (
 type CustomDNSResolver struct {
 	NextResolver
 	mapping          map[string][]net.IP
+	clientMapping    []clientCustomDNSMapping
 	reverseAddresses map[string][]string
 	ttl              uint32
+	answerOrder      config.CustomDNSAnswerOrder
+	rrCounterLock    sync.Mutex
+	rrCounter        map[string]int
+	records          map[string][]dns.RR
+	reverseZones     config.CustomDNSReverseZones
+	// locally served zones, the most specific zone comes first
+	zones []*customDNSZone
+}
+
+// clientCustomDNSMapping contains the custom DNS mapping for clients matching the client identifier
+// (client name with wildcards, IP address or CIDR)
+type clientCustomDNSMapping struct {
+	client  string
+	mapping map[string][]net.IP
 }
 
 // NewCustomDNSResolver creates new resolver instance
 func NewCustomDNSResolver(cfg config.CustomDNSConfig) ChainedResolver {
-	m := make(map[string][]net.IP)
+	m := createCustomDNSMapping(cfg.Mapping)
 	reverse := make(map[string][]string)
 
 	for url, ips := range cfg.Mapping.HostIPs {
-		m[strings.ToLower(url)] = ips
-
 		for _, ip := range ips {
 			r, _ := dns.ReverseAddr(ip.String())
 			reverse[r] = append(reverse[r], url)
 		}
 	}
 
+	var clientMapping []clientCustomDNSMapping
+
+	for client, mapping := range cfg.ClientMapping {
+		clientMapping = append(clientMapping, clientCustomDNSMapping{
+			client:  client,
+			mapping: createCustomDNSMapping(mapping),
+		})
+	}
+
+	// sort for deterministic order if multiple client identifiers match
+	sort.Slice(clientMapping, func(i, j int) bool {
+		return clientMapping[i].client < clientMapping[j].client
+	})
+
 	ttl := uint32(time.Duration(cfg.CustomTTL).Seconds())
 
-	return &CustomDNSResolver{mapping: m, reverseAddresses: reverse, ttl: ttl}
+	records := make(map[string][]dns.RR)
+
+	for _, rr := range cfg.Records {
+		name := util.ExtractDomainOnly(rr.Header().Name)
+		records[name] = append(records[name], rr)
+	}
+
+	zones := make([]*customDNSZone, 0, len(cfg.Zones))
+	for _, zoneCfg := range cfg.Zones {
+		zones = append(zones, newCustomDNSZone(zoneCfg, ttl))
+	}
+
+	sort.Slice(zones, func(i, j int) bool {
+		return dns.CountLabel(zones[i].name) > dns.CountLabel(zones[j].name)
+	})
+
+	return &CustomDNSResolver{
+		mapping:          m,
+		clientMapping:    clientMapping,
+		reverseAddresses: reverse,
+		ttl:              ttl,
+		answerOrder:      cfg.AnswerOrder,
+		rrCounter:        make(map[string]int),
+		records:          records,
+		reverseZones:     cfg.ReverseZones,
+		zones:            zones,
+	}
+}
+
+func createCustomDNSMapping(cfg config.CustomDNSMapping) map[string][]net.IP {
+	m := make(map[string][]net.IP)
+
+	for url, ips := range cfg.HostIPs {
+		m[strings.ToLower(url)] = ips
+	}
+
+	return m
 }
 
 // Configuration returns current resolver configuration
 func (r *CustomDNSResolver) Configuration() (result []string) {
-	if len(r.mapping) > 0 {
+	if len(r.mapping) > 0 || len(r.clientMapping) > 0 || len(r.records) > 0 || len(r.reverseZones) > 0 ||
+		len(r.zones) > 0 {
 		for key, val := range r.mapping {
 			result = append(result, fmt.Sprintf("%s = \"%s\"", key, val))
 		}
+
+		if len(r.clientMapping) > 0 {
+			result = append(result, "clientMapping:")
+			for _, cm := range r.clientMapping {
+				result = append(result, fmt.Sprintf("  %s:", cm.client))
+				for key, val := range cm.mapping {
+					result = append(result, fmt.Sprintf("    %s = \"%s\"", key, val))
+				}
+			}
+		}
+
+		for _, rrs := range r.records {
+			for _, rr := range rrs {
+				result = append(result, fmt.Sprintf("record = \"%s\"", strings.ReplaceAll(rr.String(), "\t", " ")))
+			}
+		}
+
+		for _, zone := range r.reverseZones {
+			result = append(result, fmt.Sprintf("reverseZone %s = \"%s\"", zone.Subnet, zone.Template))
+		}
+
+		for _, zone := range r.zones {
+			result = append(result, fmt.Sprintf("zone = \"%s\"", strings.ReplaceAll(zone.soa.String(), "\t", " ")))
+		}
+
+		result = append(result, fmt.Sprintf("answerOrder = %s", r.answerOrder))
 	} else {
 		result = []string{"deactivated"}
 	}
@@ -63,6 +156,10 @@ func (r *CustomDNSResolver) handleReverseDNS(request *model.Request) *model.Resp
 	question := request.Req.Question[0]
 	if question.Qtype == dns.TypePTR {
 		urls, found := r.reverseAddresses[question.Name]
+		if !found {
+			urls, found = r.generateReverseName(question.Name)
+		}
+
 		if found {
 			response := new(dns.Msg)
 			response.SetReply(request.Req)
@@ -82,6 +179,141 @@ func (r *CustomDNSResolver) handleReverseDNS(request *model.Request) *model.Resp
 	return nil
 }
 
+// generateReverseName returns the name generated by the most specific reverse zone containing the address
+func (r *CustomDNSResolver) generateReverseName(reverseName string) ([]string, bool) {
+	if len(r.reverseZones) == 0 {
+		return nil, false
+	}
+
+	ip := util.ParseReverseAddr(reverseName)
+	if ip == nil {
+		return nil, false
+	}
+
+	for _, zone := range r.reverseZones {
+		if zone.Subnet.Contains(ip) {
+			label := strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+
+			return []string{strings.ReplaceAll(zone.Template, config.ReverseZoneIPPlaceholder, label)}, true
+		}
+	}
+
+	return nil, false
+}
+
+// handleRecords returns the configured TXT, MX and SRV records for the queried name
+func (r *CustomDNSResolver) handleRecords(request *model.Request) *model.Response {
+	question := request.Req.Question[0]
+
+	rrs, found := r.records[util.ExtractDomain(question)]
+	if !found {
+		return nil
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == question.Qtype {
+			answer := dns.Copy(rr)
+			answer.Header().Name = question.Name
+			answer.Header().Ttl = r.ttl
+			response.Answer = append(response.Answer, answer)
+		}
+	}
+
+	if len(response.Answer) == 0 {
+		return nil
+	}
+
+	r.orderAnswer(util.ExtractDomain(question), question.Qtype, response.Answer)
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}
+}
+
+// findZone returns the most specific zone containing the name
+func (r *CustomDNSResolver) findZone(name string) *customDNSZone {
+	for _, zone := range r.zones {
+		if zone.contains(name) {
+			return zone
+		}
+	}
+
+	return nil
+}
+
+// handleZoneApex returns the SOA and NS records for the queries of a zone apex
+func (r *CustomDNSResolver) handleZoneApex(request *model.Request) *model.Response {
+	question := request.Req.Question[0]
+
+	zone := r.findZone(question.Name)
+	if zone == nil {
+		return nil
+	}
+
+	answer, ok := zone.apexAnswer(question)
+	if !ok {
+		return nil
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+	response.Authoritative = true
+	response.Answer = answer
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}
+}
+
+// emptyResponse returns NOERROR without answer. In a zone, the response is authoritative with the SOA record
+func (r *CustomDNSResolver) emptyResponse(request *model.Request) *model.Response {
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+
+	r.addZoneSOA(response)
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}
+}
+
+// addZoneSOA marks the response as authoritative, if the name is in a zone. Responses without answer get the SOA
+// record of the zone (negative caching)
+func (r *CustomDNSResolver) addZoneSOA(response *dns.Msg) {
+	zone := r.findZone(response.Question[0].Name)
+	if zone == nil {
+		return
+	}
+
+	response.Authoritative = true
+
+	if len(response.Answer) == 0 {
+		response.Ns = []dns.RR{dns.Copy(zone.soa)}
+	}
+}
+
+// orderAnswer reorders the answer records in place according to the configured answer order
+func (r *CustomDNSResolver) orderAnswer(domain string, qType uint16, answer []dns.RR) {
+	if len(answer) < 2 {
+		return
+	}
+
+	switch r.answerOrder {
+	case config.CustomDNSAnswerOrderShuffle:
+		rand.Shuffle(len(answer), func(i, j int) {
+			answer[i], answer[j] = answer[j], answer[i]
+		})
+	case config.CustomDNSAnswerOrderRoundRobin:
+		key := util.GenerateCacheKey(qType, domain)
+
+		r.rrCounterLock.Lock()
+		offset := r.rrCounter[key] % len(answer)
+		r.rrCounter[key] = offset + 1
+		r.rrCounterLock.Unlock()
+
+		rotated := append(append([]dns.RR{}, answer[offset:]...), answer[:offset]...)
+		copy(answer, rotated)
+	case config.CustomDNSAnswerOrderFixed:
+	}
+}
+
 // Resolve uses internal mapping to resolve the query
 func (r *CustomDNSResolver) Resolve(request *model.Request) (*model.Response, error) {
 	logger := withPrefix(request.Log, "custom_dns_resolver")
@@ -91,47 +323,92 @@ func (r *CustomDNSResolver) Resolve(request *model.Request) (*model.Response, er
 		return reverseResp, nil
 	}
 
-	if len(r.mapping) > 0 {
+	if recordsResp := r.handleRecords(request); recordsResp != nil {
+		logger.WithField("answer", util.AnswerToString(recordsResp.Res.Answer)).Debugf("returning custom dns record")
+
+		return recordsResp, nil
+	}
+
+	if zoneResp := r.handleZoneApex(request); zoneResp != nil {
+		logger.WithField("answer", util.AnswerToString(zoneResp.Res.Answer)).Debugf("returning zone apex records")
+
+		return zoneResp, nil
+	}
+
+	if ips, domain, found := r.findIPs(request); found {
 		response := new(dns.Msg)
 		response.SetReply(request.Req)
 
 		question := request.Req.Question[0]
-		domain := util.ExtractDomain(question)
-
-		for len(domain) > 0 {
-			ips, found := r.mapping[domain]
-			if found {
-				for _, ip := range ips {
-					if isSupportedType(ip, question) {
-						rr, _ := util.CreateAnswerFromQuestion(question, ip, r.ttl)
-						response.Answer = append(response.Answer, rr)
-					}
-				}
 
-				if len(response.Answer) > 0 {
-					logger.WithFields(logrus.Fields{
-						"answer": util.AnswerToString(response.Answer),
-						"domain": domain,
-					}).Debugf("returning custom dns entry")
+		for _, ip := range ips {
+			if isSupportedType(ip, question) {
+				rr, _ := util.CreateAnswerFromQuestion(question, ip, r.ttl)
+				response.Answer = append(response.Answer, rr)
+			}
+		}
+
+		if len(response.Answer) > 0 {
+			r.orderAnswer(domain, question.Qtype, response.Answer)
 
-					return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}, nil
-				}
+			logger.WithFields(logrus.Fields{
+				"answer": util.AnswerToString(response.Answer),
+				"domain": domain,
+			}).Debugf("returning custom dns entry")
+		}
 
-				// Mapping exists for this domain, but for another type
-				// return NOERROR with empty result
+		r.addZoneSOA(response)
 
-				return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}, nil
-			}
+		// if the mapping exists for this domain, but for another type, the result is NOERROR with empty answer
+		return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "CUSTOM DNS"}, nil
+	}
 
-			if i := strings.Index(domain, "."); i >= 0 {
-				domain = domain[i+1:]
-			} else {
-				break
-			}
-		}
+	if _, found := r.records[util.ExtractDomain(request.Req.Question[0])]; found {
+		// records exist for this domain, but for another type
+		// return NOERROR with empty result
+		return r.emptyResponse(request), nil
+	}
+
+	if zone := r.findZone(request.Req.Question[0].Name); zone != nil &&
+		strings.EqualFold(request.Req.Question[0].Name, zone.name) {
+		// the apex of a zone exists, other types than SOA and NS have no records
+		return r.emptyResponse(request), nil
 	}
 
 	logger.WithField("resolver", Name(r.next)).Trace("go to next resolver")
 
 	return r.next.Resolve(request)
 }
+
+// findIPs returns the addresses for the queried domain or its parent domains. Client specific mappings have
+// precedence over the general mapping
+func (r *CustomDNSResolver) findIPs(request *model.Request) (ips []net.IP, domain string, found bool) {
+	domainFromQuestion := util.ExtractDomain(request.Req.Question[0])
+
+	for _, cm := range r.clientMapping {
+		if clientMatches(cm.client, request) {
+			if ips, domain, found = findCustomDNSIPs(cm.mapping, domainFromQuestion); found {
+				return
+			}
+		}
+	}
+
+	return findCustomDNSIPs(r.mapping, domainFromQuestion)
+}
+
+// findCustomDNSIPs returns the addresses for the domain with and without sub-domains
+func findCustomDNSIPs(mapping map[string][]net.IP, domain string) ([]net.IP, string, bool) {
+	for len(domain) > 0 {
+		if ips, found := mapping[domain]; found {
+			return ips, domain, true
+		}
+
+		if i := strings.Index(domain, "."); i >= 0 {
+			domain = domain[i+1:]
+		} else {
+			break
+		}
+	}
+
+	return nil, "", false
+}
@@ -124,6 +124,377 @@ var _ = Describe("CustomDNSResolver", func() {
 		})
 	})
 
+	Describe("Answer order for multiple IPs", func() {
+		var cfg config.CustomDNSConfig
+
+		BeforeEach(func() {
+			cfg = config.CustomDNSConfig{
+				Mapping: config.CustomDNSMapping{HostIPs: map[string][]net.IP{
+					"multiple.ips": {
+						net.ParseIP("192.168.143.123"),
+						net.ParseIP("192.168.143.124"),
+						net.ParseIP("192.168.143.125")},
+				}},
+				CustomTTL: config.Duration(time.Duration(TTL) * time.Second),
+			}
+		})
+
+		answerIPs := func() (result []string) {
+			resp, err := sut.Resolve(newRequest("multiple.ips.", dns.TypeA))
+			Expect(err).Should(Succeed())
+
+			for _, rr := range resp.Res.Answer {
+				result = append(result, rr.(*dns.A).A.String())
+			}
+
+			return result
+		}
+
+		When("answer order is fixed", func() {
+			It("should always return the configured order", func() {
+				sut = NewCustomDNSResolver(cfg)
+
+				for i := 0; i < 3; i++ {
+					Expect(answerIPs()).Should(Equal([]string{"192.168.143.123", "192.168.143.124", "192.168.143.125"}))
+				}
+			})
+		})
+		When("answer order is round-robin", func() {
+			It("should rotate the first address with each query", func() {
+				cfg.AnswerOrder = config.CustomDNSAnswerOrderRoundRobin
+				sut = NewCustomDNSResolver(cfg)
+
+				Expect(answerIPs()).Should(Equal([]string{"192.168.143.123", "192.168.143.124", "192.168.143.125"}))
+				Expect(answerIPs()).Should(Equal([]string{"192.168.143.124", "192.168.143.125", "192.168.143.123"}))
+				Expect(answerIPs()).Should(Equal([]string{"192.168.143.125", "192.168.143.123", "192.168.143.124"}))
+				Expect(answerIPs()).Should(Equal([]string{"192.168.143.123", "192.168.143.124", "192.168.143.125"}))
+			})
+		})
+		When("answer order is shuffle", func() {
+			It("should return all addresses", func() {
+				cfg.AnswerOrder = config.CustomDNSAnswerOrderShuffle
+				sut = NewCustomDNSResolver(cfg)
+
+				Expect(answerIPs()).Should(ConsistOf("192.168.143.123", "192.168.143.124", "192.168.143.125"))
+			})
+		})
+	})
+
+	Describe("Custom TXT, MX and SRV records", func() {
+		BeforeEach(func() {
+			newRR := func(in string) dns.RR {
+				rr, err := dns.NewRR(in)
+				Expect(err).Should(Succeed())
+
+				return rr
+			}
+
+			sut = NewCustomDNSResolver(config.CustomDNSConfig{
+				Records: config.CustomDNSRecords{
+					newRR(`custom.domain TXT "v=spf1 -all"`),
+					newRR("custom.domain MX 10 mail.custom.domain."),
+					newRR("_sip._tcp.custom.domain SRV 10 60 5060 sip.custom.domain."),
+				},
+				CustomTTL: config.Duration(time.Duration(TTL) * time.Second),
+			})
+			sut.Next(m)
+		})
+
+		When("TXT record is defined", func() {
+			It("should return the TXT record with custom TTL", func() {
+				resp, err = sut.Resolve(newRequest("Custom.Domain.", dns.TypeTXT))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].Header().Name).Should(Equal("Custom.Domain."))
+				Expect(resp.Res.Answer[0].Header().Ttl).Should(Equal(TTL))
+				Expect(resp.Res.Answer[0].(*dns.TXT).Txt).Should(Equal([]string{"v=spf1 -all"}))
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+		})
+		When("MX record is defined", func() {
+			It("should return the MX record", func() {
+				resp, err = sut.Resolve(newRequest("custom.domain.", dns.TypeMX))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].(*dns.MX).Mx).Should(Equal("mail.custom.domain."))
+				Expect(resp.Res.Answer[0].(*dns.MX).Preference).Should(BeEquivalentTo(10))
+				Expect(resp.Res.Answer[0].Header().Ttl).Should(Equal(TTL))
+			})
+		})
+		When("SRV record is defined", func() {
+			It("should return the SRV record", func() {
+				resp, err = sut.Resolve(newRequest("_sip._tcp.custom.domain.", dns.TypeSRV))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].(*dns.SRV).Target).Should(Equal("sip.custom.domain."))
+				Expect(resp.Res.Answer[0].(*dns.SRV).Port).Should(BeEquivalentTo(5060))
+			})
+		})
+		When("records are defined for the domain, but not for the queried type", func() {
+			It("should return NOERROR and empty result", func() {
+				resp, err = sut.Resolve(newRequest("custom.domain.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+		})
+		When("no record is defined for the domain", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequest("other.domain.", dns.TypeTXT))
+
+				Expect(err).Should(Succeed())
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+		It("should print records in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement(ContainSubstring("custom.domain.")))
+		})
+	})
+
+	Describe("Reverse zones", func() {
+		BeforeEach(func() {
+			_, subnet, _ := net.ParseCIDR("192.168.0.0/16")
+			_, specific, _ := net.ParseCIDR("192.168.1.0/24")
+			_, ip6Subnet, _ := net.ParseCIDR("2001:db8::/32")
+
+			sut = NewCustomDNSResolver(config.CustomDNSConfig{
+				Mapping: config.CustomDNSMapping{HostIPs: map[string][]net.IP{
+					"printer.lan": {net.ParseIP("192.168.1.5")},
+				}},
+				ReverseZones: config.CustomDNSReverseZones{
+					{Subnet: specific, Template: "host-{ip}.local"},
+					{Subnet: subnet, Template: "{ip}.lan"},
+					{Subnet: ip6Subnet, Template: "host-{ip}.local"},
+				},
+				CustomTTL: config.Duration(time.Duration(TTL) * time.Second),
+			})
+			sut.Next(m)
+		})
+
+		When("address is in a reverse zone", func() {
+			It("should return the generated name of the most specific zone", func() {
+				resp, err = sut.Resolve(newRequest("10.1.168.192.in-addr.arpa.", dns.TypePTR))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Res.Answer).Should(ConsistOf(
+					BeDNSRecord("10.1.168.192.in-addr.arpa.", dns.TypePTR, TTL, "host-192-168-1-10.local.")))
+
+				resp, err = sut.Resolve(newRequest("7.2.168.192.in-addr.arpa.", dns.TypePTR))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(ConsistOf(
+					BeDNSRecord("7.2.168.192.in-addr.arpa.", dns.TypePTR, TTL, "192-168-2-7.lan.")))
+			})
+
+			It("should generate names for IPv6 addresses", func() {
+				name, _ := dns.ReverseAddr("2001:db8::10")
+				resp, err = sut.Resolve(newRequest(name, dns.TypePTR))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(ConsistOf(
+					BeDNSRecord(name, dns.TypePTR, TTL, "host-2001-db8--10.local.")))
+			})
+
+			It("should prefer the names of the mapping", func() {
+				resp, err = sut.Resolve(newRequest("5.1.168.192.in-addr.arpa.", dns.TypePTR))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(ConsistOf(
+					BeDNSRecord("5.1.168.192.in-addr.arpa.", dns.TypePTR, TTL, "printer.lan.")))
+			})
+		})
+
+		When("address is not in a reverse zone", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequest("1.0.0.10.in-addr.arpa.", dns.TypePTR))
+
+				Expect(err).Should(Succeed())
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+
+		It("should print reverse zones in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("reverseZone 192.168.1.0/24 = \"host-{ip}.local\""))
+		})
+	})
+
+	Describe("Locally served zones", func() {
+		BeforeEach(func() {
+			sut = NewCustomDNSResolver(config.CustomDNSConfig{
+				Mapping: config.CustomDNSMapping{HostIPs: map[string][]net.IP{
+					"printer.home.lan": {net.ParseIP("192.168.178.3")},
+				}},
+				Zones: []config.CustomDNSZoneConfig{
+					{Zone: "lan"},
+					{
+						Zone:        "Home.lan",
+						NameServers: []string{"ns1.home.lan", "ns2.home.lan."},
+						Mbox:        "hostmaster.home.lan",
+						Serial:      2022030101,
+						Refresh:     config.Duration(2 * time.Hour),
+						Retry:       config.Duration(30 * time.Minute),
+						Expire:      config.Duration(14 * 24 * time.Hour),
+						Minimum:     config.Duration(5 * time.Minute),
+					},
+				},
+				CustomTTL: config.Duration(time.Hour),
+			})
+			sut.Next(m)
+		})
+
+		When("the SOA record of the zone apex is queried", func() {
+			It("should return the configured SOA record", func() {
+				resp, err = sut.Resolve(newRequest("home.lan.", dns.TypeSOA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Res.Authoritative).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].String()).Should(Equal(
+					"home.lan.\t3600\tIN\tSOA\tns1.home.lan. hostmaster.home.lan. 2022030101 7200 1800 1209600 300"))
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+
+			It("should synthesize the SOA record with defaults", func() {
+				resp, err = sut.Resolve(newRequest("LAN.", dns.TypeSOA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].String()).Should(Equal(
+					"lan.\t3600\tIN\tSOA\tlocalhost. nobody.invalid. 1 3600 1200 604800 3600"))
+			})
+		})
+
+		When("the NS records of the zone apex are queried", func() {
+			It("should return the name servers", func() {
+				resp, err = sut.Resolve(newRequest("home.lan.", dns.TypeNS))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Authoritative).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].(*dns.NS).Ns).Should(Equal("ns1.home.lan."))
+				Expect(resp.Res.Answer[1].(*dns.NS).Ns).Should(Equal("ns2.home.lan."))
+			})
+		})
+
+		When("the zone apex is queried with another type", func() {
+			It("should return an empty answer with the SOA record", func() {
+				resp, err = sut.Resolve(newRequest("home.lan.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+				Expect(resp.Res.Ns).Should(HaveLen(1))
+				Expect(resp.Res.Ns[0].(*dns.SOA).Serial).Should(BeEquivalentTo(2022030101))
+			})
+		})
+
+		When("a name of the mapping in the zone is queried", func() {
+			It("should return an authoritative answer", func() {
+				resp, err = sut.Resolve(newRequest("printer.home.lan.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Authoritative).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("printer.home.lan.", dns.TypeA, 3600, "192.168.178.3"))
+				Expect(resp.Res.Ns).Should(BeEmpty())
+			})
+
+			It("should add the SOA record of the most specific zone to empty answers", func() {
+				resp, err = sut.Resolve(newRequest("printer.home.lan.", dns.TypeSOA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeEmpty())
+				Expect(resp.Res.Ns).Should(HaveLen(1))
+				Expect(resp.Res.Ns[0].Header().Name).Should(Equal("home.lan."))
+			})
+		})
+
+		When("a name in the zone without mapping is queried", func() {
+			It("should delegate to next resolver", func() {
+				resp, err = sut.Resolve(newRequest("unknown.home.lan.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+
+		It("should print the zones in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement(
+				"zone = \"lan. 3600 IN SOA localhost. nobody.invalid. 1 3600 1200 604800 3600\""))
+		})
+	})
+
+	Describe("Client specific mapping", func() {
+		BeforeEach(func() {
+			sut = NewCustomDNSResolver(config.CustomDNSConfig{
+				Mapping: config.CustomDNSMapping{HostIPs: map[string][]net.IP{
+					"service.lan": {net.ParseIP("192.168.178.10")},
+				}},
+				ClientMapping: map[string]config.CustomDNSMapping{
+					"vpn-*": {HostIPs: map[string][]net.IP{
+						"service.lan": {net.ParseIP("10.8.0.10")},
+					}},
+					"10.8.1.0/24": {HostIPs: map[string][]net.IP{
+						"service.lan": {net.ParseIP("10.8.1.10")},
+						"vpn.lan":     {net.ParseIP("10.8.1.1")},
+					}},
+				},
+				CustomTTL: config.Duration(time.Duration(TTL) * time.Second),
+			})
+			sut.Next(m)
+		})
+
+		When("client name matches the client mapping", func() {
+			It("should return the client specific address", func() {
+				resp, err = sut.Resolve(newRequestWithClient("sub.service.lan.", dns.TypeA, "192.168.178.50", "vpn-laptop"))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Res.Answer).Should(BeDNSRecord("sub.service.lan.", dns.TypeA, TTL, "10.8.0.10"))
+			})
+		})
+		When("client IP is in the CIDR of the client mapping", func() {
+			It("should return the client specific address", func() {
+				resp, err = sut.Resolve(newRequestWithClient("service.lan.", dns.TypeA, "10.8.1.5", "phone"))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("service.lan.", dns.TypeA, TTL, "10.8.1.10"))
+			})
+			It("should resolve domains which are only defined in the client mapping", func() {
+				resp, err = sut.Resolve(newRequestWithClient("vpn.lan.", dns.TypeA, "10.8.1.5", "phone"))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("vpn.lan.", dns.TypeA, TTL, "10.8.1.1"))
+			})
+		})
+		When("client does not match any client mapping", func() {
+			It("should return the default address", func() {
+				resp, err = sut.Resolve(newRequestWithClient("service.lan.", dns.TypeA, "192.168.178.50", "desktop"))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("service.lan.", dns.TypeA, TTL, "192.168.178.10"))
+			})
+			It("should delegate domains which are only defined in the client mapping", func() {
+				resp, err = sut.Resolve(newRequestWithClient("vpn.lan.", dns.TypeA, "192.168.178.50", "desktop"))
+
+				Expect(err).Should(Succeed())
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+		It("should print client mapping in configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElements("clientMapping:", "  vpn-*:", "  10.8.1.0/24:"))
+		})
+	})
+
 	Describe("Delegating to next resolver", func() {
 		When("no mapping for domain exist", func() {
 			It("should delegate to next resolver", func() {
@@ -140,7 +511,7 @@ var _ = Describe("CustomDNSResolver", func() {
 		When("resolver is enabled", func() {
 			It("should return configuration", func() {
 				c := sut.Configuration()
-				Expect(c).Should(HaveLen(3))
+				Expect(c).Should(HaveLen(4))
 			})
 		})
 
@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/miekg/dns"
+)
+
+// defaults of the synthesized SOA record, like the local zones of unbound
+const (
+	customDNSZoneNameServer = "localhost."
+	customDNSZoneMbox       = "nobody.invalid."
+	customDNSZoneSerial     = 1
+	customDNSZoneRefresh    = time.Hour
+	customDNSZoneRetry      = 20 * time.Minute
+	customDNSZoneExpire     = 7 * 24 * time.Hour
+)
+
+// customDNSZone is a locally served zone with the SOA and NS records of the apex
+type customDNSZone struct {
+	name string
+	soa  *dns.SOA
+	ns   []dns.RR
+}
+
+// newCustomDNSZone creates the records of the zone, the minimum of the SOA defaults to the TTL
+func newCustomDNSZone(cfg config.CustomDNSZoneConfig, ttl uint32) *customDNSZone {
+	name := dns.Fqdn(strings.ToLower(cfg.Zone))
+
+	header := func(rrType uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrType, Class: dns.ClassINET, Ttl: ttl}
+	}
+
+	nameServers := cfg.NameServers
+	if len(nameServers) == 0 {
+		nameServers = []string{customDNSZoneNameServer}
+	}
+
+	zone := &customDNSZone{
+		name: name,
+		soa: &dns.SOA{
+			Hdr:     header(dns.TypeSOA),
+			Ns:      dns.Fqdn(nameServers[0]),
+			Mbox:    dns.Fqdn(valueOrDefault(cfg.Mbox, customDNSZoneMbox)),
+			Serial:  cfg.Serial,
+			Refresh: seconds(cfg.Refresh, customDNSZoneRefresh),
+			Retry:   seconds(cfg.Retry, customDNSZoneRetry),
+			Expire:  seconds(cfg.Expire, customDNSZoneExpire),
+			Minttl:  seconds(cfg.Minimum, time.Duration(ttl)*time.Second),
+		},
+	}
+
+	if zone.soa.Serial == 0 {
+		zone.soa.Serial = customDNSZoneSerial
+	}
+
+	for _, ns := range nameServers {
+		zone.ns = append(zone.ns, &dns.NS{Hdr: header(dns.TypeNS), Ns: dns.Fqdn(ns)})
+	}
+
+	return zone
+}
+
+// apexAnswer returns the SOA or NS records for queries of the zone apex
+func (z *customDNSZone) apexAnswer(question dns.Question) ([]dns.RR, bool) {
+	if !strings.EqualFold(question.Name, z.name) {
+		return nil, false
+	}
+
+	switch question.Qtype {
+	case dns.TypeSOA:
+		return []dns.RR{dns.Copy(z.soa)}, true
+	case dns.TypeNS:
+		return copyRRs(z.ns), true
+	}
+
+	return nil, false
+}
+
+// contains returns true if the name is the apex or a sub domain of the zone
+func (z *customDNSZone) contains(name string) bool {
+	return dns.IsSubDomain(z.name, strings.ToLower(name))
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+func seconds(value config.Duration, defaultValue time.Duration) uint32 {
+	if value <= 0 {
+		return uint32(defaultValue.Seconds())
+	}
+
+	return uint32(time.Duration(value).Seconds())
+}
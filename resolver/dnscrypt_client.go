@@ -0,0 +1,452 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	dnscryptCertMagic     = "DNSC"
+	dnscryptResolverMagic = "r6fnvWj8"
+
+	// X25519-XSalsa20Poly1305, the encryption system supported by all DNSCrypt servers
+	dnscryptESVersion = 0x0001
+
+	dnscryptCertSize      = 124
+	dnscryptHalfNonceSize = 12
+	dnscryptNonceSize     = 24
+	dnscryptKeySize       = 32
+
+	// queries are padded to a multiple of the block size, UDP queries to the min. size (avoids amplification)
+	dnscryptPaddingBlockSize = 64
+	dnscryptMinUDPQuerySize  = 256
+	dnscryptPaddingMarker    = 0x80
+
+	// used without configured upstream timeout, like the timeout of the DNS library
+	dnscryptDefaultTimeout = 2 * time.Second
+)
+
+var errDNSCryptDecrypt = errors.New("can't decrypt DNSCrypt response")
+
+// dnscryptUpstreamClient sends encrypted queries to a DNSCrypt v2 server. The certificate of the server is fetched
+// via TXT query of the provider name, verified with the provider public key and renewed after expiration
+type dnscryptUpstreamClient struct {
+	providerName string
+	providerKey  ed25519.PublicKey
+	timeout      time.Duration
+	// repeat the query via TCP if the UDP response is truncated
+	retryTruncated bool
+
+	udpDialer, tcpDialer *net.Dialer
+
+	lock sync.Mutex
+	cert *dnscryptCert
+
+	// key pair of the client, generated with the first handshake. The shared key is computed for each certificate
+	publicKey, secretKey *[dnscryptKeySize]byte
+}
+
+type dnscryptCert struct {
+	serial      uint32
+	clientMagic []byte
+	sharedKey   [dnscryptKeySize]byte
+	notAfter    time.Time
+}
+
+func newDNSCryptUpstreamClient(cfg config.Upstream, timeout time.Duration,
+	settings *UpstreamSettings) *dnscryptUpstreamClient {
+	// the key is validated by the stamp parser
+	providerKey, _ := hex.DecodeString(cfg.PublicKey)
+
+	if timeout <= 0 {
+		timeout = dnscryptDefaultTimeout
+	}
+
+	return &dnscryptUpstreamClient{
+		providerName:   dns.Fqdn(cfg.ProviderName),
+		providerKey:    providerKey,
+		timeout:        timeout,
+		retryTruncated: settings.retryTruncated,
+		udpDialer:      settings.udpDialer,
+		tcpDialer:      settings.tcpDialer,
+	}
+}
+
+func (r *dnscryptUpstreamClient) callExternal(ctx context.Context, msg *dns.Msg,
+	upstreamURL string, protocol model.RequestProtocol) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+
+	cert, err := r.certificate(upstreamURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// don't forward the client's transaction ID, each upstream query gets a random ID
+	query := msg.Copy()
+	query.Id = dns.Id()
+
+	network := "udp"
+	if protocol == model.RequestProtocolTCP {
+		network = "tcp"
+	}
+
+	response, err := r.exchange(ctx, cert, query, upstreamURL, network)
+	if err == nil && network == "udp" && response.Truncated && r.retryTruncated {
+		response, err = r.exchange(ctx, cert, query, upstreamURL, "tcp")
+	}
+
+	if err != nil {
+		if errors.Is(err, errDNSCryptDecrypt) {
+			// the server may have rotated its key, fetch the certificate again with the next query
+			r.resetCertificate(cert)
+		}
+
+		return nil, time.Since(start), err
+	}
+
+	if err = verifyResponse(query, response); err != nil {
+		return nil, time.Since(start), err
+	}
+
+	response.Id = msg.Id
+
+	return response, time.Since(start), nil
+}
+
+// certificate returns the current certificate, an expired certificate is renewed
+func (r *dnscryptUpstreamClient) certificate(upstreamURL string) (*dnscryptCert, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cert != nil && time.Now().Before(r.cert.notAfter) {
+		return r.cert, nil
+	}
+
+	cert, err := r.fetchCertificate(upstreamURL)
+
+	evt.Bus().Publish(evt.DNSCryptHandshakeFinished, upstreamURL, err == nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("DNSCrypt handshake with '%s' failed: %w", upstreamURL, err)
+	}
+
+	logger("upstream_resolver").WithField("upstream", upstreamURL).
+		Debugf("DNSCrypt certificate with serial %d is valid until %s", cert.serial, cert.notAfter)
+
+	r.cert = cert
+
+	return cert, nil
+}
+
+func (r *dnscryptUpstreamClient) resetCertificate(cert *dnscryptCert) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cert == cert {
+		r.cert = nil
+	}
+}
+
+// fetchCertificate returns the valid certificate with the highest serial
+func (r *dnscryptUpstreamClient) fetchCertificate(upstreamURL string) (*dnscryptCert, error) {
+	if len(r.providerKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid provider public key")
+	}
+
+	if r.secretKey == nil {
+		publicKey, secretKey, err := box.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("can't generate key pair: %w", err)
+		}
+
+		r.publicKey, r.secretKey = publicKey, secretKey
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(r.providerName, dns.TypeTXT)
+
+	client := &dns.Client{Net: "udp", Timeout: r.timeout, Dialer: r.udpDialer}
+
+	response, _, err := client.Exchange(msg, upstreamURL)
+	if err == nil && response.Truncated {
+		client = &dns.Client{Net: "tcp", Timeout: r.timeout, Dialer: r.tcpDialer}
+		response, _, err = client.Exchange(msg, upstreamURL)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't query certificate: %w", err)
+	}
+
+	var (
+		result  *dnscryptCert
+		lastErr = fmt.Errorf("no certificate received (%s)", dns.RcodeToString[response.Rcode])
+		now     = time.Now()
+	)
+
+	for _, rr := range response.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+
+		cert, err := r.parseCertificate(unescapeTXT(strings.Join(txt.Txt, "")), now)
+		if err != nil {
+			lastErr = err
+
+			continue
+		}
+
+		if result == nil || cert.serial > result.serial {
+			result = cert
+		}
+	}
+
+	if result == nil {
+		return nil, lastErr
+	}
+
+	return result, nil
+}
+
+// parseCertificate verifies the certificate and computes the shared key
+func (r *dnscryptUpstreamClient) parseCertificate(data []byte, now time.Time) (*dnscryptCert, error) {
+	if len(data) < dnscryptCertSize || string(data[:4]) != dnscryptCertMagic {
+		return nil, errors.New("invalid certificate")
+	}
+
+	if esVersion := binary.BigEndian.Uint16(data[4:6]); esVersion != dnscryptESVersion {
+		return nil, fmt.Errorf("unsupported certificate encryption system %d", esVersion)
+	}
+
+	signature, signed := data[8:72], data[72:]
+	if !ed25519.Verify(r.providerKey, signed, signature) {
+		return nil, errors.New("invalid certificate signature")
+	}
+
+	var resolverKey [dnscryptKeySize]byte
+
+	copy(resolverKey[:], signed[:32])
+
+	cert := &dnscryptCert{
+		clientMagic: signed[32:40],
+		serial:      binary.BigEndian.Uint32(signed[40:44]),
+		notAfter:    time.Unix(int64(binary.BigEndian.Uint32(signed[48:52])), 0),
+	}
+
+	notBefore := time.Unix(int64(binary.BigEndian.Uint32(signed[44:48])), 0)
+	if now.Before(notBefore) || !now.Before(cert.notAfter) {
+		return nil, fmt.Errorf("certificate with serial %d is not valid at the moment", cert.serial)
+	}
+
+	box.Precompute(&cert.sharedKey, &resolverKey, r.secretKey)
+
+	return cert, nil
+}
+
+// exchange sends the encrypted query and returns the decrypted response
+func (r *dnscryptUpstreamClient) exchange(ctx context.Context, cert *dnscryptCert, query *dns.Msg,
+	upstreamURL, network string) (*dns.Msg, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("can't pack message: %w", err)
+	}
+
+	var nonce [dnscryptNonceSize]byte
+	if _, err = rand.Read(nonce[:dnscryptHalfNonceSize]); err != nil {
+		return nil, fmt.Errorf("can't generate nonce: %w", err)
+	}
+
+	minSize := 0
+	if network == "udp" {
+		minSize = dnscryptMinUDPQuerySize
+	}
+
+	encrypted := make([]byte, 0, dnscryptMinUDPQuerySize)
+	encrypted = append(encrypted, cert.clientMagic...)
+	encrypted = append(encrypted, r.publicKey[:]...)
+	encrypted = append(encrypted, nonce[:dnscryptHalfNonceSize]...)
+	encrypted = box.SealAfterPrecomputation(encrypted, dnscryptPad(packed, minSize-len(encrypted)-box.Overhead),
+		&nonce, &cert.sharedKey)
+
+	data, err := r.send(ctx, encrypted, upstreamURL, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return cert.decrypt(data, nonce[:dnscryptHalfNonceSize])
+}
+
+// send writes the packet to the server and returns the received packet, TCP packets are length prefixed. The
+// deadline of the context shortens the timeout
+func (r *dnscryptUpstreamClient) send(ctx context.Context, packet []byte, upstreamURL, network string) ([]byte, error) {
+	dialer := r.udpDialer
+	if network == "tcp" {
+		dialer = r.tcpDialer
+	}
+
+	conn, err := dialer.DialContext(ctx, network, upstreamURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		util.LogOnError("can't close connection ", conn.Close())
+	}()
+
+	deadline := time.Now().Add(r.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if network == "udp" {
+		if _, err = conn.Write(packet); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, dns.MaxMsgSize)
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[:n], nil
+	}
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(packet)))
+
+	if _, err = conn.Write(append(length, packet...)); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.ReadFull(conn, length); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (c *dnscryptCert) decrypt(data, clientNonce []byte) (*dns.Msg, error) {
+	const headerSize = len(dnscryptResolverMagic) + dnscryptNonceSize
+
+	if len(data) < headerSize+box.Overhead || string(data[:len(dnscryptResolverMagic)]) != dnscryptResolverMagic {
+		return nil, errors.New("invalid DNSCrypt response")
+	}
+
+	var nonce [dnscryptNonceSize]byte
+
+	copy(nonce[:], data[len(dnscryptResolverMagic):headerSize])
+
+	if !bytes.Equal(nonce[:dnscryptHalfNonceSize], clientNonce) {
+		return nil, errors.New("DNSCrypt response nonce doesn't match the query")
+	}
+
+	decrypted, ok := box.OpenAfterPrecomputation(nil, data[headerSize:], &nonce, &c.sharedKey)
+	if !ok {
+		return nil, errDNSCryptDecrypt
+	}
+
+	packed, err := dnscryptUnpad(decrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(dns.Msg)
+	if err = response.Unpack(packed); err != nil {
+		return nil, fmt.Errorf("can't unpack message: %w", err)
+	}
+
+	return response, nil
+}
+
+// dnscryptPad appends the padding marker and zeros up to a multiple of the block size and at least the min. size
+func dnscryptPad(packet []byte, minSize int) []byte {
+	size := len(packet) + 1
+	if size < minSize {
+		size = minSize
+	}
+
+	size = (size + dnscryptPaddingBlockSize - 1) / dnscryptPaddingBlockSize * dnscryptPaddingBlockSize
+
+	result := make([]byte, size)
+	copy(result, packet)
+	result[len(packet)] = dnscryptPaddingMarker
+
+	return result
+}
+
+func dnscryptUnpad(packet []byte) ([]byte, error) {
+	i := bytes.LastIndexByte(packet, dnscryptPaddingMarker)
+	if i < 0 || len(bytes.Trim(packet[i+1:], "\x00")) > 0 {
+		return nil, errors.New("invalid DNSCrypt padding")
+	}
+
+	return packet[:i], nil
+}
+
+// unescapeTXT returns the raw bytes of a TXT string, the DNS library escapes non printable bytes as \DDD
+func unescapeTXT(s string) []byte {
+	const decimalEscapeLength = 4
+
+	result := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			result = append(result, s[i])
+
+			continue
+		}
+
+		if i+decimalEscapeLength <= len(s) && isDigits(s[i+1:i+decimalEscapeLength]) {
+			value := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0')
+			result = append(result, byte(value))
+			i += decimalEscapeLength - 1
+
+			continue
+		}
+
+		result = append(result, s[i+1])
+		i++
+	}
+
+	return result
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
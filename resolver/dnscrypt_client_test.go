@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	. "github.com/0xERR0R/blocky/helpertest"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/nacl/box"
+)
+
+var _ = Describe("DNSCrypt upstream", func() {
+	const providerName = "2.dnscrypt-cert.example.com."
+
+	var (
+		sut *UpstreamResolver
+
+		providerPublicKey  ed25519.PublicKey
+		providerPrivateKey ed25519.PrivateKey
+		signingKey         ed25519.PrivateKey
+		resolverPublicKey  *[32]byte
+		resolverSecretKey  *[32]byte
+		clientMagic        = []byte("clientMc")
+
+		esVersion    uint16
+		notAfter     time.Time
+		handshakes   int32
+		minQuerySize int32
+	)
+
+	certificate := func() string {
+		var numbers [14]byte
+
+		binary.BigEndian.PutUint16(numbers[0:2], esVersion)
+		binary.BigEndian.PutUint32(numbers[2:6], 1)
+		binary.BigEndian.PutUint32(numbers[6:10], uint32(time.Now().Add(-time.Hour).Unix()))
+		binary.BigEndian.PutUint32(numbers[10:14], uint32(notAfter.Unix()))
+
+		signed := append(append(append([]byte{}, resolverPublicKey[:]...), clientMagic...), numbers[2:]...)
+
+		cert := append([]byte("DNSC"), numbers[0], numbers[1], 0, 0)
+		cert = append(cert, ed25519.Sign(signingKey, signed)...)
+		cert = append(cert, signed...)
+
+		// binary TXT data must be escaped for the DNS library
+		var escaped strings.Builder
+		for _, b := range cert {
+			escaped.WriteString(fmt.Sprintf("\\%03d", b))
+		}
+
+		return escaped.String()
+	}
+
+	answerCertificateQuery := func(packet []byte) []byte {
+		request := new(dns.Msg)
+		if request.Unpack(packet) != nil || request.Question[0].Name != providerName {
+			return nil
+		}
+
+		atomic.AddInt32(&handshakes, 1)
+
+		response := new(dns.Msg)
+		response.SetReply(request)
+		response.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: providerName, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{certificate()},
+		}}
+
+		result, _ := response.Pack()
+
+		return result
+	}
+
+	answerEncryptedQuery := func(packet []byte) []byte {
+		atomic.StoreInt32(&minQuerySize, int32(len(packet)))
+
+		var (
+			clientKey [32]byte
+			nonce     [24]byte
+		)
+
+		copy(clientKey[:], packet[8:40])
+		copy(nonce[:], packet[40:52])
+
+		decrypted, ok := box.Open(nil, packet[52:], &nonce, &clientKey, resolverSecretKey)
+		if !ok {
+			return nil
+		}
+
+		packed, err := dnscryptUnpad(decrypted)
+		if err != nil {
+			return nil
+		}
+
+		request := new(dns.Msg)
+		if request.Unpack(packed) != nil {
+			return nil
+		}
+
+		response, _ := util.NewMsgWithAnswer(request.Question[0].Name, 123, dns.TypeA, "123.124.122.122")
+		response.SetReply(request)
+
+		packed, _ = response.Pack()
+
+		_, _ = rand.Read(nonce[12:])
+
+		return box.Seal(append([]byte("r6fnvWj8"), nonce[:]...), dnscryptPad(packed, 0),
+			&nonce, &clientKey, resolverSecretKey)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		providerPublicKey, providerPrivateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).Should(Succeed())
+
+		resolverPublicKey, resolverSecretKey, err = box.GenerateKey(rand.Reader)
+		Expect(err).Should(Succeed())
+
+		signingKey = providerPrivateKey
+		esVersion = dnscryptESVersion
+		notAfter = time.Now().Add(time.Hour)
+		atomic.StoreInt32(&handshakes, 0)
+	})
+
+	JustBeforeEach(func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).Should(Succeed())
+
+		DeferCleanup(conn.Close)
+
+		go func() {
+			buf := make([]byte, dns.MaxMsgSize)
+
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				packet := buf[:n]
+
+				var response []byte
+				if bytes.HasPrefix(packet, clientMagic) {
+					response = answerEncryptedQuery(packet)
+				} else {
+					response = answerCertificateQuery(packet)
+				}
+
+				if response != nil {
+					_, _ = conn.WriteTo(response, addr)
+				}
+			}
+		}()
+
+		addr := conn.LocalAddr().(*net.UDPAddr)
+
+		sut = NewUpstreamResolver(config.Upstream{
+			Net:          config.NetProtocolDnscrypt,
+			Host:         "127.0.0.1",
+			Port:         uint16(addr.Port),
+			PublicKey:    hex.EncodeToString(providerPublicKey),
+			ProviderName: providerName,
+		}, NewUpstreamSettings(&config.Config{}))
+	})
+
+	When("the certificate is valid", func() {
+		It("should resolve the query encrypted", func() {
+			var success bool
+
+			_ = Bus().SubscribeOnce(DNSCryptHandshakeFinished, func(_ string, s bool) {
+				success = s
+			})
+
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "123.124.122.122"))
+			Expect(success).Should(BeTrue())
+
+			// UDP queries are padded to the min. size
+			Expect(atomic.LoadInt32(&minQuerySize)).Should(BeNumerically(">=", dnscryptMinUDPQuerySize))
+		})
+
+		It("should reuse the certificate", func() {
+			for i := 0; i < 3; i++ {
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+			}
+
+			Expect(atomic.LoadInt32(&handshakes)).Should(BeEquivalentTo(1))
+		})
+	})
+
+	When("the certificate is expired", func() {
+		BeforeEach(func() {
+			notAfter = time.Now().Add(-time.Minute)
+		})
+
+		It("should fail the handshake", func() {
+			success := true
+
+			_ = Bus().SubscribeOnce(DNSCryptHandshakeFinished, func(_ string, s bool) {
+				success = s
+			})
+
+			_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("is not valid at the moment"))
+			Expect(success).Should(BeFalse())
+		})
+	})
+
+	When("the certificate is not signed by the provider", func() {
+		BeforeEach(func() {
+			_, signingKey, _ = ed25519.GenerateKey(rand.Reader)
+		})
+
+		It("should fail the handshake", func() {
+			_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("invalid certificate signature"))
+		})
+	})
+
+	When("the certificate uses an unsupported encryption system", func() {
+		BeforeEach(func() {
+			esVersion = 2
+		})
+
+		It("should fail the handshake", func() {
+			_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("unsupported certificate encryption system 2"))
+		})
+	})
+
+	It("should pad and unpad the packets", func() {
+		padded := dnscryptPad([]byte{1, 2, 3}, 100)
+		Expect(padded).Should(HaveLen(128))
+
+		unpadded, err := dnscryptUnpad(padded)
+		Expect(err).Should(Succeed())
+		Expect(unpadded).Should(Equal([]byte{1, 2, 3}))
+
+		_, err = dnscryptUnpad([]byte{1, 2, 3})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("should unescape TXT strings", func() {
+		Expect(unescapeTXT(`a\000\255\"b\\`)).Should(Equal([]byte{'a', 0, 255, '"', 'b', '\\'}))
+	})
+})
@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+)
+
+// dynamicBlocks contains the domains blocked at runtime via API with their expiration time
+type dynamicBlocks struct {
+	lock       sync.RWMutex
+	file       string
+	defaultTTL time.Duration
+	entries    map[string]time.Time
+}
+
+func newDynamicBlocks(file string, defaultTTL time.Duration) *dynamicBlocks {
+	d := &dynamicBlocks{
+		file:       file,
+		defaultTTL: defaultTTL,
+		entries:    make(map[string]time.Time),
+	}
+
+	if file != "" {
+		if err := d.load(); err != nil {
+			log.PrefixedLog("blacklist_resolver").Warn("can't load dynamic blocks: ", err)
+		}
+	}
+
+	return d
+}
+
+// block adds the domain with all subdomains. Zero ttl uses the default TTL
+func (d *dynamicBlocks) block(domain string, ttl time.Duration) error {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+
+	if _, ok := dns.IsDomainName(domain); !ok || domain == "" {
+		return fmt.Errorf("invalid domain '%s'", domain)
+	}
+
+	if ttl < 0 {
+		return fmt.Errorf("invalid TTL '%s'", ttl)
+	}
+
+	if ttl == 0 {
+		ttl = d.defaultTTL
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.removeExpired(time.Now())
+	d.entries[domain] = time.Now().Add(ttl)
+
+	// the block is active even if it can't be persisted
+	util.LogOnError("can't save dynamic blocks: ", d.save())
+
+	return nil
+}
+
+// match returns true if the domain or one of its parent domains is blocked
+func (d *dynamicBlocks) match(domain string) bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	if len(d.entries) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	for {
+		if expires, found := d.entries[domain]; found && now.Before(expires) {
+			return true
+		}
+
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return false
+		}
+
+		domain = domain[i+1:]
+	}
+}
+
+// list returns all not expired entries sorted by domain
+func (d *dynamicBlocks) list() []api.DynamicBlock {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	now := time.Now()
+	result := make([]api.DynamicBlock, 0, len(d.entries))
+
+	for domain, expires := range d.entries {
+		if now.Before(expires) {
+			result = append(result, api.DynamicBlock{
+				Domain:            domain,
+				Expires:           expires,
+				RemainingTTLInSec: uint(expires.Sub(now).Seconds()),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Domain < result[j].Domain
+	})
+
+	return result
+}
+
+func (d *dynamicBlocks) removeExpired(now time.Time) {
+	for domain, expires := range d.entries {
+		if !now.Before(expires) {
+			delete(d.entries, domain)
+		}
+	}
+}
+
+func (d *dynamicBlocks) load() error {
+	data, err := os.ReadFile(d.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("can't read dynamic blocks file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &d.entries); err != nil {
+		return fmt.Errorf("can't parse dynamic blocks file: %w", err)
+	}
+
+	if d.entries == nil {
+		d.entries = make(map[string]time.Time)
+	}
+
+	d.removeExpired(time.Now())
+
+	return nil
+}
+
+func (d *dynamicBlocks) save() error {
+	if d.file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(d.entries)
+	if err != nil {
+		return fmt.Errorf("can't serialize dynamic blocks: %w", err)
+	}
+
+	const fileMode = 0o600
+
+	if err := os.WriteFile(d.file, data, fileMode); err != nil {
+		return fmt.Errorf("can't write dynamic blocks file: %w", err)
+	}
+
+	return nil
+}
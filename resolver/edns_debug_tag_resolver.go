@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+// EDNS0 option code (local/experimental use range) with the response type and reason (e.g. "BLOCKED: BLOCKED (ads)")
+const ednsDebugTagOptionCode = 65532
+
+// EDNSDebugTagResolver adds the response type and reason as EDNS0 option to the responses of trusted clients, this
+// shows which resolver produced the answer in tools like dig. Only queries with EDNS0 get the option
+type EDNSDebugTagResolver struct {
+	NextResolver
+	enabled bool
+	clients []string
+}
+
+// NewEDNSDebugTagResolver returns new resolver instance
+func NewEDNSDebugTagResolver(cfg config.EDNSDebugTagConfig) ChainedResolver {
+	return &EDNSDebugTagResolver{
+		enabled: cfg.Enabled,
+		clients: cfg.Clients,
+	}
+}
+
+// Configuration returns current resolver configuration
+func (r *EDNSDebugTagResolver) Configuration() (result []string) {
+	if !r.enabled {
+		return []string{"deactivated"}
+	}
+
+	return []string{fmt.Sprintf("clients = %v", r.clients)}
+}
+
+// Resolve adds the option to the response of the next resolver
+func (r *EDNSDebugTagResolver) Resolve(request *model.Request) (*model.Response, error) {
+	resp, err := r.next.Resolve(request)
+	if err != nil || !r.enabled {
+		return resp, err
+	}
+
+	reqOpt := request.Req.IsEdns0()
+	if reqOpt == nil || !containsClientIP(r.clients, request.ClientIP) {
+		return resp, nil
+	}
+
+	opt := resp.Res.IsEdns0()
+	if opt == nil {
+		resp.Res.SetEdns0(reqOpt.UDPSize(), reqOpt.Do())
+		opt = resp.Res.IsEdns0()
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{
+		Code: ednsDebugTagOptionCode,
+		Data: []byte(fmt.Sprintf("%s: %s", resp.RType, resp.Reason)),
+	})
+
+	return resp, nil
+}
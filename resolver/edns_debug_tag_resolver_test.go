@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("EDNSDebugTagResolver", func() {
+	var (
+		sut       ChainedResolver
+		sutConfig config.EDNSDebugTagConfig
+		m         *resolverMock
+	)
+
+	debugTag := func(msg *dns.Msg) (string, bool) {
+		if opt := msg.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == ednsDebugTagOptionCode {
+					return string(local.Data), true
+				}
+			}
+		}
+
+		return "", false
+	}
+
+	ednsRequest := func(ip string) *Request {
+		request := newRequestWithClient("example.com.", dns.TypeA, ip)
+		request.Req.SetEdns0(1232, false)
+
+		return request
+	}
+
+	BeforeEach(func() {
+		sutConfig = config.EDNSDebugTagConfig{Enabled: true, Clients: []string{"192.168.178.0/24"}}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewEDNSDebugTagResolver(sutConfig)
+
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{
+			Res: new(dns.Msg), RType: ResponseTypeBLOCKED, Reason: "BLOCKED (ads)",
+		}, nil)
+		sut.Next(m)
+	})
+
+	When("the client is trusted", func() {
+		It("should add the response type and reason", func() {
+			resp, err := sut.Resolve(ednsRequest("192.168.178.10"))
+			Expect(err).Should(Succeed())
+
+			tag, found := debugTag(resp.Res)
+			Expect(found).Should(BeTrue())
+			Expect(tag).Should(Equal("BLOCKED: BLOCKED (ads)"))
+			Expect(resp.Res.IsEdns0().UDPSize()).Should(BeEquivalentTo(1232))
+		})
+
+		It("should not add an OPT record if the query has none", func() {
+			resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.IsEdns0()).Should(BeNil())
+		})
+
+		It("should keep the options of the response", func() {
+			answer, _ := util.NewMsgWithAnswer("example.com.", 300, dns.TypeA, "123.122.121.120")
+			answer.SetEdns0(4096, true)
+
+			m.ExpectedCalls = nil
+			m.On("Resolve", mock.Anything).Return(&Response{Res: answer, RType: ResponseTypeRESOLVED, Reason: "RESOLVED"}, nil)
+
+			resp, err := sut.Resolve(ednsRequest("192.168.178.10"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.IsEdns0().Do()).Should(BeTrue())
+
+			tag, _ := debugTag(resp.Res)
+			Expect(tag).Should(Equal("RESOLVED: RESOLVED"))
+		})
+	})
+
+	When("the client is not trusted", func() {
+		It("should not add the option", func() {
+			resp, err := sut.Resolve(ednsRequest("10.0.0.1"))
+			Expect(err).Should(Succeed())
+
+			_, found := debugTag(resp.Res)
+			Expect(found).Should(BeFalse())
+		})
+	})
+
+	When("the tag is disabled", func() {
+		BeforeEach(func() {
+			sutConfig.Enabled = false
+		})
+
+		It("should not add the option", func() {
+			resp, err := sut.Resolve(ednsRequest("192.168.178.10"))
+			Expect(err).Should(Succeed())
+
+			_, found := debugTag(resp.Res)
+			Expect(found).Should(BeFalse())
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+
+	It("should return configuration", func() {
+		Expect(sut.Configuration()).Should(Equal([]string{"clients = [192.168.178.0/24]"}))
+	})
+})
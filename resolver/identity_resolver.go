@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+)
+
+const identityResolverLogger = "identity_resolver"
+
+// IdentityResolver answers TXT queries for the configured name with version, build time and hostname of this
+// instance, e.g. to verify which instance answers in an anycast setup. Other types of the name get an empty answer
+type IdentityResolver struct {
+	NextResolver
+	enabled  bool
+	name     string
+	hostname string
+	clients  []string
+}
+
+// NewIdentityResolver returns new resolver instance
+func NewIdentityResolver(cfg config.IdentityConfig) ChainedResolver {
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	return &IdentityResolver{
+		enabled:  cfg.Enable,
+		name:     strings.ToLower(dns.Fqdn(cfg.Name)),
+		hostname: hostname,
+		clients:  cfg.Clients,
+	}
+}
+
+// Configuration returns current resolver configuration
+func (r *IdentityResolver) Configuration() (result []string) {
+	if !r.enabled {
+		return []string{"deactivated"}
+	}
+
+	result = append(result, fmt.Sprintf("name = %s", r.name), fmt.Sprintf("hostname = %s", r.hostname))
+
+	if len(r.clients) > 0 {
+		result = append(result, fmt.Sprintf("clients = %v", r.clients))
+	}
+
+	return result
+}
+
+// Resolve answers the queries for the identity name, all other queries are passed to the next resolver
+func (r *IdentityResolver) Resolve(request *model.Request) (*model.Response, error) {
+	question := request.Req.Question[0]
+
+	if !r.enabled || !strings.EqualFold(question.Name, r.name) ||
+		(len(r.clients) > 0 && !containsClientIP(r.clients, request.ClientIP)) {
+		return r.next.Resolve(request)
+	}
+
+	withPrefix(request.Log, identityResolverLogger).WithField("domain", util.ExtractDomain(question)).
+		Debug("answering identity query")
+
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+	response.Authoritative = true
+
+	if question.Qtype == dns.TypeTXT {
+		for _, value := range []string{
+			"version=" + util.Version,
+			"buildTime=" + util.BuildTime,
+			"hostname=" + r.hostname,
+		} {
+			response.Answer = append(response.Answer, &dns.TXT{
+				// TTL 0, the answer must not be cached by other resolvers
+				Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+				Txt: []string{value},
+			})
+		}
+	}
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "IDENTITY"}, nil
+}
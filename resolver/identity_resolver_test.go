@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("IdentityResolver", func() {
+	var (
+		sut       *IdentityResolver
+		sutConfig config.IdentityConfig
+		m         *resolverMock
+	)
+
+	BeforeEach(func() {
+		sutConfig = config.IdentityConfig{
+			Enable:   true,
+			Name:     "_blocky.version",
+			Hostname: "dns1",
+		}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewIdentityResolver(sutConfig).(*IdentityResolver)
+
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	When("the identity name is queried", func() {
+		It("should answer TXT queries with version, build time and hostname", func() {
+			resp, err := sut.Resolve(newRequest("_Blocky.Version.", dns.TypeTXT))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+			Expect(resp.Reason).Should(Equal("IDENTITY"))
+			Expect(resp.Res.Authoritative).Should(BeTrue())
+			Expect(resp.Res.Answer).Should(HaveLen(3))
+
+			var values []string
+			for _, rr := range resp.Res.Answer {
+				Expect(rr.Header().Name).Should(Equal("_Blocky.Version."))
+				Expect(rr.Header().Ttl).Should(BeZero())
+				values = append(values, rr.(*dns.TXT).Txt...)
+			}
+
+			Expect(values).Should(Equal([]string{
+				"version=" + util.Version,
+				"buildTime=" + util.BuildTime,
+				"hostname=dns1",
+			}))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should return an empty answer for other types", func() {
+			resp, err := sut.Resolve(newRequest("_blocky.version.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Answer).Should(BeEmpty())
+		})
+	})
+
+	When("other names are queried", func() {
+		It("should delegate the query", func() {
+			resp, err := sut.Resolve(newRequest("version.example.com.", dns.TypeTXT))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+	})
+
+	When("only some clients are allowed", func() {
+		BeforeEach(func() {
+			sutConfig.Clients = []string{"192.168.178.0/24"}
+		})
+
+		It("should answer only these clients", func() {
+			resp, err := sut.Resolve(newRequestWithClient("_blocky.version.", dns.TypeTXT, "192.168.178.2", "client1"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("IDENTITY"))
+
+			resp, err = sut.Resolve(newRequestWithClient("_blocky.version.", dns.TypeTXT, "10.0.0.1", "client1"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+
+		It("should return the clients in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement("clients = [192.168.178.0/24]"))
+		})
+	})
+
+	When("the resolver is disabled", func() {
+		BeforeEach(func() {
+			sutConfig.Enable = false
+		})
+
+		It("should delegate the query", func() {
+			resp, err := sut.Resolve(newRequest("_blocky.version.", dns.TypeTXT))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+
+	It("should return configuration", func() {
+		Expect(sut.Configuration()).Should(Equal([]string{"name = _blocky.version.", "hostname = dns1"}))
+	})
+})
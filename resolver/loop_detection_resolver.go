@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+const (
+	loopDetectionResolverLogger = "loop_detection_resolver"
+
+	// EDNS0 option code (local/experimental use range) for the number of blocky instances the query passed
+	loopHopsOptionCode = 65530
+)
+
+// LoopDetectionResolver returns SERVFAIL for queries, which already passed blocky too often. Each query to an
+// upstream contains the number of passed hops in an EDNS0 option
+type LoopDetectionResolver struct {
+	NextResolver
+	maxHops       uint8
+	selfAddresses []string
+}
+
+// NewLoopDetectionResolver returns new resolver instance
+func NewLoopDetectionResolver(cfg config.LoopDetectionConfig) ChainedResolver {
+	return &LoopDetectionResolver{
+		maxHops:       cfg.MaxHops,
+		selfAddresses: cfg.SelfAddresses,
+	}
+}
+
+// Configuration returns current resolver configuration
+func (r *LoopDetectionResolver) Configuration() (result []string) {
+	if r.maxHops == 0 {
+		return []string{"deactivated"}
+	}
+
+	result = append(result, fmt.Sprintf("maxHops = %d", r.maxHops))
+	result = append(result, fmt.Sprintf("selfAddresses = %v", r.selfAddresses))
+
+	return result
+}
+
+// Resolve returns SERVFAIL if the query exceeds the max hops, otherwise the request is passed to the next resolver
+func (r *LoopDetectionResolver) Resolve(request *model.Request) (*model.Response, error) {
+	if r.maxHops > 0 {
+		if hops := loopHops(request.Req); hops >= r.maxHops {
+			withPrefix(request.Log, loopDetectionResolverLogger).
+				Warnf("forwarding loop detected, query passed blocky %d times", hops)
+
+			response := new(dns.Msg)
+			response.SetRcode(request.Req, dns.RcodeServerFailure)
+
+			return &model.Response{Res: response, RType: model.ResponseTypeRESOLVED, Reason: "LOOP DETECTED"}, nil
+		}
+	}
+
+	return r.next.Resolve(request)
+}
+
+// loopHops returns the number of hops from the EDNS0 option, 0 if the option is not present
+func loopHops(msg *dns.Msg) uint8 {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == loopHopsOptionCode && len(local.Data) == 1 {
+				return local.Data[0]
+			}
+		}
+	}
+
+	return 0
+}
+
+// nextHopQuery returns a copy of the query with incremented hops. The option is only added to queries with EDNS0,
+// the query is returned unchanged otherwise
+func nextHopQuery(msg *dns.Msg) *dns.Msg {
+	if msg.IsEdns0() == nil {
+		return msg
+	}
+
+	hops := loopHops(msg)
+	if hops < math.MaxUint8 {
+		hops++
+	}
+
+	query := msg.Copy()
+	opt := query.IsEdns0()
+
+	options := opt.Option[:0]
+
+	for _, o := range opt.Option {
+		if o.Option() != loopHopsOptionCode {
+			options = append(options, o)
+		}
+	}
+
+	opt.Option = append(options, &dns.EDNS0_LOCAL{Code: loopHopsOptionCode, Data: []byte{hops}})
+
+	return query
+}
@@ -0,0 +1,128 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("LoopDetectionResolver", func() {
+	var (
+		sut ChainedResolver
+		cfg config.LoopDetectionConfig
+		m   *resolverMock
+	)
+
+	// requestWithHops creates a request with EDNS0 and the hops option
+	requestWithHops := func(hops uint8) *Request {
+		req := newRequest("example.com.", dns.TypeA)
+		req.Req.SetEdns0(4096, false)
+		req.Req.IsEdns0().Option = append(req.Req.IsEdns0().Option,
+			&dns.EDNS0_LOCAL{Code: loopHopsOptionCode, Data: []byte{hops}})
+
+		return req
+	}
+
+	BeforeEach(func() {
+		cfg = config.LoopDetectionConfig{MaxHops: 3, SelfAddresses: []string{"192.168.178.2"}}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewLoopDetectionResolver(cfg)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	When("query has no hops option", func() {
+		It("should delegate to next resolver", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			m.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("query hops are below max hops", func() {
+		It("should delegate to next resolver", func() {
+			resp, err := sut.Resolve(requestWithHops(2))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+	})
+
+	When("query hops reach max hops", func() {
+		It("should return SERVFAIL", func() {
+			resp, err := sut.Resolve(requestWithHops(3))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+			Expect(resp.Reason).Should(Equal("LOOP DETECTED"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+	})
+
+	When("loop detection is disabled", func() {
+		BeforeEach(func() {
+			cfg = config.LoopDetectionConfig{}
+		})
+		It("should delegate to next resolver", func() {
+			resp, err := sut.Resolve(requestWithHops(200))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+	})
+
+	Describe("Query for the next hop", func() {
+		When("query has no EDNS0", func() {
+			It("should not change the query", func() {
+				req := newRequest("example.com.", dns.TypeA)
+
+				Expect(nextHopQuery(req.Req)).Should(BeIdenticalTo(req.Req))
+			})
+		})
+		When("query has EDNS0 without hops option", func() {
+			It("should add the option and keep other options", func() {
+				req := newRequest("example.com.", dns.TypeA)
+				req.Req.SetEdns0(4096, false)
+				req.Req.IsEdns0().Option = append(req.Req.IsEdns0().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+				query := nextHopQuery(req.Req)
+
+				Expect(loopHops(query)).Should(Equal(uint8(1)))
+				Expect(query.IsEdns0().Option).Should(HaveLen(2))
+				Expect(req.Req.IsEdns0().Option).Should(HaveLen(1))
+			})
+		})
+		When("query has hops option", func() {
+			It("should increment the hops in a copy", func() {
+				req := requestWithHops(2)
+
+				query := nextHopQuery(req.Req)
+
+				Expect(loopHops(query)).Should(Equal(uint8(3)))
+				Expect(query.IsEdns0().Option).Should(HaveLen(1))
+				Expect(loopHops(req.Req)).Should(Equal(uint8(2)))
+			})
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("resolver is enabled", func() {
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"maxHops = 3", "selfAddresses = [192.168.178.2]"}))
+			})
+		})
+
+		When("resolver is disabled", func() {
+			BeforeEach(func() {
+				cfg = config.LoopDetectionConfig{}
+			})
+			It("should return 'deactivated'", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+			})
+		})
+	})
+})
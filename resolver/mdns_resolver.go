@@ -0,0 +1,212 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/0xERR0R/blocky/cache/expirationcache"
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/hako/durafmt"
+	"github.com/miekg/dns"
+)
+
+const (
+	mdnsResolverLogger = "mdns_resolver"
+
+	// IPv4 multicast group and port of mDNS (RFC 6762)
+	mdnsAddress = "224.0.0.251:5353"
+	mdnsDomain  = "local."
+
+	// the top bit of the class is the cache-flush bit in mDNS responses
+	mdnsCacheFlushBit = 1 << 15
+)
+
+// MDNSResolver resolves .local names with a one-shot multicast DNS query on the LAN (RFC 6762 section 5.1). The
+// query is sent from a random port, so the responders answer with unicast. The answers are cached for a short time
+type MDNSResolver struct {
+	NextResolver
+	enabled   bool
+	address   string
+	timeout   time.Duration
+	cacheTime time.Duration
+	cache     expirationcache.ExpiringCache
+}
+
+// mdnsAnswer is the cached result of the query, the name exists without records of the type (NODATA) if the
+// responder returned only other records of the name (e.g. a NSEC record or the A record for an AAAA query)
+type mdnsAnswer struct {
+	records []dns.RR
+	exists  bool
+}
+
+// NewMDNSResolver returns new resolver instance
+func NewMDNSResolver(cfg config.MDNSConfig) ChainedResolver {
+	r := &MDNSResolver{
+		enabled:   cfg.Enable,
+		address:   mdnsAddress,
+		timeout:   time.Duration(cfg.Timeout),
+		cacheTime: time.Duration(cfg.CacheTime),
+	}
+
+	if r.enabled {
+		r.cache = expirationcache.NewCache(expirationcache.WithCleanUpInterval(time.Minute))
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *MDNSResolver) Configuration() (result []string) {
+	if !r.enabled {
+		return []string{"deactivated"}
+	}
+
+	return []string{
+		fmt.Sprintf("timeout = %s", durafmt.Parse(r.timeout)),
+		fmt.Sprintf("cacheTime = %s", durafmt.Parse(r.cacheTime)),
+	}
+}
+
+// Resolve sends a multicast query for .local names, other queries are delegated to the next resolver
+func (r *MDNSResolver) Resolve(request *model.Request) (*model.Response, error) {
+	question := request.Req.Question[0]
+
+	if !r.enabled || !dns.IsSubDomain(mdnsDomain, question.Name) {
+		return r.next.Resolve(request)
+	}
+
+	logger := withPrefix(request.Log, mdnsResolverLogger).WithField("domain", util.Obfuscate(question.Name))
+
+	cacheKey := util.GenerateCacheKey(question.Qtype, strings.ToLower(question.Name))
+
+	var answer mdnsAnswer
+
+	if val, _ := r.cache.Get(cacheKey); val != nil {
+		logger.Debug("mDNS answer is cached")
+
+		answer = val.(mdnsAnswer)
+	} else {
+		var err error
+
+		answer, err = r.query(question)
+		if err != nil {
+			return nil, fmt.Errorf("can't resolve '%s' with mDNS: %w", question.Name, err)
+		}
+
+		logger.Debugf("mDNS query returned %d records", len(answer.records))
+
+		// no answer is cached too, the name doesn't exist at the moment
+		r.cache.Put(cacheKey, answer, r.cacheTime)
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+	response.Answer = copyRRs(answer.records)
+
+	if len(answer.records) == 0 && !answer.exists {
+		response.Rcode = dns.RcodeNameError
+	}
+
+	return &model.Response{Res: response, RType: model.ResponseTypeMDNS, Reason: "MDNS"}, nil
+}
+
+// query sends the question to the multicast group and returns the answer of the first responder, an empty answer
+// if no responder answers within the timeout
+func (r *MDNSResolver) query(question dns.Question) (mdnsAnswer, error) {
+	addr, err := net.ResolveUDPAddr("udp4", r.address)
+	if err != nil {
+		return mdnsAnswer{}, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return mdnsAnswer{}, err
+	}
+	defer conn.Close()
+
+	query := new(dns.Msg)
+	query.SetQuestion(question.Name, question.Qtype)
+	query.RecursionDesired = false
+
+	packed, err := query.Pack()
+	if err != nil {
+		return mdnsAnswer{}, err
+	}
+
+	if _, err := conn.WriteTo(packed, addr); err != nil {
+		return mdnsAnswer{}, err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return mdnsAnswer{}, err
+	}
+
+	buf := make([]byte, dns.MaxMsgSize)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return mdnsAnswer{}, nil
+		}
+
+		if err != nil {
+			return mdnsAnswer{}, err
+		}
+
+		response := new(dns.Msg)
+		if response.Unpack(buf[:n]) != nil || !response.Response {
+			continue
+		}
+
+		if answer := r.matchingRecords(response, question); len(answer) > 0 {
+			return mdnsAnswer{records: answer, exists: true}, nil
+		}
+
+		if containsName(response, question.Name) {
+			return mdnsAnswer{exists: true}, nil
+		}
+	}
+}
+
+// containsName returns true if the response contains records of the name, the responder owns the name
+func containsName(response *dns.Msg, name string) bool {
+	for _, section := range [][]dns.RR{response.Answer, response.Extra} {
+		for _, rr := range section {
+			if strings.EqualFold(rr.Header().Name, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchingRecords returns the records of the response for the question, the TTL is limited to the cache time
+func (r *MDNSResolver) matchingRecords(response *dns.Msg, question dns.Question) (result []dns.RR) {
+	maxTTL := uint32(r.cacheTime.Seconds())
+
+	for _, rr := range response.Answer {
+		header := rr.Header()
+
+		if !strings.EqualFold(header.Name, question.Name) ||
+			(header.Rrtype != question.Qtype && header.Rrtype != dns.TypeCNAME) {
+			continue
+		}
+
+		header.Class &^= mdnsCacheFlushBit
+
+		if header.Ttl > maxTTL {
+			header.Ttl = maxTTL
+		}
+
+		result = append(result, rr)
+	}
+
+	return result
+}
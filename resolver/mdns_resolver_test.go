@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("MDNSResolver", func() {
+	var (
+		sut       *MDNSResolver
+		sutConfig config.MDNSConfig
+		m         *resolverMock
+		responder string
+		queries   int32
+	)
+
+	BeforeEach(func() {
+		sutConfig = config.MDNSConfig{
+			Enable:    true,
+			Timeout:   config.Duration(100 * time.Millisecond),
+			CacheTime: config.Duration(time.Minute),
+		}
+
+		atomic.StoreInt32(&queries, 0)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		Expect(err).Should(Succeed())
+
+		DeferCleanup(conn.Close)
+
+		// answers like an mDNS responder with unicast to the port of the one-shot query
+		go func() {
+			buf := make([]byte, dns.MaxMsgSize)
+
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				query := new(dns.Msg)
+				if query.Unpack(buf[:n]) != nil {
+					continue
+				}
+
+				atomic.AddInt32(&queries, 1)
+
+				if query.Question[0].Name != "printer.local." {
+					continue
+				}
+
+				rr, _ := dns.NewRR("printer.local. 120 IN A 192.168.178.20")
+				rr.Header().Class |= mdnsCacheFlushBit
+
+				response := new(dns.Msg)
+				response.SetReply(query)
+
+				if query.Question[0].Qtype == dns.TypeA {
+					response.Answer = []dns.RR{rr}
+				} else {
+					// negative response with NSEC record and the existing address (RFC 6762 section 6.1)
+					nsec, _ := dns.NewRR("printer.local. 120 IN NSEC printer.local. A")
+					response.Answer = []dns.RR{nsec}
+					response.Extra = []dns.RR{rr}
+				}
+
+				packed, _ := response.Pack()
+				_, _ = conn.WriteTo(packed, addr)
+			}
+		}()
+
+		responder = conn.LocalAddr().String()
+	})
+
+	JustBeforeEach(func() {
+		sut = NewMDNSResolver(sutConfig).(*MDNSResolver)
+		sut.address = responder
+
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	When("a responder answers the query", func() {
+		It("should return the answer and cache it", func() {
+			for i := 0; i < 2; i++ {
+				resp, err := sut.Resolve(newRequest("printer.local.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeMDNS))
+				Expect(resp.Reason).Should(Equal("MDNS"))
+				Expect(resp.Res.Answer).Should(BeDNSRecord("printer.local.", dns.TypeA, 60, "192.168.178.20"))
+				Expect(resp.Res.Answer[0].Header().Class).Should(Equal(uint16(dns.ClassINET)))
+			}
+
+			Expect(atomic.LoadInt32(&queries)).Should(BeEquivalentTo(1))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+	})
+
+	When("the responder has no records of the type for the name", func() {
+		It("should return NODATA and cache it", func() {
+			for i := 0; i < 2; i++ {
+				resp, err := sut.Resolve(newRequest("printer.local.", dns.TypeAAAA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeMDNS))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			}
+
+			Expect(atomic.LoadInt32(&queries)).Should(BeEquivalentTo(1))
+		})
+	})
+
+	When("no responder answers the query", func() {
+		It("should return NXDOMAIN after the timeout", func() {
+			resp, err := sut.Resolve(newRequest("unknown.local.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeMDNS))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+		})
+	})
+
+	When("the query is not for a .local name", func() {
+		It("should delegate the query", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(atomic.LoadInt32(&queries)).Should(BeZero())
+		})
+	})
+
+	When("mDNS is disabled", func() {
+		BeforeEach(func() {
+			sutConfig.Enable = false
+		})
+
+		It("should delegate .local queries", func() {
+			resp, err := sut.Resolve(newRequest("printer.local.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+
+	It("should return configuration", func() {
+		Expect(sut.Configuration()).Should(Equal([]string{"timeout = 100 milliseconds", "cacheTime = 1 minute"}))
+	})
+})
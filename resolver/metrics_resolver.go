@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ type MetricsResolver struct {
 	totalResponse     *prometheus.CounterVec
 	totalErrors       prometheus.Counter
 	durationHistogram *prometheus.HistogramVec
+	dnssecResponses   *prometheus.CounterVec
 }
 
 // Resolve resolves the passed request
@@ -48,6 +50,12 @@ func (m *MetricsResolver) Resolve(request *model.Request) (*model.Response, erro
 				"reason":        response.Reason,
 				"response_code": dns.RcodeToString[response.Res.Rcode],
 				"response_type": response.RType.String()}).Inc()
+
+			// only upstream answers can be authenticated, blocked or custom answers would distort the coverage.
+			// The AD bit of the response depends on the client's flags, the upstream's validation state doesn't
+			if response.RType == model.ResponseTypeRESOLVED || response.RType == model.ResponseTypeCACHED {
+				m.dnssecResponses.WithLabelValues(strconv.FormatBool(response.Authenticated)).Inc()
+			}
 		}
 	}
 
@@ -69,11 +77,13 @@ func NewMetricsResolver(cfg config.PrometheusConfig) ChainedResolver {
 	totalQueries := totalQueriesMetric()
 	totalResponse := totalResponseMetric()
 	totalErrors := totalErrorMetric()
+	dnssecResponses := dnssecResponseMetric()
 
 	metrics.RegisterMetric(durationHistogram)
 	metrics.RegisterMetric(totalQueries)
 	metrics.RegisterMetric(totalResponse)
 	metrics.RegisterMetric(totalErrors)
+	metrics.RegisterMetric(dnssecResponses)
 
 	return &MetricsResolver{
 		cfg:               cfg,
@@ -81,6 +91,7 @@ func NewMetricsResolver(cfg config.PrometheusConfig) ChainedResolver {
 		totalQueries:      totalQueries,
 		totalResponse:     totalResponse,
 		totalErrors:       totalErrors,
+		dnssecResponses:   dnssecResponses,
 	}
 }
 
@@ -121,3 +132,12 @@ func totalResponseMetric() *prometheus.CounterVec {
 		}, []string{"reason", "response_code", "response_type"},
 	)
 }
+
+func dnssecResponseMetric() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "blocky_dnssec_response_total",
+			Help: "Number of resolved and cached responses with and without AD (authenticated data) bit",
+		}, []string{"authenticated"},
+	)
+}
@@ -58,6 +58,27 @@ var _ = Describe("MetricResolver", func() {
 					Expect(testutil.ToFloat64(sut.totalErrors)).Should(Equal(float64(1)))
 				})
 			})
+			When("responses with and without AD bit are returned", func() {
+				BeforeEach(func() {
+					m = &resolverMock{}
+					// AD bit of the response is cleared, the client requested neither AD nor DO bit
+					m.On("Resolve", mock.Anything).Return(&Response{
+						Res: new(dns.Msg), RType: ResponseTypeRESOLVED, Authenticated: true,
+					}, nil).Once()
+					m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), RType: ResponseTypeCACHED}, nil).Once()
+					m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), RType: ResponseTypeBLOCKED}, nil).Once()
+					sut.Next(m)
+				})
+				It("should count the upstream answers per validation state", func() {
+					for i := 0; i < 3; i++ {
+						_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "", "client"))
+						Expect(err).Should(Succeed())
+					}
+
+					Expect(testutil.ToFloat64(sut.dnssecResponses.WithLabelValues("true"))).Should(Equal(float64(1)))
+					Expect(testutil.ToFloat64(sut.dnssecResponses.WithLabelValues("false"))).Should(Equal(float64(1)))
+				})
+			})
 		})
 	})
 
@@ -128,7 +128,7 @@ func TestUDPUpstream(fn func(request *dns.Msg) (response *dns.Msg)) config.Upstr
 			util.FatalOnError("error on reading from udp: ", err)
 
 			msg := new(dns.Msg)
-			err = msg.Unpack(buffer[0 : n-1])
+			err = msg.Unpack(buffer[0:n])
 
 			util.FatalOnError("can't deserialize message: ", err)
 
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+// NameNormalizingResolver normalizes the question names (lower case, without surrounding whitespace and with
+// exactly one trailing dot) before the request is passed to the next resolvers, so that caching and matching
+// don't depend on the spelling of the client. The response contains the original question of the client
+type NameNormalizingResolver struct {
+	NextResolver
+}
+
+// NewNameNormalizingResolver returns new resolver instance
+func NewNameNormalizingResolver() ChainedResolver {
+	return &NameNormalizingResolver{}
+}
+
+// Configuration returns current resolver configuration
+func (r *NameNormalizingResolver) Configuration() (result []string) {
+	return []string{"normalize question names (lower case, trailing dot)"}
+}
+
+// Resolve passes the request with normalized question names to the next resolver
+func (r *NameNormalizingResolver) Resolve(request *model.Request) (*model.Response, error) {
+	original := request.Req
+
+	questions, changed := normalizeQuestions(original.Question)
+	if !changed {
+		return r.next.Resolve(request)
+	}
+
+	normalized := original.Copy()
+	normalized.Question = questions
+	request.Req = normalized
+
+	resp, err := r.next.Resolve(request)
+
+	request.Req = original
+
+	if err == nil && resp != nil && resp.Res != nil && len(resp.Res.Question) == len(original.Question) {
+		// return the question as sent by the client (e.g. for clients using random case, "DNS 0x20")
+		resp.Res.Question = append([]dns.Question(nil), original.Question...)
+	}
+
+	return resp, err
+}
+
+// normalizeQuestions returns a copy of the questions with normalized names, changed is false if all names
+// are already normalized
+func normalizeQuestions(questions []dns.Question) (result []dns.Question, changed bool) {
+	result = make([]dns.Question, len(questions))
+
+	for i, q := range questions {
+		result[i] = q
+		result[i].Name = normalizeName(q.Name)
+
+		if result[i].Name != q.Name {
+			changed = true
+		}
+	}
+
+	return result, changed
+}
+
+// normalizeName returns the name in lower case, without surrounding whitespace and with exactly one trailing dot
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for strings.HasSuffix(name, "..") {
+		name = name[:len(name)-1]
+	}
+
+	return dns.Fqdn(name)
+}
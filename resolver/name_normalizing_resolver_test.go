@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("NameNormalizingResolver", func() {
+	var (
+		sut      ChainedResolver
+		m        *resolverMock
+		resolved []string
+	)
+
+	JustBeforeEach(func() {
+		resolved = nil
+		sut = NewNameNormalizingResolver()
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*Request).Req
+			resolved = append(resolved, req.Question[0].Name)
+		}).Return(&Response{Res: new(dns.Msg).SetQuestion("example.com.", dns.TypeA), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	DescribeTable("should pass normalized name to next resolver",
+		func(name, expected string) {
+			req := newRequest("example.com.", dns.TypeA)
+			req.Req.Question[0].Name = name
+
+			resp, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(resolved).Should(Equal([]string{expected}))
+		},
+		Entry("already normalized", "example.com.", "example.com."),
+		Entry("missing trailing dot", "example.com", "example.com."),
+		Entry("multiple trailing dots", "example.com...", "example.com."),
+		Entry("mixed case", "ExAmPlE.CoM.", "example.com."),
+		Entry("surrounding whitespace", " example.com. \t", "example.com."),
+		Entry("everything at once", "  WWW.Example.COM..", "www.example.com."),
+		Entry("root", ".", "."),
+		Entry("empty", "", "."),
+	)
+
+	When("name is normalized", func() {
+		It("should restore the original question in request and response", func() {
+			req := newRequest("example.com.", dns.TypeA)
+			req.Req.Question[0].Name = "WwW.ExAmPlE.CoM"
+			original := req.Req
+
+			resp, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"www.example.com."}))
+			Expect(req.Req).Should(BeIdenticalTo(original))
+			Expect(req.Req.Question[0].Name).Should(Equal("WwW.ExAmPlE.CoM"))
+			Expect(resp.Res.Question[0].Name).Should(Equal("WwW.ExAmPlE.CoM"))
+		})
+	})
+
+	When("name is already normalized", func() {
+		It("should pass the request unchanged", func() {
+			req := newRequest("example.com.", dns.TypeA)
+			original := req.Req
+
+			_, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(m.Calls[0].Arguments.Get(0).(*Request).Req).Should(BeIdenticalTo(original))
+		})
+	})
+
+	Describe("Configuration output", func() {
+		It("should return configuration", func() {
+			Expect(sut.Configuration()).Should(HaveLen(1))
+		})
+	})
+})
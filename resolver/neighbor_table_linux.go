@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package resolver
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// lookupIPv6MAC returns the MAC address of the IPv6 address from the neighbor table of the kernel (netlink), nil if
+// the address is not in the table or the entry is incomplete
+func lookupIPv6MAC(ip net.IP) (net.HardwareAddr, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_INET6)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	return neighborMAC(msgs, ip), nil
+}
+
+// neighborMAC returns the MAC address of the IP address from the RTM_NEWNEIGH messages
+func neighborMAC(msgs []syscall.NetlinkMessage, ip net.IP) net.HardwareAddr {
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWNEIGH || len(msg.Data) < unix.SizeofNdMsg {
+			continue
+		}
+
+		// the messages are in the byte order of the host
+		ndm := (*unix.NdMsg)(unsafe.Pointer(&msg.Data[0])) // nolint:gosec
+		if ndm.Family != syscall.AF_INET6 {
+			continue
+		}
+
+		dst, mac := neighborAttributes(msg.Data[unix.SizeofNdMsg:])
+		if !ip.Equal(dst) {
+			continue
+		}
+
+		if ndm.State&(unix.NUD_INCOMPLETE|unix.NUD_FAILED) != 0 || len(mac) == 0 {
+			return nil
+		}
+
+		return mac
+	}
+
+	return nil
+}
+
+// neighborAttributes returns the destination IP and the link layer address of the route attributes
+func neighborAttributes(b []byte) (dst net.IP, mac net.HardwareAddr) {
+	for len(b) >= unix.SizeofRtAttr {
+		attr := (*unix.RtAttr)(unsafe.Pointer(&b[0])) // nolint:gosec
+		if int(attr.Len) < unix.SizeofRtAttr || int(attr.Len) > len(b) {
+			return dst, mac
+		}
+
+		value := b[unix.SizeofRtAttr:attr.Len]
+
+		switch attr.Type {
+		case unix.NDA_DST:
+			dst = net.IP(append([]byte(nil), value...))
+		case unix.NDA_LLADDR:
+			mac = net.HardwareAddr(append([]byte(nil), value...))
+		}
+
+		// the attributes are aligned to 4 bytes
+		next := (int(attr.Len) + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+		if next >= len(b) {
+			return dst, mac
+		}
+
+		b = b[next:]
+	}
+
+	return dst, mac
+}
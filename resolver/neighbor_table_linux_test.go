@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package resolver
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("IPv6 neighbor table", func() {
+	attribute := func(typ uint16, value []byte) []byte {
+		attr := unix.RtAttr{Len: uint16(unix.SizeofRtAttr + len(value)), Type: typ}
+		b := append((*[unix.SizeofRtAttr]byte)(unsafe.Pointer(&attr))[:], value...)
+
+		// padding to 4 bytes
+		for len(b)%unix.RTA_ALIGNTO != 0 {
+			b = append(b, 0)
+		}
+
+		return b
+	}
+
+	neighbor := func(family uint8, state uint16, ip net.IP, mac net.HardwareAddr) syscall.NetlinkMessage {
+		ndm := unix.NdMsg{Family: family, State: state}
+		data := append([]byte(nil), (*[unix.SizeofNdMsg]byte)(unsafe.Pointer(&ndm))[:]...)
+		data = append(data, attribute(unix.NDA_DST, ip)...)
+
+		if mac != nil {
+			data = append(data, attribute(unix.NDA_LLADDR, mac)...)
+		}
+
+		return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWNEIGH}, Data: data}
+	}
+
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+
+	It("should return the MAC address of the IP address", func() {
+		msgs := []syscall.NetlinkMessage{
+			neighbor(syscall.AF_INET6, unix.NUD_REACHABLE, net.ParseIP("fe80::2"), net.HardwareAddr{1, 2, 3, 4, 5, 6}),
+			neighbor(syscall.AF_INET6, unix.NUD_STALE, net.ParseIP("fe80::1"), mac),
+		}
+
+		Expect(neighborMAC(msgs, net.ParseIP("fe80::1"))).Should(Equal(mac))
+	})
+
+	It("should return nil for incomplete entries and unknown addresses", func() {
+		msgs := []syscall.NetlinkMessage{
+			neighbor(syscall.AF_INET6, unix.NUD_INCOMPLETE, net.ParseIP("fe80::1"), nil),
+			neighbor(syscall.AF_INET6, unix.NUD_FAILED, net.ParseIP("fe80::2"), mac),
+		}
+
+		Expect(neighborMAC(msgs, net.ParseIP("fe80::1"))).Should(BeNil())
+		Expect(neighborMAC(msgs, net.ParseIP("fe80::2"))).Should(BeNil())
+		Expect(neighborMAC(msgs, net.ParseIP("fe80::3"))).Should(BeNil())
+	})
+
+	It("should read the neighbor table of the kernel", func() {
+		mac, err := lookupIPv6MAC(net.ParseIP("::1"))
+		Expect(err).Should(Succeed())
+		Expect(mac).Should(BeNil())
+	})
+})
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package resolver
+
+import (
+	"errors"
+	"net"
+)
+
+// lookupIPv6MAC is only supported on Linux
+func lookupIPv6MAC(net.IP) (net.HardwareAddr, error) {
+	return nil, errors.New("IPv6 neighbor table is only supported on Linux")
+}
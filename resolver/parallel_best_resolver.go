@@ -10,6 +10,7 @@ import (
 	"github.com/0xERR0R/blocky/model"
 	"github.com/0xERR0R/blocky/util"
 
+	"github.com/miekg/dns"
 	"github.com/mroth/weightedrand"
 	"github.com/sirupsen/logrus"
 )
@@ -23,11 +24,17 @@ const (
 // ParallelBestResolver delegates the DNS message to 2 upstream resolvers and returns the fastest answer
 type ParallelBestResolver struct {
 	resolversPerClient map[string][]*upstreamResolverStatus
+	// wait for the second resolver, if the first answer for A/AAAA is empty
+	retryOnEmpty bool
+	// a panic of an upstream resolver crashes the process, e.g. for debugging
+	disablePanicRecovery bool
 }
 
 type upstreamResolverStatus struct {
 	resolver      Resolver
 	lastErrorTime time.Time
+	// if not empty, the resolver is used only for these query types
+	queryTypes config.QueryTypes
 }
 
 type requestResponse struct {
@@ -35,8 +42,8 @@ type requestResponse struct {
 	err      error
 }
 
-// NewParallelBestResolver creates new resolver instance
-func NewParallelBestResolver(upstreamResolvers map[string][]config.Upstream) Resolver {
+// NewParallelBestResolver creates new resolver instance with the upstream settings of the chain
+func NewParallelBestResolver(upstreamResolvers map[string][]config.Upstream, settings *UpstreamSettings) Resolver {
 	s := make(map[string][]*upstreamResolverStatus)
 	logger := logger(parallelResolverLogger)
 
@@ -44,8 +51,9 @@ func NewParallelBestResolver(upstreamResolvers map[string][]config.Upstream) Res
 		resolvers := make([]*upstreamResolverStatus, len(res))
 		for i, u := range res {
 			resolvers[i] = &upstreamResolverStatus{
-				resolver:      NewUpstreamResolver(u),
+				resolver:      NewUpstreamResolver(u, settings),
 				lastErrorTime: time.Unix(0, 0),
+				queryTypes:    settings.queryTypes[u],
 			}
 		}
 
@@ -65,16 +73,25 @@ func NewParallelBestResolver(upstreamResolvers map[string][]config.Upstream) Res
 			"Please configure at least one under '%s' configuration name", upstreamDefaultCfgName)
 	}
 
-	return &ParallelBestResolver{resolversPerClient: s}
+	return &ParallelBestResolver{
+		resolversPerClient:   s,
+		retryOnEmpty:         settings.retryOnEmpty,
+		disablePanicRecovery: settings.disablePanicRecovery,
+	}
 }
 
 // Configuration returns current resolver configuration
 func (r *ParallelBestResolver) Configuration() (result []string) {
+	result = append(result, fmt.Sprintf("retryOnEmpty = %t", r.retryOnEmpty))
 	result = append(result, "upstream resolvers:")
 	for name, res := range r.resolversPerClient {
 		result = append(result, fmt.Sprintf("- %s", name))
 		for _, r := range res {
-			result = append(result, fmt.Sprintf("  - %s", r.resolver))
+			if len(r.queryTypes) > 0 {
+				result = append(result, fmt.Sprintf("  - %s (query types: %s)", r.resolver, r.queryTypes))
+			} else {
+				result = append(result, fmt.Sprintf("  - %s", r.resolver))
+			}
 		}
 	}
 
@@ -128,12 +145,40 @@ func (r *ParallelBestResolver) resolversForClient(request *model.Request) (resul
 	return result
 }
 
+// resolversForQueryType returns the resolvers, which are restricted to the query type. If there are none,
+// the resolvers without restriction are returned. All resolvers are returned if no resolver matches at all
+func resolversForQueryType(resolvers []*upstreamResolverStatus, qType uint16) []*upstreamResolverStatus {
+	var matching, unrestricted []*upstreamResolverStatus
+
+	for _, res := range resolvers {
+		if len(res.queryTypes) == 0 {
+			unrestricted = append(unrestricted, res)
+		} else if res.queryTypes.Contains(qType) {
+			matching = append(matching, res)
+		}
+	}
+
+	if len(matching) > 0 {
+		return matching
+	}
+
+	if len(unrestricted) > 0 {
+		return unrestricted
+	}
+
+	return resolvers
+}
+
 // Resolve sends the query request to multiple upstream resolvers and returns the fastest result
 func (r *ParallelBestResolver) Resolve(request *model.Request) (*model.Response, error) {
 	logger := request.Log.WithField("prefix", parallelResolverLogger)
 
 	resolvers := r.resolversForClient(request)
 
+	if len(request.Req.Question) > 0 {
+		resolvers = resolversForQueryType(resolvers, request.Req.Question[0].Qtype)
+	}
+
 	if len(resolvers) == 1 {
 		logger.WithField("resolver", resolvers[0].resolver).Debug("delegating to resolver")
 		return resolvers[0].resolver.Resolve(request)
@@ -144,37 +189,72 @@ func (r *ParallelBestResolver) Resolve(request *model.Request) (*model.Response,
 
 	ch := make(chan requestResponse, 2)
 
-	var collectedErrors []error
+	var (
+		collectedErrors []error
+		emptyResponse   *model.Response
+	)
 
 	logger.WithField("resolver", r1.resolver).Debug("delegating to resolver")
 
-	go resolve(request, r1, ch)
+	go r.resolve(request, r1, ch)
 
 	logger.WithField("resolver", r2.resolver).Debug("delegating to resolver")
 
-	go resolve(request, r2, ch)
+	go r.resolve(request, r2, ch)
 
-	//nolint: gosimple
-	for len(collectedErrors) < 2 {
-		select {
-		case result := <-ch:
-			if result.err != nil {
-				logger.Debug("resolution failed from resolver, cause: ", result.err)
-				collectedErrors = append(collectedErrors, result.err)
-			} else {
-				logger.WithFields(logrus.Fields{
-					"resolver": r1.resolver,
-					"answer":   util.AnswerToString(result.response.Res.Answer),
-				}).Debug("using response from resolver")
-				return result.response, nil
-			}
+	for i := 0; i < 2; i++ {
+		result := <-ch
+
+		if result.err != nil {
+			logger.Debug("resolution failed from resolver, cause: ", result.err)
+			collectedErrors = append(collectedErrors, result.err)
+
+			continue
 		}
+
+		if r.retryOnEmpty && emptyResponse == nil && isEmptyAnswer(request.Req, result.response.Res) {
+			logger.Debug("empty answer from resolver, waiting for the other resolver")
+			emptyResponse = result.response
+
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{
+			"resolver": r1.resolver,
+			"answer":   util.AnswerToString(result.response.Res.Answer),
+		}).Debug("using response from resolver")
+
+		return result.response, nil
+	}
+
+	if emptyResponse != nil {
+		return emptyResponse, nil
 	}
 
 	return nil, fmt.Errorf("resolution was not successful, used resolvers: '%s' and '%s' errors: %v",
 		r1.resolver, r2.resolver, collectedErrors)
 }
 
+// isEmptyAnswer returns true for a successful response without answers to an A/AAAA query. Responses with SOA in the
+// authority section are a legitimate NODATA (RFC 2308), e.g. for a name without addresses of this type
+func isEmptyAnswer(request, response *dns.Msg) bool {
+	if len(request.Question) == 0 || response.Rcode != dns.RcodeSuccess || len(response.Answer) > 0 {
+		return false
+	}
+
+	if qType := request.Question[0].Qtype; qType != dns.TypeA && qType != dns.TypeAAAA {
+		return false
+	}
+
+	for _, rr := range response.Ns {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return false
+		}
+	}
+
+	return true
+}
+
 // pick 2 different random resolvers from the resolver pool
 func pickRandom(resolvers []*upstreamResolverStatus) (resolver1, resolver2 *upstreamResolverStatus) {
 	resolver1 = weightedRandom(resolvers, nil)
@@ -207,15 +287,28 @@ func weightedRandom(in []*upstreamResolverStatus, exclude Resolver) *upstreamRes
 	return c.Pick().(*upstreamResolverStatus)
 }
 
-func resolve(req *model.Request, resolver *upstreamResolverStatus, ch chan<- requestResponse) {
-	resp, err := resolver.resolver.Resolve(req)
+// resolve sends the result of the resolver to the channel. A panic of the resolver is sent as error, the goroutine
+// would crash the process otherwise
+func (r *ParallelBestResolver) resolve(req *model.Request, resolver *upstreamResolverStatus, ch chan<- requestResponse) {
+	var (
+		resp *model.Response
+		err  error
+	)
+
+	defer func() {
+		// update the last error time
+		if err != nil {
+			resolver.lastErrorTime = time.Now()
+		}
+		ch <- requestResponse{
+			response: resp,
+			err:      err,
+		}
+	}()
 
-	// update the last error time
-	if err != nil {
-		resolver.lastErrorTime = time.Now()
-	}
-	ch <- requestResponse{
-		response: resp,
-		err:      err,
+	if !r.disablePanicRecovery {
+		defer (&timedResolver{Resolver: resolver.resolver}).recoverPanic(req, &resp, &err)
 	}
+
+	resp, err = resolver.resolver.Resolve(req)
 }
@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
 )
 
 var _ = Describe("ParallelBestResolver", func() {
@@ -19,8 +21,13 @@ var _ = Describe("ParallelBestResolver", func() {
 		sut  Resolver
 		err  error
 		resp *Response
+		cfg  config.Config
 	)
 
+	BeforeEach(func() {
+		cfg = config.Config{}
+	})
+
 	Describe("Default upstream resolvers are not defined", func() {
 		It("should fail on startup", func() {
 			defer func() { Log().ExitFunc = nil }()
@@ -28,7 +35,7 @@ var _ = Describe("ParallelBestResolver", func() {
 
 			Log().ExitFunc = func(int) { fatal = true }
 
-			sut = NewParallelBestResolver(map[string][]config.Upstream{})
+			sut = NewParallelBestResolver(map[string][]config.Upstream{}, NewUpstreamSettings(&cfg))
 			Expect(fatal).Should(BeTrue())
 		})
 	})
@@ -51,7 +58,10 @@ var _ = Describe("ParallelBestResolver", func() {
 						Expect(err).Should(Succeed())
 						return response
 					})
-					sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {fast, slow}})
+					sut = NewParallelBestResolver(
+						map[string][]config.Upstream{upstreamDefaultCfgName: {fast, slow}},
+						NewUpstreamSettings(&cfg),
+					)
 				})
 				It("Should use result from fastest one", func() {
 					request := newRequest("example.com.", dns.TypeA)
@@ -75,7 +85,10 @@ var _ = Describe("ParallelBestResolver", func() {
 						Expect(err).Should(Succeed())
 						return response
 					})
-					sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {withError, slow}})
+					sut = NewParallelBestResolver(
+						map[string][]config.Upstream{upstreamDefaultCfgName: {withError, slow}},
+						NewUpstreamSettings(&cfg),
+					)
 				})
 				It("Should use result from successful resolver", func() {
 					request := newRequest("example.com.", dns.TypeA)
@@ -93,7 +106,10 @@ var _ = Describe("ParallelBestResolver", func() {
 					withError1 := config.Upstream{Host: "wrong"}
 					withError2 := config.Upstream{Host: "wrong"}
 
-					sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {withError1, withError2}})
+					sut = NewParallelBestResolver(
+						map[string][]config.Upstream{upstreamDefaultCfgName: {withError1, withError2}},
+						NewUpstreamSettings(&cfg),
+					)
 				})
 				It("Should return error", func() {
 					request := newRequest("example.com.", dns.TypeA)
@@ -145,7 +161,7 @@ var _ = Describe("ParallelBestResolver", func() {
 						"client[0-9]":                    {clientSpecificResolverWildcard},
 						"192.168.178.33":                 {clientSpecificResolverIP},
 						"10.43.8.67/28":                  {clientSpecificResolverCIDR},
-					})
+					}, NewUpstreamSettings(&cfg))
 				})
 				It("Should use default if client name or IP don't match", func() {
 					request := newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55", "test")
@@ -205,7 +221,10 @@ var _ = Describe("ParallelBestResolver", func() {
 					Expect(err).Should(Succeed())
 					return response
 				})
-				sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {fast}})
+				sut = NewParallelBestResolver(
+					map[string][]config.Upstream{upstreamDefaultCfgName: {fast}},
+					NewUpstreamSettings(&cfg),
+				)
 			})
 			It("Should use result from defined resolver", func() {
 				request := newRequest("example.com.", dns.TypeA)
@@ -238,7 +257,7 @@ var _ = Describe("ParallelBestResolver", func() {
 
 				sut := NewParallelBestResolver(map[string][]config.Upstream{
 					upstreamDefaultCfgName: {withError1, fast1, fast2, withError2},
-				}).(*ParallelBestResolver)
+				}, NewUpstreamSettings(&cfg)).(*ParallelBestResolver)
 
 				By("all resolvers have same weight for random -> equal distribution", func() {
 					resolverCount := make(map[Resolver]int)
@@ -291,12 +310,213 @@ var _ = Describe("ParallelBestResolver", func() {
 		})
 	})
 
+	Describe("Query type restrictions", func() {
+		var validating, fast config.Upstream
+
+		BeforeEach(func() {
+			validating = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+				response, err := util.NewMsgWithAnswer("example.com.", 123, dns.TypeA, "10.0.0.1")
+
+				Expect(err).Should(Succeed())
+				return response
+			})
+			fast = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+				response, err := util.NewMsgWithAnswer("example.com.", 123, dns.TypeA, "10.0.0.2")
+
+				Expect(err).Should(Succeed())
+				return response
+			})
+
+			cfg.UpstreamQueryTypes = map[config.Upstream]config.QueryTypes{
+				validating: {dns.TypeTXT, dns.TypeDS},
+			}
+
+			sut = NewParallelBestResolver(
+				map[string][]config.Upstream{upstreamDefaultCfgName: {validating, fast}},
+				NewUpstreamSettings(&cfg),
+			)
+		})
+
+		When("query type is restricted to an upstream", func() {
+			It("should use only this upstream", func() {
+				for i := 0; i < 5; i++ {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeTXT))
+
+					Expect(err).Should(Succeed())
+					Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "10.0.0.1"))
+				}
+			})
+		})
+
+		When("query type is not restricted", func() {
+			It("should use only the upstreams without restriction", func() {
+				for i := 0; i < 5; i++ {
+					resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+
+					Expect(err).Should(Succeed())
+					Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "10.0.0.2"))
+				}
+			})
+		})
+
+		It("should print the query types in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElement(fmt.Sprintf("  - %s (query types: TXT, DS)",
+				NewUpstreamResolver(validating, NewUpstreamSettings(&cfg)))))
+		})
+	})
+
+	Describe("Retry on empty answers", func() {
+		var (
+			empty, slow config.Upstream
+			soa         bool
+		)
+
+		BeforeEach(func() {
+			soa = false
+
+			empty = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+				response := new(dns.Msg)
+				response.SetReply(request)
+
+				if soa {
+					rr, err := dns.NewRR("example.com. 300 IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300")
+					Expect(err).Should(Succeed())
+
+					response.Ns = append(response.Ns, rr)
+				}
+
+				return response
+			})
+			slow = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+				time.Sleep(50 * time.Millisecond)
+
+				response, err := util.NewMsgWithAnswer("example.com.", 123, dns.TypeA, "10.0.0.2")
+				Expect(err).Should(Succeed())
+
+				return response
+			})
+
+			cfg.RetryOnEmpty = true
+		})
+
+		JustBeforeEach(func() {
+			sut = NewParallelBestResolver(
+				map[string][]config.Upstream{upstreamDefaultCfgName: {empty, slow}},
+				NewUpstreamSettings(&cfg),
+			)
+		})
+
+		When("the first answer for A is empty", func() {
+			It("should return the answer of the other upstream", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "10.0.0.2"))
+			})
+		})
+
+		When("the empty answer contains SOA", func() {
+			BeforeEach(func() {
+				soa = true
+			})
+			It("should return the NODATA answer", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeEmpty())
+				Expect(resp.Res.Ns).Should(HaveLen(1))
+			})
+		})
+
+		When("query type is not A or AAAA", func() {
+			It("should return the empty answer", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeMX))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+
+		When("retry on empty is disabled", func() {
+			BeforeEach(func() {
+				cfg.RetryOnEmpty = false
+			})
+			It("should return the first answer", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeAAAA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+
+		When("all answers are empty", func() {
+			JustBeforeEach(func() {
+				sut = NewParallelBestResolver(
+					map[string][]config.Upstream{upstreamDefaultCfgName: {empty, empty}},
+					NewUpstreamSettings(&cfg),
+				)
+			})
+			It("should return the empty answer", func() {
+				resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Panic of an upstream resolver", func() {
+		JustBeforeEach(func() {
+			sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {
+				{Host: "host1"},
+				{Host: "host2"},
+			}}, NewUpstreamSettings(&cfg))
+
+			for _, res := range sut.(*ParallelBestResolver).resolversPerClient[upstreamDefaultCfgName] {
+				m := &resolverMock{}
+				m.On("Resolve", mock.Anything).Run(func(mock.Arguments) {
+					panic("test panic")
+				}).Return(nil, nil)
+
+				res.resolver = m
+			}
+		})
+
+		It("should recover the panic and return an error", func() {
+			resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+
+			Expect(err).Should(MatchError(ContainSubstring("panic in resolverMock: test panic")))
+			Expect(resp).Should(BeNil())
+		})
+
+		When("the panic recovery is disabled", func() {
+			BeforeEach(func() {
+				cfg.DisablePanicRecovery = true
+			})
+
+			It("should not recover the panic in the goroutines", func() {
+				Expect(sut.(*ParallelBestResolver).disablePanicRecovery).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("Falling back for unmatched query types", func() {
+		It("should use all upstreams if all are restricted to other types", func() {
+			restricted := []*upstreamResolverStatus{
+				{queryTypes: config.QueryTypes{dns.TypeTXT}},
+				{queryTypes: config.QueryTypes{dns.TypeDS}},
+			}
+
+			Expect(resolversForQueryType(restricted, dns.TypeA)).Should(Equal(restricted))
+		})
+	})
+
 	Describe("Configuration output", func() {
 		BeforeEach(func() {
 			sut = NewParallelBestResolver(map[string][]config.Upstream{upstreamDefaultCfgName: {
 				{Host: "host1"},
 				{Host: "host2"},
-			}})
+			}}, NewUpstreamSettings(&cfg))
 		})
 		It("should return configuration", func() {
 			c := sut.Configuration()
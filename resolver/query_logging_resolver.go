@@ -2,11 +2,14 @@ package resolver
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"time"
 
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/model"
 	"github.com/0xERR0R/blocky/querylog"
+	"github.com/0xERR0R/blocky/util"
 	"github.com/avast/retry-go/v4"
 )
 
@@ -19,15 +22,67 @@ const (
 // QueryLoggingResolver writes query information (question, answer, duration, ...)
 type QueryLoggingResolver struct {
 	NextResolver
-	target           string
+	*queryLogWriter
 	logRetentionDays uint64
-	logChan          chan *querylog.LogEntry
-	writer           querylog.Writer
-	logType          config.QueryLogType
+	clientWriters    []clientQueryLogWriter
+}
+
+// queryLogWriter writes the entries of one query log target asynchronously
+type queryLogWriter struct {
+	target  string
+	logChan chan *querylog.LogEntry
+	writer  querylog.Writer
+	logType config.QueryLogType
+	// adds the source of the answer to the entries
+	sourceFields bool
+}
+
+// clientQueryLogWriter is the query log writer of the client (name, IP or CIDR)
+type clientQueryLogWriter struct {
+	client string
+	*queryLogWriter
 }
 
 // NewQueryLoggingResolver returns a new resolver instance
 func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
+	resolver := QueryLoggingResolver{
+		queryLogWriter:   newQueryLogWriter(cfg),
+		logRetentionDays: cfg.LogRetentionDays,
+	}
+
+	for client, clientCfg := range cfg.ClientMapping {
+		resolver.clientWriters = append(resolver.clientWriters, clientQueryLogWriter{
+			client:         client,
+			queryLogWriter: newQueryLogWriter(clientQueryLogConfig(cfg, clientCfg)),
+		})
+	}
+
+	sort.Slice(resolver.clientWriters, func(i, j int) bool {
+		return resolver.clientWriters[i].client < resolver.clientWriters[j].client
+	})
+
+	if cfg.LogRetentionDays > 0 {
+		go resolver.periodicCleanUp()
+	}
+
+	return &resolver
+}
+
+// clientQueryLogConfig returns the config with type, target and CSV fields of the client, the fields are
+// inherited if not defined
+func clientQueryLogConfig(cfg config.QueryLogConfig, clientCfg config.QueryLogClientConfig) config.QueryLogConfig {
+	cfg.Type = clientCfg.Type
+	cfg.Target = clientCfg.Target
+	cfg.ClientMapping = nil
+
+	if len(clientCfg.CSVFields) > 0 {
+		cfg.CSVFields = clientCfg.CSVFields
+	}
+
+	return cfg
+}
+
+func newQueryLogWriter(cfg config.QueryLogConfig) *queryLogWriter {
 	var writer querylog.Writer
 
 	logType := cfg.Type
@@ -35,14 +90,16 @@ func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
 		func() error {
 			var err error
 			switch logType {
-			case config.QueryLogTypeCsv:
-				writer, err = querylog.NewCSVWriter(cfg.Target, false, cfg.LogRetentionDays)
-			case config.QueryLogTypeCsvClient:
-				writer, err = querylog.NewCSVWriter(cfg.Target, true, cfg.LogRetentionDays)
+			case config.QueryLogTypeCsv, config.QueryLogTypeCsvClient:
+				writer, err = querylog.NewCSVWriter(cfg)
 			case config.QueryLogTypeMysql:
 				writer, err = querylog.NewDatabaseWriter("mysql", cfg.Target, cfg.LogRetentionDays, 30*time.Second)
 			case config.QueryLogTypePostgresql:
 				writer, err = querylog.NewDatabaseWriter("postgresql", cfg.Target, cfg.LogRetentionDays, 30*time.Second)
+			case config.QueryLogTypeDnstap:
+				writer, err = querylog.NewDnstapWriter(cfg.Target)
+			case config.QueryLogTypeKafka:
+				writer, err = querylog.NewKafkaWriter(cfg.Target)
 			case config.QueryLogTypeConsole:
 				writer = querylog.NewLoggerWriter()
 			case config.QueryLogTypeNone:
@@ -64,23 +121,32 @@ func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
 		logType = config.QueryLogTypeConsole
 	}
 
-	logChan := make(chan *querylog.LogEntry, logChanCap)
+	w := &queryLogWriter{
+		target:  cfg.Target,
+		logChan: make(chan *querylog.LogEntry, logChanCap),
+		writer:  writer,
+		logType: logType,
 
-	resolver := QueryLoggingResolver{
-		target:           cfg.Target,
-		logRetentionDays: cfg.LogRetentionDays,
-		logChan:          logChan,
-		writer:           writer,
-		logType:          logType,
+		sourceFields: cfg.SourceFields || hasSourceField(cfg.CSVFields),
 	}
 
-	go resolver.writeLog()
+	if logType != config.QueryLogTypeNone {
+		// nothing to write for none, Resolve doesn't enqueue any entries
+		go w.writeLog()
+	}
 
-	if cfg.LogRetentionDays > 0 {
-		go resolver.periodicCleanUp()
+	return w
+}
+
+// hasSourceField returns true if one of the CSV fields needs the source of the entries
+func hasSourceField(fields []config.QueryLogField) bool {
+	for _, field := range fields {
+		if querylog.IsSourceField(field) {
+			return true
+		}
 	}
 
-	return &resolver
+	return false
 }
 
 // triggers periodically cleanup of old log files
@@ -96,10 +162,49 @@ func (r *QueryLoggingResolver) periodicCleanUp() {
 
 func (r *QueryLoggingResolver) doCleanUp() {
 	r.writer.CleanUp()
+
+	for _, cw := range r.clientWriters {
+		cw.writer.CleanUp()
+	}
+}
+
+// Close closes the writers with connections (e.g. dnstap), the pending entries are flushed
+func (r *QueryLoggingResolver) Close() error {
+	writers := []querylog.Writer{r.writer}
+
+	for _, cw := range r.clientWriters {
+		writers = append(writers, cw.writer)
+	}
+
+	for _, w := range writers {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writerFor returns the writer of the first matching client or the default writer
+func (r *QueryLoggingResolver) writerFor(request *model.Request) *queryLogWriter {
+	for _, cw := range r.clientWriters {
+		if clientMatches(cw.client, request) {
+			return cw.queryLogWriter
+		}
+	}
+
+	return r.queryLogWriter
 }
 
 // Resolve logs the query, duration and the result
 func (r *QueryLoggingResolver) Resolve(request *model.Request) (*model.Response, error) {
+	w := r.writerFor(request)
+	if w.logType == config.QueryLogTypeNone {
+		return r.next.Resolve(request)
+	}
+
 	logger := withPrefix(request.Log, queryLoggingResolverPrefix)
 
 	start := time.Now()
@@ -109,12 +214,19 @@ func (r *QueryLoggingResolver) Resolve(request *model.Request) (*model.Response,
 	duration := time.Since(start).Milliseconds()
 
 	if err == nil {
-		select {
-		case r.logChan <- &querylog.LogEntry{
+		entry := &querylog.LogEntry{
 			Request:    request,
 			Response:   resp,
 			Start:      start,
-			DurationMs: duration}:
+			DurationMs: duration,
+		}
+
+		if w.sourceFields {
+			entry.Source = querylog.NewLogEntrySource(resp)
+		}
+
+		select {
+		case w.logChan <- entry:
 		default:
 			logger.Error("query log writer is too slow, log entry will be dropped")
 		}
@@ -124,7 +236,7 @@ func (r *QueryLoggingResolver) Resolve(request *model.Request) (*model.Response,
 }
 
 // write entry: if log directory is configured, write to log file
-func (r *QueryLoggingResolver) writeLog() {
+func (r *queryLogWriter) writeLog() {
 	for logEntry := range r.logChan {
 		start := time.Now()
 
@@ -143,8 +255,18 @@ func (r *QueryLoggingResolver) writeLog() {
 // Configuration returns the current resolver configuration
 func (r *QueryLoggingResolver) Configuration() (result []string) {
 	result = append(result, fmt.Sprintf("type: \"%s\"", r.logType))
-	result = append(result, fmt.Sprintf("target: \"%s\"", r.target))
+	result = append(result, fmt.Sprintf("target: \"%s\"", util.RedactCredentials(r.target)))
 	result = append(result, fmt.Sprintf("logRetentionDays: %d", r.logRetentionDays))
+	result = append(result, fmt.Sprintf("sourceFields: %t", r.sourceFields))
+
+	if len(r.clientWriters) > 0 {
+		result = append(result, "clientMapping:")
+
+		for _, cw := range r.clientWriters {
+			result = append(result, fmt.Sprintf("  %s = type: \"%s\", target: \"%s\"", cw.client, cw.logType,
+				util.RedactCredentials(cw.target)))
+		}
+	}
 
 	return
 }
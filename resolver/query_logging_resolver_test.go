@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"testing"
 	"time"
 
 	"github.com/0xERR0R/blocky/querylog"
@@ -181,11 +182,125 @@ var _ = Describe("QueryLoggingResolver", func() {
 		})
 	})
 
+	Describe("Query logging per client", func() {
+		BeforeEach(func() {
+			sutConfig = config.QueryLogConfig{
+				Type:             config.QueryLogTypeNone,
+				CreationAttempts: 1,
+				CreationCooldown: config.Duration(time.Millisecond),
+				ClientMapping: map[string]config.QueryLogClientConfig{
+					"kid*": {
+						Type:      config.QueryLogTypeCsv,
+						Target:    tmpDir,
+						CSVFields: []config.QueryLogField{config.QueryLogFieldClientName, config.QueryLogFieldQuestion},
+					},
+				},
+			}
+			mockAnswer, _ = util.NewMsgWithAnswer("example.com.", 300, dns.TypeA, "123.122.121.120")
+		})
+
+		It("should log the queries of matching clients with the client config", func() {
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.25", "kid-tablet"))
+			Expect(err).Should(Succeed())
+
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.26", "parent"))
+			Expect(err).Should(Succeed())
+
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+
+			Eventually(func(g Gomega) {
+				csvLines, err := readCsv(filepath.Join(tmpDir, fmt.Sprintf("%s_ALL.log", time.Now().Format("2006-01-02"))))
+
+				g.Expect(err).Should(Succeed())
+				g.Expect(csvLines).Should(Equal([][]string{{"kid-tablet", "A (example.com.)"}}))
+			}, "1s").Should(Succeed())
+
+			Expect(sut.logChan).Should(BeEmpty())
+		})
+
+		It("should return the client mapping in the configuration", func() {
+			Expect(sut.Configuration()).Should(ContainElements(
+				"clientMapping:",
+				fmt.Sprintf("  kid* = type: \"csv\", target: \"%s\"", tmpDir),
+			))
+		})
+	})
+
+	Describe("Source fields", func() {
+		BeforeEach(func() {
+			sutConfig = config.QueryLogConfig{
+				Type:             config.QueryLogTypeCsv,
+				Target:           tmpDir,
+				CreationAttempts: 1,
+				CreationCooldown: config.Duration(time.Millisecond),
+				CSVFields: []config.QueryLogField{
+					config.QueryLogFieldQuestion,
+					config.QueryLogFieldUpstreamResponseCode,
+					config.QueryLogFieldCached,
+				},
+			}
+		})
+
+		It("should be enabled by the CSV fields and written to the log", func() {
+			Expect(sut.sourceFields).Should(BeTrue())
+
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.25", "client1"))
+			Expect(err).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				csvLines, err := readCsv(filepath.Join(tmpDir, fmt.Sprintf("%s_ALL.log", time.Now().Format("2006-01-02"))))
+
+				g.Expect(err).Should(Succeed())
+				g.Expect(csvLines).Should(Equal([][]string{{"A (example.com.)", "", "false"}}))
+			}, "1s").Should(Succeed())
+		})
+
+		When("the CSV fields don't contain source fields", func() {
+			BeforeEach(func() {
+				sutConfig.CSVFields = []config.QueryLogField{config.QueryLogFieldQuestion}
+			})
+
+			It("should be disabled", func() {
+				Expect(sut.sourceFields).Should(BeFalse())
+				Expect(sut.Configuration()).Should(ContainElement("sourceFields: false"))
+			})
+		})
+	})
+
+	Describe("Disabled query logging", func() {
+		When("type is none", func() {
+			BeforeEach(func() {
+				sutConfig = config.QueryLogConfig{
+					Type:             config.QueryLogTypeNone,
+					CreationAttempts: 1,
+					CreationCooldown: config.Duration(time.Millisecond),
+				}
+			})
+			It("should not enqueue log entries", func() {
+				for i := 0; i < 10; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.25", "client1"))
+					Expect(err).Should(Succeed())
+				}
+
+				Expect(sut.logChan).Should(BeEmpty())
+				m.AssertNumberOfCalls(GinkgoT(), "Resolve", 10)
+			})
+			It("should not allocate", func() {
+				sut.Next(&staticResolver{response: &Response{Res: new(dns.Msg)}})
+				req := newRequest("example.com.", dns.TypeA)
+
+				Expect(testing.AllocsPerRun(100, func() {
+					_, _ = sut.Resolve(req)
+				})).Should(BeZero())
+			})
+		})
+	})
+
 	Describe("Slow writer", func() {
 		When("writer is too slow", func() {
 			BeforeEach(func() {
 				sutConfig = config.QueryLogConfig{
-					Type:             config.QueryLogTypeNone,
+					Type:             config.QueryLogTypeConsole,
 					CreationAttempts: 1,
 					CreationCooldown: config.Duration(time.Millisecond),
 				}
@@ -223,6 +338,28 @@ var _ = Describe("QueryLoggingResolver", func() {
 				Expect(len(c) > 1).Should(BeTrue())
 			})
 		})
+		When("the target contains credentials", func() {
+			It("should redact the password", func() {
+				r := &QueryLoggingResolver{
+					queryLogWriter: &queryLogWriter{
+						logType: config.QueryLogTypeMysql,
+						target:  "user:secret@tcp(db:3306)/blocky",
+					},
+					clientWriters: []clientQueryLogWriter{{
+						client: "kid*",
+						queryLogWriter: &queryLogWriter{
+							logType: config.QueryLogTypePostgresql,
+							target:  "postgres://user:secret@db/blocky",
+						},
+					}},
+				}
+
+				Expect(r.Configuration()).Should(ContainElements(
+					`target: "user:*****@tcp(db:3306)/blocky"`,
+					`  kid* = type: "postgresql", target: "postgres://user:*****@db/blocky"`,
+				))
+			})
+		})
 	})
 
 	Describe("Clean up of query log directory", func() {
@@ -330,3 +467,31 @@ func readCsv(file string) ([][]string, error) {
 
 	return result, nil
 }
+
+// staticResolver returns always the same response without allocations
+type staticResolver struct {
+	NextResolver
+	response *Response
+}
+
+func (r *staticResolver) Configuration() []string {
+	return nil
+}
+
+func (r *staticResolver) Resolve(*Request) (*Response, error) {
+	return r.response, nil
+}
+
+func BenchmarkQueryLoggingResolverNone(b *testing.B) {
+	sut := NewQueryLoggingResolver(config.QueryLogConfig{Type: config.QueryLogTypeNone})
+	sut.Next(&staticResolver{response: &Response{Res: new(dns.Msg)}})
+
+	req := newRequest("example.com.", dns.TypeA)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = sut.Resolve(req)
+	}
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+const queryNameLimitsResolverLogger = "query_name_limits_resolver"
+
+// QueryNameLimitsResolver rejects queries with abnormally long names or too many labels (abuse, fuzzing)
+// before they reach the other resolvers
+type QueryNameLimitsResolver struct {
+	NextResolver
+	cfg   config.QueryNameLimitsConfig
+	rcode int
+}
+
+// NewQueryNameLimitsResolver returns new resolver instance
+func NewQueryNameLimitsResolver(cfg config.QueryNameLimitsConfig) ChainedResolver {
+	rcode := dns.RcodeFormatError
+	if cfg.Response == config.QueryNameLimitResponseRefused {
+		rcode = dns.RcodeRefused
+	}
+
+	return &QueryNameLimitsResolver{cfg: cfg, rcode: rcode}
+}
+
+// Configuration returns current resolver configuration
+func (r *QueryNameLimitsResolver) Configuration() (result []string) {
+	return []string{
+		fmt.Sprintf("maxLength = %d", r.cfg.MaxLength),
+		fmt.Sprintf("maxLabels = %d", r.cfg.MaxLabels),
+		fmt.Sprintf("response = %s", r.cfg.Response),
+	}
+}
+
+// Resolve rejects the query if a question name exceeds the limits, otherwise delegates to the next resolver
+func (r *QueryNameLimitsResolver) Resolve(request *model.Request) (*model.Response, error) {
+	for _, question := range request.Req.Question {
+		limit, reason := r.exceededLimit(question.Name)
+		if limit == "" {
+			continue
+		}
+
+		withPrefix(request.Log, queryNameLimitsResolverLogger).
+			WithField("limit", limit).
+			Debugf("query rejected, question name exceeds the %s limit", limit)
+
+		evt.Bus().Publish(evt.QueryNameLimitExceeded, limit)
+
+		response := new(dns.Msg)
+		response.SetRcode(request.Req, r.rcode)
+
+		return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: reason}, nil
+	}
+
+	return r.next.Resolve(request)
+}
+
+// exceededLimit returns the name of the exceeded limit (length, labels) and the response reason
+func (r *QueryNameLimitsResolver) exceededLimit(name string) (limit, reason string) {
+	if r.cfg.MaxLength > 0 && uint(len(strings.TrimSuffix(name, "."))) > r.cfg.MaxLength {
+		return "length", "NAME TOO LONG"
+	}
+
+	if r.cfg.MaxLabels > 0 && uint(dns.CountLabel(name)) > r.cfg.MaxLabels {
+		return "labels", "TOO MANY LABELS"
+	}
+
+	return "", ""
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/creasty/defaults"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("QueryNameLimitsResolver", func() {
+	var (
+		sut ChainedResolver
+		cfg config.QueryNameLimitsConfig
+		m   *resolverMock
+	)
+
+	BeforeEach(func() {
+		Expect(defaults.Set(&cfg)).Should(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		sut = NewQueryNameLimitsResolver(cfg)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	// name with the passed amount of labels "a.a.a...."
+	nameWithLabels := func(count int) string {
+		return strings.Repeat("a.", count)
+	}
+
+	When("default limits are used", func() {
+		It("should delegate names within the DNS protocol maximums", func() {
+			for _, name := range []string{"example.com.", nameWithLabels(127), strings.Repeat("a", 63) + "."} {
+				resp, err := sut.Resolve(newRequest(name, dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Reason).Should(Equal("RESOLVED"))
+			}
+		})
+
+		It("should return FORMERR for too long names", func() {
+			var limit string
+
+			_ = Bus().SubscribeOnce(QueryNameLimitExceeded, func(l string) {
+				limit = l
+			})
+
+			resp, err := sut.Resolve(newRequest(nameWithLabels(128), dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeFormatError))
+			Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			Expect(resp.Reason).Should(Equal("NAME TOO LONG"))
+			Expect(limit).Should(Equal("length"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should return FORMERR for too many labels", func() {
+			cfg.MaxLength = 0
+			sut = NewQueryNameLimitsResolver(cfg)
+			sut.Next(m)
+
+			var limit string
+
+			_ = Bus().SubscribeOnce(QueryNameLimitExceeded, func(l string) {
+				limit = l
+			})
+
+			resp, err := sut.Resolve(newRequest(nameWithLabels(128), dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeFormatError))
+			Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+			Expect(resp.Reason).Should(Equal("TOO MANY LABELS"))
+			Expect(limit).Should(Equal("labels"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should return configuration", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{
+				"maxLength = 253",
+				"maxLabels = 127",
+				"response = formerr",
+			}))
+		})
+	})
+
+	When("lower limits and REFUSED are configured", func() {
+		BeforeEach(func() {
+			cfg.MaxLength = 20
+			cfg.MaxLabels = 3
+			cfg.Response = config.QueryNameLimitResponseRefused
+		})
+
+		It("should refuse too long names", func() {
+			resp, err := sut.Resolve(newRequest("averyveryverylongname.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			Expect(resp.Reason).Should(Equal("NAME TOO LONG"))
+		})
+
+		It("should refuse names with too many labels", func() {
+			resp, err := sut.Resolve(newRequest("a.b.c.d.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			Expect(resp.Reason).Should(Equal("TOO MANY LABELS"))
+		})
+
+		It("should delegate names within the limits", func() {
+			resp, err := sut.Resolve(newRequest("a.b.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+	})
+})
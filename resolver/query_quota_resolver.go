@@ -0,0 +1,276 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+)
+
+const (
+	queryQuotaResolverLogger = "query_quota_resolver"
+
+	quotaStateSaveInterval = time.Minute
+
+	quotaDayFormat = "2006-01-02"
+)
+
+// clientQuota contains the daily quota and the amount of queries of one client
+type clientQuota struct {
+	Limit uint `json:"limit"`
+	Used  uint `json:"used"`
+}
+
+// quotaState is the persisted state of the query quota
+type quotaState struct {
+	Day     string                  `json:"day"`
+	Clients map[string]*clientQuota `json:"clients"`
+}
+
+// QueryQuotaResolver blocks all queries of a client after its daily query quota is exhausted
+type QueryQuotaResolver struct {
+	NextResolver
+	clientGroups map[string]uint
+	stateFile    string
+	lock         sync.Mutex
+	state        quotaState
+	now          func() time.Time
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewQueryQuotaResolver returns new resolver instance
+func NewQueryQuotaResolver(cfg config.QueryQuotaConfig) ChainedResolver {
+	r := &QueryQuotaResolver{
+		clientGroups: cfg.ClientGroups,
+		stateFile:    cfg.StateFile,
+		now:          time.Now,
+	}
+
+	r.state = quotaState{Day: r.today(), Clients: make(map[string]*clientQuota)}
+
+	if len(r.clientGroups) > 0 && r.stateFile != "" {
+		if err := r.loadState(); err != nil {
+			log.PrefixedLog(queryQuotaResolverLogger).Warn("can't load query quota state: ", err)
+		}
+
+		r.stop = make(chan struct{})
+
+		go r.periodicSave()
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *QueryQuotaResolver) Configuration() (result []string) {
+	if len(r.clientGroups) == 0 {
+		return []string{"deactivated"}
+	}
+
+	result = append(result, "clientGroups:")
+	for client, limit := range r.clientGroups {
+		result = append(result, fmt.Sprintf("  %s = %d", client, limit))
+	}
+
+	if r.stateFile != "" {
+		result = append(result, fmt.Sprintf("stateFile = %s", r.stateFile))
+	}
+
+	return result
+}
+
+// Resolve counts the query of the client and blocks it if the daily quota is exhausted
+func (r *QueryQuotaResolver) Resolve(request *model.Request) (*model.Response, error) {
+	logger := withPrefix(request.Log, queryQuotaResolverLogger)
+
+	if limit, found := r.quotaForClient(request); found {
+		client := clientIdentifier(request)
+
+		if !r.countQuery(client, limit) {
+			logger.WithField("client", client).Debugf("daily query quota of %d queries exceeded", limit)
+
+			response := new(dns.Msg)
+			response.SetRcode(request.Req, dns.RcodeRefused)
+
+			return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: "QUOTA EXCEEDED"}, nil
+		}
+	}
+
+	logger.WithField("resolver", Name(r.next)).Trace("go to next resolver")
+
+	return r.next.Resolve(request)
+}
+
+// QuotaStatus returns the quota status of all clients with queries today
+func (r *QueryQuotaResolver) QuotaStatus() []api.ClientQuotaStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.resetOnNewDay()
+
+	result := make([]api.ClientQuotaStatus, 0, len(r.state.Clients))
+
+	for client, quota := range r.state.Clients {
+		status := api.ClientQuotaStatus{Client: client, Limit: quota.Limit, Used: quota.Used}
+
+		if quota.Used < quota.Limit {
+			status.Remaining = quota.Limit - quota.Used
+		}
+
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Client < result[j].Client
+	})
+
+	return result
+}
+
+// countQuery increments the query count of the client, returns false if the quota is already exhausted
+func (r *QueryQuotaResolver) countQuery(client string, limit uint) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.resetOnNewDay()
+
+	quota, found := r.state.Clients[client]
+	if !found {
+		quota = &clientQuota{}
+		r.state.Clients[client] = quota
+	}
+
+	quota.Limit = limit
+
+	if quota.Used >= limit {
+		return false
+	}
+
+	quota.Used++
+
+	return true
+}
+
+// resetOnNewDay resets all query counts after local midnight, must be called with acquired lock
+func (r *QueryQuotaResolver) resetOnNewDay() {
+	if today := r.today(); r.state.Day != today {
+		r.state = quotaState{Day: today, Clients: make(map[string]*clientQuota)}
+	}
+}
+
+func (r *QueryQuotaResolver) today() string {
+	return r.now().Local().Format(quotaDayFormat)
+}
+
+// quotaForClient returns the smallest quota of all matching client groups,
+// the quota of the "default" group is used if no other group matches
+func (r *QueryQuotaResolver) quotaForClient(request *model.Request) (limit uint, found bool) {
+	for clientIdentifier, quota := range r.clientGroups {
+		matches := clientIdentifier == request.ClientIP.String() || util.CidrContainsIP(clientIdentifier, request.ClientIP)
+
+		for _, cName := range request.ClientNames {
+			if util.ClientNameMatchesGroupName(clientIdentifier, cName) {
+				matches = true
+			}
+		}
+
+		if matches && (!found || quota < limit) {
+			limit, found = quota, true
+		}
+	}
+
+	if !found {
+		limit, found = r.clientGroups["default"]
+	}
+
+	return limit, found
+}
+
+// clientIdentifier returns the first client name or the client IP if the name is unknown
+func clientIdentifier(request *model.Request) string {
+	if len(request.ClientNames) > 0 && request.ClientNames[0] != "" {
+		return request.ClientNames[0]
+	}
+
+	return request.ClientIP.String()
+}
+
+func (r *QueryQuotaResolver) periodicSave() {
+	ticker := time.NewTicker(quotaStateSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			util.LogOnError("can't save query quota state: ", r.saveState())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic save and saves the state, so the queries since the last save are kept on shutdown
+func (r *QueryQuotaResolver) Close() error {
+	if r.stop == nil {
+		return nil
+	}
+
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	return r.saveState()
+}
+
+func (r *QueryQuotaResolver) loadState() error {
+	data, err := os.ReadFile(r.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("can't read state file: %w", err)
+	}
+
+	var state quotaState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("can't parse state file: %w", err)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// state from a previous day is outdated
+	if state.Day == r.today() && state.Clients != nil {
+		r.state = state
+	}
+
+	return nil
+}
+
+func (r *QueryQuotaResolver) saveState() error {
+	r.lock.Lock()
+	data, err := json.Marshal(r.state)
+	r.lock.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("can't serialize state: %w", err)
+	}
+
+	const stateFilePermissions = 0o600
+
+	if err := os.WriteFile(r.stateFile, data, stateFilePermissions); err != nil {
+		return fmt.Errorf("can't write state file: %w", err)
+	}
+
+	return nil
+}
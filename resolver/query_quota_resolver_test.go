@@ -0,0 +1,247 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("QueryQuotaResolver", func() {
+	var (
+		sut  *QueryQuotaResolver
+		cfg  config.QueryQuotaConfig
+		m    *resolverMock
+		err  error
+		resp *Response
+		now  time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2022, 1, 10, 12, 0, 0, 0, time.Local)
+		cfg = config.QueryQuotaConfig{
+			ClientGroups: map[string]uint{
+				"kid*":           2,
+				"192.168.178.55": 1,
+				"10.0.0.0/8":     3,
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewQueryQuotaResolver(cfg).(*QueryQuotaResolver)
+		DeferCleanup(sut.Close)
+		sut.now = func() time.Time { return now }
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+		sut.Next(m)
+	})
+
+	expectBlocked := func() {
+		Expect(err).Should(Succeed())
+		Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+		Expect(resp.Reason).Should(Equal("QUOTA EXCEEDED"))
+		Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+	}
+
+	Describe("Counting queries", func() {
+		When("client name matches a client group", func() {
+			It("should block queries after the quota is exhausted", func() {
+				for i := 0; i < 2; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10", "kid-laptop"))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).ShouldNot(Equal(ResponseTypeBLOCKED))
+				}
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10", "kid-laptop"))
+				expectBlocked()
+				m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+			})
+			It("should count each client separately", func() {
+				for i := 0; i < 2; i++ {
+					_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10", "kid-laptop"))
+					Expect(err).Should(Succeed())
+				}
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.11", "kid-phone"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).ShouldNot(Equal(ResponseTypeBLOCKED))
+			})
+		})
+		When("client IP matches a client group", func() {
+			It("should block queries after the quota is exhausted", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				expectBlocked()
+			})
+		})
+		When("multiple client groups match", func() {
+			It("should use the smallest quota", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.1.1.1", "kid-tablet"))
+				Expect(err).Should(Succeed())
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.1.1.1", "kid-tablet"))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.1.1.1", "kid-tablet"))
+				expectBlocked()
+			})
+		})
+		When("no client group matches", func() {
+			It("should not limit the queries", func() {
+				for i := 0; i < 5; i++ {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.1", "parent"))
+					Expect(err).Should(Succeed())
+					Expect(resp.RType).ShouldNot(Equal(ResponseTypeBLOCKED))
+				}
+			})
+		})
+		When("default client group is defined", func() {
+			BeforeEach(func() {
+				cfg.ClientGroups["default"] = 1
+			})
+			It("should use the default quota for other clients", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.1", "parent"))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.1", "parent"))
+				expectBlocked()
+			})
+		})
+		When("day changes", func() {
+			It("should reset the quota at midnight", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				Expect(err).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				expectBlocked()
+
+				now = time.Date(2022, 1, 11, 0, 0, 1, 0, time.Local)
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).ShouldNot(Equal(ResponseTypeBLOCKED))
+			})
+		})
+	})
+
+	Describe("Quota status", func() {
+		It("should return the status of all clients with queries today", func() {
+			_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10", "kid-laptop"))
+			Expect(err).Should(Succeed())
+			_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+			Expect(err).Should(Succeed())
+			_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+			Expect(err).Should(Succeed())
+
+			Expect(sut.QuotaStatus()).Should(Equal([]api.ClientQuotaStatus{
+				{Client: "192.168.178.55", Limit: 1, Used: 1, Remaining: 0},
+				{Client: "kid-laptop", Limit: 2, Used: 1, Remaining: 1},
+			}))
+
+			now = now.Add(24 * time.Hour)
+
+			Expect(sut.QuotaStatus()).Should(BeEmpty())
+		})
+	})
+
+	Describe("Persistence of the state", func() {
+		var stateFile string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "quota")
+			Expect(err).Should(Succeed())
+			DeferCleanup(os.RemoveAll, dir)
+
+			stateFile = filepath.Join(dir, "quota.json")
+			cfg.StateFile = stateFile
+			// state is loaded on creation with the current time
+			now = time.Now()
+		})
+
+		When("state is saved", func() {
+			It("should be restored by a new instance on the same day", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				Expect(err).Should(Succeed())
+				Expect(sut.saveState()).Should(Succeed())
+				Expect(stateFile).Should(BeAnExistingFile())
+
+				other := NewQueryQuotaResolver(cfg).(*QueryQuotaResolver)
+				DeferCleanup(other.Close)
+				other.now = sut.now
+				other.Next(m)
+
+				resp, err = other.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				expectBlocked()
+			})
+		})
+
+		When("resolver is closed", func() {
+			It("should save the state", func() {
+				_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				Expect(err).Should(Succeed())
+				Expect(stateFile).ShouldNot(BeAnExistingFile())
+
+				Expect(sut.Close()).Should(Succeed())
+				Expect(stateFile).Should(BeAnExistingFile())
+
+				other := NewQueryQuotaResolver(cfg).(*QueryQuotaResolver)
+				DeferCleanup(other.Close)
+				other.now = sut.now
+				other.Next(m)
+
+				resp, err = other.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.55"))
+				expectBlocked()
+			})
+		})
+
+		When("state file is from a previous day", func() {
+			It("should be ignored", func() {
+				Expect(os.WriteFile(stateFile,
+					[]byte(`{"day":"2000-01-01","clients":{"192.168.178.55":{"limit":1,"used":1}}}`), 0o600)).
+					Should(Succeed())
+
+				other := NewQueryQuotaResolver(cfg).(*QueryQuotaResolver)
+				DeferCleanup(other.Close)
+				Expect(other.QuotaStatus()).Should(BeEmpty())
+			})
+		})
+
+		When("state file is invalid", func() {
+			It("should start with an empty state", func() {
+				Expect(os.WriteFile(stateFile, []byte("invalid"), 0o600)).Should(Succeed())
+
+				other := NewQueryQuotaResolver(cfg).(*QueryQuotaResolver)
+				DeferCleanup(other.Close)
+				Expect(other.QuotaStatus()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("resolver is enabled", func() {
+			It("should return configuration", func() {
+				c := sut.Configuration()
+				Expect(c).Should(HaveLen(4))
+			})
+		})
+
+		When("resolver is disabled", func() {
+			BeforeEach(func() {
+				cfg = config.QueryQuotaConfig{}
+			})
+			It("should return 'deactivated'", func() {
+				c := sut.Configuration()
+				Expect(c).Should(Equal([]string{"deactivated"}))
+			})
+		})
+	})
+})
@@ -2,14 +2,19 @@ package resolver
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
 	"github.com/0xERR0R/blocky/log"
 	"github.com/0xERR0R/blocky/model"
 	"github.com/0xERR0R/blocky/util"
 
+	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 )
 
@@ -83,7 +88,14 @@ func (r *NextResolver) Next(n Resolver) {
 
 // GetNext returns the next resolver
 func (r *NextResolver) GetNext() Resolver {
-	return r.next
+	return unwrap(r.next)
+}
+
+// link returns the link to the next resolver, nil if the resolver is not chained
+func (r *NextResolver) link() *timedResolver {
+	t, _ := r.next.(*timedResolver)
+
+	return t
 }
 
 func logger(prefix string) *logrus.Entry {
@@ -94,12 +106,33 @@ func withPrefix(logger *logrus.Entry, prefix string) *logrus.Entry {
 	return logger.WithField("prefix", prefix)
 }
 
-// Chain creates a chain of resolvers
+// ChainSettings contains the settings of the links between the resolvers of a chain
+type ChainSettings struct {
+	// a panic of a resolver crashes the process, e.g. for debugging
+	disablePanicRecovery bool
+	// answer for a request without response of a resolver
+	noAnswerResponse config.NoAnswerResponse
+}
+
+// NewChainSettings returns the chain settings of the configuration
+func NewChainSettings(cfg *config.Config) *ChainSettings {
+	return &ChainSettings{
+		disablePanicRecovery: cfg.DisablePanicRecovery,
+		noAnswerResponse:     cfg.NoAnswerResponse,
+	}
+}
+
+// Chain creates a chain of resolvers with the default settings
 func Chain(resolvers ...Resolver) Resolver {
+	return ChainWithSettings(&ChainSettings{}, resolvers...)
+}
+
+// ChainWithSettings creates a chain of resolvers, the settings apply to each link of the chain
+func ChainWithSettings(settings *ChainSettings, resolvers ...Resolver) Resolver {
 	for i, res := range resolvers {
 		if i+1 < len(resolvers) {
 			if cr, ok := res.(ChainedResolver); ok {
-				cr.Next(resolvers[i+1])
+				cr.Next(&timedResolver{Resolver: resolvers[i+1], settings: settings})
 			}
 		}
 	}
@@ -107,7 +140,138 @@ func Chain(resolvers ...Resolver) Resolver {
 	return resolvers[0]
 }
 
+// chainSettings returns the settings of the first link of the chain, the default settings for a single resolver
+func chainSettings(chain Resolver) *ChainSettings {
+	if l, ok := chain.(interface{ link() *timedResolver }); ok {
+		if t := l.link(); t != nil {
+			return t.settings
+		}
+	}
+
+	return &ChainSettings{}
+}
+
+// Close closes the resolvers of the chain with open resources (io.Closer), e.g. on shutdown
+func Close(chain Resolver) {
+	for res := unwrap(chain); res != nil; {
+		if c, ok := res.(io.Closer); ok {
+			util.LogOnError(fmt.Sprintf("can't close %s: ", Name(res)), c.Close())
+		}
+
+		cr, ok := res.(ChainedResolver)
+		if !ok {
+			return
+		}
+
+		res = cr.GetNext()
+	}
+}
+
 // Name returns a user-friendly name of a resolver
 func Name(resolver Resolver) string {
-	return strings.Split(fmt.Sprintf("%T", resolver), ".")[1]
+	return strings.Split(fmt.Sprintf("%T", unwrap(resolver)), ".")[1]
+}
+
+// Resolve resolves the request with the chain, a panic of the first resolver is recovered like in the other resolvers
+func Resolve(chain Resolver, req *model.Request) (*model.Response, error) {
+	return (&timedResolver{Resolver: chain, settings: chainSettings(chain)}).Resolve(req)
+}
+
+// noAnswer returns the configured answer for a request without response of a resolver
+func (s *ChainSettings) noAnswer(req *model.Request) *model.Response {
+	rcode := dns.RcodeServerFailure
+
+	switch s.noAnswerResponse {
+	case config.NoAnswerResponseNxdomain:
+		rcode = dns.RcodeNameError
+	case config.NoAnswerResponseRefused:
+		rcode = dns.RcodeRefused
+	}
+
+	req.Log.WithField("question", util.QuestionToString(req.Req.Question)).
+		Warnf("no resolver answered the query, answering with %s", dns.RcodeToString[rcode])
+
+	response := new(dns.Msg)
+	response.SetRcode(req.Req, rcode)
+
+	return &model.Response{Res: response, RType: model.ResponseTypeRESOLVED, Reason: "NO ANSWER"}
+}
+
+// ResolveWithTimings resolves the request with the chain and collects the time spent in each resolver
+func ResolveWithTimings(chain Resolver, req *model.Request) (*model.Response, error) {
+	req.Timings = &model.ResolverTimings{}
+
+	return Resolve(chain, req)
+}
+
+// timedResolver links the resolvers of the chain. It measures the time spent in the wrapped resolver for requests
+// with timings and recovers a panic of the wrapped resolver. If the wrapped resolver returns neither a response nor
+// an error, the request is answered with the configured no answer response, so the previous resolvers always get
+// a response
+type timedResolver struct {
+	Resolver
+	settings *ChainSettings
+}
+
+func (r *timedResolver) Resolve(req *model.Request) (resp *model.Response, err error) {
+	if !r.settings.disablePanicRecovery {
+		defer r.recoverPanic(req, &resp, &err)
+	}
+
+	resp, err = r.resolve(req)
+	if err == nil && (resp == nil || resp.Res == nil) {
+		return r.settings.noAnswer(req), nil
+	}
+
+	return resp, err
+}
+
+func (r *timedResolver) resolve(req *model.Request) (resp *model.Response, err error) {
+	if req.Timings == nil {
+		return r.Resolver.Resolve(req)
+	}
+
+	idx := len(req.Timings.Entries)
+	req.Timings.Entries = append(req.Timings.Entries, model.ResolverTiming{Resolver: Name(r.Resolver)})
+
+	start := time.Now()
+	resp, err = r.Resolver.Resolve(req)
+	total := time.Since(start)
+
+	entry := &req.Timings.Entries[idx]
+	entry.Total = total
+	entry.Duration = total
+
+	if len(req.Timings.Entries) > idx+1 {
+		// the next entry is the next resolver in the chain
+		entry.Duration -= req.Timings.Entries[idx+1].Total
+	}
+
+	return resp, err
+}
+
+// recoverPanic returns an error instead of the response, if the wrapped resolver panics. The error is answered with
+// SERVFAIL, the process keeps running
+func (r *timedResolver) recoverPanic(req *model.Request, resp **model.Response, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	name := Name(r.Resolver)
+
+	req.Log.WithField("resolver", name).Errorf("recovered panic: %v\n%s", p, debug.Stack())
+
+	evt.Bus().Publish(evt.ResolverPanicRecovered, name)
+
+	*resp = nil
+	*err = fmt.Errorf("panic in %s: %v", name, p)
+}
+
+func unwrap(resolver Resolver) Resolver {
+	if t, ok := resolver.(*timedResolver); ok {
+		return t.Resolver
+	}
+
+	return resolver
 }
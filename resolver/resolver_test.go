@@ -1,7 +1,14 @@
 package resolver
 
 import (
+	"errors"
+	"time"
+
 	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/mock"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -12,7 +19,7 @@ var _ = Describe("Resolver", func() {
 		When("A chain of resolvers will be created", func() {
 			It("should be iterable by calling 'GetNext'", func() {
 				br, _ := NewBlockingResolver(config.BlockingConfig{BlockType: "zeroIP"}, nil)
-				ch := Chain(br, NewClientNamesResolver(config.ClientLookupConfig{}))
+				ch := Chain(br, NewClientNamesResolver(config.ClientLookupConfig{}, NewUpstreamSettings(&config.Config{})))
 				c, ok := ch.(ChainedResolver)
 				Expect(ok).Should(BeTrue())
 
@@ -20,12 +27,164 @@ var _ = Describe("Resolver", func() {
 				Expect(next).ShouldNot(BeNil())
 			})
 		})
+		When("request collects timings", func() {
+			It("should measure the time spent in each resolver", func() {
+				m := &resolverMock{}
+				m.On("Resolve", mock.Anything).Run(func(mock.Arguments) {
+					time.Sleep(10 * time.Millisecond)
+				}).Return(&model.Response{Res: new(dns.Msg)}, nil)
+
+				ch := Chain(NewIPv6Checker(false), m)
+				req := newRequest("example.com.", dns.TypeA)
+
+				_, err := ResolveWithTimings(ch, req)
+				Expect(err).Should(Succeed())
+
+				Expect(req.Timings.Entries).Should(HaveLen(2))
+				Expect(req.Timings.Entries[0].Resolver).Should(Equal("IPv6DisablingResolver"))
+				Expect(req.Timings.Entries[1].Resolver).Should(Equal("resolverMock"))
+				Expect(req.Timings.Entries[1].Duration).Should(BeNumerically(">=", 10*time.Millisecond))
+				Expect(req.Timings.Entries[0].Total).Should(BeNumerically(">=", req.Timings.Entries[1].Total))
+				Expect(req.Timings.Entries[0].Duration).Should(
+					Equal(req.Timings.Entries[0].Total - req.Timings.Entries[1].Total))
+			})
+			It("should not measure requests without timings", func() {
+				m := &resolverMock{}
+				m.On("Resolve", mock.Anything).Return(&model.Response{Res: new(dns.Msg)}, nil)
+
+				req := newRequest("example.com.", dns.TypeA)
+				_, err := Chain(NewIPv6Checker(false), m).Resolve(req)
+				Expect(err).Should(Succeed())
+
+				Expect(req.Timings).Should(BeNil())
+			})
+		})
+		When("a resolver panics", func() {
+			var m *resolverMock
+
+			BeforeEach(func() {
+				m = &resolverMock{}
+				m.On("Resolve", mock.Anything).Run(func(mock.Arguments) {
+					panic("test panic")
+				}).Return(nil, nil)
+			})
+
+			It("should recover the panic and return an error", func() {
+				var recovered string
+
+				_ = Bus().SubscribeOnce(ResolverPanicRecovered, func(name string) {
+					recovered = name
+				})
+
+				resp, err := Chain(NewIPv6Checker(false), m).Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError("panic in resolverMock: test panic"))
+				Expect(resp).Should(BeNil())
+				Expect(recovered).Should(Equal("resolverMock"))
+			})
+
+			It("should recover the panic of the first resolver", func() {
+				_, err := Resolve(m, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError("panic in resolverMock: test panic"))
+			})
+
+			It("should not recover if the recovery is disabled", func() {
+				chain := ChainWithSettings(&ChainSettings{disablePanicRecovery: true}, NewIPv6Checker(false), m)
+
+				Expect(func() {
+					_, _ = Resolve(chain, newRequest("example.com.", dns.TypeA))
+				}).Should(PanicWith("test panic"))
+			})
+		})
+		When("no resolver answers", func() {
+			var m *resolverMock
+
+			BeforeEach(func() {
+				m = &resolverMock{}
+				m.On("Resolve", mock.Anything).Return(nil, nil)
+			})
+
+			It("should answer with SERVFAIL by default", func() {
+				resp, err := Resolve(m, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+				Expect(resp.Reason).Should(Equal("NO ANSWER"))
+			})
+
+			It("should answer with the configured response code", func() {
+				chain := ChainWithSettings(&ChainSettings{noAnswerResponse: config.NoAnswerResponseNxdomain},
+					NewIPv6Checker(false), m)
+
+				resp, err := Resolve(chain, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+
+				chain = ChainWithSettings(&ChainSettings{noAnswerResponse: config.NoAnswerResponseRefused},
+					NewIPv6Checker(false), m)
+
+				resp, err = Resolve(chain, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			})
+
+			It("should answer the requests of the previous resolvers in the chain", func() {
+				chain := ChainWithSettings(&ChainSettings{noAnswerResponse: config.NoAnswerResponseNxdomain},
+					NewMetricsResolver(config.PrometheusConfig{}),
+					NewCachingResolver(config.CachingConfig{CacheTimeNegative: config.Duration(time.Minute)}, nil),
+					m,
+				)
+
+				resp, err := Resolve(chain, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+				Expect(resp.Reason).Should(Equal("NO ANSWER"))
+				m.AssertNumberOfCalls(GinkgoT(), "Resolve", 1)
+
+				// the no answer response is not cached
+				resp, err = Resolve(chain, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Reason).Should(Equal("NO ANSWER"))
+				m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+			})
+
+			It("should pass errors", func() {
+				e := &resolverMock{}
+				e.On("Resolve", mock.Anything).Return(nil, errors.New("upstream error"))
+
+				_, err := Resolve(e, newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError("upstream error"))
+			})
+		})
+		When("the chain is closed", func() {
+			It("should close the resolvers with open resources", func() {
+				closer := &closingResolverMock{}
+
+				Close(Chain(NewClientNamesResolver(config.ClientLookupConfig{}, NewUpstreamSettings(&config.Config{})), closer))
+				Expect(closer.closed).Should(BeTrue())
+			})
+		})
 		When("'Name' will be called", func() {
 			It("should return resolver name", func() {
 				br, _ := NewBlockingResolver(config.BlockingConfig{BlockType: "zeroIP"}, nil)
 				name := Name(br)
 				Expect(name).Should(Equal("BlockingResolver"))
 			})
+			It("should return the name of the chained resolver", func() {
+				ch := Chain(NewIPv6Checker(false),
+					NewClientNamesResolver(config.ClientLookupConfig{}, NewUpstreamSettings(&config.Config{})))
+
+				Expect(Name(ch.(ChainedResolver).GetNext())).Should(Equal("ClientNamesResolver"))
+			})
 		})
 	})
 })
+
+type closingResolverMock struct {
+	resolverMock
+	closed bool
+}
+
+func (r *closingResolverMock) Close() error {
+	r.closed = true
+
+	return nil
+}
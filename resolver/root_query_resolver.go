@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	rootQueryResolverLogger = "root_query_resolver"
+
+	rootQueryRateLimitWindow = time.Minute
+)
+
+// rootQueryCounter counts the root/TLD queries of one client in the current rate limit window
+type rootQueryCounter struct {
+	windowStart time.Time
+	count       uint
+}
+
+// RootQueryResolver handles queries to the root zone or a bare TLD: forward, refuse or answer with static hints.
+// These queries can be optionally rate limited per client
+type RootQueryResolver struct {
+	NextResolver
+	mode      config.RootQueryMode
+	hints     []dns.RR
+	rateLimit uint
+	lock      sync.Mutex
+	counters  map[string]*rootQueryCounter
+	now       func() time.Time
+}
+
+// NewRootQueryResolver returns new resolver instance
+func NewRootQueryResolver(cfg config.RootQueriesConfig) ChainedResolver {
+	hints := make([]dns.RR, 0, len(cfg.Hints))
+
+	for _, rr := range cfg.Hints {
+		rr := dns.Copy(rr)
+		rr.Header().Name = strings.ToLower(dns.Fqdn(rr.Header().Name))
+		hints = append(hints, rr)
+	}
+
+	return &RootQueryResolver{
+		mode:      cfg.Mode,
+		hints:     hints,
+		rateLimit: cfg.RateLimit,
+		counters:  make(map[string]*rootQueryCounter),
+		now:       time.Now,
+	}
+}
+
+// Configuration returns current resolver configuration
+func (r *RootQueryResolver) Configuration() (result []string) {
+	result = append(result, fmt.Sprintf("mode = %s", r.mode))
+
+	if r.mode == config.RootQueryModeHint {
+		result = append(result, "hints:")
+		for _, rr := range r.hints {
+			result = append(result, fmt.Sprintf("  %s", rr))
+		}
+	}
+
+	if r.rateLimit > 0 {
+		result = append(result, fmt.Sprintf("rateLimit = %d per minute", r.rateLimit))
+	} else {
+		result = append(result, "rateLimit = unlimited")
+	}
+
+	return result
+}
+
+// Resolve handles queries to the root zone or a bare TLD, all other queries are passed to the next resolver
+func (r *RootQueryResolver) Resolve(request *model.Request) (*model.Response, error) {
+	logger := withPrefix(request.Log, rootQueryResolverLogger)
+
+	question := request.Req.Question[0]
+	if !isRootOrTLDQuery(question.Name) {
+		logger.WithField("resolver", Name(r.next)).Trace("go to next resolver")
+
+		return r.next.Resolve(request)
+	}
+
+	logger = logger.WithField("domain", util.ExtractDomain(question))
+
+	if !r.allowQuery(request.ClientIP.String()) {
+		logger.Debug("root/TLD query rate limit exceeded")
+
+		return r.refused(request, "RATE LIMITED (ROOT/TLD QUERY)"), nil
+	}
+
+	switch r.mode {
+	case config.RootQueryModeRefuse:
+		logger.Debug("refusing root/TLD query")
+
+		return r.refused(request, "REFUSED (ROOT/TLD QUERY)"), nil
+	case config.RootQueryModeHint:
+		logger.Debug("answering root/TLD query with static hints")
+
+		return r.answerFromHints(request, question), nil
+	case config.RootQueryModeForward:
+		logger.Debug("forwarding root/TLD query")
+	}
+
+	return r.next.Resolve(request)
+}
+
+func (r *RootQueryResolver) refused(request *model.Request, reason string) *model.Response {
+	response := new(dns.Msg)
+	response.SetRcode(request.Req, dns.RcodeRefused)
+
+	return &model.Response{Res: response, RType: model.ResponseTypeBLOCKED, Reason: reason}
+}
+
+// answerFromHints returns all hints with the name and type of the question, NOERROR with empty answer if none matches
+func (r *RootQueryResolver) answerFromHints(request *model.Request, question dns.Question) *model.Response {
+	response := new(dns.Msg)
+	response.SetReply(request.Req)
+
+	name := strings.ToLower(question.Name)
+
+	for _, rr := range r.hints {
+		if rr.Header().Name == name && rr.Header().Rrtype == question.Qtype {
+			answer := dns.Copy(rr)
+			answer.Header().Name = question.Name
+			response.Answer = append(response.Answer, answer)
+		}
+	}
+
+	return &model.Response{Res: response, RType: model.ResponseTypeCUSTOMDNS, Reason: "ROOT HINT"}
+}
+
+// allowQuery counts the query of the client, returns false if the rate limit is exceeded
+func (r *RootQueryResolver) allowQuery(client string) bool {
+	if r.rateLimit == 0 {
+		return true
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+
+	// remove counters of expired windows, so the map doesn't grow with each client
+	for c, counter := range r.counters {
+		if now.Sub(counter.windowStart) >= rootQueryRateLimitWindow {
+			delete(r.counters, c)
+		}
+	}
+
+	counter, found := r.counters[client]
+	if !found {
+		counter = &rootQueryCounter{windowStart: now}
+		r.counters[client] = counter
+	}
+
+	if counter.count >= r.rateLimit {
+		return false
+	}
+
+	counter.count++
+
+	return true
+}
+
+// isRootOrTLDQuery returns true for the root zone (".") or a TLD of the public suffix list (e.g. "com."). Other
+// single-label names (e.g. "nas.") are LAN host names
+func isRootOrTLDQuery(name string) bool {
+	switch dns.CountLabel(name) {
+	case 0:
+		return true
+	case 1:
+		_, icann := publicsuffix.PublicSuffix(strings.ToLower(strings.TrimSuffix(name, ".")))
+
+		return icann
+	default:
+		return false
+	}
+}
@@ -0,0 +1,210 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("RootQueryResolver", func() {
+	var (
+		sut  *RootQueryResolver
+		cfg  config.RootQueriesConfig
+		m    *resolverMock
+		err  error
+		resp *Response
+		now  time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2022, 1, 10, 12, 0, 0, 0, time.Local)
+		cfg = config.RootQueriesConfig{Mode: config.RootQueryModeForward}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewRootQueryResolver(cfg).(*RootQueryResolver)
+		sut.now = func() time.Time { return now }
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), RType: ResponseTypeRESOLVED}, nil)
+		sut.Next(m)
+	})
+
+	Describe("Mode forward", func() {
+		It("should forward root and TLD queries", func() {
+			resp, err = sut.Resolve(newRequest(".", dns.TypeNS))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+
+			resp, err = sut.Resolve(newRequest("com.", dns.TypeNS))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+		})
+	})
+
+	Describe("Mode refuse", func() {
+		BeforeEach(func() {
+			cfg.Mode = config.RootQueryModeRefuse
+		})
+		It("should refuse root and TLD queries", func() {
+			for _, name := range []string{".", "com."} {
+				resp, err = sut.Resolve(newRequest(name, dns.TypeNS))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeBLOCKED))
+				Expect(resp.Reason).Should(Equal("REFUSED (ROOT/TLD QUERY)"))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			}
+
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+		It("should forward other queries", func() {
+			resp, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			m.AssertExpectations(GinkgoT())
+		})
+		It("should resolve LAN host names with the conditional '.' mapping and search domains", func() {
+			conditional := NewConditionalUpstreamResolver(config.ConditionalUpstreamConfig{
+				Mapping: config.ConditionalUpstreamMapping{
+					Upstreams: map[string][]config.Upstream{
+						".": {TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+							response, _ = util.NewMsgWithAnswer(request.Question[0].Name, 300, dns.TypeA, "192.168.178.2")
+
+							return response
+						})},
+					},
+				},
+			}, NewUpstreamSettings(&config.Config{}))
+
+			r := Chain(sut, conditional, m)
+
+			resp, err = r.Resolve(newRequest("nas.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeCONDITIONAL))
+			Expect(resp.Res.Answer).Should(BeDNSRecord("nas.", dns.TypeA, 300, "192.168.178.2"))
+
+			r = Chain(NewSearchDomainResolver([]string{"home.arpa"}), sut, m)
+
+			resp, err = r.Resolve(newRequest("printer.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			// "printer.home.arpa." and the fallback without search domain
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+		})
+	})
+
+	Describe("Mode hint", func() {
+		BeforeEach(func() {
+			cfg.Mode = config.RootQueryModeHint
+
+			for _, r := range []string{
+				". 3600 IN NS a.root-servers.net.",
+				". 3600 IN NS b.root-servers.net.",
+				"COM. 3600 IN NS a.gtld-servers.net.",
+			} {
+				rr, err := dns.NewRR(r)
+				Expect(err).Should(Succeed())
+				cfg.Hints = append(cfg.Hints, rr)
+			}
+		})
+		When("hints for the query exist", func() {
+			It("should answer with the hints", func() {
+				resp, err = sut.Resolve(newRequest(".", dns.TypeNS))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeCUSTOMDNS))
+				Expect(resp.Reason).Should(Equal("ROOT HINT"))
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].(*dns.NS).Ns).Should(Equal("a.root-servers.net."))
+
+				resp, err = sut.Resolve(newRequest("Com.", dns.TypeNS))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].Header().Name).Should(Equal("Com."))
+
+				m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+			})
+		})
+		When("no hint for the query exists", func() {
+			It("should return an empty answer", func() {
+				resp, err = sut.Resolve(newRequest("net.", dns.TypeSOA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Rate limit", func() {
+		BeforeEach(func() {
+			cfg.RateLimit = 2
+		})
+		It("should refuse root and TLD queries of the client after the limit is exceeded", func() {
+			for i := 0; i < 2; i++ {
+				resp, err = sut.Resolve(newRequestWithClient(".", dns.TypeNS, "192.168.178.10"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			}
+
+			resp, err = sut.Resolve(newRequestWithClient("com.", dns.TypeNS, "192.168.178.10"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RATE LIMITED (ROOT/TLD QUERY)"))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+
+			By("other clients have their own limit", func() {
+				resp, err = sut.Resolve(newRequestWithClient(".", dns.TypeNS, "192.168.178.11"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+
+			By("other queries are not limited", func() {
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.10"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+
+			By("limit is reset after one minute", func() {
+				now = now.Add(time.Minute)
+
+				resp, err = sut.Resolve(newRequestWithClient(".", dns.TypeNS, "192.168.178.10"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
+			})
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("mode is hint with rate limit", func() {
+			BeforeEach(func() {
+				cfg = config.RootQueriesConfig{Mode: config.RootQueryModeHint, RateLimit: 10}
+			})
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"mode = hint", "hints:", "rateLimit = 10 per minute"}))
+			})
+		})
+		When("mode is forward", func() {
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"mode = forward", "rateLimit = unlimited"}))
+			})
+		})
+	})
+})
+
+var _ = Describe("isRootOrTLDQuery", func() {
+	It("should only match the root zone and TLDs", func() {
+		Expect(isRootOrTLDQuery(".")).Should(BeTrue())
+		Expect(isRootOrTLDQuery("com.")).Should(BeTrue())
+		Expect(isRootOrTLDQuery("DE.")).Should(BeTrue())
+		Expect(isRootOrTLDQuery("example.com.")).Should(BeFalse())
+		Expect(isRootOrTLDQuery("nas.")).Should(BeFalse())
+		Expect(isRootOrTLDQuery("printer")).Should(BeFalse())
+	})
+})
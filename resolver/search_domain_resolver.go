@@ -0,0 +1,93 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+)
+
+// SearchDomainResolver appends the configured search domains to single-label queries (e.g. printer ->
+// printer.home.arpa), like the search list in resolv.conf. The search domains are tried in order, the query is
+// resolved without search domain if none of them returns an answer
+type SearchDomainResolver struct {
+	NextResolver
+	domains []string
+}
+
+// NewSearchDomainResolver returns new resolver instance
+func NewSearchDomainResolver(domains []string) ChainedResolver {
+	normalized := make([]string, 0, len(domains))
+
+	for _, domain := range domains {
+		normalized = append(normalized, strings.ToLower(strings.Trim(strings.TrimSpace(domain), ".")))
+	}
+
+	return &SearchDomainResolver{domains: normalized}
+}
+
+// Configuration returns current resolver configuration
+func (r *SearchDomainResolver) Configuration() (result []string) {
+	if len(r.domains) == 0 {
+		return []string{"deactivated"}
+	}
+
+	return []string{fmt.Sprintf("searchDomains = %v", r.domains)}
+}
+
+// Resolve tries the search domains for single-label queries, all other queries are passed to the next resolver
+func (r *SearchDomainResolver) Resolve(request *model.Request) (*model.Response, error) {
+	if len(r.domains) == 0 || len(request.Req.Question) != 1 || dns.CountLabel(request.Req.Question[0].Name) != 1 {
+		return r.next.Resolve(request)
+	}
+
+	logger := withPrefix(request.Log, "search_domain_resolver")
+
+	original := request.Req
+	name := original.Question[0].Name
+
+	for _, domain := range r.domains {
+		expanded := name + domain + "."
+
+		query := original.Copy()
+		query.Question[0].Name = expanded
+		request.Req = query
+
+		resp, err := r.next.Resolve(request)
+
+		request.Req = original
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Res.Rcode == dns.RcodeSuccess && len(resp.Res.Answer) > 0 {
+			logger.WithField("domain", util.Obfuscate(expanded)).Debug("single-label query resolved with search domain")
+
+			restoreQuestionName(resp.Res, expanded, name)
+
+			return resp, nil
+		}
+	}
+
+	return r.next.Resolve(request)
+}
+
+// restoreQuestionName replaces the expanded name in the question and the answer records with the name of the client
+func restoreQuestionName(msg *dns.Msg, expanded, name string) {
+	for i := range msg.Question {
+		if strings.EqualFold(msg.Question[i].Name, expanded) {
+			msg.Question[i].Name = name
+		}
+	}
+
+	for i, rr := range msg.Answer {
+		if strings.EqualFold(rr.Header().Name, expanded) {
+			// records can be shared with other responses
+			msg.Answer[i] = dns.Copy(rr)
+			msg.Answer[i].Header().Name = name
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package resolver
+
+import (
+	"errors"
+
+	. "github.com/0xERR0R/blocky/helpertest"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("SearchDomainResolver", func() {
+	var (
+		sut      ChainedResolver
+		domains  []string
+		m        *resolverMock
+		resolved []string
+		answers  map[string]string
+		mockErr  error
+	)
+
+	BeforeEach(func() {
+		domains = []string{"home.arpa", ".lan."}
+		answers = map[string]string{}
+		mockErr = nil
+	})
+
+	JustBeforeEach(func() {
+		resolved = nil
+		sut = NewSearchDomainResolver(domains)
+		m = &resolverMock{}
+
+		track := func(args mock.Arguments) {
+			resolved = append(resolved, args.Get(0).(*Request).Req.Question[0].Name)
+		}
+
+		for name, ip := range answers {
+			name := name
+			res, err := util.NewMsgWithAnswer(name, 300, dns.TypeA, ip)
+			Expect(err).Should(Succeed())
+			res.SetQuestion(name, dns.TypeA)
+
+			m.On("Resolve", mock.MatchedBy(func(req *Request) bool {
+				return req.Req.Question[0].Name == name
+			})).Run(track).Return(&Response{Res: res, Reason: "RESOLVED"}, nil)
+		}
+
+		if mockErr != nil {
+			m.On("Resolve", mock.Anything).Run(track).Return(nil, mockErr)
+		} else {
+			nxDomain := new(dns.Msg)
+			nxDomain.Rcode = dns.RcodeNameError
+
+			m.On("Resolve", mock.Anything).Run(track).Return(&Response{Res: nxDomain, Reason: "RESOLVED"}, nil)
+		}
+
+		sut.Next(m)
+	})
+
+	When("search domains are configured", func() {
+		BeforeEach(func() {
+			answers["printer.lan."] = "192.168.178.10"
+		})
+
+		It("should try the search domains in order and return the answer with the original name", func() {
+			req := newRequest("printer.", dns.TypeA)
+			original := req.Req
+
+			resp, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"printer.home.arpa.", "printer.lan."}))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Question[0].Name).Should(Equal("printer."))
+			Expect(resp.Res.Answer).Should(BeDNSRecord("printer.", dns.TypeA, 300, "192.168.178.10"))
+			Expect(req.Req).Should(BeIdenticalTo(original))
+		})
+
+		It("should resolve the original name if no search domain returns an answer", func() {
+			resp, err := sut.Resolve(newRequest("scanner.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"scanner.home.arpa.", "scanner.lan.", "scanner."}))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+		})
+
+		It("should not change queries with multiple labels", func() {
+			_, err := sut.Resolve(newRequest("printer.example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"printer.example.com."}))
+		})
+
+		It("should not change root queries", func() {
+			_, err := sut.Resolve(newRequest(".", dns.TypeNS))
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"."}))
+		})
+
+		When("next resolver fails", func() {
+			BeforeEach(func() {
+				mockErr = errors.New("upstream error")
+			})
+
+			It("should return the error", func() {
+				_, err := sut.Resolve(newRequest("scanner.", dns.TypeA))
+				Expect(err).Should(MatchError("upstream error"))
+				Expect(resolved).Should(Equal([]string{"scanner.home.arpa."}))
+			})
+		})
+
+		It("should return configuration", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"searchDomains = [home.arpa lan]"}))
+		})
+	})
+
+	When("no search domains are configured", func() {
+		BeforeEach(func() {
+			domains = nil
+		})
+
+		It("should pass single-label queries unchanged", func() {
+			_, err := sut.Resolve(newRequest("printer.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resolved).Should(Equal([]string{"printer."}))
+		})
+
+		It("should return 'deactivated'", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+})
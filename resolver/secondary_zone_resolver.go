@@ -0,0 +1,446 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	secondaryZoneResolverLogger = "secondary_zone_resolver"
+
+	// used if neither the configuration nor the SOA record define the refresh interval
+	defaultSecondaryZoneRefresh = time.Hour
+
+	// max. amount of followed CNAME records within the zone
+	maxZoneCNAMEChain = 8
+)
+
+// SecondaryZoneResolver answers the queries of zones, which are transferred periodically from the primary DNS server
+// via AXFR, authoritatively. The zone is only transferred again, if the SOA serial of the primary is newer
+type SecondaryZoneResolver struct {
+	NextResolver
+	zones []*secondaryZone
+}
+
+type secondaryZone struct {
+	name    string
+	primary string
+	refresh time.Duration
+
+	lock    sync.RWMutex
+	soa     *dns.SOA
+	records map[string][]dns.RR
+	// refreshed is the time of the last successful refresh, the zone expires after the SOA expire interval
+	refreshed time.Time
+}
+
+// NewSecondaryZoneResolver returns new resolver instance
+func NewSecondaryZoneResolver(cfg []config.SecondaryZoneConfig) ChainedResolver {
+	r := &SecondaryZoneResolver{}
+
+	for _, zoneCfg := range cfg {
+		zone := &secondaryZone{
+			name:    dns.CanonicalName(zoneCfg.Zone),
+			primary: primaryAddress(zoneCfg.Primary),
+			refresh: time.Duration(zoneCfg.Refresh),
+		}
+
+		err := zone.refreshZone()
+		if err != nil {
+			zone.logger().Warn("can't transfer zone, queries are delegated until the next refresh: ", err)
+		}
+
+		go zone.periodicRefresh(err == nil)
+
+		r.zones = append(r.zones, zone)
+	}
+
+	// the most specific zone is checked first
+	sort.Slice(r.zones, func(i, j int) bool {
+		return dns.CountLabel(r.zones[i].name) > dns.CountLabel(r.zones[j].name)
+	})
+
+	return r
+}
+
+// primaryAddress appends the default DNS port if the address has no port
+func primaryAddress(primary string) string {
+	if _, _, err := net.SplitHostPort(primary); err != nil {
+		return net.JoinHostPort(primary, "53")
+	}
+
+	return primary
+}
+
+// Configuration returns current resolver configuration
+func (r *SecondaryZoneResolver) Configuration() (result []string) {
+	if len(r.zones) == 0 {
+		return []string{"deactivated"}
+	}
+
+	for _, zone := range r.zones {
+		zone.lock.RLock()
+		serial := "not transferred"
+
+		if zone.soa != nil {
+			serial = fmt.Sprintf("serial %d", zone.soa.Serial)
+		}
+
+		if zone.isExpired() {
+			serial += ", expired"
+		}
+
+		result = append(result, fmt.Sprintf("%s = %s (%s)", zone.name, zone.primary, serial))
+		zone.lock.RUnlock()
+	}
+
+	return result
+}
+
+// Resolve answers the queries of the secondary zones, other queries are delegated to the next resolver
+func (r *SecondaryZoneResolver) Resolve(request *model.Request) (*model.Response, error) {
+	question := request.Req.Question[0]
+
+	for _, zone := range r.zones {
+		if !dns.IsSubDomain(zone.name, question.Name) {
+			continue
+		}
+
+		if response := zone.answer(request.Req); response != nil {
+			withPrefix(request.Log, secondaryZoneResolverLogger).WithField("zone", zone.name).Debug("answered from zone")
+
+			return &model.Response{
+				Res:    response,
+				RType:  model.ResponseTypeSECONDARYZONE,
+				Reason: fmt.Sprintf("SECONDARY ZONE (%s)", zone.name),
+			}, nil
+		}
+
+		break
+	}
+
+	return r.next.Resolve(request)
+}
+
+// answer returns the authoritative answer or nil, if the zone is not transferred yet or expired
+func (z *secondaryZone) answer(request *dns.Msg) *dns.Msg {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+
+	if z.soa == nil || z.isExpired() {
+		return nil
+	}
+
+	question := request.Question[0]
+	name := dns.CanonicalName(question.Name)
+
+	response := new(dns.Msg)
+	response.SetReply(request)
+	response.Authoritative = true
+
+	for i := 0; i < maxZoneCNAMEChain; i++ {
+		if ns := z.delegation(name, question.Qtype); len(ns) > 0 {
+			if len(response.Answer) == 0 {
+				z.referral(response, ns)
+
+				return response
+			}
+
+			break
+		}
+
+		rrs, found := z.lookup(name)
+		if !found {
+			if len(response.Answer) == 0 {
+				response.Rcode = dns.RcodeNameError
+			}
+
+			break
+		}
+
+		if matching := filterRRs(rrs, question.Qtype); len(matching) > 0 {
+			response.Answer = append(response.Answer, matching...)
+
+			break
+		}
+
+		cname := filterRRs(rrs, dns.TypeCNAME)
+		if len(cname) == 0 {
+			break
+		}
+
+		response.Answer = append(response.Answer, cname[0])
+
+		name = dns.CanonicalName(cname[0].(*dns.CNAME).Target)
+		if !dns.IsSubDomain(z.name, name) {
+			break
+		}
+	}
+
+	if len(response.Answer) == 0 {
+		// negative answers contain the SOA record (RFC 2308)
+		response.Ns = []dns.RR{dns.Copy(z.soa)}
+	}
+
+	return response
+}
+
+// lookup returns the records of the name or the records of the matching wildcard with the name as owner (RFC 4592).
+// Empty non-terminals are found without records
+func (z *secondaryZone) lookup(name string) ([]dns.RR, bool) {
+	if rrs, found := z.records[name]; found {
+		return rrs, true
+	}
+
+	// the wildcard of the closest encloser matches, other wildcards are hidden by the existing names
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		encloser := name[off:]
+
+		if _, found := z.records[encloser]; !found && encloser != z.name {
+			continue
+		}
+
+		wildcard, found := z.records["*."+encloser]
+		if !found {
+			return nil, false
+		}
+
+		result := make([]dns.RR, 0, len(wildcard))
+
+		for _, rr := range wildcard {
+			synthesized := dns.Copy(rr)
+			synthesized.Header().Name = name
+			result = append(result, synthesized)
+		}
+
+		return result, true
+	}
+
+	return nil, false
+}
+
+// delegation returns the NS records of the topmost zone cut at or above the name, nil if the name isn't delegated.
+// DS records of the zone cut belong to this zone (RFC 4035)
+func (z *secondaryZone) delegation(name string, qType uint16) []dns.RR {
+	offsets := dns.Split(name)
+
+	// the names below the zone apex, starting with the topmost
+	for i := len(offsets) - dns.CountLabel(z.name) - 1; i >= 0; i-- {
+		owner := name[offsets[i]:]
+
+		if owner == name && qType == dns.TypeDS {
+			break
+		}
+
+		if ns := filterRRs(z.records[owner], dns.TypeNS); len(ns) > 0 {
+			return ns
+		}
+	}
+
+	return nil
+}
+
+// referral adds the NS records of the delegation and the glue records of the name servers within the zone
+func (z *secondaryZone) referral(response *dns.Msg, ns []dns.RR) {
+	response.Authoritative = false
+	response.Ns = ns
+
+	for _, rr := range ns {
+		target := dns.CanonicalName(rr.(*dns.NS).Ns)
+		if !dns.IsSubDomain(z.name, target) {
+			continue
+		}
+
+		response.Extra = append(response.Extra, filterRRs(z.records[target], dns.TypeA)...)
+		response.Extra = append(response.Extra, filterRRs(z.records[target], dns.TypeAAAA)...)
+	}
+}
+
+// isExpired returns true, if the primary wasn't reachable for longer than the SOA expire interval (RFC 1035)
+func (z *secondaryZone) isExpired() bool {
+	return z.soa != nil && z.soa.Expire > 0 && time.Since(z.refreshed) > time.Duration(z.soa.Expire)*time.Second
+}
+
+// filterRRs returns copies of the records with the passed type
+func filterRRs(rrs []dns.RR, qType uint16) (result []dns.RR) {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qType {
+			result = append(result, dns.Copy(rr))
+		}
+	}
+
+	return result
+}
+
+func (z *secondaryZone) periodicRefresh(success bool) {
+	for {
+		time.Sleep(z.refreshInterval(success))
+
+		err := z.refreshZone()
+		util.LogOnErrorWithEntry(z.logger(), "can't refresh zone: ", err)
+
+		success = err == nil
+	}
+}
+
+// refreshInterval returns the configured or the SOA refresh interval, after a failed refresh the SOA retry interval
+func (z *secondaryZone) refreshInterval(success bool) time.Duration {
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+
+	switch {
+	case !success && z.soa != nil && z.soa.Retry > 0:
+		return time.Duration(z.soa.Retry) * time.Second
+	case z.refresh > 0:
+		return z.refresh
+	case z.soa != nil && z.soa.Refresh > 0:
+		return time.Duration(z.soa.Refresh) * time.Second
+	default:
+		return defaultSecondaryZoneRefresh
+	}
+}
+
+// refreshZone transfers the zone, if the SOA serial of the primary is newer than the serial of the transferred zone
+func (z *secondaryZone) refreshZone() error {
+	z.lock.RLock()
+	current := z.soa
+	z.lock.RUnlock()
+
+	if current != nil {
+		serial, err := z.primarySerial()
+		if err != nil {
+			return err
+		}
+
+		if !isNewerSerial(serial, current.Serial) {
+			z.logger().WithField("serial", serial).Debug("zone is up to date")
+
+			z.lock.Lock()
+			z.refreshed = time.Now()
+			z.lock.Unlock()
+
+			return nil
+		}
+	}
+
+	soa, records, err := z.transfer()
+	if err != nil {
+		return err
+	}
+
+	z.lock.Lock()
+	z.soa = soa
+	z.records = records
+	z.refreshed = time.Now()
+	z.lock.Unlock()
+
+	z.logger().WithFields(logrus.Fields{
+		"serial":  soa.Serial,
+		"records": len(records),
+	}).Info("zone transferred")
+
+	return nil
+}
+
+// primarySerial returns the SOA serial of the zone on the primary
+func (z *secondaryZone) primarySerial() (uint32, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(z.name, dns.TypeSOA)
+
+	client := &dns.Client{Net: "tcp"}
+
+	response, _, err := client.Exchange(msg, z.primary)
+	if err != nil {
+		return 0, fmt.Errorf("can't query SOA: %w", err)
+	}
+
+	for _, rr := range response.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+
+	return 0, fmt.Errorf("primary returned no SOA (%s)", dns.RcodeToString[response.Rcode])
+}
+
+// transfer returns the SOA and the records of the zone by name via AXFR
+func (z *secondaryZone) transfer() (*dns.SOA, map[string][]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetAxfr(z.name)
+
+	envelopes, err := new(dns.Transfer).In(msg, z.primary)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't start zone transfer: %w", err)
+	}
+
+	var soa *dns.SOA
+
+	records := make(map[string][]dns.RR)
+
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, nil, fmt.Errorf("zone transfer failed: %w", envelope.Error)
+		}
+
+		for _, rr := range envelope.RR {
+			if s, ok := rr.(*dns.SOA); ok {
+				// the transfer starts and ends with the SOA record
+				if soa != nil {
+					continue
+				}
+
+				soa = s
+			}
+
+			name := dns.CanonicalName(rr.Header().Name)
+			records[name] = append(records[name], rr)
+		}
+	}
+
+	if soa == nil {
+		return nil, nil, errors.New("zone transfer contains no SOA record")
+	}
+
+	addEmptyNonTerminals(records, z.name)
+
+	return soa, records, nil
+}
+
+// addEmptyNonTerminals adds the names without records between the records and the zone apex,
+// these names exist and are answered with NODATA instead of NXDOMAIN (RFC 8020)
+func addEmptyNonTerminals(records map[string][]dns.RR, zone string) {
+	for name := range records {
+		for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+			parent := name[off:]
+			if !dns.IsSubDomain(zone, parent) {
+				break
+			}
+
+			if _, found := records[parent]; !found {
+				records[parent] = nil
+			}
+		}
+	}
+}
+
+func (z *secondaryZone) logger() *logrus.Entry {
+	return log.PrefixedLog(secondaryZoneResolverLogger).WithField("zone", z.name)
+}
+
+// isNewerSerial compares the serials with serial number arithmetic (RFC 1982)
+func isNewerSerial(serial, current uint32) bool {
+	const half = 1 << 31
+
+	return serial != current && serial-current < half
+}
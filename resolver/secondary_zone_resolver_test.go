@@ -0,0 +1,264 @@
+package resolver
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("SecondaryZoneResolver", func() {
+	var (
+		sut       *SecondaryZoneResolver
+		m         *resolverMock
+		primary   string
+		serial    uint32
+		transfers int32
+	)
+
+	zoneRecords := func() []dns.RR {
+		var result []dns.RR
+
+		for _, record := range []string{
+			"home.lan. 3600 IN SOA ns.home.lan. admin.home.lan. 1 3600 600 86400 300",
+			"home.lan. 3600 IN NS ns.home.lan.",
+			"ns.home.lan. 3600 IN A 192.168.178.1",
+			"NAS.home.lan. 3600 IN A 192.168.178.2",
+			"www.home.lan. 3600 IN CNAME web.home.lan.",
+			"web.home.lan. 3600 IN CNAME nas.home.lan.",
+			"ext.home.lan. 3600 IN CNAME example.com.",
+			"*.dyn.home.lan. 3600 IN A 192.168.178.10",
+			"host.dyn.home.lan. 3600 IN A 192.168.178.11",
+			"printer.office.home.lan. 3600 IN A 192.168.178.3",
+			"lab.home.lan. 3600 IN NS ns.lab.home.lan.",
+			"lab.home.lan. 3600 IN DS 60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			"ns.lab.home.lan. 3600 IN A 192.168.178.4",
+		} {
+			rr, err := dns.NewRR(record)
+			Expect(err).Should(Succeed())
+			result = append(result, rr)
+		}
+
+		result[0].(*dns.SOA).Serial = atomic.LoadUint32(&serial)
+
+		return result
+	}
+
+	BeforeEach(func() {
+		atomic.StoreUint32(&serial, 1)
+		atomic.StoreInt32(&transfers, 0)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).Should(Succeed())
+
+		handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(req)
+
+			records := zoneRecords()
+
+			switch req.Question[0].Qtype {
+			case dns.TypeAXFR:
+				atomic.AddInt32(&transfers, 1)
+				response.Answer = append(records, records[0])
+			case dns.TypeSOA:
+				response.Answer = records[:1]
+			}
+
+			_ = w.WriteMsg(response)
+		})
+
+		server := &dns.Server{Listener: ln, Handler: handler}
+
+		go func() {
+			_ = server.ActivateAndServe()
+		}()
+
+		DeferCleanup(server.Shutdown)
+
+		primary = ln.Addr().String()
+	})
+
+	JustBeforeEach(func() {
+		sut = NewSecondaryZoneResolver([]config.SecondaryZoneConfig{
+			{Zone: "home.lan", Primary: primary, Refresh: config.Duration(time.Hour)},
+		}).(*SecondaryZoneResolver)
+
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	When("the zone is transferred", func() {
+		It("should answer authoritatively", func() {
+			resp, err := sut.Resolve(newRequest("nas.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeSECONDARYZONE))
+			Expect(resp.Reason).Should(Equal("SECONDARY ZONE (home.lan.)"))
+			Expect(resp.Res.Authoritative).Should(BeTrue())
+			Expect(resp.Res.Answer).Should(BeDNSRecord("NAS.home.lan.", dns.TypeA, 3600, "192.168.178.2"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should follow CNAME chains within the zone", func() {
+			resp, err := sut.Resolve(newRequest("www.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Answer).Should(HaveLen(3))
+			Expect(resp.Res.Answer[2]).Should(BeDNSRecord("NAS.home.lan.", dns.TypeA, 3600, "192.168.178.2"))
+
+			resp, err = sut.Resolve(newRequest("ext.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Answer).Should(HaveLen(1))
+		})
+
+		It("should answer NXDOMAIN and NODATA with the SOA record", func() {
+			resp, err := sut.Resolve(newRequest("unknown.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(resp.Res.Ns).Should(HaveLen(1))
+
+			resp, err = sut.Resolve(newRequest("nas.home.lan.", dns.TypeAAAA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Answer).Should(BeEmpty())
+			Expect(resp.Res.Ns[0].Header().Rrtype).Should(Equal(dns.TypeSOA))
+		})
+
+		It("should answer with the records of the matching wildcard", func() {
+			resp, err := sut.Resolve(newRequest("pc.dyn.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Answer).Should(BeDNSRecord("pc.dyn.home.lan.", dns.TypeA, 3600, "192.168.178.10"))
+
+			By("existing names are not matched", func() {
+				resp, err = sut.Resolve(newRequest("host.dyn.home.lan.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("host.dyn.home.lan.", dns.TypeA, 3600, "192.168.178.11"))
+
+				resp, err = sut.Resolve(newRequest("sub.host.dyn.home.lan.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+			})
+
+			By("wildcard without records of the type", func() {
+				resp, err = sut.Resolve(newRequest("pc.dyn.home.lan.", dns.TypeAAAA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Res.Answer).Should(BeEmpty())
+			})
+		})
+
+		It("should answer empty non-terminals with NODATA", func() {
+			resp, err := sut.Resolve(newRequest("office.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Answer).Should(BeEmpty())
+			Expect(resp.Res.Ns[0].Header().Rrtype).Should(Equal(dns.TypeSOA))
+		})
+
+		It("should answer queries of delegated names with a referral", func() {
+			resp, err := sut.Resolve(newRequest("host.lab.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(ResponseTypeSECONDARYZONE))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Authoritative).Should(BeFalse())
+			Expect(resp.Res.Answer).Should(BeEmpty())
+			Expect(resp.Res.Ns).Should(HaveLen(1))
+			Expect(resp.Res.Ns[0].(*dns.NS).Ns).Should(Equal("ns.lab.home.lan."))
+			Expect(resp.Res.Extra).Should(BeDNSRecord("ns.lab.home.lan.", dns.TypeA, 3600, "192.168.178.4"))
+
+			By("DS records of the zone cut are answered authoritatively", func() {
+				resp, err = sut.Resolve(newRequest("lab.home.lan.", dns.TypeDS))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Authoritative).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(resp.Res.Answer[0].Header().Rrtype).Should(Equal(dns.TypeDS))
+			})
+		})
+
+		It("should delegate queries of other zones", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+
+		It("should return configuration", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"home.lan. = " + primary + " (serial 1)"}))
+		})
+	})
+
+	When("the zone is refreshed", func() {
+		It("should only transfer the zone if the serial of the primary is newer", func() {
+			zone := sut.zones[0]
+
+			Expect(zone.refreshZone()).Should(Succeed())
+			Expect(atomic.LoadInt32(&transfers)).Should(BeEquivalentTo(1))
+
+			atomic.StoreUint32(&serial, 2)
+			Expect(zone.refreshZone()).Should(Succeed())
+			Expect(atomic.LoadInt32(&transfers)).Should(BeEquivalentTo(2))
+			Expect(sut.Configuration()).Should(ContainElement(ContainSubstring("serial 2")))
+		})
+
+		It("should use the SOA intervals without configured refresh", func() {
+			zone := &secondaryZone{soa: &dns.SOA{Refresh: 3600, Retry: 600}}
+
+			Expect(zone.refreshInterval(true)).Should(Equal(time.Hour))
+			Expect(zone.refreshInterval(false)).Should(Equal(10 * time.Minute))
+		})
+	})
+
+	When("the primary isn't reachable longer than the SOA expire interval", func() {
+		It("should delegate the queries", func() {
+			zone := sut.zones[0]
+
+			zone.lock.Lock()
+			zone.refreshed = time.Now().Add(-25 * time.Hour)
+			zone.lock.Unlock()
+
+			resp, err := sut.Resolve(newRequest("nas.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(sut.Configuration()).Should(Equal([]string{"home.lan. = " + primary + " (serial 1, expired)"}))
+
+			By("a successful refresh serves the zone again", func() {
+				Expect(zone.refreshZone()).Should(Succeed())
+
+				resp, err = sut.Resolve(newRequest("nas.home.lan.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(ResponseTypeSECONDARYZONE))
+			})
+		})
+	})
+
+	When("the primary is not reachable", func() {
+		BeforeEach(func() {
+			primary = "127.0.0.1:1"
+		})
+
+		It("should delegate the queries", func() {
+			resp, err := sut.Resolve(newRequest("nas.home.lan.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(sut.Configuration()).Should(Equal([]string{"home.lan. = 127.0.0.1:1 (not transferred)"}))
+		})
+	})
+
+	It("should compare serials with serial number arithmetic", func() {
+		Expect(isNewerSerial(2, 1)).Should(BeTrue())
+		Expect(isNewerSerial(1, 1)).Should(BeFalse())
+		Expect(isNewerSerial(1, 2)).Should(BeFalse())
+		Expect(isNewerSerial(1, 0xFFFFFFFF)).Should(BeTrue())
+	})
+
+	It("should append the default port to the primary", func() {
+		Expect(primaryAddress("192.168.178.1")).Should(Equal("192.168.178.1:53"))
+		Expect(primaryAddress("192.168.178.1:5353")).Should(Equal("192.168.178.1:5353"))
+	})
+})
@@ -0,0 +1,91 @@
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+// UpstreamAnswerOrderResolver reorders the A/AAAA records in the responses of the next resolvers
+type UpstreamAnswerOrderResolver struct {
+	NextResolver
+	order config.UpstreamAnswerOrder
+}
+
+// NewUpstreamAnswerOrderResolver returns new resolver instance
+func NewUpstreamAnswerOrderResolver(order config.UpstreamAnswerOrder) ChainedResolver {
+	return &UpstreamAnswerOrderResolver{order: order}
+}
+
+// Configuration returns current resolver configuration
+func (r *UpstreamAnswerOrderResolver) Configuration() (result []string) {
+	if r.order == config.UpstreamAnswerOrderKeep {
+		return []string{"deactivated"}
+	}
+
+	return []string{fmt.Sprintf("order = %s", r.order)}
+}
+
+// Resolve passes the request to the next resolver and reorders the address records of the answer
+func (r *UpstreamAnswerOrderResolver) Resolve(request *model.Request) (*model.Response, error) {
+	resp, err := r.next.Resolve(request)
+
+	if err == nil && r.order != config.UpstreamAnswerOrderKeep && resp.Res != nil {
+		r.orderAnswer(resp.Res.Answer)
+	}
+
+	return resp, err
+}
+
+// orderAnswer reorders each set of consecutive A/AAAA records with the same name in place, other records
+// (e.g. CNAME) keep their position
+func (r *UpstreamAnswerOrderResolver) orderAnswer(answer []dns.RR) {
+	for start := 0; start < len(answer); {
+		end := start + 1
+		for end < len(answer) && isSameRRSet(answer[start], answer[end]) {
+			end++
+		}
+
+		if end-start > 1 && recordIP(answer[start]) != nil {
+			r.orderRRSet(answer[start:end])
+		}
+
+		start = end
+	}
+}
+
+func (r *UpstreamAnswerOrderResolver) orderRRSet(rrs []dns.RR) {
+	switch r.order {
+	case config.UpstreamAnswerOrderShuffle:
+		rand.Shuffle(len(rrs), func(i, j int) {
+			rrs[i], rrs[j] = rrs[j], rrs[i]
+		})
+	case config.UpstreamAnswerOrderSort:
+		sort.SliceStable(rrs, func(i, j int) bool {
+			return bytes.Compare(recordIP(rrs[i]).To16(), recordIP(rrs[j]).To16()) < 0
+		})
+	case config.UpstreamAnswerOrderKeep:
+	}
+}
+
+func isSameRRSet(a, b dns.RR) bool {
+	return a.Header().Rrtype == b.Header().Rrtype && a.Header().Name == b.Header().Name
+}
+
+// recordIP returns the address of A/AAAA records, nil for other records
+func recordIP(rr dns.RR) net.IP {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A
+	case *dns.AAAA:
+		return v.AAAA
+	}
+
+	return nil
+}
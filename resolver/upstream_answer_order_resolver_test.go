@@ -0,0 +1,128 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("UpstreamAnswerOrderResolver", func() {
+	var (
+		sut   ChainedResolver
+		order config.UpstreamAnswerOrder
+		m     *resolverMock
+	)
+
+	// upstreamAnswer creates the answer with a CNAME record and the given A records
+	upstreamAnswer := func() *dns.Msg {
+		msg := new(dns.Msg)
+
+		for _, rr := range []string{
+			"example.com. 300 IN CNAME cdn.example.com.",
+			"cdn.example.com. 300 IN A 192.168.178.3",
+			"cdn.example.com. 300 IN A 10.0.0.2",
+			"cdn.example.com. 300 IN A 192.168.178.1",
+			"cdn.example.com. 300 IN A 10.0.0.1",
+			"cdn.example.com. 300 IN A 172.16.0.1",
+		} {
+			record, err := dns.NewRR(rr)
+			Expect(err).Should(Succeed())
+
+			msg.Answer = append(msg.Answer, record)
+		}
+
+		return msg
+	}
+
+	answerIPs := func(answer []dns.RR) (result []string) {
+		for _, rr := range answer {
+			if a, ok := rr.(*dns.A); ok {
+				result = append(result, a.A.String())
+			}
+		}
+
+		return result
+	}
+
+	JustBeforeEach(func() {
+		sut = NewUpstreamAnswerOrderResolver(order)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: upstreamAnswer(), RType: ResponseTypeRESOLVED}, nil)
+		sut.Next(m)
+	})
+
+	When("order is keep", func() {
+		BeforeEach(func() {
+			order = config.UpstreamAnswerOrderKeep
+		})
+		It("should return the upstream order", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+
+			Expect(answerIPs(resp.Res.Answer)).Should(Equal([]string{
+				"192.168.178.3", "10.0.0.2", "192.168.178.1", "10.0.0.1", "172.16.0.1",
+			}))
+		})
+	})
+
+	When("order is sort", func() {
+		BeforeEach(func() {
+			order = config.UpstreamAnswerOrderSort
+		})
+		It("should sort the addresses and keep the CNAME on first position", func() {
+			resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+
+			Expect(resp.Res.Answer[0]).Should(BeAssignableToTypeOf(&dns.CNAME{}))
+			Expect(answerIPs(resp.Res.Answer)).Should(Equal([]string{
+				"10.0.0.1", "10.0.0.2", "172.16.0.1", "192.168.178.1", "192.168.178.3",
+			}))
+		})
+	})
+
+	When("order is shuffle", func() {
+		BeforeEach(func() {
+			order = config.UpstreamAnswerOrderShuffle
+		})
+		It("should return all addresses in different orders and keep the CNAME on first position", func() {
+			orders := make(map[string]bool)
+
+			for i := 0; i < 20; i++ {
+				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+
+				Expect(resp.Res.Answer[0]).Should(BeAssignableToTypeOf(&dns.CNAME{}))
+
+				ips := answerIPs(resp.Res.Answer)
+				Expect(ips).Should(ConsistOf("192.168.178.3", "10.0.0.2", "192.168.178.1", "10.0.0.1", "172.16.0.1"))
+
+				orders[ips[0]+ips[1]+ips[2]+ips[3]+ips[4]] = true
+			}
+
+			Expect(len(orders)).Should(BeNumerically(">", 1))
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("resolver is enabled", func() {
+			BeforeEach(func() {
+				order = config.UpstreamAnswerOrderShuffle
+			})
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"order = shuffle"}))
+			})
+		})
+
+		When("resolver is disabled", func() {
+			BeforeEach(func() {
+				order = config.UpstreamAnswerOrderKeep
+			})
+			It("should return 'deactivated'", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+			})
+		})
+	})
+})
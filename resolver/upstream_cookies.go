@@ -0,0 +1,177 @@
+package resolver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// client cookie has a fixed size of 8 bytes (16 hex characters)
+	clientCookieLen = 8
+
+	// EDNS0 buffer size, if the OPT record for the cookie is added by blocky
+	cookieEdnsUDPSize = 1232
+
+	// cookies are sent again after the backoff, if the upstream didn't support them. The backoff doubles with each
+	// failure up to the max backoff
+	cookieRetryBackoff    = time.Minute
+	cookieRetryMaxBackoff = time.Hour
+)
+
+// upstreamCookies handles the EDNS0 cookies (RFC 7873) for one upstream: a random client cookie
+// is sent with each query and the server cookie from the last response is cached
+type upstreamCookies struct {
+	lock         sync.RWMutex
+	clientCookie string
+	serverCookie string
+	// no cookies are sent until disabledUntil, if the upstream didn't support them
+	disabledUntil time.Time
+	backoff       time.Duration
+	now           func() time.Time
+}
+
+func newUpstreamCookies() *upstreamCookies {
+	b := make([]byte, clientCookieLen)
+
+	// error of crypto/rand is not expected, a zero cookie is still valid
+	_, _ = rand.Read(b)
+
+	return &upstreamCookies{clientCookie: hex.EncodeToString(b), now: time.Now}
+}
+
+// prepareQuery replaces the cookie of the client with the own cookie. Returns false if no cookie was added,
+// because the upstream didn't support EDNS0 or cookies within the backoff
+func (c *upstreamCookies) prepareQuery(query *dns.Msg) bool {
+	opt := query.IsEdns0()
+	if opt != nil {
+		// the cookie of the client belongs to the connection between client and blocky
+		removeCookieOption(opt)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.now().Before(c.disabledUntil) {
+		return false
+	}
+
+	if opt == nil {
+		query.SetEdns0(cookieEdnsUDPSize, false)
+		opt = query.IsEdns0()
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: c.clientCookie + c.serverCookie,
+	})
+
+	return true
+}
+
+// processResponse verifies the client cookie in the response and stores the server cookie.
+// Returns true if the query should be repeated (new server cookie or missing EDNS0 support)
+func (c *upstreamCookies) processResponse(response *dns.Msg) (retry bool, err error) {
+	opt := response.IsEdns0()
+
+	if opt == nil {
+		if response.Rcode == dns.RcodeFormatError || response.Rcode == dns.RcodeNotImplemented {
+			// upstream doesn't understand EDNS0 -> don't send cookies until the backoff is over
+			c.disable()
+
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	cookie := findCookieOption(opt)
+	if cookie == nil {
+		if response.Rcode == dns.RcodeBadCookie {
+			c.disable()
+
+			return true, nil
+		}
+
+		// upstream doesn't support cookies, response is accepted
+		return false, nil
+	}
+
+	if len(cookie.Cookie) < 2*clientCookieLen || !strings.EqualFold(cookie.Cookie[:2*clientCookieLen], c.clientCookie) {
+		return false, errors.New("response contains invalid client cookie")
+	}
+
+	c.lock.Lock()
+	c.serverCookie = cookie.Cookie[2*clientCookieLen:]
+	c.backoff = 0
+	c.lock.Unlock()
+
+	return response.Rcode == dns.RcodeBadCookie, nil
+}
+
+// disable stops sending cookies for the backoff, the backoff is doubled if the cookies fail again afterwards
+func (c *upstreamCookies) disable() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch {
+	case c.backoff == 0:
+		c.backoff = cookieRetryBackoff
+	case c.backoff < cookieRetryMaxBackoff:
+		c.backoff *= 2
+		if c.backoff > cookieRetryMaxBackoff {
+			c.backoff = cookieRetryMaxBackoff
+		}
+	}
+
+	c.disabledUntil = c.now().Add(c.backoff)
+}
+
+// removeCookie removes the cookie from the response. The OPT record is removed completely
+// if the client query didn't contain it
+func removeCookie(response *dns.Msg, clientUsesEdns bool) {
+	if clientUsesEdns {
+		if opt := response.IsEdns0(); opt != nil {
+			removeCookieOption(opt)
+		}
+
+		return
+	}
+
+	extra := response.Extra[:0]
+
+	for _, rr := range response.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+
+	response.Extra = extra
+}
+
+func findCookieOption(opt *dns.OPT) *dns.EDNS0_COOKIE {
+	for _, o := range opt.Option {
+		if cookie, ok := o.(*dns.EDNS0_COOKIE); ok {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func removeCookieOption(opt *dns.OPT) {
+	options := opt.Option[:0]
+
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0COOKIE {
+			options = append(options, o)
+		}
+	}
+
+	opt.Option = options
+}
@@ -0,0 +1,194 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upstream cookies", func() {
+	var (
+		sut   *upstreamCookies
+		query *dns.Msg
+	)
+
+	const serverCookie = "0102030405060708090a0b0c0d0e0f10"
+
+	BeforeEach(func() {
+		sut = newUpstreamCookies()
+		query = util.NewMsgWithQuestion("example.com.", dns.TypeA)
+	})
+
+	responseWithCookie := func(cookie string, rcode int) *dns.Msg {
+		response := new(dns.Msg)
+		response.SetRcode(query, rcode)
+		response.SetEdns0(cookieEdnsUDPSize, false)
+
+		opt := response.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: cookie})
+
+		return response
+	}
+
+	sentCookie := func() string {
+		opt := query.IsEdns0()
+		Expect(opt).ShouldNot(BeNil())
+
+		cookie := findCookieOption(opt)
+		Expect(cookie).ShouldNot(BeNil())
+
+		return cookie.Cookie
+	}
+
+	Describe("Client cookie", func() {
+		It("should be random", func() {
+			Expect(sut.clientCookie).Should(HaveLen(2 * clientCookieLen))
+			Expect(sut.clientCookie).ShouldNot(Equal(newUpstreamCookies().clientCookie))
+		})
+	})
+
+	Describe("Preparing the query", func() {
+		When("query doesn't contain an OPT record", func() {
+			It("should add the OPT record with the client cookie", func() {
+				Expect(sut.prepareQuery(query)).Should(BeTrue())
+				Expect(query.IsEdns0().UDPSize()).Should(Equal(uint16(cookieEdnsUDPSize)))
+				Expect(sentCookie()).Should(Equal(sut.clientCookie))
+			})
+		})
+		When("query contains a cookie of the client", func() {
+			It("should replace it with the own cookie and keep other options", func() {
+				query.SetEdns0(4096, false)
+				opt := query.IsEdns0()
+				opt.Option = append(opt.Option,
+					&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "aaaaaaaaaaaaaaaa"},
+					&dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+				Expect(sut.prepareQuery(query)).Should(BeTrue())
+				Expect(query.IsEdns0().UDPSize()).Should(Equal(uint16(4096)))
+				Expect(query.IsEdns0().Option).Should(HaveLen(2))
+				Expect(sentCookie()).Should(Equal(sut.clientCookie))
+			})
+		})
+		When("server cookie is known", func() {
+			It("should send client and server cookie", func() {
+				sut.serverCookie = serverCookie
+
+				Expect(sut.prepareQuery(query)).Should(BeTrue())
+				Expect(sentCookie()).Should(Equal(sut.clientCookie + serverCookie))
+			})
+		})
+		When("upstream doesn't support cookies", func() {
+			It("should not add a cookie, but remove the cookie of the client", func() {
+				sut.disable()
+				query.SetEdns0(4096, false)
+				opt := query.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "aaaaaaaaaaaaaaaa"})
+
+				Expect(sut.prepareQuery(query)).Should(BeFalse())
+				Expect(query.IsEdns0().Option).Should(BeEmpty())
+			})
+			It("should add the cookie again after the backoff", func() {
+				now := time.Now()
+				sut.now = func() time.Time { return now }
+				sut.disable()
+
+				now = now.Add(cookieRetryBackoff)
+				Expect(sut.prepareQuery(query)).Should(BeTrue())
+				Expect(sentCookie()).Should(Equal(sut.clientCookie))
+			})
+			It("should double the backoff up to the max backoff until a cookie is received", func() {
+				sut.disable()
+				Expect(sut.backoff).Should(Equal(cookieRetryBackoff))
+				sut.disable()
+				Expect(sut.backoff).Should(Equal(2 * cookieRetryBackoff))
+
+				for i := 0; i < 10; i++ {
+					sut.disable()
+				}
+				Expect(sut.backoff).Should(Equal(cookieRetryMaxBackoff))
+
+				_, err := sut.processResponse(responseWithCookie(sut.clientCookie+serverCookie, dns.RcodeSuccess))
+				Expect(err).Should(Succeed())
+				Expect(sut.backoff).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Processing the response", func() {
+		When("response contains the client cookie and a server cookie", func() {
+			It("should store the server cookie", func() {
+				retry, err := sut.processResponse(responseWithCookie(sut.clientCookie+serverCookie, dns.RcodeSuccess))
+				Expect(err).Should(Succeed())
+				Expect(retry).Should(BeFalse())
+				Expect(sut.serverCookie).Should(Equal(serverCookie))
+			})
+		})
+		When("response contains another client cookie", func() {
+			It("should return error", func() {
+				_, err := sut.processResponse(responseWithCookie("aaaaaaaaaaaaaaaa"+serverCookie, dns.RcodeSuccess))
+				Expect(err).Should(MatchError("response contains invalid client cookie"))
+				Expect(sut.serverCookie).Should(BeEmpty())
+			})
+		})
+		When("response contains a too short cookie", func() {
+			It("should return error", func() {
+				_, err := sut.processResponse(responseWithCookie("aaaa", dns.RcodeSuccess))
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		When("upstream returns BADCOOKIE with a new server cookie", func() {
+			It("should store the server cookie and request a retry", func() {
+				retry, err := sut.processResponse(responseWithCookie(sut.clientCookie+serverCookie, dns.RcodeBadCookie))
+				Expect(err).Should(Succeed())
+				Expect(retry).Should(BeTrue())
+				Expect(sut.serverCookie).Should(Equal(serverCookie))
+			})
+		})
+		When("response contains OPT record without cookie", func() {
+			It("should accept the response", func() {
+				response := new(dns.Msg)
+				response.SetRcode(query, dns.RcodeSuccess)
+				response.SetEdns0(cookieEdnsUDPSize, false)
+
+				retry, err := sut.processResponse(response)
+				Expect(err).Should(Succeed())
+				Expect(retry).Should(BeFalse())
+				Expect(sut.prepareQuery(query)).Should(BeTrue())
+			})
+		})
+		When("upstream doesn't understand EDNS0", func() {
+			It("should request a retry without cookie", func() {
+				response := new(dns.Msg)
+				response.SetRcode(query, dns.RcodeFormatError)
+
+				retry, err := sut.processResponse(response)
+				Expect(err).Should(Succeed())
+				Expect(retry).Should(BeTrue())
+				Expect(sut.prepareQuery(util.NewMsgWithQuestion("example.com.", dns.TypeA))).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("Removing the cookie from the response", func() {
+		When("client query contained an OPT record", func() {
+			It("should only remove the cookie option", func() {
+				response := responseWithCookie(sut.clientCookie+serverCookie, dns.RcodeSuccess)
+
+				removeCookie(response, true)
+				Expect(response.IsEdns0()).ShouldNot(BeNil())
+				Expect(response.IsEdns0().Option).Should(BeEmpty())
+			})
+		})
+		When("client query didn't contain an OPT record", func() {
+			It("should remove the OPT record", func() {
+				response := responseWithCookie(sut.clientCookie+serverCookie, dns.RcodeSuccess)
+
+				removeCookie(response, false)
+				Expect(response.IsEdns0()).Should(BeNil())
+			})
+		})
+	})
+})
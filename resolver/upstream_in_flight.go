@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// upstreamInFlight counts the queries in flight to one upstream DNS server and limits them, if a max is configured
+type upstreamInFlight struct {
+	upstream    string
+	slots       chan struct{}
+	waitTimeout time.Duration
+	gauge       prometheus.Gauge
+}
+
+// the gauge is changed directly for each query, events would be published out of order. It is global, because a
+// collector can be registered only once
+// nolint:gochecknoglobals
+var upstreamInFlightGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "blocky_upstream_in_flight_queries",
+		Help: "Number of queries in flight to the upstream",
+	}, []string{"upstream"},
+)
+
+// inFlight returns the shared counter of the upstream
+func (s *UpstreamSettings) inFlight(upstream string) *upstreamInFlight {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if f, found := s.inFlights[upstream]; found {
+		return f
+	}
+
+	cfg := s.limit
+
+	metrics.RegisterMetric(upstreamInFlightGauge)
+
+	f := &upstreamInFlight{
+		upstream:    upstream,
+		waitTimeout: time.Duration(cfg.WaitTimeout),
+		gauge:       upstreamInFlightGauge.WithLabelValues(upstream),
+	}
+
+	if cfg.MaxConcurrentPerUpstream > 0 {
+		f.slots = make(chan struct{}, cfg.MaxConcurrentPerUpstream)
+	}
+
+	s.inFlights[upstream] = f
+
+	return f
+}
+
+// acquire waits for a free slot up to the wait timeout. Fails if no slot is available, so the query can be answered
+// by another upstream
+func (f *upstreamInFlight) acquire() error {
+	if f.slots != nil && !f.waitForSlot() {
+		evt.Bus().Publish(evt.UpstreamInFlightRejected, f.upstream)
+
+		return fmt.Errorf("max concurrent queries to upstream '%s' reached", f.upstream)
+	}
+
+	f.gauge.Inc()
+
+	return nil
+}
+
+func (f *upstreamInFlight) waitForSlot() bool {
+	select {
+	case f.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(f.waitTimeout)
+	defer timer.Stop()
+
+	select {
+	case f.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (f *upstreamInFlight) release() {
+	f.gauge.Dec()
+
+	if f.slots != nil {
+		<-f.slots
+	}
+}
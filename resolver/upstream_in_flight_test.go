@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("upstreamInFlight", func() {
+	cfg := config.UpstreamLimitConfig{MaxConcurrentPerUpstream: 2, WaitTimeout: config.Duration(50 * time.Millisecond)}
+
+	newInFlight := func(upstream string, cfg config.UpstreamLimitConfig) *upstreamInFlight {
+		return NewUpstreamSettings(&config.Config{UpstreamLimit: cfg}).inFlight(upstream)
+	}
+
+	It("should limit the queries in flight", func() {
+		sut := newInFlight("192.0.2.1:53", cfg)
+
+		Expect(sut.acquire()).Should(Succeed())
+		Expect(sut.acquire()).Should(Succeed())
+		Expect(testutil.ToFloat64(sut.gauge)).Should(BeEquivalentTo(2))
+
+		start := time.Now()
+		Expect(sut.acquire()).Should(MatchError("max concurrent queries to upstream '192.0.2.1:53' reached"))
+		Expect(time.Since(start)).Should(BeNumerically(">=", 50*time.Millisecond))
+
+		sut.release()
+		Expect(sut.acquire()).Should(Succeed())
+
+		sut.release()
+		sut.release()
+		Expect(testutil.ToFloat64(sut.gauge)).Should(BeZero())
+	})
+
+	It("should wait for a free slot up to the wait timeout", func() {
+		sut := newInFlight("192.0.2.2:53", config.UpstreamLimitConfig{
+			MaxConcurrentPerUpstream: 1, WaitTimeout: config.Duration(time.Second),
+		})
+
+		Expect(sut.acquire()).Should(Succeed())
+
+		time.AfterFunc(20*time.Millisecond, sut.release)
+
+		Expect(sut.acquire()).Should(Succeed())
+		sut.release()
+	})
+
+	It("should share the counter of the upstream", func() {
+		settings := NewUpstreamSettings(&config.Config{UpstreamLimit: cfg})
+		sut := settings.inFlight("192.0.2.3:53")
+
+		Expect(settings.inFlight("192.0.2.3:53")).Should(BeIdenticalTo(sut))
+		Expect(settings.inFlight("192.0.2.4:53")).ShouldNot(BeIdenticalTo(sut))
+		Expect(newInFlight("192.0.2.3:53", cfg)).ShouldNot(BeIdenticalTo(sut))
+	})
+
+	It("should only count the queries without limit", func() {
+		sut := newInFlight("192.0.2.5:53", config.UpstreamLimitConfig{})
+
+		for i := 0; i < 10; i++ {
+			Expect(sut.acquire()).Should(Succeed())
+		}
+
+		Expect(testutil.ToFloat64(sut.gauge)).Should(BeEquivalentTo(10))
+	})
+})
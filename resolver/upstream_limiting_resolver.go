@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+)
+
+const upstreamLimitingResolverLogger = "upstream_limiting_resolver"
+
+// UpstreamLimitingResolver limits the number of concurrent upstream resolutions. Requests exceeding the limit
+// wait for a free slot up to the wait timeout and get SERVFAIL afterwards
+type UpstreamLimitingResolver struct {
+	NextResolver
+	slots       chan struct{}
+	waitTimeout time.Duration
+	// the limit per upstream is enforced by the upstream resolvers
+	maxConcurrentPerUpstream uint
+}
+
+// NewUpstreamLimitingResolver returns new resolver instance
+func NewUpstreamLimitingResolver(cfg config.UpstreamLimitConfig) ChainedResolver {
+	r := &UpstreamLimitingResolver{
+		waitTimeout:              time.Duration(cfg.WaitTimeout),
+		maxConcurrentPerUpstream: cfg.MaxConcurrentPerUpstream,
+	}
+
+	if cfg.MaxConcurrent > 0 {
+		r.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *UpstreamLimitingResolver) Configuration() (result []string) {
+	if r.slots == nil && r.maxConcurrentPerUpstream == 0 {
+		return []string{"deactivated"}
+	}
+
+	result = append(result, fmt.Sprintf("maxConcurrent = %d", cap(r.slots)))
+
+	if r.maxConcurrentPerUpstream > 0 {
+		result = append(result, fmt.Sprintf("maxConcurrentPerUpstream = %d", r.maxConcurrentPerUpstream))
+	}
+
+	result = append(result, fmt.Sprintf("waitTimeout = %s", r.waitTimeout))
+
+	return result
+}
+
+// Resolve passes the request to the next resolver, if a free slot is available
+func (r *UpstreamLimitingResolver) Resolve(request *model.Request) (*model.Response, error) {
+	if r.slots == nil {
+		return r.next.Resolve(request)
+	}
+
+	logger := withPrefix(request.Log, upstreamLimitingResolverLogger)
+
+	if !r.acquire() {
+		logger.Debugf("upstream concurrency limit of %d reached, rejecting request", cap(r.slots))
+
+		response := new(dns.Msg)
+		response.SetRcode(request.Req, dns.RcodeServerFailure)
+
+		return &model.Response{Res: response, RType: model.ResponseTypeRESOLVED, Reason: "UPSTREAM LIMIT EXCEEDED"}, nil
+	}
+
+	defer r.release()
+
+	logger.WithField("resolver", Name(r.next)).Trace("go to next resolver")
+
+	return r.next.Resolve(request)
+}
+
+// acquire waits for a free slot up to the wait timeout, returns false if no slot is available
+func (r *UpstreamLimitingResolver) acquire() bool {
+	select {
+	case r.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	evt.Bus().Publish(evt.UpstreamLimitQueued)
+
+	timer := time.NewTimer(r.waitTimeout)
+	defer timer.Stop()
+
+	select {
+	case r.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		evt.Bus().Publish(evt.UpstreamLimitRejected)
+
+		return false
+	}
+}
+
+func (r *UpstreamLimitingResolver) release() {
+	<-r.slots
+}
@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("UpstreamLimitingResolver", func() {
+	var (
+		sut     *UpstreamLimitingResolver
+		cfg     config.UpstreamLimitConfig
+		m       *resolverMock
+		release chan struct{}
+		started chan struct{}
+	)
+
+	BeforeEach(func() {
+		cfg = config.UpstreamLimitConfig{MaxConcurrent: 1, WaitTimeout: config.Duration(50 * time.Millisecond)}
+		release = make(chan struct{})
+		started = make(chan struct{}, 10)
+	})
+
+	JustBeforeEach(func() {
+		sut = NewUpstreamLimitingResolver(cfg).(*UpstreamLimitingResolver)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Run(func(_ mock.Arguments) {
+			started <- struct{}{}
+			<-release
+		}).Return(&Response{Res: new(dns.Msg), RType: ResponseTypeRESOLVED, Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+	})
+
+	// blockSlot starts a request, which holds the only slot until release is closed
+	blockSlot := func() *sync.WaitGroup {
+		var wg sync.WaitGroup
+
+		wg.Add(1)
+
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+
+			resp, err := sut.Resolve(newRequest("first.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		}()
+
+		Eventually(started).Should(Receive())
+
+		return &wg
+	}
+
+	When("limit is reached and no slot becomes free", func() {
+		It("should return SERVFAIL after the wait timeout", func() {
+			var queued, rejected bool
+			Expect(Bus().SubscribeOnce(UpstreamLimitQueued, func() { queued = true })).Should(Succeed())
+			Expect(Bus().SubscribeOnce(UpstreamLimitRejected, func() { rejected = true })).Should(Succeed())
+
+			wg := blockSlot()
+
+			resp, err := sut.Resolve(newRequest("second.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeServerFailure))
+			Expect(resp.Reason).Should(Equal("UPSTREAM LIMIT EXCEEDED"))
+			Expect(queued).Should(BeTrue())
+			Expect(rejected).Should(BeTrue())
+
+			close(release)
+			wg.Wait()
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 1)
+		})
+	})
+
+	When("slot becomes free within the wait timeout", func() {
+		BeforeEach(func() {
+			cfg.WaitTimeout = config.Duration(time.Second)
+		})
+		It("should resolve the waiting request", func() {
+			var rejected bool
+			handler := func() { rejected = true }
+			Expect(Bus().Subscribe(UpstreamLimitRejected, handler)).Should(Succeed())
+			DeferCleanup(func() {
+				Expect(Bus().Unsubscribe(UpstreamLimitRejected, handler)).Should(Succeed())
+			})
+
+			wg := blockSlot()
+
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				close(release)
+			}()
+
+			resp, err := sut.Resolve(newRequest("second.com.", dns.TypeA))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(rejected).Should(BeFalse())
+
+			wg.Wait()
+			m.AssertNumberOfCalls(GinkgoT(), "Resolve", 2)
+		})
+	})
+
+	When("limit is not configured", func() {
+		BeforeEach(func() {
+			cfg = config.UpstreamLimitConfig{}
+			close(release)
+		})
+		It("should not limit the requests", func() {
+			for i := 0; i < 3; i++ {
+				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Reason).Should(Equal("RESOLVED"))
+			}
+		})
+	})
+
+	Describe("Configuration output", func() {
+		When("resolver is enabled", func() {
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"maxConcurrent = 1", "waitTimeout = 50ms"}))
+			})
+		})
+
+		When("only the limit per upstream is configured", func() {
+			BeforeEach(func() {
+				cfg = config.UpstreamLimitConfig{MaxConcurrentPerUpstream: 2, WaitTimeout: config.Duration(50 * time.Millisecond)}
+			})
+			It("should return configuration", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{
+					"maxConcurrent = 0", "maxConcurrentPerUpstream = 2", "waitTimeout = 50ms",
+				}))
+			})
+		})
+
+		When("resolver is disabled", func() {
+			BeforeEach(func() {
+				cfg = config.UpstreamLimitConfig{}
+			})
+			It("should return 'deactivated'", func() {
+				Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+			})
+		})
+	})
+})
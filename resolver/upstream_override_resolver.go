@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/util"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	upstreamOverrideResolverLogger = "upstream_override_resolver"
+
+	// EDNS0 option code (local/experimental use range) with the upstream (e.g. "tcp-tls:1.1.1.1:853") for the query
+	upstreamOverrideOptionCode = 65531
+)
+
+// UpstreamOverrideResolver resolves queries of trusted clients with the upstream DNS server from the EDNS0 option,
+// bypassing blocking, caching and the upstream selection. Only configured upstreams can be selected
+type UpstreamOverrideResolver struct {
+	NextResolver
+	clients   []string
+	upstreams map[config.Upstream]Resolver
+}
+
+// NewUpstreamOverrideResolver returns new resolver instance with the upstream settings of the chain
+func NewUpstreamOverrideResolver(cfg config.UpstreamOverrideConfig,
+	upstreamResolvers map[string][]config.Upstream, settings *UpstreamSettings) ChainedResolver {
+	r := &UpstreamOverrideResolver{clients: cfg.Clients}
+
+	if cfg.Enabled {
+		r.upstreams = make(map[config.Upstream]Resolver)
+
+		for _, upstreams := range upstreamResolvers {
+			for _, u := range upstreams {
+				if _, ok := r.upstreams[u]; !ok {
+					r.upstreams[u] = NewUpstreamResolver(u, settings)
+				}
+			}
+		}
+	}
+
+	return r
+}
+
+// Configuration returns current resolver configuration
+func (r *UpstreamOverrideResolver) Configuration() (result []string) {
+	if r.upstreams == nil {
+		return []string{"deactivated"}
+	}
+
+	return []string{fmt.Sprintf("clients = %v", r.clients)}
+}
+
+// Resolve resolves the query with the selected upstream, if the option is present and the client is trusted
+func (r *UpstreamOverrideResolver) Resolve(request *model.Request) (*model.Response, error) {
+	if r.upstreams == nil {
+		return r.next.Resolve(request)
+	}
+
+	value, found := upstreamOverride(request.Req)
+	if !found {
+		return r.next.Resolve(request)
+	}
+
+	logger := withPrefix(request.Log, upstreamOverrideResolverLogger).WithFields(logrus.Fields{
+		"upstream":  value,
+		"client_ip": request.ClientIP,
+	})
+
+	if !r.isTrustedClient(request.ClientIP) {
+		logger.Warn("upstream override from untrusted client ignored")
+
+		return r.next.Resolve(request)
+	}
+
+	// only configured upstreams can be selected, unparsable values don't match
+	upstream, _ := config.ParseUpstream(value)
+
+	res, ok := r.upstreams[upstream]
+	if !ok {
+		logger.Warn("upstream override refused, upstream is not configured")
+
+		response := new(dns.Msg)
+		response.SetRcode(request.Req, dns.RcodeRefused)
+
+		return &model.Response{Res: response, RType: model.ResponseTypeRESOLVED, Reason: "UPSTREAM OVERRIDE REFUSED"}, nil
+	}
+
+	logger.WithField("question", util.QuestionToString(request.Req.Question)).
+		Warn("query resolved with upstream override, blocking and caching are bypassed")
+
+	original := request.Req
+	request.Req = withoutUpstreamOverride(original)
+
+	defer func() { request.Req = original }()
+
+	resp, err := res.Resolve(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Reason = "UPSTREAM OVERRIDE " + resp.Reason
+
+	return resp, nil
+}
+
+func (r *UpstreamOverrideResolver) isTrustedClient(ip net.IP) bool {
+	return containsClientIP(r.clients, ip)
+}
+
+// containsClientIP checks if the IP is one of the IPs or CIDRs
+func containsClientIP(clients []string, ip net.IP) bool {
+	for _, client := range clients {
+		if util.CidrContainsIP(client, ip) || ip.Equal(net.ParseIP(client)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// upstreamOverride returns the upstream from the EDNS0 option
+func upstreamOverride(msg *dns.Msg) (string, bool) {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == upstreamOverrideOptionCode {
+				return string(local.Data), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// withoutUpstreamOverride returns a copy of the query without the option, it is not sent to the upstream
+func withoutUpstreamOverride(msg *dns.Msg) *dns.Msg {
+	query := msg.Copy()
+	opt := query.IsEdns0()
+
+	options := opt.Option[:0]
+
+	for _, o := range opt.Option {
+		if o.Option() != upstreamOverrideOptionCode {
+			options = append(options, o)
+		}
+	}
+
+	opt.Option = options
+
+	return query
+}
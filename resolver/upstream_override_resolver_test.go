@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/model"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("UpstreamOverrideResolver", func() {
+	var (
+		sut      *UpstreamOverrideResolver
+		cfg      config.UpstreamOverrideConfig
+		m        *resolverMock
+		upstream *resolverMock
+		query    *dns.Msg
+	)
+
+	tlsUpstream := config.Upstream{Net: config.NetProtocolTcpTls, Host: "9.9.9.9", Port: 853}
+
+	// requestWithOverride creates a request of the client with the upstream override option
+	requestWithOverride := func(clientIP string, value string) *Request {
+		req := newRequestWithClient("example.com.", dns.TypeA, clientIP)
+		req.Req.SetEdns0(4096, false)
+		req.Req.IsEdns0().Option = append(req.Req.IsEdns0().Option,
+			&dns.EDNS0_LOCAL{Code: upstreamOverrideOptionCode, Data: []byte(value)})
+
+		return req
+	}
+
+	BeforeEach(func() {
+		cfg = config.UpstreamOverrideConfig{Enabled: true, Clients: []string{"192.168.178.0/24", "10.0.0.1"}}
+		query = nil
+	})
+
+	JustBeforeEach(func() {
+		sut = NewUpstreamOverrideResolver(cfg, map[string][]config.Upstream{
+			"default": {{Net: config.NetProtocolTcpUdp, Host: "1.1.1.1", Port: 53}, tlsUpstream},
+		}, NewUpstreamSettings(&config.Config{})).(*UpstreamOverrideResolver)
+
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+		sut.Next(m)
+
+		if sut.upstreams != nil {
+			upstream = &resolverMock{}
+			upstream.On("Resolve", mock.Anything).Run(func(args mock.Arguments) {
+				query = args.Get(0).(*Request).Req
+			}).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED (9.9.9.9:853)"}, nil)
+			sut.upstreams[tlsUpstream] = upstream
+		}
+	})
+
+	When("trusted client selects a configured upstream", func() {
+		It("should resolve the query with this upstream without the option", func() {
+			req := requestWithOverride("192.168.178.25", "tcp-tls:9.9.9.9:853")
+
+			resp, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("UPSTREAM OVERRIDE RESOLVED (9.9.9.9:853)"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+
+			Expect(query.IsEdns0().Option).Should(BeEmpty())
+			Expect(req.Req.IsEdns0().Option).Should(HaveLen(1))
+		})
+	})
+
+	When("trusted client selects an unknown upstream", func() {
+		It("should return REFUSED", func() {
+			resp, err := sut.Resolve(requestWithOverride("10.0.0.1", "8.8.8.8"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeRefused))
+			Expect(resp.Reason).Should(Equal("UPSTREAM OVERRIDE REFUSED"))
+			upstream.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+	})
+
+	When("untrusted client sends the option", func() {
+		It("should ignore the option", func() {
+			resp, err := sut.Resolve(requestWithOverride("10.0.0.2", "tcp-tls:9.9.9.9:853"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			upstream.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+	})
+
+	When("query has no option", func() {
+		It("should delegate to next resolver", func() {
+			resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.25"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+	})
+
+	It("should return configuration", func() {
+		Expect(sut.Configuration()).Should(Equal([]string{"clients = [192.168.178.0/24 10.0.0.1]"}))
+	})
+
+	When("upstream override is disabled", func() {
+		BeforeEach(func() {
+			cfg.Enabled = false
+		})
+
+		It("should ignore the option", func() {
+			resp, err := sut.Resolve(requestWithOverride("192.168.178.25", "tcp-tls:9.9.9.9:853"))
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+		})
+
+		It("should return 'deactivated'", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+})
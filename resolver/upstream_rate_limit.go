@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+)
+
+// upstreamRateLimit is a token bucket for the queries to one upstream DNS server
+type upstreamRateLimit struct {
+	lock    sync.Mutex
+	qps     float64
+	burst   float64
+	maxWait time.Duration
+	tokens  float64
+	last    time.Time
+}
+
+// rateLimit returns the shared bucket of the upstream, nil if the limit is not configured
+func (s *UpstreamSettings) rateLimit(upstream config.Upstream) *upstreamRateLimit {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if l, found := s.buckets[upstream]; found {
+		return l
+	}
+
+	l := newUpstreamRateLimit(s.rateLimits[upstream])
+	if l != nil {
+		s.buckets[upstream] = l
+	}
+
+	return l
+}
+
+// newUpstreamRateLimit returns a full bucket, nil if the limit is not configured
+func newUpstreamRateLimit(cfg config.UpstreamRateLimitConfig) *upstreamRateLimit {
+	if cfg.QPS == 0 {
+		return nil
+	}
+
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.QPS
+	}
+
+	return &upstreamRateLimit{
+		qps:     float64(cfg.QPS),
+		burst:   float64(burst),
+		maxWait: time.Duration(cfg.MaxWait),
+		tokens:  float64(burst),
+	}
+}
+
+// reserve takes a token and returns the time to wait until the token is available. Returns false without taking
+// the token, if the wait time exceeds the max wait time
+func (l *upstreamRateLimit) reserve(now time.Time) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.qps
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+
+		return 0, true
+	}
+
+	wait := time.Duration((1 - l.tokens) / l.qps * float64(time.Second))
+	if wait > l.maxWait {
+		return 0, false
+	}
+
+	// the token is taken in advance, following queries wait longer
+	l.tokens--
+
+	return wait, true
+}
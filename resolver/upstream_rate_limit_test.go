@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("upstreamRateLimit", func() {
+	var (
+		sut *upstreamRateLimit
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		sut = newUpstreamRateLimit(config.UpstreamRateLimitConfig{
+			QPS:     10,
+			Burst:   2,
+			MaxWait: config.Duration(150 * time.Millisecond),
+		})
+	})
+
+	It("should allow the burst without waiting", func() {
+		for i := 0; i < 2; i++ {
+			wait, ok := sut.reserve(now)
+			Expect(ok).Should(BeTrue())
+			Expect(wait).Should(BeZero())
+		}
+	})
+
+	It("should return the wait time over the burst and reject over the max wait time", func() {
+		_, _ = sut.reserve(now)
+		_, _ = sut.reserve(now)
+
+		wait, ok := sut.reserve(now)
+		Expect(ok).Should(BeTrue())
+		Expect(wait).Should(Equal(100 * time.Millisecond))
+
+		_, ok = sut.reserve(now)
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should refill the tokens up to the burst", func() {
+		_, _ = sut.reserve(now)
+		_, _ = sut.reserve(now)
+
+		now = now.Add(time.Hour)
+
+		for i := 0; i < 2; i++ {
+			wait, ok := sut.reserve(now)
+			Expect(ok).Should(BeTrue())
+			Expect(wait).Should(BeZero())
+		}
+
+		wait, _ := sut.reserve(now)
+		Expect(wait).Should(Equal(100 * time.Millisecond))
+	})
+
+	It("should share the bucket of the upstream", func() {
+		upstream := config.Upstream{Net: config.NetProtocolTcpUdp, Host: "192.0.2.1", Port: 53}
+		other := config.Upstream{Net: config.NetProtocolTcpUdp, Host: "192.0.2.2", Port: 53}
+		settings := NewUpstreamSettings(&config.Config{
+			UpstreamRateLimits: map[config.Upstream]config.UpstreamRateLimitConfig{
+				upstream: {QPS: 5},
+				other:    {QPS: 5},
+			},
+		})
+
+		l := settings.rateLimit(upstream)
+		Expect(settings.rateLimit(upstream)).Should(BeIdenticalTo(l))
+		Expect(settings.rateLimit(other)).ShouldNot(BeIdenticalTo(l))
+		Expect(NewUpstreamSettings(&config.Config{}).rateLimit(upstream)).Should(BeNil())
+	})
+
+	It("should use the QPS as burst by default", func() {
+		Expect(newUpstreamRateLimit(config.UpstreamRateLimitConfig{QPS: 5}).burst).Should(BeNumerically("==", 5))
+		Expect(newUpstreamRateLimit(config.UpstreamRateLimitConfig{})).Should(BeNil())
+	})
+})
@@ -2,17 +2,20 @@ package resolver
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/avast/retry-go/v4"
 
 	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
 	"github.com/0xERR0R/blocky/model"
 	"github.com/0xERR0R/blocky/util"
 
@@ -30,60 +33,83 @@ type UpstreamResolver struct {
 	upstreamURL    string
 	upstreamClient upstreamClient
 	net            config.NetProtocol
+	loopDetection  bool
+	rateLimit      *upstreamRateLimit
+	timeout        *upstreamTimeout
+	inFlight       *upstreamInFlight
 }
 
 type upstreamClient interface {
-	callExternal(msg *dns.Msg, upstreamURL string,
+	callExternal(ctx context.Context, msg *dns.Msg, upstreamURL string,
 		protocol model.RequestProtocol) (response *dns.Msg, rtt time.Duration, err error)
 }
 
 type dnsUpstreamClient struct {
 	tcpClient, udpClient *dns.Client
+	cookies              *upstreamCookies
+	// repeat the query via TCP if the UDP response is truncated
+	retryTruncated bool
 }
 
 type httpUpstreamClient struct {
 	client *http.Client
 }
 
-func createUpstreamClient(cfg config.Upstream) (client upstreamClient, upstreamURL string) {
+// createUpstreamClient creates the client with the max timeout of the settings, the context of each query can
+// shorten it
+func createUpstreamClient(cfg config.Upstream, settings *UpstreamSettings) (client upstreamClient, upstreamURL string) {
+	timeout := settings.timeout.max()
+
+	if cfg.Net == config.NetProtocolDnscrypt {
+		return newDNSCryptUpstreamClient(cfg, timeout, settings), net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+	}
+
 	if cfg.Net == config.NetProtocolHttps {
 		return &httpUpstreamClient{
 			client: &http.Client{
 				Transport: &http.Transport{
-					Dial:                (util.Dialer(config.GetConfig())).Dial,
+					Dial:                settings.tcpDialer.Dial,
 					TLSHandshakeTimeout: 5 * time.Second,
 				},
-				Timeout: time.Duration(config.GetConfig().UpstreamTimeout),
+				Timeout: timeout,
 			},
 		}, fmt.Sprintf("%s://%s:%d%s", cfg.Net, cfg.Host, cfg.Port, cfg.Path)
 	}
 
+	var cookies *upstreamCookies
+	if settings.cookies {
+		cookies = newUpstreamCookies()
+	}
+
 	if cfg.Net == config.NetProtocolTcpTls {
 		return &dnsUpstreamClient{
 			tcpClient: &dns.Client{
 				Net:     cfg.Net.String(),
-				Timeout: time.Duration(config.GetConfig().UpstreamTimeout),
-				Dialer:  util.Dialer(config.GetConfig()),
+				Timeout: timeout,
+				Dialer:  settings.tcpDialer,
 			},
+			cookies: cookies,
 		}, net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
 	}
 
 	// tcp+udp
 	return &dnsUpstreamClient{
+		cookies:        cookies,
+		retryTruncated: settings.retryTruncated,
 		tcpClient: &dns.Client{
 			Net:     "tcp",
-			Timeout: time.Duration(config.GetConfig().UpstreamTimeout),
-			Dialer:  util.Dialer(config.GetConfig()),
+			Timeout: timeout,
+			Dialer:  settings.tcpDialer,
 		},
 		udpClient: &dns.Client{
 			Net:     "udp",
-			Timeout: time.Duration(config.GetConfig().UpstreamTimeout),
-			Dialer:  util.Dialer(config.GetConfig()),
+			Timeout: timeout,
+			Dialer:  settings.udpDialer,
 		},
 	}, net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
 }
 
-func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
+func (r *httpUpstreamClient) callExternal(ctx context.Context, msg *dns.Msg,
 	upstreamURL string, _ model.RequestProtocol) (*dns.Msg, time.Duration, error) {
 	start := time.Now()
 
@@ -93,7 +119,14 @@ func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
 		return nil, 0, fmt.Errorf("can't pack message: %w", err)
 	}
 
-	httpResponse, err := r.client.Post(upstreamURL, dnsContentType, bytes.NewReader(rawDNSMessage))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL, bytes.NewReader(rawDNSMessage))
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't create https request: %w", err)
+	}
+
+	httpRequest.Header.Set("Content-Type", dnsContentType)
+
+	httpResponse, err := r.client.Do(httpRequest)
 
 	if err != nil {
 		return nil, 0, fmt.Errorf("can't perform https request: %w", err)
@@ -128,16 +161,105 @@ func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
 	return &response, time.Since(start), nil
 }
 
-func (r *dnsUpstreamClient) callExternal(msg *dns.Msg,
+func (r *dnsUpstreamClient) callExternal(ctx context.Context, msg *dns.Msg,
+	upstreamURL string, protocol model.RequestProtocol) (response *dns.Msg, rtt time.Duration, err error) {
+	response, rtt, cookieSent, err := r.exchangeAndVerify(ctx, msg, upstreamURL, protocol)
+	if err != nil {
+		return response, rtt, err
+	}
+
+	if cookieSent {
+		retry, err := r.cookies.processResponse(response)
+		if err != nil {
+			return nil, rtt, err
+		}
+
+		if retry {
+			// repeat once with the new server cookie or without cookie
+			response, rtt, cookieSent, err = r.exchangeAndVerify(ctx, msg, upstreamURL, protocol)
+			if err != nil {
+				return response, rtt, err
+			}
+
+			if cookieSent {
+				if _, err = r.cookies.processResponse(response); err != nil {
+					return nil, rtt, err
+				}
+			}
+		}
+
+		if response.Rcode == dns.RcodeBadCookie {
+			return nil, rtt, errors.New("upstream rejected the cookie")
+		}
+
+		removeCookie(response, msg.IsEdns0() != nil)
+	}
+
+	response.Id = msg.Id
+
+	return response, rtt, nil
+}
+
+// exchangeAndVerify sends a copy of the message with random ID (and EDNS0 cookie if enabled) to the upstream
+func (r *dnsUpstreamClient) exchangeAndVerify(ctx context.Context, msg *dns.Msg, upstreamURL string,
+	protocol model.RequestProtocol) (response *dns.Msg, rtt time.Duration, cookieSent bool, err error) {
+	// don't forward the client's transaction ID, it can be predictable. Each upstream query gets a random ID
+	query := msg.Copy()
+	query.Id = dns.Id()
+
+	if r.cookies != nil {
+		cookieSent = r.cookies.prepareQuery(query)
+	}
+
+	response, rtt, err = r.exchange(ctx, query, upstreamURL, protocol)
+	if err != nil {
+		return response, rtt, cookieSent, err
+	}
+
+	if err = verifyResponse(query, response); err != nil {
+		return nil, rtt, cookieSent, err
+	}
+
+	return response, rtt, cookieSent, nil
+}
+
+// verifyResponse checks if the response belongs to the query (transaction ID and question)
+func verifyResponse(query, response *dns.Msg) error {
+	if response.Id != query.Id {
+		return fmt.Errorf("response ID %d doesn't match query ID %d", response.Id, query.Id)
+	}
+
+	// error responses (e.g. FORMERR) may omit the question section
+	if len(response.Question) == 0 && response.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+
+	if len(response.Question) != len(query.Question) {
+		return fmt.Errorf("response question count %d doesn't match query question count %d",
+			len(response.Question), len(query.Question))
+	}
+
+	for i, q := range query.Question {
+		rq := response.Question[i]
+		if !strings.EqualFold(rq.Name, q.Name) || rq.Qtype != q.Qtype || rq.Qclass != q.Qclass {
+			return fmt.Errorf("response question '%s' doesn't match query question '%s'",
+				util.QuestionToString([]dns.Question{rq}), util.QuestionToString([]dns.Question{q}))
+		}
+	}
+
+	return nil
+}
+
+func (r *dnsUpstreamClient) exchange(ctx context.Context, msg *dns.Msg,
 	upstreamURL string, protocol model.RequestProtocol) (response *dns.Msg, rtt time.Duration, err error) {
 	if protocol == model.RequestProtocolTCP {
-		response, rtt, err = r.tcpClient.Exchange(msg, upstreamURL)
+		response, rtt, err = r.tcpClient.ExchangeContext(ctx, msg, upstreamURL)
 		if err != nil {
 			// try UDP as fallback
 			var opErr *net.OpError
 			if errors.As(err, &opErr) {
 				if opErr.Op == "dial" && r.udpClient != nil {
-					return r.udpClient.Exchange(msg, upstreamURL)
+					return r.udpClient.ExchangeContext(ctx, msg, upstreamURL)
 				}
 			}
 		}
@@ -146,20 +268,32 @@ func (r *dnsUpstreamClient) callExternal(msg *dns.Msg,
 	}
 
 	if r.udpClient != nil {
-		return r.udpClient.Exchange(msg, upstreamURL)
+		response, rtt, err = r.udpClient.ExchangeContext(ctx, msg, upstreamURL)
+		if err != nil || !response.Truncated || !r.retryTruncated {
+			return response, rtt, err
+		}
+
+		// large answers (e.g. DNSKEY with signatures) don't fit in an UDP packet, repeat the query via TCP
+		logger("upstream_resolver").WithField("upstream", upstreamURL).
+			Debug("truncated response, retrying with TCP")
 	}
 
-	return r.tcpClient.Exchange(msg, upstreamURL)
+	return r.tcpClient.ExchangeContext(ctx, msg, upstreamURL)
 }
 
-// NewUpstreamResolver creates new resolver instance
-func NewUpstreamResolver(upstream config.Upstream) *UpstreamResolver {
-	upstreamClient, upstreamURL := createUpstreamClient(upstream)
+// NewUpstreamResolver creates new resolver instance with the upstream settings of the chain
+func NewUpstreamResolver(upstream config.Upstream, settings *UpstreamSettings) *UpstreamResolver {
+	upstreamClient, upstreamURL := createUpstreamClient(upstream, settings)
 
 	return &UpstreamResolver{
 		upstreamClient: upstreamClient,
 		upstreamURL:    upstreamURL,
-		net:            upstream.Net}
+		net:            upstream.Net,
+		loopDetection:  settings.loopDetection,
+		rateLimit:      settings.rateLimit(upstream),
+		timeout:        settings.timeout,
+		inFlight:       settings.inFlight(upstreamURL),
+	}
 }
 
 // Configuration return current resolver configuration
@@ -171,6 +305,30 @@ func (r UpstreamResolver) String() string {
 	return fmt.Sprintf("upstream '%s:%s'", r.net, r.upstreamURL)
 }
 
+// waitForRateLimit waits until the query can be sent within the rate limit of the upstream. Fails if the wait time
+// exceeds the max wait time, so the query can be answered by another upstream
+func (r *UpstreamResolver) waitForRateLimit(logger *logrus.Entry) error {
+	if r.rateLimit == nil {
+		return nil
+	}
+
+	wait, ok := r.rateLimit.reserve(time.Now())
+	if !ok {
+		evt.Bus().Publish(evt.UpstreamRateLimitRejected, r.upstreamURL)
+
+		return fmt.Errorf("rate limit of upstream '%s' exceeded", r.upstreamURL)
+	}
+
+	if wait > 0 {
+		logger.WithField("upstream", r.upstreamURL).Debugf("rate limit reached, waiting %s", wait)
+		evt.Bus().Publish(evt.UpstreamRateLimitQueued, r.upstreamURL)
+
+		time.Sleep(wait)
+	}
+
+	return nil
+}
+
 // Resolve calls external resolver
 func (r *UpstreamResolver) Resolve(request *model.Request) (response *model.Response, err error) {
 	const retryAttempts = 3
@@ -181,13 +339,33 @@ func (r *UpstreamResolver) Resolve(request *model.Request) (response *model.Resp
 
 	var resp *dns.Msg
 
+	if err := r.inFlight.acquire(); err != nil {
+		return nil, err
+	}
+
+	defer r.inFlight.release()
+
+	query := request.Req
+	if r.loopDetection {
+		query = nextHopQuery(request.Req)
+	}
+
 	err = retry.Do(
 		func() error {
+			// each attempt is a query to the upstream
+			if err := r.waitForRateLimit(logger); err != nil {
+				return err
+			}
+
+			ctx, cancel := r.timeout.context(request)
+			defer cancel()
+
 			var err error
-			if resp, rtt, err = r.upstreamClient.callExternal(request.Req, r.upstreamURL, request.Protocol); err == nil {
+			if resp, rtt, err = r.upstreamClient.callExternal(ctx, query, r.upstreamURL, request.Protocol); err == nil {
 				logger.WithFields(logrus.Fields{
 					"answer":           util.AnswerToString(resp.Answer),
 					"return_code":      dns.RcodeToString[resp.Rcode],
+					"authenticated":    resp.AuthenticatedData,
 					"upstream":         r.upstreamURL,
 					"protocol":         request.Protocol,
 					"net":              r.net,
@@ -212,5 +390,12 @@ func (r *UpstreamResolver) Resolve(request *model.Request) (response *model.Resp
 		return nil, err
 	}
 
-	return &model.Response{Res: resp, Reason: fmt.Sprintf("RESOLVED (%s)", r.upstreamURL)}, nil
+	rcode := resp.Rcode
+
+	return &model.Response{
+		Res:           resp,
+		Reason:        fmt.Sprintf("RESOLVED (%s)", r.upstreamURL),
+		UpstreamRcode: &rcode,
+		Authenticated: resp.AuthenticatedData,
+	}, nil
 }
@@ -3,7 +3,9 @@ package resolver
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xERR0R/blocky/config"
@@ -13,10 +15,16 @@ import (
 	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 )
 
 var _ = Describe("UpstreamResolver", func() {
+	var cfg config.Config
+
+	BeforeEach(func() {
+		cfg = config.Config{}
+	})
 
 	Describe("Using DNS upstream", func() {
 		When("Configured DNS resolver can resolve query", func() {
@@ -27,7 +35,7 @@ var _ = Describe("UpstreamResolver", func() {
 					Expect(err).Should(Succeed())
 					return response
 				})
-				sut := NewUpstreamResolver(upstream)
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
 
 				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
 				Expect(err).Should(Succeed())
@@ -45,13 +53,43 @@ var _ = Describe("UpstreamResolver", func() {
 
 					return response
 				})
-				sut := NewUpstreamResolver(upstream)
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
 
 				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
 				Expect(err).Should(Succeed())
 				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
 				Expect(resp.RType).Should(Equal(ResponseTypeRESOLVED))
 				Expect(resp.Reason).Should(Equal(fmt.Sprintf("RESOLVED (%s:%d)", upstream.Host, upstream.Port)))
+				Expect(resp.UpstreamRcode).Should(HaveValue(Equal(dns.RcodeNameError)))
+			})
+		})
+		When("Source address is configured", func() {
+			var upstream config.Upstream
+
+			BeforeEach(func() {
+				upstream = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+
+					Expect(err).Should(Succeed())
+					return response
+				})
+			})
+
+			It("should send the query from the source address", func() {
+				cfg.UpstreamSourceAddress = "127.0.0.1"
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "123.124.122.122"))
+			})
+
+			It("should fail if the source address is not available on the host", func() {
+				cfg.UpstreamSourceAddress = "192.0.2.1"
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(HaveOccurred())
 			})
 		})
 		When("Configured DNS resolver fails", func() {
@@ -60,7 +98,7 @@ var _ = Describe("UpstreamResolver", func() {
 
 					return nil
 				})
-				sut := NewUpstreamResolver(upstream)
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
 
 				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
 				Expect(err).Should(HaveOccurred())
@@ -80,7 +118,7 @@ var _ = Describe("UpstreamResolver", func() {
 
 				return response
 			})
-			sut := NewUpstreamResolver(upstream)
+			sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
 			sut.upstreamClient.(*dnsUpstreamClient).udpClient.Timeout = 100 * time.Millisecond
 
 			It("should perform a retry with 3 attempts", func() {
@@ -105,6 +143,499 @@ var _ = Describe("UpstreamResolver", func() {
 
 			})
 		})
+		When("the upstream validates the answer", func() {
+			// answers with AD bit only to queries with AD bit, as validating resolvers do (RFC 6840)
+			upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+				response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+				Expect(err).Should(Succeed())
+
+				response.AuthenticatedData = request.AuthenticatedData
+
+				return response
+			})
+
+			It("should pass the AD bit of the query and keep the validation state of the answer", func() {
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				request := newRequest("example.com.", dns.TypeA)
+
+				resp, err := sut.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.Authenticated).Should(BeFalse())
+				Expect(resp.Res.AuthenticatedData).Should(BeFalse())
+
+				request.Req.AuthenticatedData = true
+
+				resp, err = sut.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.Authenticated).Should(BeTrue())
+				Expect(resp.Res.AuthenticatedData).Should(BeTrue())
+			})
+		})
+		When("the max concurrent queries per upstream are configured", func() {
+			It("should fail without query, if the queries in flight reached the limit", func() {
+				release := make(chan struct{})
+				upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					<-release
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+
+				cfg.UpstreamLimit = config.UpstreamLimitConfig{
+					MaxConcurrentPerUpstream: 1,
+					WaitTimeout:              config.Duration(10 * time.Millisecond),
+				}
+
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				done := make(chan error)
+				go func() {
+					_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+					done <- err
+				}()
+
+				Eventually(func() float64 { return testutil.ToFloat64(sut.inFlight.gauge) }).Should(BeEquivalentTo(1))
+
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError(ContainSubstring("max concurrent queries to upstream")))
+
+				close(release)
+				Expect(<-done).Should(Succeed())
+				Expect(testutil.ToFloat64(sut.inFlight.gauge)).Should(BeZero())
+			})
+		})
+		When("a timeout multiplier is configured for the client", func() {
+			var (
+				upstream config.Upstream
+				queries  int32
+			)
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&queries, 0)
+
+				upstream = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					atomic.AddInt32(&queries, 1)
+					time.Sleep(150 * time.Millisecond)
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+
+				cfg.UpstreamTimeout = config.Duration(100 * time.Millisecond)
+				cfg.UpstreamTimeoutMultipliers = map[string]float64{"vpn-*": 3}
+			})
+
+			It("should wait longer for the answer to the client", func() {
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				resp, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "10.8.0.5", "vpn-laptop"))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "123.124.122.122"))
+				Expect(atomic.LoadInt32(&queries)).Should(BeEquivalentTo(1))
+			})
+
+			It("should keep the timeout of other clients", func() {
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				_, err := sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.5", "laptop"))
+				Expect(err).Should(MatchError(ContainSubstring("i/o timeout")))
+			})
+		})
+		When("loop detection is enabled", func() {
+			var (
+				receivedHops []uint8
+				sut          *UpstreamResolver
+			)
+
+			BeforeEach(func() {
+				receivedHops = nil
+
+				upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					receivedHops = append(receivedHops, loopHops(request))
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+				sut = NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+				sut.loopDetection = true
+			})
+
+			It("should send the incremented hops to the upstream for queries with EDNS0", func() {
+				req := newRequest("example.com.", dns.TypeA)
+				req.Req.SetEdns0(4096, false)
+
+				_, err := sut.Resolve(req)
+				Expect(err).Should(Succeed())
+				Expect(receivedHops).Should(Equal([]uint8{1}))
+				Expect(loopHops(req.Req)).Should(BeZero())
+			})
+			It("should not add EDNS0 to queries without EDNS0", func() {
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(receivedHops).Should(Equal([]uint8{0}))
+			})
+		})
+		When("rate limit is configured", func() {
+			var (
+				upstream config.Upstream
+				queries  int
+			)
+
+			BeforeEach(func() {
+				queries = 0
+
+				upstream = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					queries++
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+			})
+
+			It("should fail without query if the limit is exceeded", func() {
+				cfg.UpstreamRateLimits = map[config.Upstream]config.UpstreamRateLimitConfig{
+					upstream: {QPS: 1},
+				}
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+
+				_, err = sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError(ContainSubstring("rate limit of upstream")))
+				Expect(queries).Should(Equal(1))
+			})
+
+			It("should wait for a token up to the max wait time", func() {
+				cfg.UpstreamRateLimits = map[config.Upstream]config.UpstreamRateLimitConfig{
+					upstream: {QPS: 20, Burst: 1, MaxWait: config.Duration(time.Second)},
+				}
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+
+				start := time.Now()
+
+				for i := 0; i < 3; i++ {
+					_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+				}
+
+				Expect(time.Since(start)).Should(BeNumerically(">=", 90*time.Millisecond))
+				Expect(queries).Should(Equal(3))
+			})
+
+			It("should share the limit between the resolvers of the upstream", func() {
+				cfg.UpstreamRateLimits = map[config.Upstream]config.UpstreamRateLimitConfig{
+					upstream: {QPS: 1},
+				}
+
+				settings := NewUpstreamSettings(&cfg)
+
+				_, err := NewUpstreamResolver(upstream, settings).Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+
+				_, err = NewUpstreamResolver(upstream, settings).Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError(ContainSubstring("rate limit of upstream")))
+				Expect(queries).Should(Equal(1))
+			})
+
+			It("should take a token for each retry attempt", func() {
+				upstream = TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					queries++
+
+					// timeout of the first attempt
+					if queries == 1 {
+						time.Sleep(110 * time.Millisecond)
+					}
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+
+				cfg.UpstreamRateLimits = map[config.Upstream]config.UpstreamRateLimitConfig{
+					upstream: {QPS: 1},
+				}
+				sut := NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+				sut.upstreamClient.(*dnsUpstreamClient).udpClient.Timeout = 100 * time.Millisecond
+
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError(ContainSubstring("rate limit of upstream")))
+				Expect(queries).Should(Equal(1))
+			})
+		})
+		When("EDNS0 cookies are enabled", func() {
+			const serverCookie = "0102030405060708"
+
+			var (
+				receivedCookies []string
+				badCookie       bool
+				sut             *UpstreamResolver
+			)
+
+			BeforeEach(func() {
+				receivedCookies = nil
+				badCookie = false
+
+				upstream := TestUDPUpstream(func(request *dns.Msg) *dns.Msg {
+					cookie := findCookieOption(request.IsEdns0())
+					Expect(cookie).ShouldNot(BeNil())
+					receivedCookies = append(receivedCookies, cookie.Cookie)
+
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					if badCookie && len(receivedCookies) == 1 {
+						response.Rcode = dns.RcodeBadCookie
+					}
+
+					response.SetEdns0(cookieEdnsUDPSize, false)
+					opt := response.IsEdns0()
+					opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{
+						Code:   dns.EDNS0COOKIE,
+						Cookie: cookie.Cookie[:2*clientCookieLen] + serverCookie,
+					})
+
+					return response
+				})
+				sut = NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
+				sut.upstreamClient.(*dnsUpstreamClient).cookies = newUpstreamCookies()
+			})
+
+			It("should send the server cookie of the previous response and hide the cookie from the client", func() {
+				clientCookie := sut.upstreamClient.(*dnsUpstreamClient).cookies.clientCookie
+
+				for i := 0; i < 2; i++ {
+					resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+					Expect(err).Should(Succeed())
+					Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "123.124.122.122"))
+					Expect(resp.Res.IsEdns0()).Should(BeNil())
+				}
+
+				Expect(receivedCookies).Should(Equal([]string{clientCookie, clientCookie + serverCookie}))
+			})
+			It("should repeat the query with the new server cookie after BADCOOKIE", func() {
+				badCookie = true
+
+				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(receivedCookies).Should(HaveLen(2))
+				Expect(receivedCookies[1]).Should(HaveSuffix(serverCookie))
+			})
+		})
+		When("UDP response is truncated", func() {
+			var receivedNets []string
+
+			BeforeEach(func() {
+				receivedNets = nil
+			})
+
+			// answers with a truncated response via UDP and with the DNSKEY record and signature via TCP
+			dnssecUpstream := func() config.Upstream {
+				tcpLn, err := net.Listen("tcp4", "127.0.0.1:0")
+				Expect(err).Should(Succeed())
+
+				port := tcpLn.Addr().(*net.TCPAddr).Port
+
+				udpLn, err := net.ListenPacket("udp4", fmt.Sprintf("127.0.0.1:%d", port))
+				Expect(err).Should(Succeed())
+
+				handler := dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+					network := w.LocalAddr().Network()
+					receivedNets = append(receivedNets, network)
+
+					response := new(dns.Msg)
+					response.SetReply(request)
+					response.AuthenticatedData = true
+
+					if network == "udp" {
+						response.Truncated = true
+					} else {
+						dnskey, _ := dns.NewRR("example.com. 3600 IN DNSKEY 257 3 13 dGVzdA==")
+						rrsig, _ := dns.NewRR("example.com. 3600 IN RRSIG DNSKEY 13 2 3600 20220401000000 " +
+							"20220301000000 12345 example.com. dGVzdA==")
+						response.Answer = []dns.RR{dnskey, rrsig}
+					}
+
+					_ = w.WriteMsg(response)
+				})
+
+				tcpServer := &dns.Server{Listener: tcpLn, Handler: handler}
+				udpServer := &dns.Server{PacketConn: udpLn, Handler: handler}
+
+				go func() { _ = tcpServer.ActivateAndServe() }()
+				go func() { _ = udpServer.ActivateAndServe() }()
+
+				DeferCleanup(tcpServer.Shutdown)
+				DeferCleanup(udpServer.Shutdown)
+
+				return config.Upstream{Net: config.NetProtocolTcpUdp, Host: "127.0.0.1", Port: uint16(port)}
+			}
+
+			It("should repeat the query via TCP and return the DNSSEC records untouched", func() {
+				sut := NewUpstreamResolver(dnssecUpstream(), NewUpstreamSettings(&cfg))
+
+				request := newRequest("example.com.", dns.TypeDNSKEY)
+				request.Req.SetEdns0(1232, true)
+
+				resp, err := sut.Resolve(request)
+				Expect(err).Should(Succeed())
+
+				Expect(receivedNets).Should(Equal([]string{"udp", "tcp"}))
+				Expect(resp.Res.Truncated).Should(BeFalse())
+				Expect(resp.Res.AuthenticatedData).Should(BeTrue())
+				Expect(resp.Res.Answer).Should(HaveLen(2))
+				Expect(resp.Res.Answer[0].Header().Rrtype).Should(Equal(dns.TypeDNSKEY))
+				Expect(resp.Res.Answer[1].Header().Rrtype).Should(Equal(dns.TypeRRSIG))
+			})
+
+			When("truncated responses are returned", func() {
+				BeforeEach(func() {
+					cfg.UpstreamTruncatedResponse = config.UpstreamTruncatedResponseReturn
+				})
+
+				It("should return the truncated response without TCP query", func() {
+					sut := NewUpstreamResolver(dnssecUpstream(), NewUpstreamSettings(&cfg))
+
+					resp, err := sut.Resolve(newRequest("example.com.", dns.TypeDNSKEY))
+					Expect(err).Should(Succeed())
+
+					Expect(receivedNets).Should(Equal([]string{"udp"}))
+					Expect(resp.Res.Truncated).Should(BeTrue())
+					Expect(resp.Res.Answer).Should(BeEmpty())
+				})
+
+				It("should query via TCP if the client uses TCP", func() {
+					sut := NewUpstreamResolver(dnssecUpstream(), NewUpstreamSettings(&cfg))
+
+					request := newRequest("example.com.", dns.TypeDNSKEY)
+					request.Protocol = RequestProtocolTCP
+
+					resp, err := sut.Resolve(request)
+					Expect(err).Should(Succeed())
+
+					Expect(receivedNets).Should(Equal([]string{"tcp"}))
+					Expect(resp.Res.Answer).Should(HaveLen(2))
+				})
+			})
+		})
+	})
+
+	Describe("Verification of DNS upstream responses", func() {
+		var (
+			receivedIDs chan uint16
+			replyFn     func(request *dns.Msg) []*dns.Msg
+		)
+
+		// replies with messages created by replyFn without adjusting the ID or question
+		rawUDPUpstream := func() config.Upstream {
+			ln, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).Should(Succeed())
+
+			DeferCleanup(ln.Close)
+
+			ids := receivedIDs
+
+			go func() {
+				for {
+					buffer := make([]byte, 1024)
+
+					n, addr, err := ln.ReadFromUDP(buffer)
+					if err != nil {
+						return
+					}
+
+					request := new(dns.Msg)
+					if err := request.Unpack(buffer[:n]); err != nil {
+						continue
+					}
+
+					select {
+					case ids <- request.Id:
+					default:
+					}
+
+					for _, reply := range replyFn(request) {
+						b, _ := reply.Pack()
+						_, _ = ln.WriteToUDP(b, addr)
+					}
+				}
+			}()
+
+			addr := ln.LocalAddr().(*net.UDPAddr)
+
+			return config.Upstream{Net: config.NetProtocolTcpUdp, Host: addr.IP.String(), Port: uint16(addr.Port)}
+		}
+
+		answer := func(request *dns.Msg, name string) *dns.Msg {
+			response := new(dns.Msg)
+			response.SetReply(request)
+			response.Question[0].Name = name
+			rr, _ := dns.NewRR(fmt.Sprintf("%s 123 IN A 123.124.122.122", name))
+			response.Answer = []dns.RR{rr}
+
+			return response
+		}
+
+		BeforeEach(func() {
+			receivedIDs = make(chan uint16, 10)
+		})
+
+		When("upstream response matches the query", func() {
+			It("should use a random transaction ID and restore the client's ID", func() {
+				replyFn = func(request *dns.Msg) []*dns.Msg {
+					return []*dns.Msg{answer(request, "EXAMPLE.com.")}
+				}
+				sut := NewUpstreamResolver(rawUDPUpstream(), NewUpstreamSettings(&cfg))
+
+				request := newRequest("example.com.", dns.TypeA)
+				request.Req.Id = 1234
+
+				resp, err := sut.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Id).Should(Equal(uint16(1234)))
+				Expect(resp.Res.Answer).Should(HaveLen(1))
+				Expect(request.Req.Id).Should(Equal(uint16(1234)))
+				Expect(receivedIDs).Should(HaveLen(1))
+			})
+		})
+		When("upstream sends a response with wrong transaction ID first", func() {
+			It("should ignore it and wait for the matching response", func() {
+				replyFn = func(request *dns.Msg) []*dns.Msg {
+					spoofed := answer(request, "example.com.")
+					spoofed.Id = request.Id + 1
+					spoofed.Answer[0].(*dns.A).A = net.ParseIP("6.6.6.6")
+
+					return []*dns.Msg{spoofed, answer(request, "example.com.")}
+				}
+				sut := NewUpstreamResolver(rawUDPUpstream(), NewUpstreamSettings(&cfg))
+
+				resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(Succeed())
+				Expect(resp.Res.Answer).Should(BeDNSRecord("example.com.", dns.TypeA, 123, "123.124.122.122"))
+			})
+		})
+		When("upstream response contains another question", func() {
+			It("should return error", func() {
+				replyFn = func(request *dns.Msg) []*dns.Msg {
+					return []*dns.Msg{answer(request, "other.com.")}
+				}
+				sut := NewUpstreamResolver(rawUDPUpstream(), NewUpstreamSettings(&cfg))
+
+				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
+				Expect(err).Should(MatchError(ContainSubstring("doesn't match query question")))
+			})
+		})
 	})
 
 	Describe("Using Dns over HTTP (DOH) upstream", func() {
@@ -126,7 +657,7 @@ var _ = Describe("UpstreamResolver", func() {
 
 		JustBeforeEach(func() {
 			upstream = TestDOHUpstream(respFn, modifyHTTPRespFn)
-			sut = NewUpstreamResolver(upstream)
+			sut = NewUpstreamResolver(upstream, NewUpstreamSettings(&cfg))
 
 			// use insecure certificates for test doh upstream
 			// nolint:gosec
@@ -184,7 +715,8 @@ var _ = Describe("UpstreamResolver", func() {
 		})
 		When("Configured DOH resolver does not respond", func() {
 			JustBeforeEach(func() {
-				sut = NewUpstreamResolver(config.Upstream{Net: config.NetProtocolHttps, Host: "wronghost.example.com"})
+				sut = NewUpstreamResolver(config.Upstream{Net: config.NetProtocolHttps, Host: "wronghost.example.com"},
+					NewUpstreamSettings(&cfg))
 			})
 			It("should return error", func() {
 				_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
@@ -194,7 +726,8 @@ var _ = Describe("UpstreamResolver", func() {
 		})
 		When("Configured DOH resolver receives wrong request", func() {
 			JustBeforeEach(func() {
-				sut = NewUpstreamResolver(config.Upstream{Net: config.NetProtocolHttps, Host: "host"})
+				sut = NewUpstreamResolver(config.Upstream{Net: config.NetProtocolHttps, Host: "host"},
+					NewUpstreamSettings(&cfg))
 			})
 			It("should return error", func() {
 				wrongReq := new(dns.Msg)
@@ -213,7 +746,7 @@ var _ = Describe("UpstreamResolver", func() {
 	Describe("Configuration", func() {
 		When("Configuration is called", func() {
 			It("should return nil, because upstream resolver is printed out by other resolvers", func() {
-				sut := NewUpstreamResolver(config.Upstream{})
+				sut := NewUpstreamResolver(config.Upstream{}, NewUpstreamSettings(&cfg))
 
 				c := sut.Configuration()
 
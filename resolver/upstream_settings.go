@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"net"
+	"sync"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/util"
+)
+
+// UpstreamSettings contains the settings, which apply to all upstream resolvers of the chain
+type UpstreamSettings struct {
+	timeout       *upstreamTimeout
+	cookies       bool
+	loopDetection bool
+	// repeat the query via TCP if the UDP response is truncated
+	retryTruncated bool
+	// wait for the second resolver, if the first answer for A/AAAA is empty
+	retryOnEmpty bool
+	// a panic of an upstream resolver crashes the process, e.g. for debugging
+	disablePanicRecovery bool
+	queryTypes           map[config.Upstream]config.QueryTypes
+	rateLimits           map[config.Upstream]config.UpstreamRateLimitConfig
+	limit                config.UpstreamLimitConfig
+	tcpDialer            *net.Dialer
+	udpDialer            *net.Dialer
+
+	// all resolvers of the same upstream (e.g. in multiple groups) share the bucket and the in flight counter
+	lock      sync.Mutex
+	buckets   map[config.Upstream]*upstreamRateLimit
+	inFlights map[string]*upstreamInFlight
+}
+
+// NewUpstreamSettings returns the upstream settings of the configuration
+func NewUpstreamSettings(cfg *config.Config) *UpstreamSettings {
+	return &UpstreamSettings{
+		timeout:              newUpstreamTimeout(cfg),
+		cookies:              cfg.UpstreamCookies,
+		loopDetection:        cfg.LoopDetection.MaxHops > 0,
+		retryTruncated:       cfg.UpstreamTruncatedResponse == config.UpstreamTruncatedResponseRetryTcp,
+		retryOnEmpty:         cfg.RetryOnEmpty,
+		disablePanicRecovery: cfg.DisablePanicRecovery,
+		queryTypes:           cfg.UpstreamQueryTypes,
+		rateLimits:           cfg.UpstreamRateLimits,
+		limit:                cfg.UpstreamLimit,
+		tcpDialer:            util.UpstreamDialer(cfg, "tcp"),
+		udpDialer:            util.UpstreamDialer(cfg, "udp"),
+		buckets:              make(map[config.Upstream]*upstreamRateLimit),
+		inFlights:            make(map[string]*upstreamInFlight),
+	}
+}
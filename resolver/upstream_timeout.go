@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/model"
+)
+
+// clientTimeoutMultiplier is the multiplier of the upstream timeout for the client (name, IP or CIDR)
+type clientTimeoutMultiplier struct {
+	client     string
+	multiplier float64
+}
+
+// upstreamTimeout is the timeout of the upstream queries, multiplied per client
+type upstreamTimeout struct {
+	base        time.Duration
+	multipliers []clientTimeoutMultiplier
+}
+
+func newUpstreamTimeout(cfg *config.Config) *upstreamTimeout {
+	t := &upstreamTimeout{base: time.Duration(cfg.UpstreamTimeout)}
+
+	for client, multiplier := range cfg.UpstreamTimeoutMultipliers {
+		if multiplier > 0 {
+			t.multipliers = append(t.multipliers, clientTimeoutMultiplier{client: client, multiplier: multiplier})
+		}
+	}
+
+	sort.Slice(t.multipliers, func(i, j int) bool {
+		return t.multipliers[i].client < t.multipliers[j].client
+	})
+
+	return t
+}
+
+// max returns the longest timeout of all clients, the timeout of the upstream clients
+func (t *upstreamTimeout) max() time.Duration {
+	result := t.base
+
+	for _, m := range t.multipliers {
+		if timeout := t.multiplied(m.multiplier); timeout > result {
+			result = timeout
+		}
+	}
+
+	return result
+}
+
+// forRequest returns the timeout with the multiplier of the first matching client (sorted by name)
+func (t *upstreamTimeout) forRequest(request *model.Request) time.Duration {
+	for _, m := range t.multipliers {
+		if clientMatches(m.client, request) {
+			return t.multiplied(m.multiplier)
+		}
+	}
+
+	return t.base
+}
+
+// context returns a context with the timeout of the request as deadline
+func (t *upstreamTimeout) context(request *model.Request) (context.Context, context.CancelFunc) {
+	timeout := t.forRequest(request)
+	if timeout <= 0 {
+		// no timeout configured, the defaults of the upstream clients are used
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (t *upstreamTimeout) multiplied(multiplier float64) time.Duration {
+	return time.Duration(float64(t.base) * multiplier)
+}
@@ -0,0 +1,60 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("upstreamTimeout", func() {
+	var sut *upstreamTimeout
+
+	BeforeEach(func() {
+		sut = newUpstreamTimeout(&config.Config{
+			UpstreamTimeout: config.Duration(2 * time.Second),
+			UpstreamTimeoutMultipliers: map[string]float64{
+				"vpn-*":          3,
+				"10.8.0.0/24":    2.5,
+				"192.168.178.99": 0,
+			},
+		})
+	})
+
+	It("should multiply the timeout of the first matching client", func() {
+		Expect(sut.forRequest(newRequestWithClient("example.com.", dns.TypeA, "10.8.0.5", "vpn-laptop"))).
+			Should(Equal(5 * time.Second))
+		Expect(sut.forRequest(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.5", "vpn-laptop"))).
+			Should(Equal(6 * time.Second))
+	})
+
+	It("should use the base timeout for other clients and invalid multipliers", func() {
+		Expect(sut.forRequest(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.5", "laptop"))).
+			Should(Equal(2 * time.Second))
+		Expect(sut.forRequest(newRequestWithClient("example.com.", dns.TypeA, "192.168.178.99"))).
+			Should(Equal(2 * time.Second))
+	})
+
+	It("should return the longest timeout as max", func() {
+		Expect(sut.max()).Should(Equal(6 * time.Second))
+		Expect(newUpstreamTimeout(&config.Config{UpstreamTimeout: config.Duration(time.Second)}).max()).
+			Should(Equal(time.Second))
+	})
+
+	It("should set the deadline of the context", func() {
+		ctx, cancel := sut.context(newRequestWithClient("example.com.", dns.TypeA, "10.8.0.5"))
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		Expect(ok).Should(BeTrue())
+		Expect(time.Until(deadline)).Should(BeNumerically("~", 5*time.Second, time.Second))
+
+		ctx, cancel = newUpstreamTimeout(&config.Config{}).context(newRequest("example.com.", dns.TypeA))
+		defer cancel()
+
+		_, ok = ctx.Deadline()
+		Expect(ok).Should(BeFalse())
+	})
+})
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+
+	"github.com/0xERR0R/blocky/resolver"
+	"github.com/0xERR0R/blocky/util"
+)
+
+// blockedRequestProvider returns the reason of a recently blocked request
+type blockedRequestProvider interface {
+	BlockedRequest(clientIP net.IP, domain string) (reason string, found bool)
+}
+
+var blockPageTemplate = template.Must(template.New("blockPage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Blocked by blocky</title>
+</head>
+<body>
+<h1>{{.Domain}} is blocked</h1>
+<p>The access to this domain was blocked by blocky, the DNS server of your network.</p>
+{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+<p>Please contact your network administrator, if you think this domain should not be blocked.</p>
+</body>
+</html>
+`))
+
+type blockPageData struct {
+	Domain string
+	Reason string
+}
+
+// newBlockPageHandler returns a handler, which answers all requests with a page explaining the block.
+// The reason is shown if the client's DNS request for the domain was blocked recently
+func newBlockPageHandler(provider blockedRequestProvider) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		data := blockPageData{Domain: req.Host}
+		if host, _, err := net.SplitHostPort(req.Host); err == nil {
+			data.Domain = host
+		}
+
+		if provider != nil {
+			if ip := parseIP(req.RemoteAddr); ip != nil {
+				if reason, found := provider.BlockedRequest(ip, data.Domain); found {
+					data.Reason = reason
+				}
+			}
+		}
+
+		rw.Header().Set("content-type", "text/html; charset=utf-8")
+		rw.Header().Set("cache-control", "no-store")
+		rw.WriteHeader(http.StatusForbidden)
+
+		err := blockPageTemplate.Execute(rw, data)
+		util.LogOnError("can't write block page: ", err)
+	})
+}
+
+// findBlockedRequestProvider returns the first resolver of the chain, which records blocked requests
+func findBlockedRequestProvider(res resolver.Resolver) blockedRequestProvider {
+	for res != nil {
+		if p, ok := res.(blockedRequestProvider); ok {
+			return p
+		}
+
+		if cr, ok := res.(resolver.ChainedResolver); ok {
+			res = cr.GetNext()
+		} else {
+			break
+		}
+	}
+
+	return nil
+}
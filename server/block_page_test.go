@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/resolver"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type blockedRequestMock struct {
+	clientIP net.IP
+	domain   string
+}
+
+func (m *blockedRequestMock) BlockedRequest(clientIP net.IP, domain string) (string, bool) {
+	m.clientIP = clientIP
+	m.domain = domain
+
+	return "BLOCKED (ads)", domain == "ads.example.com"
+}
+
+var _ = Describe("Block page", func() {
+	var provider *blockedRequestMock
+
+	BeforeEach(func() {
+		provider = &blockedRequestMock{}
+	})
+
+	request := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/some/path", nil)
+		req.Host = host
+		req.RemoteAddr = "192.168.178.25:1234"
+
+		rr := httptest.NewRecorder()
+		newBlockPageHandler(provider).ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	When("the request of the client was blocked", func() {
+		It("should show the domain and the reason", func() {
+			rr := request("ads.example.com:8080")
+
+			Expect(rr.Code).Should(Equal(http.StatusForbidden))
+			Expect(rr.Header().Get("content-type")).Should(Equal("text/html; charset=utf-8"))
+			Expect(rr.Body.String()).Should(ContainSubstring("ads.example.com is blocked"))
+			Expect(rr.Body.String()).Should(ContainSubstring("Reason: BLOCKED (ads)"))
+			Expect(provider.clientIP).Should(Equal(net.ParseIP("192.168.178.25")))
+			Expect(provider.domain).Should(Equal("ads.example.com"))
+		})
+	})
+
+	When("no blocked request is known", func() {
+		It("should show the page without reason", func() {
+			rr := request("<script>.example.com")
+
+			Expect(rr.Code).Should(Equal(http.StatusForbidden))
+			Expect(rr.Body.String()).Should(ContainSubstring("&lt;script&gt;.example.com is blocked"))
+			Expect(rr.Body.String()).ShouldNot(ContainSubstring("Reason"))
+		})
+	})
+
+	Describe("Provider lookup", func() {
+		It("should find the blocking resolver in the chain", func() {
+			blocking, err := resolver.NewBlockingResolver(config.BlockingConfig{BlockType: "ZEROIP"}, nil)
+			Expect(err).Should(Succeed())
+
+			chain := resolver.Chain(resolver.NewMetricsResolver(config.PrometheusConfig{}), blocking)
+
+			Expect(findBlockedRequestProvider(chain)).Should(BeIdenticalTo(blocking))
+		})
+
+		It("should return nil if no resolver records blocked requests", func() {
+			Expect(findBlockedRequestProvider(resolver.NewMetricsResolver(config.PrometheusConfig{}))).Should(BeNil())
+		})
+	})
+})
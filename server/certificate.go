@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// envSourcePrefix marks the cert/key as name of an environment variable with the PEM, e.g. "env:BLOCKY_CERT"
+	envSourcePrefix = "env:"
+
+	// base64SourcePrefix marks the cert/key as base64 encoded PEM, e.g. "base64:LS0tLS1CRUdJTi..."
+	base64SourcePrefix = "base64:"
+)
+
+// loadCertificate loads the certificate and key for the TLS endpoints (DoT, DoH, block page).
+// Each source is a file path, an environment variable ("env:NAME") or an inline base64 encoded PEM ("base64:...")
+func loadCertificate(certSource, keySource string) (tls.Certificate, error) {
+	certPEM, err := readPEM(certSource)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("can't read certificate: %w", err)
+	}
+
+	keyPEM, err := readPEM(keySource)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("can't read key: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+
+	return cert, nil
+}
+
+// readPEM returns the PEM of the source. The content of environment variables can be PEM or base64 encoded PEM
+func readPEM(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, envSourcePrefix):
+		name := strings.TrimPrefix(source, envSourcePrefix)
+
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("environment variable '%s' is not set", name)
+		}
+
+		if strings.Contains(value, "-----BEGIN") {
+			return []byte(value), nil
+		}
+
+		return decodeBase64PEM(value)
+
+	case strings.HasPrefix(source, base64SourcePrefix):
+		return decodeBase64PEM(strings.TrimPrefix(source, base64SourcePrefix))
+
+	default:
+		return os.ReadFile(source)
+	}
+}
+
+func decodeBase64PEM(value string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoded PEM: %w", err)
+	}
+
+	if !strings.Contains(string(data), "-----BEGIN") {
+		return nil, errors.New("decoded base64 value is not a PEM")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/base64"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certificate loading", func() {
+	const (
+		certFile = "../testdata/cert.pem"
+		keyFile  = "../testdata/key.pem"
+	)
+
+	var certPEM, keyPEM []byte
+
+	BeforeEach(func() {
+		var err error
+
+		certPEM, err = os.ReadFile(certFile)
+		Expect(err).Should(Succeed())
+
+		keyPEM, err = os.ReadFile(keyFile)
+		Expect(err).Should(Succeed())
+	})
+
+	setEnv := func(name, value string) {
+		Expect(os.Setenv(name, value)).Should(Succeed())
+		DeferCleanup(os.Unsetenv, name)
+	}
+
+	It("should load the certificate from files", func() {
+		cert, err := loadCertificate(certFile, keyFile)
+		Expect(err).Should(Succeed())
+		Expect(cert.Certificate).ShouldNot(BeEmpty())
+	})
+
+	It("should load the certificate from environment variables with PEM or base64 encoded PEM", func() {
+		setEnv("BLOCKY_TEST_CERT", string(certPEM))
+		setEnv("BLOCKY_TEST_KEY", base64.StdEncoding.EncodeToString(keyPEM))
+
+		cert, err := loadCertificate("env:BLOCKY_TEST_CERT", "env:BLOCKY_TEST_KEY")
+		Expect(err).Should(Succeed())
+		Expect(cert.Certificate).ShouldNot(BeEmpty())
+	})
+
+	It("should load the inline base64 encoded certificate", func() {
+		cert, err := loadCertificate("base64:"+base64.StdEncoding.EncodeToString(certPEM), keyFile)
+		Expect(err).Should(Succeed())
+		Expect(cert.Certificate).ShouldNot(BeEmpty())
+	})
+
+	When("the source is invalid", func() {
+		It("should fail if the environment variable is not set", func() {
+			_, err := loadCertificate("env:BLOCKY_TEST_UNKNOWN", keyFile)
+			Expect(err).Should(MatchError("can't read certificate: environment variable 'BLOCKY_TEST_UNKNOWN' is not set"))
+		})
+
+		It("should fail if the base64 value is invalid", func() {
+			_, err := loadCertificate(certFile, "base64:!!!")
+			Expect(err).Should(MatchError(ContainSubstring("can't read key: invalid base64 encoded PEM")))
+		})
+
+		It("should fail if the decoded value is not a PEM", func() {
+			_, err := loadCertificate("base64:"+base64.StdEncoding.EncodeToString([]byte("test")), keyFile)
+			Expect(err).Should(MatchError("can't read certificate: decoded base64 value is not a PEM"))
+		})
+
+		It("should fail if certificate and key don't match", func() {
+			_, err := loadCertificate(keyFile, keyFile)
+			Expect(err).Should(MatchError(ContainSubstring("invalid certificate or key")))
+		})
+
+		It("should fail if the file doesn't exist", func() {
+			_, err := loadCertificate("unknown.pem", keyFile)
+			Expect(err).Should(MatchError(ContainSubstring("can't read certificate")))
+		})
+	})
+})
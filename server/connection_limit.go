@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/util"
+)
+
+// connectionLimiter counts the open connections of a server type (e.g. "tls", "https"). All listeners of the server
+// type (one per configured port) share the counter, the limits apply to their sum
+type connectionLimiter struct {
+	server         string
+	maxConnections int
+	maxPerIP       int
+
+	lock        sync.Mutex
+	connections int
+	perIP       map[string]int
+}
+
+func newConnectionLimiter(server string, cfg config.ConnectionLimitsConfig) *connectionLimiter {
+	return &connectionLimiter{
+		server:         server,
+		maxConnections: cfg.MaxConnections,
+		maxPerIP:       cfg.MaxConnectionsPerIP,
+		perIP:          make(map[string]int),
+	}
+}
+
+// limit wraps the listener with the connection limits of the server type
+func (l *connectionLimiter) limit(listener net.Listener) net.Listener {
+	return &connectionLimitListener{Listener: listener, limiter: l}
+}
+
+// connectionLimitListener closes new connections, which exceed the limits of the server type
+type connectionLimitListener struct {
+	net.Listener
+	limiter *connectionLimiter
+}
+
+// Accept waits for the next connection within the limits, connections exceeding the limits are closed
+func (l *connectionLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+
+		if l.limiter.acquire(ip) {
+			return &limitedConn{Conn: conn, release: func() { l.limiter.release(ip) }}, nil
+		}
+
+		logger().Debugf("%s connection from %s rejected, connection limit reached",
+			l.limiter.server, util.Obfuscate(ip))
+		evt.Bus().Publish(evt.ServerConnectionRejected, l.limiter.server)
+
+		_ = conn.Close()
+	}
+}
+
+func (l *connectionLimiter) acquire(ip string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.maxConnections > 0 && l.connections >= l.maxConnections {
+		return false
+	}
+
+	if l.maxPerIP > 0 && ip != "" && l.perIP[ip] >= l.maxPerIP {
+		return false
+	}
+
+	l.connections++
+
+	if ip != "" {
+		l.perIP[ip]++
+	}
+
+	evt.Bus().Publish(evt.ServerConnectionsChanged, l.server, l.connections)
+
+	return true
+}
+
+func (l *connectionLimiter) release(ip string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.connections--
+
+	if ip != "" {
+		if l.perIP[ip]--; l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+	}
+
+	evt.Bus().Publish(evt.ServerConnectionsChanged, l.server, l.connections)
+}
+
+// remoteIP returns the IP of the connection's peer, empty for connections without IP (unix domain socket)
+func remoteIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+
+	return ""
+}
+
+// limitedConn releases its slot of the connection limit on close
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection limits", func() {
+	var (
+		sut      net.Listener
+		limits   config.ConnectionLimitsConfig
+		accepted chan net.Conn
+		rejected chan string
+	)
+
+	BeforeEach(func() {
+		limits = config.ConnectionLimitsConfig{}
+		rejected = make(chan string, 10)
+	})
+
+	JustBeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).Should(Succeed())
+
+		sut = newConnectionLimiter("tls", limits).limit(listener)
+		DeferCleanup(sut.Close)
+
+		handler := func(server string) {
+			rejected <- server
+		}
+		Expect(Bus().Subscribe(ServerConnectionRejected, handler)).Should(Succeed())
+		DeferCleanup(func() {
+			Expect(Bus().Unsubscribe(ServerConnectionRejected, handler)).Should(Succeed())
+		})
+
+		accepted = make(chan net.Conn, 10)
+
+		go func() {
+			for {
+				conn, err := sut.Accept()
+				if err != nil {
+					return
+				}
+
+				accepted <- conn
+			}
+		}()
+	})
+
+	// dial opens a connection and returns the accepted server side connection, nil if it was rejected
+	dial := func() (client net.Conn, server net.Conn) {
+		client, err := net.Dial("tcp", sut.Addr().String())
+		Expect(err).Should(Succeed())
+		DeferCleanup(client.Close)
+
+		select {
+		case server = <-accepted:
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		return client, server
+	}
+
+	// isClosed checks if the server closed the connection
+	isClosed := func(client net.Conn) bool {
+		_ = client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err := client.Read(make([]byte, 1))
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return false
+		}
+
+		return err != nil
+	}
+
+	When("max connections is reached", func() {
+		BeforeEach(func() {
+			limits.MaxConnections = 2
+		})
+
+		It("should close new connections until a connection is closed", func() {
+			_, first := dial()
+			Expect(first).ShouldNot(BeNil())
+			_, second := dial()
+			Expect(second).ShouldNot(BeNil())
+
+			client, third := dial()
+			Expect(third).Should(BeNil())
+			Expect(isClosed(client)).Should(BeTrue())
+			Expect(rejected).Should(Receive(Equal("tls")))
+
+			Expect(first.Close()).Should(Succeed())
+			// closing twice releases the slot only once
+			Expect(first.Close()).ShouldNot(Succeed())
+
+			_, fourth := dial()
+			Expect(fourth).ShouldNot(BeNil())
+
+			client, fifth := dial()
+			Expect(fifth).Should(BeNil())
+			Expect(isClosed(client)).Should(BeTrue())
+		})
+	})
+
+	When("max connections per IP is reached", func() {
+		BeforeEach(func() {
+			limits.MaxConnectionsPerIP = 1
+		})
+
+		It("should close new connections of this IP", func() {
+			_, first := dial()
+			Expect(first).ShouldNot(BeNil())
+
+			client, second := dial()
+			Expect(second).Should(BeNil())
+			Expect(isClosed(client)).Should(BeTrue())
+
+			Expect(first.Close()).Should(Succeed())
+
+			_, third := dial()
+			Expect(third).ShouldNot(BeNil())
+		})
+	})
+
+	When("the server has multiple listeners", func() {
+		BeforeEach(func() {
+			limits.MaxConnections = 1
+		})
+
+		It("should apply the limits to the connections of all listeners", func() {
+			_, first := dial()
+			Expect(first).ShouldNot(BeNil())
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).Should(Succeed())
+
+			other := sut.(*connectionLimitListener).limiter.limit(listener)
+			DeferCleanup(other.Close)
+
+			go func() {
+				if conn, err := other.Accept(); err == nil {
+					accepted <- conn
+				}
+			}()
+
+			client, err := net.Dial("tcp", other.Addr().String())
+			Expect(err).Should(Succeed())
+			DeferCleanup(client.Close)
+
+			Expect(isClosed(client)).Should(BeTrue())
+			Expect(rejected).Should(Receive(Equal("tls")))
+			Expect(accepted).ShouldNot(Receive())
+		})
+	})
+
+	When("no limits are configured", func() {
+		It("should accept all connections", func() {
+			for i := 0; i < 5; i++ {
+				client, server := dial()
+				Expect(server).ShouldNot(BeNil())
+				Expect(isClosed(client)).Should(BeFalse())
+			}
+
+			Expect(rejected).ShouldNot(Receive())
+		})
+	})
+})
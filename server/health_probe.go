@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/log"
+	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/resolver"
+	"github.com/0xERR0R/blocky/util"
+
+	"github.com/miekg/dns"
+)
+
+// healthProbe performs periodically a synthetic query for the configured domain through the resolver chain
+type healthProbe struct {
+	cfg      config.HealthProbeConfig
+	resolver resolver.Resolver
+
+	lock                sync.RWMutex
+	consecutiveFailures uint
+}
+
+func newHealthProbe(cfg config.HealthProbeConfig, r resolver.Resolver) *healthProbe {
+	return &healthProbe{
+		cfg:      cfg,
+		resolver: r,
+	}
+}
+
+func (p *healthProbe) enabled() bool {
+	return p.cfg.Domain != ""
+}
+
+func (p *healthProbe) run() {
+	ticker := time.NewTicker(time.Duration(p.cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		p.probe()
+
+		<-ticker.C
+	}
+}
+
+// probe resolves the configured domain and records the result
+func (p *healthProbe) probe() {
+	logger := log.PrefixedLog("health_probe")
+	start := time.Now()
+
+	resp, err := resolver.Resolve(p.resolver, &model.Request{
+		ClientIP:  net.IPv4(127, 0, 0, 1),
+		Protocol:  model.RequestProtocolUDP,
+		Req:       util.NewMsgWithQuestion(dns.Fqdn(p.cfg.Domain), dns.TypeA),
+		Log:       logger,
+		RequestTS: start,
+	})
+
+	duration := time.Since(start)
+	success := err == nil && resp != nil && resp.Res != nil && resp.Res.Rcode == dns.RcodeSuccess
+
+	failures := p.recordResult(success)
+
+	if success {
+		logger.Debugf("probe for '%s' succeeded in %s", p.cfg.Domain, duration)
+	} else {
+		logger.Warnf("probe for '%s' failed (%d consecutive failures): %v", p.cfg.Domain, failures, err)
+	}
+
+	evt.Bus().Publish(evt.HealthProbeFinished, success, duration)
+}
+
+// recordResult updates the count of consecutive failures and returns it
+func (p *healthProbe) recordResult(success bool) uint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if success {
+		p.consecutiveFailures = 0
+	} else {
+		p.consecutiveFailures++
+	}
+
+	return p.consecutiveFailures
+}
+
+// ready returns false if the probe failed at least 'failureThreshold' times in a row
+func (p *healthProbe) ready() bool {
+	if !p.enabled() {
+		return true
+	}
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.consecutiveFailures < p.cfg.FailureThreshold
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/evt"
+	"github.com/0xERR0R/blocky/resolver"
+	"github.com/0xERR0R/blocky/util"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health probe", func() {
+	var (
+		probe      *healthProbe
+		probeOK    bool
+		probeCfg   config.HealthProbeConfig
+		mockResolv *resolver.MockResolver
+	)
+
+	BeforeEach(func() {
+		probeOK = true
+		probeCfg = config.HealthProbeConfig{
+			Domain:           "probe.example.com",
+			Interval:         config.Duration(time.Minute),
+			FailureThreshold: 2,
+		}
+		mockResolv = &resolver.MockResolver{AnswerFn: func(t uint16, qName string) *dns.Msg {
+			if probeOK && t == dns.TypeA && qName == "probe.example.com." {
+				msg, _ := util.NewMsgWithAnswer(qName, 60, dns.TypeA, "1.2.3.4")
+
+				return msg
+			}
+
+			return nil
+		}}
+	})
+
+	JustBeforeEach(func() {
+		probe = newHealthProbe(probeCfg, mockResolv)
+	})
+
+	When("probe domain is not configured", func() {
+		BeforeEach(func() {
+			probeCfg.Domain = ""
+		})
+		It("should be disabled and always ready", func() {
+			Expect(probe.enabled()).Should(BeFalse())
+			Expect(probe.ready()).Should(BeTrue())
+		})
+	})
+
+	When("probe query succeeds", func() {
+		It("should be ready and publish the result", func() {
+			var result bool
+
+			err := Bus().SubscribeOnce(HealthProbeFinished, func(success bool, _ time.Duration) {
+				result = success
+			})
+			Expect(err).Should(Succeed())
+
+			probe.probe()
+
+			Expect(result).Should(BeTrue())
+			Expect(probe.ready()).Should(BeTrue())
+		})
+	})
+
+	When("probe query fails", func() {
+		BeforeEach(func() {
+			probeOK = false
+		})
+		It("should not be ready if failure threshold is reached", func() {
+			probe.probe()
+			Expect(probe.ready()).Should(BeTrue())
+
+			probe.probe()
+			Expect(probe.ready()).Should(BeFalse())
+
+			By("should be ready again after successful probe", func() {
+				probeOK = true
+
+				probe.probe()
+				Expect(probe.ready()).Should(BeTrue())
+			})
+		})
+		It("should return 503 on readiness endpoint", func() {
+			probe.probe()
+			probe.probe()
+
+			srv := &Server{healthProbe: probe}
+			rec := httptest.NewRecorder()
+
+			srv.readinessHandler(rec, httptest.NewRequest(http.MethodGet, api.PathReadiness, nil))
+
+			Expect(rec.Code).Should(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
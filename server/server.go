@@ -2,6 +2,7 @@ package server
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -32,6 +33,11 @@ type Server struct {
 	queryResolver  resolver.Resolver
 	cfg            *config.Config
 	httpMux        *chi.Mux
+	healthProbe    *healthProbe
+	tlsConfig      *tls.Config
+
+	blockPageListeners      []net.Listener
+	blockPageHTTPSListeners []net.Listener
 }
 
 func logger() *logrus.Entry {
@@ -48,24 +54,58 @@ func getServerAddress(addr string) string {
 
 type NewServerFunc func(address string) *dns.Server
 
+// httpReadHeaderTimeout limits the time to read the request headers of the HTTPS endpoints
+const httpReadHeaderTimeout = 20 * time.Second
+
 // NewServer creates new server instance with passed config
 func NewServer(cfg *config.Config) (server *Server, err error) {
 	var dnsServers []*dns.Server
 
 	log.ConfigureLogger(cfg.LogLevel, cfg.LogFormat, cfg.LogTimestamp)
 
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
 	addServers := func(newServer NewServerFunc, addresses config.ListenConfig) {
 		for _, address := range addresses {
-			dnsServers = append(dnsServers, newServer(getServerAddress(address)))
+			if !isUnixSocket(address) {
+				dnsServers = append(dnsServers, newServer(getServerAddress(address)))
+			}
 		}
 	}
 
 	addServers(createUDPServer, cfg.DNSPorts)
 	addServers(createTCPServer, cfg.DNSPorts)
 
-	addServers(func(address string) *dns.Server {
-		return createTLSServer(address, cfg.CertFile, cfg.KeyFile)
-	}, cfg.TLSPorts)
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsLimiter := newConnectionLimiter("tls", cfg.ConnectionLimits)
+
+	for _, address := range cfg.TLSPorts {
+		if !isUnixSocket(address) {
+			tlsServer, err := createTLSServer(getServerAddress(address), tlsConfig, tlsLimiter)
+			if err != nil {
+				return nil, err
+			}
+
+			dnsServers = append(dnsServers, tlsServer)
+		}
+	}
+
+	for _, address := range cfg.DNSPorts {
+		if isUnixSocket(address) {
+			unixServer, err := createUnixServer(address)
+			if err != nil {
+				return nil, err
+			}
+
+			dnsServers = append(dnsServers, unixServer)
+		}
+	}
 
 	router := createRouter(cfg)
 
@@ -78,14 +118,19 @@ func NewServer(cfg *config.Config) (server *Server, err error) {
 		metrics.Start(router, cfg.Prometheus)
 	}
 
-	metrics.RegisterEventListeners()
+	blockPageListeners, err := newListeners("block page http", cfg.Blocking.BlockPage.Port)
+	if err != nil {
+		return nil, err
+	}
 
-	redisClient, redisErr := redis.New(&cfg.Redis)
-	if redisErr != nil && cfg.Redis.Required {
-		return nil, redisErr
+	blockPageHTTPSListeners, err := newListeners("block page https", cfg.Blocking.BlockPage.HTTPSPort)
+	if err != nil {
+		return nil, err
 	}
 
-	queryResolver, queryError := createQueryResolver(cfg, redisClient)
+	metrics.RegisterEventListeners()
+
+	queryResolver, queryError := NewQueryResolver(cfg)
 	if queryError != nil {
 		return nil, queryError
 	}
@@ -96,7 +141,12 @@ func NewServer(cfg *config.Config) (server *Server, err error) {
 		cfg:            cfg,
 		httpListeners:  httpListeners,
 		httpsListeners: httpsListeners,
+		tlsConfig:      tlsConfig,
 		httpMux:        router,
+		healthProbe:    newHealthProbe(cfg.HealthProbe, queryResolver),
+
+		blockPageListeners:      blockPageListeners,
+		blockPageHTTPSListeners: blockPageHTTPSListeners,
 	}
 
 	server.printConfiguration()
@@ -109,6 +159,28 @@ func NewServer(cfg *config.Config) (server *Server, err error) {
 	return server, err
 }
 
+func validateConfig(cfg *config.Config) error {
+	for _, cidr := range cfg.TrustedProxy.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid trusted proxy CIDR '%s': %w", cidr, err)
+		}
+	}
+
+	if cfg.HealthProbe.Domain != "" && cfg.HealthProbe.Interval <= 0 {
+		return errors.New("health probe interval must be greater than 0")
+	}
+
+	if cfg.HealthProbe.Domain != "" && cfg.HealthProbe.FailureThreshold == 0 {
+		return errors.New("health probe failure threshold must be greater than 0")
+	}
+
+	if err := metrics.ValidateConfig(cfg.Prometheus); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createHTTPListeners(cfg *config.Config) (httpListeners []net.Listener, httpsListeners []net.Listener, err error) {
 	httpListeners, err = newListeners("http", cfg.HTTPPorts)
 	if err != nil {
@@ -120,6 +192,12 @@ func createHTTPListeners(cfg *config.Config) (httpListeners []net.Listener, http
 		return nil, nil, err
 	}
 
+	httpsLimiter := newConnectionLimiter("https", cfg.ConnectionLimits)
+
+	for i, listener := range httpsListeners {
+		httpsListeners[i] = httpsLimiter.limit(listener)
+	}
+
 	return httpListeners, httpsListeners, nil
 }
 
@@ -127,7 +205,17 @@ func newListeners(proto string, addresses config.ListenConfig) ([]net.Listener,
 	listeners := make([]net.Listener, 0, len(addresses))
 
 	for _, address := range addresses {
-		listener, err := net.Listen("tcp", getServerAddress(address))
+		var (
+			listener net.Listener
+			err      error
+		)
+
+		if isUnixSocket(address) {
+			listener, err = listenUnixSocket(address)
+		} else {
+			listener, err = net.Listen("tcp", getServerAddress(address))
+		}
+
 		if err != nil {
 			return nil, fmt.Errorf("start %s listener on %s failed: %w", proto, address, err)
 		}
@@ -150,22 +238,39 @@ func registerResolverAPIEndpoints(router chi.Router, res resolver.Resolver) {
 	}
 }
 
-func createTLSServer(address string, certFile string, keyFile string) *dns.Server {
-	cer, err := tls.LoadX509KeyPair(certFile, keyFile)
-	util.FatalOnError("can't load certificate files: ", err)
+// newTLSConfig loads the certificate, if a TLS endpoint (DoT, HTTPS) is configured
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if len(cfg.TLSPorts) == 0 && len(cfg.HTTPSPorts) == 0 && len(cfg.Blocking.BlockPage.HTTPSPort) == 0 {
+		return nil, nil
+	}
+
+	cert, err := loadCertificate(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func createTLSServer(address string, tlsConfig *tls.Config, limiter *connectionLimiter) (*dns.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("start tls listener on %s failed: %w", address, err)
+	}
 
 	return &dns.Server{
-		Addr: address,
-		Net:  "tcp-tls",
-		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{cer},
-			MinVersion:   tls.VersionTLS12,
-		},
-		Handler: dns.NewServeMux(),
+		Addr:      address,
+		Net:       "tcp-tls",
+		Listener:  tls.NewListener(limiter.limit(listener), tlsConfig),
+		TLSConfig: tlsConfig,
+		Handler:   dns.NewServeMux(),
 		NotifyStartedFunc: func() {
 			logger().Infof("TLS server is up and running on address %s", address)
 		},
-	}
+	}, nil
 }
 
 func createTCPServer(address string) *dns.Server {
@@ -190,31 +295,92 @@ func createUDPServer(address string) *dns.Server {
 		UDPSize: 65535}
 }
 
+// NewQueryResolver creates the resolver chain of the passed config without DNS or HTTP listeners
+func NewQueryResolver(cfg *config.Config) (resolver.Resolver, error) {
+	redisClient, redisErr := redis.New(&cfg.Redis)
+	if redisErr != nil && cfg.Redis.Required {
+		return nil, redisErr
+	}
+
+	return createQueryResolver(cfg, redisClient)
+}
+
 func createQueryResolver(cfg *config.Config, redisClient *redis.Client) (resolver.Resolver, error) {
 	br, brErr := resolver.NewBlockingResolver(cfg.Blocking, redisClient)
+	upstreams := resolver.NewUpstreamSettings(cfg)
 
-	return resolver.Chain(
+	return resolver.ChainWithSettings(resolver.NewChainSettings(cfg),
+		resolver.NewClientACLResolver(cfg.ClientACL),
+		resolver.NewEDNSDebugTagResolver(cfg.EDNSDebugTag),
+		resolver.NewQueryNameLimitsResolver(cfg.QueryNameLimits),
+		resolver.NewNameNormalizingResolver(),
 		resolver.NewIPv6Checker(cfg.DisableIPv6),
-		resolver.NewClientNamesResolver(cfg.ClientLookup),
+		resolver.NewClientNamesResolver(cfg.ClientLookup, upstreams),
 		resolver.NewQueryLoggingResolver(cfg.QueryLog),
 		resolver.NewMetricsResolver(cfg.Prometheus),
+		resolver.NewBlockingStatisticsResolver(cfg.BlockingStatistics),
+		resolver.NewLoopDetectionResolver(cfg.LoopDetection),
+		resolver.NewQueryQuotaResolver(cfg.QueryQuota),
+		resolver.NewIdentityResolver(cfg.Identity),
+		resolver.NewUpstreamOverrideResolver(cfg.UpstreamOverride, cfg.Upstream.ExternalResolvers, upstreams),
+		resolver.NewSearchDomainResolver(cfg.SearchDomains),
 		resolver.NewCustomDNSResolver(cfg.CustomDNS),
 		resolver.NewHostsFileResolver(cfg.HostsFile),
+		resolver.NewSecondaryZoneResolver(cfg.SecondaryZones),
+		resolver.NewMDNSResolver(cfg.MDNS),
+		resolver.NewRootQueryResolver(cfg.RootQueries),
 		br,
+		resolver.NewUpstreamAnswerOrderResolver(cfg.UpstreamAnswerOrder),
 		resolver.NewCachingResolver(cfg.Caching, redisClient),
-		resolver.NewConditionalUpstreamResolver(cfg.Conditional),
-		resolver.NewParallelBestResolver(cfg.Upstream.ExternalResolvers),
+		resolver.NewUpstreamLimitingResolver(cfg.UpstreamLimit),
+		resolver.NewConditionalUpstreamResolver(cfg.Conditional, upstreams),
+		resolver.NewParallelBestResolver(cfg.Upstream.ExternalResolvers, upstreams),
 	), brErr
 }
 
 func (s *Server) registerDNSHandlers() {
 	for _, server := range s.dnsServers {
+		// messages with multiple questions are handled by checkQuestions
+		server.MsgAcceptFunc = acceptMsg
+
 		handler := server.Handler.(*dns.ServeMux)
 		handler.HandleFunc(".", s.OnRequest)
 		handler.HandleFunc("healthcheck.blocky", s.OnHealthCheck)
 	}
 }
 
+// acceptMsg accepts messages like dns.DefaultMsgAcceptFunc, but also messages with more than one question
+func acceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	if dh.Qdcount > 1 {
+		dh.Qdcount = 1
+	}
+
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// checkQuestions returns a FORMERR response for messages without exactly one question. Depending on the
+// configuration, only the first question of messages with multiple questions is kept instead
+func (s *Server) checkQuestions(request *dns.Msg) *dns.Msg {
+	if len(request.Question) == 1 {
+		return nil
+	}
+
+	if len(request.Question) > 1 && s.cfg.MultipleQuestions == config.MultipleQuestionsModeFirst {
+		logger().Debugf("ignoring %d additional questions of the message", len(request.Question)-1)
+
+		request.Question = request.Question[:1]
+
+		return nil
+	}
+
+	logger().Debugf("refusing message with %d questions", len(request.Question))
+
+	response := new(dns.Msg)
+	response.SetRcodeFormatError(request)
+
+	return response
+}
+
 func (s *Server) printConfiguration() {
 	logger().Info("current configuration:")
 
@@ -238,6 +404,16 @@ func (s *Server) printConfiguration() {
 	logger().Infof("- HTTP listening on addrs/ports: %v", s.cfg.HTTPPorts)
 	logger().Infof("- HTTPS listening on addrs/ports: %v", s.cfg.HTTPSPorts)
 
+	if limits := s.cfg.ConnectionLimits; limits.MaxConnections > 0 || limits.MaxConnectionsPerIP > 0 {
+		logger().Infof("- TLS/HTTPS connection limits: max %d, max per IP %d",
+			limits.MaxConnections, limits.MaxConnectionsPerIP)
+	}
+
+	if s.cfg.Blocking.BlockPage.IsEnabled() {
+		logger().Infof("- block page listening on addrs/ports: %v (HTTP), %v (HTTPS)",
+			s.cfg.Blocking.BlockPage.Port, s.cfg.Blocking.BlockPage.HTTPSPort)
+	}
+
 	logger().Info("runtime information:")
 
 	// force garbage collector
@@ -269,7 +445,13 @@ func (s *Server) Start() {
 		srv := srv
 
 		go func() {
-			if err := srv.ListenAndServe(); err != nil {
+			serve := srv.ListenAndServe
+			if srv.Listener != nil {
+				// listener was already created (unix domain socket, TLS)
+				serve = srv.ActivateAndServe
+			}
+
+			if err := serve(); err != nil {
 				logger().Fatalf("start %s listener failed: %v", srv.Net, err)
 			}
 		}()
@@ -294,14 +476,64 @@ func (s *Server) Start() {
 		go func() {
 			logger().Infof("https server is up and running on addr/port %s", address)
 
-			err := http.ServeTLS(listener, s.httpMux, s.cfg.CertFile, s.cfg.KeyFile)
+			err := s.serveTLS(listener, s.httpMux)
 			util.FatalOnError("start https listener failed: ", err)
 		}()
 	}
 
+	s.startBlockPage()
+
+	if s.healthProbe.enabled() {
+		go s.healthProbe.run()
+	}
+
 	registerPrintConfigurationTrigger(s)
 }
 
+// serveTLS serves HTTPS requests with the loaded certificate
+func (s *Server) serveTLS(listener net.Listener, handler http.Handler) error {
+	srv := &http.Server{
+		Handler:           handler,
+		TLSConfig:         s.tlsConfig,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+
+	return srv.ServeTLS(listener, "", "")
+}
+
+// startBlockPage starts the listeners of the block page
+func (s *Server) startBlockPage() {
+	if len(s.blockPageListeners) == 0 && len(s.blockPageHTTPSListeners) == 0 {
+		return
+	}
+
+	handler := newBlockPageHandler(findBlockedRequestProvider(s.queryResolver))
+
+	for i, listener := range s.blockPageListeners {
+		listener := listener
+		address := s.cfg.Blocking.BlockPage.Port[i]
+
+		go func() {
+			logger().Infof("block page is up and running on addr/port %s", address)
+
+			err := http.Serve(listener, handler)
+			util.FatalOnError("start block page listener failed: ", err)
+		}()
+	}
+
+	for i, listener := range s.blockPageHTTPSListeners {
+		listener := listener
+		address := s.cfg.Blocking.BlockPage.HTTPSPort[i]
+
+		go func() {
+			logger().Infof("https block page is up and running on addr/port %s", address)
+
+			err := s.serveTLS(listener, handler)
+			util.FatalOnError("start https block page listener failed: ", err)
+		}()
+	}
+}
+
 // Stop stops the server
 func (s *Server) Stop() {
 	logger().Info("Stopping server")
@@ -311,6 +543,11 @@ func (s *Server) Stop() {
 			logger().Fatalf("stop %s listener failed: %v", server.Net, err)
 		}
 	}
+
+	removeUnixSockets(s.cfg.DNSPorts, s.cfg.HTTPPorts, s.cfg.HTTPSPorts,
+		s.cfg.Blocking.BlockPage.Port, s.cfg.Blocking.BlockPage.HTTPSPort)
+
+	resolver.Close(s.queryResolver)
 }
 
 func createResolverRequest(rw dns.ResponseWriter, request *dns.Msg) *model.Request {
@@ -332,6 +569,32 @@ func createResolverRequest(rw dns.ResponseWriter, request *dns.Msg) *model.Reque
 	return newRequest(clientIP, protocol, extractClientIDFromHost(hostName), request)
 }
 
+func isTLSConnection(rw dns.ResponseWriter) bool {
+	con, ok := rw.(dns.ConnectionStater)
+
+	return ok && con.ConnectionState() != nil
+}
+
+// authenticateClient returns the client name for the token. Without configured tokens, every client is accepted
+// and the token is used as client ID
+func (s *Server) authenticateClient(token string) (clientName string, ok bool) {
+	tokens := s.cfg.ClientAuth.Tokens
+	if len(tokens) == 0 {
+		return token, true
+	}
+
+	clientName, ok = tokens[token]
+
+	return clientName, ok
+}
+
+func refusedResponse(request *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetRcode(request, dns.RcodeRefused)
+
+	return response
+}
+
 func extractClientIDFromHost(hostName string) string {
 	const clientIDPrefix = "id-"
 	if strings.HasPrefix(hostName, clientIDPrefix) && strings.Contains(hostName, ".") {
@@ -360,9 +623,26 @@ func newRequest(clientIP net.IP, protocol model.RequestProtocol,
 func (s *Server) OnRequest(w dns.ResponseWriter, request *dns.Msg) {
 	logger().Debug("new request")
 
+	if response := s.checkQuestions(request); response != nil {
+		err := w.WriteMsg(response)
+		util.LogOnError("can't write message: ", err)
+
+		return
+	}
+
 	r := createResolverRequest(w, request)
 
-	response, err := s.queryResolver.Resolve(r)
+	// the server name (SNI) of DoT is sent unencrypted, it can't contain a secret token
+	if isTLSConnection(w) && len(s.cfg.ClientAuth.Tokens) > 0 {
+		logger().Warnf("refusing DoT request from %s, client tokens are only accepted via DoH", r.ClientIP)
+
+		err := w.WriteMsg(refusedResponse(request))
+		util.LogOnError("can't write message: ", err)
+
+		return
+	}
+
+	response, err := resolver.Resolve(s.queryResolver, r)
 
 	if err != nil {
 		logger().Errorf("error on processing request: %v", err)
@@ -385,17 +665,18 @@ func (s *Server) OnRequest(w dns.ResponseWriter, request *dns.Msg) {
 	}
 }
 
-// returns EDNS upd size or if not present, 512 for UDP and 64K for TCP
+// returns 64K for TCP, for UDP the EDNS udp size or if not present 512
 func getMaxResponseSize(network string, request *dns.Msg) int {
+	// the EDNS udp size doesn't limit TCP responses (e.g. large DNSSEC answers after truncation via UDP)
+	if network == "tcp" {
+		return dns.MaxMsgSize
+	}
+
 	edns := request.IsEdns0()
 	if edns != nil && edns.UDPSize() > 0 {
 		return int(edns.UDPSize())
 	}
 
-	if network == "tcp" {
-		return dns.MaxMsgSize
-	}
-
 	return dns.MinMsgSize
 }
 
@@ -414,6 +695,9 @@ func resolveClientIPAndProtocol(addr net.Addr) (ip net.IP, protocol model.Reques
 		return t.IP, model.RequestProtocolUDP
 	} else if t, ok := addr.(*net.TCPAddr); ok {
 		return t.IP, model.RequestProtocolTCP
+	} else if _, ok := addr.(*net.UnixAddr); ok {
+		// unix domain socket clients are always local
+		return net.IPv4(127, 0, 0, 1), model.RequestProtocolTCP
 	}
 
 	return nil, model.RequestProtocolUDP
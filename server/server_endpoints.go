@@ -14,6 +14,7 @@ import (
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/log"
 	"github.com/0xERR0R/blocky/model"
+	"github.com/0xERR0R/blocky/resolver"
 	"github.com/0xERR0R/blocky/util"
 	"github.com/0xERR0R/blocky/web"
 
@@ -26,10 +27,16 @@ import (
 const (
 	dohMessageLimit = 512
 	dnsContentType  = "application/dns-message"
+	jsonContentType = "application/json"
+	textContentType = "text/plain"
+
+	// gzip level of the compressed REST API responses, a compromise of speed and size
+	apiCompressionLevel = 5
 )
 
 func (s *Server) registerAPIEndpoints(router *chi.Mux) {
 	router.Post(api.PathQueryPath, s.apiQuery)
+	router.Get(api.PathResolversPath, s.apiResolvers)
 
 	router.Get(api.PathDohQuery, s.dohGetRequestHandler)
 	router.Get(api.PathDohQuery+"/", s.dohGetRequestHandler)
@@ -37,6 +44,20 @@ func (s *Server) registerAPIEndpoints(router *chi.Mux) {
 	router.Post(api.PathDohQuery, s.dohPostRequestHandler)
 	router.Post(api.PathDohQuery+"/", s.dohPostRequestHandler)
 	router.Post(api.PathDohQuery+"/{clientID}", s.dohPostRequestHandler)
+
+	router.Get(api.PathReadiness, s.readinessHandler)
+}
+
+// readinessHandler returns 503 if the health probe fails consistently
+func (s *Server) readinessHandler(rw http.ResponseWriter, _ *http.Request) {
+	if !s.healthProbe.ready() {
+		http.Error(rw, "health probe failed", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	_, err := rw.Write([]byte("OK"))
+	logAndResponseWithError(err, "can't write response: ", rw)
 }
 
 func (s *Server) dohGetRequestHandler(rw http.ResponseWriter, req *http.Request) {
@@ -98,26 +119,64 @@ func (s *Server) processDohMessage(rawMsg []byte, rw http.ResponseWriter, req *h
 		return
 	}
 
-	clientID := chi.URLParam(req, "clientID")
-	if clientID == "" {
-		clientID = extractClientIDFromHost(req.Host)
+	if response := s.checkQuestions(msg); response != nil {
+		writeDohResponse(response, rw)
+
+		return
 	}
 
-	r := newRequest(net.ParseIP(extractIP(req)), model.RequestProtocolTCP, clientID, msg)
+	clientIP := s.extractClientIP(req, msg)
+
+	clientID, ok := s.authenticateClient(s.extractDohClientID(req))
+	if !ok {
+		logger().Warnf("refusing DoH request from %s without valid client token", clientIP)
 
-	resResponse, err := s.queryResolver.Resolve(r)
+		writeDohResponse(refusedResponse(msg), rw)
+
+		return
+	}
+
+	r := newRequest(clientIP, model.RequestProtocolTCP, clientID, msg)
+
+	resResponse, err := resolver.Resolve(s.queryResolver, r)
 
 	if err != nil {
 		logAndResponseWithError(err, "unable to process query: ", rw)
 		return
 	}
 
-	response := new(dns.Msg)
-	response.SetReply(msg)
+	writeDohResponse(resResponse.Res, rw)
+}
+
+// extractDohClientID returns the client ID from the URL path or the host name. If client tokens are configured,
+// the token is only read from the URL path or the authorization header: the host name is also sent unencrypted
+// as server name (SNI)
+func (s *Server) extractDohClientID(req *http.Request) string {
+	if clientID := chi.URLParam(req, "clientID"); clientID != "" {
+		return clientID
+	}
+
+	if len(s.cfg.ClientAuth.Tokens) > 0 {
+		const bearerPrefix = "Bearer "
+
+		if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, bearerPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(auth, bearerPrefix))
+		}
+
+		return ""
+	}
+
+	return extractClientIDFromHost(req.Host)
+}
+
+func writeDohResponse(res *dns.Msg, rw http.ResponseWriter) {
+	// like via TCP, the DNS message of a DoH response is limited to 64K (RFC 8484)
+	res.Truncate(dns.MaxMsgSize)
+
 	// enable compression
-	resResponse.Res.Compress = true
+	res.Compress = true
 
-	b, err := resResponse.Res.Pack()
+	b, err := res.Pack()
 	if err != nil {
 		logAndResponseWithError(err, "can't serialize message: ", rw)
 		return
@@ -129,22 +188,103 @@ func (s *Server) processDohMessage(rawMsg []byte, rw http.ResponseWriter, req *h
 	logAndResponseWithError(err, "can't write response: ", rw)
 }
 
-func extractIP(r *http.Request) string {
-	hostPort := r.Header.Get("X-FORWARDED-FOR")
+// extractClientIP returns the IP of the real client. The configured header and the EDNS0 client subnet option
+// are only taken into account if the request was sent by a trusted proxy.
+func (s *Server) extractClientIP(r *http.Request, msg *dns.Msg) net.IP {
+	remoteIP := parseIP(r.RemoteAddr)
 
-	if hostPort == "" {
-		hostPort = r.RemoteAddr
+	if !s.isTrustedProxy(remoteIP) {
+		return remoteIP
 	}
 
-	hostPort = strings.ReplaceAll(hostPort, "[", "")
-	hostPort = strings.ReplaceAll(hostPort, "]", "")
-	index := strings.LastIndex(hostPort, ":")
+	if ip := s.extractIPFromHeader(r); ip != nil {
+		return ip
+	}
 
-	if index >= 0 {
-		return hostPort[:index]
+	if s.cfg.TrustedProxy.UseEDNS0ClientSubnet {
+		if ip := extractIPFromClientSubnet(msg); ip != nil {
+			return ip
+		}
 	}
 
-	return hostPort
+	return remoteIP
+}
+
+// isTrustedProxy checks if the passed IP belongs to a trusted proxy. If no proxies are configured,
+// all clients are trusted
+func (s *Server) isTrustedProxy(ip net.IP) bool {
+	if len(s.cfg.TrustedProxy.CIDRs) == 0 {
+		return true
+	}
+
+	for _, cidr := range s.cfg.TrustedProxy.CIDRs {
+		if util.CidrContainsIP(cidr, ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extractIPFromHeader returns the first address in the header which doesn't belong to a trusted proxy,
+// starting with the nearest hop
+func (s *Server) extractIPFromHeader(r *http.Request) net.IP {
+	header := s.cfg.TrustedProxy.Header
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+
+	value := r.Header.Get(header)
+	if value == "" {
+		return nil
+	}
+
+	var hops []net.IP
+
+	for _, part := range strings.Split(value, ",") {
+		if ip := parseIP(strings.TrimSpace(part)); ip != nil {
+			hops = append(hops, ip)
+		}
+	}
+
+	if len(hops) == 0 {
+		return nil
+	}
+
+	if len(s.cfg.TrustedProxy.CIDRs) > 0 {
+		for i := len(hops) - 1; i >= 0; i-- {
+			if !s.isTrustedProxy(hops[i]) {
+				return hops[i]
+			}
+		}
+	}
+
+	return hops[0]
+}
+
+func extractIPFromClientSubnet(msg *dns.Msg) net.IP {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok && subnet.Address != nil && !subnet.Address.IsUnspecified() {
+				return subnet.Address
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseIP parses an IP address with optional port
+func parseIP(hostPort string) net.IP {
+	if ip := net.ParseIP(hostPort); ip != nil {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.Trim(hostPort, "[]"))
 }
 
 // apiQuery is the http endpoint to perform a DNS query
@@ -185,7 +325,7 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 	dnsRequest := util.NewMsgWithQuestion(query, qType)
 	r := createResolverRequest(nil, dnsRequest)
 
-	response, err := s.queryResolver.Resolve(r)
+	response, err := resolver.ResolveWithTimings(s.queryResolver, r)
 
 	if err != nil {
 		logAndResponseWithError(err, "unable to process query: ", rw)
@@ -197,16 +337,75 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 		ResponseType: response.RType.String(),
 		Response:     util.AnswerToString(response.Res.Answer),
 		ReturnCode:   dns.RcodeToString[response.Res.Rcode],
+		Timings:      toAPITimings(r.Timings),
 	})
+	rw.Header().Set("Content-Type", jsonContentType)
 	_, err = rw.Write(jsonResponse)
 	logAndResponseWithError(err, "unable to write response: ", rw)
 }
 
+// apiResolvers is the http endpoint to list the resolvers of the chain
+// @Summary Resolver chain
+// @Description lists the resolvers in processing order with their configuration, credentials are redacted
+// @Tags resolvers
+// @Produce  json
+// @Success 200 {array} api.ResolverInfo "resolvers of the chain"
+// @Router /resolvers [get]
+func (s *Server) apiResolvers(rw http.ResponseWriter, _ *http.Request) {
+	jsonResponse, _ := json.Marshal(resolverChainInfo(s.queryResolver))
+	rw.Header().Set("Content-Type", jsonContentType)
+	_, err := rw.Write(jsonResponse)
+	logAndResponseWithError(err, "unable to write response: ", rw)
+}
+
+// resolverChainInfo returns the resolvers of the chain in processing order
+func resolverChainInfo(res resolver.Resolver) []api.ResolverInfo {
+	result := []api.ResolverInfo{}
+
+	for res != nil {
+		cfg := res.Configuration()
+		if cfg == nil {
+			cfg = []string{}
+		}
+
+		result = append(result, api.ResolverInfo{
+			Name:          resolver.Name(res),
+			Active:        !(len(cfg) == 1 && cfg[0] == "deactivated"),
+			Configuration: cfg,
+		})
+
+		cr, ok := res.(resolver.ChainedResolver)
+		if !ok {
+			break
+		}
+
+		res = cr.GetNext()
+	}
+
+	return result
+}
+
+func toAPITimings(timings *model.ResolverTimings) []api.ResolverTiming {
+	result := make([]api.ResolverTiming, 0, len(timings.Entries))
+
+	for _, t := range timings.Entries {
+		result = append(result, api.ResolverTiming{
+			Resolver:   t.Resolver,
+			DurationMs: float64(t.Duration.Microseconds()) / 1000,
+			TotalMs:    float64(t.Total.Microseconds()) / 1000,
+		})
+	}
+
+	return result
+}
+
 func createRouter(cfg *config.Config) *chi.Mux {
 	router := chi.NewRouter()
 
 	configureCorsHandler(router)
 
+	configureCompressionHandler(router)
+
 	configureDebugHandler(router)
 
 	configureRootHandler(cfg, router)
@@ -269,6 +468,27 @@ func configureDebugHandler(router *chi.Mux) {
 	router.Mount("/debug", middleware.Profiler())
 }
 
+// configureCompressionHandler compresses the JSON and text (list export) responses of the REST API, if the client
+// accepts it (Accept-Encoding). The handlers set the content type. Responses of other endpoints (e.g. DoH, metrics)
+// are not changed
+func configureCompressionHandler(router *chi.Mux) {
+	compress := middleware.Compress(apiCompressionLevel, jsonContentType, textContentType)
+
+	router.Use(func(next http.Handler) http.Handler {
+		compressed := compress(next)
+
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !strings.HasPrefix(req.URL.Path, "/api/") {
+				next.ServeHTTP(rw, req)
+
+				return
+			}
+
+			compressed.ServeHTTP(rw, req)
+		})
+	})
+}
+
 func configureCorsHandler(router *chi.Mux) {
 	crs := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API response compression", func() {
+	body := `{"entries":["` + strings.Repeat("example.com", 100) + `"]}`
+
+	request := func(path, contentType, acceptEncoding string) *httptest.ResponseRecorder {
+		router := createRouter(&config.Config{})
+		router.Get(path, func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Header().Set("Content-Type", contentType)
+			_, _ = rw.Write([]byte(body))
+		})
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	When("the client accepts gzip", func() {
+		It("should compress the JSON response", func() {
+			rr := request("/api/cache/entries", "application/json", "gzip, deflate")
+
+			Expect(rr.Code).Should(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+			Expect(rr.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+			reader, err := gzip.NewReader(rr.Body)
+			Expect(err).Should(Succeed())
+
+			uncompressed, err := io.ReadAll(reader)
+			Expect(err).Should(Succeed())
+			Expect(string(uncompressed)).Should(Equal(body))
+		})
+
+		It("should compress the text response and keep its content type", func() {
+			rr := request("/api/lists/export", "text/plain; charset=utf-8", "gzip")
+
+			Expect(rr.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+			Expect(rr.Header().Get("Content-Type")).Should(Equal("text/plain; charset=utf-8"))
+		})
+
+		It("should not compress responses with other content types", func() {
+			rr := request("/api/other", "application/octet-stream", "gzip")
+
+			Expect(rr.Header().Get("Content-Encoding")).Should(BeEmpty())
+			Expect(rr.Header().Get("Content-Type")).Should(Equal("application/octet-stream"))
+			Expect(rr.Body.String()).Should(Equal(body))
+		})
+
+		It("should not compress responses of other endpoints", func() {
+			rr := request("/other", "application/json", "gzip")
+
+			Expect(rr.Header().Get("Content-Encoding")).Should(BeEmpty())
+			Expect(rr.Body.String()).Should(Equal(body))
+		})
+	})
+
+	When("the client doesn't accept gzip", func() {
+		It("should return the uncompressed response", func() {
+			rr := request("/api/cache/entries", "application/json", "")
+
+			Expect(rr.Header().Get("Content-Encoding")).Should(BeEmpty())
+			Expect(rr.Header().Get("Content-Type")).Should(Equal("application/json"))
+			Expect(rr.Body.String()).Should(Equal(body))
+		})
+	})
+})
+
+var _ = Describe("DoH response", func() {
+	// returns a response with a CNAME chain of deep sub domains and the A records of the last name
+	largeResponse := func(records int) *dns.Msg {
+		res := new(dns.Msg)
+		res.SetQuestion("a.very.long.domain.name.to.test.the.name.compression.example.com.", dns.TypeA)
+		res.Response = true
+
+		name := res.Question[0].Name
+		for i := 0; i < 20; i++ {
+			target := fmt.Sprintf("level-%d.%s", i, name)
+			res.Answer = append(res.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: target,
+			})
+			name = target
+		}
+
+		for i := 0; i < records; i++ {
+			res.Answer = append(res.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)),
+			})
+		}
+
+		return res
+	}
+
+	write := func(res *dns.Msg) (*dns.Msg, int) {
+		rr := httptest.NewRecorder()
+		writeDohResponse(res, rr)
+
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+
+		msg := new(dns.Msg)
+		Expect(msg.Unpack(rr.Body.Bytes())).Should(Succeed())
+
+		return msg, rr.Body.Len()
+	}
+
+	When("the response fits in 64K only with name compression", func() {
+		It("should return all records without corruption", func() {
+			expected := largeResponse(3000)
+			Expect(expected.Len()).Should(BeNumerically(">", dns.MaxMsgSize))
+
+			msg, size := write(largeResponse(3000))
+			Expect(size).Should(BeNumerically("<=", dns.MaxMsgSize))
+			Expect(msg.Truncated).Should(BeFalse())
+			Expect(msg.Question).Should(Equal(expected.Question))
+			Expect(msg.Answer).Should(HaveLen(len(expected.Answer)))
+
+			for i, rr := range msg.Answer {
+				Expect(rr.String()).Should(Equal(expected.Answer[i].String()))
+			}
+		})
+	})
+
+	When("the compressed response is larger than 64K", func() {
+		It("should truncate the response", func() {
+			msg, size := write(largeResponse(10000))
+			Expect(size).Should(BeNumerically("<=", dns.MaxMsgSize))
+			Expect(msg.Truncated).Should(BeTrue())
+			Expect(msg.Answer).ShouldNot(BeEmpty())
+		})
+	})
+})
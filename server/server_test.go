@@ -2,11 +2,13 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"time"
 
@@ -277,6 +279,17 @@ var _ = Describe("Running DNS server", func() {
 			})
 		})
 	})
+	Describe("Readiness endpoint", func() {
+		When("Readiness URL is called", func() {
+			It("should return OK if health probe is not configured", func() {
+				r, err := http.Get("http://localhost:4000/readyz")
+				Expect(err).Should(Succeed())
+				defer r.Body.Close()
+				Expect(r).Should(HaveHTTPStatus(http.StatusOK))
+			})
+		})
+	})
+
 	Describe("Root endpoint", func() {
 		When("Root URL is called", func() {
 			It("should return root page", func() {
@@ -287,6 +300,32 @@ var _ = Describe("Running DNS server", func() {
 		})
 	})
 
+	Describe("Resolvers Rest API", func() {
+		When("Resolvers API is called", func() {
+			It("should return the resolvers of the chain in processing order", func() {
+				resp, err := http.Get("http://localhost:4000/api/resolvers")
+				Expect(err).Should(Succeed())
+				defer resp.Body.Close()
+
+				Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+
+				var result []api.ResolverInfo
+				err = json.NewDecoder(resp.Body).Decode(&result)
+				Expect(err).Should(Succeed())
+				Expect(result).ShouldNot(BeEmpty())
+				Expect(result[0]).Should(Equal(api.ResolverInfo{
+					Name: "ClientACLResolver", Active: false, Configuration: []string{"deactivated"},
+				}))
+				Expect(result[len(result)-1].Name).Should(Equal("ParallelBestResolver"))
+				Expect(result).Should(ContainElement(And(
+					HaveField("Name", "BlockingResolver"),
+					HaveField("Active", true),
+					HaveField("Configuration", ContainElement("clientGroupsBlock")),
+				)))
+			})
+		})
+	})
+
 	Describe("Query Rest API", func() {
 		When("Query API is called", func() {
 			It("Should process the query", func() {
@@ -308,6 +347,25 @@ var _ = Describe("Running DNS server", func() {
 				Expect(err).Should(Succeed())
 				Expect(result.Response).Should(Equal("A (123.124.122.122)"))
 			})
+			It("Should return the time spent in each resolver", func() {
+				req := api.QueryRequest{
+					Query: "google.de",
+					Type:  "A",
+				}
+				jsonValue, _ := json.Marshal(req)
+
+				resp, err := http.Post("http://localhost:4000/api/query", "application/json", bytes.NewBuffer(jsonValue))
+
+				Expect(err).Should(Succeed())
+				defer resp.Body.Close()
+
+				var result api.QueryResult
+				err = json.NewDecoder(resp.Body).Decode(&result)
+				Expect(err).Should(Succeed())
+				Expect(result.Timings).ShouldNot(BeEmpty())
+				Expect(result.Timings[0].Resolver).Should(Equal("ClientACLResolver"))
+				Expect(result.Timings).Should(ContainElement(HaveField("Resolver", "CachingResolver")))
+			})
 		})
 		When("Wrong request type is used", func() {
 			It("Should return internal error", func() {
@@ -489,12 +547,247 @@ var _ = Describe("Running DNS server", func() {
 		})
 	})
 
+	Describe("Client tokens", func() {
+		BeforeEach(func() {
+			sut.cfg.ClientAuth.Tokens = map[string]string{"secret123": "clYoutubeOnly"}
+			DeferCleanup(func() { sut.cfg.ClientAuth.Tokens = nil })
+		})
+
+		dohRequest := func(url, authorization string, host ...string) *dns.Msg {
+			rawDNSMessage, err := util.NewMsgWithQuestion("youtube.com.", dns.TypeA).Pack()
+			Expect(err).Should(Succeed())
+
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(rawDNSMessage))
+			Expect(err).Should(Succeed())
+			req.Header.Set("Content-Type", "application/dns-message")
+
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+
+			if len(host) == 1 {
+				req.Host = host[0]
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).Should(Succeed())
+			defer resp.Body.Close()
+			Expect(resp).Should(HaveHTTPStatus(http.StatusOK))
+
+			rawMsg, err := ioutil.ReadAll(resp.Body)
+			Expect(err).Should(Succeed())
+
+			msg := new(dns.Msg)
+			Expect(msg.Unpack(rawMsg)).Should(Succeed())
+
+			return msg
+		}
+
+		dotRequest := func(serverName string) *dns.Msg {
+			client := dns.Client{
+				Net:       "tcp-tls",
+				TLSConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}, // nolint:gosec
+			}
+
+			msg, _, err := client.Exchange(util.NewMsgWithQuestion("youtube.com.", dns.TypeA), "localhost:8853")
+			Expect(err).Should(Succeed())
+
+			return msg
+		}
+
+		When("DoH request contains a valid token", func() {
+			It("should use the client name of the token from the URL path", func() {
+				msg := dohRequest("http://localhost:4000/dns-query/secret123", "")
+
+				Expect(msg.Answer).Should(BeDNSRecord("youtube.com.", dns.TypeA, 0, "0.0.0.0"))
+			})
+			It("should use the client name of the token from the authorization header", func() {
+				msg := dohRequest("http://localhost:4000/dns-query", "Bearer secret123")
+
+				Expect(msg.Answer).Should(BeDNSRecord("youtube.com.", dns.TypeA, 0, "0.0.0.0"))
+			})
+		})
+
+		When("DoH request doesn't contain a valid token", func() {
+			It("should refuse the request", func() {
+				msg := dohRequest("http://localhost:4000/dns-query/wrong", "")
+				Expect(msg.Rcode).Should(Equal(dns.RcodeRefused))
+
+				msg = dohRequest("http://localhost:4000/dns-query", "")
+				Expect(msg.Rcode).Should(Equal(dns.RcodeRefused))
+			})
+		})
+
+		When("DoH request contains the token in the host name", func() {
+			It("should refuse the request, the host name is not secret", func() {
+				msg := dohRequest("http://localhost:4000/dns-query", "", "id-secret123.blocky.lan")
+
+				Expect(msg.Rcode).Should(Equal(dns.RcodeRefused))
+			})
+		})
+
+		When("DoT is used", func() {
+			It("should refuse the request, the server name is not secret", func() {
+				Expect(dotRequest("id-secret123.blocky.lan").Rcode).Should(Equal(dns.RcodeRefused))
+				Expect(dotRequest("blocky.lan").Rcode).Should(Equal(dns.RcodeRefused))
+			})
+		})
+
+		When("plain DNS is used", func() {
+			It("should not require a token", func() {
+				resp := requestServer(util.NewMsgWithQuestion("www.example.com.", dns.TypeA))
+
+				Expect(resp.Rcode).Should(Equal(dns.RcodeSuccess))
+			})
+		})
+	})
+
+	Describe("Multiple questions", func() {
+		var msg *dns.Msg
+
+		BeforeEach(func() {
+			msg = util.NewMsgWithQuestion("google.de.", dns.TypeA)
+			msg.Question = append(msg.Question, dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		})
+
+		When("mode is 'refuse'", func() {
+			It("should answer with FORMERR", func() {
+				resp := requestServer(msg)
+				Expect(resp.Rcode).Should(Equal(dns.RcodeFormatError))
+				Expect(resp.Answer).Should(BeEmpty())
+			})
+
+			It("should answer DoH requests with FORMERR", func() {
+				rawDNSMessage, err := msg.Pack()
+				Expect(err).Should(Succeed())
+
+				resp, err := http.Post("http://localhost:4000/dns-query",
+					"application/dns-message", bytes.NewReader(rawDNSMessage))
+				Expect(err).Should(Succeed())
+				defer resp.Body.Close()
+				Expect(resp).Should(HaveHTTPStatus(http.StatusOK))
+
+				rawMsg, err := ioutil.ReadAll(resp.Body)
+				Expect(err).Should(Succeed())
+
+				response := new(dns.Msg)
+				Expect(response.Unpack(rawMsg)).Should(Succeed())
+				Expect(response.Rcode).Should(Equal(dns.RcodeFormatError))
+			})
+		})
+
+		When("mode is 'first'", func() {
+			BeforeEach(func() {
+				sut.cfg.MultipleQuestions = config.MultipleQuestionsModeFirst
+				DeferCleanup(func() { sut.cfg.MultipleQuestions = config.MultipleQuestionsModeRefuse })
+			})
+
+			It("should resolve only the first question", func() {
+				resp := requestServer(msg)
+				Expect(resp.Rcode).Should(Equal(dns.RcodeSuccess))
+				Expect(resp.Question).Should(HaveLen(1))
+				Expect(resp.Answer).Should(HaveLen(1))
+				Expect(resp.Answer[0].Header().Name).Should(Equal("google.de."))
+			})
+		})
+	})
+
+	Describe("Client IP extraction for DoH", func() {
+		var (
+			srv *Server
+			msg *dns.Msg
+		)
+
+		newHTTPRequest := func(remoteAddr, forwardedFor string) *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/dns-query", nil)
+			req.RemoteAddr = remoteAddr
+
+			if forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+			}
+
+			return req
+		}
+
+		BeforeEach(func() {
+			srv = &Server{cfg: &config.Config{}}
+			msg = util.NewMsgWithQuestion("example.com.", dns.TypeA)
+		})
+
+		When("no trusted proxies are configured", func() {
+			It("should use the remote address if header is not present", func() {
+				ip := srv.extractClientIP(newHTTPRequest("192.168.178.1:1234", ""), msg)
+				Expect(ip).Should(Equal(net.ParseIP("192.168.178.1")))
+			})
+			It("should use the first address from the header", func() {
+				ip := srv.extractClientIP(newHTTPRequest("192.168.178.1:1234", "10.0.0.5, 10.0.0.1"), msg)
+				Expect(ip).Should(Equal(net.ParseIP("10.0.0.5")))
+			})
+			It("should parse IPv6 addresses with and without port", func() {
+				ip := srv.extractClientIP(newHTTPRequest("[2001:db8::1]:1234", ""), msg)
+				Expect(ip).Should(Equal(net.ParseIP("2001:db8::1")))
+
+				ip = srv.extractClientIP(newHTTPRequest("[2001:db8::1]:1234", "2001:db8::2"), msg)
+				Expect(ip).Should(Equal(net.ParseIP("2001:db8::2")))
+			})
+		})
+
+		When("trusted proxies are configured", func() {
+			BeforeEach(func() {
+				srv.cfg.TrustedProxy = config.TrustedProxyConfig{
+					Header: "X-Real-IP",
+					CIDRs:  []string{"192.168.178.0/24", "10.0.0.0/8"},
+				}
+			})
+			It("should ignore the header if request wasn't sent by a trusted proxy", func() {
+				req := newHTTPRequest("172.16.0.1:1234", "")
+				req.Header.Set("X-Real-IP", "1.2.3.4")
+
+				Expect(srv.extractClientIP(req, msg)).Should(Equal(net.ParseIP("172.16.0.1")))
+			})
+			It("should use the configured header if request was sent by a trusted proxy", func() {
+				req := newHTTPRequest("192.168.178.1:1234", "5.6.7.8")
+				req.Header.Set("X-Real-IP", "1.2.3.4")
+
+				Expect(srv.extractClientIP(req, msg)).Should(Equal(net.ParseIP("1.2.3.4")))
+			})
+			It("should skip addresses of trusted proxies in the header", func() {
+				srv.cfg.TrustedProxy.Header = "X-Forwarded-For"
+
+				req := newHTTPRequest("192.168.178.1:1234", "1.1.1.1, 1.2.3.4, 10.0.0.1")
+
+				Expect(srv.extractClientIP(req, msg)).Should(Equal(net.ParseIP("1.2.3.4")))
+			})
+			It("should use the EDNS0 client subnet if enabled and header is not present", func() {
+				srv.cfg.TrustedProxy.UseEDNS0ClientSubnet = true
+
+				msg.SetEdns0(4096, false)
+				opt := msg.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+					Code:          dns.EDNS0SUBNET,
+					Family:        1,
+					SourceNetmask: 32,
+					Address:       net.ParseIP("1.2.3.4"),
+				})
+
+				Expect(srv.extractClientIP(newHTTPRequest("192.168.178.1:1234", ""), msg)).
+					Should(Equal(net.ParseIP("1.2.3.4")))
+
+				By("ignore EDNS0 client subnet from untrusted clients", func() {
+					Expect(srv.extractClientIP(newHTTPRequest("172.16.0.1:1234", ""), msg)).
+						Should(Equal(net.ParseIP("172.16.0.1")))
+				})
+			})
+		})
+	})
+
 	Describe("Server create", func() {
 		var (
 			cfg  config.Config
 			cErr error
 		)
 		BeforeEach(func() {
+			cfg = config.Config{}
 			cErr = defaults.Set(&cfg)
 
 			Expect(cErr).Should(Succeed())
@@ -521,6 +814,43 @@ var _ = Describe("Running DNS server", func() {
 
 				Expect(err).ShouldNot(Succeed())
 			})
+			It("can't be created if health probe interval is invalid", func() {
+				cfg.HealthProbe = config.HealthProbeConfig{Domain: "example.com", Interval: 0}
+
+				_, err := NewServer(&cfg)
+
+				Expect(err).Should(MatchError("health probe interval must be greater than 0"))
+			})
+			It("can't be created if health probe failure threshold is 0", func() {
+				cfg.HealthProbe = config.HealthProbeConfig{
+					Domain: "example.com", Interval: config.Duration(time.Minute), FailureThreshold: 0,
+				}
+
+				_, err := NewServer(&cfg)
+
+				Expect(err).Should(MatchError("health probe failure threshold must be greater than 0"))
+			})
+			It("can't be created if trusted proxy CIDR is invalid", func() {
+				cfg.TrustedProxy.CIDRs = []string{"wrong"}
+
+				_, err := NewServer(&cfg)
+
+				Expect(err).Should(MatchError(ContainSubstring("invalid trusted proxy CIDR")))
+			})
+			It("can't be created if prometheus metric prefix is invalid", func() {
+				cfg.Prometheus.Prefix = "edge-"
+
+				_, err := NewServer(&cfg)
+
+				Expect(err).Should(MatchError("invalid prometheus metric prefix 'edge-'"))
+			})
+			It("can't be created if prometheus label name is invalid", func() {
+				cfg.Prometheus.Labels = map[string]string{"__instance": "dns1"}
+
+				_, err := NewServer(&cfg)
+
+				Expect(err).Should(MatchError("invalid prometheus label name '__instance'"))
+			})
 		})
 	})
 
@@ -639,6 +969,22 @@ var _ = Describe("Running DNS server", func() {
 		})
 	})
 
+	Describe("max response size", func() {
+		It("should use the EDNS udp size for UDP", func() {
+			request := new(dns.Msg)
+			Expect(getMaxResponseSize("udp", request)).Should(Equal(dns.MinMsgSize))
+
+			request.SetEdns0(1232, true)
+			Expect(getMaxResponseSize("udp", request)).Should(Equal(1232))
+		})
+
+		It("should not limit TCP responses to the EDNS udp size", func() {
+			request := new(dns.Msg)
+			request.SetEdns0(1232, true)
+			Expect(getMaxResponseSize("tcp", request)).Should(Equal(dns.MaxMsgSize))
+		})
+	})
+
 })
 
 func requestServer(request *dns.Msg) *dns.Msg {
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/0xERR0R/blocky/config"
+	"github.com/miekg/dns"
+)
+
+// unixSocketPrefix marks a listen address as path of a unix domain socket, e.g. "unix:/run/blocky/dns.sock"
+const unixSocketPrefix = "unix:"
+
+func isUnixSocket(address string) bool {
+	return strings.HasPrefix(address, unixSocketPrefix)
+}
+
+func unixSocketPath(address string) string {
+	return strings.TrimPrefix(address, unixSocketPrefix)
+}
+
+// listenUnixSocket creates a listener on the socket path. A stale socket file from a previous run is removed
+func listenUnixSocket(address string) (net.Listener, error) {
+	path := unixSocketPath(address)
+
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("can't remove stale socket file %s: %w", path, err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// createUnixServer creates a DNS server on a unix domain socket. Messages use the TCP wire format
+func createUnixServer(address string) (*dns.Server, error) {
+	listener, err := listenUnixSocket(address)
+	if err != nil {
+		return nil, fmt.Errorf("start unix socket listener on %s failed: %w", address, err)
+	}
+
+	return &dns.Server{
+		Addr:     address,
+		Net:      "unix",
+		Listener: listener,
+		Handler:  dns.NewServeMux(),
+		NotifyStartedFunc: func() {
+			logger().Infof("unix socket server is up and running on %s", unixSocketPath(address))
+		},
+	}, nil
+}
+
+// removeUnixSockets removes the socket files of all unix domain socket addresses
+func removeUnixSockets(addresses ...config.ListenConfig) {
+	for _, list := range addresses {
+		for _, address := range list {
+			if isUnixSocket(address) {
+				if err := os.Remove(unixSocketPath(address)); err != nil && !os.IsNotExist(err) {
+					logger().Warnf("can't remove socket file %s: %v", unixSocketPath(address), err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/0xERR0R/blocky/api"
+	"github.com/0xERR0R/blocky/config"
+	. "github.com/0xERR0R/blocky/helpertest"
+	"github.com/0xERR0R/blocky/util"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// streamConn hides the net.PacketConn interface of the unix connection, so dns.Conn uses the TCP wire format
+type streamConn struct {
+	net.Conn
+}
+
+var _ = Describe("Unix domain socket", func() {
+	var (
+		dir                  string
+		dnsSocket, apiSocket string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		// short path: socket paths are limited to ~100 characters
+		dir, err = os.MkdirTemp("", "blocky")
+		Expect(err).Should(Succeed())
+		DeferCleanup(os.RemoveAll, dir)
+
+		dnsSocket = filepath.Join(dir, "dns.sock")
+		apiSocket = filepath.Join(dir, "api.sock")
+	})
+
+	Describe("Listener creation", func() {
+		When("stale socket file exists", func() {
+			It("should remove it and listen", func() {
+				stale, err := net.Listen("unix", dnsSocket)
+				Expect(err).Should(Succeed())
+				// keep the socket file as left over by a crashed process
+				stale.(*net.UnixListener).SetUnlinkOnClose(false)
+				Expect(stale.Close()).Should(Succeed())
+				Expect(dnsSocket).Should(BeAnExistingFile())
+
+				listener, err := listenUnixSocket("unix:" + dnsSocket)
+				Expect(err).Should(Succeed())
+				Expect(listener.Close()).Should(Succeed())
+			})
+		})
+		When("path is a regular file", func() {
+			It("should not remove it and fail", func() {
+				Expect(os.WriteFile(dnsSocket, []byte("data"), 0o600)).Should(Succeed())
+
+				_, err := listenUnixSocket("unix:" + dnsSocket)
+				Expect(err).Should(HaveOccurred())
+				Expect(dnsSocket).Should(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("Server with unix socket addresses", func() {
+		It("should answer DNS and API requests and remove the socket files on stop", func() {
+			server, err := NewServer(&config.Config{
+				Upstream: config.UpstreamConfig{
+					ExternalResolvers: map[string][]config.Upstream{
+						"default": {config.Upstream{Net: config.NetProtocolTcpUdp, Host: "4.4.4.4", Port: 53}}}},
+				CustomDNS: config.CustomDNSConfig{
+					Mapping: config.CustomDNSMapping{
+						HostIPs: map[string][]net.IP{
+							"custom.lan": {net.ParseIP("192.168.178.55")},
+						},
+					}},
+				Blocking:  config.BlockingConfig{BlockType: "zeroIp"},
+				DNSPorts:  config.ListenConfig{"unix:" + dnsSocket},
+				HTTPPorts: config.ListenConfig{"unix:" + apiSocket},
+			})
+			Expect(err).Should(Succeed())
+
+			server.Start()
+
+			By("DNS query via unix socket", func() {
+				var conn net.Conn
+
+				Eventually(func() error {
+					conn, err = net.Dial("unix", dnsSocket)
+
+					return err
+				}, "1s").Should(Succeed())
+
+				defer conn.Close()
+
+				co := &dns.Conn{Conn: streamConn{conn}}
+				Expect(co.WriteMsg(util.NewMsgWithQuestion("custom.lan.", dns.TypeA))).Should(Succeed())
+
+				resp, err := co.ReadMsg()
+				Expect(err).Should(Succeed())
+				Expect(resp.Answer).Should(BeDNSRecord("custom.lan.", dns.TypeA, 0, "192.168.178.55"))
+			})
+
+			By("API request via unix socket", func() {
+				client := http.Client{Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, "unix", apiSocket)
+					},
+				}}
+
+				resp, err := client.Get("http://localhost" + api.PathReadiness)
+				Expect(err).Should(Succeed())
+				defer resp.Body.Close()
+
+				Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			})
+
+			server.Stop()
+
+			Expect(dnsSocket).ShouldNot(BeAnExistingFile())
+			Expect(apiSocket).ShouldNot(BeAnExistingFile())
+		})
+	})
+})
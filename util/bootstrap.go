@@ -19,12 +19,10 @@ func Dialer(cfg *config.Config) *net.Dialer {
 			dns := net.JoinHostPort(cfg.BootstrapDNS.Host, fmt.Sprint(cfg.BootstrapDNS.Port))
 			log.Log().Debugf("using %s as bootstrap dns server", dns)
 
+			d := bootstrapDialer(cfg)
 			resolver = &net.Resolver{
 				PreferGo: true,
 				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-					d := net.Dialer{
-						Timeout: time.Millisecond * time.Duration(2000),
-					}
 					return d.DialContext(ctx, "udp", dns)
 				}}
 		} else {
@@ -37,3 +35,87 @@ func Dialer(cfg *config.Config) *net.Dialer {
 		Resolver: resolver,
 	}
 }
+
+// bootstrapDialer creates the dialer for the queries to the bootstrap DNS server, which is an upstream DNS server
+// and uses the configured source address
+func bootstrapDialer(cfg *config.Config) *net.Dialer {
+	d := &net.Dialer{
+		Timeout: time.Millisecond * time.Duration(2000),
+	}
+
+	if ip := sourceIP(cfg); ip != nil {
+		d.LocalAddr = &net.UDPAddr{IP: ip}
+	}
+
+	return d
+}
+
+// UpstreamDialer creates a new dialer instance for the passed network (tcp or udp), which uses the configured
+// source address for the connections to the upstream DNS servers
+func UpstreamDialer(cfg *config.Config, network string) *net.Dialer {
+	d := Dialer(cfg)
+
+	if ip := sourceIP(cfg); ip != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: ip}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+
+	return d
+}
+
+// sourceIP returns the configured source address, nil if not configured. For a network interface, the first IPv4
+// address of the interface is used, the first IPv6 address if the interface has no IPv4 address
+func sourceIP(cfg *config.Config) net.IP {
+	if cfg.UpstreamSourceAddress == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(cfg.UpstreamSourceAddress); ip != nil {
+		return ip
+	}
+
+	ip, err := interfaceIP(cfg.UpstreamSourceAddress)
+	if err != nil {
+		log.Log().Fatalf("can't use upstream source address: %v", err)
+	}
+
+	return ip
+}
+
+func interfaceIP(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("network interface '%s' not found: %w", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read the addresses of network interface '%s': %w", name, err)
+	}
+
+	var result net.IP
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+
+		if result == nil {
+			result = ipNet.IP
+		}
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf("network interface '%s' has no IP address", name)
+	}
+
+	return result, nil
+}
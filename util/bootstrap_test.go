@@ -1,6 +1,8 @@
 package util
 
 import (
+	"net"
+
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/helpertest"
 	. "github.com/onsi/ginkgo/v2"
@@ -47,4 +49,53 @@ var _ = Describe("Bootstrap resolver configuration", func() {
 
 	})
 
+	Describe("Upstream dialer", func() {
+		When("source address is not configured", func() {
+			It("should not bind to a local address", func() {
+				Expect(UpstreamDialer(&config.Config{}, "udp").LocalAddr).Should(BeNil())
+			})
+		})
+		When("source address is configured", func() {
+			cfg := &config.Config{UpstreamSourceAddress: "192.168.178.2"}
+
+			It("should bind udp connections to the source address", func() {
+				Expect(UpstreamDialer(cfg, "udp").LocalAddr).Should(Equal(&net.UDPAddr{IP: net.ParseIP("192.168.178.2")}))
+			})
+			It("should bind tcp connections to the source address", func() {
+				Expect(UpstreamDialer(cfg, "tcp").LocalAddr).Should(Equal(&net.TCPAddr{IP: net.ParseIP("192.168.178.2")}))
+			})
+			It("should bind the queries to the bootstrap DNS server to the source address", func() {
+				Expect(bootstrapDialer(cfg).LocalAddr).Should(Equal(&net.UDPAddr{IP: net.ParseIP("192.168.178.2")}))
+				Expect(bootstrapDialer(&config.Config{}).LocalAddr).Should(BeNil())
+			})
+		})
+		When("network interface is configured", func() {
+			It("should bind the connections to the address of the interface", func() {
+				lo := loopbackInterface()
+
+				Expect(UpstreamDialer(&config.Config{UpstreamSourceAddress: lo.Name}, "udp").LocalAddr.(*net.UDPAddr).IP.
+					IsLoopback()).Should(BeTrue())
+			})
+			It("should fail for a not existing interface", func() {
+				_, err := interfaceIP("notexisting0")
+
+				Expect(err).Should(MatchError(ContainSubstring("network interface 'notexisting0' not found")))
+			})
+		})
+	})
 })
+
+func loopbackInterface() net.Interface {
+	ifaces, err := net.Interfaces()
+	Expect(err).Should(Succeed())
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface
+		}
+	}
+
+	Skip("no loopback interface")
+
+	return net.Interface{}
+}
@@ -3,11 +3,14 @@ package util
 import (
 	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"net"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/0xERR0R/blocky/config"
 	"github.com/0xERR0R/blocky/log"
@@ -27,6 +30,42 @@ func Obfuscate(in string) string {
 	return in
 }
 
+const (
+	redacted           = "*****"
+	urlSchemeDelimiter = "://"
+)
+
+var (
+	urlPassword      = regexp.MustCompile(`(://[^:/@]*:)[^@]*@`)
+	dsnPassword      = regexp.MustCompile(`^([^:/@]*:)[^@]*@`)
+	keyValuePassword = regexp.MustCompile(`(?i)(password=)[^\s&]*`)
+)
+
+// RedactCredentials replaces the password of a database DSN or URL ("user:password@" or "password=...") with *****
+func RedactCredentials(in string) string {
+	if strings.Contains(in, urlSchemeDelimiter) {
+		in = urlPassword.ReplaceAllString(in, "${1}"+redacted+"@")
+	} else {
+		in = dsnPassword.ReplaceAllString(in, "${1}"+redacted+"@")
+	}
+
+	return keyValuePassword.ReplaceAllString(in, "${1}"+redacted)
+}
+
+// RedactURL returns only the scheme and host of the URL, path and query of e.g. webhooks often contain secret tokens
+func RedactURL(in string) string {
+	u, err := url.Parse(in)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+
+	if u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" {
+		return u.Scheme + urlSchemeDelimiter + u.Host
+	}
+
+	return u.Scheme + urlSchemeDelimiter + u.Host + "/" + redacted
+}
+
 // AnswerToString creates a user-friendly representation of an answer
 func AnswerToString(answer []dns.RR) string {
 	answers := make([]string, len(answer))
@@ -221,8 +260,73 @@ func CidrContainsIP(cidr string, ip net.IP) bool {
 	return ipnet.Contains(ip)
 }
 
+// ParseReverseAddr returns the IP address of a complete reverse name (in-addr.arpa or ip6.arpa),
+// nil if the name is not a reverse name of a single address
+func ParseReverseAddr(name string) net.IP {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if v4 := strings.TrimSuffix(name, ".in-addr.arpa"); v4 != name {
+		labels := strings.Split(v4, ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	}
+
+	if v6 := strings.TrimSuffix(name, ".ip6.arpa"); v6 != name {
+		labels := strings.Split(v6, ".")
+		if len(labels) != 2*net.IPv6len {
+			return nil
+		}
+
+		var b strings.Builder
+
+		for i := len(labels) - 1; i >= 0; i-- {
+			if len(labels[i]) != 1 {
+				return nil
+			}
+
+			b.WriteString(labels[i])
+
+			if i%4 == 0 && i > 0 {
+				b.WriteString(":")
+			}
+		}
+
+		return net.ParseIP(b.String())
+	}
+
+	return nil
+}
+
 // ClientNameMatchesGroupName checks if a group with optional wildcards contains a client name
 func ClientNameMatchesGroupName(group string, clientName string) bool {
 	match, _ := filepath.Match(group, clientName)
 	return match
 }
+
+// ApplyJitter reduces the duration by a random amount of up to the passed percentage.
+// This spreads periodic tasks of multiple instances over time
+func ApplyJitter(d time.Duration, jitterPercent uint) time.Duration {
+	const maxPercent = 100
+
+	if jitterPercent == 0 || d <= 0 {
+		return d
+	}
+
+	if jitterPercent > maxPercent {
+		jitterPercent = maxPercent
+	}
+
+	maxJitter := int64(d) * int64(jitterPercent) / maxPercent
+	if maxJitter <= 0 {
+		return d
+	}
+
+	return d - time.Duration(rand.Int63n(maxJitter+1))
+}